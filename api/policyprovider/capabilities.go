@@ -0,0 +1,40 @@
+package policyprovider
+
+/*
+Capabilities describes which IDQL policy features a Provider is able to represent on its platform. Policies that use a
+feature the platform does not support are either rejected or changed in meaning when set (see sdk.CheckPolicies).
+*/
+type Capabilities struct {
+	Conditions      bool // Policy conditions are supported
+	DenyConditions  bool // Conditions with a "deny" action are supported
+	Scopes          bool // Policy scopes (obligations returned to a PEP) are supported
+	Templates       bool // Policy templates with slots (e.g. ?principal and ?resource) are supported
+	Wildcards       bool // Policies may match all subjects (any, anyAuthenticated or none), all actions (none) or all objects (none)
+	MultipleActions bool // More than one action per policy is supported
+	Objects         bool // The policy object is applied by the platform (when false the object is ignored)
+
+	// SubjectTypes, when not empty, are the subject forms the platform accepts. Values ending in ':' are prefixes
+	// (e.g. "user:"), other values must match exactly.
+	SubjectTypes []string
+	// ActionTypes, when not empty, are the action forms the platform accepts (e.g. "http:"), matched as for SubjectTypes.
+	ActionTypes []string
+}
+
+// FullCapabilities describes a Provider that can represent every IDQL policy feature (e.g. one that stores IDQL directly)
+var FullCapabilities = Capabilities{
+	Conditions:      true,
+	DenyConditions:  true,
+	Scopes:          true,
+	Templates:       true,
+	Wildcards:       true,
+	MultipleActions: true,
+	Objects:         true,
+}
+
+/*
+CapabilityProvider is implemented by providers that advertise the IDQL features their platform supports. Providers that
+do not implement CapabilityProvider are assumed to have FullCapabilities.
+*/
+type CapabilityProvider interface {
+	Capabilities() Capabilities
+}
@@ -0,0 +1,64 @@
+package policyprovider
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+)
+
+/*
+ContextProvider is implemented by providers whose platform requests accept a context.Context, so that a caller's
+deadline or cancellation stops discovery, retrieval and update of policy. The Provider methods of a ContextProvider are
+the equivalent of calling these methods with context.Background().
+*/
+type ContextProvider interface {
+	Provider
+
+	DiscoverApplicationsContext(context.Context, IntegrationInfo) ([]ApplicationInfo, error)
+
+	GetPolicyInfoContext(context.Context, IntegrationInfo, ApplicationInfo) ([]hexapolicy.PolicyInfo, error)
+
+	SetPolicyInfoContext(context.Context, IntegrationInfo, ApplicationInfo, []hexapolicy.PolicyInfo) (status int, foundErr error)
+}
+
+// ContextReconciler is implemented by V2 providers whose Reconcile accepts a context (see ContextProvider)
+type ContextReconciler interface {
+	ReconcileContext(context.Context, IntegrationInfo, ApplicationInfo, []hexapolicy.PolicyInfo, bool) ([]hexapolicy.PolicyDif, error)
+}
+
+/*
+WithContext returns the provider as a ContextProvider. A provider that does not implement ContextProvider is adapted so
+that a request is not started once the context is done. A request already started by such a provider is not interrupted.
+*/
+func WithContext(provider Provider) ContextProvider {
+	if cp, ok := provider.(ContextProvider); ok {
+		return cp
+	}
+	return contextAdapter{provider}
+}
+
+type contextAdapter struct {
+	Provider
+}
+
+func (a contextAdapter) DiscoverApplicationsContext(ctx context.Context, info IntegrationInfo) ([]ApplicationInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.DiscoverApplications(info)
+}
+
+func (a contextAdapter) GetPolicyInfoContext(ctx context.Context, info IntegrationInfo, app ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.GetPolicyInfo(info, app)
+}
+
+func (a contextAdapter) SetPolicyInfoContext(ctx context.Context, info IntegrationInfo, app ApplicationInfo, policies []hexapolicy.PolicyInfo) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return a.SetPolicyInfo(info, app, policies)
+}
@@ -5,6 +5,7 @@ integrates with.
 package policyprovider
 
 import (
+	"github.com/hexa-org/policy-mapper/models/policyInfoModel"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 )
 
@@ -50,3 +51,28 @@ type V2Provider interface {
 
 	Reconcile(IntegrationInfo, ApplicationInfo, []hexapolicy.PolicyInfo, bool) ([]hexapolicy.PolicyDif, error)
 }
+
+/*
+MappingReporter is implemented by providers that can report how faithfully IDQL policies are represented when set on
+the platform (e.g. conditions the platform cannot express). MapPolicyReport does not change the platform.
+*/
+type MappingReporter interface {
+	MapPolicyReport(IntegrationInfo, ApplicationInfo, []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error)
+}
+
+/*
+SchemaManager is implemented by providers whose platform holds a schema of the entities and actions used by policy
+(e.g. the Cedar schema of an AVP policy store). The schema is represented as a policy information model.
+*/
+type SchemaManager interface {
+	GetSchema(IntegrationInfo, ApplicationInfo) (*policyInfoModel.Namespaces, error)
+	SetSchema(IntegrationInfo, ApplicationInfo, policyInfoModel.Namespaces) error
+}
+
+/*
+ApplicationCreator is implemented by providers that can provision a new policy application point (e.g. an AVP policy
+store). Settings are provider specific.
+*/
+type ApplicationCreator interface {
+	CreateApplication(info IntegrationInfo, description string, settings map[string]string) (ApplicationInfo, error)
+}
@@ -16,15 +16,19 @@ import (
 
 	"github.com/alecthomas/kong"
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/formats/casbin"
 	"github.com/hexa-org/policy-mapper/models/formats/cedar"
 	"github.com/hexa-org/policy-mapper/models/formats/gcpBind"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/policyReport"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicysupport"
+	"github.com/hexa-org/policy-mapper/providers/aws/awscommon"
 	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/pmezard/go-difflib/difflib"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
-var MapFormats = []string{"gcp", "cedar"}
+var MapFormats = []string{"gcp", "cedar", "cedar-json", "casbin"}
 
 var seperatorline = "==============================================================================="
 
@@ -81,6 +85,7 @@ func getFile(path string) []byte {
 type AddGcpIntegrationCmd struct {
 	Alias string `arg:"" optional:"" help:"A new local alias that will be used to refer to the integration in subsequent operations. Defaults to an auto-generated alias"`
 	File  string `short:"f" xor:"Keyid" required:"" help:"A GCP service account credentials file"`
+	Iam   bool   `help:"Manage the IAM policies of the project, its folders, Cloud Storage buckets and Pub/Sub topics instead of IAP"`
 }
 
 func (a *AddGcpIntegrationCmd) Help() string {
@@ -98,6 +103,10 @@ func (a *AddGcpIntegrationCmd) Help() string {
   "client_x509_cert_url": "https://www.googleapis.com/robot/v1/metadata/x509/google-cloud-project-id%google-cloud-project-id.iam.gserviceaccount.com"
 }
 
+By default, the integration manages Identity-Aware Proxy (IAP) policies for App Engine and backend services. Specify --iam
+to manage the Resource Manager IAM policies of the project, the folders containing it, and its Cloud Storage buckets and
+Pub/Sub topics.
+
 Once a GCP integration is added, it is saved for future use with the supplied alias name.
 `
 }
@@ -129,6 +138,9 @@ func (a *AddGcpIntegrationCmd) Run(cli *CLI) error {
 		Name: sdk.ProviderTypeGoogleCloudIAP,
 		Key:  keyStr,
 	}
+	if a.Iam {
+		info.Name = sdk.ProviderTypeGoogleCloudIAM
+	}
 
 	integration, err := openIntegration(alias, sdk.WithIntegrationInfo(info))
 	if err != nil {
@@ -335,16 +347,22 @@ func (a *AddOpaIntegrationCmd) Run(cli *CLI) error {
 }
 
 type AddAwsIntegrationCmd struct {
-	Type   string  `arg:"" required:"" help:"Type of AWS integration: avp, cognito, or apigw"`
-	Alias  string  `arg:"" optional:"" help:"A new local alias that will be used to refer to the integration in subsequent operations. Defaults to an auto-generated alias"`
-	Region *string `short:"r" help:"The Amazon data center (e.g. us-west-1)"`
-	Keyid  *string `short:"k" help:"Amazon Access Key ID"`
-	Secret *string `short:"s" help:"Secret access key"`
-	File   string  `short:"f" xor:"Keyid" help:"File containing the Amazon credential information"`
+	Type                 string  `arg:"" required:"" help:"Type of AWS integration: avp, cognito, apigw, or iam"`
+	Alias                string  `arg:"" optional:"" help:"A new local alias that will be used to refer to the integration in subsequent operations. Defaults to an auto-generated alias"`
+	Region               *string `short:"r" help:"The Amazon data center (e.g. us-west-1)"`
+	Keyid                *string `short:"k" help:"Amazon Access Key ID"`
+	Secret               *string `short:"s" help:"Secret access key"`
+	Token                *string `help:"Session token of temporary credentials (used with --keyid and --secret)"`
+	Profile              *string `help:"A named profile from the AWS shared config and credentials files"`
+	Defaultchain         bool    `help:"Use the AWS default credential chain (environment variables, instance or container roles)"`
+	Rolearn              *string `help:"The ARN of a role to assume using STS"`
+	Externalid           *string `help:"The external id required to assume the role (used with --rolearn)"`
+	Webidentitytokenfile *string `help:"File containing an OIDC token used to assume the role (used with --rolearn)"`
+	File                 string  `short:"f" xor:"Keyid" help:"File containing the Amazon credential information"`
 }
 
 func (a *AddAwsIntegrationCmd) Help() string {
-	return `To add an Amazon integration specify one of "avp", "cognito", or "apigw", and a credential by'
+	return `To add an Amazon integration specify one of "avp", "cognito", "apigw", or "iam", and a credential by'
 specifying either a file (--file) that contains AWS credentials looks like:
 {
   "accessKeyID": "aws-access-key-id",
@@ -352,7 +370,23 @@ specifying either a file (--file) that contains AWS credentials looks like:
   "region": "aws-region"
 }
 
-Or, use the parameters --region, --keyid, and --secret to specify the equivalent on the command line.
+The key may instead (or also) use temporary credentials, a profile, or a role to assume:
+{
+  "region": "aws-region",
+  "sessionToken": "session token used with accessKeyID and secretAccessKey",
+  "profile": "a profile in ~/.aws/config",
+  "defaultChain": true,
+  "roleArn": "arn:aws:iam::123456789012:role/hexa",
+  "externalId": "external id of the role",
+  "roleSessionName": "hexa-policy-mapper",
+  "webIdentityTokenFile": "file containing an OIDC token used to assume roleArn"
+}
+Only one of an access key, a profile, or "defaultChain" (the AWS default credential chain) may be given. A key with
+none of them must assume roleArn with a webIdentityTokenFile. Setting the environment variable
+HEXA_AWS_DENY_LONG_LIVED_KEYS=true rejects keys with an access key but no session token.
+
+Or, use the parameters --region, --keyid, --secret, --token, --profile, --defaultchain, --rolearn, --externalid and
+--webidentitytokenfile to specify the equivalent on the command line.
 
 Once the AWS integration is added, it is available for future use with the supplied alias name.
 `
@@ -360,8 +394,11 @@ Once the AWS integration is added, it is available for future use with the suppl
 
 func (a *AddAwsIntegrationCmd) AfterApply(_ *kong.Context) error {
 	if len(a.File) == 0 {
-		if a.Secret == nil || a.Keyid == nil || a.Region == nil {
-			return errors.New("must provide all of --keyid, --secret, and --region, or --file")
+		if a.Region == nil {
+			return errors.New("must provide --region (with --keyid and --secret, --profile, --defaultchain or --rolearn and --webidentitytokenfile), or --file")
+		}
+		if err := a.credentialsKey().Validate(false); err != nil {
+			return err
 		}
 	} else {
 		err := checkFile(a.File)
@@ -369,17 +406,38 @@ func (a *AddAwsIntegrationCmd) AfterApply(_ *kong.Context) error {
 			return err
 		}
 
-		if a.Secret != nil || a.Keyid != nil || a.Region != nil {
-			return errors.New("must provide all of --keyid, --secret, and --region, or --file")
+		if a.Secret != nil || a.Keyid != nil || a.Region != nil || a.Token != nil || a.Profile != nil || a.Defaultchain || a.Rolearn != nil || a.Externalid != nil || a.Webidentitytokenfile != nil {
+			return errors.New("must provide either --file or credential parameters, not both")
 		}
 	}
 
 	switch a.Type {
-	case "avp", "cognito", "apigw":
+	case "avp", "cognito", "apigw", "iam":
 		return nil
 	}
 
-	return errors.New("specify the AWS provider type: apigw, avp, or cognito")
+	return errors.New("specify the AWS provider type: apigw, avp, cognito, or iam")
+}
+
+// credentialsKey returns the integration key described by the command line parameters
+func (a *AddAwsIntegrationCmd) credentialsKey() awscommon.CredentialsKey {
+	value := func(param *string) string {
+		if param == nil {
+			return ""
+		}
+		return *param
+	}
+	return awscommon.CredentialsKey{
+		AccessKeyID:          value(a.Keyid),
+		SecretAccessKey:      value(a.Secret),
+		SessionToken:         value(a.Token),
+		Region:               value(a.Region),
+		Profile:              value(a.Profile),
+		DefaultChain:         a.Defaultchain,
+		RoleArn:              value(a.Rolearn),
+		ExternalId:           value(a.Externalid),
+		WebIdentityTokenFile: value(a.Webidentitytokenfile),
+	}
 }
 
 func (a *AddAwsIntegrationCmd) Run(cli *CLI) error {
@@ -399,11 +457,7 @@ func (a *AddAwsIntegrationCmd) Run(cli *CLI) error {
 	if len(a.File) != 0 {
 		keyStr = getFile(a.File)
 	} else {
-		keyStr = []byte(fmt.Sprintf(`{
-  "accessKeyID": "%s",
-  "secretAccessKey": "%s",
-  "region": "%s"
-}`, *a.Keyid, *a.Secret, *a.Region))
+		keyStr, _ = json.MarshalIndent(a.credentialsKey(), "", "  ")
 	}
 
 	var provType string // note: validation has already been done
@@ -414,6 +468,8 @@ func (a *AddAwsIntegrationCmd) Run(cli *CLI) error {
 		provType = sdk.ProviderTypeAwsApiGW
 	case "cognito":
 		provType = sdk.ProviderTypeCognito
+	case "iam":
+		provType = sdk.ProviderTypeAwsIam
 	}
 
 	info := policyprovider.IntegrationInfo{
@@ -437,6 +493,7 @@ type AddAzureIntegrationCmd struct {
 	Clientid *string `short:"c" help:"The Azure Service Principal Client Id (aka appId)"`
 	Secret   *string `short:"s" help:"The Azure registration secret"`
 	File     string  `short:"f" xor:"Keyid" required:"" help:"File containing the Azure credential information"`
+	Rbac     bool    `help:"Manage the Azure RBAC role assignments of subscriptions, resource groups and resources instead of app role assignments"`
 }
 
 func (a *AddAzureIntegrationCmd) Help() string {
@@ -449,6 +506,10 @@ func (a *AddAzureIntegrationCmd) Help() string {
 
 Or, use the parameters --tenant, --appid and --secret to specify the equivalent on the command line.
 
+By default, the integration manages the app role assignments of Entra ID (Azure AD) applications. Specify --rbac to
+manage the Azure Resource Manager role assignments of the subscriptions, resource groups and resources the service
+principal can read. To limit discovery to one subscription, add "subscription": "subscription-id" to the file.
+
 Once the Azure integration is added, it is available for future use with the supplied alias name.
 `
 }
@@ -500,6 +561,9 @@ func (a *AddAzureIntegrationCmd) Run(cli *CLI) error {
 		Name: sdk.ProviderTypeAzure,
 		Key:  keyStr,
 	}
+	if a.Rbac {
+		info.Name = sdk.ProviderTypeAzureRbac
+	}
 
 	integration, err := openIntegration(alias, sdk.WithIntegrationInfo(info))
 	if err != nil {
@@ -512,7 +576,7 @@ func (a *AddAzureIntegrationCmd) Run(cli *CLI) error {
 }
 
 type AddCmd struct {
-	Aws   AddAwsIntegrationCmd   `cmd:"" aliases:"amazon" help:"Add AWS Api Gateway, Cognito, or AVP integration"`
+	Aws   AddAwsIntegrationCmd   `cmd:"" aliases:"amazon" help:"Add AWS Api Gateway, Cognito, AVP, or IAM integration"`
 	Gcp   AddGcpIntegrationCmd   `cmd:"" aliases:"google" help:"Add a Google Cloud GCP integration"`
 	Azure AddAzureIntegrationCmd `cmd:"" aliases:"ms,microsoft" help:"Add an Azure RBAC integration"`
 	Opa   AddOpaIntegrationCmd   `cmd:"" help:"Add an Open Policy Agent (OPA) integration"`
@@ -580,6 +644,9 @@ func (a *GetPoliciesCmd) Run(cli *CLI) error {
 	fmt.Println(fmt.Sprintf("Policies retrieved for %s:", a.Alias))
 
 	_ = MarshalJsonNoEscape(policies, os.Stdout)
+	if format := hexapolicysupport.FormatOf(cli.Output); format == hexapolicysupport.FormatYaml || format == hexapolicysupport.FormatJsonLines {
+		return writePolicyOutput(cli, policies.Policies, format)
+	}
 	outWriter := cli.GetOutputWriter()
 	_ = MarshalJsonNoEscape(policies, outWriter.GetOutput())
 	outWriter.Close()
@@ -590,11 +657,12 @@ func (a *GetPoliciesCmd) Run(cli *CLI) error {
 type GetCmd struct {
 	Paps     GetPolicyApplicationsCmd `cmd:"" aliases:"apps,applications" help:"Retrieve or discover policy application points from the specified integration alias"`
 	Policies GetPoliciesCmd           `cmd:"" aliases:"pol" help:"Get and map policies from a PAP."`
+	Schema   GetSchemaCmd             `cmd:"" help:"Get the schema (policy model) of a PAP, or its differences with the loaded policy model"`
 }
 
 type SetPoliciesCmd struct {
 	Alias       string `arg:"" required:"" help:"The alias or object id of a PAP (application) where policies are to be set/reconciled with specified policies"`
-	File        string `short:"f" required:"" type:"path" help:"A file containing IDQL policy to be applied (REQUIRED)"`
+	File        string `short:"f" required:"" type:"path" help:"A file containing IDQL policy (JSON, YAML or JSON Lines) to be applied (REQUIRED)"`
 	Differences bool   `optional:"" default:"false" short:"d" help:"When specified, the list of changes to be applied will be shown before confirming change (if supported by provider)"`
 }
 
@@ -609,6 +677,12 @@ func (s *SetPoliciesCmd) Run(cli *CLI) error {
 		return err
 	}
 
+	// Reject policies that use features the provider does not support
+	err = integration.CheckPolicies(policies)
+	if err != nil {
+		return err
+	}
+
 	if s.Differences {
 		diffs, err := integration.ReconcilePolicy(s.Alias, policies, false)
 		if errors.Is(err, errors.New("provider does not support reconcile")) {
@@ -624,6 +698,17 @@ func (s *SetPoliciesCmd) Run(cli *CLI) error {
 		}
 	}
 
+	// Warn of policy elements the provider cannot represent (if supported by the provider)
+	report, err := integration.GetMappingReport(s.Alias, policies)
+	switch {
+	case err != nil:
+		fmt.Println("No policy mapping report is available: " + err.Error())
+		fmt.Println()
+	case report.IsLossy():
+		fmt.Println(report.String())
+		fmt.Println()
+	}
+
 	msg := fmt.Sprintf("Applying %d policies to %s", len(policies), s.Alias)
 	fmt.Println(msg)
 	if ConfirmProceed("Update policies Y|[n]?") {
@@ -648,6 +733,7 @@ func (s *SetPoliciesCmd) Run(cli *CLI) error {
 
 type SetCmd struct {
 	Policies SetPoliciesCmd `cmd:"" aliases:"pol,policy" help:"Set policies at a policy application point"`
+	Schema   SetSchemaCmd   `cmd:"" help:"Replace the schema of a policy application point with a policy model"`
 }
 
 type ShowIntegrationCmd struct {
@@ -729,8 +815,9 @@ type ShowCmd struct {
 }
 
 type MapToCmd struct {
-	Format string `arg:"" required:"" help:"Target format: gcp, or cedar"`
-	File   string `arg:"" type:"path" help:"A file containing IDQL policy to be mapped"`
+	Format string `arg:"" required:"" help:"Target format: gcp, cedar, cedar-json, or casbin"`
+	File   string `arg:"" type:"path" help:"A file containing IDQL policy (JSON, YAML or JSON Lines) to be mapped"`
+	Model  string `short:"m" type:"path" help:"For casbin, a file where the generated model.conf is to be written"`
 }
 
 func (m *MapToCmd) AfterApply(_ *kong.Context) error {
@@ -751,29 +838,58 @@ func (m *MapToCmd) Run(cli *CLI) error {
 	switch strings.ToLower(m.Format) {
 	case "gcp":
 		gcpMapper := gcpBind.New(map[string]string{})
-		bindings := gcpMapper.MapPoliciesToBindings(policies)
+		bindings, report := gcpMapper.MapPoliciesToBindingsReport(policies)
 		_ = MarshalJsonNoEscape(bindings, os.Stdout)
 		outWriter := cli.GetOutputWriter()
 		_ = MarshalJsonNoEscape(bindings, outWriter.GetOutput())
 		outWriter.Close()
+		fmt.Println(report.String())
 	case "cedar":
 		cMapper := cedar.NewCedarMapper(map[string]string{})
 
-		cedarPoliciesString, err := cMapper.MapHexaPolicies(m.File, policies)
-		if err != nil {
-			return err
-		}
+		cedarPoliciesString, report := cMapper.MapHexaPoliciesReport(m.File, policies)
 
 		fmt.Println(cedarPoliciesString)
 		cli.GetOutputWriter().WriteString(cedarPoliciesString, false)
 		cli.GetOutputWriter().Close()
+		fmt.Println(report.String())
+	case "cedar-json":
+		cMapper := cedar.NewCedarMapper(map[string]string{})
+
+		cedarJsonBytes, report, err := cMapper.MapHexaPoliciesToJsonReport(m.File, policies)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(cedarJsonBytes))
+		cli.GetOutputWriter().WriteBytes(cedarJsonBytes, true)
+		fmt.Println(report.String())
+		return droppedPoliciesError(report)
+	case "casbin":
+		cMapper := casbin.NewCasbinMapper(map[string]string{})
+		policySet, report := cMapper.MapHexaPoliciesReport(policies)
+		var err error
+		modelString := policySet.Model.String()
+		policyString := policySet.PolicyString()
+		if m.Model != "" {
+			err = os.WriteFile(m.Model, []byte(modelString), 0644)
+			if err != nil {
+				return err
+			}
+		} else {
+			fmt.Println(modelString)
+		}
+		fmt.Println(policyString)
+		cli.GetOutputWriter().WriteString(policyString, true)
+		fmt.Println(report.String())
 	}
 	return nil
 }
 
 type MapFromCmd struct {
-	Format string `arg:"" required:"" help:"Input format: gcp, or cedar"`
+	Format string `arg:"" required:"" help:"Input format: gcp, cedar, cedar-json, or casbin"`
 	File   string `arg:"" type:"path" help:"A file containing policy to be mapped into IDQL"`
+	Model  string `short:"m" type:"path" help:"For casbin, the model.conf file used to interpret the policy file (defaults to the Hexa model)"`
 }
 
 func (m *MapFromCmd) AfterApply(_ *kong.Context) error {
@@ -787,6 +903,7 @@ func (m *MapFromCmd) AfterApply(_ *kong.Context) error {
 func (m *MapFromCmd) Run(cli *CLI) error {
 	fmt.Println(fmt.Sprintf("Mapping from %s to IDQL", m.Format))
 	var policies []hexapolicy.PolicyInfo
+	var report *hexapolicy.MappingReport
 	switch strings.ToLower(m.Format) {
 	case "gcp":
 		gcpMapper := gcpBind.New(map[string]string{})
@@ -805,21 +922,75 @@ func (m *MapFromCmd) Run(cli *CLI) error {
 		if err != nil {
 			return err
 		}
-		pols, err := cMapper.MapCedarPolicyBytes(m.File, policyBytes)
+		pols, cedarReport, err := cMapper.MapCedarPolicyBytesReport(m.File, policyBytes)
 		if err != nil {
 			return err
 		}
 		policies = pols.Policies
+		report = cedarReport
+
+	case "cedar-json":
+		cMapper := cedar.NewCedarMapper(map[string]string{})
+		policyBytes, err := os.ReadFile(m.File)
+		if err != nil {
+			return err
+		}
+		pols, cedarReport, err := cMapper.MapCedarJsonPolicyBytesReport(m.File, policyBytes)
+		if err != nil {
+			return err
+		}
+		policies = pols.Policies
+		report = cedarReport
+
+	case "casbin":
+		cMapper := casbin.NewCasbinMapper(map[string]string{})
+		var err error
+		policies, err = cMapper.MapCasbinFiles(m.Model, m.File)
+		if err != nil {
+			return err
+		}
 	}
 
 	_ = MarshalJsonNoEscape(policies, os.Stdout)
-	outWriter := cli.GetOutputWriter()
-	err := MarshalJsonNoEscape(policies, outWriter.GetOutput())
-	if err != nil {
-		fmt.Println(err.Error())
+	if format := hexapolicysupport.FormatOf(cli.Output); format == hexapolicysupport.FormatYaml || format == hexapolicysupport.FormatJsonLines {
+		err := writePolicyOutput(cli, policies, format)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	} else {
+		outWriter := cli.GetOutputWriter()
+		err := MarshalJsonNoEscape(policies, outWriter.GetOutput())
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		outWriter.WriteString("", true)
+	}
+	if report != nil {
+		fmt.Println(report.String())
 	}
-	outWriter.WriteString("", true)
 
+	if strings.EqualFold(m.Format, "cedar-json") {
+		return droppedPoliciesError(report)
+	}
+	return nil
+}
+
+// droppedPoliciesError returns an error when the report records policies that could not be mapped at all
+func droppedPoliciesError(report *hexapolicy.MappingReport) error {
+	if report == nil {
+		return nil
+	}
+	dropped := 0
+	for _, policy := range report.Policies {
+		for _, element := range policy.Elements {
+			if element.Element == hexapolicy.MapElementPolicy && element.Fidelity == hexapolicy.FidelityDropped {
+				dropped++
+			}
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("%d of the policies could not be mapped", dropped)
+	}
 	return nil
 }
 
@@ -841,11 +1012,7 @@ func (r *ReconcileCmd) Run(cli *CLI) error {
 	var err error
 	var comparePolicies []hexapolicy.PolicyInfo
 	if appCompare == nil {
-		policyBytes, err := os.ReadFile(r.AliasCompare)
-		if err != nil {
-			return err
-		}
-		comparePolicies, err = hexapolicysupport.ParsePolicies(policyBytes)
+		comparePolicies, err = hexapolicysupport.ParsePolicyFile(r.AliasCompare)
 		if err != nil {
 			return err
 		}
@@ -862,16 +1029,12 @@ func (r *ReconcileCmd) Run(cli *CLI) error {
 
 	if appSource == nil {
 		// try file path
-		policyBytes, err := os.ReadFile(r.AliasSource)
-		if err != nil {
-			return err
-		}
-		hexaPolicies, err := hexapolicysupport.ParsePolicies(policyBytes)
+		hexaPolicies, err := hexapolicysupport.ParsePolicyFile(r.AliasSource)
 		if err != nil {
 			return err
 		}
 		sourcePolicies = &hexapolicy.Policies{Policies: hexaPolicies}
-		difs = sourcePolicies.ReconcilePolicies(comparePolicies, r.Differences)
+		difs = sourcePolicies.ReconcilePoliciesWithScopes(comparePolicies, r.Differences)
 	} else {
 		difs, err = sourceIntegration.ReconcilePolicy(r.AliasSource, comparePolicies, r.Differences)
 		if err != nil {
@@ -891,6 +1054,111 @@ func (r *ReconcileCmd) Run(cli *CLI) error {
 	return nil
 }
 
+type MigrateCmd struct {
+	File   string `arg:"" required:"" type:"path" help:"A file containing IDQL policies (JSON, YAML or JSON Lines) to be upgraded in place to the current IDQL version"`
+	DryRun bool   `optional:"" short:"n" default:"false" help:"Show the changes and file differences without updating the file"`
+}
+
+func (m *MigrateCmd) Run(cli *CLI) error {
+	original, err := os.ReadFile(m.File)
+	if err != nil {
+		return err
+	}
+	format := hexapolicysupport.FormatOf(m.File)
+	if format == "" {
+		format = hexapolicysupport.DetectFormat(original)
+	}
+
+	policies, report, err := hexapolicysupport.MigratePoliciesFormat(original, format)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report.String())
+	output, _ := json.MarshalIndent(report, "", "  ")
+	cli.GetOutputWriter().WriteBytes(output, true)
+	if !report.Changed() {
+		return nil
+	}
+
+	var migrated []byte
+	if format == hexapolicysupport.FormatJson {
+		buf := &strings.Builder{}
+		if err = MarshalJsonNoEscape(hexapolicy.Policies{Policies: policies}, buf); err != nil {
+			return err
+		}
+		migrated = []byte(buf.String())
+	} else {
+		migrated, err = hexapolicysupport.ToFormatBytes(policies, format)
+		if err != nil {
+			return err
+		}
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(original)),
+		B:        difflib.SplitLines(string(migrated)),
+		FromFile: m.File,
+		ToFile:   m.File + " (migrated)",
+		Context:  2,
+	})
+	fmt.Println()
+	fmt.Println(diff)
+
+	if m.DryRun {
+		return nil
+	}
+	if ConfirmProceed(fmt.Sprintf("Update %s Y|[n]? ", m.File)) {
+		if err = os.WriteFile(m.File, migrated, 0644); err != nil {
+			return err
+		}
+		fmt.Println(fmt.Sprintf("%s migrated to IDQL %s.", m.File, hexapolicy.IdqlVersion))
+	}
+	return nil
+}
+
+type ReportCmd struct {
+	Source    string `arg:"" required:"" help:"The alias of a Policy Application, or a file path to a file containing IDQL policies to be reported"`
+	Format    string `optional:"" short:"f" enum:"md,html" default:"md" help:"Report format: md (Markdown) or html (a standalone HTML document)"`
+	Namespace string `optional:"" short:"n" help:"Default namespace used to describe objects and actions with the loaded policy model (e.g. PhotoApp)"`
+}
+
+func (r *ReportCmd) Run(cli *CLI) error {
+	var policies hexapolicy.Policies
+	integration, app := cli.Data.GetApplicationInfo(r.Source)
+	if app == nil {
+		// try file path
+		filePolicies, err := hexapolicysupport.ParsePolicyFile(r.Source)
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(r.Source)
+		policies = hexapolicy.Policies{Policies: filePolicies, App: &name}
+	} else {
+		papPolicies, err := integration.GetPolicies(r.Source)
+		if err != nil {
+			return err
+		}
+		policies = *papPolicies
+		if policies.App == nil {
+			policies.App = &r.Source
+		}
+	}
+
+	report := policyReport.NewReport(policies, cli.Namespaces, r.Namespace)
+	doc, err := report.Render(r.Format)
+	if err != nil {
+		return err
+	}
+
+	if cli.Output == "" {
+		fmt.Println(string(doc))
+		return nil
+	}
+	cli.GetOutputWriter().WriteBytes(doc, true)
+	fmt.Println(fmt.Sprintf("Report of %d policies (%d objects) written to %s", report.Policies, report.ObjectCount(), cli.Output))
+	return nil
+}
+
 func ConfirmProceed(msg string) bool {
 	if msg != "" {
 		fmt.Print(msg)
@@ -906,6 +1174,39 @@ func ConfirmProceed(msg string) bool {
 	return false
 }
 
+type CreatePapCmd struct {
+	Alias       string `arg:"" required:"" help:"Alias of the integration where the policy application (e.g. an AVP policy store) is to be created"`
+	Description string `short:"d" optional:"" help:"A description of the new policy application"`
+	Validation  string `optional:"" enum:"strict,off," default:"" help:"The AVP policy store validation mode: strict (provider default) or off"`
+}
+
+func (c *CreatePapCmd) Run(cli *CLI) error {
+	integration := cli.Data.GetIntegration(c.Alias)
+	if integration == nil {
+		return errors.New(fmt.Sprintf("alias %s not found", c.Alias))
+	}
+
+	settings := map[string]string{}
+	if c.Validation != "" {
+		settings[sdk.SettingAvpValidationMode] = strings.ToUpper(c.Validation)
+	}
+
+	alias, app, err := integration.CreateApplication(c.Description, settings, func() string {
+		return generateAliasOfSize(3)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Policy application created:")
+	printApplication(alias, *app)
+
+	return cli.Data.Save(&cli.Globals)
+}
+
+type CreateCmd struct {
+	Pap CreatePapCmd `cmd:"" aliases:"app,PAP" help:"Create a new policy application point (e.g. an AVP policy store) in an integration"`
+}
+
 type DeleteIntegrationCmd struct {
 	Alias string `arg:"" required:"" help:"An alias for an integration to be deleted from local configuration"`
 }
@@ -975,6 +1276,16 @@ func (h *HelpCmd) Run(realCtx *kong.Context) error {
 	return nil
 }
 
+// writePolicyOutput writes policies to the output file (--output) in the YAML or JSON Lines format
+func writePolicyOutput(cli *CLI, policies []hexapolicy.PolicyInfo, format string) error {
+	policyBytes, err := hexapolicysupport.ToFormatBytes(policies, format)
+	if err != nil {
+		return err
+	}
+	cli.GetOutputWriter().WriteBytes(policyBytes, true)
+	return nil
+}
+
 func MarshalJsonNoEscape(t interface{}, out io.Writer) error {
 	if out == nil {
 		return nil // do nothing
@@ -15,6 +15,7 @@ import (
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicysupport"
+	"github.com/hexa-org/policy-mapper/providers/aws/awscommon"
 	"github.com/hexa-org/policy-mapper/providers/test"
 	"github.com/hexa-org/policy-mapper/sdk"
 	"github.com/stretchr/testify/assert"
@@ -166,6 +167,13 @@ func (suite *testSuite) Test01_AddIntegrations() {
 	res3, err := suite.executeCommand(cmd3, 1)
 	assert.NoError(suite.T(), err, "Check no error after add gcp --file")
 	testLog.Println(string(res3))
+	assert.Equal(suite.T(), sdk.ProviderTypeGoogleCloudIAP, suite.pd.cli.Data.GetIntegration("testgcp").Opts.Info.Name)
+
+	cmd3 = "add gcp testgcpiam --iam --file=./test/gcp_test.json"
+	res3, err = suite.executeCommand(cmd3, 1)
+	assert.NoError(suite.T(), err, "Check no error after add gcp --iam")
+	testLog.Println(string(res3))
+	assert.Equal(suite.T(), sdk.ProviderTypeGoogleCloudIAM, suite.pd.cli.Data.GetIntegration("testgcpiam").Opts.Info.Name)
 
 	testLog.Println("  ...Cognito")
 	cmd4 := "add aws cognito test4 --region=us-west-1 --keyid=1234 --secret=5678"
@@ -174,6 +182,28 @@ func (suite *testSuite) Test01_AddIntegrations() {
 	assert.NoError(suite.T(), err, "Check no error after add cognito")
 	testLog.Println(string(res4))
 
+	cmd5 := "add aws apigw test5role --region=us-west-1 --defaultchain --rolearn=arn:aws:iam::123456789012:role/hexa --externalid=anId"
+	res5, err := suite.executeCommand(cmd5, 1)
+	assert.NoError(suite.T(), err, "Check no error after add aws --rolearn")
+	testLog.Println(string(res5))
+	roleKey, err := awscommon.DecodeCredentialsKey(suite.pd.cli.Data.GetIntegration("test5role").Opts.Info.Key)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), awscommon.CredentialsKey{Region: "us-west-1", DefaultChain: true, RoleArn: "arn:aws:iam::123456789012:role/hexa", ExternalId: "anId"}, roleKey)
+
+	cmd5 = "add aws avp test5web --region=us-west-1 --rolearn=arn:aws:iam::123456789012:role/hexa --webidentitytokenfile=/var/run/token"
+	res5, err = suite.executeCommand(cmd5, 1)
+	assert.NoError(suite.T(), err, "Check no error after add aws --webidentitytokenfile")
+	testLog.Println(string(res5))
+	webKey, err := awscommon.DecodeCredentialsKey(suite.pd.cli.Data.GetIntegration("test5web").Opts.Info.Key)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "/var/run/token", webKey.WebIdentityTokenFile)
+
+	cmdIam := "add aws iam testiam --region=us-west-1 --keyid=1234 --secret=5678"
+	resIam, err := suite.executeCommand(cmdIam, 1)
+	assert.NoError(suite.T(), err, "Check no error after add aws iam")
+	testLog.Println(string(resIam))
+	assert.Equal(suite.T(), sdk.ProviderTypeAwsIam, suite.pd.cli.Data.GetIntegration("testiam").Opts.Info.Name)
+
 	testLog.Println("  ...Azure")
 	cmd6 := "add azure test6 --tenant=abc --clientid=1234 --secret=not4u2no"
 
@@ -185,6 +215,13 @@ func (suite *testSuite) Test01_AddIntegrations() {
 	res7, err := suite.executeCommand(cmd7, 1)
 	assert.NoError(suite.T(), err, "Check no error after add azure --file")
 	testLog.Println(string(res7))
+	assert.Equal(suite.T(), sdk.ProviderTypeAzure, suite.pd.cli.Data.GetIntegration("test5").Opts.Info.Name)
+
+	cmd7 = "add azure testrbac --rbac --file=./test/azure_test.json"
+	res7, err = suite.executeCommand(cmd7, 1)
+	assert.NoError(suite.T(), err, "Check no error after add azure --rbac")
+	testLog.Println(string(res7))
+	assert.Equal(suite.T(), sdk.ProviderTypeAzureRbac, suite.pd.cli.Data.GetIntegration("testrbac").Opts.Info.Name)
 
 	cmd8 := "add opa http --file=./test/opa_test.json"
 	res8, err := suite.executeCommand(cmd8, 1)
@@ -210,6 +247,11 @@ func (suite *testSuite) Test01_AddIntegrations() {
 		"add gcp testd --file=notvalid.txt",
 		"add aws cognito teste --file=notvalid.txt",
 		"add aws cognito testf --keyid=123",
+		"add aws avp testf2 --region=us-west-1 --token=abc",
+		"add aws avp testf3 --region=us-west-1 --keyid=123 --secret=456 --profile=hexa",
+		"add aws avp testf4 --file=./test/aws_test.json --rolearn=arn:aws:iam::123456789012:role/hexa",
+		"add aws avp testf5 --region=us-west-1 --rolearn=arn:aws:iam::123456789012:role/hexa",
+		"add aws avp testf6 --region=us-west-1 --profile=hexa --defaultchain",
 		"add azure testg --file=notvalid.txt",
 		"add azure testh --tenant=123",
 		"add opa http --url=http://localhost:8889 --clientid=hexaclient",
@@ -449,6 +491,23 @@ func (suite *testSuite) Test06_Reconcile() {
 	assert.NoError(suite.T(), err)
 	err = json.Unmarshal(difBytes, &difs4)
 	assert.Len(suite.T(), difs4, 3, "Should be 3 difs")
+
+	// policies written as YAML are read back with no differences
+	yamlPath := fmt.Sprintf("%s/policytest6-%s.yaml", suite.testDir, papAliases[0])
+	res, err = suite.executeCommand(fmt.Sprintf("get policies %s -o %s", papAliases[0], yamlPath), 1)
+	assert.NoError(suite.T(), err, "Check no error on get policies")
+	yamlBytes, err := os.ReadFile(yamlPath)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), strings.HasPrefix(string(yamlBytes), "policies:\n"), "Output should be yaml")
+
+	command5 := fmt.Sprintf("reconcile %s %s -d --output %s", papAliases[0], yamlPath, outputFile)
+	_, err = suite.executeCommand(command5, 2)
+	assert.NoError(suite.T(), err, "Check no error on reconcile")
+	var difs5 []hexapolicy.PolicyDif
+	difBytes, err = os.ReadFile(outputFile)
+	assert.NoError(suite.T(), err)
+	err = json.Unmarshal(difBytes, &difs5)
+	assert.Len(suite.T(), difs5, 0, "Should be no difs")
 }
 
 func (suite *testSuite) Test07_MapToCmd() {
@@ -466,11 +525,40 @@ func (suite *testSuite) Test07_MapToCmd() {
 	res, err = suite.executeCommand(command, 0)
 	assert.NoError(suite.T(), err, "Should be successful map of cedar")
 	assert.Contains(suite.T(), string(res), "permit (")
+	assert.Contains(suite.T(), string(res), "cedar mapping: all 2 policies mapped exactly")
+
+	command = "map to cedar-json ./test/photoidql.json"
+	res, err = suite.executeCommand(command, 0)
+	assert.NoError(suite.T(), err, "Should be successful map of cedar-json")
+	assert.Contains(suite.T(), string(res), "\"staticPolicies\": {")
+	assert.Contains(suite.T(), string(res), "cedar mapping:")
+
+	// The policies that can be mapped are written, but a dropped policy is an error
+	dupFile := filepath.Join(suite.testDir, "dupidql.json")
+	_ = os.WriteFile(dupFile, []byte(`{"policies": [
+  {"meta": {"policyId": "dup"}, "subjects": ["any"], "actions": ["Action:\"view\""], "object": "Photo:\"a.jpg\""},
+  {"meta": {"policyId": "dup"}, "subjects": ["any"], "actions": ["Action:\"edit\""], "object": "Photo:\"a.jpg\""}
+]}`), 0644)
+	command = "map to cedar-json " + dupFile
+	res, err = suite.executeCommand(command, 0)
+	assert.ErrorContains(suite.T(), err, "1 of the policies could not be mapped")
+	assert.Contains(suite.T(), string(res), "\"dup\": {")
+	assert.Contains(suite.T(), string(res), "policy 1 (dup): POLICY DROPPED - duplicate policy id: dup")
 
 	command = "map to gcp ../../examples/policyExamples/idqlAlice.json"
 	res, err = suite.executeCommand(command, 0)
 	assert.NoError(suite.T(), err, "Should be successful map of gcp")
 	assert.Contains(suite.T(), string(res), "bindings")
+	assert.Contains(suite.T(), string(res), "bind mapping: 2 element(s) approximated or dropped")
+
+	modelFile := filepath.Join(suite.testDir, "model.conf")
+	command = "map to casbin ../../examples/policyExamples/example_idql.json --model=" + modelFile
+	res, err = suite.executeCommand(command, 0)
+	assert.NoError(suite.T(), err, "Should be successful map of casbin")
+	assert.Contains(suite.T(), string(res), "p, accounting@hexaindustries.io, *, aResourceId3, http:POST:/accounting")
+	modelBytes, err := os.ReadFile(modelFile)
+	assert.NoError(suite.T(), err, "model file should be written")
+	assert.Contains(suite.T(), string(modelBytes), "eval(p.cond)")
 }
 
 func (suite *testSuite) Test08_MapFromCmd() {
@@ -489,11 +577,23 @@ func (suite *testSuite) Test08_MapFromCmd() {
 	assert.NoError(suite.T(), err, "Should be successful map of cedar")
 	assert.Contains(suite.T(), string(res), "\"Photo:\\\"VacationPhoto94.jpg\\\"")
 	assert.Contains(suite.T(), string(res), " \"Rule\": \"resource in Account:\\\"stacey\\\"\",")
+	assert.Contains(suite.T(), string(res), "idql mapping:")
+
+	command = "map from cedar-json ../../models/formats/cedar/test/cedarPhotoPolicySet.json"
+	res, err = suite.executeCommand(command, 0)
+	assert.NoError(suite.T(), err, "Should be successful map of cedar-json")
+	assert.Contains(suite.T(), string(res), "\"policyId\": \"alicePhoto\"")
+	assert.Contains(suite.T(), string(res), "idql mapping: all 2 policies mapped exactly")
 
 	command = "map from gcp ../../examples/policyExamples/example_bindings.json"
 	res, err = suite.executeCommand(command, 0)
 	assert.NoError(suite.T(), err, "Should be successful map of gcp")
 	assert.Contains(suite.T(), string(res), "req.ip sw \\\"127\\\" and req.method eq \\\"POST\\\"", "Check contains condition")
+
+	command = "map from casbin ../../models/formats/casbin/test/rbac_with_domains_policy.csv --model=../../models/formats/casbin/test/rbac_with_domains_model.conf"
+	res, err = suite.executeCommand(command, 0)
+	assert.NoError(suite.T(), err, "Should be successful map of casbin")
+	assert.Contains(suite.T(), string(res), "\"casbinDomain\": \"domain2\"")
 }
 
 func (suite *testSuite) Test09_DeleteCmds() {
@@ -583,6 +683,143 @@ func (suite *testSuite) Test11_LoadShowAndValidateModel() {
 	assert.Contains(suite.T(), string(res), "invalid condition entity type: PhotoApp:BadAccount:\"stacey\"")
 }
 
+func (suite *testSuite) Test12_LoadCedarSchemaModel() {
+	res, err := suite.executeCommand("load model ../../models/policyInfoModel/test/documentSchema.cedarschema", 0)
+	assert.NoError(suite.T(), err, "Check no error after load model")
+	assert.Contains(suite.T(), string(res), "DocApp")
+
+	res, err = suite.executeCommand("show model DocApp --format=cedarschema", 0)
+	assert.NoError(suite.T(), err, "Check no error after show model")
+	testLog.Println(string(res))
+	assert.Contains(suite.T(), string(res), "namespace DocApp {")
+	assert.Contains(suite.T(), string(res), "entity User in [Team, Group] = {")
+
+	res, err = suite.executeCommand("show model DocApp --format=json", 0)
+	assert.NoError(suite.T(), err, "Check no error after show model")
+	assert.Contains(suite.T(), string(res), `"memberOfTypes": [`)
+
+	// Convert a JSON model to the human-readable format
+	_, err = suite.executeCommand("load model ./test/photoSchema.json", 0)
+	assert.NoError(suite.T(), err)
+	schemaFile := filepath.Join(suite.testDir, "photo.cedarschema")
+	_, err = suite.executeCommand("show model PhotoApp --format=cedarschema -o "+schemaFile, 0)
+	assert.NoError(suite.T(), err)
+	schemaBytes, err := os.ReadFile(schemaFile)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(schemaBytes), `action "viewPhoto" appliesTo {`)
+}
+
+func (suite *testSuite) Test13_Migrate() {
+	legacyBytes, err := os.ReadFile("../../pkg/hexapolicy/test/legacyPolicies.json")
+	assert.NoError(suite.T(), err)
+	legacyFile := filepath.Join(suite.testDir, "legacyPolicies.json")
+	assert.NoError(suite.T(), os.WriteFile(legacyFile, legacyBytes, 0644))
+
+	// A dry run shows the changes without updating the file
+	res, err := suite.executeCommand("migrate -n "+legacyFile, 0)
+	assert.NoError(suite.T(), err)
+	testLog.Println(string(res))
+	assert.Contains(suite.T(), string(res), "2 of 2 policies migrated to IDQL 0.7:")
+	assert.Contains(suite.T(), string(res), "policy 1 (GetTodos): 0.6 -> 0.7")
+	assert.Contains(suite.T(), string(res), "(migrated)")
+	assert.Contains(suite.T(), string(res), "-      \"subject\": {")
+	assert.Contains(suite.T(), string(res), "+      \"subjects\": [")
+	fileBytes, _ := os.ReadFile(legacyFile)
+	assert.Equal(suite.T(), legacyBytes, fileBytes)
+
+	res, err = suite.executeCommand("migrate "+legacyFile, 1)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(res), "migrated to IDQL 0.7.")
+
+	fileBytes, _ = os.ReadFile(legacyFile)
+	_, err = hexapolicy.ParsePoliciesStrict(fileBytes)
+	assert.NoError(suite.T(), err, "migrated file should conform to the IDQL schema")
+
+	res, err = suite.executeCommand("migrate "+legacyFile, 0)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(res), "no migration required: all 2 policies are IDQL 0.7")
+}
+
+func (suite *testSuite) Test14_Report() {
+	_, err := suite.executeCommand("load model ./test/photoSchema.json", 0)
+	assert.NoError(suite.T(), err)
+
+	res, err := suite.executeCommand("report -n PhotoApp ./test/photoidql.json", 0)
+	assert.NoError(suite.T(), err)
+	testLog.Println(string(res))
+	assert.Contains(suite.T(), string(res), "# Policy Report: photoidql.json")
+	assert.Contains(suite.T(), string(res), "## Object: All objects")
+	assert.Contains(suite.T(), string(res), "Model action `PhotoApp::Action::\"viewPhoto\"`, for principals User, UserGroup on resources Photo")
+	assert.Contains(suite.T(), string(res), "  - Condition: when resource is in PhotoApp:BadAccount:\"stacey\"")
+
+	reportFile := filepath.Join(suite.testDir, "report.html")
+	res, err = suite.executeCommand(fmt.Sprintf("report -f html -o %s ./test/photoidql.json", reportFile), 0)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(res), "Report of 2 policies (2 objects) written to "+reportFile)
+	reportBytes, err := os.ReadFile(reportFile)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), strings.HasPrefix(string(reportBytes), "<!DOCTYPE html>"))
+
+	_, err = suite.executeCommand("report -f pdf ./test/photoidql.json", 0)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *testSuite) Test15_CreatePapAndSchema() {
+	_, err := suite.executeCommand("add aws avp test15 --region=us-west-1 --keyid=1234 --secret=5678", 1)
+	assert.NoError(suite.T(), err)
+	integration := suite.pd.cli.Data.GetIntegration("test15")
+	assert.Len(suite.T(), integration.Apps, 1)
+
+	res, err := suite.executeCommand("create pap test15 -d Photos --validation=off", 0)
+	assert.NoError(suite.T(), err)
+	testLog.Println(string(res))
+	assert.Contains(suite.T(), string(res), "Policy application created:")
+	assert.Len(suite.T(), integration.Apps, 2)
+	var alias string
+	for k, app := range integration.Apps {
+		if app.Description == "Photos" {
+			alias = k
+		}
+	}
+	assert.NotEmpty(suite.T(), alias)
+
+	_, err = suite.executeCommand("create pap notexist", 0)
+	assert.Error(suite.T(), err, "alias notexist not found")
+
+	res, err = suite.executeCommand("get schema "+alias, 0)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(res), "No schema defined for "+alias)
+
+	res, err = suite.executeCommand("set schema "+alias+" -d -f ./test/photoSchema.json", 1)
+	assert.NoError(suite.T(), err)
+	testLog.Println(string(res))
+	assert.Contains(suite.T(), string(res), "0: ADDED PhotoApp")
+	assert.Contains(suite.T(), string(res), "Schema applied successfully.")
+
+	res, err = suite.executeCommand("get schema "+alias+" --format=cedarschema", 0)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(res), `action "viewPhoto" appliesTo {`)
+
+	// Namespaces of the loaded model that are not in the schema are reported
+	_, err = suite.executeCommand("load model ../../models/policyInfoModel/test/documentSchema.cedarschema", 0)
+	assert.NoError(suite.T(), err)
+	res, err = suite.executeCommand("get schema "+alias+" -d", 0)
+	assert.NoError(suite.T(), err)
+	testLog.Println(string(res))
+	assert.Contains(suite.T(), string(res), "ADDED DocApp")
+	assert.NotContains(suite.T(), string(res), "PhotoApp")
+
+	_, err = suite.executeCommand("set schema "+alias+" -n DocApp", 1)
+	assert.NoError(suite.T(), err)
+	res, err = suite.executeCommand("get schema "+alias+" -d", 0)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(res), "ADDED PhotoApp")
+	assert.NotContains(suite.T(), string(res), "DocApp")
+
+	_, err = suite.executeCommand("set schema "+alias+" -n NotLoaded", 0)
+	assert.Error(suite.T(), err, "namespace not found or not loaded")
+}
+
 func (suite *testSuite) Test99_ConfigSave() {
 
 	config := suite.pd.cli.Data
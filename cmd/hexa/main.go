@@ -38,11 +38,14 @@ type CLI struct {
 	Globals
 
 	Add       AddCmd       `cmd:"" help:"Add a new integration"`
+	Create    CreateCmd    `cmd:"" help:"Create a new policy application point at a provider"`
 	Delete    DeleteCmd    `cmd:"" help:"Delete an integration or policy application point from local configuration"`
 	Get       GetCmd       `cmd:"" help:"Retrieve or update information and display"`
 	Export    ExportCmd    `cmd:"" help:"Export an integration configuration (for use with Policy-Orchestrator web application)"`
 	Map       MapCmd       `cmd:"" help:"Convert syntactical policies to and from IDQL"`
 	Reconcile ReconcileCmd `cmd:"" help:"Reconcile compares a source set of policies another source (file or alias) of policies to determine differences."`
+	Migrate   MigrateCmd   `cmd:"" help:"Upgrade a file of IDQL policies to the current IDQL version"`
+	Report    ReportCmd    `cmd:"" help:"Generate a human-readable report (Markdown or HTML) of the policies of an application or file"`
 	Set       SetCmd       `cmd:"" help:"Set or update policies (e.g. set policies -file=idql.json)"`
 	Show      ShowCmd      `cmd:"" help:"Show locally stored information about integrations and applications"`
 	Load      LoadCmd      `cmd:"" help:"Load data for local use (eg. load model)"`
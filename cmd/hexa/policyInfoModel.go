@@ -1,12 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/hexa-org/policy-mapper/models/policyInfoModel"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/pimValidate"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicysupport"
 )
@@ -16,24 +19,36 @@ type LoadCmd struct {
 }
 
 type LoadModelCmd struct {
-	File string `arg:"" required:"" type:"path" help:"A json file containing an IDQL Policy Model or Cedar Schema"`
+	File string `arg:"" required:"" type:"path" help:"A json file containing an IDQL Policy Model or Cedar Schema, or a Cedar human-readable schema (.cedarschema)"`
 }
 
-func (m *LoadModelCmd) Run(cli *CLI) error {
-	var err error
-	modelBytes, err := os.ReadFile(m.File)
+// parseModelFile parses a json IDQL Policy Model or Cedar Schema, or a Cedar human-readable schema (.cedarschema)
+func parseModelFile(file string) (*policyInfoModel.Namespaces, error) {
+	modelBytes, err := os.ReadFile(file)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var ns *policyInfoModel.Namespaces
-	ns, err = policyInfoModel.ParseSchemaFile(modelBytes)
+	if strings.EqualFold(filepath.Ext(file), ".cedarschema") {
+		ns, err = policyInfoModel.ParseCedarSchema(modelBytes)
+	} else {
+		ns, err = policyInfoModel.ParseSchemaFile(modelBytes)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if ns == nil {
-		return errors.New("No policy model data found in " + m.File)
+		return nil, errors.New("No policy model data found in " + file)
+	}
+	return ns, nil
+}
+
+func (m *LoadModelCmd) Run(cli *CLI) error {
+	ns, err := parseModelFile(m.File)
+	if err != nil {
+		return err
 	}
 
 	if cli.Namespaces == nil {
@@ -55,6 +70,7 @@ func (m *LoadModelCmd) Run(cli *CLI) error {
 
 type ShowModelCmd struct {
 	Namespace string `arg:"" required:"" help:"The policy application namespace to show (or *)"`
+	Format    string `short:"f" enum:"text,cedarschema,json" default:"text" help:"Display as text (default), Cedar human-readable schema (cedarschema), or json"`
 }
 
 func printAttrs(ow *OutputWriter, amap map[string]policyInfoModel.AttrType) {
@@ -160,16 +176,41 @@ func (s *ShowModelCmd) Run(cli *CLI) error {
 	if cli.Namespaces == nil {
 		return errors.New("no namespaces loaded. Use the `load model` command")
 	}
-	if s.Namespace == "*" {
-		for k, v := range *cli.Namespaces {
-			displayNamespace(ow, k, v)
-		}
-	} else {
+	namespaces := *cli.Namespaces
+	if s.Namespace != "*" {
 		ns, ok := (*cli.Namespaces)[s.Namespace]
 		if !ok {
 			return errors.New("namespace not found or not loaded")
 		}
-		displayNamespace(ow, s.Namespace, ns)
+		namespaces = policyInfoModel.Namespaces{s.Namespace: ns}
+	}
+
+	return displayNamespaces(ow, namespaces, s.Format)
+}
+
+// displayNamespaces writes namespaces as text, Cedar human-readable schema (cedarschema), or json
+func displayNamespaces(ow *OutputWriter, namespaces policyInfoModel.Namespaces, format string) error {
+	switch format {
+	case "cedarschema":
+		schema, err := policyInfoModel.FormatCedarSchema(namespaces)
+		if err != nil {
+			return err
+		}
+		fmt.Print(schema)
+		ow.WriteString(schema, true)
+		return nil
+	case "json":
+		nsBytes, err := json.MarshalIndent(namespaces, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(nsBytes))
+		ow.WriteBytes(nsBytes, true)
+		return nil
+	}
+
+	for k, v := range namespaces {
+		displayNamespace(ow, k, v)
 	}
 	ow.Close()
 	return nil
@@ -177,7 +218,7 @@ func (s *ShowModelCmd) Run(cli *CLI) error {
 
 type ValidatePolicyCmd struct {
 	Namespace string `arg:"" required:"" help:"Default namespace for the policy (e.g. PhotoApp)"`
-	File      string `arg:"" required:"" type:"path" help:"A json file containing an IDQL Policy to be validated"`
+	File      string `arg:"" required:"" type:"path" help:"A file containing IDQL policy (JSON, YAML or JSON Lines) to be validated"`
 }
 
 func (v *ValidatePolicyCmd) Run(cli *CLI) error {
@@ -187,19 +228,14 @@ func (v *ValidatePolicyCmd) Run(cli *CLI) error {
 	}
 	validator := pimValidate.GetValidator(*cli.Namespaces, v.Namespace)
 
-	policies, err := hexapolicysupport.ParsePolicyFile(v.File)
-	if err != nil {
-		return err
-	}
-	if policies == nil || len(policies) == 0 {
-		return errors.New("no policies found")
-	}
-
-	for i, policy := range policies {
-		pid := fmt.Sprintf("Policy-%d", i)
+	// Policies are streamed so that very large policy files can be validated
+	count := 0
+	err := hexapolicysupport.ReadPolicyFile(v.File, func(policy hexapolicy.PolicyInfo) error {
+		pid := fmt.Sprintf("Policy-%d", count)
 		if policy.Meta.PolicyId != nil {
 			pid = *policy.Meta.PolicyId
 		}
+		count++
 		fmt.Print(pid)
 		ow.WriteString(pid, false)
 
@@ -208,7 +244,7 @@ func (v *ValidatePolicyCmd) Run(cli *CLI) error {
 			line := "...Valid\n\n"
 			fmt.Print(line)
 			ow.WriteString(line, false)
-			continue
+			return nil
 
 		}
 		for _, err := range errs {
@@ -218,11 +254,119 @@ func (v *ValidatePolicyCmd) Run(cli *CLI) error {
 		}
 		fmt.Print("\n")
 		ow.WriteString("\n", false)
-	}
+		return nil
+	})
 	ow.Close()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("no policies found")
+	}
 	return nil
 }
 
 type ValidateCmd struct {
 	Policy ValidatePolicyCmd `cmd:"" help:"validate a set of policies against a policy model (previously loaded)"`
 }
+
+type GetSchemaCmd struct {
+	Alias       string `arg:"" required:"" help:"Alias or object id of a PAP (application) to retrieve the schema from"`
+	Format      string `short:"f" enum:"text,cedarschema,json" default:"text" help:"Display as text (default), Cedar human-readable schema (cedarschema), or json"`
+	Differences bool   `optional:"" default:"false" short:"d" help:"When specified, the differences between the loaded policy model (see load model) and the PAP schema are shown instead"`
+}
+
+func (g *GetSchemaCmd) Run(cli *CLI) error {
+	integration, app := cli.Data.GetApplicationInfo(g.Alias)
+	if app == nil {
+		return errors.New(fmt.Sprintf("pap alias %s not found", g.Alias))
+	}
+
+	if g.Differences {
+		if cli.Namespaces == nil {
+			return errors.New("no namespaces loaded. Use the `load model` command")
+		}
+		difs, err := integration.CompareSchema(g.Alias, *cli.Namespaces, false)
+		if err != nil {
+			return err
+		}
+		printSchemaDifferences(cli, difs)
+		return nil
+	}
+
+	namespaces, err := integration.GetSchema(g.Alias)
+	if err != nil {
+		return err
+	}
+	if len(*namespaces) == 0 {
+		fmt.Println(fmt.Sprintf("No schema defined for %s.", g.Alias))
+		return nil
+	}
+	return displayNamespaces(cli.GetOutputWriter(), *namespaces, g.Format)
+}
+
+func printSchemaDifferences(cli *CLI, difs []policyInfoModel.SchemaDifference) {
+	if len(difs) == 0 {
+		fmt.Println("No schema differences found.")
+		return
+	}
+	for i, dif := range difs {
+		fmt.Println(fmt.Sprintf("%d: %s", i, dif.String()))
+	}
+	fmt.Println()
+	// Write to output if specified
+	output, _ := json.MarshalIndent(difs, "", "  ")
+	cli.GetOutputWriter().WriteBytes(output, true)
+}
+
+type SetSchemaCmd struct {
+	Alias       string `arg:"" required:"" help:"The alias or object id of a PAP (application) whose schema is to be replaced"`
+	File        string `short:"f" optional:"" type:"path" help:"A json file containing an IDQL Policy Model or Cedar Schema, or a Cedar human-readable schema (.cedarschema). When omitted, the loaded policy model (see load model) is used"`
+	Namespace   string `short:"n" optional:"" help:"The namespace to apply (default: all namespaces of the model)"`
+	Differences bool   `optional:"" default:"false" short:"d" help:"When specified, the differences with the current PAP schema will be shown before confirming change"`
+}
+
+func (s *SetSchemaCmd) Run(cli *CLI) error {
+	integration, app := cli.Data.GetApplicationInfo(s.Alias)
+	if app == nil {
+		return errors.New(fmt.Sprintf("pap alias %s not found", s.Alias))
+	}
+
+	namespaces := cli.Namespaces
+	if s.File != "" {
+		var err error
+		namespaces, err = parseModelFile(s.File)
+		if err != nil {
+			return err
+		}
+	}
+	if namespaces == nil {
+		return errors.New("no namespaces loaded. Use the `load model` command or --file")
+	}
+	model := *namespaces
+	if s.Namespace != "" {
+		ns, ok := model[s.Namespace]
+		if !ok {
+			return errors.New("namespace not found or not loaded")
+		}
+		model = policyInfoModel.Namespaces{s.Namespace: ns}
+	}
+
+	if s.Differences {
+		difs, err := integration.CompareSchema(s.Alias, model, true)
+		if err != nil {
+			return err
+		}
+		printSchemaDifferences(cli, difs)
+	}
+
+	fmt.Println(fmt.Sprintf("Applying schema with %d namespace(s) to %s", len(model), s.Alias))
+	if ConfirmProceed("Replace schema Y|[n]?") {
+		err := integration.SetSchema(s.Alias, model)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Schema applied successfully.")
+	}
+	return nil
+}
@@ -0,0 +1,425 @@
+package awsIamConditions
+
+/*
+ Condition mapper for AWS IAM policy statement conditions - See:
+ https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_policies_elements_condition.html
+
+ An IAM condition block maps condition operators (e.g. StringEquals) to condition keys and their values. Condition keys
+ (e.g. aws:RequestedRegion or aws:PrincipalTag/team) are used as IDQL attribute names. The keys of a block must all
+ match (and), while the values of a key are alternatives (or), except for negated operators such as StringNotEquals
+ where none of the values may match. A value that is a policy variable (e.g. ${aws:username}) is mapped to an IDQL
+ attribute comparison.
+*/
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions/parser"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
+)
+
+// Condition is an IAM condition block, mapping each condition operator to the values of its condition keys
+type Condition map[string]map[string][]string
+
+const (
+	OpStringEquals             = "StringEquals"
+	OpStringNotEquals          = "StringNotEquals"
+	OpStringLike               = "StringLike"
+	OpStringNotLike            = "StringNotLike"
+	OpNumericEquals            = "NumericEquals"
+	OpNumericNotEquals         = "NumericNotEquals"
+	OpNumericLessThan          = "NumericLessThan"
+	OpNumericLessThanEquals    = "NumericLessThanEquals"
+	OpNumericGreaterThan       = "NumericGreaterThan"
+	OpNumericGreaterThanEquals = "NumericGreaterThanEquals"
+	OpDateEquals               = "DateEquals"
+	OpDateNotEquals            = "DateNotEquals"
+	OpDateLessThan             = "DateLessThan"
+	OpDateLessThanEquals       = "DateLessThanEquals"
+	OpDateGreaterThan          = "DateGreaterThan"
+	OpDateGreaterThanEquals    = "DateGreaterThanEquals"
+	OpBool                     = "Bool"
+	OpNull                     = "Null"
+)
+
+// negatedOperators are the operators whose values must all not match
+var negatedOperators = map[string]bool{
+	OpStringNotEquals:  true,
+	OpStringNotLike:    true,
+	OpNumericNotEquals: true,
+	OpDateNotEquals:    true,
+}
+
+// comparisons maps an IDQL comparison to the suffix of the Numeric and Date operators, and (negated) to its opposite
+var comparisons = map[parser.CompareOperator][2]string{
+	parser.EQ: {"Equals", "NotEquals"},
+	parser.NE: {"NotEquals", "Equals"},
+	parser.LT: {"LessThan", "GreaterThanEquals"},
+	parser.LE: {"LessThanEquals", "GreaterThan"},
+	parser.GT: {"GreaterThan", "LessThanEquals"},
+	parser.GE: {"GreaterThanEquals", "LessThan"},
+}
+
+type IamConditionMapper struct {
+	NameMapper *conditions.AttributeMap
+}
+
+func NewIamConditionMapper(nameMap map[string]string) *IamConditionMapper {
+	return &IamConditionMapper{NameMapper: conditions.NewNameMapper(nameMap)}
+}
+
+// clause is a condition key tested by an operator against one or more values
+type clause struct {
+	operator string
+	key      string
+	values   []string
+}
+
+/*
+MapConditionToIam converts an IDQL condition into an IAM condition block. A nil condition returns nil. Because an IDQL
+condition with an action of `deny` means the policy applies unless the rule is met, its rule is negated (e.g.
+StringEquals becomes StringNotEquals). IAM conditions cannot express every IDQL rule: alternatives (or) must test the
+same condition key with the same operator.
+*/
+func (mapper *IamConditionMapper) MapConditionToIam(condition *conditions.ConditionInfo) (Condition, error) {
+	if condition == nil {
+		return nil, nil
+	}
+	ast, err := conditions.ParseConditionRuleAst(*condition)
+	if err != nil {
+		return nil, err
+	}
+	clauses, err := mapper.mapExpression(ast, strings.EqualFold(condition.Action, conditions.ADeny))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(Condition)
+	for _, c := range clauses {
+		if res[c.operator] == nil {
+			res[c.operator] = make(map[string][]string)
+		}
+		res[c.operator][c.key] = c.values
+	}
+	return res, nil
+}
+
+func (mapper *IamConditionMapper) mapExpression(ast parser.Expression, negate bool) ([]clause, error) {
+	switch element := ast.(type) {
+	case parser.PrecedenceExpression:
+		return mapper.mapExpression(element.Expression, negate)
+	case parser.NotExpression:
+		return mapper.mapExpression(element.Expression, !negate)
+	case parser.LogicalExpression:
+		left, err := mapper.mapExpression(element.Left, negate)
+		if err != nil {
+			return nil, err
+		}
+		right, err := mapper.mapExpression(element.Right, negate)
+		if err != nil {
+			return nil, err
+		}
+		isAnd := element.Operator == parser.AND
+		if negate {
+			isAnd = !isAnd // not (a and b) is not a or not b
+		}
+		if isAnd {
+			return andClauses(left, right)
+		}
+		return orClauses(left, right)
+	case parser.AttributeExpression:
+		c, err := mapper.mapAttrExpr(element, negate)
+		if err != nil {
+			return nil, err
+		}
+		return []clause{c}, nil
+	}
+	return nil, fmt.Errorf("IDQL expression %s cannot be mapped to an IAM condition", ast.String())
+}
+
+// andClauses combines clauses that must all match. Only a negated operator can test the same key more than once.
+func andClauses(left []clause, right []clause) ([]clause, error) {
+	res := append([]clause{}, left...)
+	for _, r := range right {
+		i := indexOfClause(res, r)
+		if i < 0 {
+			res = append(res, r)
+			continue
+		}
+		if !negatedOperators[r.operator] {
+			return nil, fmt.Errorf("IAM conditions cannot require %s %s to match more than one value", r.key, r.operator)
+		}
+		res[i].values = append(append([]string{}, res[i].values...), r.values...)
+	}
+	return res, nil
+}
+
+// orClauses combines alternatives, which IAM only supports as values of the same key and (non-negated) operator
+func orClauses(left []clause, right []clause) ([]clause, error) {
+	if len(left) != 1 || len(right) != 1 || indexOfClause(left, right[0]) != 0 || negatedOperators[left[0].operator] {
+		return nil, errors.New("IAM conditions only support alternatives (or) that compare the same condition key with the same operator")
+	}
+	merged := left[0]
+	merged.values = append(append([]string{}, left[0].values...), right[0].values...)
+	return []clause{merged}, nil
+}
+
+func indexOfClause(clauses []clause, c clause) int {
+	for i, existing := range clauses {
+		if existing.operator == c.operator && existing.key == c.key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (mapper *IamConditionMapper) mapAttrExpr(attrExpr parser.AttributeExpression, negate bool) (clause, error) {
+	key := mapper.NameMapper.GetProviderAttributeName(attrExpr.AttributePath.String())
+	if attrExpr.Operator == parser.PR {
+		return clause{operator: OpNull, key: key, values: []string{strconv.FormatBool(negate)}}, nil
+	}
+
+	suffixes, isComparison := comparisons[attrExpr.Operator]
+	isLike := attrExpr.Operator == parser.SW || attrExpr.Operator == parser.EW || attrExpr.Operator == parser.CO
+	if !isComparison && !isLike {
+		return clause{}, fmt.Errorf("IDQL operator '%s' is not supported by IAM conditions", attrExpr.Operator)
+	}
+	value, err := mapper.mapValue(attrExpr.CompareValue)
+	if err != nil {
+		return clause{}, err
+	}
+	valueType := attrExpr.CompareValue.ValueType()
+
+	if isLike {
+		if valueType != types.TypeString {
+			return clause{}, fmt.Errorf("IDQL operator '%s' requires a string value for %s", attrExpr.Operator, key)
+		}
+		if strings.ContainsAny(value, "*?") {
+			return clause{}, fmt.Errorf("value %s of %s cannot contain the IAM wildcards * or ?", value, key)
+		}
+		pattern := value + "*"
+		if attrExpr.Operator == parser.EW {
+			pattern = "*" + value
+		} else if attrExpr.Operator == parser.CO {
+			pattern = "*" + value + "*"
+		}
+		operator := OpStringLike
+		if negate {
+			operator = OpStringNotLike
+		}
+		return clause{operator: operator, key: key, values: []string{pattern}}, nil
+	}
+
+	suffix := suffixes[0]
+	if negate {
+		suffix = suffixes[1]
+	}
+
+	switch valueType {
+	case types.TypeNumber:
+		return clause{operator: "Numeric" + suffix, key: key, values: []string{value}}, nil
+	case types.TypeDate:
+		return clause{operator: "Date" + suffix, key: key, values: []string{value}}, nil
+	case types.TypeBool:
+		if suffix != "Equals" && suffix != "NotEquals" {
+			break
+		}
+		boolValue := attrExpr.CompareValue.Value().(bool)
+		if suffix == "NotEquals" {
+			boolValue = !boolValue
+		}
+		return clause{operator: OpBool, key: key, values: []string{strconv.FormatBool(boolValue)}}, nil
+	default:
+		if suffix == "Equals" {
+			return clause{operator: OpStringEquals, key: key, values: []string{value}}, nil
+		}
+		if suffix == "NotEquals" {
+			return clause{operator: OpStringNotEquals, key: key, values: []string{value}}, nil
+		}
+	}
+	return clause{}, fmt.Errorf("IDQL operator '%s' is not supported by IAM conditions for %s values", attrExpr.Operator, strings.ToLower(types.TypeName(valueType)))
+}
+
+// mapValue converts an IDQL value into an IAM condition value. An attribute is mapped to a policy variable.
+func (mapper *IamConditionMapper) mapValue(value types.Value) (string, error) {
+	switch v := value.(type) {
+	case types.String:
+		return v.Value().(string), nil
+	case types.Entity:
+		return "${" + mapper.NameMapper.GetProviderAttributeName(v.String()) + "}", nil
+	case types.Numeric, types.Boolean, types.Date:
+		return value.String(), nil
+	}
+	return "", fmt.Errorf("IDQL value %s cannot be mapped to an IAM condition value", value.String())
+}
+
+/*
+MapIamToCondition converts an IAM condition block into an IDQL condition that allows access. A nil or empty block
+returns nil. Operators with the IfExists suffix or a set qualifier (ForAllValues: and ForAnyValue:), and the Arn,
+Binary and IpAddress operators are not supported.
+*/
+func (mapper *IamConditionMapper) MapIamToCondition(condition Condition) (*conditions.ConditionInfo, error) {
+	if len(condition) == 0 {
+		return nil, nil
+	}
+	operators := make([]string, 0, len(condition))
+	for operator := range condition {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	var rules []string
+	var alternatives []bool // alternatives marks rules (or) that are grouped when combined with other rules
+	for _, operator := range operators {
+		keys := make([]string, 0, len(condition[operator]))
+		for key := range condition[operator] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			values := condition[operator][key]
+			if len(values) == 0 {
+				return nil, fmt.Errorf("IAM condition %s %s has no values", operator, key)
+			}
+			exprs := make([]string, len(values))
+			for i, value := range values {
+				expr, err := mapper.mapIamComparison(operator, key, value)
+				if err != nil {
+					return nil, err
+				}
+				exprs[i] = expr
+			}
+			logical := " or "
+			if negatedOperators[operator] {
+				logical = " and "
+			}
+			rules = append(rules, strings.Join(exprs, logical))
+			alternatives = append(alternatives, len(exprs) > 1 && logical == " or ")
+		}
+	}
+	if len(rules) > 1 {
+		for i := range rules {
+			if alternatives[i] {
+				rules[i] = "(" + rules[i] + ")"
+			}
+		}
+	}
+
+	rule := strings.Join(rules, " and ")
+	ast, err := conditions.ParseExpressionAst(rule)
+	if err != nil {
+		return nil, fmt.Errorf("IAM condition could not be mapped (%s): %w", rule, err)
+	}
+	return &conditions.ConditionInfo{
+		Rule:   conditions.SerializeExpression(ast),
+		Action: conditions.AAllow,
+	}, nil
+}
+
+// mapIamComparison returns the IDQL comparison of a condition key with one value of an IAM condition operator
+func (mapper *IamConditionMapper) mapIamComparison(operator string, key string, value string) (string, error) {
+	attribute := mapper.hexaName(key)
+
+	switch operator {
+	case OpStringEquals, OpStringNotEquals:
+		op := parser.EQ
+		if operator == OpStringNotEquals {
+			op = parser.NE
+		}
+		return fmt.Sprintf("%s %s %s", attribute, op, mapper.mapIamValue(value)), nil
+	case OpStringLike, OpStringNotLike:
+		expr, err := likeComparison(attribute, value)
+		if err != nil {
+			return "", err
+		}
+		if operator == OpStringNotLike {
+			return "not(" + expr + ")", nil
+		}
+		return expr, nil
+	case OpBool:
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("IAM condition %s %s has an invalid boolean value %s", operator, key, value)
+		}
+		return fmt.Sprintf("%s eq %t", attribute, boolValue), nil
+	case OpNull:
+		isNull, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("IAM condition %s %s has an invalid boolean value %s", operator, key, value)
+		}
+		if isNull {
+			return fmt.Sprintf("not(%s pr)", attribute), nil
+		}
+		return fmt.Sprintf("%s pr", attribute), nil
+	}
+
+	for _, kind := range []string{"Numeric", "Date"} {
+		suffix, found := strings.CutPrefix(operator, kind)
+		if !found {
+			continue
+		}
+		for op, suffixes := range comparisons {
+			if suffixes[0] != suffix {
+				continue
+			}
+			if strings.HasPrefix(value, "${") {
+				return fmt.Sprintf("%s %s %s", attribute, op, mapper.mapIamValue(value)), nil
+			}
+			if kind == "Numeric" {
+				if _, err := strconv.ParseFloat(value, 64); err != nil {
+					return "", fmt.Errorf("IAM condition %s %s has an invalid numeric value %s", operator, key, value)
+				}
+				return fmt.Sprintf("%s %s %s", attribute, op, value), nil
+			}
+			date, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return "", fmt.Errorf("IAM condition %s %s has a date value %s that is not in RFC3339 format", operator, key, value)
+			}
+			return fmt.Sprintf("%s %s %s", attribute, op, date.Format(time.RFC3339)), nil
+		}
+	}
+	return "", fmt.Errorf("IAM condition operator %s is not supported", operator)
+}
+
+// likeComparison maps a StringLike pattern with a leading and/or trailing wildcard to an IDQL comparison
+func likeComparison(attribute string, pattern string) (string, error) {
+	value := strings.TrimSuffix(strings.TrimPrefix(pattern, "*"), "*")
+	if strings.Contains(value, "${") {
+		return "", fmt.Errorf("StringLike pattern %s of %s cannot be mapped (policy variables are only supported as a whole value)", pattern, attribute)
+	}
+	if strings.ContainsAny(value, "*?") || value == "" {
+		return "", fmt.Errorf("StringLike pattern %s of %s cannot be mapped (only leading or trailing wildcards are supported)", pattern, attribute)
+	}
+	quoted := strconv.Quote(value)
+	leading, trailing := strings.HasPrefix(pattern, "*"), strings.HasSuffix(pattern, "*")
+	switch {
+	case leading && trailing:
+		return fmt.Sprintf("%s co %s", attribute, quoted), nil
+	case leading:
+		return fmt.Sprintf("%s ew %s", attribute, quoted), nil
+	case trailing:
+		return fmt.Sprintf("%s sw %s", attribute, quoted), nil
+	}
+	return fmt.Sprintf("%s eq %s", attribute, quoted), nil
+}
+
+// mapIamValue converts an IAM string value into an IDQL value. A policy variable (e.g. ${aws:username}) becomes an attribute.
+func (mapper *IamConditionMapper) mapIamValue(value string) string {
+	if variable, ok := strings.CutPrefix(value, "${"); ok && strings.HasSuffix(variable, "}") {
+		return mapper.hexaName(strings.TrimSuffix(variable, "}"))
+	}
+	return strconv.Quote(value)
+}
+
+// hexaName returns the IDQL attribute name of an IAM condition key (condition keys are not case-sensitive)
+func (mapper *IamConditionMapper) hexaName(key string) string {
+	if name := mapper.NameMapper.GetHexaFilterAttributePath(strings.ToLower(key)); name != strings.ToLower(key) {
+		return name
+	}
+	return key
+}
@@ -0,0 +1,133 @@
+package awsIamConditions_test
+
+import (
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/models/conditionLangs/awsIamConditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/stretchr/testify/assert"
+)
+
+var mapper = awsIamConditions.NewIamConditionMapper(map[string]string{
+	"subject.team": "aws:PrincipalTag/team",
+})
+
+func TestMapToIam(t *testing.T) {
+	tests := []struct {
+		name string
+		idql string
+		iam  awsIamConditions.Condition
+	}{
+		{"Equals", `aws:RequestedRegion eq "us-west-2"`,
+			awsIamConditions.Condition{"StringEquals": {"aws:RequestedRegion": {"us-west-2"}}}},
+		{"Alternatives", `aws:RequestedRegion eq "us-west-2" or aws:RequestedRegion eq "us-east-1"`,
+			awsIamConditions.Condition{"StringEquals": {"aws:RequestedRegion": {"us-west-2", "us-east-1"}}}},
+		{"Not equals", `aws:RequestedRegion ne "us-west-2" and aws:RequestedRegion ne "us-east-1"`,
+			awsIamConditions.Condition{"StringNotEquals": {"aws:RequestedRegion": {"us-west-2", "us-east-1"}}}},
+		{"Starts with", `s3:prefix sw "home/"`, awsIamConditions.Condition{"StringLike": {"s3:prefix": {"home/*"}}}},
+		{"Ends with", `s3:prefix ew ".txt"`, awsIamConditions.Condition{"StringLike": {"s3:prefix": {"*.txt"}}}},
+		{"Contains", `s3:prefix co "logs"`, awsIamConditions.Condition{"StringLike": {"s3:prefix": {"*logs*"}}}},
+		{"Not like", `not(s3:prefix sw "private/")`, awsIamConditions.Condition{"StringNotLike": {"s3:prefix": {"private/*"}}}},
+		{"Numeric", `s3:max-keys le 10`, awsIamConditions.Condition{"NumericLessThanEquals": {"s3:max-keys": {"10"}}}},
+		{"Date", `aws:CurrentTime lt 2025-01-01T00:00:00Z`,
+			awsIamConditions.Condition{"DateLessThan": {"aws:CurrentTime": {"2025-01-01T00:00:00Z"}}}},
+		{"Bool", `aws:MultiFactorAuthPresent eq true`, awsIamConditions.Condition{"Bool": {"aws:MultiFactorAuthPresent": {"true"}}}},
+		{"Present", `aws:PrincipalTag/team pr`, awsIamConditions.Condition{"Null": {"aws:PrincipalTag/team": {"false"}}}},
+		{"Not present", `not(aws:TokenIssueTime pr)`, awsIamConditions.Condition{"Null": {"aws:TokenIssueTime": {"true"}}}},
+		{"Policy variable", `s3:prefix eq aws:username`, awsIamConditions.Condition{"StringEquals": {"s3:prefix": {"${aws:username}"}}}},
+		{"Attribute map", `subject.team eq "hr"`, awsIamConditions.Condition{"StringEquals": {"aws:PrincipalTag/team": {"hr"}}}},
+		{"And", `(aws:RequestedRegion eq "us-west-2" or aws:RequestedRegion eq "us-east-1") and aws:MultiFactorAuthPresent eq true`,
+			awsIamConditions.Condition{
+				"StringEquals": {"aws:RequestedRegion": {"us-west-2", "us-east-1"}},
+				"Bool":         {"aws:MultiFactorAuthPresent": {"true"}},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := mapper.MapConditionToIam(&conditions.ConditionInfo{Rule: tt.idql, Action: conditions.AAllow})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.iam, res)
+
+			// and back again
+			cond, err := mapper.MapIamToCondition(res)
+			assert.NoError(t, err)
+			assert.Equal(t, conditions.AAllow, cond.Action)
+			res2, err := mapper.MapConditionToIam(cond)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.iam, res2)
+		})
+	}
+
+	res, err := mapper.MapConditionToIam(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+}
+
+func TestMapToIam_Deny(t *testing.T) {
+	// the policy applies unless the rule is met
+	res, err := mapper.MapConditionToIam(&conditions.ConditionInfo{
+		Rule:   `aws:RequestedRegion eq "us-west-2" or aws:MultiFactorAuthPresent eq false`,
+		Action: conditions.ADeny,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, awsIamConditions.Condition{
+		"StringNotEquals": {"aws:RequestedRegion": {"us-west-2"}},
+		"Bool":            {"aws:MultiFactorAuthPresent": {"true"}},
+	}, res)
+
+	res, err = mapper.MapConditionToIam(&conditions.ConditionInfo{Rule: `s3:max-keys gt 10`, Action: conditions.ADeny})
+	assert.NoError(t, err)
+	assert.Equal(t, awsIamConditions.Condition{"NumericLessThanEquals": {"s3:max-keys": {"10"}}}, res)
+}
+
+func TestMapToIam_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		idql string
+		err  string
+	}{
+		{"Or of different keys", `aws:RequestedRegion eq "us-west-2" or s3:prefix eq "home"`, "only support alternatives"},
+		{"Key matched twice", `aws:RequestedRegion eq "us-west-2" and aws:RequestedRegion eq "us-east-1"`, "more than one value"},
+		{"Wildcard in value", `s3:prefix sw "home*"`, "wildcards"},
+		{"String compare", `s3:prefix gt "a"`, "not supported by IAM conditions for string values"},
+		{"In", `aws:RequestedRegion in ["us-west-2"]`, "not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mapper.MapConditionToIam(&conditions.ConditionInfo{Rule: tt.idql, Action: conditions.AAllow})
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestMapIamToCondition(t *testing.T) {
+	cond, err := mapper.MapIamToCondition(awsIamConditions.Condition{
+		"StringLike":    {"s3:prefix": {"home/${aws:username}/*"}},
+		"NumericEquals": {"s3:max-keys": {"5"}},
+	})
+	assert.ErrorContains(t, err, "policy variables")
+	assert.Nil(t, cond)
+
+	_, err = mapper.MapIamToCondition(awsIamConditions.Condition{"StringLike": {"s3:prefix": {"home/*/docs"}}})
+	assert.ErrorContains(t, err, "only leading or trailing wildcards")
+
+	cond, err = mapper.MapIamToCondition(awsIamConditions.Condition{
+		"StringLike":         {"s3:prefix": {"home/", "*.txt"}},
+		"NumericGreaterThan": {"s3:max-keys": {"5"}},
+		"StringNotEquals":    {"aws:PrincipalTag/team": {"hr", "${aws:username}"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `s3:max-keys gt 5 and (s3:prefix eq "home/" or s3:prefix ew ".txt") and subject.team ne "hr" and subject.team ne aws:username`, cond.Rule)
+
+	for _, operator := range []string{"StringEqualsIfExists", "ForAnyValue:StringEquals", "IpAddress", "ArnLike"} {
+		_, err = mapper.MapIamToCondition(awsIamConditions.Condition{operator: {"aws:SourceArn": {"x"}}})
+		assert.ErrorContains(t, err, "not supported", operator)
+	}
+
+	_, err = mapper.MapIamToCondition(awsIamConditions.Condition{"DateLessThan": {"aws:CurrentTime": {"2025-01-01"}}})
+	assert.ErrorContains(t, err, "RFC3339")
+
+	cond, err = mapper.MapIamToCondition(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, cond)
+}
@@ -0,0 +1,279 @@
+package azureConditions
+
+/*
+ Condition mapper for Azure role assignment (ABAC) conditions - See:
+ https://learn.microsoft.com/en-us/azure/role-based-access-control/conditions-format
+
+ Azure conditions reference attributes by source (e.g. @Resource[Microsoft.Storage/storageAccounts/blobServices/containers:name]).
+ Each source is mapped to a leading IDQL attribute name (see DefaultSourceNames), so that the example becomes the IDQL
+ attribute resource.Microsoft.Storage/storageAccounts/blobServices/containers:name. ActionMatches{'<action>'} is mapped to
+ action eq "<action>".
+*/
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions/parser"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
+)
+
+// ConditionVersion is the Azure condition format version produced by the mapper
+const ConditionVersion = "2.0"
+
+const (
+	actionAttribute       = "action"
+	subOperationAttribute = "action.subOperation"
+)
+
+// DefaultSourceNames maps the leading IDQL attribute name to the equivalent Azure attribute source
+var DefaultSourceNames = map[string]string{
+	"resource": "@Resource",
+	"req":      "@Request",
+	"subject":  "@Principal",
+	"env":      "@Environment",
+}
+
+type AzureConditionMapper struct {
+	NameMapper *conditions.AttributeMap
+}
+
+func NewAzureConditionMapper(nameMap map[string]string) *AzureConditionMapper {
+	return &AzureConditionMapper{NameMapper: conditions.NewNameMapper(nameMap)}
+}
+
+/*
+MapConditionToAzure converts an IDQL condition into an Azure role assignment condition. A nil condition returns an empty
+string. Azure conditions can only limit the access granted by a role assignment, so conditions with an action of `deny`
+cannot be mapped.
+*/
+func (mapper *AzureConditionMapper) MapConditionToAzure(condition *conditions.ConditionInfo) (string, error) {
+	if condition == nil {
+		return "", nil
+	}
+	if condition.Action == conditions.ADeny {
+		return "", errors.New("azure role assignment conditions cannot deny access")
+	}
+	ast, err := conditions.ParseConditionRuleAst(*condition)
+	if err != nil {
+		return "", err
+	}
+	return mapper.mapFilterInternal(ast)
+}
+
+func (mapper *AzureConditionMapper) mapFilterInternal(ast parser.Expression) (string, error) {
+	switch element := ast.(type) {
+	case parser.NotExpression:
+		sub, err := mapper.mapFilterInternal(element.Expression)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("NOT (%s)", sub), nil
+	case parser.PrecedenceExpression:
+		sub, err := mapper.mapFilterInternal(element.Expression)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s)", sub), nil
+	case parser.LogicalExpression:
+		left, err := mapper.mapFilterInternal(element.Left)
+		if err != nil {
+			return "", err
+		}
+		right, err := mapper.mapFilterInternal(element.Right)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", left, strings.ToUpper(string(element.Operator)), right), nil
+	case parser.AttributeExpression:
+		return mapper.mapFilterAttrExpr(element)
+	case parser.ValuePathExpression:
+		return "", errors.New("IDQL ValuePath expression mapping to Azure conditions currently not supported")
+	}
+	return "", fmt.Errorf("unsupported IDQL expression: %s", ast.String())
+}
+
+func (mapper *AzureConditionMapper) mapFilterAttrExpr(attrExpr parser.AttributeExpression) (string, error) {
+	hexaName := attrExpr.AttributePath.String()
+	switch hexaName {
+	case actionAttribute, subOperationAttribute:
+		str, ok := attrExpr.CompareValue.(types.String)
+		if attrExpr.Operator != parser.EQ || !ok {
+			return "", fmt.Errorf("%s can only be compared to a string using eq", hexaName)
+		}
+		function := "ActionMatches"
+		if hexaName == subOperationAttribute {
+			function = "SubOperationMatches"
+		}
+		return fmt.Sprintf("%s{%s}", function, quote(str.Value().(string))), nil
+	}
+
+	attribute, err := mapper.mapAttributeName(hexaName)
+	if err != nil {
+		return "", err
+	}
+	if attrExpr.Operator == parser.PR {
+		return "Exists " + attribute, nil
+	}
+
+	if attrExpr.Operator == parser.IN {
+		array, ok := attrExpr.CompareValue.(types.Array)
+		if !ok {
+			return "", fmt.Errorf("%s in requires an array of values", hexaName)
+		}
+		items := array.Value().([]types.ComparableValue)
+		if len(items) == 0 {
+			return "", fmt.Errorf("%s in requires at least one value", hexaName)
+		}
+		vals := make([]string, len(items))
+		for i, item := range items {
+			if vals[i], err = mapper.mapValue(item); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%s ForAnyOfAnyValues:%sEquals {%s}", attribute, valueKind(items[0]), strings.Join(vals, ", ")), nil
+	}
+
+	value, err := mapper.mapValue(attrExpr.CompareValue)
+	if err != nil {
+		return "", err
+	}
+	kind := valueKind(attrExpr.CompareValue)
+	if kind == "String" {
+		rawValue := ""
+		if str, ok := attrExpr.CompareValue.(types.String); ok {
+			rawValue = str.Value().(string)
+		}
+		switch attrExpr.Operator {
+		case parser.SW:
+			return fmt.Sprintf("%s StringStartsWith %s", attribute, value), nil
+		case parser.EW:
+			return fmt.Sprintf("%s StringLike %s", attribute, quote("*"+rawValue)), nil
+		case parser.CO:
+			return fmt.Sprintf("%s StringLike %s", attribute, quote("*"+rawValue+"*")), nil
+		}
+	}
+
+	var suffix string
+	switch attrExpr.Operator {
+	case parser.EQ:
+		suffix = "Equals"
+	case parser.NE:
+		suffix = "NotEquals"
+	case parser.GT:
+		suffix = "GreaterThan"
+	case parser.GE:
+		suffix = "GreaterThanEquals"
+	case parser.LT:
+		suffix = "LessThan"
+	case parser.LE:
+		suffix = "LessThanEquals"
+	}
+	if suffix == "" || ((kind == "String" || kind == "Bool") && suffix != "Equals" && suffix != "NotEquals") {
+		return "", fmt.Errorf("IDQL operator '%s' is not supported by Azure conditions for %s values", attrExpr.Operator, strings.ToLower(kind))
+	}
+	return fmt.Sprintf("%s %s%s %s", attribute, kind, suffix, value), nil
+}
+
+// valueKind returns the prefix of the Azure operators that compare values of the type of value (e.g. Numeric)
+func valueKind(value types.Value) string {
+	switch value.ValueType() {
+	case types.TypeNumber:
+		return "Numeric"
+	case types.TypeBool:
+		return "Bool"
+	case types.TypeDate:
+		return "DateTime"
+	}
+	return "String"
+}
+
+// mapValue converts an IDQL value into an Azure condition literal or attribute reference
+func (mapper *AzureConditionMapper) mapValue(value types.Value) (string, error) {
+	switch v := value.(type) {
+	case types.String:
+		return quote(v.Value().(string)), nil
+	case types.Date:
+		return quote(v.String()), nil
+	case types.Entity:
+		return mapper.mapAttributeName(v.String())
+	case types.Numeric, types.Boolean:
+		return value.String(), nil
+	}
+	return "", fmt.Errorf("IDQL value %s cannot be mapped to an Azure condition", value.String())
+}
+
+// mapAttributeName converts an IDQL attribute name (e.g. resource.tags:project) into an Azure attribute reference
+func (mapper *AzureConditionMapper) mapAttributeName(hexaName string) (string, error) {
+	if mapper.NameMapper != nil {
+		if name := mapper.NameMapper.GetProviderAttributeName(hexaName); name != hexaName {
+			return name, nil
+		}
+	}
+	prefix, rest, found := strings.Cut(hexaName, ".")
+	if source, ok := DefaultSourceNames[prefix]; ok && found && rest != "" {
+		return fmt.Sprintf("%s[%s]", source, rest), nil
+	}
+	return "", fmt.Errorf("attribute %s cannot be mapped to an Azure condition attribute (use resource., req., subject. or env.)", hexaName)
+}
+
+// quote returns a single-quoted Azure condition string literal
+func quote(value string) string {
+	return "'" + value + "'"
+}
+
+// MapAzureToCondition converts an Azure role assignment condition into an IDQL condition that allows access.
+func (mapper *AzureConditionMapper) MapAzureToCondition(expression string) (*conditions.ConditionInfo, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+	ast, err := mapper.ParseExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	return &conditions.ConditionInfo{
+		Rule:   conditions.SerializeExpression(ast),
+		Action: conditions.AAllow,
+	}, nil
+}
+
+// ParseExpression parses an Azure role assignment condition into an IDQL condition AST
+func (mapper *AzureConditionMapper) ParseExpression(expression string) (parser.Expression, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, mapper: mapper}
+	ast, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("azure condition: unexpected token '%s' at position %d", p.tokens[p.pos].text, p.tokens[p.pos].offset)
+	}
+	if prec, ok := ast.(parser.PrecedenceExpression); ok {
+		return prec.Expression, nil
+	}
+	return ast, nil
+}
+
+// mapSourceName converts an Azure attribute reference (e.g. @Principal[Microsoft.Directory/CustomSecurityAttributes/Id:Engineering_Project]) into an IDQL attribute name
+func (mapper *AzureConditionMapper) mapSourceName(reference string) (string, error) {
+	if mapper.NameMapper != nil {
+		// reverse names are keyed in lower case
+		lower := strings.ToLower(reference)
+		if hexaName := mapper.NameMapper.GetHexaFilterAttributePath(lower); hexaName != lower {
+			return hexaName, nil
+		}
+	}
+	source, rest, found := strings.Cut(reference, "[")
+	if found && strings.HasSuffix(rest, "]") {
+		for idqlName, sourceName := range DefaultSourceNames {
+			if strings.EqualFold(source, sourceName) {
+				return idqlName + "." + strings.TrimSuffix(rest, "]"), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("azure condition: unsupported attribute reference %s", reference)
+}
@@ -0,0 +1,134 @@
+package azureConditions_test
+
+import (
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/models/conditionLangs/azureConditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/stretchr/testify/assert"
+)
+
+var mapper = azureConditions.NewAzureConditionMapper(map[string]string{
+	"subject.project": "@Principal[Microsoft.Directory/CustomSecurityAttributes/Id:Engineering_Project]",
+})
+
+const containerName = "@Resource[Microsoft.Storage/storageAccounts/blobServices/containers:name]"
+
+func TestMapToAzure(t *testing.T) {
+	tests := []struct {
+		name  string
+		idql  string
+		azure string
+	}{
+		{"Equals", `resource.Microsoft.Storage/storageAccounts/blobServices/containers:name eq "blobs-example-container"`,
+			containerName + ` StringEquals 'blobs-example-container'`},
+		{"Action scoped", `not(action eq "Microsoft.Storage/storageAccounts/blobServices/containers/blobs/read") or resource.Microsoft.Storage/storageAccounts/blobServices/containers:name eq "logs"`,
+			`NOT (ActionMatches{'Microsoft.Storage/storageAccounts/blobServices/containers/blobs/read'}) OR ` + containerName + ` StringEquals 'logs'`},
+		{"Numeric and", `req.Microsoft.Storage/storageAccounts/blobServices/containers/blobs:versionId ge 3 and env.UtcNow lt 2024-05-01T13:00:00Z`,
+			`@Request[Microsoft.Storage/storageAccounts/blobServices/containers/blobs:versionId] NumericGreaterThanEquals 3 AND @Environment[UtcNow] DateTimeLessThan '2024-05-01T13:00:00Z'`},
+		{"Starts with", `resource.blobs:path sw "logs/"`, `@Resource[blobs:path] StringStartsWith 'logs/'`},
+		{"Contains", `resource.blobs:path co "2024"`, `@Resource[blobs:path] StringLike '*2024*'`},
+		{"Ends with", `resource.blobs:path ew ".txt"`, `@Resource[blobs:path] StringLike '*.txt'`},
+		{"Present", `resource.tags:Project pr`, `Exists @Resource[tags:Project]`},
+		{"In", `resource.tags:Project in ["Alpine", "Baker"]`, `@Resource[tags:Project] ForAnyOfAnyValues:StringEquals {'Alpine', 'Baker'}`},
+		{"Attribute compare", `subject.project eq resource.tags:Project`,
+			`@Principal[Microsoft.Directory/CustomSecurityAttributes/Id:Engineering_Project] StringEquals @Resource[tags:Project]`},
+		{"Boolean", `resource.encrypted ne false`, `@Resource[encrypted] BoolNotEquals false`},
+		{"Precedence", `resource.a eq "1" and (resource.b eq "2" or resource.c eq "3")`,
+			`@Resource[a] StringEquals '1' AND (@Resource[b] StringEquals '2' OR @Resource[c] StringEquals '3')`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := mapper.MapConditionToAzure(&conditions.ConditionInfo{Rule: tt.idql, Action: conditions.AAllow})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.azure, res)
+
+			// and back again
+			cond, err := mapper.MapAzureToCondition(res)
+			assert.NoError(t, err)
+			res2, err := mapper.MapConditionToAzure(cond)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.azure, res2)
+		})
+	}
+
+	res, err := mapper.MapConditionToAzure(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func TestMapToAzure_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		cond conditions.ConditionInfo
+		err  string
+	}{
+		{"Deny", conditions.ConditionInfo{Rule: `resource.a eq "1"`, Action: conditions.ADeny}, "azure role assignment conditions cannot deny access"},
+		{"Unknown source", conditions.ConditionInfo{Rule: `user.a eq "1"`}, "attribute user.a cannot be mapped"},
+		{"String order", conditions.ConditionInfo{Rule: `resource.a gt "b"`}, "IDQL operator 'gt' is not supported by Azure conditions for string values"},
+		{"Action operator", conditions.ConditionInfo{Rule: `action sw "Microsoft.Storage"`}, "action can only be compared to a string using eq"},
+		{"Value path", conditions.ConditionInfo{Rule: `subject.emails[type eq "work"] pr`}, "ValuePath"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mapper.MapConditionToAzure(&tt.cond)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestMapAzureToCondition(t *testing.T) {
+	tests := []struct {
+		name  string
+		azure string
+		idql  string
+	}{
+		{"Portal example", `((!(ActionMatches{'Microsoft.Storage/storageAccounts/blobServices/containers/blobs/read'})) OR (` + containerName + ` StringEquals 'blobs-example-container'))`,
+			`not(action eq "Microsoft.Storage/storageAccounts/blobServices/containers/blobs/read") or resource.Microsoft.Storage/storageAccounts/blobServices/containers:name eq "blobs-example-container"`},
+		{"Nested precedence", `((@Resource[a] StringEquals 'x')) AND ((@Resource[b] StringEquals 'y' OR @Resource[c] StringEquals 'z'))`,
+			`resource.a eq "x" and (resource.b eq "y" or resource.c eq "z")`},
+		{"Symbols", `@Resource[a] StringEquals 'x' && @Resource[b] StringNotEquals 'y' || !(@Resource[c] NumericLessThanEquals 5)`,
+			`resource.a eq "x" and resource.b ne "y" or not(resource.c le 5)`},
+		{"Not like", `@Resource[blobs:path] StringNotLike 'logs*'`, `not(resource.blobs:path sw "logs")`},
+		{"Not exists", `NotExists @Resource[tags:Project]`, `not(resource.tags:Project pr)`},
+		{"Sub operation", `SubOperationMatches{'Blob.List'}`, `action.subOperation eq "Blob.List"`},
+		{"Fractional date", `@Environment[UtcNow] DateTimeGreaterThan '2023-05-01T13:00:00.0Z'`, `env.UtcNow gt 2023-05-01T13:00:00Z`},
+		{"Name map", `@Principal[Microsoft.Directory/CustomSecurityAttributes/Id:Engineering_Project] ForAnyOfAnyValues:StringEquals {'Alpine'}`,
+			`subject.project in ["Alpine"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := mapper.MapAzureToCondition(tt.azure)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.idql, cond.Rule)
+			assert.Equal(t, conditions.AAllow, cond.Action)
+		})
+	}
+
+	cond, err := mapper.MapAzureToCondition("  ")
+	assert.NoError(t, err)
+	assert.Nil(t, cond)
+}
+
+func TestMapAzureToCondition_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		azure string
+		err   string
+	}{
+		{"Ignore case", `@Resource[a] StringEqualsIgnoreCase 'x'`, "operator StringEqualsIgnoreCase at position 13 has no IDQL equivalent"},
+		{"For all", `@Resource[a] ForAllOfAnyValues:StringEquals {'x'}`, "operator ForAllOfAnyValues:StringEquals at position 13 has no IDQL equivalent"},
+		{"Wildcard", `@Resource[a] StringLike 'a*b'`, "operator StringLike at position 13 has no IDQL equivalent"},
+		{"Unterminated string", `@Resource[a] StringEquals 'x`, "unterminated string at position 26"},
+		{"Unknown source", `@Tenant[a] StringEquals 'x'`, "unsupported attribute reference @Tenant[a]"},
+		{"Missing paren", `(@Resource[a] StringEquals 'x'`, "expected ')' at end of expression"},
+		{"Trailing", `@Resource[a] StringEquals 'x' 'y'`, "unexpected token 'y' at position 30"},
+		{"Bad character", `@Resource[a] == 'x'`, "unexpected character '=' at position 13"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mapper.MapAzureToCondition(tt.azure)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package azureConditions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions/parser"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
+)
+
+const (
+	tokIdent = iota
+	tokAttribute
+	tokString
+	tokNumber
+	tokOperator
+)
+
+type token struct {
+	kind   int
+	text   string
+	offset int
+}
+
+// tokenize breaks an Azure condition into tokens. Attribute references (e.g. @Resource[...]) are returned as one token.
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			start := i
+			i++
+			for i < len(runes) && runes[i] != '\'' {
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("azure condition: unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokString, text: string(runes[start+1 : i-1]), offset: start})
+		case r == '@':
+			start := i
+			for i < len(runes) && runes[i] != ']' {
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("azure condition: unterminated attribute at position %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokAttribute, text: string(runes[start:i]), offset: start})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[start:i]), offset: start})
+		case unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == ':') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[start:i]), offset: start})
+		default:
+			start := i
+			op := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "&&", "||":
+					op = two
+				}
+			}
+			switch op {
+			case "&&", "||", "!", "(", ")", "{", "}", ",":
+			default:
+				return nil, fmt.Errorf("azure condition: unexpected character '%s' at position %d", op, start)
+			}
+			i += len(op)
+			tokens = append(tokens, token{kind: tokOperator, text: op, offset: start})
+		}
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	mapper *AzureConditionMapper
+}
+
+func (p *exprParser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *exprParser) isOperator(op string) bool {
+	tok := p.peek()
+	return tok != nil && tok.kind == tokOperator && tok.text == op
+}
+
+// isKeyword matches a logical keyword (AND, OR or NOT) or its symbolic form
+func (p *exprParser) isKeyword(keyword string, symbol string) bool {
+	tok := p.peek()
+	return tok != nil && (tok.kind == tokIdent && strings.EqualFold(tok.text, keyword) || tok.kind == tokOperator && tok.text == symbol)
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.isOperator(op) {
+		tok := p.peek()
+		if tok == nil {
+			return fmt.Errorf("azure condition: expected '%s' at end of expression", op)
+		}
+		return fmt.Errorf("azure condition: expected '%s' at position %d", op, tok.offset)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *exprParser) parseOr() (parser.Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR", "||") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = parser.LogicalExpression{Operator: parser.OR, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (parser.Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND", "&&") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = parser.LogicalExpression{Operator: parser.AND, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (parser.Expression, error) {
+	if p.isKeyword("NOT", "!") {
+		p.pos++
+		sub, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not(sub), nil
+	}
+	return p.parsePrimary()
+}
+
+// not negates sub. not() already implies precedence.
+func not(sub parser.Expression) parser.Expression {
+	if prec, ok := sub.(parser.PrecedenceExpression); ok {
+		sub = prec.Expression
+	}
+	return parser.NotExpression{Expression: sub}
+}
+
+func (p *exprParser) parsePrimary() (parser.Expression, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, errors.New("azure condition: unexpected end of expression")
+	}
+	if p.isOperator("(") {
+		p.pos++
+		sub, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(")"); err != nil {
+			return nil, err
+		}
+		// Azure conditions are often written with redundant parentheses, which are only kept around AND and OR
+		if _, ok := sub.(parser.LogicalExpression); !ok {
+			return sub, nil
+		}
+		return parser.PrecedenceExpression{Expression: sub}, nil
+	}
+
+	if tok.kind == tokIdent {
+		p.pos++
+		switch tok.text {
+		case "ActionMatches", "SubOperationMatches":
+			return p.parseActionMatches(tok.text)
+		case "Exists", "NotExists":
+			attr, err := p.parseAttribute()
+			if err != nil {
+				return nil, err
+			}
+			var exists parser.Expression = parser.AttributeExpression{AttributePath: attr, Operator: parser.PR}
+			if tok.text == "NotExists" {
+				exists = not(exists)
+			}
+			return exists, nil
+		}
+		return nil, fmt.Errorf("azure condition: unexpected '%s' at position %d", tok.text, tok.offset)
+	}
+
+	attr, err := p.parseAttribute()
+	if err != nil {
+		return nil, err
+	}
+	opTok := p.peek()
+	if opTok == nil || opTok.kind != tokIdent {
+		return nil, fmt.Errorf("azure condition: expected an operator after %s", tok.text)
+	}
+	p.pos++
+	return p.parseComparison(attr, *opTok)
+}
+
+func (p *exprParser) parseActionMatches(function string) (parser.Expression, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	if tok == nil || tok.kind != tokString {
+		return nil, fmt.Errorf("azure condition: %s requires a quoted action", function)
+	}
+	p.pos++
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	attribute := actionAttribute
+	if function == "SubOperationMatches" {
+		attribute = subOperationAttribute
+	}
+	return parser.AttributeExpression{AttributePath: *types.ParseEntity(attribute), Operator: parser.EQ, CompareValue: types.NewString(tok.text)}, nil
+}
+
+func (p *exprParser) parseAttribute() (types.Value, error) {
+	tok := p.peek()
+	if tok == nil || tok.kind != tokAttribute {
+		if tok == nil {
+			return nil, errors.New("azure condition: expected an attribute at end of expression")
+		}
+		return nil, fmt.Errorf("azure condition: expected an attribute at position %d", tok.offset)
+	}
+	p.pos++
+	name, err := p.mapper.mapSourceName(tok.text)
+	if err != nil {
+		return nil, err
+	}
+	return *types.ParseEntity(name), nil
+}
+
+var compareSuffixes = map[string]parser.CompareOperator{
+	"Equals":            parser.EQ,
+	"NotEquals":         parser.NE,
+	"GreaterThan":       parser.GT,
+	"GreaterThanEquals": parser.GE,
+	"LessThan":          parser.LT,
+	"LessThanEquals":    parser.LE,
+}
+
+// parseComparison maps an Azure operator (e.g. StringEquals or NumericLessThan) and its value to an IDQL comparison
+func (p *exprParser) parseComparison(attr types.Value, opTok token) (parser.Expression, error) {
+	operator := opTok.text
+	if setOperator, found := strings.CutPrefix(operator, "ForAnyOfAnyValues:"); found {
+		kind, _ := strings.CutSuffix(setOperator, "Equals")
+		if kind == setOperator || (kind != "String" && kind != "Numeric") {
+			return nil, fmt.Errorf("azure condition: operator %s has no IDQL equivalent", operator)
+		}
+		values, err := p.parseValues(kind)
+		if err != nil {
+			return nil, err
+		}
+		return parser.AttributeExpression{AttributePath: attr, Operator: parser.IN, CompareValue: types.NewArray(values)}, nil
+	}
+
+	for _, kind := range []string{"String", "Numeric", "DateTime", "Bool"} {
+		suffix, found := strings.CutPrefix(operator, kind)
+		if !found {
+			continue
+		}
+		value, err := p.parseValue(kind)
+		if err != nil {
+			return nil, err
+		}
+		if kind == "String" {
+			if expression, ok := stringExpression(attr, suffix, value); ok {
+				return expression, nil
+			}
+		}
+		if op, ok := compareSuffixes[suffix]; ok && (kind == "Numeric" || kind == "DateTime" || op == parser.EQ || op == parser.NE) {
+			return parser.AttributeExpression{AttributePath: attr, Operator: op, CompareValue: value}, nil
+		}
+		break
+	}
+	return nil, fmt.Errorf("azure condition: operator %s at position %d has no IDQL equivalent", operator, opTok.offset)
+}
+
+// stringExpression maps the Azure string operators that have no direct IDQL comparison operator
+func stringExpression(attr types.Value, suffix string, value types.Value) (parser.Expression, bool) {
+	str, isString := value.(types.String)
+	if !isString {
+		return nil, false
+	}
+	negate := false
+	if strings.HasPrefix(suffix, "Not") && suffix != "NotEquals" {
+		negate = true
+		suffix = strings.TrimPrefix(suffix, "Not")
+	}
+
+	var expression parser.Expression
+	pattern := str.Value().(string)
+	switch suffix {
+	case "StartsWith":
+		expression = parser.AttributeExpression{AttributePath: attr, Operator: parser.SW, CompareValue: value}
+	case "Like":
+		// Only patterns with a leading and/or trailing wildcard have an IDQL equivalent
+		literal := strings.TrimSuffix(strings.TrimPrefix(pattern, "*"), "*")
+		if strings.ContainsAny(literal, "*?") {
+			return nil, false
+		}
+		op := parser.EQ
+		switch {
+		case len(pattern) >= 2 && strings.HasPrefix(pattern, "*") && strings.HasSuffix(pattern, "*"):
+			op = parser.CO
+		case strings.HasPrefix(pattern, "*"):
+			op = parser.EW
+		case strings.HasSuffix(pattern, "*"):
+			op = parser.SW
+		}
+		expression = parser.AttributeExpression{AttributePath: attr, Operator: op, CompareValue: types.NewString(literal)}
+	default:
+		return nil, false
+	}
+	if negate {
+		expression = not(expression)
+	}
+	return expression, true
+}
+
+// parseValue parses a literal or attribute reference compared using an operator for values of kind (e.g. Numeric)
+func (p *exprParser) parseValue(kind string) (types.Value, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, errors.New("azure condition: expected a value at end of expression")
+	}
+	if tok.kind == tokAttribute {
+		return p.parseAttribute()
+	}
+	p.pos++
+	switch {
+	case tok.kind == tokString && kind == "DateTime":
+		return types.NewDate(tok.text)
+	case tok.kind == tokString:
+		return types.NewString(tok.text), nil
+	case tok.kind == tokNumber && kind == "Numeric":
+		return types.NewNumeric(tok.text)
+	case tok.kind == tokIdent && kind == "Bool" && (strings.EqualFold(tok.text, "true") || strings.EqualFold(tok.text, "false")):
+		return types.NewBoolean(strings.ToLower(tok.text)), nil
+	}
+	return nil, fmt.Errorf("azure condition: unexpected value '%s' at position %d", tok.text, tok.offset)
+}
+
+// parseValues parses a set of values (e.g. {'a', 'b'})
+func (p *exprParser) parseValues(kind string) ([]types.ComparableValue, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var values []types.ComparableValue
+	for !p.isOperator("}") {
+		if len(values) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		val, err := p.parseValue(kind)
+		if err != nil {
+			return nil, err
+		}
+		comparable, ok := val.(types.ComparableValue)
+		if !ok {
+			return nil, fmt.Errorf("azure condition: set values must be literals, found '%s'", val.String())
+		}
+		values = append(values, comparable)
+	}
+	p.pos++
+	return values, nil
+}
@@ -0,0 +1,243 @@
+package casbinConditions
+
+/*
+ Condition mapper for Casbin matcher expressions - See: https://casbin.org/docs/syntax-for-models#matchers
+
+ Casbin matchers are evaluated using govaluate expression syntax. IDQL conditions are mapped to expressions that
+ reference the Casbin request tuple (e.g. r.sub.department == 'Sales').
+*/
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions/parser"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
+)
+
+// DefaultRequestNames maps the leading IDQL attribute name to the equivalent Casbin request definition token
+var DefaultRequestNames = map[string]string{
+	"subject":  "r.sub",
+	"resource": "r.obj",
+	"action":   "r.act",
+	"domain":   "r.dom",
+}
+
+type CasbinConditionMapper struct {
+	NameMapper *conditions.AttributeMap
+}
+
+func NewCasbinConditionMapper(nameMap map[string]string) *CasbinConditionMapper {
+	return &CasbinConditionMapper{NameMapper: conditions.NewNameMapper(nameMap)}
+}
+
+// MapConditionToCasbin converts an IDQL condition into a Casbin matcher expression. Conditions with an action of
+// `deny` are negated. A nil condition returns an empty string.
+func (mapper *CasbinConditionMapper) MapConditionToCasbin(condition *conditions.ConditionInfo) (string, error) {
+	if condition == nil {
+		return "", nil
+	}
+	ast, err := conditions.ParseConditionRuleAst(*condition)
+	if err != nil {
+		return "", err
+	}
+	err = checkCompatibility(ast)
+	if err != nil {
+		return "", err
+	}
+	expression := mapper.mapFilterInternal(ast, false)
+	if condition.Action == conditions.ADeny {
+		return fmt.Sprintf("!(%s)", expression), nil
+	}
+	return expression, nil
+}
+
+func (mapper *CasbinConditionMapper) mapFilterInternal(ast parser.Expression, isChild bool) string {
+	switch element := ast.(type) {
+	case parser.NotExpression:
+		return fmt.Sprintf("!(%s)", mapper.mapFilterInternal(element.Expression, false))
+	case parser.PrecedenceExpression:
+		return fmt.Sprintf("(%s)", mapper.mapFilterInternal(element.Expression, false))
+	case parser.LogicalExpression:
+		return mapper.mapFilterLogical(element, isChild)
+	default:
+		return mapper.mapFilterAttrExpr(ast.(parser.AttributeExpression))
+	}
+}
+
+func (mapper *CasbinConditionMapper) mapFilterLogical(logicFilter parser.LogicalExpression, isChild bool) string {
+	isDouble := false
+	switch subFilter := logicFilter.Left.(type) {
+	case parser.LogicalExpression:
+		if subFilter.Operator == logicFilter.Operator {
+			isDouble = true
+		}
+	}
+
+	left := mapper.mapFilterInternal(logicFilter.Left, !isDouble)
+	right := mapper.mapFilterInternal(logicFilter.Right, !isDouble)
+
+	switch logicFilter.Operator {
+	case parser.OR:
+		if isChild {
+			return fmt.Sprintf("(%s || %s)", left, right)
+		}
+		return fmt.Sprintf("%s || %s", left, right)
+	default:
+		return fmt.Sprintf("%s && %s", left, right)
+	}
+}
+
+// mapValue converts an IDQL value into a govaluate literal. Strings are single-quoted so that the expression can
+// be embedded in a policy.csv field without escaping.
+func (mapper *CasbinConditionMapper) mapValue(value types.Value) string {
+	switch v := value.(type) {
+	case types.String:
+		return quote(v.Value().(string))
+	case types.Date:
+		return quote(v.String())
+	case types.Array:
+		items := v.Value().([]types.ComparableValue)
+		vals := make([]string, len(items))
+		for i, item := range items {
+			vals[i] = mapper.mapValue(item)
+		}
+		return "(" + strings.Join(vals, ", ") + ")"
+	case types.Entity:
+		return mapper.mapAttributeName(v.String())
+	default:
+		return value.String()
+	}
+}
+
+func (mapper *CasbinConditionMapper) mapAttributeName(hexaName string) string {
+	name := mapper.NameMapper.GetProviderAttributeName(hexaName)
+	if name != hexaName {
+		return name
+	}
+	prefix, rest, found := strings.Cut(hexaName, ".")
+	if requestName, ok := DefaultRequestNames[strings.ToLower(prefix)]; ok {
+		if found {
+			return requestName + "." + rest
+		}
+		return requestName
+	}
+	return hexaName
+}
+
+func (mapper *CasbinConditionMapper) mapFilterAttrExpr(attrExpr parser.AttributeExpression) string {
+	mapPath := mapper.mapAttributeName(attrExpr.AttributePath.String())
+
+	compareValue := ""
+	rawValue := ""
+	if attrExpr.CompareValue != nil {
+		compareValue = mapper.mapValue(attrExpr.CompareValue)
+		rawValue = attrExpr.CompareValue.String()
+		if str, ok := attrExpr.CompareValue.(types.String); ok {
+			rawValue = str.Value().(string)
+		}
+	}
+
+	switch attrExpr.Operator {
+	case parser.NE:
+		return mapPath + " != " + compareValue
+	case parser.LT:
+		return mapPath + " < " + compareValue
+	case parser.LE:
+		return mapPath + " <= " + compareValue
+	case parser.GT:
+		return mapPath + " > " + compareValue
+	case parser.GE:
+		return mapPath + " >= " + compareValue
+	case parser.SW:
+		return fmt.Sprintf("regexMatch(%s, %s)", mapPath, quote("^"+regexp.QuoteMeta(rawValue)))
+	case parser.EW:
+		return fmt.Sprintf("regexMatch(%s, %s)", mapPath, quote(regexp.QuoteMeta(rawValue)+"$"))
+	case parser.CO:
+		return fmt.Sprintf("regexMatch(%s, %s)", mapPath, quote(regexp.QuoteMeta(rawValue)))
+	case parser.PR:
+		return mapPath + " != ''"
+	case parser.IN:
+		return mapPath + " in " + compareValue
+	default:
+		return mapPath + " == " + compareValue
+	}
+}
+
+// quote returns a single-quoted govaluate string literal. Note that govaluate removes escape backslashes when parsing.
+func quote(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	return "'" + strings.ReplaceAll(value, "'", "\\'") + "'"
+}
+
+func checkCompatibility(e parser.Expression) error {
+	switch v := e.(type) {
+	case parser.LogicalExpression:
+		if err := checkCompatibility(v.Left); err != nil {
+			return err
+		}
+		return checkCompatibility(v.Right)
+	case parser.NotExpression:
+		return checkCompatibility(v.Expression)
+	case parser.PrecedenceExpression:
+		return checkCompatibility(v.Expression)
+	case parser.ValuePathExpression:
+		return errors.New("IDQL ValuePath expression mapping to Casbin currently not supported")
+	case parser.AttributeExpression:
+		if v.Operator == parser.IS {
+			return errors.New("IDQL 'is' operator is not supported by Casbin matchers")
+		}
+	}
+	return nil
+}
+
+// MapCasbinToCondition converts a Casbin matcher expression (govaluate syntax) into an IDQL condition.
+func (mapper *CasbinConditionMapper) MapCasbinToCondition(expression string) (*conditions.ConditionInfo, error) {
+	if strings.TrimSpace(expression) == "" || strings.TrimSpace(expression) == "true" {
+		return nil, nil
+	}
+	ast, err := mapper.ParseExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	return &conditions.ConditionInfo{
+		Rule:   conditions.SerializeExpression(ast),
+		Action: conditions.AAllow,
+	}, nil
+}
+
+// ParseExpression parses a Casbin matcher expression into an IDQL condition AST
+func (mapper *CasbinConditionMapper) ParseExpression(expression string) (parser.Expression, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, mapper: mapper}
+	ast, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("casbin expression: unexpected token '%s' at position %d", p.tokens[p.pos].text, p.tokens[p.pos].offset)
+	}
+	return ast, nil
+}
+
+// mapRequestName converts a Casbin request attribute (e.g. r.sub.department) into an IDQL attribute name
+func (mapper *CasbinConditionMapper) mapRequestName(name string) string {
+	hexaName := mapper.NameMapper.GetHexaFilterAttributePath(name)
+	if hexaName != name {
+		return hexaName
+	}
+	for idqlName, requestName := range DefaultRequestNames {
+		if name == requestName {
+			return idqlName
+		}
+		if strings.HasPrefix(name, requestName+".") {
+			return idqlName + name[len(requestName):]
+		}
+	}
+	return name
+}
@@ -0,0 +1,96 @@
+package casbinConditions_test
+
+import (
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/models/conditionLangs/casbinConditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/stretchr/testify/assert"
+)
+
+var mapper = casbinConditions.NewCasbinConditionMapper(map[string]string{
+	"req.ip": "r.ip",
+})
+
+func TestMapToCasbin(t *testing.T) {
+	tests := []struct {
+		name   string
+		idql   string
+		casbin string
+	}{
+		{"Equals", `subject.department eq "Sales"`, `r.sub.department == 'Sales'`},
+		{"Numeric and", `subject.age ge 18 and resource.level lt 5`, `r.sub.age >= 18 && r.obj.level < 5`},
+		{"Nested or", `subject.department eq "Sales" and (subject.level gt 2 or action.name eq "read")`,
+			`r.sub.department == 'Sales' && (r.sub.level > 2 || r.act.name == 'read')`},
+		{"Not", `not(subject.department eq "Sales")`, `!(r.sub.department == 'Sales')`},
+		{"Starts with", `resource.path sw "/api/v1"`, `regexMatch(r.obj.path, '^/api/v1')`},
+		{"Ends with", `resource.name ew ".jpg"`, `regexMatch(r.obj.name, '\\.jpg$')`},
+		{"Contains", `subject.email co "@hexa"`, `regexMatch(r.sub.email, '@hexa')`},
+		{"Present", `subject.email pr`, `r.sub.email != ''`},
+		{"In list", `subject.department in ["Sales", "Marketing"]`, `r.sub.department in ('Sales', 'Marketing')`},
+		{"Name map", `req.ip eq "127.0.0.1"`, `r.ip == '127.0.0.1'`},
+		{"Attribute compare", `resource.owner eq subject.name`, `r.obj.owner == r.sub.name`},
+		{"Quoted", `subject.name eq "O'Malley"`, `r.sub.name == 'O\'Malley'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := mapper.MapConditionToCasbin(&conditions.ConditionInfo{Rule: tt.idql, Action: conditions.AAllow})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.casbin, res)
+
+			cond, err := mapper.MapCasbinToCondition(res)
+			assert.NoError(t, err)
+			assert.NotNil(t, cond)
+			expected := &conditions.ConditionInfo{Rule: tt.idql, Action: conditions.AAllow}
+			assert.True(t, expected.Equals(cond), "expected %s, got %s", expected.Rule, cond.Rule)
+		})
+	}
+}
+
+func TestMapDenyCondition(t *testing.T) {
+	res, err := mapper.MapConditionToCasbin(&conditions.ConditionInfo{Rule: `subject.level lt 3`, Action: conditions.ADeny})
+	assert.NoError(t, err)
+	assert.Equal(t, `!(r.sub.level < 3)`, res)
+
+	res, err = mapper.MapConditionToCasbin(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", res)
+}
+
+func TestMapFromCasbin(t *testing.T) {
+	tests := []struct {
+		name   string
+		casbin string
+		idql   string
+		err    bool
+	}{
+		{"Empty", "", "", false},
+		{"True", "true", "", false},
+		{"Reversed", `'Sales' == r.sub.dept`, `subject.dept eq "Sales"`, false},
+		{"Reversed gt", `18 < r.sub.age`, `subject.age gt 18`, false},
+		{"Boolean attr", `r.sub.active && r.obj.public == true`, `subject.active eq true and resource.public eq true`, false},
+		{"Double quotes", `r.sub.dept == "Sales"`, `subject.dept eq "Sales"`, false},
+		{"keyMatch", `keyMatch(r.obj.path, '/api/*')`, `resource.path sw "/api/"`, false},
+		{"Not precedence", `!(r.sub.a == 1 || r.sub.b == 2)`, `not(subject.a eq 1 or subject.b eq 2)`, false},
+		{"Regex unsupported", `regexMatch(r.obj.path, '^/api/.*/x$')`, "", true},
+		{"Function unsupported", `ipMatch(r.sub.ip, '192.168.0.0/16')`, "", true},
+		{"Bad token", `r.sub.a === 1`, "", true},
+		{"Unterminated", `r.sub.a == 'abc`, "", true},
+		{"Missing paren", `(r.sub.a == 1`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := mapper.MapCasbinToCondition(tt.casbin)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.idql == "" {
+				assert.Nil(t, cond)
+				return
+			}
+			assert.Equal(t, tt.idql, cond.Rule)
+		})
+	}
+}
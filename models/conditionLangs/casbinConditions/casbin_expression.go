@@ -0,0 +1,381 @@
+package casbinConditions
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions/parser"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
+)
+
+const (
+	tokIdent = iota
+	tokString
+	tokNumber
+	tokOperator
+)
+
+type token struct {
+	kind   int
+	text   string
+	offset int
+}
+
+// tokenize breaks a govaluate expression into tokens
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			start := i
+			sb := strings.Builder{}
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == r {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("casbin expression: unterminated string at position %d", start)
+			}
+			tokens = append(tokens, token{kind: tokString, text: sb.String(), offset: start})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[start:i]), offset: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[start:i]), offset: start})
+		default:
+			start := i
+			op := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "&&", "||", "==", "!=", ">=", "<=":
+					op = two
+				}
+			}
+			switch op {
+			case "&&", "||", "==", "!=", ">=", "<=", ">", "<", "!", "(", ")", ",":
+			default:
+				return nil, fmt.Errorf("casbin expression: unexpected character '%s' at position %d", op, start)
+			}
+			i += len(op)
+			tokens = append(tokens, token{kind: tokOperator, text: op, offset: start})
+		}
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	mapper *CasbinConditionMapper
+}
+
+func (p *exprParser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *exprParser) isOperator(op string) bool {
+	tok := p.peek()
+	return tok != nil && tok.kind == tokOperator && tok.text == op
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.isOperator(op) {
+		tok := p.peek()
+		if tok == nil {
+			return fmt.Errorf("casbin expression: expected '%s' at end of expression", op)
+		}
+		return fmt.Errorf("casbin expression: expected '%s' at position %d", op, tok.offset)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *exprParser) parseOr() (parser.Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = parser.LogicalExpression{Operator: parser.OR, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (parser.Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = parser.LogicalExpression{Operator: parser.AND, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (parser.Expression, error) {
+	if p.isOperator("!") {
+		p.pos++
+		sub, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		// not() already implies precedence
+		if prec, ok := sub.(parser.PrecedenceExpression); ok {
+			sub = prec.Expression
+		}
+		return parser.NotExpression{Expression: sub}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (parser.Expression, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, errors.New("casbin expression: unexpected end of expression")
+	}
+	if p.isOperator("(") {
+		p.pos++
+		sub, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(")"); err != nil {
+			return nil, err
+		}
+		return parser.PrecedenceExpression{Expression: sub}, nil
+	}
+
+	if tok.kind == tokIdent && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "(" && p.tokens[p.pos+1].kind == tokOperator {
+		return p.parseFunction()
+	}
+
+	left, isAttr, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	next := p.peek()
+	if next == nil || next.kind == tokOperator && (next.text == "&&" || next.text == "||" || next.text == ")") {
+		// A bare attribute is treated as a boolean test
+		if !isAttr {
+			return nil, fmt.Errorf("casbin expression: literal value '%s' is not a condition", left.String())
+		}
+		return parser.AttributeExpression{AttributePath: left, Operator: parser.EQ, CompareValue: types.NewBoolean("true")}, nil
+	}
+
+	if next.kind == tokIdent && next.text == "in" {
+		p.pos++
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return parser.AttributeExpression{AttributePath: left, Operator: parser.IN, CompareValue: list}, nil
+	}
+
+	var op parser.CompareOperator
+	switch next.text {
+	case "==":
+		op = parser.EQ
+	case "!=":
+		op = parser.NE
+	case ">":
+		op = parser.GT
+	case "<":
+		op = parser.LT
+	case ">=":
+		op = parser.GE
+	case "<=":
+		op = parser.LE
+	default:
+		return nil, fmt.Errorf("casbin expression: unsupported operator '%s' at position %d", next.text, next.offset)
+	}
+	p.pos++
+	right, rightIsAttr, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAttr && rightIsAttr {
+		// normalize so that the attribute is always on the left (e.g. 'Sales' == r.sub.dept)
+		left, right = right, left
+		switch op {
+		case parser.GT:
+			op = parser.LT
+		case parser.LT:
+			op = parser.GT
+		case parser.GE:
+			op = parser.LE
+		case parser.LE:
+			op = parser.GE
+		}
+	}
+
+	if op == parser.NE {
+		if str, ok := right.(types.String); ok && str.Value().(string) == "" {
+			return parser.AttributeExpression{AttributePath: left, Operator: parser.PR}, nil
+		}
+	}
+
+	return parser.AttributeExpression{AttributePath: left, Operator: op, CompareValue: right}, nil
+}
+
+// parseOperand returns the parsed value and true if the value is an attribute reference
+func (p *exprParser) parseOperand() (types.Value, bool, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, false, errors.New("casbin expression: unexpected end of expression")
+	}
+	p.pos++
+	switch tok.kind {
+	case tokString:
+		return types.NewString(tok.text), false, nil
+	case tokNumber:
+		val, err := types.NewNumeric(tok.text)
+		return val, false, err
+	case tokIdent:
+		if strings.EqualFold(tok.text, "true") || strings.EqualFold(tok.text, "false") {
+			return types.NewBoolean(tok.text), false, nil
+		}
+		val, err := types.ParseValue(p.mapper.mapRequestName(tok.text))
+		return val, true, err
+	}
+	return nil, false, fmt.Errorf("casbin expression: unexpected token '%s' at position %d", tok.text, tok.offset)
+}
+
+func (p *exprParser) parseList() (types.Value, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var values []types.ComparableValue
+	for !p.isOperator(")") {
+		if len(values) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		val, _, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		comparable, ok := val.(types.ComparableValue)
+		if !ok {
+			return nil, fmt.Errorf("casbin expression: list values must be literals, found '%s'", val.String())
+		}
+		values = append(values, comparable)
+	}
+	p.pos++
+	return types.NewArray(values), nil
+}
+
+// parseFunction maps the Casbin matching functions that have an IDQL equivalent
+func (p *exprParser) parseFunction() (parser.Expression, error) {
+	name := p.tokens[p.pos]
+	p.pos += 2 // skip name and (
+	var args []token
+	for !p.isOperator(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		tok := p.peek()
+		if tok == nil {
+			return nil, fmt.Errorf("casbin expression: unterminated call to %s", name.text)
+		}
+		args = append(args, *tok)
+		p.pos++
+	}
+	p.pos++
+
+	if len(args) != 2 || args[0].kind != tokIdent || args[1].kind != tokString {
+		return nil, fmt.Errorf("casbin expression: unsupported call to %s at position %d", name.text, name.offset)
+	}
+	attr, err := types.ParseValue(p.mapper.mapRequestName(args[0].text))
+	if err != nil {
+		return nil, err
+	}
+	pattern := args[1].text
+
+	switch name.text {
+	case "regexMatch":
+		if lit, ok := unquoteMeta(strings.TrimPrefix(pattern, "^")); ok && strings.HasPrefix(pattern, "^") {
+			return parser.AttributeExpression{AttributePath: attr, Operator: parser.SW, CompareValue: types.NewString(lit)}, nil
+		}
+		if lit, ok := unquoteMeta(strings.TrimSuffix(pattern, "$")); ok && strings.HasSuffix(pattern, "$") && !strings.HasSuffix(pattern, "\\$") {
+			return parser.AttributeExpression{AttributePath: attr, Operator: parser.EW, CompareValue: types.NewString(lit)}, nil
+		}
+		if lit, ok := unquoteMeta(pattern); ok {
+			return parser.AttributeExpression{AttributePath: attr, Operator: parser.CO, CompareValue: types.NewString(lit)}, nil
+		}
+	case "keyMatch", "globMatch":
+		if strings.HasSuffix(pattern, "*") && !strings.Contains(pattern[:len(pattern)-1], "*") {
+			return parser.AttributeExpression{AttributePath: attr, Operator: parser.SW, CompareValue: types.NewString(pattern[:len(pattern)-1])}, nil
+		}
+		if !strings.Contains(pattern, "*") {
+			return parser.AttributeExpression{AttributePath: attr, Operator: parser.EQ, CompareValue: types.NewString(pattern)}, nil
+		}
+	}
+	return nil, fmt.Errorf("casbin expression: %s(%s, %s) has no IDQL equivalent", name.text, args[0].text, strconv.Quote(pattern))
+}
+
+// unquoteMeta returns the literal value of a regular expression if it contains only literal or escaped characters
+func unquoteMeta(pattern string) (string, bool) {
+	sb := strings.Builder{}
+	escaped := false
+	for _, r := range pattern {
+		if escaped {
+			sb.WriteRune(r)
+			escaped = false
+			continue
+		}
+		if r == '\\' {
+			escaped = true
+			continue
+		}
+		if strings.ContainsRune(`.+*?()|[]{}^$`, r) {
+			return "", false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String(), !escaped
+}
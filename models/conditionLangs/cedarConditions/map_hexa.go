@@ -3,12 +3,14 @@ package cedarConditions
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/cedar-policy/cedar-go/types"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
 	hexaParser "github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions/parser"
+	hexaTypes "github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
 )
 
 type CedarConditionMapper struct {
@@ -281,10 +283,20 @@ func removeQuotes(val string) string {
 	return val
 }
 
+// mapCompareValue converts IDQL entity values (e.g. PhotoApp:Account:"stacey") into Cedar entity references (e.g. PhotoApp::Account::"stacey")
+func mapCompareValue(value hexaTypes.Value) string {
+	if entity, ok := value.(hexaTypes.Entity); ok && entity.Type == hexaTypes.RelTypeEquals && entity.Types != nil && entity.Id != nil && !entity.IsPath() {
+		if !slices.Contains(entity.Types, "") { // already in Cedar form (e.g. PhotoApp::Account::"stacey")
+			return strings.Join(entity.Types, "::") + "::" + *entity.Id
+		}
+	}
+	return value.String()
+}
+
 func (mapper *CedarConditionMapper) mapFilterAttrExpr(attrExpr *hexaParser.AttributeExpression) string {
 	compareValue := ""
 	if attrExpr.CompareValue != nil {
-		compareValue = attrExpr.CompareValue.String()
+		compareValue = mapCompareValue(attrExpr.CompareValue)
 	}
 
 	mapPath := mapper.NameMapper.GetProviderAttributeName(attrExpr.AttributePath.String())
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/cel-go/cel"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
@@ -19,10 +21,50 @@ var (
 	env, _ = cel.NewEnv()
 )
 
+// valuePathVar is the CEL iteration variable used when an IDQL value path is mapped to the exists() macro
+const valuePathVar = "x"
+
+/*
+iamAttributeNames maps IDQL request attributes to the Google IAM condition attribute names
+(see: https://cloud.google.com/iam/docs/conditions-attribute-reference). Resource attributes such as resource.name and
+resource.type have the same name in IDQL and IAM. Names in the mapper's NameMapper take precedence.
+*/
+var iamAttributeNames = map[string]string{
+	"req.time": "request.time",
+	"req.host": "request.host",
+	"req.path": "request.path",
+}
+
 type GoogleConditionMapper struct {
 	NameMapper *conditions.AttributeMap
 }
 
+func (mapper *GoogleConditionMapper) providerName(hexaName string) string {
+	if mapper.NameMapper != nil {
+		if name := mapper.NameMapper.GetProviderAttributeName(hexaName); name != hexaName {
+			return name
+		}
+	}
+	if name, ok := iamAttributeNames[hexaName]; ok {
+		return name
+	}
+	return hexaName
+}
+
+func (mapper *GoogleConditionMapper) hexaName(provName string) string {
+	if mapper.NameMapper != nil {
+		if name := mapper.NameMapper.GetHexaFilterAttributePath(provName); name != provName {
+			return name
+		}
+	}
+	for hexaName, iamName := range iamAttributeNames {
+		if iamName == provName {
+			return hexaName
+		}
+	}
+	return provName
+}
+
 func (mapper *GoogleConditionMapper) MapConditionToProvider(condition conditions.ConditionInfo) (string, error) {
 	// assumes https://github.com/google/cel-spec/blob/master/doc/langdef.md#logical-operators
 	ast, err := conditions.ParseConditionRuleAst(condition)
@@ -52,22 +94,47 @@ func (mapper *GoogleConditionMapper) mapFilterInternal(ast parser.Expression, is
 	case parser.LogicalExpression:
 		return mapper.mapFilterLogical(element, isChild)
 
+	case parser.ValuePathExpression:
+		return mapper.mapFilterValuePath(element)
+
 	default:
 		attrExpression := ast.(parser.AttributeExpression)
 		return mapper.mapFilterAttrExpr(attrExpression)
 	}
-	// return mapTool.mapFilterValuePath(deref.(idqlCondition.ValuePathExpression))
 }
 
 /*
-func (mapTool *GoogleConditionMapper) mapFilterValuePath(vpFilter idqlCondition.ValuePathExpression) string {
-	// See: https://cloud.google.com/access-context-manager/docs/custom-access-level-spec
-	subFilter := vpFilter.VPathFilter
-	attribute := vpFilter.Attribute
-	celFilter := mapTool.mapFilterInternal(&subFilter, false)
-	return attribute + ".exists(" + attribute + "," + celFilter + ")"
-}
+mapFilterValuePath maps an IDQL value path to the CEL exists() macro. The filter attributes are qualified by the
+iteration variable, and a sub-attribute comparison is added to the filter. For example:
+
+	emails[type eq "work"].value ew "strata.io"
+
+becomes:
+
+	emails.exists(x, x.type == "work" && x.value.endsWith("strata.io"))
 */
+func (mapper *GoogleConditionMapper) mapFilterValuePath(vpFilter parser.ValuePathExpression) string {
+	filter, _ := rewritePaths(vpFilter.VPathFilter, func(path string) (string, error) {
+		return valuePathVar + "." + path, nil
+	})
+	if vpFilter.Operator != nil && (*vpFilter.Operator != parser.PR || vpFilter.SubAttr != nil) {
+		path := valuePathVar
+		if vpFilter.SubAttr != nil {
+			path = path + "." + *vpFilter.SubAttr
+		}
+		filter = parser.LogicalExpression{
+			Operator: parser.AND,
+			Left:     filter,
+			Right: parser.AttributeExpression{
+				AttributePath: *types.ParseEntity(path),
+				Operator:      *vpFilter.Operator,
+				CompareValue:  vpFilter.CompareValue,
+			},
+		}
+	}
+	attribute := mapper.providerName(vpFilter.Attribute.String())
+	return fmt.Sprintf("%s.exists(%s, %s)", attribute, valuePathVar, mapper.mapFilterInternal(filter, false))
+}
 
 func (mapper *GoogleConditionMapper) mapFilterNot(notFilter parser.NotExpression, _ bool) string {
 	subExpression := notFilter.Expression
@@ -130,16 +197,10 @@ func (mapper *GoogleConditionMapper) mapFilterLogical(logicFilter parser.Logical
 func (mapper *GoogleConditionMapper) mapFilterAttrExpr(attrExpr parser.AttributeExpression) string {
 	compareValue := ""
 	if attrExpr.CompareValue != nil {
-		switch attrExpr.CompareValue.(type) {
-		case types.Date:
-			// GCP dates need to be quoted
-			compareValue = fmt.Sprintf("timestamp('%s')", attrExpr.CompareValue.String())
-		default:
-			compareValue = attrExpr.CompareValue.String()
-		}
+		compareValue = mapper.mapValue(attrExpr.CompareValue)
 	}
 
-	mapPath := mapper.NameMapper.GetProviderAttributeName(attrExpr.AttributePath.String())
+	mapPath := mapper.mapValue(attrExpr.AttributePath)
 
 	switch attrExpr.Operator {
 
@@ -169,6 +230,25 @@ func (mapper *GoogleConditionMapper) mapFilterAttrExpr(attrExpr parser.Attribute
 
 }
 
+func (mapper *GoogleConditionMapper) mapValue(value types.Value) string {
+	switch v := value.(type) {
+	case types.Date:
+		// GCP dates need to be quoted
+		return fmt.Sprintf("timestamp('%s')", v.String())
+	case types.Entity:
+		return mapper.providerName(v.String())
+	case types.Array:
+		values := v.Value().([]types.ComparableValue)
+		items := make([]string, len(values))
+		for i, item := range values {
+			items[i] = mapper.mapValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return value.String()
+	}
+}
+
 func (mapper *GoogleConditionMapper) MapProviderToCondition(expression string) (conditions.ConditionInfo, error) {
 
 	celAst, issues := env.Parse(expression)
@@ -208,14 +288,29 @@ func (mapper *GoogleConditionMapper) mapCelExpr(expression *expr.Expr, isChild b
 	switch v := kind.(type) {
 	case *expr.Expr_SelectExpr:
 		return mapper.mapSelectExpr(v)
-	// case *expr.Expr_ComprehensionExpr:
-	//	return nil, errors.New("unimplemented CEL 'comprehension expression' not implemented. ")
+	case *expr.Expr_ComprehensionExpr:
+		return mapper.mapComprehension(v.ComprehensionExpr)
 	default:
 		msg := fmt.Sprintf("unimplemented CEL expression: %s", expression.String())
 		return nil, fmt.Errorf(msg)
 	}
 }
 
+// celPath returns the dotted attribute path of a CEL identifier or field selection (e.g. request.auth.claims)
+func celPath(expression *expr.Expr) (string, bool) {
+	switch v := expression.GetExprKind().(type) {
+	case *expr.Expr_IdentExpr:
+		return v.IdentExpr.GetName(), true
+	case *expr.Expr_SelectExpr:
+		operand, ok := celPath(v.SelectExpr.GetOperand())
+		if !ok {
+			return "", false
+		}
+		return operand + "." + v.SelectExpr.GetField(), true
+	}
+	return "", false
+}
+
 func (mapper *GoogleConditionMapper) mapSelectExpr(selection *expr.Expr_SelectExpr) (parser.Expression, error) {
 	field := selection.SelectExpr.GetField()
 	/*
@@ -224,11 +319,11 @@ func (mapper *GoogleConditionMapper) mapSelectExpr(selection *expr.Expr_SelectEx
 		}
 	*/
 
-	ident := selection.SelectExpr.GetOperand().GetIdentExpr()
-
-	name := ident.GetName()
-	attr := name + "." + field
-	path := mapper.NameMapper.GetHexaFilterAttributePath(attr)
+	name, ok := celPath(selection.SelectExpr.GetOperand())
+	if !ok {
+		return nil, errors.New("unimplemented Google CEL Select Expression: " + selection.SelectExpr.String())
+	}
+	path := mapper.hexaName(name + "." + field)
 	lhv, err := types.ParseValue(path)
 	if err != nil {
 		return nil, err
@@ -239,6 +334,47 @@ func (mapper *GoogleConditionMapper) mapSelectExpr(selection *expr.Expr_SelectEx
 	}, nil
 }
 
+/*
+mapComprehension maps the CEL exists() macro to an IDQL value path. For example, emails.exists(x, x.type == "work")
+becomes emails[type eq "work"] pr. Other macros such as all() and exists_one() have no IDQL equivalent.
+*/
+func (mapper *GoogleConditionMapper) mapComprehension(comprehension *expr.Expr_Comprehension) (parser.Expression, error) {
+	// exists() expands to a loop step of `accumulator || predicate` (see https://github.com/google/cel-spec/blob/master/doc/langdef.md#macros)
+	step := comprehension.GetLoopStep().GetCallExpr()
+	if comprehension.GetAccuInit().GetConstExpr() == nil || step.GetFunction() != "_||_" || len(step.GetArgs()) != 2 ||
+		step.GetArgs()[0].GetIdentExpr().GetName() != comprehension.GetAccuVar() {
+		return nil, errors.New("unimplemented CEL macro: only exists() can be mapped to an IDQL value path")
+	}
+
+	name, ok := celPath(comprehension.GetIterRange())
+	if !ok {
+		return nil, fmt.Errorf("unimplemented CEL expression: %s", comprehension.GetIterRange().String())
+	}
+
+	filter, err := mapper.mapCelExpr(step.GetArgs()[1], false)
+	if err != nil {
+		return nil, err
+	}
+	iterVar := comprehension.GetIterVar()
+	filter, err = rewritePaths(filter, func(path string) (string, error) {
+		if !strings.HasPrefix(path, iterVar+".") {
+			return "", fmt.Errorf("exists() condition on %s must compare attributes of %s (found %s)", name, iterVar, path)
+		}
+		return strings.TrimPrefix(path, iterVar+"."), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attribute := types.ParseEntity(mapper.hexaName(name))
+	operator := parser.PR
+	return parser.ValuePathExpression{
+		Attribute:   *attribute,
+		VPathFilter: filter,
+		Operator:    &operator,
+	}, nil
+}
+
 func (mapper *GoogleConditionMapper) mapCallExpr(expression *expr.Expr_Call, isChild bool) (parser.Expression, error) {
 	operand := expression.GetFunction()
 	switch operand {
@@ -263,7 +399,7 @@ func (mapper *GoogleConditionMapper) mapCallExpr(expression *expr.Expr_Call, isC
 	case "@in":
 		return mapper.mapCelAttrCompare(expression.Args, parser.IN)
 
-	case "startsWith", "endsWith", "contains", "has":
+	case "startsWith", "endsWith", "contains", "matches", "has":
 		return mapper.mapCelAttrFunction(expression)
 
 	}
@@ -272,31 +408,23 @@ func (mapper *GoogleConditionMapper) mapCallExpr(expression *expr.Expr_Call, isC
 }
 
 func (mapper *GoogleConditionMapper) mapCelAttrFunction(expression *expr.Expr_Call) (parser.Expression, error) {
-	target := expression.GetTarget()
-	selection := target.GetSelectExpr()
-	operand := selection.GetOperand()
-	// subattr := selection.Field
-	name := operand.GetIdentExpr().GetName()
-	var path string
-	if name == "" {
-		name = target.GetIdentExpr().GetName()
-		path = mapper.NameMapper.GetHexaFilterAttributePath(name)
-
-	} else {
-		subattr := selection.GetField()
-		path = mapper.NameMapper.GetHexaFilterAttributePath(name + "." + subattr)
+	name, ok := celPath(expression.GetTarget())
+	if !ok || len(expression.GetArgs()) != 1 {
+		return nil, fmt.Errorf("unimplemented CEL function: %s", expression.GetFunction())
 	}
+	path := mapper.hexaName(name)
 
 	lhv, err := types.ParseValue(path)
 	if err != nil {
 		return nil, err
 	}
 
-	rh := strconv.Quote(expression.GetArgs()[0].GetConstExpr().GetStringValue())
-	rhv, err := types.ParseValue(rh)
-	if err != nil {
-		return nil, err
+	constExpr := expression.GetArgs()[0].GetConstExpr()
+	if constExpr == nil {
+		return nil, fmt.Errorf("unimplemented CEL function: %s with argument %s", expression.GetFunction(), expression.GetArgs()[0].String())
 	}
+	arg := constExpr.GetStringValue()
+	rhv := types.NewString(arg)
 	switch expression.GetFunction() {
 	case "startsWith":
 		return parser.AttributeExpression{
@@ -316,11 +444,76 @@ func (mapper *GoogleConditionMapper) mapCelAttrFunction(expression *expr.Expr_Ca
 			Operator:      parser.CO,
 			CompareValue:  rhv,
 		}, nil
+	case "matches":
+		return mapCelMatches(lhv, arg)
 	}
 	return nil, errors.New(fmt.Sprintf("unimplemented CEL function:%s", expression.GetFunction()))
 
 }
 
+/*
+mapCelMatches maps a CEL matches() function to an IDQL comparison. Because IDQL has no regular expression operator,
+only patterns that test for a literal value can be mapped: "^abc" (sw), "abc$" (ew), "^abc$" (eq) and "abc" (co).
+*/
+func mapCelMatches(lhv types.Value, pattern string) (parser.Expression, error) {
+	body := pattern
+	anchorStart := strings.HasPrefix(body, "^")
+	body = strings.TrimPrefix(body, "^")
+	if strings.HasPrefix(body, ".*") {
+		anchorStart = false
+		body = body[2:]
+	}
+	anchorEnd := strings.HasSuffix(body, "$") && !strings.HasSuffix(body, "\\$")
+	if anchorEnd {
+		body = body[:len(body)-1]
+	}
+	if strings.HasSuffix(body, ".*") && !strings.HasSuffix(body, "\\.*") {
+		anchorEnd = false
+		body = body[:len(body)-2]
+	}
+
+	literal, ok := unquoteMeta(body)
+	if !ok {
+		return nil, fmt.Errorf("CEL matches(%s) has no IDQL equivalent", strconv.Quote(pattern))
+	}
+	operator := parser.CO
+	switch {
+	case anchorStart && anchorEnd:
+		operator = parser.EQ
+	case anchorStart:
+		operator = parser.SW
+	case anchorEnd:
+		operator = parser.EW
+	}
+	return parser.AttributeExpression{
+		AttributePath: lhv,
+		Operator:      operator,
+		CompareValue:  types.NewString(literal),
+	}, nil
+}
+
+// unquoteMeta returns the literal value of a regular expression if it contains only literal or escaped characters
+func unquoteMeta(pattern string) (string, bool) {
+	sb := strings.Builder{}
+	escaped := false
+	for _, r := range pattern {
+		if escaped {
+			sb.WriteRune(r)
+			escaped = false
+			continue
+		}
+		if r == '\\' {
+			escaped = true
+			continue
+		}
+		if strings.ContainsRune(`.+*?()|[]{}^$`, r) {
+			return "", false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String(), !escaped
+}
+
 func convertConstExpr(cexpr *expr.Expr_ConstExpr) (types.Value, error) {
 	var rhv types.Value
 	var constExpr string
@@ -354,66 +547,98 @@ func convertConstExpr(cexpr *expr.Expr_ConstExpr) (types.Value, error) {
 	return rhv, nil
 }
 
-func (mapper *GoogleConditionMapper) mapCelAttrCompare(expressions []*expr.Expr, operator parser.CompareOperator) (parser.Expression, error) {
-	// target :=
-
-	path := ""
-	isNot := false
-	callExpr := expressions[0].GetCallExpr()
-	lhExpression := expressions[0]
-	if callExpr != nil {
-		switch callExpr.GetFunction() {
-		case "!_":
-			isNot = true
-			break
-		default:
-			msg := fmt.Sprintf("unimplemented CEL function: %s", callExpr.GetFunction())
-			return nil, errors.New(msg)
-		}
-		lhExpression = callExpr.Args[0]
-	}
-	ident := lhExpression.GetIdentExpr()
-	if ident == nil {
-		selectExpr := lhExpression.GetSelectExpr()
-		path = selectExpr.GetOperand().GetIdentExpr().Name + "." + selectExpr.GetField()
-	} else {
-		path = ident.GetName()
+/*
+mapCelOperand maps a comparison operand to an IDQL value. Operands may be attribute paths, constants, lists of
+constants (e.g. for `in`), or timestamps.
+*/
+func (mapper *GoogleConditionMapper) mapCelOperand(operand *expr.Expr) (types.Value, error) {
+	if path, ok := celPath(operand); ok {
+		return types.ParseValue(mapper.hexaName(path))
 	}
 
-	// map the path name
-	path = mapper.NameMapper.GetHexaFilterAttributePath(path)
-
-	// Map the RH expression
-	kind := expressions[1].GetExprKind()
-	var rhv types.Value
-	var err error
-	switch val := kind.(type) {
+	switch val := operand.GetExprKind().(type) {
 	case *expr.Expr_ConstExpr:
-		rhv, err = convertConstExpr(val)
+		return convertConstExpr(val)
+	case *expr.Expr_ListExpr:
+		elements := val.ListExpr.GetElements()
+		values := make([]types.ComparableValue, len(elements))
+		for i, element := range elements {
+			value, err := mapper.mapCelOperand(element)
+			if err != nil {
+				return nil, err
+			}
+			comparable, ok := value.(types.ComparableValue)
+			if !ok {
+				return nil, fmt.Errorf("CEL list values must be literals, found %s", value.String())
+			}
+			values[i] = comparable
+		}
+		return types.NewArray(values), nil
+	case *expr.Expr_CallExpr:
+		timestamp, err := evalCelTimestamp(val.CallExpr)
 		if err != nil {
 			return nil, err
 		}
+		return types.NewDate(timestamp.Format(time.RFC3339Nano))
+	}
+	return nil, fmt.Errorf("unimplemented CEL expression: %s", operand.String())
+}
 
-	case *expr.Expr_IdentExpr:
-		rhv = types.ParseEntity(val.IdentExpr.Name)
-	case *expr.Expr_CallExpr:
-		callFunc := val.CallExpr.GetFunction()
-		args := val.CallExpr.GetArgs()
-		switch callFunc {
-		case "timestamp":
-			val := args[0].GetConstExpr().GetStringValue()
-			rhv, err = types.NewDate(val)
+/*
+evalCelTimestamp evaluates the timestamp() function and timestamp arithmetic with duration() constants. For example,
+timestamp("2024-01-01T00:00:00Z") + duration("86400s") is mapped to the IDQL date 2024-01-02T00:00:00Z.
+*/
+func evalCelTimestamp(call *expr.Expr_Call) (time.Time, error) {
+	args := call.GetArgs()
+	switch call.GetFunction() {
+	case "timestamp":
+		if len(args) == 1 && args[0].GetConstExpr() != nil {
+			return time.Parse(time.RFC3339Nano, args[0].GetConstExpr().GetStringValue())
+		}
+	case "_+_", "_-_":
+		if len(args) == 2 && args[0].GetCallExpr() != nil {
+			timestamp, err := evalCelTimestamp(args[0].GetCallExpr())
 			if err != nil {
-				return nil, err
+				return time.Time{}, err
+			}
+			duration, err := evalCelDuration(args[1])
+			if err != nil {
+				return time.Time{}, err
+			}
+			if call.GetFunction() == "_-_" {
+				duration = -duration
 			}
-		default:
-			msg := fmt.Sprintf("unsupported function %s in %s", callFunc, expressions[1].String())
-			// fmt.Println("Warning: "+msg)
-			return nil, errors.New(msg)
+			return timestamp.Add(duration), nil
 		}
+	case "duration":
+		return time.Time{}, errors.New("CEL duration values have no IDQL equivalent except when added to a timestamp")
 	}
+	return time.Time{}, fmt.Errorf("unimplemented CEL function: %s", call.GetFunction())
+}
 
-	lhv, err := types.ParseValue(path)
+func evalCelDuration(expression *expr.Expr) (time.Duration, error) {
+	call := expression.GetCallExpr()
+	if call.GetFunction() != "duration" || len(call.GetArgs()) != 1 || call.GetArgs()[0].GetConstExpr() == nil {
+		return 0, fmt.Errorf("unimplemented CEL timestamp arithmetic: %s", expression.String())
+	}
+	return time.ParseDuration(call.GetArgs()[0].GetConstExpr().GetStringValue())
+}
+
+func (mapper *GoogleConditionMapper) mapCelAttrCompare(expressions []*expr.Expr, operator parser.CompareOperator) (parser.Expression, error) {
+	isNot := false
+	lhExpression := expressions[0]
+	callExpr := lhExpression.GetCallExpr()
+	if callExpr != nil && callExpr.GetFunction() == "!_" {
+		isNot = true
+		lhExpression = callExpr.Args[0]
+	}
+
+	lhv, err := mapper.mapCelOperand(lhExpression)
+	if err != nil {
+		return nil, err
+	}
+
+	rhv, err := mapper.mapCelOperand(expressions[1])
 	if err != nil {
 		return nil, err
 	}
@@ -493,9 +718,50 @@ func checkCompatibility(e parser.Expression) error {
 	case parser.PrecedenceExpression:
 		return checkCompatibility(v.Expression)
 	case parser.ValuePathExpression:
-		return errors.New("IDQL ValuePath expression mapping to Google CEL currently not supported")
+		if _, isValuePath := v.VPathFilter.(parser.ValuePathExpression); isValuePath {
+			return errors.New("nested IDQL ValuePath expressions cannot be mapped to Google CEL")
+		}
+		return checkCompatibility(v.VPathFilter)
 	case parser.AttributeExpression:
 		return nil
 	}
 	return nil
 }
+
+// rewritePaths returns a copy of e with the attribute paths of each comparison replaced using mapPath
+func rewritePaths(e parser.Expression, mapPath func(path string) (string, error)) (parser.Expression, error) {
+	switch v := e.(type) {
+	case parser.LogicalExpression:
+		left, err := rewritePaths(v.Left, mapPath)
+		if err != nil {
+			return nil, err
+		}
+		right, err := rewritePaths(v.Right, mapPath)
+		if err != nil {
+			return nil, err
+		}
+		return parser.LogicalExpression{Operator: v.Operator, Left: left, Right: right}, nil
+	case parser.NotExpression:
+		sub, err := rewritePaths(v.Expression, mapPath)
+		if err != nil {
+			return nil, err
+		}
+		return parser.NotExpression{Expression: sub}, nil
+	case parser.PrecedenceExpression:
+		sub, err := rewritePaths(v.Expression, mapPath)
+		if err != nil {
+			return nil, err
+		}
+		return parser.PrecedenceExpression{Expression: sub}, nil
+	case parser.AttributeExpression:
+		if entity, ok := v.AttributePath.(types.Entity); ok {
+			path, err := mapPath(entity.String())
+			if err != nil {
+				return nil, err
+			}
+			v.AttributePath = *types.ParseEntity(path)
+		}
+		return v, nil
+	}
+	return e, nil
+}
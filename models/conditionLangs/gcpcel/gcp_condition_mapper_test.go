@@ -1,7 +1,11 @@
 package gcpcel_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/hexa-org/policy-mapper/models/conditionLangs/gcpcel"
@@ -84,9 +88,16 @@ func TestParseFilter(t *testing.T) {
 			"userType ne \"Employee\" and not (emails co \"example.com\" or emails.value co \"example.org\")",
 			"userType ne \"Employee\" and not(emails co \"example.com\" or emails.value co \"example.org\")",
 		},
-		// "userType eq \"Employee\" and emails[type eq \"work\" and value co \"@example.com\"]",  // ValueFilter not implemented
-		// "emails[type eq \"work\" and value co \"@example.com\"] or ims[type eq \"xmpp\" and value co \"@foo.com\"]",
-
+		{
+			"userType eq \"Employee\" and emails[type eq \"work\" and value co \"@example.com\"] pr",
+			"userType eq \"Employee\" and emails[type eq \"work\" and value co \"@example.com\"] pr",
+		},
+		{
+			"emails[type eq \"work\" and value co \"@example.com\"] pr or ims[type eq \"xmpp\" and value co \"@foo.com\"] pr",
+			"emails[type eq \"work\" and value co \"@example.com\"] pr or ims[type eq \"xmpp\" and value co \"@foo.com\"] pr",
+		},
+		{"username in [\"june\", \"fred\"]", "username in [\"june\", \"fred\"]"},
+		{"req.time lt 2030-01-01T00:00:00Z", "req.time lt 2030-01-01T00:00:00Z"},
 	}
 	for _, example := range examples {
 		t.Run(example[0], func(t *testing.T) {
@@ -130,18 +141,13 @@ func TestNegToProvider(t *testing.T) {
 
 	valuePath = conditions.ConditionInfo{Rule: "emails[type eq \"work\" and value ew \"strata.io\"]"}
 	celString, err = mapper.MapConditionToProvider(valuePath)
-	assert.Errorf(t, err, "IDQL ValuePath expression mapping to Google CEL currently not supported")
-	assert.Equal(t, "", celString, "Empty, value path not supported")
-
-	valuePath = conditions.ConditionInfo{Rule: "level GT 5 and emails[type eq \"work\" and value ew \"strata.io\"] pr"}
-	celString, err = mapper.MapConditionToProvider(valuePath)
-	assert.Errorf(t, err, "IDQL ValuePath expression mapping to Google CEL currently not supported")
-	assert.Equal(t, "", celString, "Empty, value path not supported")
+	assert.Errorf(t, err, "invalid condition: Missing and/or clause")
+	assert.Equal(t, "", celString, "Empty, value path requires a comparison")
 
 	valuePath = conditions.ConditionInfo{Rule: "emails[type eq \"work\" and value ew \"strata.io\"] and level gt 5"}
 	celString, err = mapper.MapConditionToProvider(valuePath)
-	assert.Errorf(t, err, "IDQL ValuePath expression mapping to Google CEL currently not supported")
-	assert.Equal(t, "", celString, "Empty, value path not supported")
+	assert.Error(t, err)
+	assert.Equal(t, "", celString, "Empty, value path requires a comparison")
 
 	badCompare := conditions.ConditionInfo{Rule: "level GT 3 and abc GR 2"}
 	celString, err = mapper.MapConditionToProvider(badCompare)
@@ -179,7 +185,94 @@ func TestNegToIdql(t *testing.T) {
 
 	celString = "emails.exists(emails,type == \"work\" && value.endsWith(\"strata.io\"))"
 	cond, err = mapper.MapProviderToCondition(celString)
-	assert.Contains(t, err.Error(), "unimplemented CEL expression:")
+	assert.ErrorContains(t, err, "must compare attributes of emails")
 	assert.Equal(t, "", cond.Rule, "Empty rule returned")
 
+	for _, celString := range []string{
+		"roles.all(r, r.name == \"admin\")",
+		"roles.exists_one(r, r.name == \"admin\")",
+		"resource.name.matches(\"^projects/.+/buckets/logs$\")",
+		"request.time.getHours(\"Europe/Berlin\") >= 9",
+		"request.time < duration(\"3600s\")",
+		"request.time < timestamp(\"2024-01-01T00:00:00Z\") + 3600",
+		"roles.exists(r, r.startsWith(\"admin\"))",
+	} {
+		cond, err = mapper.MapProviderToCondition(celString)
+		assert.Error(t, err, celString)
+		assert.Equal(t, "", cond.Rule, "Empty rule returned")
+	}
+
+}
+
+func TestValuePathToProvider(t *testing.T) {
+	examples := [][3]string{
+		{
+			"emails[type eq \"work\"] pr",
+			"emails.exists(x, x.type == \"work\")",
+			"emails[type eq \"work\"] pr",
+		},
+		{
+			"emails[type eq \"work\"].value ew \"strata.io\"",
+			"emails.exists(x, x.type == \"work\" && x.value.endsWith(\"strata.io\"))",
+			"emails[type eq \"work\" and value ew \"strata.io\"] pr",
+		},
+		{
+			"emails[type eq \"work\" or type eq \"home\"].value pr",
+			"emails.exists(x, (x.type == \"work\" || x.type == \"home\") && has(x.value))",
+			"emails[(type eq \"work\" or type eq \"home\") and value pr] pr",
+		},
+		{
+			"level gt 5 and emails[type eq \"work\"] pr",
+			"level > 5 && emails.exists(x, x.type == \"work\")",
+			"level gt 5 and emails[type eq \"work\"] pr",
+		},
+	}
+	for _, example := range examples {
+		t.Run(example[0], func(t *testing.T) {
+			celString, err := mapper.MapConditionToProvider(conditions.ConditionInfo{Rule: example[0]})
+			assert.NoError(t, err)
+			assert.Equal(t, example[1], celString)
+
+			condition, err := mapper.MapProviderToCondition(celString)
+			assert.NoError(t, err)
+			assert.Equal(t, example[2], condition.Rule)
+		})
+	}
+}
+
+type iamCondition struct {
+	Name      string `json:"name"`
+	Cel       string `json:"cel"`
+	Idql      string `json:"idql"`
+	MappedCel string `json:"mappedCel,omitempty"`
+}
+
+// TestIamConditionCorpus round-trips Google IAM condition expressions through IDQL
+func TestIamConditionCorpus(t *testing.T) {
+	_, file, _, _ := runtime.Caller(0)
+	corpusBytes, err := os.ReadFile(filepath.Join(file, "../test/iam_conditions.json"))
+	assert.NoError(t, err)
+	var corpus []iamCondition
+	assert.NoError(t, json.Unmarshal(corpusBytes, &corpus))
+
+	iamMapper := gcpcel.GoogleConditionMapper{NameMapper: conditions.NewNameMapper(map[string]string{})}
+	for _, example := range corpus {
+		t.Run(example.Name, func(t *testing.T) {
+			condition, err := iamMapper.MapProviderToCondition(example.Cel)
+			assert.NoError(t, err)
+			assert.Equal(t, example.Idql, condition.Rule)
+
+			celString, err := iamMapper.MapConditionToProvider(condition)
+			assert.NoError(t, err)
+			expected := example.Cel
+			if example.MappedCel != "" {
+				expected = example.MappedCel
+			}
+			assert.Equal(t, expected, celString)
+
+			again, err := iamMapper.MapProviderToCondition(celString)
+			assert.NoError(t, err)
+			assert.Equal(t, example.Idql, again.Rule)
+		})
+	}
 }
@@ -0,0 +1,349 @@
+package awsIam
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/models/conditionLangs/awsIamConditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+)
+
+// Keys of the IDQL policy Meta.SourceData set by the mapper
+const (
+	SourcePolicyArn = "policyArn" // the ARN of the managed policy
+	SourceVersionId = "versionId" // the version of the managed policy document
+)
+
+// DenyAllRule is the IDQL condition rule of an unconditional Deny statement. It holds for every request (an identity
+// policy always has a principal).
+const DenyAllRule = "aws:PrincipalArn pr"
+
+// SubjectTypes are the IAM identities a managed policy can be attached to (e.g. role:app-server)
+var SubjectTypes = []string{"user:", "group:", "role:"}
+
+var (
+	policyNamePattern = regexp.MustCompile(`^[\w+=,.@-]{1,128}$`)
+	sidPattern        = regexp.MustCompile(`^[A-Za-z0-9]*$`)
+	nonSidCharacters  = regexp.MustCompile(`[^A-Za-z0-9]`)
+)
+
+/*
+ManagedPolicy is a customer managed IAM policy and the identities (users, groups and roles) it is attached to. Arn and
+VersionId are empty for a policy that has not been created.
+*/
+type ManagedPolicy struct {
+	Name      string
+	Arn       string
+	VersionId string
+	Subjects  []string
+	Document  PolicyDocument
+}
+
+/*
+AwsIamMapper maps the statements of IAM managed policies to IDQL policies. Each statement resource is an IDQL policy
+whose id is <policy name>/<statement sid> (with #<n> appended when the statement has more than one resource), whose
+subjects are the identities the managed policy is attached to, and whose actions are the IAM actions of the statement.
+A Deny statement is a policy with a deny condition: the statement condition or, when it has none, DenyAllRule.
+*/
+type AwsIamMapper struct {
+	conditionMapper *awsIamConditions.IamConditionMapper
+}
+
+func New(nameMap map[string]string) *AwsIamMapper {
+	return &AwsIamMapper{conditionMapper: awsIamConditions.NewIamConditionMapper(nameMap)}
+}
+
+func (m *AwsIamMapper) Name() string {
+	return "awsIam"
+}
+
+// MapManagedPolicyToPolicies maps each statement resource of the managed policy document to an IDQL policy
+func (m *AwsIamMapper) MapManagedPolicyToPolicies(managed ManagedPolicy) ([]hexapolicy.PolicyInfo, error) {
+	var policies []hexapolicy.PolicyInfo
+	for i, statement := range managed.Document.Statement {
+		sid := statement.Sid
+		if sid == "" {
+			sid = fmt.Sprintf("Stmt%d", i+1)
+		}
+		if len(statement.NotAction) > 0 || len(statement.NotResource) > 0 {
+			return nil, fmt.Errorf("policy %s statement %s: NotAction and NotResource are not supported", managed.Name, sid)
+		}
+		if statement.Effect != EffectAllow && statement.Effect != EffectDeny {
+			return nil, fmt.Errorf("policy %s statement %s: invalid effect '%s'", managed.Name, sid, statement.Effect)
+		}
+		if len(statement.Resource) == 0 {
+			return nil, fmt.Errorf("policy %s statement %s: no Resource", managed.Name, sid)
+		}
+
+		condition, err := m.conditionMapper.MapIamToCondition(toIamCondition(statement.Condition))
+		if err != nil {
+			return nil, fmt.Errorf("policy %s statement %s: %w", managed.Name, sid, err)
+		}
+		if statement.Effect == EffectDeny {
+			if condition == nil {
+				condition = &conditions.ConditionInfo{Rule: DenyAllRule}
+			}
+			condition.Action = conditions.ADeny
+		}
+		actions := make([]hexapolicy.ActionInfo, len(statement.Action))
+		for j, action := range statement.Action {
+			actions[j] = hexapolicy.ActionInfo(action)
+		}
+
+		for j, resource := range statement.Resource {
+			policyId := managed.Name + "/" + sid
+			if len(statement.Resource) > 1 {
+				policyId = fmt.Sprintf("%s#%d", policyId, j+1)
+			}
+			var sourceData map[string]interface{}
+			if managed.Arn != "" {
+				sourceData = map[string]interface{}{SourcePolicyArn: managed.Arn}
+				if managed.VersionId != "" {
+					sourceData[SourceVersionId] = managed.VersionId
+				}
+			}
+			policy := hexapolicy.PolicyInfo{
+				Meta: hexapolicy.MetaInfo{
+					Version:    hexapolicy.IdqlVersion,
+					PolicyId:   &policyId,
+					SourceData: sourceData,
+				},
+				Subjects: append([]string{}, managed.Subjects...),
+				Actions:  append([]hexapolicy.ActionInfo{}, actions...),
+				Object:   hexapolicy.ObjectInfo(resource),
+			}
+			if condition != nil {
+				cond := *condition
+				policy.Condition = &cond
+			}
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
+
+/*
+MapPoliciesToManagedPolicies groups policies into managed policy documents. The managed policy and statement of a policy
+are taken from its id (<policy name>/<statement sid>). A policy without an id, or whose id is not of that form, is
+added to the managed policy defaultName. Policies with the same statement sid are merged into one statement with
+several resources, and all the policies of a managed policy must have the same subjects.
+*/
+func (m *AwsIamMapper) MapPoliciesToManagedPolicies(policies []hexapolicy.PolicyInfo, defaultName string) ([]*ManagedPolicy, error) {
+	return m.mapPolicies(policies, defaultName, nil)
+}
+
+/*
+MapPoliciesToManagedPoliciesReport maps policies as for MapPoliciesToManagedPolicies and returns a MappingReport. Policies
+that cannot be mapped are reported as dropped instead of returning an error.
+*/
+func (m *AwsIamMapper) MapPoliciesToManagedPoliciesReport(policies []hexapolicy.PolicyInfo, defaultName string) ([]*ManagedPolicy, *hexapolicy.MappingReport) {
+	report := hexapolicy.NewMappingReport(m.Name())
+	managed, _ := m.mapPolicies(policies, defaultName, report)
+	return managed, report
+}
+
+type statementRef struct {
+	managed *ManagedPolicy
+	index   int
+}
+
+func (m *AwsIamMapper) mapPolicies(policies []hexapolicy.PolicyInfo, defaultName string, report *hexapolicy.MappingReport) ([]*ManagedPolicy, error) {
+	var res []*ManagedPolicy
+	managedPolicies := make(map[string]*ManagedPolicy)
+	statements := make(map[string]statementRef)
+	var unnamed []statementRef
+
+	for i, policy := range policies {
+		name, sid, err := policyStatementId(policy, defaultName)
+		if err == nil {
+			err = checkSubjects(policy.Subjects)
+		}
+		var statement Statement
+		if err == nil {
+			statement, err = m.mapStatement(policy, sid)
+		}
+		if err == nil {
+			managed, exists := managedPolicies[name]
+			if exists && !sameSubjects(managed.Subjects, policy.Subjects) {
+				err = fmt.Errorf("the policies of managed policy %s must have the same subjects (found %v and %v)", name, managed.Subjects, policy.Subjects)
+			}
+			if ref, ok := statements[name+"/"+sid]; err == nil && ok && sid != "" {
+				err = mergeStatement(&ref.managed.Document.Statement[ref.index], statement)
+			} else if err == nil {
+				if !exists {
+					managed = &ManagedPolicy{
+						Name:     name,
+						Subjects: sortedSubjects(policy.Subjects),
+						Document: PolicyDocument{Version: PolicyLanguageVersion},
+					}
+					managedPolicies[name] = managed
+					res = append(res, managed)
+				}
+				managed.Document.Statement = append(managed.Document.Statement, statement)
+				ref := statementRef{managed: managed, index: len(managed.Document.Statement) - 1}
+				if sid == "" {
+					unnamed = append(unnamed, ref)
+				} else {
+					statements[name+"/"+sid] = ref
+				}
+			}
+		}
+
+		if err != nil {
+			if report == nil {
+				return nil, fmt.Errorf("policy %d: %w", i, err)
+			}
+			report.Dropped(i, policy, hexapolicy.MapElementPolicy, err.Error())
+			continue
+		}
+		report.ExactPolicy(i, policy)
+		if statement.Effect == EffectDeny {
+			report.Approximated(i, policy, hexapolicy.CompareDifCondition, "the deny condition is mapped to an IAM Deny statement, which overrides Allow statements and grants nothing when the rule is not met")
+		}
+	}
+
+	// statements without a sid are numbered once the sids in use are known
+	for _, ref := range unnamed {
+		for n := 1; ; n++ {
+			sid := fmt.Sprintf("Hexa%d", n)
+			if _, used := statements[ref.managed.Name+"/"+sid]; !used {
+				ref.managed.Document.Statement[ref.index].Sid = sid
+				statements[ref.managed.Name+"/"+sid] = ref
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func (m *AwsIamMapper) mapStatement(policy hexapolicy.PolicyInfo, sid string) (Statement, error) {
+	if len(policy.Actions) == 0 {
+		return Statement{}, errors.New("policy has no actions")
+	}
+	if policy.Object == "" {
+		return Statement{}, errors.New("policy has no object (use * for all resources)")
+	}
+	if policy.Scope != nil {
+		return Statement{}, errors.New("policy scopes are not supported by IAM policies")
+	}
+
+	effect := EffectAllow
+	condition := policy.Condition
+	if condition != nil && strings.EqualFold(condition.Action, conditions.ADeny) {
+		// A Deny statement applies when its condition is met
+		effect = EffectDeny
+		condition = &conditions.ConditionInfo{Rule: condition.Rule, Action: conditions.AAllow}
+		if strings.TrimSpace(condition.Rule) == DenyAllRule {
+			condition = nil
+		}
+	}
+	iamCondition, err := m.conditionMapper.MapConditionToIam(condition)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	actions := make(StringList, len(policy.Actions))
+	for i, action := range policy.Actions {
+		actions[i] = action.String()
+	}
+	return Statement{
+		Sid:       sid,
+		Effect:    effect,
+		Action:    actions,
+		Resource:  StringList{policy.Object.String()},
+		Condition: fromIamCondition(iamCondition),
+	}, nil
+}
+
+// mergeStatement adds the resource of statement to existing, which must otherwise be the same
+func mergeStatement(existing *Statement, statement Statement) error {
+	if existing.Effect != statement.Effect || !slices.Equal(existing.Action, statement.Action) || !reflect.DeepEqual(existing.Condition, statement.Condition) {
+		return fmt.Errorf("statement %s has policies with different effects, actions or conditions", existing.Sid)
+	}
+	for _, resource := range statement.Resource {
+		if !slices.Contains(existing.Resource, resource) {
+			existing.Resource = append(existing.Resource, resource)
+		}
+	}
+	return nil
+}
+
+// policyStatementId returns the managed policy name and statement sid of a policy (see MapPoliciesToManagedPolicies)
+func policyStatementId(policy hexapolicy.PolicyInfo, defaultName string) (string, string, error) {
+	if policy.Meta.PolicyId == nil || *policy.Meta.PolicyId == "" {
+		return defaultName, "", nil
+	}
+	name, sid, found := strings.Cut(*policy.Meta.PolicyId, "/")
+	if !found {
+		return defaultName, nonSidCharacters.ReplaceAllString(*policy.Meta.PolicyId, ""), nil
+	}
+	sid, _, _ = strings.Cut(sid, "#")
+	if !policyNamePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid managed policy name '%s'", name)
+	}
+	if !sidPattern.MatchString(sid) {
+		return "", "", fmt.Errorf("invalid statement sid '%s' (only letters and digits are allowed)", sid)
+	}
+	return name, sid, nil
+}
+
+// checkSubjects returns an error if a subject is not an IAM identity (see SubjectTypes)
+func checkSubjects(subjects []string) error {
+	for _, subject := range subjects {
+		if !IsIamSubject(subject) {
+			return fmt.Errorf("subject %s is not an IAM user, group or role (user:<name>, group:<name> or role:<name>)", subject)
+		}
+	}
+	return nil
+}
+
+// IsIamSubject returns true if subject names an IAM identity (see SubjectTypes)
+func IsIamSubject(subject string) bool {
+	return slices.ContainsFunc(SubjectTypes, func(subjectType string) bool {
+		return strings.HasPrefix(subject, subjectType) && len(subject) > len(subjectType)
+	})
+}
+
+func sortedSubjects(subjects []string) []string {
+	res := append([]string{}, subjects...)
+	sort.Strings(res)
+	return res
+}
+
+func sameSubjects(subjects []string, other []string) bool {
+	return slices.Equal(sortedSubjects(subjects), sortedSubjects(other))
+}
+
+func toIamCondition(condition map[string]map[string]StringList) awsIamConditions.Condition {
+	if len(condition) == 0 {
+		return nil
+	}
+	res := make(awsIamConditions.Condition, len(condition))
+	for operator, keys := range condition {
+		res[operator] = make(map[string][]string, len(keys))
+		for key, values := range keys {
+			res[operator][key] = values
+		}
+	}
+	return res
+}
+
+func fromIamCondition(condition awsIamConditions.Condition) map[string]map[string]StringList {
+	if len(condition) == 0 {
+		return nil
+	}
+	res := make(map[string]map[string]StringList, len(condition))
+	for operator, keys := range condition {
+		res[operator] = make(map[string]StringList, len(keys))
+		for key, values := range keys {
+			res[operator][key] = values
+		}
+	}
+	return res
+}
@@ -0,0 +1,218 @@
+package awsIam_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/models/formats/awsIam"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/stretchr/testify/assert"
+)
+
+var mapper = awsIam.New(map[string]string{})
+
+func readDocument(t *testing.T) awsIam.PolicyDocument {
+	_, file, _, _ := runtime.Caller(0)
+	docBytes, err := os.ReadFile(filepath.Join(filepath.Dir(file), "test", "bucket_policy.json"))
+	assert.NoError(t, err)
+	doc, err := awsIam.ParsePolicyDocument(string(docBytes))
+	assert.NoError(t, err)
+	return *doc
+}
+
+func TestParsePolicyDocument(t *testing.T) {
+	doc := readDocument(t)
+	assert.Len(t, doc.Statement, 2)
+	assert.Equal(t, awsIam.StringList{"true"}, doc.Statement[0].Condition["Bool"]["aws:SecureTransport"])
+	assert.Equal(t, awsIam.StringList{"s3:DeleteObject"}, doc.Statement[1].Action)
+
+	single, err := awsIam.ParsePolicyDocument(`{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Action": "s3:*", "Resource": "*"}}`)
+	assert.NoError(t, err)
+	assert.Len(t, single.Statement, 1)
+	assert.Equal(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:*","Resource":"*"}]}`, single.String())
+
+	_, err = awsIam.ParsePolicyDocument(`{"Version": "2012-10-17", "Statement": []}`)
+	assert.ErrorContains(t, err, "no statements")
+	_, err = awsIam.ParsePolicyDocument(`{"Statement": {"Effect": "Allow", "Action": {"s3": "x"}}}`)
+	assert.Error(t, err)
+}
+
+func TestMapManagedPolicyToPolicies(t *testing.T) {
+	managed := awsIam.ManagedPolicy{
+		Name:      "ReportReaders",
+		Arn:       "arn:aws:iam::123456789012:policy/ReportReaders",
+		VersionId: "v2",
+		Subjects:  []string{"role:analyst", "user:alice"},
+		Document:  readDocument(t),
+	}
+	policies, err := mapper.MapManagedPolicyToPolicies(managed)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 3)
+
+	assert.Equal(t, "ReportReaders/ReadReports#1", *policies[0].Meta.PolicyId)
+	assert.Equal(t, "ReportReaders/ReadReports#2", *policies[1].Meta.PolicyId)
+	assert.Equal(t, "ReportReaders/DenyDelete", *policies[2].Meta.PolicyId)
+
+	assert.Equal(t, hexapolicy.SubjectInfo{"role:analyst", "user:alice"}, policies[0].Subjects)
+	assert.Equal(t, []hexapolicy.ActionInfo{"s3:GetObject", "s3:ListBucket"}, policies[0].Actions)
+	assert.Equal(t, hexapolicy.ObjectInfo("arn:aws:s3:::reports/*"), policies[1].Object)
+	assert.Equal(t, `aws:SecureTransport eq true and (aws:RequestedRegion eq "us-west-2" or aws:RequestedRegion eq "us-east-1")`, policies[0].Condition.Rule)
+	assert.Equal(t, conditions.AAllow, policies[0].Condition.Action)
+	assert.Equal(t, managed.Arn, policies[0].Meta.SourceData[awsIam.SourcePolicyArn])
+	assert.Equal(t, "v2", policies[0].Meta.SourceData[awsIam.SourceVersionId])
+
+	// a Deny statement without a condition denies every request
+	assert.Equal(t, &conditions.ConditionInfo{Rule: awsIam.DenyAllRule, Action: conditions.ADeny}, policies[2].Condition)
+
+	// and back again
+	mapped, err := mapper.MapPoliciesToManagedPolicies(policies, "unused")
+	assert.NoError(t, err)
+	assert.Len(t, mapped, 1)
+	assert.Equal(t, "ReportReaders", mapped[0].Name)
+	assert.Equal(t, []string{"role:analyst", "user:alice"}, mapped[0].Subjects)
+	assert.True(t, managed.Document.Equals(mapped[0].Document), mapped[0].Document.String())
+}
+
+func TestMapManagedPolicyToPolicies_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		err      string
+	}{
+		{"NotAction", `{"Statement": {"Effect": "Allow", "NotAction": "s3:*", "Resource": "*"}}`, "NotAction"},
+		{"Effect", `{"Statement": {"Effect": "Permit", "Action": "s3:*", "Resource": "*"}}`, "invalid effect"},
+		{"No resource", `{"Statement": {"Effect": "Allow", "Action": "s3:*"}}`, "no Resource"},
+		{"Condition", `{"Statement": {"Effect": "Allow", "Action": "s3:*", "Resource": "*", "Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}}}`, "IpAddress is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := awsIam.ParsePolicyDocument(tt.document)
+			assert.NoError(t, err)
+			_, err = mapper.MapManagedPolicyToPolicies(awsIam.ManagedPolicy{Name: "p", Document: *doc})
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func policy(id string, subjects []string, object string, actions ...hexapolicy.ActionInfo) hexapolicy.PolicyInfo {
+	p := hexapolicy.PolicyInfo{
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: subjects,
+		Actions:  actions,
+		Object:   hexapolicy.ObjectInfo(object),
+	}
+	if id != "" {
+		p.Meta.PolicyId = &id
+	}
+	return p
+}
+
+func TestMapPoliciesToManagedPolicies(t *testing.T) {
+	subjects := []string{"role:app"}
+	denyUnencrypted := policy("Uploads/DenyUnencrypted", subjects, "arn:aws:s3:::uploads/*", "s3:PutObject")
+	denyUnencrypted.Condition = &conditions.ConditionInfo{Rule: `not(s3:x-amz-server-side-encryption pr)`, Action: conditions.ADeny}
+
+	mapped, err := mapper.MapPoliciesToManagedPolicies([]hexapolicy.PolicyInfo{
+		policy("", subjects, "arn:aws:sqs:us-west-2:123456789012:orders", "sqs:SendMessage"),
+		policy("Uploads/Write", subjects, "arn:aws:s3:::uploads/*", "s3:PutObject"),
+		policy("3f2c-uuid", subjects, "*", "s3:ListAllMyBuckets"),
+		denyUnencrypted,
+		policy("", subjects, "arn:aws:sqs:us-west-2:123456789012:returns", "sqs:SendMessage"),
+		policy("Hexa1", subjects, "arn:aws:sns:us-west-2:123456789012:alerts", "sns:Publish"),
+	}, "hexa-app")
+	assert.NoError(t, err)
+	assert.Len(t, mapped, 2)
+
+	defaultPolicy := mapped[0]
+	assert.Equal(t, "hexa-app", defaultPolicy.Name)
+	var sids []string
+	for _, statement := range defaultPolicy.Document.Statement {
+		sids = append(sids, statement.Sid)
+	}
+	// statements without a sid are numbered, skipping sids in use
+	assert.Equal(t, []string{"Hexa2", "3f2cuuid", "Hexa3", "Hexa1"}, sids)
+
+	uploads := mapped[1]
+	assert.Equal(t, "Uploads", uploads.Name)
+	assert.Equal(t, awsIam.PolicyLanguageVersion, uploads.Document.Version)
+	assert.Len(t, uploads.Document.Statement, 2)
+	deny := uploads.Document.Statement[1]
+	assert.Equal(t, awsIam.EffectDeny, deny.Effect)
+	// the deny condition is the condition of the Deny statement
+	assert.Equal(t, map[string]map[string]awsIam.StringList{"Null": {"s3:x-amz-server-side-encryption": {"true"}}}, deny.Condition)
+}
+
+func TestMapPoliciesToManagedPolicies_Merge(t *testing.T) {
+	subjects := []string{"group:readers", "role:app"}
+	mapped, err := mapper.MapPoliciesToManagedPolicies([]hexapolicy.PolicyInfo{
+		policy("Reports/Read#1", subjects, "arn:aws:s3:::reports", "s3:GetObject"),
+		policy("Reports/Read#2", []string{"role:app", "group:readers"}, "arn:aws:s3:::reports/*", "s3:GetObject"),
+	}, "hexa")
+	assert.NoError(t, err)
+	assert.Len(t, mapped[0].Document.Statement, 1)
+	assert.Equal(t, awsIam.StringList{"arn:aws:s3:::reports", "arn:aws:s3:::reports/*"}, mapped[0].Document.Statement[0].Resource)
+
+	_, err = mapper.MapPoliciesToManagedPolicies([]hexapolicy.PolicyInfo{
+		policy("Reports/Read#1", subjects, "arn:aws:s3:::reports", "s3:GetObject"),
+		policy("Reports/Read#2", subjects, "arn:aws:s3:::reports/*", "s3:PutObject"),
+	}, "hexa")
+	assert.ErrorContains(t, err, "different effects, actions or conditions")
+
+	_, err = mapper.MapPoliciesToManagedPolicies([]hexapolicy.PolicyInfo{
+		policy("Reports/Read", subjects, "arn:aws:s3:::reports", "s3:GetObject"),
+		policy("Reports/Write", []string{"role:app"}, "arn:aws:s3:::reports", "s3:PutObject"),
+	}, "hexa")
+	assert.ErrorContains(t, err, "must have the same subjects")
+}
+
+func TestMapPoliciesToManagedPoliciesReport(t *testing.T) {
+	deny := policy("Reports/Deny", []string{"role:app"}, "*", "s3:DeleteBucket")
+	deny.Condition = &conditions.ConditionInfo{Rule: awsIam.DenyAllRule, Action: conditions.ADeny}
+	orCondition := policy("Reports/Cond", []string{"role:app"}, "*", "s3:GetObject")
+	orCondition.Condition = &conditions.ConditionInfo{Rule: `aws:RequestedRegion eq "us-west-2" or s3:prefix eq "home"`, Action: conditions.AAllow}
+
+	mapped, report := mapper.MapPoliciesToManagedPoliciesReport([]hexapolicy.PolicyInfo{
+		policy("Reports/Read", []string{"role:app"}, "arn:aws:s3:::reports/*", "s3:GetObject"),
+		policy("Reports/Any", []string{"any"}, "*", "s3:ListAllMyBuckets"),
+		policy("Bad Name/Read", []string{"role:app"}, "*", "s3:GetObject"),
+		policy("Reports/NoActions", []string{"role:app"}, "*"),
+		orCondition,
+		deny,
+	}, "hexa")
+	assert.Len(t, mapped, 1)
+	assert.Len(t, mapped[0].Document.Statement, 2)
+	assert.Equal(t, "awsIam", report.Target)
+	assert.True(t, report.IsLossy())
+
+	issues := report.Issues()
+	assert.Len(t, issues, 5)
+	assert.Contains(t, issues[0], "not an IAM user, group or role")
+	assert.Contains(t, issues[1], "invalid managed policy name")
+	assert.Contains(t, issues[2], "no actions")
+	assert.Contains(t, issues[3], "only support alternatives")
+	assert.Contains(t, issues[4], "IAM Deny statement")
+	assert.Empty(t, mapped[0].Document.Statement[1].Condition, "DenyAllRule is not written as an IAM condition")
+}
+
+func TestMapManagedPolicyToPolicies_ConditionalDeny(t *testing.T) {
+	doc, err := awsIam.ParsePolicyDocument(`{"Version": "2012-10-17", "Statement": {"Sid": "DenyHttp", "Effect": "Deny", "Action": "s3:*", "Resource": "*",
+		"Condition": {"Bool": {"aws:SecureTransport": "false"}}}}`)
+	assert.NoError(t, err)
+	managed := awsIam.ManagedPolicy{Name: "Secure", Subjects: []string{"role:app"}, Document: *doc}
+	policies, err := mapper.MapManagedPolicyToPolicies(managed)
+	assert.NoError(t, err)
+	assert.Equal(t, conditions.ADeny, policies[0].Condition.Action)
+	assert.Equal(t, "aws:SecureTransport eq false", policies[0].Condition.Rule)
+
+	// The effect is part of the condition, so an Allow/Deny change is a difference
+	allow := policies[0]
+	allow.Condition = &conditions.ConditionInfo{Rule: policies[0].Condition.Rule, Action: conditions.AAllow}
+	assert.NotContains(t, allow.Compare(policies[0]), hexapolicy.CompareEqual)
+
+	mapped, err := mapper.MapPoliciesToManagedPolicies(policies, "unused")
+	assert.NoError(t, err)
+	assert.True(t, managed.Document.Equals(mapped[0].Document), mapped[0].Document.String())
+}
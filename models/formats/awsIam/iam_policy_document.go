@@ -0,0 +1,122 @@
+package awsIam
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// PolicyLanguageVersion is the IAM policy language version of the documents produced by the mapper
+const PolicyLanguageVersion = "2012-10-17"
+
+const (
+	EffectAllow = "Allow"
+	EffectDeny  = "Deny"
+)
+
+/*
+PolicyDocument is an AWS IAM identity-based policy document. See
+https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_policies_grammar.html
+*/
+type PolicyDocument struct {
+	Version   string     `json:"Version"`
+	Id        string     `json:"Id,omitempty"`
+	Statement Statements `json:"Statement"`
+}
+
+type Statement struct {
+	Sid         string                           `json:"Sid,omitempty"`
+	Effect      string                           `json:"Effect"`
+	Action      StringList                       `json:"Action,omitempty"`
+	NotAction   StringList                       `json:"NotAction,omitempty"`
+	Resource    StringList                       `json:"Resource,omitempty"`
+	NotResource StringList                       `json:"NotResource,omitempty"`
+	Condition   map[string]map[string]StringList `json:"Condition,omitempty"`
+}
+
+// Statements is the Statement element of a document, which may be a single statement or an array
+type Statements []Statement
+
+func (s *Statements) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		var statements []Statement
+		if err := json.Unmarshal(b, &statements); err != nil {
+			return err
+		}
+		*s = statements
+		return nil
+	}
+	var statement Statement
+	if err := json.Unmarshal(b, &statement); err != nil {
+		return err
+	}
+	*s = Statements{statement}
+	return nil
+}
+
+// StringList is a policy element that may be a single value or an array. Numbers and booleans are kept as strings.
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(b []byte) error {
+	var values []interface{}
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		if err := json.Unmarshal(b, &values); err != nil {
+			return err
+		}
+	} else {
+		var value interface{}
+		if err := json.Unmarshal(b, &value); err != nil {
+			return err
+		}
+		values = []interface{}{value}
+	}
+
+	res := make(StringList, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case string:
+			res[i] = v
+		case bool:
+			res[i] = strconv.FormatBool(v)
+		case float64:
+			res[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return fmt.Errorf("invalid IAM policy value: %v", value)
+		}
+	}
+	*l = res
+	return nil
+}
+
+func (l StringList) MarshalJSON() ([]byte, error) {
+	if len(l) == 1 {
+		return json.Marshal(l[0])
+	}
+	return json.Marshal([]string(l))
+}
+
+// ParsePolicyDocument parses the JSON of an IAM policy document
+func ParsePolicyDocument(document string) (*PolicyDocument, error) {
+	var doc PolicyDocument
+	if err := json.Unmarshal([]byte(document), &doc); err != nil {
+		return nil, fmt.Errorf("invalid IAM policy document: %w", err)
+	}
+	if len(doc.Statement) == 0 {
+		return nil, errors.New("invalid IAM policy document: no statements")
+	}
+	return &doc, nil
+}
+
+// String returns the JSON of the document
+func (d PolicyDocument) String() string {
+	docBytes, _ := json.Marshal(d)
+	return string(docBytes)
+}
+
+// Equals returns true if the documents have the same statements
+func (d PolicyDocument) Equals(other PolicyDocument) bool {
+	return d.Version == other.Version && d.Id == other.Id && reflect.DeepEqual(d.Statement, other.Statement)
+}
@@ -0,0 +1,425 @@
+/*
+Package casbin maps IDQL policies to and from the Casbin (https://casbin.org) `model.conf` and `policy.csv` formats.
+
+IDQL policies are mapped to `p` rules of the form `p, sub, dom, obj, act, cond, eft` (see DefaultModel). Conditions
+are converted into govaluate expressions which are evaluated by the model matcher using `eval(p.cond)`. Casbin role
+assignments (`g` rules) are carried in policy meta source data so that they survive a round trip.
+*/
+package casbin
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/models/conditionLangs/casbinConditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+)
+
+const (
+	SourceDomain = "casbinDomain" // SourceDomain is the MetaInfo.SourceData key holding the Casbin domain (tenant)
+	SourceEffect = "casbinEffect" // SourceEffect is the MetaInfo.SourceData key holding a Casbin effect other than allow
+	SourceRoles  = "casbinRoles"  // SourceRoles is the MetaInfo.SourceData key holding role (g) rules used by the policy
+
+	Wildcard    = "*"
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+var (
+	evalRegex      = regexp.MustCompile(`eval\(\s*p\.(\w+)\s*\)`)
+	roleFuncRegex  = regexp.MustCompile(`\bg\d*\(`)
+	policyRefRegex = regexp.MustCompile(`\bp\.`)
+)
+
+type CasbinMapper struct {
+	condMap *casbinConditions.CasbinConditionMapper
+}
+
+func NewCasbinMapper(attrNameMap map[string]string) *CasbinMapper {
+	return &CasbinMapper{condMap: casbinConditions.NewCasbinConditionMapper(attrNameMap)}
+}
+
+func (c *CasbinMapper) Name() string {
+	return "casbin"
+}
+
+// MapHexaPolicies converts IDQL policies into a Casbin PolicySet using DefaultModel. Each combination of subject and
+// action becomes a `p` rule.
+func (c *CasbinMapper) MapHexaPolicies(policies []hexapolicy.PolicyInfo) (*PolicySet, error) {
+	return c.mapHexaPolicies(policies, nil)
+}
+
+// MapHexaPoliciesReport converts IDQL policies like MapHexaPolicies, but policies whose condition cannot be mapped are
+// skipped and recorded in the returned MappingReport.
+func (c *CasbinMapper) MapHexaPoliciesReport(policies []hexapolicy.PolicyInfo) (*PolicySet, *hexapolicy.MappingReport) {
+	report := hexapolicy.NewMappingReport(c.Name())
+	set, _ := c.mapHexaPolicies(policies, report)
+	return set, report
+}
+
+func (c *CasbinMapper) mapHexaPolicies(policies []hexapolicy.PolicyInfo, report *hexapolicy.MappingReport) (*PolicySet, error) {
+	set := PolicySet{Model: NewDefaultModel()}
+	roleRules := map[string]bool{}
+	var roles []Rule
+
+	for index, policy := range policies {
+		cond, err := c.condMap.MapConditionToCasbin(policy.Condition)
+		if err != nil {
+			if report == nil {
+				return nil, fmt.Errorf("policy %s: %w", policyName(policy), err)
+			}
+			report.Dropped(index, policy, hexapolicy.MapElementPolicy, err.Error())
+			continue
+		}
+		report.ExactPolicy(index, policy)
+		if cond == "" {
+			cond = "true"
+		}
+
+		dom := sourceString(policy.Meta, SourceDomain, Wildcard)
+		eft := sourceString(policy.Meta, SourceEffect, EffectAllow)
+		obj := policy.Object.String()
+		if obj == "" {
+			obj = Wildcard
+		}
+
+		subjects := []string{Wildcard}
+		if len(policy.Subjects) > 0 {
+			subjects = make([]string, len(policy.Subjects))
+			for i, subject := range policy.Subjects {
+				if strings.EqualFold(subject, hexapolicy.SubjectAnyUser) {
+					subject = Wildcard
+				}
+				if strings.EqualFold(subject, hexapolicy.SubjectAnyAuth) {
+					report.Approximated(index, policy, hexapolicy.CompareDifSubject, "anyAuthenticated is kept as a literal Casbin subject")
+				}
+				subjects[i] = subject
+			}
+		}
+		actions := []string{Wildcard}
+		if len(policy.Actions) > 0 {
+			actions = make([]string, len(policy.Actions))
+			for i, action := range policy.Actions {
+				actions[i] = action.String()
+			}
+		}
+
+		for _, sub := range subjects {
+			for _, act := range actions {
+				set.Rules = append(set.Rules, Rule{PType: "p", Values: []string{sub, dom, obj, act, cond, eft}})
+			}
+		}
+
+		for _, role := range sourceRoles(policy.Meta) {
+			key := role.String()
+			if !roleRules[key] {
+				roleRules[key] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+	set.Rules = append(set.Rules, roles...)
+	return &set, nil
+}
+
+// MapCasbinFiles reads a Casbin model and policy file and maps them to IDQL. If modelPath is empty, DefaultModel is used.
+func (c *CasbinMapper) MapCasbinFiles(modelPath, policyPath string) ([]hexapolicy.PolicyInfo, error) {
+	model := NewDefaultModel()
+	if modelPath != "" {
+		modelBytes, err := os.ReadFile(modelPath)
+		if err != nil {
+			return nil, err
+		}
+		model, err = ParseModel(modelBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	policyBytes, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	return c.MapCasbinPolicyBytes(model, policyBytes)
+}
+
+// MapCasbinPolicyBytes parses policy.csv data and maps it to IDQL using the field definitions in model
+func (c *CasbinMapper) MapCasbinPolicyBytes(model *Model, policyBytes []byte) ([]hexapolicy.PolicyInfo, error) {
+	rules, err := ParsePolicyCsv(policyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return c.MapCasbinPolicies(&PolicySet{Model: model, Rules: rules})
+}
+
+type policyGroup struct {
+	dom, obj, cond, eft string
+	subjects            []string
+	actions             []string
+}
+
+// MapCasbinPolicies converts a Casbin PolicySet into IDQL policies. `p` rules sharing the same domain, object,
+// condition and effect are combined into a single IDQL policy where possible. Matcher clauses that only test request
+// attributes (e.g. r.sub.Age > 18) are mapped to an IDQL condition added to every policy.
+func (c *CasbinMapper) MapCasbinPolicies(set *PolicySet) ([]hexapolicy.PolicyInfo, error) {
+	model := set.Model
+	if model == nil {
+		model = NewDefaultModel()
+	}
+	fields := model.Fields(SectionPolicy, "p")
+	index := func(names ...string) int {
+		for i, field := range fields {
+			for _, name := range names {
+				if field == name {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	subIdx := index("sub")
+	domIdx := index("dom", "domain", "tenant")
+	objIdx := index("obj")
+	actIdx := index("act")
+	eftIdx := index("eft")
+	condIdx := -1
+	matcher := model.Get(SectionMatcher, "m")
+	if match := evalRegex.FindStringSubmatch(matcher); match != nil {
+		condIdx = index(match[1])
+	}
+
+	matcherCondition, err := c.mapMatcherCondition(matcher)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func(rule Rule, i int, defValue string) string {
+		if i < 0 || i >= len(rule.Values) || rule.Values[i] == "" {
+			return defValue
+		}
+		return rule.Values[i]
+	}
+
+	// group rules by domain, object, condition, effect and subject to rebuild the action lists
+	var groups []*policyGroup
+	groupIndex := map[string]*policyGroup{}
+	var roles []Rule
+	for _, rule := range set.Rules {
+		if strings.HasPrefix(rule.PType, "g") {
+			roles = append(roles, rule)
+			continue
+		}
+		if rule.PType != "p" {
+			continue // additional policy types (p2..) are not supported by the IDQL mapping
+		}
+		sub := value(rule, subIdx, Wildcard)
+		dom := value(rule, domIdx, Wildcard)
+		obj := value(rule, objIdx, Wildcard)
+		act := value(rule, actIdx, Wildcard)
+		cond := value(rule, condIdx, "true")
+		eft := value(rule, eftIdx, EffectAllow)
+
+		key := strings.Join([]string{dom, obj, cond, eft, sub}, "\x00")
+		group, ok := groupIndex[key]
+		if !ok {
+			group = &policyGroup{dom: dom, obj: obj, cond: cond, eft: eft, subjects: []string{sub}}
+			groupIndex[key] = group
+			groups = append(groups, group)
+		}
+		group.actions = append(group.actions, act)
+	}
+
+	// merge groups that differ only in subject
+	var merged []*policyGroup
+	mergeIndex := map[string]*policyGroup{}
+	for _, group := range groups {
+		sort.Strings(group.actions)
+		key := strings.Join([]string{group.dom, group.obj, group.cond, group.eft, strings.Join(group.actions, "\x01")}, "\x00")
+		if existing, ok := mergeIndex[key]; ok {
+			existing.subjects = append(existing.subjects, group.subjects...)
+			continue
+		}
+		mergeIndex[key] = group
+		merged = append(merged, group)
+	}
+
+	policies := make([]hexapolicy.PolicyInfo, 0, len(merged))
+	for _, group := range merged {
+		policy, err := c.mapGroup(group, matcherCondition, roles)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func (c *CasbinMapper) mapGroup(group *policyGroup, matcherCondition *conditions.ConditionInfo, roles []Rule) (hexapolicy.PolicyInfo, error) {
+	policy := hexapolicy.PolicyInfo{Meta: hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion}}
+	sourceData := map[string]interface{}{}
+
+	subjects := make(hexapolicy.SubjectInfo, len(group.subjects))
+	for i, sub := range group.subjects {
+		if sub == Wildcard {
+			sub = hexapolicy.SubjectAnyUser
+		}
+		subjects[i] = sub
+	}
+	policy.Subjects = subjects
+
+	for _, act := range group.actions {
+		if act == Wildcard {
+			continue
+		}
+		policy.Actions = append(policy.Actions, hexapolicy.ActionInfo(act))
+	}
+	if group.obj != Wildcard {
+		policy.Object = hexapolicy.ObjectInfo(group.obj)
+	}
+
+	if group.dom != Wildcard {
+		sourceData[SourceDomain] = group.dom
+	}
+	if group.eft != EffectAllow {
+		sourceData[SourceEffect] = group.eft
+	}
+
+	var policyRoles [][]string
+	for _, role := range roles {
+		if len(role.Values) < 2 {
+			continue
+		}
+		roleName := role.Values[1]
+		for _, sub := range group.subjects {
+			if sub == roleName && (len(role.Values) < 3 || group.dom == Wildcard || role.Values[2] == group.dom) {
+				policyRoles = append(policyRoles, append([]string{role.PType}, role.Values...))
+				break
+			}
+		}
+	}
+	if len(policyRoles) > 0 {
+		sourceData[SourceRoles] = policyRoles
+	}
+	if len(sourceData) > 0 {
+		policy.Meta.SourceData = sourceData
+	}
+
+	cond, err := c.condMap.MapCasbinToCondition(group.cond)
+	if err != nil {
+		return policy, err
+	}
+	if matcherCondition != nil {
+		if cond == nil {
+			cond = matcherCondition
+		} else {
+			cond = &conditions.ConditionInfo{
+				Rule:   fmt.Sprintf("(%s) and (%s)", matcherCondition.Rule, cond.Rule),
+				Action: conditions.AAllow,
+			}
+		}
+	}
+	policy.Condition = cond
+	return policy, nil
+}
+
+// mapMatcherCondition converts top level `&&` clauses of a matcher that only reference request attributes into an
+// IDQL condition. Clauses referencing policy fields (p.*), role functions (g()) or eval() define the model structure
+// and are not mapped.
+func (c *CasbinMapper) mapMatcherCondition(matcher string) (*conditions.ConditionInfo, error) {
+	var requestClauses []string
+	for _, clause := range splitTopLevel(matcher, "&&") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" || policyRefRegex.MatchString(clause) || strings.Contains(clause, "eval(") || roleFuncRegex.MatchString(clause) {
+			continue
+		}
+		requestClauses = append(requestClauses, clause)
+	}
+	if len(requestClauses) == 0 {
+		return nil, nil
+	}
+	return c.condMap.MapCasbinToCondition(strings.Join(requestClauses, " && "))
+}
+
+// splitTopLevel splits an expression on a separator that is not within quotes or parentheses
+func splitTopLevel(expression, sep string) []string {
+	var parts []string
+	depth := 0
+	var quote rune
+	start := 0
+	runes := []rune(expression)
+	sepRunes := []rune(sep)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == '\\' {
+				i++
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case depth == 0 && i+len(sepRunes) <= len(runes) && string(runes[i:i+len(sepRunes)]) == sep:
+			parts = append(parts, string(runes[start:i]))
+			start = i + len(sepRunes)
+			i += len(sepRunes) - 1
+		}
+	}
+	return append(parts, string(runes[start:]))
+}
+
+func policyName(policy hexapolicy.PolicyInfo) string {
+	if policy.Meta.PolicyId != nil {
+		return *policy.Meta.PolicyId
+	}
+	return policy.CalculateEtag()
+}
+
+func sourceString(meta hexapolicy.MetaInfo, key, defValue string) string {
+	if meta.SourceData == nil {
+		return defValue
+	}
+	if val, ok := meta.SourceData[key].(string); ok && val != "" {
+		return val
+	}
+	return defValue
+}
+
+// sourceRoles returns role rules saved in SourceData. Values may be [][]string or, after JSON parsing, []interface{}
+func sourceRoles(meta hexapolicy.MetaInfo) []Rule {
+	if meta.SourceData == nil {
+		return nil
+	}
+	var lines [][]string
+	switch val := meta.SourceData[SourceRoles].(type) {
+	case [][]string:
+		lines = val
+	case []interface{}:
+		for _, item := range val {
+			items, ok := item.([]interface{})
+			if !ok {
+				continue
+			}
+			line := make([]string, len(items))
+			for i, v := range items {
+				line[i] = fmt.Sprint(v)
+			}
+			lines = append(lines, line)
+		}
+	}
+	var rules []Rule
+	for _, line := range lines {
+		if len(line) < 3 {
+			continue
+		}
+		rules = append(rules, Rule{PType: line[0], Values: line[1:]})
+	}
+	return rules
+}
@@ -0,0 +1,216 @@
+package casbin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	SectionRequest = "request_definition"
+	SectionPolicy  = "policy_definition"
+	SectionRole    = "role_definition"
+	SectionEffect  = "policy_effect"
+	SectionMatcher = "matchers"
+)
+
+var sectionOrder = []string{SectionRequest, SectionPolicy, SectionRole, SectionEffect, SectionMatcher}
+
+// DefaultModel is the Casbin model generated for IDQL policies. It supports RBAC with domains (g = _, _, _), wildcard
+// subjects, domains, objects and actions, and ABAC conditions evaluated from the `cond` policy field.
+const DefaultModel = `[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act, cond, eft
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = (p.sub == "*" || g(r.sub, p.sub, r.dom)) && (p.dom == "*" || r.dom == p.dom) && (p.obj == "*" || keyMatch(r.obj, p.obj)) && (p.act == "*" || r.act == p.act) && eval(p.cond)
+`
+
+// Model holds the sections of a Casbin model.conf file. Each section is a map of key (e.g. `r`, `p`, `g`, `m`) to value.
+type Model struct {
+	Sections map[string]map[string]string
+}
+
+// ParseModel parses the INI style Casbin model.conf format
+func ParseModel(modelBytes []byte) (*Model, error) {
+	model := Model{Sections: map[string]map[string]string{}}
+	scanner := bufio.NewScanner(bytes.NewReader(modelBytes))
+	section := ""
+	lineNum := 0
+	pending := ""
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if pending != "" {
+			line = pending + " " + line
+			pending = ""
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			pending = strings.TrimSpace(strings.TrimSuffix(line, "\\"))
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := model.Sections[section]; !ok {
+				model.Sections[section] = map[string]string{}
+			}
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || section == "" {
+			return nil, fmt.Errorf("casbin model: invalid line %d: %s", lineNum, line)
+		}
+		model.Sections[section][strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := model.Sections[SectionPolicy]["p"]; !ok {
+		return nil, errors.New("casbin model: missing policy_definition 'p'")
+	}
+	return &model, nil
+}
+
+// NewDefaultModel returns the parsed DefaultModel
+func NewDefaultModel() *Model {
+	model, _ := ParseModel([]byte(DefaultModel))
+	return model
+}
+
+// Get returns the value of a key within a section or empty string if not defined
+func (m *Model) Get(section, key string) string {
+	if sec, ok := m.Sections[section]; ok {
+		return sec[key]
+	}
+	return ""
+}
+
+// Fields returns the token names of a definition (e.g. [sub obj act] for `p = sub, obj, act`)
+func (m *Model) Fields(section, key string) []string {
+	value := m.Get(section, key)
+	if value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return parts
+}
+
+func (m *Model) String() string {
+	sb := strings.Builder{}
+	written := map[string]bool{}
+	writeSection := func(name string) {
+		values, ok := m.Sections[name]
+		if !ok {
+			return
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf("[%s]\n", name))
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sb.WriteString(fmt.Sprintf("%s = %s\n", k, values[k]))
+		}
+		written[name] = true
+	}
+	for _, name := range sectionOrder {
+		writeSection(name)
+	}
+	var others []string
+	for name := range m.Sections {
+		if !written[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		writeSection(name)
+	}
+	return sb.String()
+}
+
+// Rule is a single line of a Casbin policy.csv file (e.g. `p, alice, data1, read`)
+type Rule struct {
+	PType  string
+	Values []string
+}
+
+func (r Rule) String() string {
+	fields := make([]string, len(r.Values)+1)
+	fields[0] = r.PType
+	for i, value := range r.Values {
+		if strings.ContainsAny(value, ",\"\n") || strings.TrimSpace(value) != value {
+			value = "\"" + strings.ReplaceAll(value, "\"", "\"\"") + "\""
+		}
+		fields[i+1] = value
+	}
+	return strings.Join(fields, ", ")
+}
+
+// ParsePolicyCsv parses a Casbin policy.csv file into rules. Blank lines and lines starting with # are ignored.
+func ParsePolicyCsv(policyBytes []byte) ([]Rule, error) {
+	reader := csv.NewReader(bytes.NewReader(policyBytes))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rules []Rule
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("casbin policy: %w", err)
+		}
+		if len(record) < 2 {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("casbin policy: line %d has no values", line)
+		}
+		values := make([]string, len(record)-1)
+		for i, value := range record[1:] {
+			values[i] = strings.TrimSpace(value)
+		}
+		rules = append(rules, Rule{PType: strings.TrimSpace(record[0]), Values: values})
+	}
+	return rules, nil
+}
+
+// PolicySet is a Casbin model and its associated policy rules
+type PolicySet struct {
+	Model *Model
+	Rules []Rule
+}
+
+// PolicyString returns the rules in policy.csv form
+func (p *PolicySet) PolicyString() string {
+	sb := strings.Builder{}
+	for _, rule := range p.Rules {
+		sb.WriteString(rule.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
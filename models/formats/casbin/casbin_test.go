@@ -0,0 +1,186 @@
+package casbin_test
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/models/formats/casbin"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicysupport"
+	"github.com/stretchr/testify/assert"
+)
+
+var mapper = casbin.NewCasbinMapper(map[string]string{})
+
+func getTestFile(name string) string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(file, "../test", name)
+}
+
+func TestParseModel(t *testing.T) {
+	model := casbin.NewDefaultModel()
+	assert.NotNil(t, model)
+	assert.Equal(t, []string{"sub", "dom", "obj", "act", "cond", "eft"}, model.Fields(casbin.SectionPolicy, "p"))
+	assert.Equal(t, "_, _, _", model.Get(casbin.SectionRole, "g"))
+
+	reparsed, err := casbin.ParseModel([]byte(model.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, model.Sections, reparsed.Sections)
+
+	_, err = casbin.ParseModel([]byte("[request_definition]\nr = sub, obj, act\n"))
+	assert.Error(t, err, "missing policy definition")
+
+	_, err = casbin.ParseModel([]byte("r = sub, obj, act\n"))
+	assert.Error(t, err, "key outside a section")
+
+	continued, err := casbin.ParseModel([]byte("[policy_definition]\np = sub, \\\n  obj, act\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sub", "obj", "act"}, continued.Fields(casbin.SectionPolicy, "p"))
+}
+
+func TestMapIdqlToCasbin(t *testing.T) {
+	policies, err := hexapolicysupport.ParsePolicyFile(getTestFile("idql.json"))
+	assert.NoError(t, err)
+
+	set, err := mapper.MapHexaPolicies(policies)
+	assert.NoError(t, err)
+	assert.Contains(t, set.Model.String(), "eval(p.cond)")
+
+	csv := set.PolicyString()
+	assert.Contains(t, csv, `p, role:sales, *, /reports/*, read, "regexMatch(req.ip, '^192\\.168\\.') && r.sub.department == 'Sales'", allow`)
+	assert.Contains(t, csv, "p, *, *, /public/*, list, true, allow")
+	assert.Contains(t, csv, `p, role:admin, *, *, delete, "r.sub.level >= 3 || (r.sub.department in ('IT', 'Security'))", allow`)
+
+	rules, err := casbin.ParsePolicyCsv([]byte(csv))
+	assert.NoError(t, err)
+	assert.Len(t, rules, len(set.Rules))
+	assert.Equal(t, set.Rules, rules)
+
+	back, err := mapper.MapCasbinPolicies(&casbin.PolicySet{Model: set.Model, Rules: rules})
+	assert.NoError(t, err)
+	assert.Len(t, back, len(policies))
+	for i, policy := range policies {
+		assert.True(t, policy.Equals(back[i]), "policy %d should round trip", i)
+	}
+}
+
+func TestMapRbacWithDomains(t *testing.T) {
+	policies, err := mapper.MapCasbinFiles(getTestFile("rbac_with_domains_model.conf"), getTestFile("rbac_with_domains_policy.csv"))
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	first := policies[0]
+	assert.Equal(t, hexapolicy.SubjectInfo{"admin"}, first.Subjects)
+	assert.Equal(t, []hexapolicy.ActionInfo{"read", "write"}, first.Actions)
+	assert.Equal(t, "data1", first.Object.String())
+	assert.Equal(t, "domain1", first.Meta.SourceData[casbin.SourceDomain])
+	assert.Equal(t, [][]string{{"g", "alice", "admin", "domain1"}}, first.Meta.SourceData[casbin.SourceRoles])
+	assert.Nil(t, first.Condition)
+
+	// Check the role assignments and domains survive a round trip through JSON
+	policyBytes, err := hexapolicysupport.ToBytes(policies)
+	assert.NoError(t, err)
+	parsed, err := hexapolicysupport.ParsePolicies(policyBytes)
+	assert.NoError(t, err)
+
+	set, err := mapper.MapHexaPolicies(parsed)
+	assert.NoError(t, err)
+	csv := set.PolicyString()
+	assert.Contains(t, csv, "p, admin, domain2, data2, write, true, allow")
+	assert.Contains(t, csv, "g, alice, admin, domain1")
+	assert.Contains(t, csv, "g, bob, admin, domain2")
+	assert.Equal(t, 1, strings.Count(csv, "g, bob, admin, domain2"))
+}
+
+func TestMapAbac(t *testing.T) {
+	policies, err := mapper.MapCasbinFiles(getTestFile("abac_model.conf"), getTestFile("abac_policy.csv"))
+	assert.NoError(t, err)
+	assert.Len(t, policies, 3)
+
+	assert.Equal(t, hexapolicy.SubjectInfo{hexapolicy.SubjectAnyUser}, policies[0].Subjects)
+	assert.Equal(t, "/data1", policies[0].Object.String())
+	assert.True(t, policies[0].Condition.Equals(&conditions.ConditionInfo{
+		Rule:   "(subject.Age lt 65) and (subject.Age gt 18)",
+		Action: conditions.AAllow,
+	}), policies[0].Condition.Rule)
+	assert.Equal(t, `(subject.Age lt 65) and (subject.Age lt 60 and subject.Department eq "Sales")`, policies[1].Condition.Rule)
+	assert.Equal(t, `(subject.Age lt 65) and (subject.Department in ["Sales", "Marketing"])`, policies[2].Condition.Rule)
+
+	set, err := mapper.MapHexaPolicies(policies)
+	assert.NoError(t, err)
+	assert.Contains(t, set.PolicyString(), `p, *, *, /data2, read, "(r.sub.Age < 65) && (r.sub.Department in ('Sales', 'Marketing'))", allow`)
+}
+
+func TestMapMatcherRequestClauses(t *testing.T) {
+	model, err := casbin.ParseModel([]byte(`[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub.Name == p.sub && r.obj == p.obj && r.act == p.act && r.sub.Group == "Sales"
+`))
+	assert.NoError(t, err)
+
+	// r.sub.Group contains "p." but is a request attribute, so the clause is mapped
+	policies, err := mapper.MapCasbinPolicyBytes(model, []byte("p, alice, data1, read\n"))
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+	assert.NotNil(t, policies[0].Condition)
+	assert.Equal(t, `subject.Group eq "Sales"`, policies[0].Condition.Rule)
+}
+
+func TestMapDenyEffect(t *testing.T) {
+	csv := "p, bob, *, data1, write, r.sub.level < 3, deny\n"
+	policies, err := mapper.MapCasbinPolicyBytes(casbin.NewDefaultModel(), []byte(csv))
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+	assert.Equal(t, casbin.EffectDeny, policies[0].Meta.SourceData[casbin.SourceEffect])
+
+	set, err := mapper.MapHexaPolicies(policies)
+	assert.NoError(t, err)
+	assert.Equal(t, csv, set.PolicyString())
+}
+
+func TestMapErrors(t *testing.T) {
+	_, err := mapper.MapCasbinPolicyBytes(casbin.NewDefaultModel(), []byte("p, bob, *, data1, write, ipMatch(r.sub.ip, '10.0.0.0/8'), allow\n"))
+	assert.Error(t, err)
+
+	_, err = mapper.MapCasbinPolicyBytes(casbin.NewDefaultModel(), []byte("p\n"))
+	assert.Error(t, err)
+
+	_, err = mapper.MapHexaPolicies([]hexapolicy.PolicyInfo{{
+		Subjects:  hexapolicy.SubjectInfo{"alice"},
+		Condition: &conditions.ConditionInfo{Rule: `emails[type eq "work"].value ew "hexa.org"`},
+	}})
+	assert.Error(t, err)
+
+	_, err = mapper.MapCasbinFiles("", getTestFile("missing.csv"))
+	assert.Error(t, err)
+}
+
+func TestMapHexaPoliciesReport(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{
+		{Subjects: hexapolicy.SubjectInfo{"alice"}, Actions: []hexapolicy.ActionInfo{"read"}, Object: "data1"},
+		{
+			Subjects:  hexapolicy.SubjectInfo{"bob"},
+			Condition: &conditions.ConditionInfo{Rule: `emails[type eq "work"].value ew "hexa.org"`},
+		},
+		{Subjects: hexapolicy.SubjectInfo{hexapolicy.SubjectAnyAuth}, Actions: []hexapolicy.ActionInfo{"read"}},
+	}
+
+	set, report := mapper.MapHexaPoliciesReport(policies)
+	assert.Equal(t, "p, alice, *, data1, read, true, allow\np, anyAuthenticated, *, *, read, true, allow\n", set.PolicyString())
+	assert.Equal(t, "casbin", report.Target)
+	issues := report.Issues()
+	assert.Len(t, issues, 2)
+	assert.True(t, strings.HasPrefix(issues[0], "policy 1: POLICY DROPPED"))
+	assert.Equal(t, "policy 2: SUBJECT APPROXIMATED - anyAuthenticated is kept as a literal Casbin subject", issues[1])
+}
@@ -0,0 +1,122 @@
+package cedar
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicysupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCedarAnnotations(t *testing.T) {
+	mapper := NewCedarMapper(map[string]string{})
+	policies, err := mapper.MapCedarPolicyBytes("test", []byte(`@id("policy1")
+@description("Alice may view photos")
+@owner("photo-team")
+permit (
+  principal == User::"alice",
+  action == Action::"view",
+  resource
+);`))
+	assert.NoError(t, err)
+	policy := policies.Policies[0]
+	assert.Equal(t, "policy1", *policy.Meta.PolicyId)
+	assert.Equal(t, "Alice may view photos", policy.Meta.Description)
+	assert.Equal(t, map[string]string{
+		"id":          "policy1",
+		"description": "Alice may view photos",
+		"owner":       "photo-team",
+	}, GetAnnotations(policy.Meta))
+
+	// Annotations survive an IDQL JSON round trip
+	idqlBytes, err := hexapolicysupport.ToBytes([]hexapolicy.PolicyInfo{policy})
+	assert.NoError(t, err)
+	idqlPolicies, err := hexapolicysupport.ParsePolicies(idqlBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, GetAnnotations(policy.Meta), GetAnnotations(idqlPolicies[0].Meta))
+
+	// Edits to the IDQL policy id and description are reflected in the annotations
+	edited := idqlPolicies[0]
+	newId := "policy2"
+	edited.Meta.PolicyId = &newId
+	edited.Meta.Description = "Updated"
+	cedarText, err := mapper.MapHexaPolicies("test", []hexapolicy.PolicyInfo{edited})
+	assert.NoError(t, err)
+	assert.Contains(t, cedarText, "@description(\"Updated\")\n@id(\"policy2\")\n@owner(\"photo-team\")\npermit")
+
+	// Policy ids and descriptions are not added as annotations when not already present
+	plain := hexapolicy.PolicyInfo{
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion, PolicyId: &newId, Description: "No annotations"},
+		Subjects: hexapolicy.SubjectInfo{"any"},
+	}
+	cedarText, err = mapper.MapHexaPolicies("test", []hexapolicy.PolicyInfo{plain})
+	assert.NoError(t, err)
+	assert.NotContains(t, cedarText, "@")
+}
+
+// TestCedarRoundTripConformance maps the example Cedar policies to IDQL and back, checking that annotations are
+// preserved and that mapping is stable.
+func TestCedarRoundTripConformance(t *testing.T) {
+	_, file, _, _ := runtime.Caller(0)
+	examples := filepath.Join(file, "../../../../examples")
+	var files []string
+	for _, dir := range []string{"policyExamples", "policyInfoModels"} {
+		matches, err := filepath.Glob(filepath.Join(examples, dir, "cedar*.txt"))
+		assert.NoError(t, err)
+		files = append(files, matches...)
+	}
+	assert.NotEmpty(t, files)
+
+	mapper := NewCedarMapper(map[string]string{})
+	for _, name := range files {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			cedarBytes, err := os.ReadFile(name)
+			assert.NoError(t, err)
+
+			idql, err := mapper.MapCedarPolicyBytes("test", cedarBytes)
+			assert.NoError(t, err)
+			cedarText, err := mapper.MapHexaPolicies("test", idql.Policies)
+			assert.NoError(t, err)
+
+			var original, roundTrip cedar.PolicyList
+			assert.NoError(t, original.UnmarshalCedar(cedarBytes))
+			assert.NoError(t, roundTrip.UnmarshalCedar([]byte(cedarText)))
+			assert.Len(t, roundTrip, len(original))
+			for i := range original {
+				assert.Equal(t, original[i].Annotations(), roundTrip[i].Annotations(), "policy %d annotations", i)
+			}
+
+			// Mapping the result again must give the same IDQL and Cedar
+			idql2, err := mapper.MapCedarPolicyBytes("test", []byte(cedarText))
+			assert.NoError(t, err)
+			for i, policy := range idql2.Policies {
+				assert.True(t, policy.Equals(idql.Policies[i]), "policy %d should match", i)
+				assert.Equal(t, idql.Policies[i].Meta.PolicyId, policy.Meta.PolicyId)
+				assert.Equal(t, idql.Policies[i].Meta.Description, policy.Meta.Description)
+				assert.Equal(t, GetAnnotations(idql.Policies[i].Meta), GetAnnotations(policy.Meta))
+			}
+			cedarText2, err := mapper.MapHexaPolicies("test", idql2.Policies)
+			assert.NoError(t, err)
+			assert.Equal(t, cedarText, cedarText2)
+		})
+	}
+
+	// Annotated policies are reproduced exactly
+	cedarBytes, err := os.ReadFile(filepath.Join(examples, "policyExamples", "cedarAnnotated.txt"))
+	assert.NoError(t, err)
+	idql, err := mapper.MapCedarPolicyBytes("test", cedarBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, "staceyAccount", *idql.Policies[1].Meta.PolicyId)
+	cedarText, err := mapper.MapHexaPolicies("test", idql.Policies)
+	assert.NoError(t, err)
+	var original, roundTrip cedar.PolicyList
+	assert.NoError(t, original.UnmarshalCedar(cedarBytes))
+	assert.NoError(t, roundTrip.UnmarshalCedar([]byte(cedarText)))
+	for i := range original {
+		assert.Equal(t, string(original[i].MarshalCedar()), string(roundTrip[i].MarshalCedar()))
+	}
+}
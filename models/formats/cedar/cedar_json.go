@@ -0,0 +1,189 @@
+package cedar
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+)
+
+/*
+cedar_json.go supports the Cedar JSON policy format (see https://docs.cedarpolicy.com/policies/json-format.html). A
+document may contain a single policy (e.g. `{"effect": "permit", "principal": {...}, ...}`) or a policy set of the form
+`{"staticPolicies": {"policy0": {...}}}`.
+*/
+
+// MapCedarJsonPolicyBytes maps a Cedar JSON policy or policy set into IDQL. For policy sets, the Cedar policy id is
+// returned as the IDQL policy id and policies are returned in policy id order.
+func (c *CedarMapper) MapCedarJsonPolicyBytes(location string, jsonBytes []byte) (*hexapolicy.Policies, error) {
+	return c.mapCedarJson(location, jsonBytes, nil)
+}
+
+/*
+MapCedarJsonPolicyBytesReport maps a Cedar JSON policy or policy set to IDQL like MapCedarJsonPolicyBytes, but continues
+past policies that cannot be mapped. The returned MappingReport (whose indexes are the position of each Cedar policy in
+policy id order) records dropped policies and policies whose meaning changed. An error is returned only when the
+document cannot be parsed.
+*/
+func (c *CedarMapper) MapCedarJsonPolicyBytesReport(location string, jsonBytes []byte) (*hexapolicy.Policies, *hexapolicy.MappingReport, error) {
+	report := hexapolicy.NewMappingReport("idql")
+	policies, err := c.mapCedarJson(location, jsonBytes, report)
+	if err != nil {
+		return nil, nil, err
+	}
+	return policies, report, nil
+}
+
+// mapCedarJson maps a Cedar JSON document. When report is nil, the first policy that cannot be mapped is an error.
+func (c *CedarMapper) mapCedarJson(location string, jsonBytes []byte, report *hexapolicy.MappingReport) (*hexapolicy.Policies, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(jsonBytes, &doc); err != nil {
+		return nil, fmt.Errorf("invalid Cedar JSON policy: %w", err)
+	}
+
+	cset := ParseSet{
+		Pairs:           make([]PolicyPair, 0),
+		IdqlPolicies:    make([]hexapolicy.PolicyInfo, 0),
+		Pos:             0,
+		loc:             location,
+		conditionMapper: c.condMap,
+		report:          report,
+	}
+
+	switch {
+	case doc["staticPolicies"] != nil:
+		var policySet cedar.PolicySet
+		if err := policySet.UnmarshalJSON(jsonBytes); err != nil {
+			return nil, fmt.Errorf("invalid Cedar JSON policy set: %w", err)
+		}
+		policyMap := policySet.Map()
+		ids := make([]string, 0, len(policyMap))
+		for id := range policyMap {
+			ids = append(ids, string(id))
+		}
+		sort.Strings(ids)
+		for i, id := range ids {
+			policyId := id
+			cset.Pos = i
+			if err := cset.MapCedarPolicy(policyMap[cedar.PolicyID(id)]); err != nil {
+				if report == nil {
+					return nil, fmt.Errorf("policy %s: %w", id, err)
+				}
+				report.Dropped(i, hexapolicy.PolicyInfo{Meta: hexapolicy.MetaInfo{PolicyId: &policyId}}, hexapolicy.MapElementPolicy, err.Error())
+				continue
+			}
+			cset.IdqlPolicies[len(cset.IdqlPolicies)-1].Meta.PolicyId = &policyId
+		}
+	case doc["effect"] != nil:
+		var policy cedar.Policy
+		if err := policy.UnmarshalJSON(jsonBytes); err != nil {
+			return nil, fmt.Errorf("invalid Cedar JSON policy: %w", err)
+		}
+		if err := cset.MapCedarPolicy(&policy); err != nil {
+			if report == nil {
+				return nil, err
+			}
+			report.Dropped(0, hexapolicy.PolicyInfo{}, hexapolicy.MapElementPolicy, err.Error())
+		}
+	default:
+		return nil, errors.New("invalid Cedar JSON policy: expecting a policy or a policy set with staticPolicies")
+	}
+
+	return &hexapolicy.Policies{
+		Policies: cset.IdqlPolicies,
+		App:      &location,
+	}, nil
+}
+
+// MapHexaPoliciesToJson maps IDQL policies to a Cedar JSON policy set. Policy ids are taken from the IDQL policy id when
+// present. Policy templates are not supported and return an error. Because a Cedar policy has a single principal, an IDQL policy with multiple subjects is mapped to multiple Cedar
+// policies whose ids are suffixed with the subject index (e.g. `policy1_0`, `policy1_1`).
+func (c *CedarMapper) MapHexaPoliciesToJson(location string, policies []hexapolicy.PolicyInfo) ([]byte, error) {
+	return c.mapHexaPoliciesToJson(location, policies, nil)
+}
+
+/*
+MapHexaPoliciesToJsonReport maps IDQL policies to a Cedar JSON policy set like MapHexaPoliciesToJson, but continues past
+policies that cannot be mapped (including policy templates). The mapping of each policy is recorded in the returned
+MappingReport.
+*/
+func (c *CedarMapper) MapHexaPoliciesToJsonReport(location string, policies []hexapolicy.PolicyInfo) ([]byte, *hexapolicy.MappingReport, error) {
+	report := hexapolicy.NewMappingReport("cedar")
+	jsonBytes, err := c.mapHexaPoliciesToJson(location, policies, report)
+	return jsonBytes, report, err
+}
+
+// mapHexaPoliciesToJson maps policies to a Cedar JSON policy set. When report is nil, the first policy that cannot be
+// mapped is an error.
+func (c *CedarMapper) mapHexaPoliciesToJson(location string, policies []hexapolicy.PolicyInfo, report *hexapolicy.MappingReport) ([]byte, error) {
+	pset := ParseSet{
+		Pairs:           make([]PolicyPair, 0),
+		IdqlPolicies:    make([]hexapolicy.PolicyInfo, 0),
+		Pos:             0,
+		loc:             location,
+		conditionMapper: c.condMap,
+		report:          report,
+	}
+
+	policySet := cedar.NewPolicySet()
+	for i, hexaPolicy := range policies {
+		pset.Pos = i
+		cedarPolicies, err := pset.mapHexaPolicyToJson(location, i, hexaPolicy, policySet)
+		if err != nil {
+			if report == nil {
+				return nil, err
+			}
+			report.Dropped(i, hexaPolicy, hexapolicy.MapElementPolicy, err.Error())
+			continue
+		}
+		for policyId, cedarPolicy := range cedarPolicies {
+			policySet.Add(policyId, cedarPolicy)
+		}
+	}
+
+	jsonBytes, err := policySet.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err = json.Indent(&out, jsonBytes, "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// mapHexaPolicyToJson maps the policy at index i to the Cedar policies to be added to policySet, keyed by policy id
+func (t *ParseSet) mapHexaPolicyToJson(location string, i int, hexaPolicy hexapolicy.PolicyInfo, policySet *cedar.PolicySet) (map[cedar.PolicyID]*cedar.Policy, error) {
+	if IsTemplate(hexaPolicy) {
+		return nil, fmt.Errorf("policy %d: policy templates are not supported in Cedar JSON", i)
+	}
+	cedarText, err := t.MapHexaPolicy(hexaPolicy)
+	if err != nil {
+		return nil, err
+	}
+	cedarPolicies, err := cedar.NewPolicyListFromBytes(location, []byte(cedarText))
+	if err != nil {
+		return nil, fmt.Errorf("policy %d: %w", i, err)
+	}
+
+	id := fmt.Sprintf("policy%d", i)
+	if hexaPolicy.Meta.PolicyId != nil && *hexaPolicy.Meta.PolicyId != "" {
+		id = *hexaPolicy.Meta.PolicyId
+	}
+	mapped := make(map[cedar.PolicyID]*cedar.Policy, len(cedarPolicies))
+	for j, cedarPolicy := range cedarPolicies {
+		policyId := id
+		if len(cedarPolicies) > 1 {
+			policyId = fmt.Sprintf("%s_%d", id, j)
+		}
+		if policySet.Get(cedar.PolicyID(policyId)) != nil {
+			return nil, fmt.Errorf("duplicate policy id: %s", policyId)
+		}
+		mapped[cedar.PolicyID(policyId)] = cedarPolicy
+	}
+	return mapped, nil
+}
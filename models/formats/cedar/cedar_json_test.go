@@ -0,0 +1,154 @@
+package cedar
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicysupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func readCedarTestFile(t *testing.T, name string) []byte {
+	_, file, _, _ := runtime.Caller(0)
+	fileBytes, err := os.ReadFile(filepath.Join(file, "../test", name))
+	assert.NoError(t, err)
+	return fileBytes
+}
+
+func TestMapCedarJsonPolicySet(t *testing.T) {
+	mapper := NewCedarMapper(map[string]string{})
+
+	policies, err := mapper.MapCedarJsonPolicyBytes("test", readCedarTestFile(t, "cedarPhotoPolicySet.json"))
+	assert.NoError(t, err)
+	assert.Len(t, policies.Policies, 2)
+
+	alice := policies.Policies[0]
+	assert.Equal(t, "alicePhoto", *alice.Meta.PolicyId)
+	assert.Equal(t, hexapolicy.SubjectInfo{"PhotoApp:User:\"alice\""}, alice.Subjects)
+	assert.Equal(t, []hexapolicy.ActionInfo{"PhotoApp:Action:\"viewPhoto\""}, alice.Actions)
+	assert.Equal(t, "PhotoApp:Photo:\"vacationPhoto.jpg\"", alice.Object.String())
+
+	stacey := policies.Policies[1]
+	assert.Equal(t, "staceyAccount", *stacey.Meta.PolicyId)
+	assert.NotNil(t, stacey.Condition)
+	assert.Equal(t, "resource in PhotoApp:Account:\"stacey\"", stacey.Condition.Rule)
+
+	// The same policies expressed as Cedar text should map identically
+	textPolicies, err := mapper.MapCedarPolicyBytes("test", readCedarTestFile(t, "cedarPhotoPolicy.txt"))
+	assert.NoError(t, err)
+	for i, policy := range textPolicies.Policies {
+		assert.True(t, policy.Equals(policies.Policies[i]), "policy %d should match", i)
+	}
+}
+
+func TestMapCedarJsonSinglePolicy(t *testing.T) {
+	mapper := NewCedarMapper(map[string]string{})
+
+	policies, err := mapper.MapCedarJsonPolicyBytes("test", readCedarTestFile(t, "cedarSinglePolicy.json"))
+	assert.NoError(t, err)
+	assert.Len(t, policies.Policies, 1)
+
+	policy := policies.Policies[0]
+	assert.Nil(t, policy.Meta.PolicyId)
+	assert.Equal(t, hexapolicy.SubjectInfo{"[UserGroup:\"AVTeam\"]"}, policy.Subjects)
+	assert.Equal(t, []hexapolicy.ActionInfo{"Action:\"viewPhoto\"", "Action:\"listPhotos\""}, policy.Actions)
+	assert.Equal(t, "Photo:", policy.Object.String())
+	assert.Equal(t, "principal.department eq \"Media\"", policy.Condition.Rule)
+	assert.Equal(t, "Members of the AV team may view photos", GetAnnotations(policy.Meta)["description"])
+	assert.Equal(t, "Members of the AV team may view photos", policy.Meta.Description)
+}
+
+func TestMapHexaToCedarJson(t *testing.T) {
+	mapper := NewCedarMapper(map[string]string{})
+
+	policies, err := mapper.MapCedarJsonPolicyBytes("test", readCedarTestFile(t, "cedarPhotoPolicySet.json"))
+	assert.NoError(t, err)
+
+	// Round trip via JSON to ensure policy ids survive an IDQL file
+	idqlBytes, err := hexapolicysupport.ToBytes(policies.Policies)
+	assert.NoError(t, err)
+	idqlPolicies, err := hexapolicysupport.ParsePolicies(idqlBytes)
+	assert.NoError(t, err)
+
+	jsonBytes, err := mapper.MapHexaPoliciesToJson("test", idqlPolicies)
+	assert.NoError(t, err)
+
+	var got, want cedar.PolicySet
+	assert.NoError(t, json.Unmarshal(jsonBytes, &got))
+	assert.NoError(t, json.Unmarshal(readCedarTestFile(t, "cedarPhotoPolicySet.json"), &want))
+	assert.Len(t, got.Map(), 2)
+	for id, policy := range want.Map() {
+		gotPolicy := got.Get(id)
+		assert.NotNil(t, gotPolicy, "policy %s should be present", id)
+		assert.Equal(t, policy.MarshalCedar(), gotPolicy.MarshalCedar())
+	}
+
+	// Multiple subjects map to multiple Cedar policies
+	multi := []hexapolicy.PolicyInfo{{
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: hexapolicy.SubjectInfo{"User:\"alice\"", "User:\"bob\""},
+		Actions:  []hexapolicy.ActionInfo{"Action:\"view\""},
+		Object:   "Photo:\"a.jpg\"",
+	}}
+	jsonBytes, err = mapper.MapHexaPoliciesToJson("test", multi)
+	assert.NoError(t, err)
+	var multiSet cedar.PolicySet
+	assert.NoError(t, json.Unmarshal(jsonBytes, &multiSet))
+	assert.NotNil(t, multiSet.Get("policy0_0"))
+	assert.NotNil(t, multiSet.Get("policy0_1"))
+}
+
+func TestMapCedarJsonErrors(t *testing.T) {
+	mapper := NewCedarMapper(map[string]string{})
+
+	_, err := mapper.MapCedarJsonPolicyBytes("test", []byte(`not json`))
+	assert.Error(t, err)
+
+	_, err = mapper.MapCedarJsonPolicyBytes("test", []byte(`{"policies": []}`))
+	assert.Error(t, err)
+
+	_, err = mapper.MapCedarJsonPolicyBytes("test", []byte(`{"effect": "permit", "principal": {"op": "bad"}}`))
+	assert.Error(t, err)
+
+	id := "dup"
+	dups := []hexapolicy.PolicyInfo{
+		{Meta: hexapolicy.MetaInfo{PolicyId: &id}, Subjects: hexapolicy.SubjectInfo{"any"}},
+		{Meta: hexapolicy.MetaInfo{PolicyId: &id}, Subjects: hexapolicy.SubjectInfo{"any"}},
+	}
+	_, err = mapper.MapHexaPoliciesToJson("test", dups)
+	assert.Error(t, err)
+}
+
+func TestMapCedarJsonReport(t *testing.T) {
+	mapper := NewCedarMapper(map[string]string{})
+
+	policies, report, err := mapper.MapCedarJsonPolicyBytesReport("test", readCedarTestFile(t, "cedarPhotoPolicySet.json"))
+	assert.NoError(t, err)
+	assert.Len(t, policies.Policies, 2)
+	assert.Equal(t, "idql", report.Target)
+	assert.Len(t, report.Policies, 2)
+	assert.False(t, report.IsLossy())
+
+	_, report, err = mapper.MapCedarJsonPolicyBytesReport("test", []byte(`not json`))
+	assert.Error(t, err)
+	assert.Nil(t, report)
+
+	// A policy that cannot be mapped is dropped, and the remaining policies are mapped
+	id := "dup"
+	dups := []hexapolicy.PolicyInfo{
+		{Meta: hexapolicy.MetaInfo{PolicyId: &id}, Subjects: hexapolicy.SubjectInfo{"any"}},
+		{Meta: hexapolicy.MetaInfo{PolicyId: &id}, Subjects: hexapolicy.SubjectInfo{"any"}},
+	}
+	jsonBytes, report, err := mapper.MapHexaPoliciesToJsonReport("test", dups)
+	assert.NoError(t, err)
+	assert.Equal(t, "cedar", report.Target)
+	assert.Equal(t, []string{"policy 1 (dup): POLICY DROPPED - duplicate policy id: dup"}, report.Issues())
+	var policySet cedar.PolicySet
+	assert.NoError(t, json.Unmarshal(jsonBytes, &policySet))
+	assert.Len(t, policySet.Map(), 1)
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -22,7 +24,7 @@ type CedarMapper struct {
 }
 
 func NewCedarMapper(attrNameMap map[string]string) *CedarMapper {
-	return &CedarMapper{condMap: &cedarConditions.CedarConditionMapper{conditions.NewNameMapper(attrNameMap)}}
+	return &CedarMapper{condMap: &cedarConditions.CedarConditionMapper{NameMapper: conditions.NewNameMapper(attrNameMap)}}
 }
 
 /*
@@ -44,11 +46,12 @@ type ParseSet struct {
 	Pos             int
 	loc             string
 	conditionMapper *cedarConditions.CedarConditionMapper
+	report          *hexapolicy.MappingReport // when set, the mapping of the policy at Pos is recorded
 }
 
 func (c *CedarMapper) MapCedarPolicyBytes(location string, cedarBytes []byte) (*hexapolicy.Policies, error) {
 
-	policies, err := cedar.NewPolicyListFromBytes(location, cedarBytes)
+	policies, err := cedar.NewPolicyListFromBytes(location, []byte(replaceSlots(string(cedarBytes))))
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +78,38 @@ func (c *CedarMapper) MapCedarPolicyBytes(location string, cedarBytes []byte) (*
 
 }
 
+/*
+MapCedarPolicyBytesReport maps Cedar policies to IDQL like MapCedarPolicyBytes, but continues past policies that cannot
+be mapped. The returned MappingReport (whose indexes are the position of each Cedar policy) records dropped policies and
+policies whose meaning changed. An error is returned only when the Cedar policies cannot be parsed.
+*/
+func (c *CedarMapper) MapCedarPolicyBytesReport(location string, cedarBytes []byte) (*hexapolicy.Policies, *hexapolicy.MappingReport, error) {
+	policies, err := cedar.NewPolicyListFromBytes(location, []byte(replaceSlots(string(cedarBytes))))
+	if err != nil {
+		return nil, nil, err
+	}
+	report := hexapolicy.NewMappingReport("idql")
+	cset := ParseSet{
+		Pairs:           make([]PolicyPair, 0),
+		IdqlPolicies:    make([]hexapolicy.PolicyInfo, 0),
+		loc:             location,
+		conditionMapper: c.condMap,
+		report:          report,
+	}
+
+	for i, cedarPolicy := range policies {
+		cset.Pos = i
+		if err := cset.MapCedarPolicy(cedarPolicy); err != nil {
+			report.Dropped(i, hexapolicy.PolicyInfo{}, hexapolicy.MapElementPolicy, err.Error())
+		}
+	}
+
+	return &hexapolicy.Policies{
+		Policies: cset.IdqlPolicies,
+		App:      &location,
+	}, report, nil
+}
+
 func (t *ParseSet) MapCedarPolicy(policy *cedar.Policy) error {
 	var err error
 	hexaPolicy := hexapolicy.PolicyInfo{Meta: hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion}}
@@ -107,6 +142,11 @@ func (t *ParseSet) MapCedarPolicy(policy *cedar.Policy) error {
 	}
 
 	if pair.HexaPolicy != nil {
+		t.report.ExactPolicy(t.Pos, *pair.HexaPolicy)
+		if jsonPolicy.Effect == "forbid" {
+			// IDQL policies are always a permit
+			t.report.Approximated(t.Pos, *pair.HexaPolicy, hexapolicy.MapElementPolicy, "Cedar forbid policy is mapped as an IDQL permit")
+		}
 		t.IdqlPolicies = append(t.IdqlPolicies, *pair.HexaPolicy)
 	} else {
 		return errors.New("no policy mapped")
@@ -146,6 +186,34 @@ func (c *CedarMapper) MapHexaPolicies(location string, policies []hexapolicy.Pol
 	return sb.String(), nil
 }
 
+/*
+MapHexaPoliciesReport maps IDQL policies to Cedar like MapHexaPolicies, but continues past policies that cannot be
+mapped. The mapping of each policy is recorded in the returned MappingReport.
+*/
+func (c *CedarMapper) MapHexaPoliciesReport(location string, policies []hexapolicy.PolicyInfo) (string, *hexapolicy.MappingReport) {
+	report := hexapolicy.NewMappingReport("cedar")
+	sb := strings.Builder{}
+	pset := ParseSet{
+		Pairs:           make([]PolicyPair, 0),
+		IdqlPolicies:    make([]hexapolicy.PolicyInfo, 0),
+		loc:             location,
+		conditionMapper: c.condMap,
+		report:          report,
+	}
+
+	for i, hexaPolicy := range policies {
+		pset.Pos = i
+		cedarPol, err := pset.MapHexaPolicy(hexaPolicy)
+		if err != nil {
+			report.Dropped(i, hexaPolicy, hexapolicy.MapElementPolicy, err.Error())
+			continue
+		}
+		sb.WriteString(cedarPol)
+	}
+
+	return sb.String(), report
+}
+
 func (t *ParseSet) MapHexaPolicy(policy hexapolicy.PolicyInfo) (string, error) {
 	pp := PolicyPair{
 		HexaPolicy: &policy,
@@ -161,6 +229,7 @@ func (t *ParseSet) MapHexaPolicy(policy hexapolicy.PolicyInfo) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	t.reportHexaPolicy(policy, subjects, resource)
 
 	// conditions ;= pp.mapConditions()
 	for _, subject := range subjects {
@@ -170,6 +239,27 @@ func (t *ParseSet) MapHexaPolicy(policy hexapolicy.PolicyInfo) (string, error) {
 	return pp.res.String(), nil
 }
 
+func (t *ParseSet) reportHexaPolicy(policy hexapolicy.PolicyInfo, subjects []string, resource string) {
+	if t.report == nil {
+		return
+	}
+	t.report.ExactPolicy(t.Pos, policy)
+	if len(subjects) == 0 {
+		t.report.Dropped(t.Pos, policy, hexapolicy.MapElementPolicy, "policy has no subjects so no Cedar policy was created")
+	}
+	for i, subject := range subjects {
+		if strings.HasPrefix(subject, "<unexpected type") {
+			t.report.Dropped(t.Pos, policy, hexapolicy.CompareDifSubject, fmt.Sprintf("subject %s has no Cedar equivalent", policy.Subjects[i]))
+		}
+	}
+	if slices.ContainsFunc(policy.Subjects, func(subject string) bool { return strings.EqualFold(subject, hexapolicy.SubjectAnyAuth) }) {
+		t.report.Approximated(t.Pos, policy, hexapolicy.CompareDifSubject, "anyAuthenticated is mapped as any principal of type User")
+	}
+	if strings.HasPrefix(resource, "<unexpected type") {
+		t.report.Dropped(t.Pos, policy, hexapolicy.CompareDifObject, fmt.Sprintf("object %s has no Cedar equivalent", policy.Object.String()))
+	}
+}
+
 func (pp *PolicyPair) writeCedarPolicy(annotations, subject, actions, resource, conditions string) {
 	pp.res.WriteString(annotations)
 	// Note: IDQL policies are always a permit
@@ -190,35 +280,77 @@ func (pp *PolicyPair) writeCedarPolicy(annotations, subject, actions, resource,
 	return
 }
 
-// For Hexa, we just map annotations to Policy Meta
+const (
+	SourceAnnotations     = "annotations" // SourceAnnotations is the IDQL meta SourceData key holding Cedar annotations
+	AnnotationId          = "id"          // AnnotationId is the Cedar annotation mapped to the IDQL policy id
+	AnnotationDescription = "description" // AnnotationDescription is the Cedar annotation mapped to the IDQL description
+)
+
+// GetAnnotations returns the Cedar annotations held in IDQL meta. Annotations may be a map of strings or, after being
+// parsed from JSON, a map of interfaces.
+func GetAnnotations(meta hexapolicy.MetaInfo) map[string]string {
+	switch annotations := meta.SourceData[SourceAnnotations].(type) {
+	case map[string]string:
+		return annotations
+	case map[string]interface{}:
+		res := make(map[string]string, len(annotations))
+		for key, value := range annotations {
+			res[key] = fmt.Sprint(value)
+		}
+		return res
+	}
+	return nil
+}
+
+// mapCedarAnnotations copies all Cedar annotations to the IDQL Meta SourceData. The `@id` and `@description` annotations
+// also set the IDQL policy id and description.
 func (pp *PolicyPair) mapCedarAnnotations() {
 	meta := pp.HexaPolicy.Meta
 
-	annotations := pp.CedarPolicy.Annotations
-	aMap := annotations()
-	if aMap == nil || len(aMap) == 0 {
+	aMap := pp.CedarPolicy.Annotations()
+	if len(aMap) == 0 {
 		return
 	}
+	annotations := make(map[string]string, len(aMap))
+	for key, value := range aMap {
+		annotations[string(key)] = string(value)
+	}
+	if id, ok := annotations[AnnotationId]; ok {
+		meta.PolicyId = &id
+	}
+	if description, ok := annotations[AnnotationDescription]; ok {
+		meta.Description = description
+	}
 	if meta.SourceData == nil {
 		meta.SourceData = make(map[string]interface{})
 	}
-	meta.SourceData["annotations"] = aMap
+	meta.SourceData[SourceAnnotations] = annotations
 	pp.HexaPolicy.Meta = meta
 }
 
+// mapHexaAnnotations returns the Cedar annotations for an IDQL policy in key order. Where the policy has `@id` or
+// `@description` annotations, the IDQL policy id and description take precedence so that edits to the IDQL are kept.
 func (pp *PolicyPair) mapHexaAnnotations() string {
 	meta := pp.HexaPolicy.Meta
-	sourceData := meta.SourceData
-	if sourceData == nil {
+	annotationMap := GetAnnotations(meta)
+	if len(annotationMap) == 0 {
 		return ""
 	}
-	annotationMap, ok := sourceData["annotations"].(map[string]interface{})
-	if !ok {
-		return ""
+	keys := make([]string, 0, len(annotationMap))
+	for key := range annotationMap {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 	sb := strings.Builder{}
-	for key, val := range annotationMap {
-		sb.WriteString(fmt.Sprintf("@%s(\"%s\")\n", key, val))
+	for _, key := range keys {
+		value := annotationMap[key]
+		switch {
+		case key == AnnotationId && meta.PolicyId != nil:
+			value = *meta.PolicyId
+		case key == AnnotationDescription && meta.Description != "":
+			value = meta.Description
+		}
+		sb.WriteString(fmt.Sprintf("@%s(%s)\n", key, strconv.Quote(value)))
 	}
 	return sb.String()
 }
@@ -231,6 +363,9 @@ func mapCedarScope(verb string, scope policyjson.ScopeJSON) []string {
 		}
 		return []string{}
 	case "==":
+		if slot, ok := slotEntity(string(scope.Entity.Type), scope.Entity.ID.String()); ok {
+			return []string{slot.String()}
+		}
 		id := strconv.Quote(scope.Entity.ID.String())
 		entityType := string(scope.Entity.Type)
 		types := strings.Split(entityType, "::")
@@ -246,20 +381,21 @@ func mapCedarScope(verb string, scope policyjson.ScopeJSON) []string {
 		if scope.In != nil {
 			// is in
 
-			inEntityStr := fmt.Sprintf("%s:%s", scope.In.Entity.Type, strconv.Quote(string(scope.In.Entity.ID)))
-
-			inEntity := hexaTypes.ParseEntity(inEntityStr)
+			inEntity, ok := slotEntity(string(scope.In.Entity.Type), string(scope.In.Entity.ID))
+			if !ok {
+				inEntity = hexaTypes.ParseEntity(EntityValue(string(scope.In.Entity.Type), string(scope.In.Entity.ID)))
+			}
 			inEntities := []hexaTypes.Entity{*inEntity}
 			path := hexaTypes.Entity{
 				Type:  hexaTypes.RelTypeIsIn,
-				Types: []string{scope.EntityType},
+				Types: strings.Split(scope.EntityType, "::"),
 				In:    &inEntities,
 			}
 			return []string{path.String()}
 		} else {
 			path := hexaTypes.Entity{
 				Type:  hexaTypes.RelTypeIs,
-				Types: []string{scope.EntityType}}
+				Types: strings.Split(scope.EntityType, "::")}
 			return []string{path.String()}
 
 		}
@@ -268,12 +404,15 @@ func mapCedarScope(verb string, scope policyjson.ScopeJSON) []string {
 		if scope.Entity != nil {
 			eType := string(scope.Entity.Type)
 			id := strconv.Quote(scope.Entity.ID.String())
-			inEntity := hexaTypes.Entity{
+			inEntity := &hexaTypes.Entity{
 				Type:  hexaTypes.RelTypeEquals,
-				Types: []string{eType},
+				Types: strings.Split(eType, "::"),
 				Id:    &id,
 			}
-			inEntities := []hexaTypes.Entity{inEntity}
+			if slot, ok := slotEntity(eType, scope.Entity.ID.String()); ok {
+				inEntity = slot
+			}
+			inEntities := []hexaTypes.Entity{*inEntity}
 			path := hexaTypes.Entity{
 				Type: hexaTypes.RelTypeIn,
 				In:   &inEntities,
@@ -287,7 +426,7 @@ func mapCedarScope(verb string, scope policyjson.ScopeJSON) []string {
 				pathItem := hexaTypes.Entity{
 					Type:  hexaTypes.RelTypeEquals,
 					Id:    &id,
-					Types: []string{string(entity.Type)},
+					Types: strings.Split(string(entity.Type), "::"),
 				}
 				items[i] = pathItem
 			}
@@ -340,8 +479,11 @@ func mapHexaValue(verb string, member string) string {
 	path := hexaTypes.ParseEntity(member)
 	switch path.Type {
 	case hexaTypes.RelTypeEquals:
+		if isSlot(*path) {
+			return fmt.Sprintf("%s == %s%s", verb, *path.Id, comma)
+		}
 		types := strings.Join(path.Types, "::")
-		id := strconv.Quote(*path.Id)
+		id := strconv.Quote(path.GetId())
 		if verb == "action" {
 			return fmt.Sprintf("%s::%s", types, id)
 		}
@@ -353,12 +495,7 @@ func mapHexaValue(verb string, member string) string {
 		if len(*path.In) == 1 {
 			// if only one entity, no square brackets
 			inset := *path.In
-			entity := inset[0]
-			types := strings.Join(entity.Types, "::")
-			if entity.Id != nil {
-				types = types + "::" + strconv.Quote(*entity.Id)
-			}
-			return fmt.Sprintf("%s in %s%s", verb, types, comma)
+			return fmt.Sprintf("%s in %s%s", verb, mapHexaEntityRef(inset[0]), comma)
 		}
 		sb := strings.Builder{}
 		sb.WriteString("[")
@@ -366,11 +503,7 @@ func mapHexaValue(verb string, member string) string {
 			if i > 0 {
 				sb.WriteString(",")
 			}
-			types := strings.Join(entity.Types, "::")
-			if entity.Id != nil {
-				types = types + "::" + strconv.Quote(*entity.Id)
-			}
-			sb.WriteString(types)
+			sb.WriteString(mapHexaEntityRef(entity))
 		}
 		sb.WriteString("]")
 		return fmt.Sprintf("%s in %s%s", verb, sb.String(), comma)
@@ -380,22 +513,14 @@ func mapHexaValue(verb string, member string) string {
 			// if only one entity, no square brackets
 			inset := *path.In
 			entity := inset[0]
-			types := strings.Join(entity.Types, "::")
-			if entity.Id != nil {
-				types = types + "::" + strconv.Quote(*entity.Id)
-			}
-			sb.WriteString(types)
+			sb.WriteString(mapHexaEntityRef(entity))
 		} else {
 			sb.WriteString("[")
 			for i, entity := range *path.In {
 				if i > 0 {
 					sb.WriteString(",")
 				}
-				types := strings.Join(entity.Types, "::")
-				if entity.Id != nil {
-					types = types + "::" + strconv.Quote(*entity.Id)
-				}
-				sb.WriteString(types)
+				sb.WriteString(mapHexaEntityRef(entity))
 			}
 			sb.WriteString("]")
 		}
@@ -405,6 +530,18 @@ func mapHexaValue(verb string, member string) string {
 	return "<unexpected type [" + path.Type + "]>"
 }
 
+// mapHexaEntityRef returns the Cedar reference for an entity within an `in` clause (e.g. `Group::"admins"`)
+func mapHexaEntityRef(entity hexaTypes.Entity) string {
+	if isSlot(entity) {
+		return *entity.Id
+	}
+	ref := strings.Join(entity.Types, "::")
+	if entity.Id != nil {
+		ref = ref + "::" + strconv.Quote(entity.GetId())
+	}
+	return ref
+}
+
 func (pp *PolicyPair) mapHexaSubjects() []string {
 	if pp.HexaPolicy == nil || pp.HexaPolicy.Subjects == nil {
 		return nil
@@ -0,0 +1,76 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicysupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapHexaPoliciesReport(t *testing.T) {
+	policies, err := hexapolicysupport.ParsePolicies([]byte(`[
+  {
+    "meta": {"version": "0.7", "policyId": "exact"},
+    "subjects": ["User:\"alice\""],
+    "actions": ["Action:\"view\""],
+    "object": "Photo:\"VacationPhoto.jpg\""
+  },
+  {
+    "meta": {"version": "0.7"},
+    "subjects": ["anyAuthenticated"],
+    "actions": ["Action:\"view\""],
+    "object": "any"
+  },
+  {
+    "meta": {"version": "0.7"},
+    "actions": ["Action:\"view\""]
+  },
+  {
+    "meta": {"version": "0.7"},
+    "subjects": ["User:\"alice\""],
+    "condition": {"rule": "(context.level eq 1", "action": "allow"}
+  }
+]`))
+	assert.NoError(t, err)
+
+	mapper := NewCedarMapper(map[string]string{})
+	cedarPolicies, report := mapper.MapHexaPoliciesReport("test", policies)
+	assert.Contains(t, cedarPolicies, `principal == User::"alice"`)
+	assert.Contains(t, cedarPolicies, "principal is User")
+	assert.Equal(t, "cedar", report.Target)
+	assert.Len(t, report.Policies, 4)
+
+	issues := report.Issues()
+	assert.Len(t, issues, 4)
+	assert.Equal(t, "policy 1: SUBJECT APPROXIMATED - anyAuthenticated is mapped as any principal of type User", issues[0])
+	assert.Equal(t, "policy 1: OBJECT DROPPED - object any has no Cedar equivalent", issues[1])
+	assert.Contains(t, issues[2], "policy 2: POLICY DROPPED - policy has no subjects")
+	assert.Contains(t, issues[3], "policy 3: POLICY DROPPED")
+
+	// MapHexaPolicies stops at the first failure
+	_, err = mapper.MapHexaPolicies("test", policies)
+	assert.Error(t, err)
+}
+
+func TestMapCedarPolicyBytesReport(t *testing.T) {
+	cedarPolicies := `permit (
+  principal == User::"alice",
+  action == Action::"view",
+  resource
+);
+forbid (
+  principal == User::"bob",
+  action,
+  resource
+);`
+	mapper := NewCedarMapper(map[string]string{})
+	policies, report, err := mapper.MapCedarPolicyBytesReport("test", []byte(cedarPolicies))
+	assert.NoError(t, err)
+	assert.Len(t, policies.Policies, 2)
+	assert.Equal(t, []string{"policy 1: POLICY APPROXIMATED - Cedar forbid policy is mapped as an IDQL permit"}, report.Issues())
+	assert.Equal(t, hexapolicy.FidelityExact, report.Policies[0].Elements[0].Fidelity)
+
+	_, _, err = mapper.MapCedarPolicyBytesReport("test", []byte("permit (principal"))
+	assert.Error(t, err)
+}
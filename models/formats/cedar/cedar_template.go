@@ -0,0 +1,139 @@
+package cedar
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	hexaTypes "github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
+)
+
+/*
+cedar_template.go supports Cedar policy templates (see https://docs.cedarpolicy.com/policies/templates.html). In IDQL, a
+template is a policy whose subject and/or object contains the slots `?principal` and `?resource`, for example:
+
+	"subjects": ["?principal"], "object": "[?resource]"
+
+is equivalent to `principal == ?principal` and `resource in ?resource`. A template-linked policy is the template with its
+slots bound to specific entities (see LinkTemplate).
+*/
+
+const (
+	SlotPrincipal = "?principal"
+	SlotResource  = "?resource"
+)
+
+// slotEntityType is a placeholder entity type used to carry template slots through the Cedar parser, which does not
+// accept templates.
+const slotEntityType = "HexaTemplateSlot"
+
+var slotRegex = regexp.MustCompile(`^\?(principal|resource)\b`)
+
+/*
+replaceSlots converts template slots in Cedar policy text into placeholder entities that can be parsed. String literals
+and comments are copied unchanged, so text such as `"?principal"` in a condition is not treated as a slot.
+*/
+func replaceSlots(cedarText string) string {
+	return scanSlots(cedarText, func(slot string) string {
+		return slotEntityType + `::"` + slot[1:] + `"`
+	})
+}
+
+// TemplateSlots returns the slots (SlotPrincipal and/or SlotResource) used by Cedar policy template text, ignoring text
+// in string literals and comments
+func TemplateSlots(cedarText string) []string {
+	var slots []string
+	scanSlots(cedarText, func(slot string) string {
+		if !slices.Contains(slots, slot) {
+			slots = append(slots, slot)
+		}
+		return slot
+	})
+	return slots
+}
+
+// scanSlots returns cedarText with each template slot outside string literals and comments replaced by replace(slot)
+func scanSlots(cedarText string, replace func(slot string) string) string {
+	var sb strings.Builder
+	for i := 0; i < len(cedarText); {
+		switch {
+		case cedarText[i] == '"':
+			end := i + 1
+			for end < len(cedarText) && cedarText[end] != '"' {
+				if cedarText[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(cedarText))
+			sb.WriteString(cedarText[i:end])
+			i = end
+		case strings.HasPrefix(cedarText[i:], "//"):
+			end := strings.IndexByte(cedarText[i:], '\n')
+			if end < 0 {
+				end = len(cedarText) - i
+			}
+			sb.WriteString(cedarText[i : i+end])
+			i += end
+		default:
+			if slot := slotRegex.FindString(cedarText[i:]); slot != "" {
+				sb.WriteString(replace(slot))
+				i += len(slot)
+				continue
+			}
+			sb.WriteByte(cedarText[i])
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// slotEntity returns the IDQL slot (e.g. `?principal`) when the Cedar entity is a slot placeholder
+func slotEntity(entityType string, id string) (*hexaTypes.Entity, bool) {
+	if entityType != slotEntityType {
+		return nil, false
+	}
+	slot := "?" + id
+	return &hexaTypes.Entity{Type: hexaTypes.RelTypeEquals, Id: &slot}, true
+}
+
+func isSlot(entity hexaTypes.Entity) bool {
+	if len(entity.Types) > 0 || entity.Id == nil {
+		return false
+	}
+	return *entity.Id == SlotPrincipal || *entity.Id == SlotResource
+}
+
+// IsTemplate returns true if the IDQL policy subjects or object contain a template slot
+func IsTemplate(policy hexapolicy.PolicyInfo) bool {
+	if slices.ContainsFunc(policy.Subjects, func(subject string) bool {
+		return strings.Contains(subject, SlotPrincipal)
+	}) {
+		return true
+	}
+	return strings.Contains(policy.Object.String(), SlotResource)
+}
+
+// EntityValue returns the IDQL value for a Cedar entity type (e.g. `PhotoApp::User`) and id
+func EntityValue(entityType string, id string) string {
+	return strings.ReplaceAll(entityType, "::", ":") + ":" + strconv.Quote(id)
+}
+
+// LinkTemplate returns a copy of an IDQL template with its slots bound to the IDQL entity values principal and
+// resource (see EntityValue). An empty value leaves the corresponding slot unbound.
+func LinkTemplate(template hexapolicy.PolicyInfo, principal string, resource string) hexapolicy.PolicyInfo {
+	linked := template
+	if principal != "" {
+		subjects := make(hexapolicy.SubjectInfo, len(template.Subjects))
+		for i, subject := range template.Subjects {
+			subjects[i] = strings.ReplaceAll(subject, SlotPrincipal, principal)
+		}
+		linked.Subjects = subjects
+	}
+	if resource != "" {
+		linked.Object = hexapolicy.ObjectInfo(strings.ReplaceAll(template.Object.String(), SlotResource, resource))
+	}
+	return linked
+}
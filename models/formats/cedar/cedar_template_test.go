@@ -0,0 +1,128 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapCedarTemplate(t *testing.T) {
+	mapper := NewCedarMapper(map[string]string{})
+
+	tests := []struct {
+		name     string
+		cedar    string
+		subjects hexapolicy.SubjectInfo
+		object   string
+	}{
+		{
+			name: "Equals",
+			cedar: `permit (
+  principal == ?principal,
+  action in [hexa_avp::Action::"ReadAccount"],
+  resource == ?resource
+);`,
+			subjects: hexapolicy.SubjectInfo{"?principal"},
+			object:   "?resource",
+		},
+		{
+			name: "In",
+			cedar: `permit (
+  principal in ?principal,
+  action in [hexa_avp::Action::"ReadAccount"],
+  resource in ?resource
+);`,
+			subjects: hexapolicy.SubjectInfo{"[?principal]"},
+			object:   "[?resource]",
+		},
+		{
+			name: "Is in",
+			cedar: `permit (
+  principal is hexa_avp::User in ?principal,
+  action in [hexa_avp::Action::"ReadAccount"],
+  resource == hexa_avp::account::"1"
+);`,
+			subjects: hexapolicy.SubjectInfo{"hexa_avp:User[?principal]"},
+			object:   "hexa_avp:account:\"1\"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := mapper.MapCedarPolicyBytes("test", []byte(tt.cedar))
+			assert.NoError(t, err)
+			assert.Len(t, policies.Policies, 1)
+			template := policies.Policies[0]
+			assert.Equal(t, tt.subjects, template.Subjects)
+			assert.Equal(t, tt.object, template.Object.String())
+			assert.True(t, IsTemplate(template))
+
+			// Mapping back to Cedar should produce an equivalent template
+			cedarText, err := mapper.MapHexaPolicies("test", policies.Policies)
+			assert.NoError(t, err)
+			reparsed, err := mapper.MapCedarPolicyBytes("test", []byte(cedarText))
+			assert.NoError(t, err)
+			assert.True(t, template.Equals(reparsed.Policies[0]), "round trip should match")
+		})
+	}
+}
+
+func TestLinkTemplate(t *testing.T) {
+	mapper := NewCedarMapper(map[string]string{})
+	policies, err := mapper.MapCedarPolicyBytes("test", []byte(`permit (
+  principal in ?principal,
+  action == Action::"view",
+  resource == ?resource
+);`))
+	assert.NoError(t, err)
+	template := policies.Policies[0]
+
+	principal := EntityValue("PhotoApp::UserGroup", "admins")
+	assert.Equal(t, "PhotoApp:UserGroup:\"admins\"", principal)
+	linked := LinkTemplate(template, principal, EntityValue("Photo", "a.jpg"))
+	assert.False(t, IsTemplate(linked))
+	assert.Equal(t, hexapolicy.SubjectInfo{"[PhotoApp:UserGroup:\"admins\"]"}, linked.Subjects)
+	assert.Equal(t, "Photo:\"a.jpg\"", linked.Object.String())
+	assert.Equal(t, hexapolicy.SubjectInfo{"[?principal]"}, template.Subjects, "template should be unchanged")
+
+	cedarText, err := mapper.MapHexaPolicies("test", []hexapolicy.PolicyInfo{linked})
+	assert.NoError(t, err)
+	assert.Contains(t, cedarText, "principal in PhotoApp::UserGroup::\"admins\"")
+	assert.Contains(t, cedarText, "resource == Photo::\"a.jpg\"")
+
+	partial := LinkTemplate(template, "", EntityValue("Photo", "a.jpg"))
+	assert.True(t, IsTemplate(partial))
+
+	_, err = mapper.MapHexaPoliciesToJson("test", []hexapolicy.PolicyInfo{template})
+	assert.Error(t, err, "templates are not supported in Cedar JSON")
+}
+
+func TestMapCedarTemplate_slotTextInStrings(t *testing.T) {
+	mapper := NewCedarMapper(map[string]string{})
+	policies, err := mapper.MapCedarPolicyBytes("test", []byte(`// ?resource is bound when the template is linked
+permit (
+  principal == ?principal,
+  action == Action::"view",
+  resource in ?resource
+) when { context.note == "?principal \"?resource\"" };`))
+	assert.NoError(t, err)
+	assert.Len(t, policies.Policies, 1)
+	template := policies.Policies[0]
+	assert.Equal(t, hexapolicy.SubjectInfo{"?principal"}, template.Subjects)
+	assert.Equal(t, "[?resource]", template.Object.String())
+	assert.NotNil(t, template.Condition)
+	assert.Contains(t, template.Condition.Rule, `?principal`)
+	assert.NotContains(t, template.Condition.Rule, slotEntityType, "slot text in a string should not be replaced")
+
+	cedarText, err := mapper.MapHexaPolicies("test", policies.Policies)
+	assert.NoError(t, err)
+	assert.NotContains(t, cedarText, slotEntityType)
+	assert.Contains(t, cedarText, `principal == ?principal`)
+}
+
+func TestTemplateSlots(t *testing.T) {
+	assert.Equal(t, []string{SlotPrincipal, SlotResource}, TemplateSlots(`permit (principal == ?principal, action, resource in ?resource);`))
+	assert.Equal(t, []string{SlotPrincipal}, TemplateSlots(`// ?resource is not used
+permit (principal in ?principal, action, resource) when { context.note == "?resource" };`))
+	assert.Nil(t, TemplateSlots(`permit (principal, action, resource) when { context.note == "?principal" };`))
+}
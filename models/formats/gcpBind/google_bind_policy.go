@@ -2,8 +2,11 @@ package gcpBind
 
 import (
     "encoding/json"
+    "errors"
     "fmt"
+    "log"
     "os"
+    "slices"
     "strings"
 
     "github.com/hexa-org/policy-mapper/models/conditionLangs/gcpcel"
@@ -28,6 +31,9 @@ func New(nameMap map[string]string) *GooglePolicyMapper {
     return &GooglePolicyMapper{conditionMapper: gcpcel.GoogleConditionMapper{NameMapper: conditions.NewNameMapper(nameMap)}}
 }
 
+// ErrDenyCondition is returned when a policy has a deny condition, which IAM binding conditions cannot express
+var ErrDenyCondition = errors.New("IAM binding conditions can only allow access; policies with a deny condition are not supported")
+
 func (m *GooglePolicyMapper) Name() string {
     return "bind"
 }
@@ -108,31 +114,360 @@ func (m *GooglePolicyMapper) MapPolicyToBinding(policy hexapolicy.PolicyInfo) (*
 }
 
 func (m *GooglePolicyMapper) MapPoliciesToBindings(policies []hexapolicy.PolicyInfo) []*BindAssignment {
+    bindings, _ := m.MapPoliciesToBindingsReport(policies)
+    return bindings
+}
+
+/*
+MapPoliciesToBindingsReport maps policies to bindings grouped by resource (object) and returns a MappingReport
+describing policies and elements that could not be represented exactly. Policies that cannot be mapped are reported as
+dropped.
+*/
+func (m *GooglePolicyMapper) MapPoliciesToBindingsReport(policies []hexapolicy.PolicyInfo) ([]*BindAssignment, *hexapolicy.MappingReport) {
+    report := hexapolicy.NewMappingReport(m.Name())
     bindingMap := make(map[string][]iam.Binding)
+    var resourceIds []string
 
     for i, policy := range policies {
-        binding, err := m.MapPolicyToBinding(policy)
+        policyBindings, err := m.MapPolicyToBindings(policy)
         if err != nil {
-            fmt.Println(err.Error())
+            report.Dropped(i, policy, hexapolicy.MapElementPolicy, err.Error())
+            continue
+        }
+        m.ReportPolicy(report, i, policy)
+        if len(policyBindings) == 0 {
             continue
         }
         key := policies[i].Object.String()
 
-        existing := bindingMap[key]
-        existing = append(existing, *binding)
+        existing, ok := bindingMap[key]
+        if !ok {
+            resourceIds = append(resourceIds, key)
+        }
+        for _, binding := range policyBindings {
+            existing = append(existing, *binding)
+        }
         bindingMap[key] = existing
 
     }
-    bindings := make([]*BindAssignment, len(bindingMap))
-    i := 0
-    for k, v := range bindingMap {
+    bindings := make([]*BindAssignment, len(resourceIds))
+    for i, k := range resourceIds {
         bindings[i] = &BindAssignment{
             ResourceId: k,
-            Bindings:   v,
+            Bindings:   bindingMap[k],
         }
-        i++
     }
-    return bindings
+    return bindings, report
+}
+
+/*
+IamMemberTypes are the forms of Google IAM principal identifiers (see https://cloud.google.com/iam/docs/principal-identifiers).
+Values ending in ':' are prefixes, others are matched exactly.
+*/
+var IamMemberTypes = []string{"allUsers", "allAuthenticatedUsers", "user:", "group:", "serviceAccount:", "domain:", "principal:", "principalSet:", "deleted:", "projectOwner:", "projectEditor:", "projectViewer:"}
+
+// IsIamMember returns true if member is a Google IAM principal identifier (see IamMemberTypes)
+func IsIamMember(member string) bool {
+    return slices.ContainsFunc(IamMemberTypes, func(memberType string) bool {
+        if strings.HasSuffix(memberType, ":") {
+            return strings.HasPrefix(member, memberType)
+        }
+        return member == memberType
+    })
+}
+
+/*
+ReportPolicy records in report how policy (at index) is represented by IAM bindings (see MapPolicyToBindings). It is
+used by MapPoliciesToBindingsReport and by the Google Cloud providers.
+*/
+func (m *GooglePolicyMapper) ReportPolicy(report *hexapolicy.MappingReport, index int, policy hexapolicy.PolicyInfo) {
+    report.ExactPolicy(index, policy)
+    if policy.Condition != nil && policy.Condition.Action == conditions.ADeny {
+        report.Dropped(index, policy, hexapolicy.MapElementPolicy, ErrDenyCondition.Error())
+        return
+    }
+    if len(policy.Actions) == 0 {
+        report.Dropped(index, policy, hexapolicy.MapElementPolicy, "policy has no actions (roles) so no bindings were created")
+        return
+    }
+    for _, member := range policy.Subjects {
+        if IsIamMember(member) {
+            continue
+        }
+        report.Approximated(index, policy, hexapolicy.CompareDifSubject, fmt.Sprintf("subject %s is not a Google IAM principal identifier and will not match any principal", member))
+    }
+}
+
+/*
+MapPolicyToBindings maps a policy to one binding per action (role). Unlike MapPolicyToBinding, which only uses the first
+action, every action of the policy is kept. A policy with a deny condition returns ErrDenyCondition.
+*/
+func (m *GooglePolicyMapper) MapPolicyToBindings(policy hexapolicy.PolicyInfo) ([]*iam.Binding, error) {
+    condExpr, err := m.convertPolicyCondition(policy)
+    if err != nil {
+        return nil, err
+    }
+    bindings := make([]*iam.Binding, 0, len(policy.Actions))
+    for _, action := range policy.Actions {
+        var cond *iam.Expr
+        if condExpr != nil {
+            exprCopy := *condExpr
+            cond = &exprCopy
+        }
+        bindings = append(bindings, &iam.Binding{
+            Condition: cond,
+            Members:   append([]string{}, policy.Subjects...),
+            Role:      strings.TrimPrefix(string(action), "gcp:"),
+        })
+    }
+    return bindings, nil
+}
+
+/*
+MapPoliciesToIamBindings maps a set of policies for a single resource to the bindings of an IAM policy. Bindings with
+the same role and condition are merged so that each appears once with the combined members (see MergeBindings).
+*/
+func (m *GooglePolicyMapper) MapPoliciesToIamBindings(policies []hexapolicy.PolicyInfo) ([]*iam.Binding, error) {
+    var bindings []*iam.Binding
+    for _, policy := range policies {
+        policyBindings, err := m.MapPolicyToBindings(policy)
+        if err != nil {
+            return nil, err
+        }
+        bindings = append(bindings, policyBindings...)
+    }
+    return MergeBindings(bindings), nil
+}
+
+/*
+BindingKey returns the identity of a binding within an IAM policy, which is the role and the condition expression (if any).
+*/
+func BindingKey(binding *iam.Binding) string {
+    if binding.Condition == nil || binding.Condition.Expression == "" {
+        return binding.Role
+    }
+    return fmt.Sprintf("%s if %s", binding.Role, binding.Condition.Expression)
+}
+
+/*
+MergeBindings combines bindings that have the same BindingKey into a single binding whose members are the union of the
+members of each. The order of first occurrence is preserved for both bindings and members.
+*/
+func MergeBindings(bindings []*iam.Binding) []*iam.Binding {
+    merged := make([]*iam.Binding, 0, len(bindings))
+    index := make(map[string]*iam.Binding, len(bindings))
+    for _, binding := range bindings {
+        key := BindingKey(binding)
+        existing, ok := index[key]
+        if !ok {
+            existing = &iam.Binding{Role: binding.Role, Condition: binding.Condition}
+            index[key] = existing
+            merged = append(merged, existing)
+        }
+        for _, member := range binding.Members {
+            if !slices.Contains(existing.Members, member) {
+                existing.Members = append(existing.Members, member)
+            }
+        }
+    }
+    return merged
+}
+
+/*
+PolicyVersion returns the IAM policy version required for the bindings. Version 3 is required for conditional bindings.
+*/
+func PolicyVersion(bindings []*iam.Binding) int64 {
+    for _, binding := range bindings {
+        if binding.Condition != nil {
+            return 3
+        }
+    }
+    return 1
+}
+
+/*
+ReconcileBindings compares the bindings of an existing IAM policy with a set of bindings to be applied to the resource
+objectId. Differences are reported per binding, where the PolicyId of each difference is the BindingKey. A binding
+whose members differ is reported as an update with a CompareDifSubject difference.
+*/
+func (m *GooglePolicyMapper) ReconcileBindings(objectId string, existBindings []*iam.Binding, compareBindings []*iam.Binding, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+    existMap := make(map[string]*iam.Binding, len(existBindings))
+    for _, binding := range existBindings {
+        existMap[BindingKey(binding)] = binding
+    }
+
+    res := make([]hexapolicy.PolicyDif, 0)
+    for _, binding := range compareBindings {
+        key := BindingKey(binding)
+        comparePolicy, err := m.MapBindingToPolicy(objectId, *binding)
+        if err != nil {
+            return nil, err
+        }
+
+        existBinding, exists := existMap[key]
+        if !exists {
+            res = append(res, hexapolicy.PolicyDif{
+                Type:          hexapolicy.ChangeTypeNew,
+                PolicyId:      key,
+                PolicyCompare: &comparePolicy,
+            })
+            continue
+        }
+        delete(existMap, key)
+
+        existPolicy, err := m.MapBindingToPolicy(objectId, *existBinding)
+        if err != nil {
+            return nil, err
+        }
+        if sameMembers(binding.Members, existBinding.Members) {
+            if !diffsOnly {
+                res = append(res, hexapolicy.PolicyDif{
+                    Type:          hexapolicy.ChangeTypeEqual,
+                    PolicyId:      key,
+                    DifTypes:      []string{hexapolicy.CompareEqual},
+                    PolicyExist:   []hexapolicy.PolicyInfo{existPolicy},
+                    PolicyCompare: &comparePolicy,
+                })
+            }
+            continue
+        }
+        res = append(res, hexapolicy.PolicyDif{
+            Type:          hexapolicy.ChangeTypeUpdate,
+            PolicyId:      key,
+            DifTypes:      []string{hexapolicy.CompareDifSubject},
+            PolicyExist:   []hexapolicy.PolicyInfo{existPolicy},
+            PolicyCompare: &comparePolicy,
+        })
+    }
+
+    // Remaining existing bindings are implied deletes
+    for _, binding := range existBindings {
+        key := BindingKey(binding)
+        if _, ok := existMap[key]; !ok {
+            continue
+        }
+        existPolicy, err := m.MapBindingToPolicy(objectId, *binding)
+        if err != nil {
+            return nil, err
+        }
+        res = append(res, hexapolicy.PolicyDif{
+            Type:        hexapolicy.ChangeTypeDelete,
+            PolicyId:    key,
+            PolicyExist: []hexapolicy.PolicyInfo{existPolicy},
+        })
+    }
+    return res, nil
+}
+
+// ErrEtagConflict is returned when an IAM policy was changed after it was read (see UpdateIamPolicy)
+var ErrEtagConflict = errors.New("google cloud iam policy was modified concurrently (etag mismatch)")
+
+// MaxSetPolicyAttempts is the number of times UpdateIamPolicy will read and write the IAM policy when an etag conflict
+// is detected.
+const MaxSetPolicyAttempts = 3
+
+/*
+UpdateIamPolicy replaces the bindings of the IAM policy of resource with bindings using an etag-guarded read-modify-write.
+getPolicy reads the policy and setPolicy writes it, returning ErrEtagConflict when the policy's etag no longer matches.
+On a conflict the policy is read again and the changes made by bindings to the policy first read are applied to it (see
+RebaseBindings), so that bindings changed by another client in the meantime are kept. An error wrapping ErrEtagConflict
+is returned when a binding was changed by both, or the policy is still changing after MaxSetPolicyAttempts.
+*/
+func UpdateIamPolicy(resource string, getPolicy func() (*iam.Policy, error), setPolicy func(*iam.Policy) error, bindings []*iam.Binding) error {
+    var baseBindings []*iam.Binding
+    for attempt := 1; ; attempt++ {
+        iamPolicy, err := getPolicy()
+        if err != nil {
+            return err
+        }
+        if attempt == 1 {
+            baseBindings = iamPolicy.Bindings
+        }
+        merged, err := RebaseBindings(baseBindings, iamPolicy.Bindings, bindings)
+        if err != nil {
+            return err
+        }
+        iamPolicy.Bindings = merged
+        iamPolicy.Version = PolicyVersion(merged)
+
+        err = setPolicy(iamPolicy)
+        if errors.Is(err, ErrEtagConflict) && attempt < MaxSetPolicyAttempts {
+            log.Printf("IAM policy for %s changed while updating, retrying (attempt %d).\n", resource, attempt)
+            continue
+        }
+        return err
+    }
+}
+
+/*
+RebaseBindings applies the changes that turn baseBindings into bindings to currentBindings, a later version of
+baseBindings. Bindings (identified by BindingKey) added to or changed in currentBindings since baseBindings that bindings
+does not change are kept. An error wrapping ErrEtagConflict is returned when a binding was changed differently in both.
+*/
+func RebaseBindings(baseBindings []*iam.Binding, currentBindings []*iam.Binding, bindings []*iam.Binding) ([]*iam.Binding, error) {
+    baseMap := bindingMap(baseBindings)
+    currentMap := bindingMap(currentBindings)
+    updateMap := bindingMap(bindings)
+
+    changed := func(from *iam.Binding, to *iam.Binding) bool {
+        if from == nil || to == nil {
+            return from != to
+        }
+        return !sameMembers(from.Members, to.Members)
+    }
+
+    res := make([]*iam.Binding, 0, len(bindings)+len(currentBindings))
+    for _, binding := range bindings {
+        key := BindingKey(binding)
+        base, current := baseMap[key], currentMap[key]
+        switch {
+        case !changed(base, binding):
+            // not changed by the update, keep any change made by another client
+            if current != nil {
+                res = append(res, current)
+            }
+        case changed(base, current) && changed(current, binding):
+            return nil, fmt.Errorf("%w: binding %s was also changed", ErrEtagConflict, key)
+        default:
+            res = append(res, binding)
+        }
+    }
+    for _, current := range currentBindings {
+        key := BindingKey(current)
+        if _, updated := updateMap[key]; updated {
+            continue
+        }
+        base, exists := baseMap[key]
+        if !exists {
+            // added by another client
+            res = append(res, current)
+            continue
+        }
+        if changed(base, current) {
+            return nil, fmt.Errorf("%w: binding %s was changed while being removed", ErrEtagConflict, key)
+        }
+    }
+    return res, nil
+}
+
+func bindingMap(bindings []*iam.Binding) map[string]*iam.Binding {
+    res := make(map[string]*iam.Binding, len(bindings))
+    for _, binding := range bindings {
+        res[BindingKey(binding)] = binding
+    }
+    return res
+}
+
+func sameMembers(members []string, other []string) bool {
+    if len(members) != len(other) {
+        return false
+    }
+    for _, member := range members {
+        if !slices.Contains(other, member) {
+            return false
+        }
+    }
+    return true
 }
 
 func convertActionToRole(policy hexapolicy.PolicyInfo) string {
@@ -163,6 +498,9 @@ func (m *GooglePolicyMapper) convertPolicyCondition(policy hexapolicy.PolicyInfo
     if policy.Condition == nil {
         return nil, nil // do nothing as policy has no condition
     }
+    if policy.Condition.Action == conditions.ADeny {
+        return nil, ErrDenyCondition
+    }
 
     celString, err := m.conditionMapper.MapConditionToProvider(*policy.Condition)
     if err != nil {
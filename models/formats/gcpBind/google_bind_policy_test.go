@@ -91,7 +91,7 @@ func TestProduceAndParseGcp(t *testing.T) {
     output, err := json.MarshalIndent(copyPolcies, "", "  ")
     fmt.Println(string(output))
     assert.NoError(t, err, "Check error after mapping bindings back to policies")
-    assert.Equal(t, 5, len(copyPolcies), "5 policies returned")
+    assert.Equal(t, 7, len(copyPolcies), "7 policies returned (one per action of the 5 source policies)")
 
     found := false
     for _, policy := range bindAssigns {
@@ -155,6 +155,112 @@ func PrintObj(data interface{}) {
 
 }
 
+func TestMapPoliciesToIamBindings(t *testing.T) {
+    policies, err := hexapolicysupport.ParsePolicies([]byte(`[
+  {
+    "meta": {"version": "0.7"},
+    "subjects": ["user:alice@example.com"],
+    "actions": ["gcp:roles/iap.httpsResourceAccessor", "gcp:roles/viewer"],
+    "object": "anObjectId"
+  },
+  {
+    "meta": {"version": "0.7"},
+    "subjects": ["user:bob@example.com", "user:alice@example.com"],
+    "actions": ["roles/iap.httpsResourceAccessor"],
+    "object": "anObjectId"
+  },
+  {
+    "meta": {"version": "0.7"},
+    "subjects": ["user:carol@example.com"],
+    "actions": ["gcp:roles/iap.httpsResourceAccessor"],
+    "condition": {"rule": "req.ip sw 127", "action": "allow"},
+    "object": "anObjectId"
+  }
+]`))
+    assert.NoError(t, err)
+
+    bindings, err := gcpMapper.MapPoliciesToIamBindings(policies)
+    assert.NoError(t, err)
+    assert.Len(t, bindings, 3)
+
+    assert.Equal(t, "roles/iap.httpsResourceAccessor", bindings[0].Role)
+    assert.Equal(t, []string{"user:alice@example.com", "user:bob@example.com"}, bindings[0].Members)
+    assert.Nil(t, bindings[0].Condition)
+
+    assert.Equal(t, "roles/viewer", bindings[1].Role)
+    assert.Equal(t, []string{"user:alice@example.com"}, bindings[1].Members)
+
+    assert.Equal(t, "roles/iap.httpsResourceAccessor", bindings[2].Role)
+    assert.Equal(t, []string{"user:carol@example.com"}, bindings[2].Members)
+    assert.NotNil(t, bindings[2].Condition)
+    assert.Equal(t, "roles/iap.httpsResourceAccessor if "+bindings[2].Condition.Expression, gcpBind.BindingKey(bindings[2]))
+    assert.Equal(t, "roles/viewer", gcpBind.BindingKey(bindings[1]))
+
+    // Policies are not modified when members are merged
+    assert.Equal(t, []string{"user:alice@example.com"}, []string(policies[0].Subjects))
+}
+
+func TestMapPoliciesToBindingsReport(t *testing.T) {
+    policies, err := hexapolicysupport.ParsePolicies([]byte(`[
+  {
+    "meta": {"version": "0.7", "policyId": "exact"},
+    "subjects": ["user:alice@example.com", "allUsers"],
+    "actions": ["gcp:roles/viewer"],
+    "object": "resource1"
+  },
+  {
+    "meta": {"version": "0.7"},
+    "subjects": ["alice@example.com"],
+    "actions": ["gcp:roles/viewer"],
+    "condition": {"rule": "req.ip sw 127", "action": "allow"},
+    "object": "resource2"
+  },
+  {
+    "meta": {"version": "0.7"},
+    "subjects": ["user:bob@example.com"],
+    "object": "resource1"
+  },
+  {
+    "meta": {"version": "0.7"},
+    "subjects": ["user:carol@example.com"],
+    "actions": ["gcp:roles/viewer"],
+    "condition": {"rule": "(req.ip sw 127", "action": "allow"},
+    "object": "resource1"
+  },
+  {
+    "meta": {"version": "0.7"},
+    "subjects": ["user:dave@example.com"],
+    "actions": ["gcp:roles/viewer"],
+    "condition": {"rule": "req.ip sw 127", "action": "deny"},
+    "object": "resource3"
+  }
+]`))
+    assert.NoError(t, err)
+
+    bindings, report := gcpMapper.MapPoliciesToBindingsReport(policies)
+    assert.Len(t, bindings, 2)
+    assert.Equal(t, "resource1", bindings[0].ResourceId, "bindings are in policy order")
+    assert.Equal(t, "resource2", bindings[1].ResourceId)
+
+    assert.True(t, report.IsLossy())
+    assert.Len(t, report.Policies, 5)
+    issues := report.Issues()
+    assert.Len(t, issues, 4)
+    assert.Contains(t, issues[0], "policy 1: SUBJECT APPROXIMATED - subject alice@example.com")
+    assert.Contains(t, issues[1], "policy 2: POLICY DROPPED - policy has no actions")
+    assert.Contains(t, issues[2], "policy 3: POLICY DROPPED")
+    assert.Contains(t, issues[3], "policy 4: POLICY DROPPED - IAM binding conditions can only allow access")
+
+    // A deny condition is not written as an allow binding
+    _, err = gcpMapper.MapPolicyToBindings(policies[4])
+    assert.ErrorIs(t, err, gcpBind.ErrDenyCondition)
+    _, err = gcpMapper.MapPoliciesToIamBindings(policies)
+    assert.Error(t, err)
+    for _, element := range report.Policies[0].Elements {
+        assert.Equal(t, "EXACT", element.Fidelity)
+    }
+}
+
 func WriteObj(path string, data interface{}) error {
     var polBytes []byte
     switch pol := data.(type) {
@@ -178,3 +284,38 @@ func WriteObj(path string, data interface{}) error {
     return os.WriteFile(path, polBytes, 0644)
 
 }
+
+func TestRebaseBindings(t *testing.T) {
+    viewer := &iam.Binding{Role: "roles/viewer", Members: []string{"user:alice@example.com"}}
+    editor := &iam.Binding{Role: "roles/editor", Members: []string{"user:bob@example.com"}}
+    owner := &iam.Binding{Role: "roles/owner", Members: []string{"user:carol@example.com"}}
+    viewerBob := &iam.Binding{Role: "roles/viewer", Members: []string{"user:bob@example.com"}}
+    editorDan := &iam.Binding{Role: "roles/editor", Members: []string{"user:dan@example.com"}}
+    base := []*iam.Binding{viewer, editor}
+
+    // Unchanged policy: the bindings replace the policy
+    res, err := gcpBind.RebaseBindings(base, base, []*iam.Binding{viewerBob})
+    assert.NoError(t, err)
+    assert.Equal(t, []*iam.Binding{viewerBob}, res)
+
+    // A binding added by another client is kept, the removed editor binding stays removed
+    res, err = gcpBind.RebaseBindings(base, []*iam.Binding{viewer, editor, owner}, []*iam.Binding{viewerBob})
+    assert.NoError(t, err)
+    assert.Equal(t, []*iam.Binding{viewerBob, owner}, res)
+
+    // A binding changed by another client that is not changed by the update is kept
+    res, err = gcpBind.RebaseBindings(base, []*iam.Binding{viewer, editorDan}, []*iam.Binding{viewerBob, editor})
+    assert.NoError(t, err)
+    assert.Equal(t, []*iam.Binding{viewerBob, editorDan}, res)
+
+    // The same change made by both is not a conflict
+    res, err = gcpBind.RebaseBindings(base, []*iam.Binding{viewerBob, editor}, []*iam.Binding{viewerBob, editor})
+    assert.NoError(t, err)
+    assert.Equal(t, []*iam.Binding{viewerBob, editor}, res)
+
+    // Different changes to the same binding, or a change to a removed binding, conflict
+    _, err = gcpBind.RebaseBindings(base, []*iam.Binding{viewer, editorDan}, []*iam.Binding{viewer, owner, {Role: "roles/editor", Members: []string{"user:erin@example.com"}}})
+    assert.ErrorIs(t, err, gcpBind.ErrEtagConflict)
+    _, err = gcpBind.RebaseBindings(base, []*iam.Binding{viewer, editorDan}, []*iam.Binding{viewer})
+    assert.ErrorIs(t, err, gcpBind.ErrEtagConflict)
+}
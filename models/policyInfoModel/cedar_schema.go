@@ -0,0 +1,884 @@
+package policyInfoModel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This file converts between Namespaces and the Cedar schema formats (.cedarschema and Cedar JSON schema). See
+// [Cedar Schema Grammar](https://docs.cedarpolicy.com/schema/human-readable-schema-grammar.html).
+
+const cedarBuiltInPrefix = "__cedar::"
+
+var cedarExtensionTypes = []string{"ipaddr", "decimal", "datetime", "duration"}
+
+var identRegex = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+
+const (
+	tokenEOF = iota
+	tokenIdent
+	tokenString
+	tokenPunct
+)
+
+type schemaToken struct {
+	kind int
+	text string
+	line int
+}
+
+func (t schemaToken) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+func lexCedarSchema(src string) ([]schemaToken, error) {
+	var tokens []schemaToken
+	runes := []rune(src)
+	line := 1
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, schemaToken{kind: tokenIdent, text: string(runes[start:i]), line: line})
+		case r == '"':
+			sb := strings.Builder{}
+			startLine := line
+			i++
+			closed := false
+			for i < len(runes) {
+				c := runes[i]
+				if c == '"' {
+					closed = true
+					i++
+					break
+				}
+				if c == '\n' {
+					line++
+				}
+				if c == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					case 'r':
+						sb.WriteRune('\r')
+					case '0':
+						sb.WriteRune(0)
+					default:
+						sb.WriteRune(runes[i])
+					}
+					i++
+					continue
+				}
+				sb.WriteRune(c)
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("cedar schema line %d: unterminated string", startLine)
+			}
+			tokens = append(tokens, schemaToken{kind: tokenString, text: sb.String(), line: startLine})
+		case r == ':' && i+1 < len(runes) && runes[i+1] == ':':
+			tokens = append(tokens, schemaToken{kind: tokenPunct, text: "::", line: line})
+			i += 2
+		case strings.ContainsRune("{}[]<>(),;:?=@", r):
+			tokens = append(tokens, schemaToken{kind: tokenPunct, text: string(r), line: line})
+			i++
+		default:
+			return nil, fmt.Errorf("cedar schema line %d: unexpected character '%c'", line, r)
+		}
+	}
+	return append(tokens, schemaToken{kind: tokenEOF, line: line}), nil
+}
+
+type schemaParser struct {
+	tokens     []schemaToken
+	pos        int
+	namespaces Namespaces
+}
+
+// ParseCedarSchema parses a Cedar human-readable schema (.cedarschema) into Namespaces. Declarations outside a
+// `namespace` block are returned under the empty namespace "". Annotations are accepted but not retained.
+func ParseCedarSchema(schemaBytes []byte) (*Namespaces, error) {
+	tokens, err := lexCedarSchema(string(schemaBytes))
+	if err != nil {
+		return nil, err
+	}
+	p := schemaParser{tokens: tokens, namespaces: Namespaces{}}
+	for p.peek().kind != tokenEOF {
+		p.skipAnnotations()
+		if p.isKeyword("namespace") {
+			p.next()
+			ns, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect("{"); err != nil {
+				return nil, err
+			}
+			p.schema(ns)
+			for !p.isPunct("}") {
+				if err = p.parseDecl(ns); err != nil {
+					return nil, err
+				}
+			}
+			p.next()
+			continue
+		}
+		if err = p.parseDecl(""); err != nil {
+			return nil, err
+		}
+	}
+	p.resolveTypes()
+	return &p.namespaces, nil
+}
+
+// ParseCedarJsonSchema parses a schema in Cedar JSON schema format (e.g. the schema of an AVP policy store). Unlike a
+// policy information model, Cedar treats a record attribute without "required" as required.
+func ParseCedarJsonSchema(schemaBytes []byte) (*Namespaces, error) {
+	var schema interface{}
+	if err := json.Unmarshal(schemaBytes, &schema); err != nil {
+		return nil, err
+	}
+	requireByDefault(schema)
+	requiredBytes, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchemaFile(requiredBytes)
+}
+
+// requireByDefault sets "required": true on the record attributes of a JSON schema that do not declare it
+func requireByDefault(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		_, isType := v["type"]
+		for key, field := range v {
+			if attributes, ok := field.(map[string]interface{}); ok && key == "attributes" && isType {
+				for _, attr := range attributes {
+					if attrMap, ok := attr.(map[string]interface{}); ok {
+						if _, declared := attrMap["required"]; !declared {
+							attrMap["required"] = true
+						}
+					}
+				}
+			}
+			requireByDefault(field)
+		}
+	case []interface{}:
+		for _, item := range v {
+			requireByDefault(item)
+		}
+	}
+}
+
+func (p *schemaParser) peek() schemaToken {
+	return p.tokens[p.pos]
+}
+
+func (p *schemaParser) peekAt(offset int) schemaToken {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *schemaParser) next() schemaToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *schemaParser) isPunct(punct string) bool {
+	tok := p.peek()
+	return tok.kind == tokenPunct && tok.text == punct
+}
+
+func (p *schemaParser) isKeyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokenIdent && tok.text == word
+}
+
+func (p *schemaParser) errorf(tok schemaToken, format string, args ...interface{}) error {
+	return fmt.Errorf("cedar schema line %d: %s", tok.line, fmt.Sprintf(format, args...))
+}
+
+func (p *schemaParser) expect(punct string) error {
+	tok := p.next()
+	if tok.kind != tokenPunct || tok.text != punct {
+		return p.errorf(tok, "expected '%s' but found %s", punct, tok.String())
+	}
+	return nil
+}
+
+func (p *schemaParser) consume(punct string) bool {
+	if p.isPunct(punct) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *schemaParser) schema(ns string) SchemaType {
+	schema, ok := p.namespaces[ns]
+	if !ok {
+		schema = SchemaType{
+			EntityTypes: map[string]EntityType{},
+			Actions:     map[string]ActionType{},
+			CommonTypes: map[string]ContextType{},
+		}
+		p.namespaces[ns] = schema
+	}
+	return schema
+}
+
+// skipAnnotations skips annotations such as `@doc("text")`
+func (p *schemaParser) skipAnnotations() {
+	for p.isPunct("@") {
+		p.next()
+		p.next()
+		if p.consume("(") {
+			for !p.isPunct(")") && p.peek().kind != tokenEOF {
+				p.next()
+			}
+			p.next()
+		}
+	}
+}
+
+func (p *schemaParser) parseIdent() (string, error) {
+	tok := p.next()
+	if tok.kind != tokenIdent {
+		return "", p.errorf(tok, "expected identifier but found %s", tok.String())
+	}
+	return tok.text, nil
+}
+
+// parseName parses an IDENT or STR
+func (p *schemaParser) parseName() (string, error) {
+	tok := p.next()
+	if tok.kind != tokenIdent && tok.kind != tokenString {
+		return "", p.errorf(tok, "expected name but found %s", tok.String())
+	}
+	return tok.text, nil
+}
+
+// parsePath parses IDENT { '::' IDENT }
+func (p *schemaParser) parsePath() (string, error) {
+	path, err := p.parseIdent()
+	if err != nil {
+		return "", err
+	}
+	for p.isPunct("::") && p.peekAt(1).kind == tokenIdent {
+		p.next()
+		path = path + "::" + p.next().text
+	}
+	return path, nil
+}
+
+func (p *schemaParser) parseDecl(ns string) error {
+	p.skipAnnotations()
+	tok := p.next()
+	if tok.kind == tokenIdent {
+		switch tok.text {
+		case "entity":
+			return p.parseEntity(ns)
+		case "action":
+			return p.parseAction(ns)
+		case "type":
+			return p.parseTypeDecl(ns)
+		}
+	}
+	return p.errorf(tok, "expected entity, action or type declaration but found %s", tok.String())
+}
+
+// parseEntity parses: 'entity' Idents ['in' EntOrTyps] [['='] RecType] ';'
+func (p *schemaParser) parseEntity(ns string) error {
+	var names []string
+	for {
+		name, err := p.parseIdent()
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		if !p.consume(",") {
+			break
+		}
+	}
+
+	var memberOf []string
+	var err error
+	if p.isKeyword("in") {
+		p.next()
+		if memberOf, err = p.parseEntOrTyps(); err != nil {
+			return err
+		}
+	}
+	if p.isKeyword("enum") || p.isKeyword("tags") {
+		return p.errorf(p.peek(), "entity %s is not supported", p.peek().text)
+	}
+
+	attributes := map[string]AttrType{}
+	p.consume("=")
+	if p.isPunct("{") {
+		if attributes, err = p.parseRecord(); err != nil {
+			return err
+		}
+	}
+	if p.isKeyword("tags") {
+		return p.errorf(p.peek(), "entity tags are not supported")
+	}
+	if err = p.expect(";"); err != nil {
+		return err
+	}
+
+	schema := p.schema(ns)
+	for _, name := range names {
+		if _, exists := schema.EntityTypes[name]; exists {
+			return fmt.Errorf("cedar schema: duplicate entity type %s", name)
+		}
+		schema.EntityTypes[name] = EntityType{
+			MemberOfTypes: memberOf,
+			Shape:         ShapeTypes{Type: TypeRecord, Attributes: attributes},
+		}
+	}
+	return nil
+}
+
+// parseEntOrTyps parses: Path | '[' [ Path { ',' Path } ] ']'
+func (p *schemaParser) parseEntOrTyps() ([]string, error) {
+	if !p.consume("[") {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	}
+	paths := []string{}
+	for !p.isPunct("]") {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		if !p.consume(",") {
+			break
+		}
+	}
+	return paths, p.expect("]")
+}
+
+// parseAction parses: 'action' Names ['in' RefOrRefs] [AppliesTo] ';'
+func (p *schemaParser) parseAction(ns string) error {
+	var names []string
+	for {
+		name, err := p.parseName()
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		if !p.consume(",") {
+			break
+		}
+	}
+
+	action := ActionType{}
+	if p.isKeyword("in") {
+		p.next()
+		if p.consume("[") {
+			action.MemberOf = []string{}
+			for !p.isPunct("]") {
+				ref, err := p.parseRef()
+				if err != nil {
+					return err
+				}
+				action.MemberOf = append(action.MemberOf, ref)
+				if !p.consume(",") {
+					break
+				}
+			}
+			if err := p.expect("]"); err != nil {
+				return err
+			}
+		} else {
+			ref, err := p.parseRef()
+			if err != nil {
+				return err
+			}
+			action.MemberOf = []string{ref}
+		}
+	}
+
+	if p.isKeyword("appliesTo") {
+		p.next()
+		appliesTo, err := p.parseAppliesTo()
+		if err != nil {
+			return err
+		}
+		action.AppliesTo = *appliesTo
+	}
+	if err := p.expect(";"); err != nil {
+		return err
+	}
+
+	schema := p.schema(ns)
+	for _, name := range names {
+		if _, exists := schema.Actions[name]; exists {
+			return fmt.Errorf("cedar schema: duplicate action %s", name)
+		}
+		schema.Actions[name] = action
+	}
+	return nil
+}
+
+// parseRef parses an action reference: Name | Path '::' STR. Qualified references are returned in Cedar form (e.g. `PhotoApp::Action::"read"`).
+func (p *schemaParser) parseRef() (string, error) {
+	if p.peek().kind == tokenString {
+		return p.next().text, nil
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return "", err
+	}
+	if p.isPunct("::") && p.peekAt(1).kind == tokenString {
+		p.next()
+		return path + "::" + quoteCedarString(p.next().text), nil
+	}
+	return path, nil
+}
+
+// parseAppliesTo parses: 'appliesTo' '{' AppDecls '}'
+func (p *schemaParser) parseAppliesTo() (*AppliesType, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	appliesTo := AppliesType{}
+	for !p.isPunct("}") {
+		tok := p.next()
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		switch tok.text {
+		case "principal":
+			types, err := p.parseEntOrTyps()
+			if err != nil {
+				return nil, err
+			}
+			principalTypes := PrincipalTypes(types)
+			appliesTo.PrincipalTypes = &principalTypes
+		case "resource":
+			types, err := p.parseEntOrTyps()
+			if err != nil {
+				return nil, err
+			}
+			resourceTypes := ResourceTypes(types)
+			appliesTo.ResourceTypes = &resourceTypes
+		case "context":
+			if p.isPunct("{") {
+				attributes, err := p.parseRecord()
+				if err != nil {
+					return nil, err
+				}
+				appliesTo.Context = &ContextType{Type: TypeRecord, Attributes: attributes}
+			} else {
+				path, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				appliesTo.Context = &ContextType{Type: path}
+			}
+		default:
+			return nil, p.errorf(tok, "expected principal, resource or context but found %s", tok.String())
+		}
+		if !p.consume(",") {
+			break
+		}
+	}
+	return &appliesTo, p.expect("}")
+}
+
+// parseTypeDecl parses: 'type' IDENT '=' Type ';'
+func (p *schemaParser) parseTypeDecl(ns string) error {
+	name, err := p.parseIdent()
+	if err != nil {
+		return err
+	}
+	if err = p.expect("="); err != nil {
+		return err
+	}
+	attrType, err := p.parseType()
+	if err != nil {
+		return err
+	}
+	if err = p.expect(";"); err != nil {
+		return err
+	}
+	schema := p.schema(ns)
+	if _, exists := schema.CommonTypes[name]; exists {
+		return fmt.Errorf("cedar schema: duplicate common type %s", name)
+	}
+	schema.CommonTypes[name] = ContextType{Type: attrType.Type, Attributes: attrType.Attributes, SetType: attrType.SetType}
+	return nil
+}
+
+// parseType parses: Path | 'Set' '<' Type '>' | RecType. Paths are resolved once all declarations are known.
+func (p *schemaParser) parseType() (*AttrType, error) {
+	if p.isPunct("{") {
+		attributes, err := p.parseRecord()
+		if err != nil {
+			return nil, err
+		}
+		return &AttrType{Type: TypeRecord, RecordType: RecordType{Attributes: attributes}}, nil
+	}
+	if p.isKeyword(TypeSet) && p.peekAt(1).kind == tokenPunct && p.peekAt(1).text == "<" {
+		p.next()
+		p.next()
+		element, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		return &AttrType{Type: TypeSet, SetType: SetType{Element: element}}, p.expect(">")
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return &AttrType{Type: path}, nil
+}
+
+// parseRecord parses: '{' [ Name ['?'] ':' Type { ',' Name ['?'] ':' Type } ] '}'. As with Cedar, an attribute is required
+// unless it is marked optional with '?'.
+func (p *schemaParser) parseRecord() (map[string]AttrType, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	attributes := map[string]AttrType{}
+	for !p.isPunct("}") {
+		p.skipAnnotations()
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		optional := p.consume("?")
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		attrType, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		attrType.Required = !optional
+		attributes[name] = *attrType
+		if !p.consume(",") {
+			break
+		}
+	}
+	return attributes, p.expect("}")
+}
+
+func (p *schemaParser) resolveTypes() {
+	for ns, schema := range p.namespaces {
+		// A common type that refers to another type by name keeps the name, as ContextType cannot hold an entity reference
+		for name, commonType := range schema.CommonTypes {
+			for attrName, attr := range commonType.Attributes {
+				commonType.Attributes[attrName] = p.resolveType(ns, attr)
+			}
+			if commonType.Element != nil {
+				element := p.resolveType(ns, *commonType.Element)
+				commonType.Element = &element
+				schema.CommonTypes[name] = commonType
+			}
+		}
+		for _, entity := range schema.EntityTypes {
+			for name, attr := range entity.Shape.Attributes {
+				entity.Shape.Attributes[name] = p.resolveType(ns, attr)
+			}
+		}
+		for _, action := range schema.Actions {
+			if action.AppliesTo.Context != nil {
+				for name, attr := range action.AppliesTo.Context.Attributes {
+					action.AppliesTo.Context.Attributes[name] = p.resolveType(ns, attr)
+				}
+			}
+		}
+	}
+}
+
+// lookup returns the schema and local name for a possibly qualified name (e.g. PhotoApp::User)
+func (p *schemaParser) lookup(ns string, name string) (SchemaType, string) {
+	if index := strings.LastIndex(name, "::"); index > 0 {
+		return p.namespaces[name[0:index]], name[index+2:]
+	}
+	return p.namespaces[ns], name
+}
+
+// resolveType determines whether a type name refers to a common type, entity type, primitive or extension type. As with
+// Cedar, common types take precedence over entity types, which take precedence over built-in types.
+func (p *schemaParser) resolveType(ns string, attr AttrType) AttrType {
+	switch attr.Type {
+	case TypeRecord:
+		for name, sub := range attr.Attributes {
+			attr.Attributes[name] = p.resolveType(ns, sub)
+		}
+		return attr
+	case TypeSet:
+		if attr.Element != nil {
+			element := p.resolveType(ns, *attr.Element)
+			attr.Element = &element
+		}
+		return attr
+	case TypeEntity, TypeExtension:
+		return attr
+	}
+
+	schema, local := p.lookup(ns, attr.Type)
+	if _, ok := schema.CommonTypes[local]; ok {
+		return attr
+	}
+	if _, ok := p.namespaces[""].CommonTypes[attr.Type]; ok {
+		return attr
+	}
+	if _, ok := schema.EntityTypes[local]; ok {
+		return AttrType{Type: TypeEntity, Name: attr.Type, Required: attr.Required}
+	}
+	if _, ok := p.namespaces[""].EntityTypes[attr.Type]; ok {
+		return AttrType{Type: TypeEntity, Name: attr.Type, Required: attr.Required}
+	}
+
+	builtIn := strings.TrimPrefix(attr.Type, cedarBuiltInPrefix)
+	switch builtIn {
+	case TypeLong, TypeString, TypeDate, TypeNumeric:
+		return AttrType{Type: builtIn, Required: attr.Required}
+	case TypeBool, TypeBoolean:
+		return AttrType{Type: TypeBoolean, Required: attr.Required}
+	}
+	for _, extension := range cedarExtensionTypes {
+		if builtIn == extension {
+			return AttrType{Type: TypeExtension, Name: extension, Required: attr.Required}
+		}
+	}
+	// An undeclared type is assumed to be an entity type defined elsewhere
+	return AttrType{Type: TypeEntity, Name: attr.Type, Required: attr.Required}
+}
+
+// FormatCedarSchema returns the namespaces in Cedar human-readable schema format. Declarations are sorted by name so that
+// the output is stable.
+func FormatCedarSchema(namespaces Namespaces) (string, error) {
+	nsNames := make([]string, 0, len(namespaces))
+	for name := range namespaces {
+		nsNames = append(nsNames, name)
+	}
+	sort.Strings(nsNames)
+
+	sb := strings.Builder{}
+	for i, ns := range nsNames {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		indent := ""
+		if ns != "" {
+			sb.WriteString(fmt.Sprintf("namespace %s {\n", ns))
+			indent = "    "
+		}
+		if err := formatSchemaDecls(&sb, namespaces[ns], indent); err != nil {
+			return "", fmt.Errorf("namespace %s: %w", ns, err)
+		}
+		if ns != "" {
+			sb.WriteString("}\n")
+		}
+	}
+	return sb.String(), nil
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatSchemaDecls(sb *strings.Builder, schema SchemaType, indent string) error {
+	section := false
+	startSection := func(size int) {
+		if size > 0 && section {
+			sb.WriteString("\n")
+		}
+		if size > 0 {
+			section = true
+		}
+	}
+
+	startSection(len(schema.CommonTypes))
+	for _, name := range sortedKeys(schema.CommonTypes) {
+		commonType := schema.CommonTypes[name]
+		declType := commonType.Type
+		if declType == "" {
+			declType = TypeRecord
+		}
+		typeString, err := formatType(AttrType{Type: declType, SetType: commonType.SetType, RecordType: RecordType{Attributes: commonType.Attributes}}, indent)
+		if err != nil {
+			return fmt.Errorf("common type %s: %w", name, err)
+		}
+		sb.WriteString(fmt.Sprintf("%stype %s = %s;\n", indent, name, typeString))
+	}
+
+	startSection(len(schema.EntityTypes))
+	for _, name := range sortedKeys(schema.EntityTypes) {
+		entity := schema.EntityTypes[name]
+		sb.WriteString(indent + "entity " + name)
+		if len(entity.MemberOfTypes) > 0 {
+			sb.WriteString(" in [" + strings.Join(entity.MemberOfTypes, ", ") + "]")
+		}
+		if len(entity.Shape.Attributes) > 0 {
+			record, err := formatRecord(entity.Shape.Attributes, indent)
+			if err != nil {
+				return fmt.Errorf("entity %s: %w", name, err)
+			}
+			sb.WriteString(" = " + record)
+		}
+		sb.WriteString(";\n")
+	}
+
+	startSection(len(schema.Actions))
+	for _, name := range sortedKeys(schema.Actions) {
+		action := schema.Actions[name]
+		sb.WriteString(indent + "action " + quoteCedarString(name))
+		if len(action.MemberOf) > 0 {
+			refs := make([]string, len(action.MemberOf))
+			for i, ref := range action.MemberOf {
+				refs[i] = formatActionRef(ref)
+			}
+			sb.WriteString(" in [" + strings.Join(refs, ", ") + "]")
+		}
+		appliesTo, err := formatAppliesTo(action.AppliesTo, indent)
+		if err != nil {
+			return fmt.Errorf("action %s: %w", name, err)
+		}
+		sb.WriteString(appliesTo + ";\n")
+	}
+	return nil
+}
+
+func formatAppliesTo(appliesTo AppliesType, indent string) (string, error) {
+	var decls []string
+	inner := indent + "    "
+	if appliesTo.PrincipalTypes != nil {
+		decls = append(decls, inner+"principal: ["+strings.Join(*appliesTo.PrincipalTypes, ", ")+"]")
+	}
+	if appliesTo.ResourceTypes != nil {
+		decls = append(decls, inner+"resource: ["+strings.Join(*appliesTo.ResourceTypes, ", ")+"]")
+	}
+	if appliesTo.Context != nil {
+		context := appliesTo.Context
+		if context.Type == TypeRecord || context.Type == "" {
+			record, err := formatRecord(context.Attributes, inner)
+			if err != nil {
+				return "", fmt.Errorf("context: %w", err)
+			}
+			decls = append(decls, inner+"context: "+record)
+		} else {
+			decls = append(decls, inner+"context: "+context.Type)
+		}
+	}
+	if len(decls) == 0 {
+		return "", nil
+	}
+	return " appliesTo {\n" + strings.Join(decls, ",\n") + "\n" + indent + "}", nil
+}
+
+func formatRecord(attributes map[string]AttrType, indent string) (string, error) {
+	if len(attributes) == 0 {
+		return "{}", nil
+	}
+	inner := indent + "    "
+	decls := make([]string, 0, len(attributes))
+	for _, name := range sortedKeys(attributes) {
+		attr := attributes[name]
+		typeString, err := formatType(attr, inner)
+		if err != nil {
+			return "", fmt.Errorf("attribute %s: %w", name, err)
+		}
+		optional := ""
+		if !attr.Required {
+			optional = "?"
+		}
+		decls = append(decls, fmt.Sprintf("%s%s%s: %s", inner, formatName(name), optional, typeString))
+	}
+	return "{\n" + strings.Join(decls, ",\n") + "\n" + indent + "}", nil
+}
+
+func formatType(attr AttrType, indent string) (string, error) {
+	switch attr.Type {
+	case TypeRecord:
+		return formatRecord(attr.Attributes, indent)
+	case TypeSet:
+		if attr.Element == nil {
+			return "", errors.New("set type is missing an element type")
+		}
+		element, err := formatType(*attr.Element, indent)
+		if err != nil {
+			return "", err
+		}
+		return "Set<" + element + ">", nil
+	case TypeEntity, TypeExtension, "EntityOrCommon":
+		if attr.Name == "" {
+			return "", fmt.Errorf("%s type is missing a name", attr.Type)
+		}
+		return attr.Name, nil
+	case TypeBool, TypeBoolean:
+		return TypeBool, nil
+	case "":
+		return "", errors.New("missing type")
+	}
+	return attr.Type, nil
+}
+
+func formatName(name string) string {
+	if identRegex.MatchString(name) {
+		return name
+	}
+	return quoteCedarString(name)
+}
+
+// formatActionRef returns a reference to an action group. Qualified references (e.g. `PhotoApp::Action::"read"`) are returned as is.
+func formatActionRef(ref string) string {
+	if strings.Contains(ref, "::") {
+		return ref
+	}
+	return quoteCedarString(ref)
+}
+
+func quoteCedarString(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t", "\r", "\\r")
+	return "\"" + replacer.Replace(value) + "\""
+}
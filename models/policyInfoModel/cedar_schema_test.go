@@ -0,0 +1,189 @@
+package policyInfoModel
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readTestFile(t *testing.T, name string) []byte {
+	_, file, _, _ := runtime.Caller(0)
+	fileBytes, err := os.ReadFile(filepath.Join(file, "../test", name))
+	assert.NoError(t, err)
+	return fileBytes
+}
+
+func TestParseCedarSchema(t *testing.T) {
+	namespaces, err := ParseCedarSchema(readTestFile(t, "documentSchema.cedarschema"))
+	assert.NoError(t, err)
+	assert.NotNil(t, namespaces)
+
+	schemas := *namespaces
+	assert.Len(t, schemas, 2)
+
+	global := schemas[""]
+	address := global.CommonTypes["Address"]
+	assert.Equal(t, TypeRecord, address.Type)
+	assert.True(t, address.Attributes["street"].Required)
+	assert.False(t, address.Attributes["postal code"].Required)
+
+	app, ok := schemas["DocApp"]
+	assert.True(t, ok, "Expected DocApp schema")
+
+	tags := app.CommonTypes["Tags"]
+	assert.Equal(t, TypeSet, tags.Type)
+	assert.Equal(t, TypeString, tags.Element.Type)
+
+	context := app.CommonTypes["RequestContext"]
+	assert.Equal(t, AttrType{Type: TypeExtension, Name: "ipaddr", Required: true}, context.Attributes["ip"])
+	assert.Equal(t, TypeBoolean, context.Attributes["authenticated"].Type)
+	assert.Equal(t, "decimal", context.Attributes["riskScore"].Name)
+	assert.Equal(t, "datetime", context.Attributes["requestTime"].Name)
+
+	assert.Equal(t, []string{"Group"}, app.EntityTypes["Team"].MemberOfTypes)
+	assert.Empty(t, app.EntityTypes["Folder"].Shape.Attributes)
+	assert.Contains(t, app.EntityTypes, "Drive")
+
+	user := app.EntityTypes["User"]
+	assert.Equal(t, []string{"Team", "Group"}, user.MemberOfTypes)
+	assert.Equal(t, TypeRecord, user.Shape.Type)
+	assert.Equal(t, TypeLong, user.Shape.Attributes["level"].Type)
+	assert.Equal(t, AttrType{Type: TypeEntity, Name: "User"}, user.Shape.Attributes["manager"], "optional attribute")
+	assert.Equal(t, "Address", user.Shape.Attributes["address"].Type, "common type reference")
+	assert.Equal(t, "Tags", user.Shape.Attributes["tags"].Type, "common type reference")
+	assert.Equal(t, AttrType{Type: TypeEntity, Name: "Group"}, *user.Shape.Attributes["roles"].Element)
+	assert.Equal(t, TypeString, user.Shape.Attributes["profile"].Attributes["displayName"].Type)
+
+	document := app.EntityTypes["Document"]
+	assert.Equal(t, TypeEntity, document.Shape.Attributes["editors"].Element.Type)
+
+	assert.Nil(t, app.Actions["readActions"].MemberOf)
+	assert.Nil(t, app.Actions["readActions"].AppliesTo.PrincipalTypes)
+	assert.Equal(t, []string{"readActions"}, app.Actions["writeActions"].MemberOf)
+
+	view := app.Actions["view"]
+	assert.Equal(t, PrincipalTypes{"User", "Group"}, *view.AppliesTo.PrincipalTypes)
+	assert.Equal(t, ResourceTypes{"Document"}, *view.AppliesTo.ResourceTypes)
+	assert.Equal(t, "RequestContext", view.AppliesTo.Context.Type)
+	assert.Equal(t, view, app.Actions["download"])
+
+	edit := app.Actions["edit document"]
+	assert.Equal(t, []string{"writeActions"}, edit.MemberOf)
+	assert.Equal(t, TypeRecord, edit.AppliesTo.Context.Type)
+	assert.False(t, edit.AppliesTo.Context.Attributes["reason"].Required)
+	assert.Equal(t, TypeBoolean, edit.AppliesTo.Context.Attributes["approved"].Type)
+
+	share := app.Actions["share"]
+	assert.Equal(t, []string{"writeActions", `DocApp::Action::"readActions"`}, share.MemberOf)
+	assert.Nil(t, share.AppliesTo.Context)
+
+	// Attribute lookup works the same as for JSON models
+	userType := app.EntityTypes["User"].FindAttrType("profile.displayName", app)
+	assert.NotNil(t, userType)
+	assert.Equal(t, TypeString, userType.Type)
+}
+
+func TestCedarSchemaRoundTrip(t *testing.T) {
+	namespaces, err := ParseCedarSchema(readTestFile(t, "documentSchema.cedarschema"))
+	assert.NoError(t, err)
+
+	schemaString, err := FormatCedarSchema(*namespaces)
+	assert.NoError(t, err)
+	assert.Contains(t, schemaString, "type Address = {\n    city: String,\n    \"postal code\"?: String,\n    street: String\n};")
+	assert.Contains(t, schemaString, "namespace DocApp {\n    type RequestContext = {")
+	assert.Contains(t, schemaString, "        requestTime?: datetime")
+	assert.Contains(t, schemaString, "    entity User in [Team, Group] = {")
+	assert.Contains(t, schemaString, "    action \"share\" in [\"writeActions\", DocApp::Action::\"readActions\"] appliesTo {\n        principal: [User],\n        resource: [Document, Folder]\n    };")
+
+	reparsed, err := ParseCedarSchema([]byte(schemaString))
+	assert.NoError(t, err)
+	assert.Equal(t, *namespaces, *reparsed)
+}
+
+func TestCedarSchemaFromJson(t *testing.T) {
+	for _, name := range []string{"photoSchema.json", "cmvSchemaTest.json", "healthSchema.json"} {
+		t.Run(name, func(t *testing.T) {
+			namespaces, err := ParseSchemaFile(readTestFile(t, name))
+			assert.NoError(t, err)
+
+			schemaString, err := FormatCedarSchema(*namespaces)
+			assert.NoError(t, err)
+
+			reparsed, err := ParseCedarSchema([]byte(schemaString))
+			assert.NoError(t, err)
+			second, err := FormatCedarSchema(*reparsed)
+			assert.NoError(t, err)
+			assert.Equal(t, schemaString, second)
+		})
+	}
+
+	namespaces, err := ParseSchemaFile(readTestFile(t, "photoSchema.json"))
+	assert.NoError(t, err)
+	schemaString, err := FormatCedarSchema(*namespaces)
+	assert.NoError(t, err)
+	assert.Contains(t, schemaString, "entity Photo in [Album, Account] = {\n        account: Account,\n        private: Bool\n    };")
+	assert.Contains(t, schemaString, "        ip?: ipaddr")
+	assert.Contains(t, schemaString, "        personInformation?: PersonType,")
+	assert.Contains(t, schemaString, "context: ContextType")
+
+	// Attributes without "required": true are optional in the human-readable format
+	reparsed, err := ParseCedarSchema([]byte(schemaString))
+	assert.NoError(t, err)
+	photo := (*reparsed)["PhotoApp"].EntityTypes["Photo"]
+	assert.Equal(t, AttrType{Type: TypeEntity, Name: "Account", Required: true}, photo.Shape.Attributes["account"])
+	assert.True(t, photo.Shape.Attributes["private"].Required)
+	assert.Equal(t, (*namespaces)["PhotoApp"].Actions, (*reparsed)["PhotoApp"].Actions)
+}
+
+func TestParseCedarJsonSchema(t *testing.T) {
+	schema := `{"App": {"entityTypes": {"User": {"shape": {"type": "Record", "attributes": {
+      "name": {"type": "String"},
+      "nickname": {"type": "String", "required": false},
+      "address": {"type": "Record", "attributes": {"street": {"type": "String"}}}}}}}}}`
+	namespaces, err := ParseCedarJsonSchema([]byte(schema))
+	assert.NoError(t, err)
+	attributes := (*namespaces)["App"].EntityTypes["User"].Shape.Attributes
+	assert.True(t, attributes["name"].Required)
+	assert.False(t, attributes["nickname"].Required)
+	assert.True(t, attributes["address"].Attributes["street"].Required)
+
+	// A policy information model keeps its own default
+	model, err := ParseSchemaFile([]byte(schema))
+	assert.NoError(t, err)
+	assert.False(t, (*model)["App"].EntityTypes["User"].Shape.Attributes["name"].Required)
+
+	_, err = ParseCedarJsonSchema([]byte("{"))
+	assert.Error(t, err)
+}
+
+func TestCedarSchemaErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{"Unterminated string", `action "view;`},
+		{"Bad character", `entity User = { age: Long } $`},
+		{"Missing semicolon", `entity User entity Group;`},
+		{"Unknown declaration", `resource Photo;`},
+		{"Duplicate entity", `entity User; entity User;`},
+		{"Duplicate action", `action view; action view;`},
+		{"Bad appliesTo", `action view appliesTo { subject: User };`},
+		{"Unclosed namespace", `namespace App { entity User;`},
+		{"Entity tags", `entity User tags String;`},
+		{"Enum entity", `entity Color enum ["red", "green"];`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCedarSchema([]byte(tt.schema))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := FormatCedarSchema(Namespaces{"App": SchemaType{
+		CommonTypes: map[string]ContextType{"Bad": {Type: TypeSet}},
+	}})
+	assert.Error(t, err, "set without element")
+}
@@ -14,11 +14,13 @@ const (
 	TypeRecord    string = "Record"
 	TypeSet       string = "Set"
 	TypeBool      string = "Bool"
+	TypeBoolean   string = "Boolean"
 	TypeString    string = "String"
 	TypeDate      string = "Date"
 	TypeNumeric   string = "Numeric"
 	TypeLong      string = "Long"
 	TypeExtension string = "Extension"
+	TypeEntity    string = "Entity"
 )
 
 type hasAttributes interface {
@@ -26,7 +28,7 @@ type hasAttributes interface {
 }
 
 type SetType struct {
-	Element *AttrType `json:"element"`
+	Element *AttrType `json:"element,omitempty"`
 }
 
 type AttrType struct {
@@ -38,7 +40,7 @@ type AttrType struct {
 }
 
 type RecordType struct {
-	Attributes map[string]AttrType `json:"attributes"`
+	Attributes map[string]AttrType `json:"attributes,omitempty"`
 }
 
 func (h AttrType) FindAttrTypes(path string, schema SchemaType) *AttrType {
@@ -59,9 +61,12 @@ func (h AttrType) FindAttrTypes(path string, schema SchemaType) *AttrType {
 	return nil
 }
 
+// ContextType is a record type. When used as a common type it may also be a Set (with Element) or a reference to another
+// type by name.
 type ContextType struct {
 	Type       string              `json:"type"` // fixed as "RecordType"
 	Attributes map[string]AttrType `json:"attributes"`
+	SetType
 }
 
 func (c ContextType) FindAttrTypes(path string, schema SchemaType) *AttrType {
@@ -108,7 +113,7 @@ func doFindAttr(attributes map[string]AttrType, path string, schema SchemaType)
 			}
 		}
 		switch attrType.Type {
-		case TypeString, TypeBool, TypeDate, TypeNumeric, TypeLong, TypeExtension, TypeRecord, TypeSet:
+		case TypeString, TypeBool, TypeBoolean, TypeDate, TypeNumeric, TypeLong, TypeExtension, TypeEntity, TypeRecord, TypeSet:
 			continue
 		default:
 			// This is a custom type - lookup under "commonTypes"
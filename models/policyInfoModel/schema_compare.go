@@ -0,0 +1,164 @@
+package policyInfoModel
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Schema difference types
+const (
+	SchemaDifAdded   string = "ADDED"   // the element is only in the compared schema
+	SchemaDifRemoved string = "REMOVED" // the element is only in the current schema
+	SchemaDifChanged string = "CHANGED"
+)
+
+// Schema element kinds
+const (
+	ElementNamespace  string = "namespace"
+	ElementEntityType string = "entityType"
+	ElementAction     string = "action"
+	ElementCommonType string = "commonType"
+)
+
+// SchemaDifference describes an element that differs between two policy models
+type SchemaDifference struct {
+	Type      string   `json:"type"`
+	Namespace string   `json:"namespace"`
+	Element   string   `json:"element"`
+	Name      string   `json:"name,omitempty"`
+	Details   []string `json:"details,omitempty"` // the fields of a changed element that differ (e.g. "shape.attributes.age added")
+}
+
+func (d SchemaDifference) String() string {
+	name := d.Namespace
+	if d.Element != ElementNamespace {
+		name = fmt.Sprintf("%s %s %s", d.Namespace, d.Element, d.Name)
+	}
+	if len(d.Details) == 0 {
+		return fmt.Sprintf("%s %s", d.Type, name)
+	}
+	return fmt.Sprintf("%s %s: %s", d.Type, name, strings.Join(d.Details, ", "))
+}
+
+/*
+CompareNamespaces returns the differences between the current model (e.g. the schema of a policy store) and the
+compare model (e.g. a locally loaded model). Elements are compared by value, so an empty attribute list is the same as
+one that is absent. Differences are ordered by namespace, element kind, and name.
+*/
+func CompareNamespaces(current Namespaces, compare Namespaces) []SchemaDifference {
+	difs := make([]SchemaDifference, 0)
+	for _, ns := range sortedKeys(unionKeys(current, compare)) {
+		currentSchema, inCurrent := current[ns]
+		compareSchema, inCompare := compare[ns]
+		switch {
+		case !inCurrent:
+			difs = append(difs, SchemaDifference{Type: SchemaDifAdded, Namespace: ns, Element: ElementNamespace})
+			continue
+		case !inCompare:
+			difs = append(difs, SchemaDifference{Type: SchemaDifRemoved, Namespace: ns, Element: ElementNamespace})
+			continue
+		}
+		difs = append(difs, compareElements(ns, ElementEntityType, currentSchema.EntityTypes, compareSchema.EntityTypes)...)
+		difs = append(difs, compareElements(ns, ElementAction, currentSchema.Actions, compareSchema.Actions)...)
+		difs = append(difs, compareElements(ns, ElementCommonType, currentSchema.CommonTypes, compareSchema.CommonTypes)...)
+	}
+	return difs
+}
+
+func compareElements[V any](ns string, element string, current map[string]V, compare map[string]V) []SchemaDifference {
+	difs := make([]SchemaDifference, 0)
+	for _, name := range sortedKeys(unionKeys(current, compare)) {
+		currentValue, inCurrent := current[name]
+		compareValue, inCompare := compare[name]
+		dif := SchemaDifference{Namespace: ns, Element: element, Name: name}
+		switch {
+		case !inCurrent:
+			dif.Type = SchemaDifAdded
+		case !inCompare:
+			dif.Type = SchemaDifRemoved
+		default:
+			dif.Details = compareFields("", canonicalValue(currentValue), canonicalValue(compareValue))
+			if len(dif.Details) == 0 {
+				continue
+			}
+			dif.Type = SchemaDifChanged
+		}
+		difs = append(difs, dif)
+	}
+	return difs
+}
+
+// compareFields returns the fields that differ between two canonical values, descending into objects
+func compareFields(path string, current interface{}, compare interface{}) []string {
+	currentMap, currentIsMap := current.(map[string]interface{})
+	compareMap, compareIsMap := compare.(map[string]interface{})
+	if !currentIsMap || !compareIsMap {
+		if reflect.DeepEqual(current, compare) {
+			return nil
+		}
+		return []string{strings.TrimPrefix(path, ".") + " changed"}
+	}
+
+	var details []string
+	for _, key := range sortedKeys(unionKeys(currentMap, compareMap)) {
+		currentValue, inCurrent := currentMap[key]
+		compareValue, inCompare := compareMap[key]
+		fieldPath := path + "." + key
+		switch {
+		case !inCurrent:
+			details = append(details, strings.TrimPrefix(fieldPath, ".")+" added")
+		case !inCompare:
+			details = append(details, strings.TrimPrefix(fieldPath, ".")+" removed")
+		default:
+			details = append(details, compareFields(fieldPath, currentValue, compareValue)...)
+		}
+	}
+	return details
+}
+
+// canonicalValue returns the JSON form of a schema element without nulls or empty values
+func canonicalValue(value interface{}) interface{} {
+	valueBytes, _ := json.Marshal(value)
+	var canonical interface{}
+	_ = json.Unmarshal(valueBytes, &canonical)
+	return prune(canonical)
+}
+
+func prune(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			field = prune(field)
+			if field == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = field
+		}
+		if len(v) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+	case string:
+		if v == "" {
+			return nil
+		}
+	}
+	return value
+}
+
+func unionKeys[V any](a map[string]V, b map[string]V) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
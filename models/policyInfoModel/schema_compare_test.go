@@ -0,0 +1,59 @@
+package policyInfoModel
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadPhotoSchema(t *testing.T) Namespaces {
+	_, file, _, _ := runtime.Caller(0)
+	fileBytes, err := os.ReadFile(filepath.Join(file, "../test", "photoSchema.json"))
+	assert.NoError(t, err)
+	namespaces, err := ParseSchemaFile(fileBytes)
+	assert.NoError(t, err)
+	return *namespaces
+}
+
+func TestCompareNamespaces(t *testing.T) {
+	current := loadPhotoSchema(t)
+	assert.Empty(t, CompareNamespaces(current, loadPhotoSchema(t)))
+
+	compare := loadPhotoSchema(t)
+	photoApp := compare["PhotoApp"]
+
+	// An empty attribute list is not a difference
+	user := photoApp.EntityTypes["User"]
+	group := photoApp.EntityTypes["UserGroup"]
+	group.Shape.Attributes = nil
+	photoApp.EntityTypes["UserGroup"] = group
+	assert.Empty(t, CompareNamespaces(current, compare))
+
+	user.Shape.Attributes["department"] = AttrType{Type: TypeString}
+	delete(user.Shape.Attributes, "personInformation")
+	user.MemberOfTypes = []string{"UserGroup", "Team"}
+	photoApp.EntityTypes["User"] = user
+	photoApp.EntityTypes["Team"] = EntityType{}
+	delete(photoApp.Actions, "viewPhoto")
+	compare["Other"] = SchemaType{}
+
+	difs := CompareNamespaces(current, compare)
+	assert.Equal(t, []SchemaDifference{
+		{Type: SchemaDifAdded, Namespace: "Other", Element: ElementNamespace},
+		{Type: SchemaDifAdded, Namespace: "PhotoApp", Element: ElementEntityType, Name: "Team"},
+		{Type: SchemaDifChanged, Namespace: "PhotoApp", Element: ElementEntityType, Name: "User", Details: []string{
+			"memberOfTypes changed",
+			"shape.attributes.department added",
+			"shape.attributes.personInformation removed",
+		}},
+		{Type: SchemaDifRemoved, Namespace: "PhotoApp", Element: ElementAction, Name: "viewPhoto"},
+	}, difs)
+	assert.Equal(t, "CHANGED PhotoApp entityType User: memberOfTypes changed, shape.attributes.department added, shape.attributes.personInformation removed", difs[2].String())
+	assert.Equal(t, "ADDED Other", difs[0].String())
+
+	assert.Equal(t, []SchemaDifference{{Type: SchemaDifRemoved, Namespace: "PhotoApp", Element: ElementNamespace}},
+		CompareNamespaces(current, Namespaces{}))
+}
@@ -1,6 +1,9 @@
 package rar
 
 import (
+    "fmt"
+    "strings"
+
     "github.com/hexa-org/policy-mapper/models/rar/functionalsupport"
     "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 
@@ -46,6 +49,47 @@ func CalcResourceActionRolesForUpdate(existing []ResourceActionRoles, policyInfo
     return rarUpdateList
 }
 
+/*
+CalcResourceActionRolesForUpdateReport is CalcResourceActionRolesForUpdate that also returns a MappingReport (whose
+indexes are the positions of policyInfos) recording the elements of each policy that resource action roles cannot hold.
+Conditions are dropped, and actions that are not an http method of an existing resource action are ignored.
+*/
+func CalcResourceActionRolesForUpdateReport(existing []ResourceActionRoles, policyInfos []hexapolicy.PolicyInfo) ([]ResourceActionRoles, *hexapolicy.MappingReport) {
+    existingRarMap := mapResourceActionRoles(existing)
+    report := hexapolicy.NewMappingReport("rar")
+    for i, pol := range policyInfos {
+        report.ExactPolicy(i, pol)
+        if pol.Object == "" {
+            report.Dropped(i, pol, hexapolicy.MapElementPolicy, "policy has no object (resource) so it is ignored")
+            continue
+        }
+        if pol.Condition != nil {
+            report.Dropped(i, pol, hexapolicy.CompareDifCondition, "resource action roles cannot hold conditions; the roles are assigned unconditionally")
+        }
+        mapped := 0
+        for _, act := range pol.Actions {
+            action := strings.TrimSpace(string(act))
+            if action == "" {
+                continue
+            }
+            rarKey := MakeRarKeyForPolicy(action, pol.Object.String())
+            if rarKey == "" {
+                report.Dropped(i, pol, hexapolicy.CompareDifAction, fmt.Sprintf("action %s is not an http method (%s<METHOD>)", action, ActionUriPrefix))
+                continue
+            }
+            if _, found := existingRarMap[rarKey]; !found {
+                report.Dropped(i, pol, hexapolicy.CompareDifAction, fmt.Sprintf("no existing resource action matches %s %s", action, pol.Object))
+                continue
+            }
+            mapped++
+        }
+        if mapped == 0 {
+            report.Dropped(i, pol, hexapolicy.MapElementPolicy, "no action of the policy matches an existing resource action")
+        }
+    }
+    return CalcResourceActionRolesForUpdate(existing, policyInfos), report
+}
+
 // rolesToKeep - removes from existingRoles, those that are not present in newRoles
 // Returns bool, slice
 // false indicates no changes (i.e. when existing == new)
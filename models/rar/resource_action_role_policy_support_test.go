@@ -4,6 +4,7 @@ import (
 	"github.com/hexa-org/policy-mapper/models/rar"
 	"github.com/hexa-org/policy-mapper/models/rar/testsupport/policytestsupport"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
 
 	"testing"
 
@@ -143,3 +144,29 @@ func TestCalcResourceActionRolesForUpdate_RemoveAllRoleAssignments(t *testing.T)
 	assert.Equal(t, policytestsupport.ResourceHrUs, actRars[0].Resource)
 	assert.Equal(t, 0, len(actRars[0].Roles))
 }
+
+func TestCalcResourceActionRolesForUpdateReport(t *testing.T) {
+	existingRars := policytestsupport.MakeRarList(map[string][]string{policytestsupport.ActionGetHrUs: {"some-role-to-remove"}})
+
+	exact := policytestsupport.MakeRoleSubjectTestPolicy(policytestsupport.ResourceHrUs, "http:GET", []string{"some-role-to-add"})
+	conditional := exact
+	conditional.Condition = &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: conditions.AAllow}
+	unknownAction := exact
+	unknownAction.Actions = []hexapolicy.ActionInfo{"http:GET", "http:POST", "read"}
+	unknownResource := policytestsupport.MakeRoleSubjectTestPolicy(policytestsupport.ResourceProfile, "http:GET", []string{"some-role-to-add"})
+
+	rars, report := rar.CalcResourceActionRolesForUpdateReport(existingRars, []hexapolicy.PolicyInfo{exact, conditional, unknownAction, unknownResource})
+	assert.Equal(t, rar.CalcResourceActionRolesForUpdate(existingRars, []hexapolicy.PolicyInfo{exact, conditional, unknownAction, unknownResource}), rars)
+
+	assert.True(t, report.IsLossy())
+	assert.Len(t, report.Policies, 4)
+	for _, element := range report.Policies[0].Elements {
+		assert.Equal(t, hexapolicy.FidelityExact, element.Fidelity)
+	}
+	issues := report.Issues()
+	assert.Len(t, issues, 4)
+	assert.Contains(t, issues[0], "policy 1: CONDITION DROPPED")
+	assert.Contains(t, issues[1], "policy 2: ACTION DROPPED")
+	assert.Contains(t, issues[2], "policy 3: ACTION DROPPED - no existing resource action matches http:GET /profile")
+	assert.Contains(t, issues[3], "policy 3: POLICY DROPPED")
+}
@@ -39,6 +39,90 @@ func (m *MockCognitoHTTPClient) MockListGroupsWithHttpStatus(httpStatus int, gro
 	m.AddRequest(http.MethodPost, CognitoApiUrl, "ListGroups", httpStatus, ListGroupsResponse(groupNames...))
 }
 
+// MockListGroupsPage returns groups with their descriptions. A non-empty nextToken indicates more pages follow.
+func (m *MockCognitoHTTPClient) MockListGroupsPage(nextToken string, groups ...types.GroupType) {
+	output := cognitoidentityprovider.ListGroupsOutput{Groups: groups}
+	if nextToken != "" {
+		output.NextToken = aws.String(nextToken)
+	}
+	resp, _ := json.Marshal(output)
+	m.AddRequest(http.MethodPost, CognitoApiUrl, "ListGroups", http.StatusOK, resp)
+}
+
+func (m *MockCognitoHTTPClient) MockCreateGroup() {
+	m.MockCreateGroupWithHttpStatus(http.StatusOK)
+}
+
+func (m *MockCognitoHTTPClient) MockCreateGroupWithHttpStatus(httpStatus int) {
+	resp, _ := json.Marshal(cognitoidentityprovider.CreateGroupOutput{})
+	m.AddRequest(http.MethodPost, CognitoApiUrl, "CreateGroup", httpStatus, resp)
+}
+
+func (m *MockCognitoHTTPClient) MockUpdateGroup() {
+	m.MockUpdateGroupWithHttpStatus(http.StatusOK)
+}
+
+func (m *MockCognitoHTTPClient) MockUpdateGroupWithHttpStatus(httpStatus int) {
+	resp, _ := json.Marshal(cognitoidentityprovider.UpdateGroupOutput{})
+	m.AddRequest(http.MethodPost, CognitoApiUrl, "UpdateGroup", httpStatus, resp)
+}
+
+func (m *MockCognitoHTTPClient) MockListUserPoolClients(clientIds ...string) {
+	m.MockListUserPoolClientsWithHttpStatus(http.StatusOK, clientIds...)
+}
+
+func (m *MockCognitoHTTPClient) MockListUserPoolClientsWithHttpStatus(httpStatus int, clientIds ...string) {
+	clients := make([]types.UserPoolClientDescription, 0)
+	for _, id := range clientIds {
+		clients = append(clients, types.UserPoolClientDescription{
+			ClientId:   aws.String(id),
+			ClientName: aws.String(id + "-name"),
+			UserPoolId: aws.String(awstestsupport.TestUserPoolId),
+		})
+	}
+	resp, _ := json.Marshal(cognitoidentityprovider.ListUserPoolClientsOutput{UserPoolClients: clients})
+	m.AddRequest(http.MethodPost, CognitoApiUrl, "ListUserPoolClients", httpStatus, resp)
+}
+
+// MockDescribeUserPoolClient returns an app client whose allowed OAuth scopes are scopes
+func (m *MockCognitoHTTPClient) MockDescribeUserPoolClient(clientId string, scopes ...string) {
+	output := cognitoidentityprovider.DescribeUserPoolClientOutput{
+		UserPoolClient: &types.UserPoolClientType{
+			ClientId:           aws.String(clientId),
+			ClientName:         aws.String(clientId + "-name"),
+			UserPoolId:         aws.String(awstestsupport.TestUserPoolId),
+			AllowedOAuthScopes: scopes,
+		},
+	}
+	resp, _ := json.Marshal(output)
+	m.AddRequest(http.MethodPost, CognitoApiUrl, "DescribeUserPoolClient", http.StatusOK, resp)
+}
+
+func (m *MockCognitoHTTPClient) MockDescribeResourceServer(scopeNames ...string) {
+	m.MockDescribeResourceServerWithHttpStatus(http.StatusOK, scopeNames...)
+}
+
+// MockDescribeResourceServerWithHttpStatus returns the test resource server defining scopeNames
+func (m *MockCognitoHTTPClient) MockDescribeResourceServerWithHttpStatus(httpStatus int, scopeNames ...string) {
+	scopes := make([]types.ResourceServerScopeType, 0)
+	for _, name := range scopeNames {
+		scopes = append(scopes, types.ResourceServerScopeType{
+			ScopeName:        aws.String(name),
+			ScopeDescription: aws.String(name + " scope"),
+		})
+	}
+	output := cognitoidentityprovider.DescribeResourceServerOutput{
+		ResourceServer: &types.ResourceServerType{
+			Identifier: aws.String(awstestsupport.TestResourceServerIdentifier),
+			Name:       aws.String(awstestsupport.TestResourceServerName),
+			UserPoolId: aws.String(awstestsupport.TestUserPoolId),
+			Scopes:     scopes,
+		},
+	}
+	resp, _ := json.Marshal(output)
+	m.AddRequest(http.MethodPost, CognitoApiUrl, "DescribeResourceServer", httpStatus, resp)
+}
+
 func (m *MockCognitoHTTPClient) MockListUsersInGroup(userName ...string) {
 	m.MockListUsersInGroupWithHttpStatus(http.StatusOK, userName...)
 }
@@ -76,6 +160,15 @@ func (m *MockCognitoHTTPClient) MockAdminRemoveUserFromGroupWithHttpStatus(httpS
 	m.AddRequest(http.MethodPost, CognitoApiUrl, "AdminRemoveUserFromGroup", httpStatus, removeResp)
 }
 
+// Group returns a group of the test user pool
+func Group(name, description string) types.GroupType {
+	return types.GroupType{
+		GroupName:   aws.String(name),
+		UserPoolId:  aws.String(awstestsupport.TestUserPoolId),
+		Description: aws.String(description),
+	}
+}
+
 func ListGroupsResponse(groupNames ...string) []byte {
 	groups := make([]types.GroupType, 0)
 	for _, name := range groupNames {
@@ -88,72 +88,115 @@ func EnhanceError(err error, data []byte) error {
 	return err
 }
 
+// policyFields holds the raw value of each policy attribute. Attribute names are matched case-insensitively.
+type policyFields struct {
+	Meta      *json.RawMessage `json:"meta"`
+	Subject   *json.RawMessage `json:"subject"` // the pre-0.7 subject form, converted by a Migration
+	Subjects  *json.RawMessage `json:"subjects"`
+	Actions   *json.RawMessage `json:"actions"`
+	Object    *json.RawMessage `json:"object"`
+	Scope     *json.RawMessage `json:"scope"`
+	Condition *json.RawMessage `json:"condition"`
+}
+
 func (p *PolicyInfo) UnmarshalJSON(data []byte) error {
+	return p.unmarshal(data, true)
+}
+
+/*
+unmarshal decodes a policy. Policies from an earlier IDQL version (or in an earlier form) are upgraded using the
+registered migrations (see RegisterMigration). When logUpgrade is true, a warning is logged for upgraded policies.
+*/
+func (p *PolicyInfo) unmarshal(data []byte, logUpgrade bool) error {
 	if data == nil || len(data) == 0 {
 		return nil
 	}
-	var fieldMap map[string]*json.RawMessage
-	if err := json.Unmarshal(data, &fieldMap); err != nil {
+	var fields policyFields
+	if err := json.Unmarshal(data, &fields); err != nil {
 		return err
 	}
 	var meta MetaInfo
+	if v := fields.Meta; v != nil {
+		if err := json.Unmarshal(*v, &meta); err != nil {
+			return EnhanceError(err, *v)
+		}
+	}
+
+	if fields.Subject == nil && (meta.Version == "" || strings.EqualFold(meta.Version, IdqlVersion)) {
+		err := p.decodeFields(fields, meta)
+		if err == nil {
+			if meta.Version != IdqlVersion {
+				if logUpgrade {
+					log.Warn("Auto-upgrading policy to "+IdqlVersion, "PolicyId", meta.PolicyId)
+				}
+				p.Meta.Version = IdqlVersion
+			}
+			return nil
+		}
+		// A policy labelled with the current version may still use an earlier form
+		migrated, migration, migrateErr := migratePolicyJSON(0, data)
+		if migrateErr != nil || migration == nil {
+			return err
+		}
+		data = migrated
+	} else if CompareVersions(meta.Version, IdqlVersion) > 0 {
+		// A policy from a newer IDQL version is read as is
+		log.Warn("Policy version "+meta.Version+" is newer than "+IdqlVersion+" and is not upgraded", "PolicyId", meta.PolicyId)
+		return p.decodeFields(fields, meta)
+	} else {
+		migrated, _, err := migratePolicyJSON(0, data)
+		if err != nil {
+			return err
+		}
+		data = migrated
+	}
+
+	if logUpgrade {
+		log.Warn("Auto-upgrading policy to "+IdqlVersion, "PolicyId", meta.PolicyId)
+	}
+	fields = policyFields{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	meta = MetaInfo{}
+	if v := fields.Meta; v != nil {
+		if err := json.Unmarshal(*v, &meta); err != nil {
+			return EnhanceError(err, *v)
+		}
+	}
+	return p.decodeFields(fields, meta)
+}
+
+// decodeFields decodes the current (IDQL 0.7) form of each policy attribute
+func (p *PolicyInfo) decodeFields(fields policyFields, meta MetaInfo) error {
 	var subjects SubjectInfo
 	var actions []ActionInfo
 	var object ObjectInfo
 	var scope *ScopeInfo
 	var condition *conditions.ConditionInfo
 
-	for k, v := range fieldMap {
-		var err error
-		switch k {
-		case "Meta", "meta":
-			err = json.Unmarshal(*v, &meta)
-			if !strings.EqualFold(meta.Version, IdqlVersion) {
-				log.Warn("Auto-upgrading policy to "+IdqlVersion, "PolicyId", meta.PolicyId)
-				meta.Version = IdqlVersion
-			}
-		case "Subjects", "subjects":
-
-			err = json.Unmarshal(*v, &subjects)
-		case "Subject", "subject":
-			var oldSub OldSubjectInfo
-			err = json.Unmarshal(*v, &oldSub)
-			if err == nil {
-				subjects = oldSub.Members
-			}
-		case "Actions", "actions":
-			if v == nil {
-				continue // if null passed to "actions"
-			}
-			err = json.Unmarshal(*v, &actions)
-			if err != nil {
-				// try old action format
-				var oldAction []OldActionInfo
-				err = json.Unmarshal(*v, &oldAction)
-				if err == nil {
-					var items []ActionInfo
-					for _, v := range oldAction {
-						items = append(items, ActionInfo(v.ActionUri))
-					}
-					actions = items
-				}
-			}
-		case "Object", "object":
-			err = json.Unmarshal(*v, &object)
-			if err != nil {
-				// try old object
-				var oldObject OldObjectInfo
-				err = json.Unmarshal(*v, &oldObject)
-				if err == nil {
-					object = ObjectInfo(oldObject.ResourceID)
-				}
-			}
-		case "Scope", "scope":
-			err = json.Unmarshal(*v, &scope)
-		case "Condition", "condition":
-			err = json.Unmarshal(*v, &condition)
+	if v := fields.Subjects; v != nil {
+		if err := json.Unmarshal(*v, &subjects); err != nil {
+			return EnhanceError(err, *v)
 		}
-		if err != nil {
+	}
+	if v := fields.Actions; v != nil { // nil if null passed to "actions"
+		if err := json.Unmarshal(*v, &actions); err != nil {
+			return EnhanceError(err, *v)
+		}
+	}
+	if v := fields.Object; v != nil {
+		if err := json.Unmarshal(*v, &object); err != nil {
+			return EnhanceError(err, *v)
+		}
+	}
+	if v := fields.Scope; v != nil {
+		if err := json.Unmarshal(*v, &scope); err != nil {
+			return EnhanceError(err, *v)
+		}
+	}
+	if v := fields.Condition; v != nil {
+		if err := json.Unmarshal(*v, &condition); err != nil {
 			return EnhanceError(err, *v)
 		}
 	}
@@ -182,7 +225,7 @@ func (p *PolicyInfo) CalculateEtag() string {
 	}
 	scopeBytes := make([]byte, 0)
 	if p.Scope != nil {
-		scopeBytes, _ = json.Marshal(p.Condition)
+		scopeBytes, _ = json.Marshal(p.Scope)
 	}
 
 	policyBytes := make([]byte, 0)
@@ -244,10 +287,11 @@ const (
 	CompareDifSubject   string = "SUBJECT"
 	CompareDifObject    string = "OBJECT"
 	CompareDifCondition string = "CONDITION"
+	CompareDifScope     string = "SCOPE"
 )
 
 // Compare reports the differences between two policies, one or more of CompareEqual, CompareDifAction,
-// CompareDifSubject, CompareDifObject, CompareDifCondition
+// CompareDifSubject, CompareDifObject, CompareDifCondition. Scopes are not compared (see CompareWithScope).
 func (p *PolicyInfo) Compare(hexaPolicy PolicyInfo) []string {
 	// First do a textual compare
 	if p.Equals(hexaPolicy) {
@@ -284,6 +328,19 @@ func (p *PolicyInfo) Compare(hexaPolicy PolicyInfo) []string {
 	return difs
 }
 
+// CompareWithScope is Compare for providers that support scopes (see policyprovider.Capabilities). A scope difference
+// is reported as CompareDifScope.
+func (p *PolicyInfo) CompareWithScope(hexaPolicy PolicyInfo) []string {
+	difs := p.Compare(hexaPolicy)
+	if (p.Scope == nil) != (hexaPolicy.Scope == nil) || p.Scope != nil && !p.Scope.Equals(hexaPolicy.Scope) {
+		if slices.Contains(difs, CompareEqual) {
+			return []string{CompareDifScope}
+		}
+		difs = append(difs, CompareDifScope)
+	}
+	return difs
+}
+
 func (p *PolicyInfo) ActionsEqual(actions []ActionInfo) bool {
 	if actions == nil || len(p.Actions) != len(actions) {
 		return false
@@ -509,105 +566,169 @@ func (d *PolicyDif) Report() string {
 
 func (p *Policies) ReconcilePolicies(comparePolicies []PolicyInfo, diffsOnly bool) []PolicyDif {
 	var res = make([]PolicyDif, 0)
+	reconciler := p.NewReconciler(diffsOnly)
+	for _, comparePolicy := range comparePolicies {
+		if dif := reconciler.Compare(comparePolicy); dif != nil {
+			res = append(res, *dif)
+		}
+	}
+	return append(res, reconciler.Deletes()...)
+}
+
+// ReconcilePoliciesWithScopes is ReconcilePolicies for providers that support scopes. Policies that differ only in
+// scope are reported as updates.
+func (p *Policies) ReconcilePoliciesWithScopes(comparePolicies []PolicyInfo, diffsOnly bool) []PolicyDif {
+	var res = make([]PolicyDif, 0)
+	reconciler := p.NewReconciler(diffsOnly).WithScopes()
+	for _, comparePolicy := range comparePolicies {
+		if dif := reconciler.Compare(comparePolicy); dif != nil {
+			res = append(res, *dif)
+		}
+	}
+	return append(res, reconciler.Deletes()...)
+}
+
+/*
+Reconciler compares policies, one at a time, against a set of existing policies. Only the existing policies are held
+in memory, so the policies being compared may be streamed (e.g. from a very large file). Call Compare for each policy
+and then Deletes to obtain the existing policies that were not matched. Scopes are ignored unless WithScopes is called,
+as most providers do not store them.
+*/
+type Reconciler struct {
+	diffsOnly     bool
+	compareScopes bool
+	policyIdMap   map[string]PolicyInfo
+	policyEtagMap map[string]PolicyInfo
+}
+
+// NewReconciler returns a Reconciler for the existing policies p. When diffsOnly is true, matched policies are not reported.
+func (p *Policies) NewReconciler(diffsOnly bool) *Reconciler {
 	existingPolicies := p.Policies
-	var policyIdMap = make(map[string]PolicyInfo, len(existingPolicies))
-	var policyEtagMap = make(map[string]PolicyInfo, len(existingPolicies))
+	r := &Reconciler{
+		diffsOnly:     diffsOnly,
+		policyIdMap:   make(map[string]PolicyInfo, len(existingPolicies)),
+		policyEtagMap: make(map[string]PolicyInfo, len(existingPolicies)),
+	}
 
 	for _, policy := range existingPolicies {
 		if policy.Meta.PolicyId != nil {
 			id := *policy.Meta.PolicyId
-			policyIdMap[id] = policy
+			r.policyIdMap[id] = policy
 		} else {
-			policyEtagMap[policy.CalculateEtag()] = policy
+			r.policyEtagMap[r.etagKey(&policy)] = policy
 		}
 	}
+	return r
+}
 
-	for _, comparePolicy := range comparePolicies {
+// WithScopes causes the Reconciler to report scope differences. Use it for providers whose Capabilities support scopes.
+func (r *Reconciler) WithScopes() *Reconciler {
+	r.compareScopes = true
+	etagMap := make(map[string]PolicyInfo, len(r.policyEtagMap))
+	for _, policy := range r.policyEtagMap {
+		etagMap[r.etagKey(&policy)] = policy
+	}
+	r.policyEtagMap = etagMap
+	return r
+}
 
-		meta := comparePolicy.Meta
-
-		// Because comparePolicy is an iterator, take a copy to avoid it changing
-		newPolicy := comparePolicy
-
-		exists := false
-		var sourcePolicy PolicyInfo
-		sourcePolicy = PolicyInfo{}
-		var policyId string
-		if meta.PolicyId != nil {
-			policyId = *meta.PolicyId
-			sourcePolicy, exists = policyIdMap[policyId]
-		}
-		pExisting := []PolicyInfo{sourcePolicy}
-		// A policy was matched based on policyId
-		if exists {
-			differenceTypes := comparePolicy.Compare(sourcePolicy)
-
-			if slices.Contains(differenceTypes, CompareEqual) {
-				if !diffsOnly {
-					// policy matches, only return an equal difference if diffsOnly is false
-					dif := PolicyDif{
-						Type:          ChangeTypeEqual,
-						PolicyId:      *sourcePolicy.Meta.PolicyId,
-						DifTypes:      differenceTypes,
-						PolicyExist:   pExisting,
-						PolicyCompare: &newPolicy,
-					}
-					res = append(res, dif)
-				}
-				delete(policyIdMap, policyId) // Remove to indicate existing policy handled
-				continue                      // nothing to do
-			}
+// etagKey calculates the etag of policy and returns the key used to match it, which excludes the scope unless scopes
+// are compared
+func (r *Reconciler) etagKey(policy *PolicyInfo) string {
+	etag := policy.CalculateEtag()
+	if r.compareScopes || policy.Scope == nil {
+		return etag
+	}
+	unscoped := *policy
+	unscoped.Scope = nil
+	return unscoped.CalculateEtag()
+}
 
-			// This is a modify request
-			dif := PolicyDif{
-				Type:          ChangeTypeUpdate,
+// Compare returns the difference between comparePolicy and the existing policies, or nil if the policy matched and diffsOnly is set
+func (r *Reconciler) Compare(comparePolicy PolicyInfo) *PolicyDif {
+	meta := comparePolicy.Meta
+
+	// Take a copy as comparePolicy is modified when calculating an etag
+	newPolicy := comparePolicy
+
+	exists := false
+	var sourcePolicy PolicyInfo
+	sourcePolicy = PolicyInfo{}
+	var policyId string
+	if meta.PolicyId != nil {
+		policyId = *meta.PolicyId
+		sourcePolicy, exists = r.policyIdMap[policyId]
+	}
+	pExisting := []PolicyInfo{sourcePolicy}
+	// A policy was matched based on policyId
+	if exists {
+		differenceTypes := comparePolicy.Compare(sourcePolicy)
+		if r.compareScopes {
+			differenceTypes = comparePolicy.CompareWithScope(sourcePolicy)
+		}
+		delete(r.policyIdMap, policyId) // Remove to indicate existing policy handled
+
+		if slices.Contains(differenceTypes, CompareEqual) {
+			if r.diffsOnly {
+				return nil // nothing to do
+			}
+			// policy matches, only return an equal difference if diffsOnly is false
+			return &PolicyDif{
+				Type:          ChangeTypeEqual,
 				PolicyId:      *sourcePolicy.Meta.PolicyId,
 				DifTypes:      differenceTypes,
 				PolicyExist:   pExisting,
 				PolicyCompare: &newPolicy,
 			}
-			res = append(res, dif)
-			delete(policyIdMap, policyId) // Remove to indicate existing policy handled
-			continue
-		}
-
-		// Check for a match based on hash
-		sourcePolicy, hashExists := policyEtagMap[comparePolicy.CalculateEtag()]
-		pExisting = []PolicyInfo{sourcePolicy}
-		if hashExists {
-			if !diffsOnly {
-				// Because it is a hash compare, the policies must be equal (even though metadata may be different)
-				// policy matches
-				dif := PolicyDif{
-					Type:          ChangeTypeEqual,
-					Hash:          sourcePolicy.Meta.Etag,
-					DifTypes:      []string{CompareEqual},
-					PolicyExist:   pExisting,
-					PolicyCompare: &newPolicy,
-				}
-				res = append(res, dif)
-			}
-			delete(policyEtagMap, comparePolicy.Meta.Etag)
-			continue
 		}
 
-		// At this point no match was found. So assume new
-		dif := PolicyDif{
-			Type:          ChangeTypeNew,
-			PolicyId:      policyId,
-			Hash:          comparePolicy.Meta.Etag,
-			DifTypes:      nil,
-			PolicyExist:   nil,
+		// This is a modify request
+		return &PolicyDif{
+			Type:          ChangeTypeUpdate,
+			PolicyId:      *sourcePolicy.Meta.PolicyId,
+			DifTypes:      differenceTypes,
+			PolicyExist:   pExisting,
 			PolicyCompare: &newPolicy,
 		}
-		res = append(res, dif)
+	}
 
+	// Check for a match based on hash
+	etagKey := r.etagKey(&comparePolicy)
+	sourcePolicy, hashExists := r.policyEtagMap[etagKey]
+	pExisting = []PolicyInfo{sourcePolicy}
+	if hashExists {
+		delete(r.policyEtagMap, etagKey)
+		if r.diffsOnly {
+			return nil
+		}
+		// Because it is a hash compare, the policies must be equal (even though metadata may be different)
+		return &PolicyDif{
+			Type:          ChangeTypeEqual,
+			Hash:          sourcePolicy.Meta.Etag,
+			DifTypes:      []string{CompareEqual},
+			PolicyExist:   pExisting,
+			PolicyCompare: &newPolicy,
+		}
 	}
 
+	// At this point no match was found. So assume new
+	return &PolicyDif{
+		Type:          ChangeTypeNew,
+		PolicyId:      policyId,
+		Hash:          comparePolicy.Meta.Etag,
+		DifTypes:      nil,
+		PolicyExist:   nil,
+		PolicyCompare: &newPolicy,
+	}
+}
+
+// Deletes returns a ChangeTypeDelete difference for each existing policy that was not matched by Compare
+func (r *Reconciler) Deletes() []PolicyDif {
+	var res = make([]PolicyDif, 0)
 	// For each remaining pre-existing policy there is an implied delete
-	if len(policyIdMap) > 0 {
-		fmt.Printf("%v existing policies with Policy Ids will be removed.\n", len(policyIdMap))
-		for _, policy := range policyIdMap {
+	if len(r.policyIdMap) > 0 {
+		fmt.Printf("%v existing policies with Policy Ids will be removed.\n", len(r.policyIdMap))
+		for _, policy := range r.policyIdMap {
 			dif := PolicyDif{
 				Type:          ChangeTypeDelete,
 				PolicyId:      *policy.Meta.PolicyId,
@@ -618,9 +739,9 @@ func (p *Policies) ReconcilePolicies(comparePolicies []PolicyInfo, diffsOnly boo
 			res = append(res, dif)
 		}
 	}
-	if len(policyEtagMap) > 0 {
-		fmt.Printf("%v existing policies (without policy ids) will be removed.\n", len(policyEtagMap))
-		for _, policy := range policyEtagMap {
+	if len(r.policyEtagMap) > 0 {
+		fmt.Printf("%v existing policies (without policy ids) will be removed.\n", len(r.policyEtagMap))
+		for _, policy := range r.policyEtagMap {
 			pol := policy
 			dif := PolicyDif{
 				Type:          ChangeTypeDelete,
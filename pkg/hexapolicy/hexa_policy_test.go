@@ -351,6 +351,13 @@ func TestPolicyInfo_CalculateEtag(t *testing.T) {
 	etag2 := pnew.CalculateEtag()
 
 	assert.NotEqual(t, etag, etag2, "Should be different etags")
+
+	filter := "idql:name eq alice"
+	pscope := p1
+	pscope.Scope = &ScopeInfo{Filter: &filter}
+	pscope2 := p1
+	pscope2.Scope = &ScopeInfo{Filter: &filter, Attributes: []string{"email"}}
+	assert.NotEqual(t, pscope.CalculateEtag(), pscope2.CalculateEtag(), "Scopes should change the etag")
 }
 
 func TestPolicyInfo_Equals(t *testing.T) {
@@ -406,6 +413,9 @@ func TestPolicyInfo_Compare(t *testing.T) {
 	// This will be used to make sure subject is case insensitive
 	p3.Subjects = []string{"User:Accounting@Hexaindustries.io"}
 
+	p4 := policies.Policies[0]
+	p4.Scope = &ScopeInfo{Attributes: []string{"email"}}
+
 	type fields struct {
 		hexaPolicy PolicyInfo
 	}
@@ -413,38 +423,80 @@ func TestPolicyInfo_Compare(t *testing.T) {
 		hexaPolicy PolicyInfo
 	}
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		want   []string
+		name      string
+		fields    fields
+		args      args
+		want      []string
+		wantScope []string
 	}{
 		{
-			name:   "Matching policy",
-			fields: fields{hexaPolicy: policies.Policies[0]},
-			args:   args{hexaPolicy: policies.Policies[0]},
-			want:   []string{CompareEqual},
+			name:      "Matching policy",
+			fields:    fields{hexaPolicy: policies.Policies[0]},
+			args:      args{hexaPolicy: policies.Policies[0]},
+			want:      []string{CompareEqual},
+			wantScope: []string{CompareEqual},
 		},
 		{
-			name:   "Diff policy",
-			fields: fields{hexaPolicy: policies.Policies[0]},
-			args:   args{hexaPolicy: policies.Policies[1]},
-			want:   []string{CompareDifSubject, CompareDifAction, CompareDifCondition},
+			name:      "Diff policy",
+			fields:    fields{hexaPolicy: policies.Policies[0]},
+			args:      args{hexaPolicy: policies.Policies[1]},
+			want:      []string{CompareDifSubject, CompareDifAction, CompareDifCondition},
+			wantScope: []string{CompareDifSubject, CompareDifAction, CompareDifCondition, CompareDifScope},
 		},
 		{
-			name:   "Subjects case test",
-			fields: fields{hexaPolicy: policies.Policies[0]},
-			args:   args{hexaPolicy: p3},
-			want:   []string{CompareEqual},
+			name:      "Subjects case test",
+			fields:    fields{hexaPolicy: policies.Policies[0]},
+			args:      args{hexaPolicy: p3},
+			want:      []string{CompareEqual},
+			wantScope: []string{CompareEqual},
+		},
+		{
+			name:      "Scope added",
+			fields:    fields{hexaPolicy: policies.Policies[0]},
+			args:      args{hexaPolicy: p4},
+			want:      []string{CompareEqual},
+			wantScope: []string{CompareDifScope},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &tt.fields.hexaPolicy
 			assert.Equalf(t, tt.want, p.Compare(tt.args.hexaPolicy), "Compare(%v)", tt.args.hexaPolicy)
+			assert.Equalf(t, tt.wantScope, p.CompareWithScope(tt.args.hexaPolicy), "CompareWithScope(%v)", tt.args.hexaPolicy)
 		})
 	}
 }
 
+func TestReconcilePoliciesWithScopes(t *testing.T) {
+	policies := getPolicies(t)
+	existing := Policies{Policies: []PolicyInfo{policies.Policies[0]}}
+	existing.Policies[0].Meta.PolicyId = nil
+	existing.Policies[0].Scope = nil
+
+	scoped := existing.Policies[0]
+	scoped.Scope = &ScopeInfo{Attributes: []string{"email"}}
+
+	// Providers without scope support ignore the scope, so the policy matches by etag
+	difs := existing.ReconcilePolicies([]PolicyInfo{scoped}, true)
+	assert.Empty(t, difs)
+
+	difs = existing.ReconcilePoliciesWithScopes([]PolicyInfo{scoped}, true)
+	assert.Len(t, difs, 2)
+	assert.Equal(t, ChangeTypeNew, difs[0].Type)
+	assert.Equal(t, ChangeTypeDelete, difs[1].Type)
+
+	id := "scopedPolicy"
+	existing.Policies[0].Meta.PolicyId = &id
+	scoped.Meta.PolicyId = &id
+	difs = existing.ReconcilePolicies([]PolicyInfo{scoped}, true)
+	assert.Empty(t, difs)
+
+	difs = existing.ReconcilePoliciesWithScopes([]PolicyInfo{scoped}, true)
+	assert.Len(t, difs, 1)
+	assert.Equal(t, ChangeTypeUpdate, difs[0].Type)
+	assert.Equal(t, []string{CompareDifScope}, difs[0].DifTypes)
+}
+
 func TestPolicyDif_Report(t *testing.T) {
 	pid := "abc"
 	/*
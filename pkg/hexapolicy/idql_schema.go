@@ -0,0 +1,248 @@
+package hexapolicy
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// IdqlSchemaId is the $id of IdqlSchema
+const IdqlSchemaId = "https://hexaorchestration.org/idql/0.7/schema.json"
+
+// IdqlSchema is the JSON Schema (draft 2020-12) for IDQL 0.7 policy documents. A document is an object with a
+// "policies" array, an array of policies, or a single policy.
+//
+//go:embed resources/idql-0.7.schema.json
+var IdqlSchema []byte
+
+var (
+	schemaOnce        sync.Once
+	schemaErr         error
+	policySetSchema   *jsonschema.Schema
+	policyArraySchema *jsonschema.Schema
+	policySchema      *jsonschema.Schema
+)
+
+func compileSchemas() error {
+	schemaOnce.Do(func() {
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(IdqlSchema))
+		if err != nil {
+			schemaErr = err
+			return
+		}
+		compiler := jsonschema.NewCompiler()
+		if schemaErr = compiler.AddResource(IdqlSchemaId, doc); schemaErr != nil {
+			return
+		}
+		if policySetSchema, schemaErr = compiler.Compile(IdqlSchemaId + "#/$defs/policySet"); schemaErr != nil {
+			return
+		}
+		if policyArraySchema, schemaErr = compiler.Compile(IdqlSchemaId + "#/$defs/policyArray"); schemaErr != nil {
+			return
+		}
+		policySchema, schemaErr = compiler.Compile(IdqlSchemaId + "#/$defs/policy")
+	})
+	return schemaErr
+}
+
+// ParseIssue describes a problem with the value at Pointer (a JSON Pointer, RFC6901) in an IDQL policy document
+type ParseIssue struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+func (i ParseIssue) String() string {
+	return fmt.Sprintf("#%s: %s", i.Pointer, i.Message)
+}
+
+// SchemaError is returned by ParsePoliciesStrict when a document does not conform to IdqlSchema
+type SchemaError struct {
+	Issues []ParseIssue
+}
+
+func (e *SchemaError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("%d IDQL %s schema violation(s):", len(e.Issues), IdqlVersion))
+	for _, issue := range e.Issues {
+		sb.WriteString("\n  ")
+		sb.WriteString(issue.String())
+	}
+	return sb.String()
+}
+
+/*
+ValidateSchema validates an IDQL JSON document against IdqlSchema, returning an issue for each unknown attribute,
+legacy (pre 0.7) form, or invalid value. An error is returned if the document is not valid JSON.
+*/
+func ValidateSchema(document []byte) ([]ParseIssue, error) {
+	if err := compileSchemas(); err != nil {
+		return nil, err
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(document))
+	if err != nil {
+		return nil, err
+	}
+
+	schema := policySchema
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if _, ok := v["policies"]; ok {
+			schema = policySetSchema
+		}
+	case []interface{}:
+		schema = policyArraySchema
+	}
+
+	err = schema.Validate(doc)
+	if err == nil {
+		return nil, nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, err
+	}
+	issues := schemaIssues(validationErr, doc, nil)
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Pointer < issues[j].Pointer
+	})
+	return issues, nil
+}
+
+/*
+ParsePoliciesStrict parses an IDQL JSON document (see IdqlSchema). Unknown attributes, legacy forms (e.g. "subject" with
+"members", actions with "actionUri", and objects with "resource_id") and other IDQL versions are rejected with a
+*SchemaError.
+*/
+func ParsePoliciesStrict(document []byte) ([]PolicyInfo, error) {
+	issues, err := ValidateSchema(document)
+	if err != nil {
+		return nil, err
+	}
+	if len(issues) > 0 {
+		return nil, &SchemaError{Issues: issues}
+	}
+	return decodePolicies(document)
+}
+
+/*
+ParsePoliciesLenient parses an IDQL JSON document, accepting legacy forms and upgrading policies to the current IDQL
+version. Rather than being logged, anything that would be rejected by ParsePoliciesStrict is returned as an issue.
+*/
+func ParsePoliciesLenient(document []byte) ([]PolicyInfo, []ParseIssue, error) {
+	issues, err := ValidateSchema(document)
+	if err != nil {
+		return nil, nil, err
+	}
+	policies, err := decodePolicies(document)
+	return policies, issues, err
+}
+
+// decodePolicies decodes each policy in document without logging version upgrades
+func decodePolicies(document []byte) ([]PolicyInfo, error) {
+	raws, err := splitPolicies(document)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]PolicyInfo, len(raws))
+	for i, raw := range raws {
+		if err := policies[i].unmarshal(raw, false); err != nil {
+			return nil, fmt.Errorf("policy %d: %w", i, err)
+		}
+	}
+	return policies, nil
+}
+
+var printer = message.NewPrinter(language.English)
+
+// knownAttributes are the attribute names used in IDQL documents, used to detect attributes with the wrong case
+var knownAttributes = []string{"policies", "app", "meta", "subjects", "actions", "object", "condition", "scope",
+	"version", "sourceData", "description", "created", "modified", "etag", "policyId", "papId", "providerType",
+	"filter", "attributes"}
+
+// schemaIssues converts the leaf errors of err to issues, describing legacy forms and misnamed attributes
+func schemaIssues(err *jsonschema.ValidationError, doc interface{}, issues []ParseIssue) []ParseIssue {
+	if len(err.Causes) > 0 {
+		for _, cause := range err.Causes {
+			issues = schemaIssues(cause, doc, issues)
+		}
+		return issues
+	}
+
+	pointer := jsonPointer(err.InstanceLocation)
+	switch errKind := err.ErrorKind.(type) {
+	case *kind.AdditionalProperties:
+		for _, property := range errKind.Properties {
+			issues = append(issues, ParseIssue{Pointer: pointer + "/" + escapePointer(property), Message: unknownAttributeMessage(property)})
+		}
+		return issues
+	case *kind.Type:
+		value, _ := valueAt(doc, err.InstanceLocation).(map[string]interface{})
+		if _, ok := value["actionUri"]; ok {
+			return append(issues, ParseIssue{Pointer: pointer, Message: "legacy action form {\"actionUri\"}; use the action uri string"})
+		}
+		if _, ok := value["resource_id"]; ok {
+			return append(issues, ParseIssue{Pointer: pointer, Message: "legacy object form {\"resource_id\"}; use the resource id string"})
+		}
+	case *kind.Const:
+		if len(err.InstanceLocation) > 0 && err.InstanceLocation[len(err.InstanceLocation)-1] == "version" {
+			return append(issues, ParseIssue{Pointer: pointer, Message: fmt.Sprintf("IDQL version %v is not %s (policy is upgraded)", errKind.Got, IdqlVersion)})
+		}
+	}
+	return append(issues, ParseIssue{Pointer: pointer, Message: err.ErrorKind.LocalizedString(printer)})
+}
+
+func unknownAttributeMessage(property string) string {
+	switch property {
+	case "subject":
+		return "legacy subject form {\"members\"}; use \"subjects\" (an array of subjects)"
+	}
+	for _, name := range knownAttributes {
+		if strings.EqualFold(property, name) {
+			return fmt.Sprintf("unknown attribute (attribute names are case-sensitive; use %q)", name)
+		}
+	}
+	return "unknown attribute"
+}
+
+// valueAt returns the value in doc located by tokens
+func valueAt(doc interface{}, tokens []string) interface{} {
+	value := doc
+	for _, token := range tokens {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[token]
+		case []interface{}:
+			var index int
+			if _, err := fmt.Sscanf(token, "%d", &index); err != nil || index < 0 || index >= len(v) {
+				return nil
+			}
+			value = v[index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+func jsonPointer(tokens []string) string {
+	sb := strings.Builder{}
+	for _, token := range tokens {
+		sb.WriteString("/")
+		sb.WriteString(escapePointer(token))
+	}
+	return sb.String()
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,94 @@
+package hexapolicy
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdqlSchema(t *testing.T) {
+	var schema map[string]interface{}
+	assert.NoError(t, json.Unmarshal(IdqlSchema, &schema))
+	assert.Equal(t, IdqlSchemaId, schema["$id"])
+	assert.NoError(t, compileSchemas())
+}
+
+func TestParsePoliciesStrict(t *testing.T) {
+	policies, err := ParsePoliciesStrict([]byte(`{"policies": [` + testPolicy1 + "," + testPolicy2 + `], "app": "anApp"}`))
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	policies, err = ParsePoliciesStrict([]byte(testPolicy1))
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	// policies written by the mapper must conform
+	policyBytes, err := json.Marshal(policies)
+	assert.NoError(t, err)
+	_, err = ParsePoliciesStrict(policyBytes)
+	assert.NoError(t, err)
+
+	_, file, _, _ := runtime.Caller(0)
+	legacyBytes, err := os.ReadFile(filepath.Join(file, "..", "test", "legacyPolicies.json"))
+	assert.NoError(t, err)
+	_, err = ParsePoliciesStrict(legacyBytes)
+	var schemaErr *SchemaError
+	assert.True(t, errors.As(err, &schemaErr))
+	assert.Equal(t, []ParseIssue{
+		{Pointer: "/policies/0/actions/0", Message: "legacy action form {\"actionUri\"}; use the action uri string"},
+		{Pointer: "/policies/0/meta/version", Message: "IDQL version 0.6 is not 0.7 (policy is upgraded)"},
+		{Pointer: "/policies/0/object", Message: "legacy object form {\"resource_id\"}; use the resource id string"},
+		{Pointer: "/policies/0/subject", Message: "legacy subject form {\"members\"}; use \"subjects\" (an array of subjects)"},
+		{Pointer: "/policies/1/actions/0", Message: "legacy action form {\"actionUri\"}; use the action uri string"},
+		{Pointer: "/policies/1/meta/version", Message: "IDQL version 0.6 is not 0.7 (policy is upgraded)"},
+		{Pointer: "/policies/1/object", Message: "legacy object form {\"resource_id\"}; use the resource id string"},
+		{Pointer: "/policies/1/subject", Message: "legacy subject form {\"members\"}; use \"subjects\" (an array of subjects)"},
+	}, schemaErr.Issues)
+	assert.Contains(t, err.Error(), "8 IDQL 0.7 schema violation(s):\n  #/policies/0/actions/0: legacy action form")
+
+	_, err = ParsePoliciesStrict([]byte(`[{"Subjects": ["any"], "object": 1, "colour": "red", "condition": {"rule": "a eq b", "when": "now"}}]`))
+	assert.True(t, errors.As(err, &schemaErr))
+	assert.Equal(t, []ParseIssue{
+		{Pointer: "/0/Subjects", Message: "unknown attribute (attribute names are case-sensitive; use \"subjects\")"},
+		{Pointer: "/0/colour", Message: "unknown attribute"},
+		{Pointer: "/0/condition/when", Message: "unknown attribute"},
+		{Pointer: "/0/object", Message: "got number, want string"},
+	}, schemaErr.Issues)
+
+	_, err = ParsePoliciesStrict([]byte(`{"policies": [`))
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &schemaErr))
+}
+
+func TestParsePoliciesLenient(t *testing.T) {
+	_, file, _, _ := runtime.Caller(0)
+	legacyBytes, err := os.ReadFile(filepath.Join(file, "..", "test", "legacyPolicies.json"))
+	assert.NoError(t, err)
+
+	policies, issues, err := ParsePoliciesLenient(legacyBytes)
+	assert.NoError(t, err)
+	assert.Len(t, issues, 8)
+	assert.Len(t, policies, 2)
+	assert.Equal(t, IdqlVersion, policies[0].Meta.Version)
+	assert.Equal(t, SubjectInfo{"anyAuthenticated"}, policies[0].Subjects)
+	assert.Equal(t, []ActionInfo{"can_read_user"}, policies[0].Actions)
+	assert.Equal(t, ObjectInfo("todo"), policies[0].Object)
+
+	// The lenient result matches the default (logging) parser
+	var expected Policies
+	assert.NoError(t, json.Unmarshal(legacyBytes, &expected))
+	assert.Equal(t, expected.Policies, policies)
+
+	policies, issues, err = ParsePoliciesLenient([]byte(testPolicy1))
+	assert.NoError(t, err)
+	assert.Nil(t, issues)
+	assert.Len(t, policies, 1)
+
+	_, _, err = ParsePoliciesLenient([]byte(`{"subjects": "any"}`))
+	assert.ErrorContains(t, err, "policy 0: json: cannot unmarshal string")
+}
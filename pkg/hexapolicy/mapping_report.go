@@ -0,0 +1,157 @@
+package hexapolicy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fidelity values describe how well an element of an IDQL policy was represented by a target policy format
+const (
+	FidelityExact       string = "EXACT"        // the element was mapped with the same meaning
+	FidelityApproximate string = "APPROXIMATED" // the element was mapped, but its meaning changed (e.g. a broader match)
+	FidelityDropped     string = "DROPPED"      // the element (or policy) is not present in the mapped result
+)
+
+// MapElementPolicy is used when a whole policy is dropped or approximated. Other elements use CompareDifSubject,
+// CompareDifAction, CompareDifObject, and CompareDifCondition.
+const MapElementPolicy string = "POLICY"
+
+type ElementMapping struct {
+	Element  string `json:"element"`
+	Fidelity string `json:"fidelity"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// PolicyMapping holds the ElementMapping results for the policy at Index in the mapped set of policies
+type PolicyMapping struct {
+	Index    int              `json:"index"`
+	PolicyId string           `json:"policyId,omitempty"`
+	Elements []ElementMapping `json:"elements"`
+}
+
+/*
+MappingReport records, for each policy mapped to (or from) a Target format or provider, which elements were mapped
+exactly, approximated, or dropped, and why. Methods may be called on a nil report, in which case nothing is recorded.
+*/
+type MappingReport struct {
+	Target   string          `json:"target"`
+	Policies []PolicyMapping `json:"policies"`
+}
+
+func NewMappingReport(target string) *MappingReport {
+	return &MappingReport{Target: target, Policies: []PolicyMapping{}}
+}
+
+// Exact records that element of the policy at index was mapped without loss
+func (r *MappingReport) Exact(index int, policy PolicyInfo, element string) {
+	r.record(index, policy, element, FidelityExact, "")
+}
+
+// ExactPolicy records each element of the policy as mapped without loss. A weaker result recorded for an element
+// (before or after) takes precedence.
+func (r *MappingReport) ExactPolicy(index int, policy PolicyInfo) {
+	r.Exact(index, policy, CompareDifSubject)
+	r.Exact(index, policy, CompareDifAction)
+	r.Exact(index, policy, CompareDifObject)
+	if policy.Condition != nil {
+		r.Exact(index, policy, CompareDifCondition)
+	}
+}
+
+// Approximated records that element of the policy at index was mapped with a change in meaning
+func (r *MappingReport) Approximated(index int, policy PolicyInfo, element string, reason string) {
+	r.record(index, policy, element, FidelityApproximate, reason)
+}
+
+// Dropped records that element (or MapElementPolicy) of the policy at index could not be mapped
+func (r *MappingReport) Dropped(index int, policy PolicyInfo, element string, reason string) {
+	r.record(index, policy, element, FidelityDropped, reason)
+}
+
+func (r *MappingReport) record(index int, policy PolicyInfo, element, fidelity, reason string) {
+	if r == nil {
+		return
+	}
+	mapping := r.policyMapping(index, policy)
+	for i, existing := range mapping.Elements {
+		if existing.Element == element {
+			// Keep the weakest result reported for an element
+			if fidelityRank(fidelity) > fidelityRank(existing.Fidelity) {
+				mapping.Elements[i] = ElementMapping{Element: element, Fidelity: fidelity, Reason: reason}
+			}
+			return
+		}
+	}
+	mapping.Elements = append(mapping.Elements, ElementMapping{Element: element, Fidelity: fidelity, Reason: reason})
+}
+
+func (r *MappingReport) policyMapping(index int, policy PolicyInfo) *PolicyMapping {
+	for i := range r.Policies {
+		if r.Policies[i].Index == index {
+			return &r.Policies[i]
+		}
+	}
+	mapping := PolicyMapping{Index: index, Elements: []ElementMapping{}}
+	if policy.Meta.PolicyId != nil {
+		mapping.PolicyId = *policy.Meta.PolicyId
+	}
+	r.Policies = append(r.Policies, mapping)
+	return &r.Policies[len(r.Policies)-1]
+}
+
+func fidelityRank(fidelity string) int {
+	switch fidelity {
+	case FidelityDropped:
+		return 2
+	case FidelityApproximate:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// IsLossy returns true if any policy element was approximated or dropped
+func (r *MappingReport) IsLossy() bool {
+	return len(r.Issues()) > 0
+}
+
+// Issues returns a description of each approximated or dropped element
+func (r *MappingReport) Issues() []string {
+	var issues []string
+	if r == nil {
+		return issues
+	}
+	for _, policy := range r.Policies {
+		for _, element := range policy.Elements {
+			if element.Fidelity == FidelityExact {
+				continue
+			}
+			issues = append(issues, fmt.Sprintf("%s: %s %s - %s", policy.name(), element.Element, element.Fidelity, element.Reason))
+		}
+	}
+	return issues
+}
+
+func (p PolicyMapping) name() string {
+	if p.PolicyId != "" {
+		return fmt.Sprintf("policy %d (%s)", p.Index, p.PolicyId)
+	}
+	return fmt.Sprintf("policy %d", p.Index)
+}
+
+func (r *MappingReport) String() string {
+	if r == nil {
+		return ""
+	}
+	issues := r.Issues()
+	if len(issues) == 0 {
+		return fmt.Sprintf("%s mapping: all %d policies mapped exactly", r.Target, len(r.Policies))
+	}
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("%s mapping: %d element(s) approximated or dropped", r.Target, len(issues)))
+	for _, issue := range issues {
+		sb.WriteString("\n  ")
+		sb.WriteString(issue)
+	}
+	return sb.String()
+}
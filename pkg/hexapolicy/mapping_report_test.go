@@ -0,0 +1,43 @@
+package hexapolicy
+
+import (
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappingReport(t *testing.T) {
+	policyId := "policy1"
+	policy := PolicyInfo{
+		Meta:      MetaInfo{PolicyId: &policyId},
+		Subjects:  []string{"user:alice@example.com"},
+		Actions:   []ActionInfo{"read"},
+		Condition: &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: conditions.AAllow},
+	}
+
+	report := NewMappingReport("test")
+	report.ExactPolicy(0, policy)
+	report.ExactPolicy(1, PolicyInfo{Subjects: []string{"any"}})
+	assert.False(t, report.IsLossy())
+	assert.Len(t, report.Policies[0].Elements, 4, "condition is reported when present")
+	assert.Len(t, report.Policies[1].Elements, 3)
+	assert.Equal(t, "test mapping: all 2 policies mapped exactly", report.String())
+
+	report.Dropped(0, policy, CompareDifCondition, "conditions not supported")
+	report.Approximated(0, policy, CompareDifCondition, "weaker result is ignored")
+	report.Exact(0, policy, CompareDifCondition)
+	assert.True(t, report.IsLossy())
+	assert.Equal(t, []string{"policy 0 (policy1): CONDITION DROPPED - conditions not supported"}, report.Issues())
+
+	report.Approximated(1, PolicyInfo{}, CompareDifSubject, "any is broader")
+	assert.Equal(t, "test mapping: 2 element(s) approximated or dropped\n"+
+		"  policy 0 (policy1): CONDITION DROPPED - conditions not supported\n"+
+		"  policy 1: SUBJECT APPROXIMATED - any is broader", report.String())
+
+	var nilReport *MappingReport
+	nilReport.ExactPolicy(0, policy)
+	nilReport.Dropped(0, policy, MapElementPolicy, "ignored")
+	assert.False(t, nilReport.IsLossy())
+	assert.Equal(t, "", nilReport.String())
+}
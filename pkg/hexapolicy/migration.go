@@ -0,0 +1,383 @@
+package hexapolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+Migration upgrades the JSON form of a policy from IDQL version From to version To. Migrations are registered with
+RegisterMigration and applied in version order, so that a policy is upgraded one version at a time to IdqlVersion.
+*/
+type Migration struct {
+	From        string
+	To          string
+	Description string
+	// Detect, when set, returns true when a policy uses the From form regardless of its meta.version (e.g. a policy
+	// labelled with a later version that still uses an earlier form).
+	Detect func(policy map[string]interface{}) bool
+	// Migrate converts policy to the To form in place, returning a description of each change
+	Migrate func(policy map[string]interface{}) []MigrationChange
+}
+
+// MigrationChange describes a change made to the attribute at Pointer (a JSON Pointer relative to the policy)
+type MigrationChange struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Pointer     string `json:"pointer"`
+	Description string `json:"description"`
+}
+
+// PolicyMigration holds the changes made to the policy at Index when migrating from version From to To
+type PolicyMigration struct {
+	Index    int               `json:"index"`
+	PolicyId string            `json:"policyId,omitempty"`
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Changes  []MigrationChange `json:"changes"`
+}
+
+// MigrationReport lists the policies changed by MigratePolicies. Total is the number of policies migrated.
+type MigrationReport struct {
+	Total    int               `json:"total"`
+	Policies []PolicyMigration `json:"policies"`
+}
+
+func (p PolicyMigration) String() string {
+	sb := strings.Builder{}
+	if p.PolicyId != "" {
+		sb.WriteString(fmt.Sprintf("policy %d (%s): ", p.Index, p.PolicyId))
+	} else {
+		sb.WriteString(fmt.Sprintf("policy %d: ", p.Index))
+	}
+	from := p.From
+	if from == "" {
+		from = "unversioned"
+	}
+	sb.WriteString(fmt.Sprintf("%s -> %s", from, p.To))
+	for _, change := range p.Changes {
+		sb.WriteString(fmt.Sprintf("\n  %s: %s", change.Pointer, change.Description))
+	}
+	return sb.String()
+}
+
+// Changed returns true if any policy was changed by migration
+func (r *MigrationReport) Changed() bool {
+	return r != nil && len(r.Policies) > 0
+}
+
+func (r *MigrationReport) String() string {
+	if r == nil {
+		return ""
+	}
+	if len(r.Policies) == 0 {
+		return fmt.Sprintf("no migration required: all %d policies are IDQL %s", r.Total, IdqlVersion)
+	}
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("%d of %d policies migrated to IDQL %s:", len(r.Policies), r.Total, IdqlVersion))
+	for _, policy := range r.Policies {
+		sb.WriteString("\n")
+		sb.WriteString(policy.String())
+	}
+	return sb.String()
+}
+
+var (
+	migrationLock sync.RWMutex
+	migrations    []Migration
+)
+
+func init() {
+	RegisterMigration(Migration{
+		From:        "0.5",
+		To:          "0.6",
+		Description: "IDQL 0.5 and 0.6 policies have the same form",
+		Migrate: func(policy map[string]interface{}) []MigrationChange {
+			return nil
+		},
+	})
+	RegisterMigration(Migration{
+		From:        "0.6",
+		To:          "0.7",
+		Description: "Converts subject members, action uris, and object resource ids to values and lower case attribute names",
+		Detect:      hasPre07Form,
+		Migrate:     migrate06To07,
+	})
+}
+
+// RegisterMigration adds (or replaces) the migration from m.From. Migrations are applied in order of their From version.
+func RegisterMigration(m Migration) {
+	migrationLock.Lock()
+	defer migrationLock.Unlock()
+	for i, existing := range migrations {
+		if existing.From == m.From {
+			migrations[i] = m
+			return
+		}
+	}
+	migrations = append(migrations, m)
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return CompareVersions(migrations[i].From, migrations[j].From) < 0
+	})
+}
+
+// Migrations returns the registered migrations in the order they are applied
+func Migrations() []Migration {
+	migrationLock.RLock()
+	defer migrationLock.RUnlock()
+	return append([]Migration{}, migrations...)
+}
+
+// CompareVersions compares dotted IDQL versions numerically, returning -1, 0, or 1 (e.g. 0.6 < 0.6.15 < 0.7 < 0.10)
+func CompareVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aNum, bNum int
+		if i < len(aParts) {
+			aNum, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bNum, _ = strconv.Atoi(bParts[i])
+		}
+		if aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+/*
+MigratePolicy upgrades policy (the generic JSON form of a single policy) in place to IdqlVersion. The starting version
+is meta.version, or the earliest version detected by a Migration when the policy uses an earlier form than its version
+indicates. The starting version and the changes made are returned. A policy with a version newer than IdqlVersion is
+not changed and an error is returned.
+*/
+func MigratePolicy(policy map[string]interface{}) (string, []MigrationChange, error) {
+	declared := ""
+	meta, _ := attribute(policy, "meta").(map[string]interface{})
+	if meta != nil {
+		declared, _ = attribute(meta, "version").(string)
+	}
+	if declared != "" && CompareVersions(declared, IdqlVersion) > 0 {
+		return declared, nil, fmt.Errorf("IDQL version %s is newer than the supported version %s", declared, IdqlVersion)
+	}
+
+	registered := Migrations()
+	version := declared
+	for _, m := range registered {
+		if m.Detect != nil && m.Detect(policy) {
+			if version == "" || CompareVersions(m.From, version) < 0 {
+				version = m.From
+			}
+			break
+		}
+	}
+	if version == "" {
+		version = IdqlVersion
+	}
+
+	var changes []MigrationChange
+	for _, m := range registered {
+		if CompareVersions(m.To, version) <= 0 || CompareVersions(m.To, IdqlVersion) > 0 {
+			continue
+		}
+		for _, change := range m.Migrate(policy) {
+			change.From = m.From
+			change.To = m.To
+			changes = append(changes, change)
+		}
+		version = m.To
+	}
+
+	meta, _ = attribute(policy, "meta").(map[string]interface{})
+	if meta == nil {
+		meta = map[string]interface{}{}
+		policy["meta"] = meta
+	}
+	if declared != IdqlVersion {
+		description := fmt.Sprintf("version %s changed to %s", declared, IdqlVersion)
+		if declared == "" {
+			description = "version " + IdqlVersion + " added"
+		}
+		for key := range meta {
+			if strings.EqualFold(key, "version") {
+				delete(meta, key)
+			}
+		}
+		meta["version"] = IdqlVersion
+		changes = append(changes, MigrationChange{From: declared, To: IdqlVersion, Pointer: "/meta/version", Description: description})
+	}
+	return declared, changes, nil
+}
+
+/*
+MigratePolicies upgrades each policy in an IDQL JSON document (an object with a "policies" array, an array of policies,
+or a single policy) to IdqlVersion. The returned report lists the policies that were changed and how.
+*/
+func MigratePolicies(document []byte) ([]PolicyInfo, *MigrationReport, error) {
+	raws, err := splitPolicies(document)
+	if err != nil {
+		return nil, nil, err
+	}
+	report := &MigrationReport{Total: len(raws), Policies: []PolicyMigration{}}
+	policies := make([]PolicyInfo, len(raws))
+	for i, raw := range raws {
+		migrated, migration, err := migratePolicyJSON(i, raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("policy %d: %w", i, err)
+		}
+		if err = policies[i].unmarshal(migrated, false); err != nil {
+			return nil, nil, fmt.Errorf("policy %d: %w", i, err)
+		}
+		if migration != nil {
+			report.Policies = append(report.Policies, *migration)
+		}
+	}
+	return policies, report, nil
+}
+
+// migratePolicyJSON migrates the JSON form of the policy at index, returning nil for the migration if it is unchanged
+func migratePolicyJSON(index int, data []byte) ([]byte, *PolicyMigration, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var policy map[string]interface{}
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, nil, err
+	}
+	if policy == nil {
+		return data, nil, nil
+	}
+	from, changes, err := MigratePolicy(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(changes) == 0 {
+		return data, nil, nil
+	}
+	migrated, err := json.Marshal(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	migration := &PolicyMigration{Index: index, From: from, To: IdqlVersion, Changes: changes}
+	if meta, ok := policy["meta"].(map[string]interface{}); ok {
+		migration.PolicyId, _ = attribute(meta, "policyId").(string)
+	}
+	return migrated, migration, nil
+}
+
+// splitPolicies returns the JSON of each policy in an IDQL document
+func splitPolicies(document []byte) ([]json.RawMessage, error) {
+	var raws []json.RawMessage
+	trimmed := bytes.TrimSpace(document)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &raws); err != nil {
+			return nil, err
+		}
+		return raws, nil
+	}
+	var set struct {
+		Policies *[]json.RawMessage `json:"policies"`
+	}
+	if err := json.Unmarshal(trimmed, &set); err != nil {
+		return nil, err
+	}
+	if set.Policies != nil {
+		return *set.Policies, nil
+	}
+	return []json.RawMessage{trimmed}, nil
+}
+
+// attribute returns the value of the attribute name in object, matching the name case-insensitively
+func attribute(object map[string]interface{}, name string) interface{} {
+	if value, ok := object[name]; ok {
+		return value
+	}
+	for key, value := range object {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return nil
+}
+
+// hasPre07Form returns true if policy uses the subject members, actionUri, or resource_id forms
+func hasPre07Form(policy map[string]interface{}) bool {
+	if _, ok := attribute(policy, "subject").(map[string]interface{}); ok {
+		return true
+	}
+	if _, ok := attribute(policy, "object").(map[string]interface{}); ok {
+		return true
+	}
+	actions, _ := attribute(policy, "actions").([]interface{})
+	for _, action := range actions {
+		if _, ok := action.(map[string]interface{}); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var policyAttributes = []string{"meta", "subjects", "actions", "object", "condition", "scope"}
+var metaAttributes = []string{"version", "sourceData", "description", "created", "modified", "etag", "policyId", "papId", "providerType"}
+
+// renameAttributes changes attribute names to the case used by names
+func renameAttributes(object map[string]interface{}, names []string, pointer string) []MigrationChange {
+	var changes []MigrationChange
+	for _, name := range names {
+		for key, value := range object {
+			if key != name && strings.EqualFold(key, name) {
+				delete(object, key)
+				object[name] = value
+				changes = append(changes, MigrationChange{Pointer: pointer + "/" + key, Description: fmt.Sprintf("renamed to %q", name)})
+			}
+		}
+	}
+	return changes
+}
+
+func migrate06To07(policy map[string]interface{}) []MigrationChange {
+	var changes []MigrationChange
+	for key, value := range policy {
+		if !strings.EqualFold(key, "subject") {
+			continue
+		}
+		delete(policy, key)
+		subject, _ := value.(map[string]interface{})
+		members := attribute(subject, "members")
+		if members == nil {
+			members = []interface{}{}
+		}
+		policy["subjects"] = members
+		changes = append(changes, MigrationChange{Pointer: "/" + key, Description: "subject members converted to subjects"})
+	}
+
+	changes = append(changes, renameAttributes(policy, policyAttributes, "")...)
+	if meta, ok := policy["meta"].(map[string]interface{}); ok {
+		changes = append(changes, renameAttributes(meta, metaAttributes, "/meta")...)
+	}
+
+	if actions, ok := policy["actions"].([]interface{}); ok {
+		for i, action := range actions {
+			if actionObject, ok := action.(map[string]interface{}); ok {
+				actions[i] = attribute(actionObject, "actionUri")
+				changes = append(changes, MigrationChange{Pointer: fmt.Sprintf("/actions/%d", i), Description: "actionUri converted to an action"})
+			}
+		}
+	}
+
+	if object, ok := policy["object"].(map[string]interface{}); ok {
+		resourceId, _ := attribute(object, "resource_id").(string)
+		policy["object"] = resourceId
+		changes = append(changes, MigrationChange{Pointer: "/object", Description: "resource_id converted to an object"})
+	}
+	return changes
+}
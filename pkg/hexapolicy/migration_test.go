@@ -0,0 +1,147 @@
+package hexapolicy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, -1, CompareVersions("0.5", "0.6"))
+	assert.Equal(t, -1, CompareVersions("0.6", "0.6.15"))
+	assert.Equal(t, -1, CompareVersions("0.6.15", "0.7"))
+	assert.Equal(t, 1, CompareVersions("0.10", "0.7"))
+	assert.Equal(t, 0, CompareVersions("0.7", "0.7.0"))
+}
+
+func TestMigrations(t *testing.T) {
+	registered := Migrations()
+	assert.Len(t, registered, 2)
+	assert.Equal(t, "0.5", registered[0].From)
+	assert.Equal(t, "0.6", registered[1].From)
+	assert.Equal(t, IdqlVersion, registered[len(registered)-1].To)
+}
+
+func TestMigratePolicies(t *testing.T) {
+	_, file, _, _ := runtime.Caller(0)
+	legacyBytes, err := os.ReadFile(filepath.Join(file, "..", "test", "legacyPolicies.json"))
+	assert.NoError(t, err)
+
+	policies, report, err := MigratePolicies(legacyBytes)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+	assert.Equal(t, SubjectInfo{"anyAuthenticated"}, policies[0].Subjects)
+	assert.Equal(t, []ActionInfo{"can_read_user"}, policies[0].Actions)
+	assert.Equal(t, ObjectInfo("todo"), policies[0].Object)
+	assert.Equal(t, IdqlVersion, policies[0].Meta.Version)
+
+	assert.True(t, report.Changed())
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, PolicyMigration{
+		Index:    0,
+		PolicyId: "GetUsers",
+		From:     "0.6",
+		To:       IdqlVersion,
+		Changes: []MigrationChange{
+			{From: "0.6", To: "0.7", Pointer: "/subject", Description: "subject members converted to subjects"},
+			{From: "0.6", To: "0.7", Pointer: "/actions/0", Description: "actionUri converted to an action"},
+			{From: "0.6", To: "0.7", Pointer: "/object", Description: "resource_id converted to an object"},
+			{From: "0.6", To: "0.7", Pointer: "/meta/version", Description: "version 0.6 changed to 0.7"},
+		},
+	}, report.Policies[0])
+	assert.Contains(t, report.String(), "2 of 2 policies migrated to IDQL 0.7:\npolicy 0 (GetUsers): 0.6 -> 0.7\n  /subject: subject members converted to subjects")
+
+	// The migrated policies are valid IDQL 0.7
+	policyBytes, err := json.Marshal(Policies{Policies: policies})
+	assert.NoError(t, err)
+	issues, err := ValidateSchema(policyBytes)
+	assert.NoError(t, err)
+	assert.Nil(t, issues)
+
+	_, report, err = MigratePolicies(policyBytes)
+	assert.NoError(t, err)
+	assert.False(t, report.Changed())
+	assert.Equal(t, "no migration required: all 2 policies are IDQL 0.7", report.String())
+}
+
+func TestMigratePolicy(t *testing.T) {
+	// A policy labelled 0.7 that uses the 0.6 action form
+	policy := map[string]interface{}{
+		"meta":     map[string]interface{}{"version": "0.7"},
+		"subjects": []interface{}{"any"},
+		"actions":  []interface{}{map[string]interface{}{"actionUri": "http:GET:/"}},
+		"object":   "aResourceId",
+	}
+	from, changes, err := MigratePolicy(policy)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.7", from)
+	assert.Equal(t, []MigrationChange{{From: "0.6", To: "0.7", Pointer: "/actions/0", Description: "actionUri converted to an action"}}, changes)
+	assert.Equal(t, []interface{}{"http:GET:/"}, policy["actions"])
+
+	// A 0.5 policy with capitalized attribute names is migrated through 0.6
+	policy = map[string]interface{}{
+		"Meta":    map[string]interface{}{"Version": "0.5", "PolicyId": "p1"},
+		"Actions": []interface{}{"cedar:Action::view"},
+		"Subject": map[string]interface{}{"Members": []interface{}{"User:\"alice\""}},
+		"Object":  "cedar:Photo::\"VacationPhoto94.jpg\"",
+	}
+	from, changes, err = MigratePolicy(policy)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.5", from)
+	assert.Equal(t, []interface{}{"User:\"alice\""}, policy["subjects"])
+	assert.Equal(t, map[string]interface{}{"version": "0.7", "policyId": "p1"}, policy["meta"])
+	assert.Equal(t, "cedar:Photo::\"VacationPhoto94.jpg\"", policy["object"])
+	assert.Len(t, changes, 7)
+
+	// An unversioned policy only has its version added
+	policy = map[string]interface{}{"subjects": []interface{}{"any"}}
+	from, changes, err = MigratePolicy(policy)
+	assert.NoError(t, err)
+	assert.Equal(t, "", from)
+	assert.Equal(t, []MigrationChange{{From: "", To: "0.7", Pointer: "/meta/version", Description: "version 0.7 added"}}, changes)
+
+	// A policy from a newer IDQL version is not changed
+	policy = map[string]interface{}{"meta": map[string]interface{}{"version": "0.8"}, "subjects": []interface{}{"any"}}
+	from, changes, err = MigratePolicy(policy)
+	assert.ErrorContains(t, err, "IDQL version 0.8 is newer")
+	assert.Equal(t, "0.8", from)
+	assert.Nil(t, changes)
+	assert.Equal(t, map[string]interface{}{"version": "0.8"}, policy["meta"])
+
+	_, _, err = MigratePolicies([]byte(`[{"meta": {"version": "0.10"}, "subjects": ["any"]}]`))
+	assert.ErrorContains(t, err, "policy 0: IDQL version 0.10 is newer")
+
+	// The parser reads a newer policy without changing its version
+	var newer PolicyInfo
+	assert.NoError(t, json.Unmarshal([]byte(`{"meta": {"version": "0.8"}, "subjects": ["any"], "actions": ["read"], "object": "a"}`), &newer))
+	assert.Equal(t, "0.8", newer.Meta.Version)
+	assert.Equal(t, SubjectInfo{"any"}, newer.Subjects)
+}
+
+func TestRegisterMigration(t *testing.T) {
+	original := Migrations()
+	defer func() {
+		migrationLock.Lock()
+		migrations = original
+		migrationLock.Unlock()
+	}()
+
+	RegisterMigration(Migration{
+		From: "0.6",
+		To:   "0.7",
+		Migrate: func(policy map[string]interface{}) []MigrationChange {
+			policy["object"] = "replaced"
+			return []MigrationChange{{Pointer: "/object", Description: "replaced"}}
+		},
+	})
+	assert.Len(t, Migrations(), 2, "a migration from the same version replaces the existing one")
+
+	policies, report, err := MigratePolicies([]byte(`{"meta": {"version": "0.6"}, "object": "anObject"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, ObjectInfo("replaced"), policies[0].Object)
+	assert.Equal(t, "/object", report.Policies[0].Changes[0].Pointer)
+}
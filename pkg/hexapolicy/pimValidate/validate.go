@@ -184,6 +184,10 @@ func (v *Validator) checkOperand(operand types.Value) (string, error) {
 				if attr == nil {
 					return "error", errors.New(fmt.Sprintf("invalid condition attribute: %s", value.String()))
 				}
+				if attr.Type == policyInfoModel.TypeBoolean {
+					// Cedar JSON schema uses Boolean where IDQL uses Bool
+					return policyInfoModel.TypeBool, nil
+				}
 				return attr.Type, nil
 			}
 		}
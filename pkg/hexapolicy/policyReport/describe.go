@@ -0,0 +1,104 @@
+package policyReport
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions/parser"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
+)
+
+var operatorPhrases = map[parser.CompareOperator]string{
+	parser.PR: "is present",
+	parser.EQ: "equals",
+	parser.NE: "does not equal",
+	parser.CO: "contains",
+	parser.IN: "is in",
+	parser.SW: "starts with",
+	parser.EW: "ends with",
+	parser.GT: "is greater than",
+	parser.LT: "is less than",
+	parser.GE: "is greater than or equal to",
+	parser.LE: "is less than or equal to",
+	parser.IS: "is a",
+}
+
+// DescribeCondition describes the condition rule in plain English (see DescribeExpression)
+func DescribeCondition(condition conditions.ConditionInfo) (string, error) {
+	ast, err := condition.Ast()
+	if err != nil {
+		return "", err
+	}
+	return DescribeExpression(ast), nil
+}
+
+// DescribeRule parses an IDQL condition rule and describes it in plain English
+func DescribeRule(rule string) (string, error) {
+	ast, err := parser.ParseFilter(rule)
+	if err != nil {
+		return "", err
+	}
+	return DescribeExpression(ast), nil
+}
+
+/*
+DescribeExpression describes a parsed condition in plain English. For example:
+
+	subject.department eq "Sales" and not (subject.level lt 5)
+
+is described as
+
+	subject.department equals Sales and not (subject.level is less than 5)
+*/
+func DescribeExpression(expression parser.Expression) string {
+	switch exp := expression.(type) {
+	case parser.LogicalExpression:
+		return fmt.Sprintf("%s %s %s", DescribeExpression(exp.Left), exp.Operator, DescribeExpression(exp.Right))
+	case parser.PrecedenceExpression:
+		return fmt.Sprintf("(%s)", DescribeExpression(exp.Expression))
+	case parser.NotExpression:
+		if _, ok := exp.Expression.(parser.PrecedenceExpression); ok {
+			return "not " + DescribeExpression(exp.Expression)
+		}
+		return fmt.Sprintf("not (%s)", DescribeExpression(exp.Expression))
+	case parser.AttributeExpression:
+		return describeComparison(exp.AttributePath.String(), exp.Operator, exp.CompareValue)
+	case parser.ValuePathExpression:
+		filter := DescribeExpression(exp.VPathFilter)
+		if exp.Operator == nil || (*exp.Operator == parser.PR && exp.SubAttr == nil) {
+			if exp.SubAttr != nil {
+				return fmt.Sprintf("%s of %s entries where %s", *exp.SubAttr, exp.Attribute.String(), filter)
+			}
+			return fmt.Sprintf("%s has an entry where %s", exp.Attribute.String(), filter)
+		}
+		attribute := fmt.Sprintf("%s entries (where %s)", exp.Attribute.String(), filter)
+		if exp.SubAttr != nil {
+			attribute = fmt.Sprintf("%s of %s", *exp.SubAttr, attribute)
+		}
+		return describeComparison(attribute, *exp.Operator, exp.CompareValue)
+	}
+	return expression.String()
+}
+
+func describeComparison(attribute string, operator parser.CompareOperator, value types.Value) string {
+	phrase, ok := operatorPhrases[operator]
+	if !ok {
+		phrase = string(operator)
+	}
+	if operator == parser.PR || value == nil {
+		return fmt.Sprintf("%s %s", attribute, phrase)
+	}
+	return fmt.Sprintf("%s %s %s", attribute, phrase, describeValue(value))
+}
+
+// describeValue renders strings without quotes unless they contain spaces or are empty
+func describeValue(value types.Value) string {
+	if value.ValueType() == types.TypeString {
+		text, _ := value.Value().(string)
+		if text != "" && !strings.ContainsAny(text, " \t\n") {
+			return text
+		}
+	}
+	return value.String()
+}
@@ -0,0 +1,374 @@
+// Package policyReport renders a set of IDQL policies as a human-readable document (Markdown or standalone HTML)
+// describing what an application allows. Policies are grouped by object and then by action, conditions are described
+// in plain English, and when a Policy Information Model is provided, objects and actions are described using the
+// model's entity and action types.
+package policyReport
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/models/policyInfoModel"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
+)
+
+const (
+	FormatMarkdown string = "md"
+	FormatHtml     string = "html"
+)
+
+//go:embed resources/*.tmpl
+var templates embed.FS
+
+// Rule describes a policy that permits an action on an object
+type Rule struct {
+	Index        int        // Index is the position of the policy in the policies reported
+	PolicyId     string     // PolicyId is meta.policyId, if set
+	Description  string     // Description is meta.description
+	Subjects     []string   // Subjects describes each policy subject
+	Condition    string     // Condition is the condition rule described in plain English
+	Rule         string     // Rule is the IDQL condition rule as written in the policy
+	Deny         bool       // Deny is true when the condition action is deny (the policy applies unless the condition is met)
+	Scope        string     // Scope describes the policy scope (filter and attributes)
+	Version      string     // Version is the IDQL version of the policy
+	PapId        string     // PapId is the source Policy Application Point
+	ProviderType string     // ProviderType is the provider the policy was retrieved from
+	Modified     *time.Time // Modified is the time the policy was last changed
+}
+
+// Source describes where the policy came from (PAP, provider, and version), or "" when unknown
+func (r Rule) Source() string {
+	var parts []string
+	if r.PapId != "" {
+		parts = append(parts, "PAP "+r.PapId)
+	}
+	if r.ProviderType != "" {
+		parts = append(parts, "provider "+r.ProviderType)
+	}
+	if r.Version != "" {
+		parts = append(parts, "IDQL "+r.Version)
+	}
+	if r.Modified != nil {
+		parts = append(parts, "modified "+r.Modified.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Name is the policy id or, when the policy has no id, its position
+func (r Rule) Name() string {
+	if r.PolicyId != "" {
+		return r.PolicyId
+	}
+	return fmt.Sprintf("Policy-%d", r.Index)
+}
+
+// ActionGroup lists the rules that permit Action on an object
+type ActionGroup struct {
+	Action     string   // Action is the IDQL action, or "" for policies without actions
+	ModelType  string   // ModelType is the Policy Information Model action (e.g. PhotoApp::Action::"view"), if found
+	Principals []string // Principals are the principal types the model action applies to
+	Resources  []string // Resources are the resource types the model action applies to
+	Rules      []Rule
+}
+
+// Title describes the action
+func (a ActionGroup) Title() string {
+	if a.Action == "" {
+		return "All actions"
+	}
+	return a.Action
+}
+
+// ObjectGroup lists the actions permitted on Object
+type ObjectGroup struct {
+	Object     string   // Object is the IDQL object, or "" for policies that apply to all objects
+	ModelType  string   // ModelType is the Policy Information Model entity type (e.g. PhotoApp::Photo), if found
+	Attributes []string // Attributes are the model entity type's attributes (name: type)
+	Actions    []ActionGroup
+}
+
+// Title describes the object
+func (o ObjectGroup) Title() string {
+	if o.Object == "" {
+		return "All objects"
+	}
+	return o.Object
+}
+
+// Report is a description of a set of policies grouped by object and action
+type Report struct {
+	Title     string
+	App       string
+	Generated time.Time
+	Policies  int      // Policies is the number of policies reported
+	Issues    []string // Issues are problems found while describing policies (e.g. conditions that could not be parsed)
+	Objects   []ObjectGroup
+}
+
+/*
+NewReport groups policies by object and action. When namespaces (a Policy Information Model) is provided, objects and
+actions are matched to the model's entity and action types, using defNamespace for entities that do not include a
+namespace (e.g. Photo:vacation.jpg).
+*/
+func NewReport(policies hexapolicy.Policies, namespaces *policyInfoModel.Namespaces, defNamespace string) *Report {
+	report := &Report{
+		Title:     "Policy Report",
+		Generated: time.Now().UTC(),
+		Policies:  len(policies.Policies),
+	}
+	if policies.App != nil {
+		report.App = *policies.App
+		report.Title = "Policy Report: " + report.App
+	}
+
+	objects := map[string]map[string][]Rule{}
+	for i, policy := range policies.Policies {
+		rule := newRule(i, policy)
+		if policy.Condition != nil && rule.Condition == "" {
+			report.Issues = append(report.Issues, fmt.Sprintf("%s: condition could not be parsed: %s", rule.Name(), rule.Rule))
+		}
+
+		object := policy.Object.String()
+		actions, ok := objects[object]
+		if !ok {
+			actions = map[string][]Rule{}
+			objects[object] = actions
+		}
+		if len(policy.Actions) == 0 {
+			actions[""] = append(actions[""], rule)
+		}
+		for _, action := range policy.Actions {
+			actions[action.String()] = append(actions[action.String()], rule)
+		}
+	}
+
+	for _, object := range sortedKeys(objects) {
+		group := ObjectGroup{Object: object}
+		describeObject(&group, namespaces, defNamespace)
+		for _, action := range sortedKeys(objects[object]) {
+			actionGroup := ActionGroup{Action: action, Rules: objects[object][action]}
+			describeAction(&actionGroup, namespaces, defNamespace)
+			group.Actions = append(group.Actions, actionGroup)
+		}
+		report.Objects = append(report.Objects, group)
+	}
+	return report
+}
+
+func newRule(index int, policy hexapolicy.PolicyInfo) Rule {
+	rule := Rule{
+		Index:        index,
+		Description:  policy.Meta.Description,
+		Version:      policy.Meta.Version,
+		ProviderType: policy.Meta.ProviderType,
+		Modified:     policy.Meta.Modified,
+	}
+	if policy.Meta.PolicyId != nil {
+		rule.PolicyId = *policy.Meta.PolicyId
+	}
+	if policy.Meta.PapId != nil {
+		rule.PapId = *policy.Meta.PapId
+	}
+	for _, subject := range policy.Subjects {
+		rule.Subjects = append(rule.Subjects, DescribeSubject(subject))
+	}
+	if len(rule.Subjects) == 0 {
+		rule.Subjects = []string{"No subjects"}
+	}
+	if policy.Condition != nil {
+		rule.Rule = policy.Condition.Rule
+		rule.Deny = strings.EqualFold(policy.Condition.Action, conditions.ADeny)
+		rule.Condition, _ = DescribeCondition(*policy.Condition)
+	}
+	if policy.Scope != nil {
+		rule.Scope = describeScope(*policy.Scope)
+	}
+	return rule
+}
+
+// DescribeSubject describes the any and anyAuthenticated subjects, other subjects are returned as is
+func DescribeSubject(subject string) string {
+	switch {
+	case strings.EqualFold(subject, hexapolicy.SubjectAnyUser):
+		return "Anyone (including anonymous users)"
+	case strings.EqualFold(subject, hexapolicy.SubjectAnyAuth):
+		return "Any authenticated user"
+	}
+	return subject
+}
+
+func describeScope(scope hexapolicy.ScopeInfo) string {
+	var parts []string
+	if scope.Filter != nil && *scope.Filter != "" {
+		filter := scope.Value()
+		if scope.Type() == hexapolicy.ScopeTypeIDQL {
+			if described, err := DescribeRule(filter); err == nil {
+				filter = described
+			}
+		}
+		parts = append(parts, "limited to "+filter)
+	}
+	if len(scope.Attributes) > 0 {
+		parts = append(parts, "returning "+strings.Join(scope.Attributes, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// modelSchema returns the model namespace and schema for entity, or nil if the namespace is not in the model
+func modelSchema(entity *types.Entity, namespaces *policyInfoModel.Namespaces, defNamespace string) (string, *policyInfoModel.SchemaType) {
+	if namespaces == nil || entity == nil {
+		return "", nil
+	}
+	namespace := entity.GetNamespace(defNamespace)
+	schema, ok := (*namespaces)[namespace]
+	if !ok {
+		return namespace, nil
+	}
+	return namespace, &schema
+}
+
+func describeObject(group *ObjectGroup, namespaces *policyInfoModel.Namespaces, defNamespace string) {
+	if group.Object == "" {
+		return
+	}
+	entity := types.ParseEntity(group.Object)
+	namespace, schema := modelSchema(entity, namespaces, defNamespace)
+	if schema == nil {
+		return
+	}
+	entityType, ok := schema.EntityTypes[entity.GetType()]
+	if !ok {
+		return
+	}
+	group.ModelType = fmt.Sprintf("%s::%s", namespace, entity.GetType())
+	for _, name := range sortedKeys(entityType.Shape.Attributes) {
+		group.Attributes = append(group.Attributes, fmt.Sprintf("%s: %s", name, describeAttrType(entityType.Shape.Attributes[name])))
+	}
+}
+
+func describeAttrType(attr policyInfoModel.AttrType) string {
+	switch {
+	case attr.Type == policyInfoModel.TypeSet && attr.Element != nil:
+		return "Set of " + describeAttrType(*attr.Element)
+	case attr.Name != "":
+		return fmt.Sprintf("%s (%s)", attr.Type, attr.Name)
+	}
+	return attr.Type
+}
+
+func describeAction(group *ActionGroup, namespaces *policyInfoModel.Namespaces, defNamespace string) {
+	if group.Action == "" {
+		return
+	}
+	entity := types.ParseEntity(group.Action)
+	namespace, schema := modelSchema(entity, namespaces, defNamespace)
+	if schema == nil || entity.Id == nil {
+		return
+	}
+	actionType, ok := schema.Actions[entity.GetId()]
+	if !ok {
+		return
+	}
+	group.ModelType = fmt.Sprintf("%s::Action::%q", namespace, entity.GetId())
+	if actionType.AppliesTo.PrincipalTypes != nil {
+		group.Principals = *actionType.AppliesTo.PrincipalTypes
+	}
+	if actionType.AppliesTo.ResourceTypes != nil {
+		group.Resources = *actionType.AppliesTo.ResourceTypes
+	}
+}
+
+// ObjectCount is the number of objects reported
+func (r *Report) ObjectCount() int {
+	return len(r.Objects)
+}
+
+// Markdown renders the report as a Markdown document
+func (r *Report) Markdown() (string, error) {
+	tmpl, err := template.New("report.md.tmpl").Funcs(template.FuncMap{
+		"code":  markdownCode,
+		"text":  markdownText,
+		"join":  strings.Join,
+		"mdate": formatDate,
+	}).ParseFS(templates, "resources/report.md.tmpl")
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err = tmpl.Execute(buf, r); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Html renders the report as a standalone HTML document
+func (r *Report) Html() (string, error) {
+	tmpl, err := htmltemplate.New("report.html.tmpl").Funcs(htmltemplate.FuncMap{
+		"join":  strings.Join,
+		"mdate": formatDate,
+	}).ParseFS(templates, "resources/report.html.tmpl")
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err = tmpl.Execute(buf, r); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Render renders the report in format (FormatMarkdown or FormatHtml)
+func (r *Report) Render(format string) ([]byte, error) {
+	var doc string
+	var err error
+	switch strings.ToLower(format) {
+	case FormatMarkdown, "markdown", "":
+		doc, err = r.Markdown()
+	case FormatHtml, "htm":
+		doc, err = r.Html()
+	default:
+		return nil, fmt.Errorf("unsupported report format: %s", format)
+	}
+	return []byte(doc), err
+}
+
+func formatDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// markdownCode renders value as inline code, using a longer fence when value contains backticks
+func markdownCode(value string) string {
+	fence := "`"
+	for strings.Contains(value, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(value, "`") || strings.HasSuffix(value, "`") {
+		return fence + " " + value + " " + fence
+	}
+	return fence + value + fence
+}
+
+var markdownEscaper = strings.NewReplacer("\\", "\\\\", "*", "\\*", "_", "\\_", "`", "\\`", "[", "\\[", "]", "\\]",
+	"<", "&lt;", ">", "&gt;", "|", "\\|", "\n", " ")
+
+// markdownText escapes characters that Markdown would otherwise interpret as formatting
+func markdownText(value string) string {
+	return markdownEscaper.Replace(value)
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,161 @@
+package policyReport
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/models/policyInfoModel"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeRule(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{`subject.department eq "Sales" and subject.level ge 5`, "subject.department equals Sales and subject.level is greater than or equal to 5"},
+		{`not (subject.type eq "contractor")`, "not (subject.type equals contractor)"},
+		{`subject.title sw "VP" or (subject.manager pr and subject.region ne "EU West")`, `subject.title starts with VP or (subject.manager is present and subject.region does not equal "EU West")`},
+		{`subject.roles co "admin"`, "subject.roles contains admin"},
+		{`subject.emails[type eq "work"] pr`, "subject.emails has an entry where type equals work"},
+		{`subject.emails[type eq "work"].value ew "example.com"`, "value of subject.emails entries (where type equals work) ends with example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := DescribeRule(tt.rule)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := DescribeRule("subject.department eq Sales and")
+	assert.Error(t, err)
+}
+
+func testPolicies() hexapolicy.Policies {
+	app := "PhotoApp"
+	viewId := "viewPolicy"
+	papId := "pap1"
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	return hexapolicy.Policies{
+		App: &app,
+		Policies: []hexapolicy.PolicyInfo{
+			{
+				Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion, PolicyId: &viewId, PapId: &papId, ProviderType: "avp", Description: "Sales can view", Modified: &modified},
+				Subjects: hexapolicy.SubjectInfo{hexapolicy.SubjectAnyAuth},
+				Actions:  []hexapolicy.ActionInfo{"PhotoApp:Action:\"viewPhoto\"", "PhotoApp:Action:\"listPhotos\""},
+				Object:   "PhotoApp:Photo:\"vacation.jpg\"",
+				Condition: &conditions.ConditionInfo{
+					Rule:   `subject.department eq "Sales"`,
+					Action: conditions.AAllow,
+				},
+			},
+			{
+				Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+				Subjects: hexapolicy.SubjectInfo{"PhotoApp:User:\"alice\""},
+				Actions:  []hexapolicy.ActionInfo{"PhotoApp:Action:\"viewPhoto\""},
+				Object:   "PhotoApp:Photo:\"vacation.jpg\"",
+				Condition: &conditions.ConditionInfo{
+					Rule:   `context.authenticated eq false`,
+					Action: conditions.ADeny,
+				},
+			},
+			{
+				Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+				Subjects: hexapolicy.SubjectInfo{hexapolicy.SubjectAnyUser},
+				Object:   "",
+				Condition: &conditions.ConditionInfo{
+					Rule: "subject.level gt 5 and",
+				},
+			},
+		},
+	}
+}
+
+func loadModel(t *testing.T) *policyInfoModel.Namespaces {
+	_, file, _, _ := runtime.Caller(0)
+	schemaBytes, err := os.ReadFile(filepath.Join(file, "..", "..", "..", "..", "models", "policyInfoModel", "test", "photoSchema.json"))
+	assert.NoError(t, err)
+	namespaces, err := policyInfoModel.ParseSchemaFile(schemaBytes)
+	assert.NoError(t, err)
+	return namespaces
+}
+
+func TestNewReport(t *testing.T) {
+	report := NewReport(testPolicies(), loadModel(t), "PhotoApp")
+
+	assert.Equal(t, "Policy Report: PhotoApp", report.Title)
+	assert.Equal(t, 3, report.Policies)
+	assert.Equal(t, []string{"Policy-2: condition could not be parsed: subject.level gt 5 and"}, report.Issues)
+	assert.Len(t, report.Objects, 2)
+
+	all := report.Objects[0]
+	assert.Equal(t, "All objects", all.Title())
+	assert.Len(t, all.Actions, 1)
+	assert.Equal(t, "All actions", all.Actions[0].Title())
+
+	photo := report.Objects[1]
+	assert.Equal(t, "PhotoApp::Photo", photo.ModelType)
+	assert.Contains(t, photo.Attributes, "private: Boolean")
+	assert.Len(t, photo.Actions, 2)
+	assert.Equal(t, "PhotoApp:Action:\"listPhotos\"", photo.Actions[0].Action)
+
+	view := photo.Actions[1]
+	assert.Equal(t, "PhotoApp::Action::\"viewPhoto\"", view.ModelType)
+	assert.Equal(t, []string{"User", "UserGroup"}, view.Principals)
+	assert.Len(t, view.Rules, 2)
+	assert.Equal(t, "viewPolicy", view.Rules[0].Name())
+	assert.Equal(t, []string{"Any authenticated user"}, view.Rules[0].Subjects)
+	assert.Equal(t, "subject.department equals Sales", view.Rules[0].Condition)
+	assert.Equal(t, "PAP pap1, provider avp, IDQL 0.7, modified 2024-05-01T10:00:00Z", view.Rules[0].Source())
+	assert.True(t, view.Rules[1].Deny)
+	assert.Equal(t, "Policy-1", view.Rules[1].Name())
+
+	// Without a model, objects and actions are reported as is
+	report = NewReport(testPolicies(), nil, "")
+	assert.Equal(t, "", report.Objects[1].ModelType)
+	assert.Nil(t, report.Objects[1].Actions[1].Principals)
+}
+
+func TestReport_Markdown(t *testing.T) {
+	report := NewReport(testPolicies(), loadModel(t), "PhotoApp")
+	report.Generated = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	doc, err := report.Render(FormatMarkdown)
+	assert.NoError(t, err)
+	md := string(doc)
+	assert.True(t, strings.HasPrefix(md, "# Policy Report: PhotoApp\n\nGenerated 2024-06-01T00:00:00Z from 3 policies covering 2 objects."))
+	assert.Contains(t, md, "## Object: All objects")
+	assert.Contains(t, md, "## Object: `PhotoApp:Photo:\"vacation.jpg\"`\n\nEntity type `PhotoApp::Photo`")
+	assert.Contains(t, md, "### Action: `PhotoApp:Action:\"viewPhoto\"`\n\nModel action `PhotoApp::Action::\"viewPhoto\"`, for principals User, UserGroup on resources Photo")
+	assert.Contains(t, md, "- **viewPolicy**: Sales can view\n  - Subjects: `Any authenticated user`\n  - Condition: when subject.department equals Sales\n  - Source: PAP pap1, provider avp, IDQL 0.7")
+	assert.Contains(t, md, "  - Condition: unless context.authenticated equals false")
+	assert.Contains(t, md, "  - Condition: `subject.level gt 5 and` (could not be parsed)")
+	assert.Contains(t, md, "## Issues\n\n- Policy-2: condition could not be parsed: subject.level gt")
+}
+
+func TestReport_Html(t *testing.T) {
+	report := NewReport(testPolicies(), nil, "")
+	doc, err := report.Render(FormatHtml)
+	assert.NoError(t, err)
+	html := string(doc)
+	assert.True(t, strings.HasPrefix(html, "<!DOCTYPE html>"))
+	assert.Contains(t, html, "<title>Policy Report: PhotoApp</title>")
+	assert.Contains(t, html, "<h3>Action: <code>PhotoApp:Action:&#34;viewPhoto&#34;</code></h3>")
+	assert.Contains(t, html, "<td>when subject.department equals Sales</td>")
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(html), "</html>"))
+
+	_, err = report.Render("pdf")
+	assert.EqualError(t, err, "unsupported report format: pdf")
+}
+
+func TestMarkdownEscaping(t *testing.T) {
+	assert.Equal(t, "``a`b``", markdownCode("a`b"))
+	assert.Equal(t, "a\\_b \\| c", markdownText("a_b | c"))
+}
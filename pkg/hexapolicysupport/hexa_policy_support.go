@@ -1,25 +1,100 @@
 package hexapolicysupport
 
 import (
+    "bufio"
+    "bytes"
     "encoding/json"
+    "errors"
+    "fmt"
+    "io"
     "os"
+    "path/filepath"
+    "strings"
 
     "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+    "gopkg.in/yaml.v3"
 )
 
-// ParsePolicyFile parses a file containing IDQL policy data in JSON form. The top level attribute is "policies" which
-// is an array of IDQL Policies ([]PolicyInfo)
+// Policy file formats
+const (
+    FormatJson      string = "json"  // An object with a "policies" array, an array of policies, or a single policy
+    FormatYaml      string = "yaml"  // The JSON forms in YAML. Multiple documents (separated by ---) are combined
+    FormatJsonLines string = "jsonl" // One JSON policy per line
+)
+
+/*
+FormatOf returns the policy file format implied by the extension of path (.yaml and .yml for FormatYaml, .jsonl and
+.ndjson for FormatJsonLines, .json for FormatJson). An empty string is returned for other extensions.
+*/
+func FormatOf(path string) string {
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".yaml", ".yml":
+        return FormatYaml
+    case ".jsonl", ".ndjson":
+        return FormatJsonLines
+    case ".json":
+        return FormatJson
+    }
+    return ""
+}
+
+// DetectFormat returns the format of policy data based on its content (see FormatJson, FormatYaml, FormatJsonLines).
+// Data starting with { or [ is treated as JSON (or JSON Lines) so that a malformed JSON file reports a JSON error.
+func DetectFormat(policyBytes []byte) string {
+    if json.Valid(policyBytes) {
+        return FormatJson
+    }
+    trimmed := bytes.TrimSpace(policyBytes)
+    if bytes.HasPrefix(trimmed, []byte("[")) {
+        return FormatJson
+    }
+    if bytes.HasPrefix(trimmed, []byte("{")) {
+        for _, line := range bytes.Split(trimmed, []byte("\n")) {
+            line = bytes.TrimSpace(line)
+            if len(line) > 0 && !json.Valid(line) {
+                return FormatJson
+            }
+        }
+        return FormatJsonLines
+    }
+    return FormatYaml
+}
+
+// ParsePolicyFile parses a file containing IDQL policy data. The format is determined by the file extension (see FormatOf)
+// or, if the extension is not recognized, by the content. See ParsePolicies.
 func ParsePolicyFile(path string) ([]hexapolicy.PolicyInfo, error) {
     policyBytes, err := os.ReadFile(path)
     if err != nil {
         return nil, err
     }
-    return ParsePolicies(policyBytes)
+    format := FormatOf(path)
+    if format == "" {
+        format = DetectFormat(policyBytes)
+    }
+    return ParsePoliciesFormat(policyBytes, format)
 }
 
-// ParsePolicies parses an array of bytes representing an IDQL policy data in JSON form. The top level attribute is "policies" which
-// is an array of IDQL Policies ([]PolicyInfo)
+// ParsePolicies parses an array of bytes representing IDQL policy data in JSON form. The top level attribute is "policies" which
+// is an array of IDQL Policies ([]PolicyInfo). An array of policies or a single policy is also accepted. YAML and JSON
+// Lines data is detected by content (see DetectFormat).
 func ParsePolicies(policyBytes []byte) ([]hexapolicy.PolicyInfo, error) {
+    return ParsePoliciesFormat(policyBytes, DetectFormat(policyBytes))
+}
+
+// ParsePoliciesFormat parses policy data in the specified format (FormatJson, FormatYaml or FormatJsonLines)
+func ParsePoliciesFormat(policyBytes []byte, format string) ([]hexapolicy.PolicyInfo, error) {
+    switch format {
+    case FormatYaml:
+        return parseYaml(policyBytes)
+    case FormatJsonLines:
+        return parseJsonLines(policyBytes)
+    case FormatJson, "":
+        return parseJson(policyBytes)
+    }
+    return nil, fmt.Errorf("unsupported policy format: %s", format)
+}
+
+func parseJson(policyBytes []byte) ([]hexapolicy.PolicyInfo, error) {
     var policies hexapolicy.Policies
     err := json.Unmarshal(policyBytes, &policies)
     if err != nil || policies.Policies == nil {
@@ -39,13 +114,181 @@ func ParsePolicies(policyBytes []byte) ([]hexapolicy.PolicyInfo, error) {
     return policies.Policies, nil
 }
 
+func parseJsonLines(policyBytes []byte) ([]hexapolicy.PolicyInfo, error) {
+    policies := []hexapolicy.PolicyInfo{}
+    scanner := bufio.NewScanner(bytes.NewReader(policyBytes))
+    scanner.Buffer(make([]byte, 0, 64*1024), len(policyBytes)+1)
+    lineNum := 0
+    for scanner.Scan() {
+        lineNum++
+        line := bytes.TrimSpace(scanner.Bytes())
+        if len(line) == 0 {
+            continue
+        }
+        var pol hexapolicy.PolicyInfo
+        if err := json.Unmarshal(line, &pol); err != nil {
+            return nil, fmt.Errorf("line %d: %w", lineNum, err)
+        }
+        policies = append(policies, pol)
+    }
+    return policies, scanner.Err()
+}
+
+// parseYaml converts each YAML document to JSON and parses it as with parseJson
+func parseYaml(policyBytes []byte) ([]hexapolicy.PolicyInfo, error) {
+    documents, err := yamlDocuments(policyBytes)
+    if err != nil {
+        return nil, err
+    }
+    policies := []hexapolicy.PolicyInfo{}
+    for i, document := range documents {
+        pols, err := parseJson(document)
+        if err != nil {
+            return nil, fmt.Errorf("yaml document %d: %w", i+1, err)
+        }
+        policies = append(policies, pols...)
+    }
+    return policies, nil
+}
+
+// yamlDocuments returns each non-empty YAML document in policyBytes converted to JSON
+func yamlDocuments(policyBytes []byte) ([][]byte, error) {
+    var documents [][]byte
+    decoder := yaml.NewDecoder(bytes.NewReader(policyBytes))
+    for docNum := 1; ; docNum++ {
+        var doc interface{}
+        err := decoder.Decode(&doc)
+        if errors.Is(err, io.EOF) {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("yaml document %d: %w", docNum, err)
+        }
+        if doc == nil {
+            continue
+        }
+        docBytes, err := json.Marshal(doc)
+        if err != nil {
+            return nil, fmt.Errorf("yaml document %d: %w", docNum, err)
+        }
+        documents = append(documents, docBytes)
+    }
+    return documents, nil
+}
+
+// MigratePolicyFile upgrades the policies in a file to the current IDQL version (see hexapolicy.MigratePolicies). The
+// file is not changed.
+func MigratePolicyFile(path string) ([]hexapolicy.PolicyInfo, *hexapolicy.MigrationReport, error) {
+    policyBytes, err := os.ReadFile(path)
+    if err != nil {
+        return nil, nil, err
+    }
+    format := FormatOf(path)
+    if format == "" {
+        format = DetectFormat(policyBytes)
+    }
+    return MigratePoliciesFormat(policyBytes, format)
+}
+
+// MigratePoliciesFormat upgrades policy data in the specified format to the current IDQL version. Each YAML document or
+// JSON line is migrated in turn, and the report indexes policies across the whole of the data.
+func MigratePoliciesFormat(policyBytes []byte, format string) ([]hexapolicy.PolicyInfo, *hexapolicy.MigrationReport, error) {
+    var documents [][]byte
+    switch format {
+    case FormatJson, "":
+        return hexapolicy.MigratePolicies(policyBytes)
+    case FormatJsonLines:
+        for _, line := range bytes.Split(policyBytes, []byte("\n")) {
+            if line = bytes.TrimSpace(line); len(line) > 0 {
+                documents = append(documents, line)
+            }
+        }
+    case FormatYaml:
+        var err error
+        if documents, err = yamlDocuments(policyBytes); err != nil {
+            return nil, nil, err
+        }
+    default:
+        return nil, nil, fmt.Errorf("unsupported policy format: %s", format)
+    }
+
+    policies := []hexapolicy.PolicyInfo{}
+    report := &hexapolicy.MigrationReport{Policies: []hexapolicy.PolicyMigration{}}
+    for i, document := range documents {
+        docPolicies, docReport, err := hexapolicy.MigratePolicies(document)
+        if err != nil {
+            return nil, nil, fmt.Errorf("document %d: %w", i+1, err)
+        }
+        for _, migration := range docReport.Policies {
+            migration.Index += len(policies)
+            report.Policies = append(report.Policies, migration)
+        }
+        policies = append(policies, docPolicies...)
+    }
+    report.Total = len(policies)
+    return policies, report, nil
+}
+
 func ToBytes(policies []hexapolicy.PolicyInfo) ([]byte, error) {
     pol := hexapolicy.Policies{Policies: policies}
     return json.Marshal(&pol)
 }
 
+// ToFormatBytes returns policies in the specified format (FormatJson, FormatYaml or FormatJsonLines)
+func ToFormatBytes(policies []hexapolicy.PolicyInfo, format string) ([]byte, error) {
+    switch format {
+    case FormatYaml:
+        return toYaml(policies)
+    case FormatJsonLines:
+        var buf bytes.Buffer
+        for _, policy := range policies {
+            policyBytes, err := json.Marshal(&policy)
+            if err != nil {
+                return nil, err
+            }
+            buf.Write(policyBytes)
+            buf.WriteByte('\n')
+        }
+        return buf.Bytes(), nil
+    case FormatJson, "":
+        return ToBytes(policies)
+    }
+    return nil, fmt.Errorf("unsupported policy format: %s", format)
+}
+
+// toYaml converts the JSON form of policies to YAML, preserving the order of the JSON attributes
+func toYaml(policies []hexapolicy.PolicyInfo) ([]byte, error) {
+    jsonBytes, err := ToBytes(policies)
+    if err != nil {
+        return nil, err
+    }
+    var node yaml.Node
+    if err = yaml.Unmarshal(jsonBytes, &node); err != nil {
+        return nil, err
+    }
+    clearStyle(&node)
+
+    var buf bytes.Buffer
+    encoder := yaml.NewEncoder(&buf)
+    encoder.SetIndent(2)
+    if err = encoder.Encode(&node); err != nil {
+        return nil, err
+    }
+    err = encoder.Close()
+    return buf.Bytes(), err
+}
+
+// clearStyle removes the JSON (flow) styles so that the default block YAML style is used
+func clearStyle(node *yaml.Node) {
+    node.Style = 0
+    for _, child := range node.Content {
+        clearStyle(child)
+    }
+}
+
+// WritePolicies writes policies to path in the format implied by its extension (see FormatOf), defaulting to FormatJson
 func WritePolicies(path string, policies []hexapolicy.PolicyInfo) error {
-    polBytes, err := ToBytes(policies)
+    polBytes, err := ToFormatBytes(policies, FormatOf(path))
     if err != nil {
         return err
     }
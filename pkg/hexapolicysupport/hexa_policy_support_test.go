@@ -1,10 +1,14 @@
 package hexapolicysupport_test
 
 import (
+    "encoding/json"
+    "errors"
     "fmt"
     "math/rand"
+    "os"
     "path/filepath"
     "runtime"
+    "strings"
     "testing"
     "time"
 
@@ -37,6 +41,112 @@ func TestWriteFile(t *testing.T) {
     assert.Equal(t, policies, policyCopy, "Check that the copy is the same as the original")
 }
 
+func TestReadFormats(t *testing.T) {
+    policies, err := hexapolicysupport.ParsePolicyFile(getFile())
+    assert.NoError(t, err)
+
+    yamlPolicies, err := hexapolicysupport.ParsePolicyFile(getTestFile("data.yaml"))
+    assert.NoError(t, err, "Multi-document yaml should parse")
+    assert.Equal(t, policies, yamlPolicies)
+
+    jsonlPolicies, err := hexapolicysupport.ParsePolicyFile(getTestFile("data.jsonl"))
+    assert.NoError(t, err)
+    assert.Equal(t, policies, jsonlPolicies)
+
+    // Formats are detected by content when there is no recognized extension
+    for _, name := range []string{"data.json", "data.yaml", "data.jsonl"} {
+        policyBytes, err := os.ReadFile(getTestFile(name))
+        assert.NoError(t, err)
+        parsed, err := hexapolicysupport.ParsePolicies(policyBytes)
+        assert.NoError(t, err, "File %s not parsed", name)
+        assert.Equal(t, policies, parsed)
+    }
+
+    _, err = hexapolicysupport.ParsePolicies([]byte("{\"meta\": {\"version\": \"0.7\"}}\n{\"meta\": bad}\n"))
+    assert.Error(t, err)
+
+    // Truncated JSON is still detected as JSON so the JSON syntax error is reported
+    policyBytes, err := os.ReadFile(getTestFile("data.json"))
+    assert.NoError(t, err)
+    truncated := policyBytes[:len(policyBytes)/2]
+    assert.Equal(t, hexapolicysupport.FormatJson, hexapolicysupport.DetectFormat(truncated))
+    _, err = hexapolicysupport.ParsePolicies(truncated)
+    var syntaxErr *json.SyntaxError
+    assert.True(t, errors.As(err, &syntaxErr), "expecting a JSON syntax error, got %v", err)
+    assert.Equal(t, hexapolicysupport.FormatJson, hexapolicysupport.DetectFormat([]byte("[{\"meta\": ")))
+    _, err = hexapolicysupport.ParsePoliciesFormat([]byte("{}"), "xml")
+    assert.EqualError(t, err, "unsupported policy format: xml")
+}
+
+func TestWriteFormats(t *testing.T) {
+    policies, err := hexapolicysupport.ParsePolicyFile(getFile())
+    assert.NoError(t, err)
+
+    dir := t.TempDir()
+    for _, name := range []string{"copy.yaml", "copy.yml", "copy.jsonl", "copy.policies"} {
+        path := filepath.Join(dir, name)
+        err = hexapolicysupport.WritePolicies(path, policies)
+        assert.NoError(t, err)
+        policyCopy, err := hexapolicysupport.ParsePolicyFile(path)
+        assert.NoError(t, err, "File %s not parsed", name)
+        assert.Equal(t, policies, policyCopy)
+    }
+
+    yamlBytes, err := hexapolicysupport.ToFormatBytes(policies[0:1], hexapolicysupport.FormatYaml)
+    assert.NoError(t, err)
+    assert.Equal(t, `policies:
+  - meta:
+      version: "0.7"
+    subjects:
+      - any
+    actions:
+      - http:GET:/
+    object: aResourceId
+    condition:
+      Rule: req.ip sw 127 and req.method eq POST
+      Action: allow
+`, string(yamlBytes))
+
+    jsonlBytes, err := hexapolicysupport.ToFormatBytes(policies, hexapolicysupport.FormatJsonLines)
+    assert.NoError(t, err)
+    assert.Equal(t, 4, strings.Count(string(jsonlBytes), "\n"))
+}
+
+func TestMigratePolicyFile(t *testing.T) {
+    policies, report, err := hexapolicysupport.MigratePolicyFile(getTestFile("oldPolicy.json"))
+    assert.NoError(t, err)
+    assert.Equal(t, len(policies), report.Total)
+    assert.Equal(t, len(policies), len(report.Policies))
+
+    // Current policies need no migration
+    _, report, err = hexapolicysupport.MigratePolicyFile(getTestFile("data.yaml"))
+    assert.NoError(t, err)
+    assert.False(t, report.Changed())
+    assert.Equal(t, 4, report.Total)
+
+    // Policies are indexed across JSON lines and YAML documents
+    lines := `{"meta":{"version":"0.7"},"subjects":["any"],"object":"a"}
+{"meta":{"version":"0.6"},"subject":{"members":["any"]},"object":"b"}
+`
+    policies, report, err = hexapolicysupport.MigratePoliciesFormat([]byte(lines), hexapolicysupport.FormatJsonLines)
+    assert.NoError(t, err)
+    assert.Equal(t, 2, len(policies))
+    assert.Equal(t, 1, len(report.Policies))
+    assert.Equal(t, 1, report.Policies[0].Index)
+
+    yamlDocs := "subjects: [any]\nobject: a\n---\nmeta:\n  version: \"0.6\"\nsubject:\n  members: [any]\nobject: b\n"
+    policies, report, err = hexapolicysupport.MigratePoliciesFormat([]byte(yamlDocs), hexapolicysupport.FormatYaml)
+    assert.NoError(t, err)
+    assert.Equal(t, "b", policies[1].Object.String())
+    assert.Equal(t, 2, len(report.Policies), "the unversioned policy has a version added")
+    assert.Equal(t, 1, report.Policies[1].Index)
+}
+
+func getTestFile(name string) string {
+    _, file, _, _ := runtime.Caller(0)
+    return filepath.Join(file, "../test", name)
+}
+
 func getFile() string {
     _, file, _, _ := runtime.Caller(0)
     return filepath.Join(file, "../test/data.json")
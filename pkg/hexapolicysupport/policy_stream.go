@@ -0,0 +1,399 @@
+package hexapolicysupport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+)
+
+/*
+PolicyError is returned by PolicyReader.Next when a policy could not be decoded. Index is the position of the policy in
+the stream (starting at 0) and Line and Offset locate the start of the policy (or, for syntax errors, the error) in the
+input. A reader may continue after a PolicyError unless Err is a *json.SyntaxError.
+*/
+type PolicyError struct {
+	Index  int
+	Line   int
+	Offset int64
+	Err    error
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("policy %d (line %d, offset %d): %v", e.Index, e.Line, e.Offset, e.Err)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// Reader states
+const (
+	readStart  = iota // nothing read yet
+	readArray         // reading an array of policies, either at the top level or as the value of "policies"
+	readValues        // reading a sequence of top level policies (e.g. JSON Lines)
+	readDone          // the end of input was reached
+	readFailed        // a syntax or read error occurred
+)
+
+/*
+PolicyReader decodes IDQL policies one at a time from an io.Reader so that very large policy sets do not have to be held
+in memory. The input may be an object with a "policies" array, an array of policies, a single policy, or a sequence of
+policies such as JSON Lines (FormatJsonLines). YAML is not streamed (see ParsePolicyFile).
+*/
+type PolicyReader struct {
+	lines   *lineCounter
+	decoder *json.Decoder
+	state   int
+	wrapped bool // the policies array is the value of "policies"
+	index   int
+	err     error
+	first   map[string]json.RawMessage // attributes of a top level object that turned out to be a single policy
+	start   int64
+}
+
+func NewPolicyReader(reader io.Reader) *PolicyReader {
+	lines := &lineCounter{reader: reader}
+	return &PolicyReader{lines: lines, decoder: json.NewDecoder(lines)}
+}
+
+// Index returns the number of policies read so far (including policies that returned a PolicyError)
+func (r *PolicyReader) Index() int {
+	return r.index
+}
+
+/*
+Next returns the next policy in the stream, or io.EOF when there are no more policies. A *PolicyError is returned when a
+policy could not be decoded. Syntax and read errors are returned by all subsequent calls.
+*/
+func (r *PolicyReader) Next() (*hexapolicy.PolicyInfo, error) {
+	if r.state == readFailed {
+		return nil, r.err
+	}
+	if r.state == readStart {
+		if err := r.readStart(); err != nil {
+			return nil, r.fail(err)
+		}
+		if r.first != nil {
+			// the top level object was a policy rather than a "policies" wrapper
+			first := r.first
+			r.first = nil
+			policyBytes, err := json.Marshal(first)
+			if err != nil {
+				return nil, r.fail(err)
+			}
+			return r.decodePolicy(policyBytes, r.start)
+		}
+	}
+
+	switch r.state {
+	case readArray:
+		if !r.decoder.More() {
+			if err := r.readEnd(); err != nil {
+				return nil, r.fail(err)
+			}
+			r.state = readDone
+			return nil, io.EOF
+		}
+	case readDone:
+		return nil, io.EOF
+	}
+
+	var raw json.RawMessage
+	if err := r.decoder.Decode(&raw); err != nil {
+		if r.state == readValues && errors.Is(err, io.EOF) {
+			r.state = readDone
+			return nil, io.EOF
+		}
+		return nil, r.fail(err)
+	}
+	// raw may include the whitespace that preceded the policy
+	policyBytes := bytes.TrimLeft(raw, " \t\r\n")
+	return r.decodePolicy(policyBytes, r.decoder.InputOffset()-int64(len(policyBytes)))
+}
+
+// ForEach calls fn for each policy in the stream, stopping at the first error returned by Next or fn
+func (r *PolicyReader) ForEach(fn func(policy hexapolicy.PolicyInfo) error) error {
+	for {
+		policy, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(*policy); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *PolicyReader) decodePolicy(data []byte, offset int64) (*hexapolicy.PolicyInfo, error) {
+	index := r.index
+	r.index++
+	var policy hexapolicy.PolicyInfo
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, &PolicyError{Index: index, Line: r.lines.lineAt(offset), Offset: offset, Err: err}
+	}
+	return &policy, nil
+}
+
+// readStart reads up to the first policy, determining the form of the input
+func (r *PolicyReader) readStart() error {
+	token, err := r.decoder.Token()
+	if errors.Is(err, io.EOF) {
+		r.state = readDone
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('['):
+		r.state = readArray
+		return nil
+	case json.Delim('{'):
+		r.start = r.decoder.InputOffset() - 1
+	default:
+		return fmt.Errorf("expecting a policy object or array but found %v", token)
+	}
+
+	fields := map[string]json.RawMessage{}
+	for r.decoder.More() {
+		token, err = r.decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		if strings.EqualFold(key, "policies") {
+			token, err = r.decoder.Token()
+			if err != nil {
+				return err
+			}
+			if token != json.Delim('[') {
+				return errors.New("expecting an array of policies for \"policies\"")
+			}
+			r.state = readArray
+			r.wrapped = true
+			return nil
+		}
+		var value json.RawMessage
+		if err = r.decoder.Decode(&value); err != nil {
+			return err
+		}
+		fields[key] = value
+	}
+	// consume the closing '}'
+	if _, err = r.decoder.Token(); err != nil {
+		return err
+	}
+	r.first = fields
+	r.state = readValues
+	return nil
+}
+
+// readEnd reads the end of the policies array and, if present, the remainder of the "policies" wrapper
+func (r *PolicyReader) readEnd() error {
+	if _, err := r.decoder.Token(); err != nil {
+		return err
+	}
+	if r.wrapped {
+		for r.decoder.More() {
+			var skip json.RawMessage
+			if _, err := r.decoder.Token(); err != nil {
+				return err
+			}
+			if err := r.decoder.Decode(&skip); err != nil {
+				return err
+			}
+		}
+		if _, err := r.decoder.Token(); err != nil {
+			return err
+		}
+	}
+	if _, err := r.decoder.Token(); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return err
+		}
+		return errors.New("unexpected data after the end of the policies")
+	}
+	return nil
+}
+
+func (r *PolicyReader) fail(err error) error {
+	var syntaxErr *json.SyntaxError
+	offset := r.decoder.InputOffset()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// the input ended part way through a policy
+		err = io.ErrUnexpectedEOF
+		offset = r.lines.read
+	} else if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	}
+	r.err = &PolicyError{Index: r.index, Line: r.lines.lineAt(offset), Offset: offset, Err: err}
+	r.state = readFailed
+	return r.err
+}
+
+/*
+lineCounter records the offsets of newlines read from reader so that a decoder offset can be converted to a line number.
+Offsets passed to lineAt must not decrease, which allows counted newlines to be discarded.
+*/
+type lineCounter struct {
+	reader   io.Reader
+	read     int64
+	newlines []int64
+	line     int
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			c.newlines = append(c.newlines, c.read+int64(i))
+		}
+	}
+	c.read += int64(n)
+	return n, err
+}
+
+// lineAt returns the line number (starting at 1) of offset
+func (c *lineCounter) lineAt(offset int64) int {
+	i := 0
+	for i < len(c.newlines) && c.newlines[i] < offset {
+		i++
+	}
+	c.line += i
+	c.newlines = c.newlines[i:]
+	return c.line + 1
+}
+
+/*
+PolicyWriter writes IDQL policies one at a time to an io.Writer in FormatJson (an object with a "policies" array) or
+FormatJsonLines. Close must be called to complete the output.
+*/
+type PolicyWriter struct {
+	writer *bufio.Writer
+	format string
+	count  int
+	err    error
+}
+
+func NewPolicyWriter(writer io.Writer, format string) (*PolicyWriter, error) {
+	switch format {
+	case FormatJson, "":
+		format = FormatJson
+	case FormatJsonLines:
+	default:
+		return nil, fmt.Errorf("unsupported streaming policy format: %s", format)
+	}
+	return &PolicyWriter{writer: bufio.NewWriter(writer), format: format}, nil
+}
+
+// Count returns the number of policies written
+func (w *PolicyWriter) Count() int {
+	return w.count
+}
+
+func (w *PolicyWriter) Write(policy hexapolicy.PolicyInfo) error {
+	if w.err != nil {
+		return w.err
+	}
+	policyBytes, err := json.Marshal(&policy)
+	if err != nil {
+		return err
+	}
+	if w.format == FormatJson {
+		if w.count == 0 {
+			_, w.err = w.writer.WriteString("{\"policies\":[")
+		} else {
+			w.err = w.writer.WriteByte(',')
+		}
+	}
+	if w.err == nil {
+		_, w.err = w.writer.Write(policyBytes)
+	}
+	if w.err == nil && w.format == FormatJsonLines {
+		w.err = w.writer.WriteByte('\n')
+	}
+	if w.err == nil {
+		w.count++
+	}
+	return w.err
+}
+
+// Close completes the output and flushes it to the underlying writer (which is not closed)
+func (w *PolicyWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.format == FormatJson {
+		if w.count == 0 {
+			_, w.err = w.writer.WriteString("{\"policies\":[")
+		}
+		if w.err == nil {
+			_, w.err = w.writer.WriteString("]}")
+		}
+	}
+	if w.err == nil {
+		w.err = w.writer.Flush()
+	}
+	return w.err
+}
+
+/*
+ReadPolicyFile calls fn for each policy in the file at path. JSON and JSON Lines files are streamed with a PolicyReader;
+YAML files are parsed in full (see ParsePolicyFile).
+*/
+func ReadPolicyFile(path string, fn func(policy hexapolicy.PolicyInfo) error) error {
+	if FormatOf(path) == FormatYaml {
+		policies, err := ParsePolicyFile(path)
+		if err != nil {
+			return err
+		}
+		for _, policy := range policies {
+			if err = fn(policy); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	return NewPolicyReader(file).ForEach(fn)
+}
+
+/*
+ReconcileReader reconciles the policies read from reader against the existing policies (see
+hexapolicy.Policies ReconcilePolicies), calling fn with each difference as it is found. Only the existing policies are
+held in memory. Policy deletions are reported once all policies have been read.
+*/
+func ReconcileReader(existing []hexapolicy.PolicyInfo, reader *PolicyReader, diffsOnly bool, fn func(dif hexapolicy.PolicyDif) error) error {
+	existingPolicies := hexapolicy.Policies{Policies: existing}
+	reconciler := existingPolicies.NewReconciler(diffsOnly)
+	err := reader.ForEach(func(policy hexapolicy.PolicyInfo) error {
+		if dif := reconciler.Compare(policy); dif != nil {
+			return fn(*dif)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, dif := range reconciler.Deletes() {
+		if err = fn(dif); err != nil {
+			return err
+		}
+	}
+	return nil
+}
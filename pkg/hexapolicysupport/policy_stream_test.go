@@ -0,0 +1,177 @@
+package hexapolicysupport_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicysupport"
+)
+
+func readAll(t *testing.T, reader *hexapolicysupport.PolicyReader) []hexapolicy.PolicyInfo {
+	var policies []hexapolicy.PolicyInfo
+	err := reader.ForEach(func(policy hexapolicy.PolicyInfo) error {
+		policies = append(policies, policy)
+		return nil
+	})
+	assert.NoError(t, err)
+	return policies
+}
+
+func TestPolicyReader(t *testing.T) {
+	policies, err := hexapolicysupport.ParsePolicyFile(getFile())
+	assert.NoError(t, err)
+
+	policyBytes, err := os.ReadFile(getFile())
+	assert.NoError(t, err)
+	jsonlBytes, err := os.ReadFile(getTestFile("data.jsonl"))
+	assert.NoError(t, err)
+	arrayBytes, err := json.MarshalIndent(policies, "", "  ")
+	assert.NoError(t, err)
+
+	for name, input := range map[string][]byte{
+		"wrapper": policyBytes,
+		"jsonl":   jsonlBytes,
+		"array":   arrayBytes,
+		"app":     []byte(`{"app": "anApp", "policies": ` + string(arrayBytes) + `, "extra": {"a": [1]}}`),
+	} {
+		reader := hexapolicysupport.NewPolicyReader(bytes.NewReader(input))
+		assert.Equal(t, policies, readAll(t, reader), name)
+		assert.Equal(t, 4, reader.Index(), name)
+
+		_, err = reader.Next()
+		assert.Equal(t, io.EOF, err, "%s: EOF is repeated", name)
+	}
+
+	single := hexapolicysupport.NewPolicyReader(strings.NewReader(`{"Subjects": ["any"], "Object": "anObject"}`))
+	assert.Equal(t, 1, len(readAll(t, single)))
+
+	empty := hexapolicysupport.NewPolicyReader(strings.NewReader(" "))
+	assert.Equal(t, 0, len(readAll(t, empty)))
+}
+
+func TestPolicyReader_Errors(t *testing.T) {
+	input := `{"subjects":["any"],"object":"a"}
+{"subjects":"notAnArray","object":"b"}
+{"subjects":["any"],"object":"c"}
+{"subjects":["any"],"object":
+`
+	reader := hexapolicysupport.NewPolicyReader(strings.NewReader(input))
+	policy, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", policy.Object.String())
+
+	_, err = reader.Next()
+	var policyErr *hexapolicysupport.PolicyError
+	assert.True(t, errors.As(err, &policyErr))
+	assert.Equal(t, 1, policyErr.Index)
+	assert.Equal(t, 2, policyErr.Line)
+	assert.Equal(t, int64(34), policyErr.Offset)
+	assert.Contains(t, err.Error(), "policy 1 (line 2, offset 34): json: cannot unmarshal string")
+
+	// The reader continues after a policy that could not be decoded
+	policy, err = reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "c", policy.Object.String())
+
+	_, err = reader.Next()
+	assert.True(t, errors.As(err, &policyErr))
+	assert.Equal(t, 3, policyErr.Index)
+	assert.Equal(t, 5, policyErr.Line)
+	assert.Equal(t, io.ErrUnexpectedEOF, policyErr.Err)
+
+	// syntax errors end the stream
+	_, err2 := reader.Next()
+	assert.Equal(t, err, err2)
+
+	reader = hexapolicysupport.NewPolicyReader(strings.NewReader("[\n  {\"subjects\": [\"any\"]},\n  {\"subjects\" [\"any\"]}\n]"))
+	_, err = reader.Next()
+	assert.NoError(t, err)
+	_, err = reader.Next()
+	assert.True(t, errors.As(err, &policyErr))
+	assert.Equal(t, 3, policyErr.Line)
+	assert.Contains(t, err.Error(), "invalid character '['")
+
+	reader = hexapolicysupport.NewPolicyReader(strings.NewReader(`{"policies": {}}`))
+	_, err = reader.Next()
+	assert.Contains(t, err.Error(), "expecting an array of policies")
+
+	reader = hexapolicysupport.NewPolicyReader(strings.NewReader(`[{"subjects": ["any"]}] [`))
+	_, err = reader.Next()
+	assert.NoError(t, err)
+	_, err = reader.Next()
+	assert.Contains(t, err.Error(), "unexpected data after the end of the policies")
+}
+
+func TestPolicyWriter(t *testing.T) {
+	policies, err := hexapolicysupport.ParsePolicyFile(getFile())
+	assert.NoError(t, err)
+
+	for _, format := range []string{hexapolicysupport.FormatJson, hexapolicysupport.FormatJsonLines} {
+		var buf bytes.Buffer
+		writer, err := hexapolicysupport.NewPolicyWriter(&buf, format)
+		assert.NoError(t, err)
+		for _, policy := range policies {
+			assert.NoError(t, writer.Write(policy))
+		}
+		assert.NoError(t, writer.Close())
+		assert.Equal(t, 4, writer.Count())
+
+		expected, err := hexapolicysupport.ToFormatBytes(policies, format)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), buf.String(), format)
+	}
+
+	var buf bytes.Buffer
+	writer, err := hexapolicysupport.NewPolicyWriter(&buf, hexapolicysupport.FormatJson)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, `{"policies":[]}`, buf.String())
+
+	_, err = hexapolicysupport.NewPolicyWriter(&buf, hexapolicysupport.FormatYaml)
+	assert.EqualError(t, err, "unsupported streaming policy format: yaml")
+}
+
+func TestReadPolicyFile(t *testing.T) {
+	policies, err := hexapolicysupport.ParsePolicyFile(getFile())
+	assert.NoError(t, err)
+
+	for _, name := range []string{"data.json", "data.jsonl", "data.yaml"} {
+		var read []hexapolicy.PolicyInfo
+		err = hexapolicysupport.ReadPolicyFile(getTestFile(name), func(policy hexapolicy.PolicyInfo) error {
+			read = append(read, policy)
+			return nil
+		})
+		assert.NoError(t, err, name)
+		assert.Equal(t, policies, read, name)
+	}
+}
+
+func TestReconcileReader(t *testing.T) {
+	policies, err := hexapolicysupport.ParsePolicyFile(getFile())
+	assert.NoError(t, err)
+
+	policyBytes, err := os.ReadFile(getTestFile("data.jsonl"))
+	assert.NoError(t, err)
+
+	// Remove the first policy and change the object of the last
+	existing := append([]hexapolicy.PolicyInfo{}, policies[1:]...)
+	existing[2].Object = "changedResource"
+	existingPolicies := hexapolicy.Policies{Policies: existing}
+	expected := existingPolicies.ReconcilePolicies(policies, true)
+
+	var difs []hexapolicy.PolicyDif
+	err = hexapolicysupport.ReconcileReader(existing, hexapolicysupport.NewPolicyReader(bytes.NewReader(policyBytes)), true, func(dif hexapolicy.PolicyDif) error {
+		difs = append(difs, dif)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, difs)
+	assert.Equal(t, 3, len(difs))
+}
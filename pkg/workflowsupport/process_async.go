@@ -1,6 +1,9 @@
 package workflowsupport
 
-import "sync"
+import (
+	"errors"
+	"sync"
+)
 
 func ProcessAsync[T any, U any](inputs []U, block func(u U) (T, error)) []T {
 	var results []T
@@ -33,3 +36,35 @@ func ProcessAsync[T any, U any](inputs []U, block func(u U) (T, error)) []T {
 
 	return results
 }
+
+/*
+ProcessAsyncWithLimit calls block for each input with at most limit calls running at once, returning the results in
+the order of inputs. Unlike ProcessAsync, errors are not discarded: the errors returned by block are joined and
+returned with the results (the result of a failed call is the zero value of T).
+*/
+func ProcessAsyncWithLimit[T any, U any](inputs []U, limit int, block func(u U) (T, error)) ([]T, error) {
+	if limit < 1 {
+		limit = 1
+	}
+	results := make([]T, len(inputs))
+	errs := make([]error, len(inputs))
+	semaphore := make(chan struct{}, limit)
+	wg := sync.WaitGroup{}
+
+	for i, input := range inputs {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(index int, input U) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			results[index], errs[index] = block(input)
+		}(i, input)
+	}
+	wg.Wait()
+
+	return results, errors.Join(errs...)
+}
@@ -1,10 +1,14 @@
 package workflowsupport
 
 import (
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/hexa-org/policy-mapper/models/rar/testsupport"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestProcessAsync(t *testing.T) {
@@ -22,3 +26,28 @@ func TestProcessAsync(t *testing.T) {
 		"processed:whyDoWeNeedMoreThings",
 	)
 }
+
+func TestProcessAsyncWithLimit(t *testing.T) {
+	things := []string{"thing", "anotherThing", "badThing", "lotsOfThings", "whyDoWeNeedMoreThings"}
+
+	var running, maxRunning int32
+	responses, err := ProcessAsyncWithLimit[string, string](things, 2, func(thing string) (string, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if thing == "badThing" {
+			return "", errors.New("bad thing")
+		}
+		return fmt.Sprintf("processed:%s", thing), nil
+	})
+
+	assert.EqualError(t, err, "bad thing")
+	assert.Equal(t, []string{"processed:thing", "processed:anotherThing", "", "processed:lotsOfThings", "processed:whyDoWeNeedMoreThings"}, responses)
+	assert.LessOrEqual(t, maxRunning, int32(2))
+}
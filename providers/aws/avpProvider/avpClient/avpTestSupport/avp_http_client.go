@@ -2,6 +2,7 @@ package avpTestSupport
 
 import (
     "bytes"
+    "encoding/json"
     "fmt"
     "io"
     "log"
@@ -52,8 +53,9 @@ func (m *MockVerifiedPermissionsHTTPClient) Post(url, _ string, body io.Reader)
 
 func (m *MockVerifiedPermissionsHTTPClient) sendRequest(method, url, awsServiceOp string, body io.Reader) (resp *http.Response, err error) {
     reqKey := m.reqKey(method, url, awsServiceOp)
+    var reqBody []byte
     if body != nil {
-        reqBody, _ := io.ReadAll(body)
+        reqBody, _ = io.ReadAll(body)
         m.requestBody[reqKey] = append(m.requestBody[reqKey], reqBody)
     }
 
@@ -62,9 +64,41 @@ func (m *MockVerifiedPermissionsHTTPClient) sendRequest(method, url, awsServiceO
     responseBody = m.responseBody[reqKey][reqNum]
     statusCode := m.statusCodes[reqKey][reqNum]
     m.called[reqKey] = append(m.called[reqKey], statusCode)
+    if awsServiceOp == "VerifiedPermissions.BatchIsAuthorized" {
+        if msg := validateBatch(reqBody); msg != "" {
+            statusCode = http.StatusBadRequest
+            responseBody, _ = json.Marshal(map[string]string{"__type": "ValidationException", "message": msg})
+        }
+    }
     return &http.Response{StatusCode: statusCode, Body: io.NopCloser(bytes.NewReader(responseBody))}, nil
 }
 
+// validateBatch returns an error message if a BatchIsAuthorized request breaks the AVP rules: at most 30 requests that
+// all have the same principal or the same resource
+func validateBatch(reqBody []byte) string {
+    var batch struct {
+        Requests []struct {
+            Principal json.RawMessage `json:"principal"`
+            Resource  json.RawMessage `json:"resource"`
+        } `json:"requests"`
+    }
+    if err := json.Unmarshal(reqBody, &batch); err != nil || len(batch.Requests) == 0 {
+        return ""
+    }
+    if len(batch.Requests) > 30 {
+        return "a batch may contain at most 30 requests"
+    }
+    samePrincipal, sameResource := true, true
+    for _, request := range batch.Requests[1:] {
+        samePrincipal = samePrincipal && bytes.Equal(request.Principal, batch.Requests[0].Principal)
+        sameResource = sameResource && bytes.Equal(request.Resource, batch.Requests[0].Resource)
+    }
+    if !samePrincipal && !sameResource {
+        return "the requests of a batch must have the same principal or the same resource"
+    }
+    return ""
+}
+
 func (m *MockVerifiedPermissionsHTTPClient) AddRequest(method, url, apiOp string, statusCode int, responseBody []byte) {
     serviceOp := "VerifiedPermissions." + apiOp
     m.addRequest(m.reqKey(method, url, serviceOp), statusCode, responseBody)
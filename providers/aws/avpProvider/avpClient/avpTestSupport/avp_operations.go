@@ -428,3 +428,182 @@ func (m *MockVerifiedPermissionsHTTPClient) MockDeletePolicyWithHttpStatus(httpS
     emptyJson := "{}"
     m.AddRequest(http.MethodPost, AvpApiUrl, "DeletePolicy", httpStatus, []byte(emptyJson))
 }
+
+type MockPolicyTemplateItem struct {
+    CreatedDate      *time.Time `json:"createdDate"`
+    LastUpdatedDate  *time.Time `json:"lastUpdatedDate"`
+    PolicyStoreId    *string    `json:"policyStoreId"`
+    PolicyTemplateId *string    `json:"policyTemplateId"`
+    Description      *string    `json:"description"`
+}
+
+type MockListPolicyTemplatesOutput struct {
+    PolicyTemplates []MockPolicyTemplateItem `json:"policyTemplates"`
+    NextToken       *string                  `json:"nextToken"`
+}
+
+func (m *MockVerifiedPermissionsHTTPClient) MockListPolicyTemplatesWithHttpStatus(httpStatus int, ids ...string) {
+    if httpStatus != 200 {
+        m.AddRequest(http.MethodPost, AvpApiUrl, "ListPolicyTemplates", httpStatus, []byte{})
+        return
+    }
+    m.AddRequest(http.MethodPost, AvpApiUrl, "ListPolicyTemplates", httpStatus, ListPolicyTemplatesResponse(ids...))
+}
+
+func ListPolicyTemplatesResponse(ids ...string) []byte {
+    testDate := time.Date(2023, 2, 1, 1, 2, 3, 0, time.UTC)
+    description := "Test Hexa Policy Template"
+    templates := make([]MockPolicyTemplateItem, len(ids))
+    for i := range ids {
+        templates[i] = MockPolicyTemplateItem{
+            CreatedDate:      &testDate,
+            LastUpdatedDate:  &testDate,
+            PolicyStoreId:    &TestPolicyStoreId,
+            PolicyTemplateId: &ids[i],
+            Description:      &description,
+        }
+    }
+    outBytes, _ := json.Marshal(MockListPolicyTemplatesOutput{PolicyTemplates: templates})
+    return outBytes
+}
+
+type PolicyTemplateOutput struct {
+    CreatedDate      *time.Time `json:"createdDate"`
+    LastUpdatedDate  *time.Time `json:"lastUpdatedDate"`
+    PolicyStoreId    *string    `json:"policyStoreId"`
+    PolicyTemplateId *string    `json:"policyTemplateId"`
+}
+
+func PolicyTemplateResponse(id string) []byte {
+    nowTime := time.Now()
+    output := PolicyTemplateOutput{
+        CreatedDate:      &nowTime,
+        LastUpdatedDate:  &nowTime,
+        PolicyStoreId:    &TestPolicyStoreId,
+        PolicyTemplateId: &id,
+    }
+    outBytes, _ := json.Marshal(output)
+    return outBytes
+}
+
+func (m *MockVerifiedPermissionsHTTPClient) MockCreatePolicyTemplateWithHttpStatus(httpStatus int, id string) {
+    if httpStatus != 200 {
+        m.AddRequest(http.MethodPost, AvpApiUrl, "CreatePolicyTemplate", httpStatus, []byte{})
+        return
+    }
+    m.AddRequest(http.MethodPost, AvpApiUrl, "CreatePolicyTemplate", httpStatus, PolicyTemplateResponse(id))
+}
+
+func (m *MockVerifiedPermissionsHTTPClient) MockUpdatePolicyTemplateWithHttpStatus(httpStatus int, id string) {
+    if httpStatus != 200 {
+        m.AddRequest(http.MethodPost, AvpApiUrl, "UpdatePolicyTemplate", httpStatus, []byte{})
+        return
+    }
+    m.AddRequest(http.MethodPost, AvpApiUrl, "UpdatePolicyTemplate", httpStatus, PolicyTemplateResponse(id))
+}
+
+func (m *MockVerifiedPermissionsHTTPClient) MockDeletePolicyTemplateWithHttpStatus(httpStatus int) {
+    if httpStatus != 200 {
+        m.AddRequest(http.MethodPost, AvpApiUrl, "DeletePolicyTemplate", httpStatus, []byte{})
+        return
+    }
+    m.AddRequest(http.MethodPost, AvpApiUrl, "DeletePolicyTemplate", httpStatus, []byte("{}"))
+}
+
+type MockGetSchemaOutput struct {
+    PolicyStoreId *string  `json:"policyStoreId"`
+    Schema        *string  `json:"schema"`
+    Namespaces    []string `json:"namespaces"`
+}
+
+// MockGetSchemaWithHttpStatus returns schema (a Cedar JSON schema) as the schema of the test policy store. A status of
+// http.StatusNotFound returns the error AVP returns when the store has no schema.
+func (m *MockVerifiedPermissionsHTTPClient) MockGetSchemaWithHttpStatus(httpStatus int, schema string, namespaces ...string) {
+    switch httpStatus {
+    case http.StatusOK:
+        outBytes, _ := json.Marshal(MockGetSchemaOutput{PolicyStoreId: &TestPolicyStoreId, Schema: &schema, Namespaces: namespaces})
+        m.AddRequest(http.MethodPost, AvpApiUrl, "GetSchema", httpStatus, outBytes)
+    case http.StatusNotFound:
+        m.AddRequest(http.MethodPost, AvpApiUrl, "GetSchema", http.StatusBadRequest,
+            []byte(`{"__type": "ResourceNotFoundException", "message": "No schema found", "resourceId": "schema", "resourceType": "SCHEMA"}`))
+    default:
+        m.AddRequest(http.MethodPost, AvpApiUrl, "GetSchema", httpStatus, []byte{})
+    }
+}
+
+func (m *MockVerifiedPermissionsHTTPClient) MockPutSchemaWithHttpStatus(httpStatus int, namespaces ...string) {
+    if httpStatus != 200 {
+        m.AddRequest(http.MethodPost, AvpApiUrl, "PutSchema", httpStatus, []byte{})
+        return
+    }
+    nowTime := time.Now()
+    outBytes, _ := json.Marshal(map[string]interface{}{
+        "policyStoreId":   TestPolicyStoreId,
+        "namespaces":      namespaces,
+        "createdDate":     nowTime,
+        "lastUpdatedDate": nowTime,
+    })
+    m.AddRequest(http.MethodPost, AvpApiUrl, "PutSchema", httpStatus, outBytes)
+}
+
+func (m *MockVerifiedPermissionsHTTPClient) MockCreatePolicyStoreWithHttpStatus(httpStatus int, id string) {
+    if httpStatus != 200 {
+        m.AddRequest(http.MethodPost, AvpApiUrl, "CreatePolicyStore", httpStatus, []byte{})
+        return
+    }
+    nowTime := time.Now()
+    outBytes, _ := json.Marshal(map[string]interface{}{
+        "policyStoreId":   id,
+        "arn":             "arn:aws:verifiedpermissions::773752081234:policy-store/" + id,
+        "createdDate":     nowTime,
+        "lastUpdatedDate": nowTime,
+    })
+    m.AddRequest(http.MethodPost, AvpApiUrl, "CreatePolicyStore", httpStatus, outBytes)
+}
+
+type mockDeterminingPolicy struct {
+    PolicyId string `json:"policyId"`
+}
+
+type mockAuthorizationResult struct {
+    Decision            string                  `json:"decision"`
+    DeterminingPolicies []mockDeterminingPolicy `json:"determiningPolicies"`
+    Errors              []interface{}           `json:"errors"`
+}
+
+func authorizationResult(decision string, policyIds ...string) mockAuthorizationResult {
+    result := mockAuthorizationResult{Decision: decision, DeterminingPolicies: []mockDeterminingPolicy{}, Errors: []interface{}{}}
+    for _, id := range policyIds {
+        result.DeterminingPolicies = append(result.DeterminingPolicies, mockDeterminingPolicy{PolicyId: id})
+    }
+    return result
+}
+
+// MockIsAuthorizedWithHttpStatus returns decision (ALLOW or DENY) as determined by the policies policyIds
+func (m *MockVerifiedPermissionsHTTPClient) MockIsAuthorizedWithHttpStatus(httpStatus int, decision string, policyIds ...string) {
+    if httpStatus != 200 {
+        m.AddRequest(http.MethodPost, AvpApiUrl, "IsAuthorized", httpStatus, []byte{})
+        return
+    }
+    outBytes, _ := json.Marshal(authorizationResult(decision, policyIds...))
+    m.AddRequest(http.MethodPost, AvpApiUrl, "IsAuthorized", httpStatus, outBytes)
+}
+
+// MockBatchIsAuthorizedWithHttpStatus returns a result for each of decisions. An ALLOW decision is determined by the
+// first test static policy.
+func (m *MockVerifiedPermissionsHTTPClient) MockBatchIsAuthorizedWithHttpStatus(httpStatus int, decisions ...string) {
+    if httpStatus != 200 {
+        m.AddRequest(http.MethodPost, AvpApiUrl, "BatchIsAuthorized", httpStatus, []byte{})
+        return
+    }
+    results := make([]mockAuthorizationResult, len(decisions))
+    for i, decision := range decisions {
+        results[i] = authorizationResult(decision)
+        if decision == "ALLOW" {
+            results[i] = authorizationResult(decision, TestCedarStaticPolicyId+"0")
+        }
+    }
+    outBytes, _ := json.Marshal(map[string]interface{}{"results": results})
+    m.AddRequest(http.MethodPost, AvpApiUrl, "BatchIsAuthorized", httpStatus, outBytes)
+}
+
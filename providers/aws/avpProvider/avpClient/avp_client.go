@@ -12,31 +12,47 @@ import (
 
 type AvpClient interface {
     ListStores() (apps []policyprovider.ApplicationInfo, err error)
+    CreatePolicyStore(description string, validationMode types.ValidationMode) (*verifiedpermissions.CreatePolicyStoreOutput, error)
     ListPolicies(app policyprovider.ApplicationInfo) ([]types.PolicyItem, error)
+    ListPolicyTemplates(app policyprovider.ApplicationInfo) ([]types.PolicyTemplateItem, error)
     GetTemplatePolicy(id string, app policyprovider.ApplicationInfo) (*verifiedpermissions.GetPolicyTemplateOutput, error)
+    CreatePolicyTemplate(createTemplateInput *verifiedpermissions.CreatePolicyTemplateInput) (*verifiedpermissions.CreatePolicyTemplateOutput, error)
+    UpdatePolicyTemplate(updateTemplateInput *verifiedpermissions.UpdatePolicyTemplateInput) (*verifiedpermissions.UpdatePolicyTemplateOutput, error)
+    DeletePolicyTemplate(deleteTemplateInput *verifiedpermissions.DeletePolicyTemplateInput) (*verifiedpermissions.DeletePolicyTemplateOutput, error)
     GetPolicy(id string, app policyprovider.ApplicationInfo) (*verifiedpermissions.GetPolicyOutput, error)
     CreatePolicy(createPolicyInput *verifiedpermissions.CreatePolicyInput) (*verifiedpermissions.CreatePolicyOutput, error)
     UpdatePolicy(updatePolicy *verifiedpermissions.UpdatePolicyInput) (*verifiedpermissions.UpdatePolicyOutput, error)
     DeletePolicy(deletePolicyInput *verifiedpermissions.DeletePolicyInput) (*verifiedpermissions.DeletePolicyOutput, error)
     GetSchema(app policyprovider.ApplicationInfo) (*verifiedpermissions.GetSchemaOutput, error)
     PutSchema(app policyprovider.ApplicationInfo, schema types.SchemaDefinition) (*verifiedpermissions.PutSchemaOutput, error)
+    IsAuthorized(isAuthorizedInput *verifiedpermissions.IsAuthorizedInput) (*verifiedpermissions.IsAuthorizedOutput, error)
+    BatchIsAuthorized(batchInput *verifiedpermissions.BatchIsAuthorizedInput) (*verifiedpermissions.BatchIsAuthorizedOutput, error)
 }
 
 type avpClient struct {
     client *verifiedpermissions.Client
     app    policyprovider.ApplicationInfo
+    ctx    context.Context
 }
 
 func NewAvpClient(key []byte, opt awscommon.AWSClientOptions) (AvpClient, error) {
-    client, err := newAvpClient(key, opt)
+    return NewAvpClientContext(context.Background(), key, opt)
+}
+
+/*
+NewAvpClientContext returns a client whose requests are made with ctx, so that they are cancelled or time out with the
+operation the client was created for.
+*/
+func NewAvpClientContext(ctx context.Context, key []byte, opt awscommon.AWSClientOptions) (AvpClient, error) {
+    client, err := newAvpClient(ctx, key, opt)
     if err != nil {
         return nil, err
     }
-    return &avpClient{client: client}, nil
+    return &avpClient{client: client, ctx: ctx}, nil
 }
 
-func newAvpClient(key []byte, opts awscommon.AWSClientOptions) (*verifiedpermissions.Client, error) {
-    cfg, err := awscommon.GetAwsClientConfig(key, opts)
+func newAvpClient(ctx context.Context, key []byte, opts awscommon.AWSClientOptions) (*verifiedpermissions.Client, error) {
+    cfg, err := awscommon.GetAwsClientConfigContext(ctx, key, opts)
     if err != nil {
         return nil, err
     }
@@ -49,7 +65,7 @@ func (c *avpClient) ListStores() (apps []policyprovider.ApplicationInfo, err err
     storesInput := verifiedpermissions.ListPolicyStoresInput{
         MaxResults: &maxRes,
     }
-    storeOutput, err := c.client.ListPolicyStores(context.Background(), &storesInput)
+    storeOutput, err := c.client.ListPolicyStores(c.ctx, &storesInput)
     if err != nil {
         return nil, err
     }
@@ -65,6 +81,13 @@ func (c *avpClient) ListStores() (apps []policyprovider.ApplicationInfo, err err
     return apps, nil
 }
 
+func (c *avpClient) CreatePolicyStore(description string, validationMode types.ValidationMode) (*verifiedpermissions.CreatePolicyStoreOutput, error) {
+    return c.client.CreatePolicyStore(c.ctx, &verifiedpermissions.CreatePolicyStoreInput{
+        Description:        &description,
+        ValidationSettings: &types.ValidationSettings{Mode: validationMode},
+    })
+}
+
 // ListPolicies calls avp and collects all the policies found and does paging if necessary
 func (c *avpClient) ListPolicies(app policyprovider.ApplicationInfo) ([]types.PolicyItem, error) {
     maxRes := int32(50) // Maximum is 50?
@@ -75,7 +98,7 @@ func (c *avpClient) ListPolicies(app policyprovider.ApplicationInfo) ([]types.Po
     morePage := true
     var policies []types.PolicyItem
     for morePage == true {
-        policyOutput, err := c.client.ListPolicies(context.Background(), &policyInput)
+        policyOutput, err := c.client.ListPolicies(c.ctx, &policyInput)
         if err != nil {
             return nil, err
         }
@@ -93,42 +116,87 @@ func (c *avpClient) ListPolicies(app policyprovider.ApplicationInfo) ([]types.Po
     return policies, nil
 }
 
+// ListPolicyTemplates calls avp and collects all the policy templates found and does paging if necessary
+func (c *avpClient) ListPolicyTemplates(app policyprovider.ApplicationInfo) ([]types.PolicyTemplateItem, error) {
+    maxRes := int32(50)
+    templateInput := verifiedpermissions.ListPolicyTemplatesInput{
+        PolicyStoreId: &app.ObjectID,
+        MaxResults:    &maxRes,
+    }
+    var templates []types.PolicyTemplateItem
+    for {
+        templateOutput, err := c.client.ListPolicyTemplates(c.ctx, &templateInput)
+        if err != nil {
+            return nil, err
+        }
+        templates = append(templates, templateOutput.PolicyTemplates...)
+        if templateOutput.NextToken == nil {
+            break
+        }
+        fmt.Println("  paging policy templates...")
+        templateInput.NextToken = templateOutput.NextToken
+    }
+    return templates, nil
+}
+
 func (c *avpClient) GetTemplatePolicy(id string, app policyprovider.ApplicationInfo) (*verifiedpermissions.GetPolicyTemplateOutput, error) {
-    return c.client.GetPolicyTemplate(context.TODO(), &verifiedpermissions.GetPolicyTemplateInput{
+    return c.client.GetPolicyTemplate(c.ctx, &verifiedpermissions.GetPolicyTemplateInput{
         PolicyStoreId:    &app.ObjectID,
         PolicyTemplateId: &id,
     })
 
 }
 
+func (c *avpClient) CreatePolicyTemplate(createTemplateInput *verifiedpermissions.CreatePolicyTemplateInput) (*verifiedpermissions.CreatePolicyTemplateOutput, error) {
+    return c.client.CreatePolicyTemplate(c.ctx, createTemplateInput)
+}
+
+func (c *avpClient) UpdatePolicyTemplate(updateTemplateInput *verifiedpermissions.UpdatePolicyTemplateInput) (*verifiedpermissions.UpdatePolicyTemplateOutput, error) {
+    return c.client.UpdatePolicyTemplate(c.ctx, updateTemplateInput)
+}
+
+func (c *avpClient) DeletePolicyTemplate(deleteTemplateInput *verifiedpermissions.DeletePolicyTemplateInput) (*verifiedpermissions.DeletePolicyTemplateOutput, error) {
+    return c.client.DeletePolicyTemplate(c.ctx, deleteTemplateInput)
+}
+
 func (c *avpClient) GetPolicy(id string, app policyprovider.ApplicationInfo) (*verifiedpermissions.GetPolicyOutput, error) {
-    return c.client.GetPolicy(context.TODO(), &verifiedpermissions.GetPolicyInput{
+    return c.client.GetPolicy(c.ctx, &verifiedpermissions.GetPolicyInput{
         PolicyId:      &id,
         PolicyStoreId: &app.ObjectID,
     })
 }
 
 func (c *avpClient) CreatePolicy(createPolicyInput *verifiedpermissions.CreatePolicyInput) (*verifiedpermissions.CreatePolicyOutput, error) {
-    return c.client.CreatePolicy(context.TODO(), createPolicyInput)
+    return c.client.CreatePolicy(c.ctx, createPolicyInput)
 }
 
 func (c *avpClient) UpdatePolicy(updatePolicy *verifiedpermissions.UpdatePolicyInput) (*verifiedpermissions.UpdatePolicyOutput, error) {
-    return c.client.UpdatePolicy(context.TODO(), updatePolicy)
+    return c.client.UpdatePolicy(c.ctx, updatePolicy)
 }
 
 func (c *avpClient) DeletePolicy(deletePolicyInput *verifiedpermissions.DeletePolicyInput) (*verifiedpermissions.DeletePolicyOutput, error) {
-    return c.client.DeletePolicy(context.TODO(), deletePolicyInput)
+    return c.client.DeletePolicy(c.ctx, deletePolicyInput)
 }
 
 func (c *avpClient) GetSchema(app policyprovider.ApplicationInfo) (*verifiedpermissions.GetSchemaOutput, error) {
-    return c.client.GetSchema(context.TODO(), &verifiedpermissions.GetSchemaInput{
+    return c.client.GetSchema(c.ctx, &verifiedpermissions.GetSchemaInput{
         PolicyStoreId: &app.ObjectID,
     })
 }
 
 func (c *avpClient) PutSchema(app policyprovider.ApplicationInfo, schema types.SchemaDefinition) (*verifiedpermissions.PutSchemaOutput, error) {
-    return c.client.PutSchema(context.TODO(), &verifiedpermissions.PutSchemaInput{
+    return c.client.PutSchema(c.ctx, &verifiedpermissions.PutSchemaInput{
         PolicyStoreId: &app.ObjectID,
         Definition:    schema,
     })
 }
+
+// IsAuthorized evaluates a single authorization request against the policies of a policy store
+func (c *avpClient) IsAuthorized(isAuthorizedInput *verifiedpermissions.IsAuthorizedInput) (*verifiedpermissions.IsAuthorizedOutput, error) {
+    return c.client.IsAuthorized(c.ctx, isAuthorizedInput)
+}
+
+// BatchIsAuthorized evaluates up to 30 authorization requests that share the same entities
+func (c *avpClient) BatchIsAuthorized(batchInput *verifiedpermissions.BatchIsAuthorizedInput) (*verifiedpermissions.BatchIsAuthorizedOutput, error) {
+    return c.client.BatchIsAuthorized(c.ctx, batchInput)
+}
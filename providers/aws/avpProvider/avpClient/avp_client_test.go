@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/verifiedpermissions"
 	"github.com/aws/aws-sdk-go-v2/service/verifiedpermissions/types"
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
@@ -197,3 +198,88 @@ func TestAvpClient_7_DeletePolicy(t *testing.T) {
 	assert.NotNil(t, output)
 	assert.True(t, testInfo.mockClient.VerifyCalled())
 }
+
+func TestAvpClient_8_PolicyTemplates(t *testing.T) {
+	testInfo.mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusBadRequest)
+	noItems, err := testInfo.hexaAvpClient.ListPolicyTemplates(testInfo.App)
+	assert.Error(t, err, "Should be a bad request error")
+	assert.Nil(t, noItems, "Should be no items")
+	assert.True(t, testInfo.mockClient.VerifyCalled())
+
+	testInfo.mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, "temp1", "temp2")
+	templates, err := testInfo.hexaAvpClient.ListPolicyTemplates(testInfo.App)
+	assert.NoError(t, err)
+	assert.Len(t, templates, 2)
+	assert.Equal(t, "temp2", *templates[1].PolicyTemplateId)
+	assert.True(t, testInfo.mockClient.VerifyCalled())
+
+	testInfo.mockClient.MockCreatePolicyTemplateWithHttpStatus(http.StatusOK, "temp3")
+	created, err := testInfo.hexaAvpClient.CreatePolicyTemplate(&verifiedpermissions.CreatePolicyTemplateInput{
+		PolicyStoreId: &avpTestSupport.TestPolicyStoreId,
+		Statement:     &avpTestSupport.TestCedarTemplatePolicy,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "temp3", *created.PolicyTemplateId)
+	assert.True(t, testInfo.mockClient.VerifyCalled())
+
+	testInfo.mockClient.MockUpdatePolicyTemplateWithHttpStatus(http.StatusOK, "temp3")
+	updated, err := testInfo.hexaAvpClient.UpdatePolicyTemplate(&verifiedpermissions.UpdatePolicyTemplateInput{
+		PolicyStoreId:    &avpTestSupport.TestPolicyStoreId,
+		PolicyTemplateId: created.PolicyTemplateId,
+		Statement:        &avpTestSupport.TestCedarTemplatePolicy,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "temp3", *updated.PolicyTemplateId)
+	assert.True(t, testInfo.mockClient.VerifyCalled())
+
+	testInfo.mockClient.MockDeletePolicyTemplateWithHttpStatus(http.StatusBadRequest)
+	_, err = testInfo.hexaAvpClient.DeletePolicyTemplate(&verifiedpermissions.DeletePolicyTemplateInput{
+		PolicyStoreId:    &avpTestSupport.TestPolicyStoreId,
+		PolicyTemplateId: created.PolicyTemplateId,
+	})
+	assert.Error(t, err, "Should be a bad request error")
+	testInfo.mockClient.MockDeletePolicyTemplateWithHttpStatus(http.StatusOK)
+	_, err = testInfo.hexaAvpClient.DeletePolicyTemplate(&verifiedpermissions.DeletePolicyTemplateInput{
+		PolicyStoreId:    &avpTestSupport.TestPolicyStoreId,
+		PolicyTemplateId: created.PolicyTemplateId,
+	})
+	assert.NoError(t, err)
+	assert.True(t, testInfo.mockClient.VerifyCalled())
+}
+
+func TestAvpClient_9_IsAuthorized(t *testing.T) {
+	principal := types.EntityIdentifier{EntityType: aws.String("hexa_avp::User"), EntityId: aws.String("alice")}
+	action := types.ActionIdentifier{ActionType: aws.String("hexa_avp::Action"), ActionId: aws.String("ReadAccount")}
+	resource := types.EntityIdentifier{EntityType: aws.String("hexa_avp::Account"), EntityId: aws.String("1")}
+
+	testInfo.mockClient.MockIsAuthorizedWithHttpStatus(http.StatusOK, "ALLOW", "policy1")
+	output, err := testInfo.hexaAvpClient.IsAuthorized(&verifiedpermissions.IsAuthorizedInput{
+		PolicyStoreId: &avpTestSupport.TestPolicyStoreId,
+		Principal:     &principal,
+		Action:        &action,
+		Resource:      &resource,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, types.DecisionAllow, output.Decision)
+	assert.Equal(t, "policy1", *output.DeterminingPolicies[0].PolicyId)
+	assert.True(t, testInfo.mockClient.VerifyCalled())
+
+	testInfo.mockClient.MockBatchIsAuthorizedWithHttpStatus(http.StatusOK, "ALLOW", "DENY")
+	request := types.BatchIsAuthorizedInputItem{Principal: &principal, Action: &action, Resource: &resource}
+	batchOutput, err := testInfo.hexaAvpClient.BatchIsAuthorized(&verifiedpermissions.BatchIsAuthorizedInput{
+		PolicyStoreId: &avpTestSupport.TestPolicyStoreId,
+		Requests:      []types.BatchIsAuthorizedInputItem{request, request},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, batchOutput.Results, 2)
+	assert.Equal(t, types.DecisionDeny, batchOutput.Results[1].Decision)
+	assert.True(t, testInfo.mockClient.VerifyCalled())
+
+	testInfo.mockClient.MockBatchIsAuthorizedWithHttpStatus(http.StatusBadRequest)
+	_, err = testInfo.hexaAvpClient.BatchIsAuthorized(&verifiedpermissions.BatchIsAuthorizedInput{
+		PolicyStoreId: &avpTestSupport.TestPolicyStoreId,
+		Requests:      []types.BatchIsAuthorizedInputItem{request},
+	})
+	assert.Error(t, err, "Should be a bad request error")
+	assert.True(t, testInfo.mockClient.VerifyCalled())
+}
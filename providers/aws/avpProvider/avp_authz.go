@@ -0,0 +1,427 @@
+package avpProvider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/verifiedpermissions"
+	"github.com/aws/aws-sdk-go-v2/service/verifiedpermissions/types"
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/providers/aws/avpProvider/avpClient"
+)
+
+const maxBatchRequests = 30 // the maximum number of requests AVP accepts in a BatchIsAuthorized call
+
+// AuthzEntityUid identifies an entity in the Cedar JSON entities format (e.g. {"type": "PhotoApp::User", "id": "alice"})
+type AuthzEntityUid struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+// AuthzEntity is an entity in the Cedar JSON entities format. Attribute values are JSON values where an entity
+// reference is {"__entity": {"type": ..., "id": ...}} and a decimal or ip address is {"__extn": {"fn": "decimal", "arg": "1.5"}}
+type AuthzEntity struct {
+	Uid     AuthzEntityUid         `json:"uid"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+	Parents []AuthzEntityUid       `json:"parents,omitempty"`
+}
+
+/*
+AuthzTestCase is an authorization request and its expected decision. The principal, action and resource are IDQL
+entity values (e.g. `PhotoApp:User:"alice"`, `PhotoApp:Action:"viewPhoto"`). Entities given with a case are added to
+the entities of the AuthzTests for that case only.
+*/
+type AuthzTestCase struct {
+	Name      string                 `json:"name"`
+	Principal string                 `json:"principal"`
+	Action    string                 `json:"action"`
+	Resource  string                 `json:"resource"`
+	Context   map[string]interface{} `json:"context,omitempty"`
+	Entities  []AuthzEntity          `json:"entities,omitempty"`
+	Decision  string                 `json:"decision"` // the expected decision: ALLOW or DENY
+}
+
+// AuthzTests is a suite of authorization test cases and the entities they share
+type AuthzTests struct {
+	Entities []AuthzEntity   `json:"entities,omitempty"`
+	Cases    []AuthzTestCase `json:"cases"`
+}
+
+// AuthzTestResult is the outcome of an AuthzTestCase
+type AuthzTestResult struct {
+	Name                string   `json:"name"`
+	Expected            string   `json:"expected"`
+	Decision            string   `json:"decision"`
+	DeterminingPolicies []string `json:"determiningPolicies,omitempty"` // the AVP policy ids that determined the decision
+	Errors              []string `json:"errors,omitempty"`              // errors AVP encountered evaluating policies
+	Passed              bool     `json:"passed"`
+}
+
+// AuthzTestReport contains the results of running AuthzTests against a policy store
+type AuthzTestReport struct {
+	PolicyStoreId string            `json:"policyStoreId"`
+	Results       []AuthzTestResult `json:"results"`
+}
+
+// Failed returns the results of the test cases whose decision was not the expected decision
+func (r AuthzTestReport) Failed() []AuthzTestResult {
+	var failed []AuthzTestResult
+	for _, result := range r.Results {
+		if !result.Passed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+func (r AuthzTestReport) String() string {
+	sb := strings.Builder{}
+	failed := len(r.Failed())
+	sb.WriteString(fmt.Sprintf("Policy store %s: %d passed, %d failed\n", r.PolicyStoreId, len(r.Results)-failed, failed))
+	for _, result := range r.Results {
+		policies := "none"
+		if len(result.DeterminingPolicies) > 0 {
+			policies = strings.Join(result.DeterminingPolicies, ", ")
+		}
+		if result.Passed {
+			sb.WriteString(fmt.Sprintf("PASS %s: %s (policies: %s)\n", result.Name, result.Decision, policies))
+		} else {
+			sb.WriteString(fmt.Sprintf("FAIL %s: expected %s, got %s (policies: %s)\n", result.Name, result.Expected, result.Decision, policies))
+		}
+		for _, msg := range result.Errors {
+			sb.WriteString(fmt.Sprintf("  error: %s\n", msg))
+		}
+	}
+	return sb.String()
+}
+
+// ParseAuthzTests parses a JSON suite of authorization test cases
+func ParseAuthzTests(testBytes []byte) (*AuthzTests, error) {
+	var tests AuthzTests
+	decoder := json.NewDecoder(bytes.NewReader(testBytes))
+	decoder.UseNumber() // Cedar longs must not be converted to floats
+	if err := decoder.Decode(&tests); err != nil {
+		return nil, fmt.Errorf("invalid authorization tests: %w", err)
+	}
+	if len(tests.Cases) == 0 {
+		return nil, errors.New("invalid authorization tests: no test cases found")
+	}
+	return &tests, nil
+}
+
+// LoadAuthzTests reads a JSON suite of authorization test cases from a file
+func LoadAuthzTests(path string) (*AuthzTests, error) {
+	testBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAuthzTests(testBytes)
+}
+
+/*
+RunAuthzTests evaluates each test case against the policies of the policy store and compares the decision with the
+expected decision. Cases that use only the shared entities are evaluated with BatchIsAuthorized, and cases with their
+own entities with IsAuthorized. An error is returned if a case is invalid or AVP could not be called; a decision
+other than the expected decision is reported as a failed result.
+*/
+func (a AmazonAvpProvider) RunAuthzTests(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, tests AuthzTests) (*AuthzTestReport, error) {
+	return a.RunAuthzTestsContext(context.Background(), info, applicationInfo, tests)
+}
+
+// RunAuthzTestsContext is RunAuthzTests with a context that cancels the remaining AVP calls
+func (a AmazonAvpProvider) RunAuthzTestsContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, tests AuthzTests) (*AuthzTestReport, error) {
+	sharedEntities, err := entitiesDefinition(tests.Entities)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate all cases before calling AVP
+	requests := make([]types.BatchIsAuthorizedInputItem, len(tests.Cases))
+	caseEntities := make([]types.EntitiesDefinition, len(tests.Cases))
+	for i, testCase := range tests.Cases {
+		if testCase.Name == "" {
+			tests.Cases[i].Name = fmt.Sprintf("case %d", i)
+		}
+		requests[i], err = authzRequest(tests.Cases[i])
+		if err != nil {
+			return nil, err
+		}
+		if len(testCase.Entities) > 0 {
+			caseEntities[i], err = entitiesDefinition(append(append([]AuthzEntity{}, tests.Entities...), testCase.Entities...))
+			if err != nil {
+				return nil, fmt.Errorf("test case %s: %w", tests.Cases[i].Name, err)
+			}
+		}
+	}
+
+	client, err := a.getAvpClient(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	report := AuthzTestReport{PolicyStoreId: applicationInfo.ObjectID, Results: make([]AuthzTestResult, len(tests.Cases))}
+	var batched []int // the indexes of the cases evaluated with BatchIsAuthorized
+	for i, testCase := range tests.Cases {
+		if len(testCase.Entities) == 0 {
+			batched = append(batched, i)
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		output, err := client.IsAuthorized(&verifiedpermissions.IsAuthorizedInput{
+			PolicyStoreId: &applicationInfo.ObjectID,
+			Principal:     requests[i].Principal,
+			Action:        requests[i].Action,
+			Resource:      requests[i].Resource,
+			Context:       requests[i].Context,
+			Entities:      caseEntities[i],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("test case %s: %w", testCase.Name, err)
+		}
+		report.Results[i] = authzResult(testCase, output.Decision, output.DeterminingPolicies, output.Errors)
+	}
+	for _, batch := range authzBatches(requests, batched) {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err = runAuthzBatch(client, applicationInfo, sharedEntities, tests.Cases, requests, batch, &report); err != nil {
+			return nil, err
+		}
+	}
+	return &report, nil
+}
+
+/*
+authzBatches groups the requests at indexes into BatchIsAuthorized batches. AVP requires the requests of a batch to have
+the same principal or the same resource, so the requests are grouped by principal, and requests whose principal is not
+shared are then grouped by resource. Each group is split into batches of at most maxBatchRequests.
+*/
+func authzBatches(requests []types.BatchIsAuthorizedInputItem, indexes []int) [][]int {
+	byPrincipal := groupRequests(indexes, func(i int) *types.EntityIdentifier { return requests[i].Principal })
+	var batches [][]int
+	var unshared []int
+	for _, group := range byPrincipal {
+		if len(group) == 1 {
+			unshared = append(unshared, group[0])
+			continue
+		}
+		batches = append(batches, splitBatch(group)...)
+	}
+	for _, group := range groupRequests(unshared, func(i int) *types.EntityIdentifier { return requests[i].Resource }) {
+		batches = append(batches, splitBatch(group)...)
+	}
+	return batches
+}
+
+// groupRequests groups indexes by the entity returned by entity, keeping the order in which entities first appear
+func groupRequests(indexes []int, entity func(i int) *types.EntityIdentifier) [][]int {
+	var groups [][]int
+	groupIndex := make(map[string]int)
+	for _, i := range indexes {
+		identifier := entity(i)
+		key := aws.ToString(identifier.EntityType) + "::" + aws.ToString(identifier.EntityId)
+		n, ok := groupIndex[key]
+		if !ok {
+			n = len(groups)
+			groupIndex[key] = n
+			groups = append(groups, nil)
+		}
+		groups[n] = append(groups[n], i)
+	}
+	return groups
+}
+
+func splitBatch(group []int) [][]int {
+	var batches [][]int
+	for len(group) > maxBatchRequests {
+		batches = append(batches, group[:maxBatchRequests])
+		group = group[maxBatchRequests:]
+	}
+	return append(batches, group)
+}
+
+func runAuthzBatch(client avpClient.AvpClient, applicationInfo policyprovider.ApplicationInfo, entities types.EntitiesDefinition, cases []AuthzTestCase, requests []types.BatchIsAuthorizedInputItem, batch []int, report *AuthzTestReport) error {
+	input := verifiedpermissions.BatchIsAuthorizedInput{PolicyStoreId: &applicationInfo.ObjectID, Entities: entities}
+	for _, i := range batch {
+		input.Requests = append(input.Requests, requests[i])
+	}
+	output, err := client.BatchIsAuthorized(&input)
+	if err != nil {
+		return err
+	}
+	if len(output.Results) != len(batch) {
+		return fmt.Errorf("AVP returned %d results for %d authorization requests", len(output.Results), len(batch))
+	}
+	for n, i := range batch {
+		result := output.Results[n]
+		report.Results[i] = authzResult(cases[i], result.Decision, result.DeterminingPolicies, result.Errors)
+	}
+	return nil
+}
+
+func authzResult(testCase AuthzTestCase, decision types.Decision, policies []types.DeterminingPolicyItem, evalErrors []types.EvaluationErrorItem) AuthzTestResult {
+	result := AuthzTestResult{
+		Name:     testCase.Name,
+		Expected: strings.ToUpper(testCase.Decision),
+		Decision: string(decision),
+	}
+	result.Passed = result.Decision == result.Expected
+	for _, policy := range policies {
+		result.DeterminingPolicies = append(result.DeterminingPolicies, aws.ToString(policy.PolicyId))
+	}
+	for _, evalError := range evalErrors {
+		result.Errors = append(result.Errors, aws.ToString(evalError.ErrorDescription))
+	}
+	return result
+}
+
+// authzRequest maps a test case to an AVP authorization request
+func authzRequest(testCase AuthzTestCase) (types.BatchIsAuthorizedInputItem, error) {
+	var request types.BatchIsAuthorizedInputItem
+	switch strings.ToUpper(testCase.Decision) {
+	case string(types.DecisionAllow), string(types.DecisionDeny):
+	default:
+		return request, fmt.Errorf("test case %s: expected decision must be ALLOW or DENY", testCase.Name)
+	}
+
+	var err error
+	if request.Principal, err = requestEntity(testCase, ParamPrincipal, testCase.Principal); err != nil {
+		return request, err
+	}
+	if request.Resource, err = requestEntity(testCase, ParamResource, testCase.Resource); err != nil {
+		return request, err
+	}
+	action, err := requestEntity(testCase, "action", testCase.Action)
+	if err != nil {
+		return request, err
+	}
+	request.Action = &types.ActionIdentifier{ActionType: action.EntityType, ActionId: action.EntityId}
+
+	if len(testCase.Context) > 0 {
+		contextMap, err := attributeMap(testCase.Context)
+		if err != nil {
+			return request, fmt.Errorf("test case %s: context %w", testCase.Name, err)
+		}
+		request.Context = &types.ContextDefinitionMemberContextMap{Value: contextMap}
+	}
+	return request, nil
+}
+
+func requestEntity(testCase AuthzTestCase, name string, value string) (*types.EntityIdentifier, error) {
+	identifier, err := entityIdentifier(value)
+	if err != nil {
+		return nil, fmt.Errorf("test case %s: %s %q is not an entity (e.g. PhotoApp:User:\"alice\")", testCase.Name, name, value)
+	}
+	return identifier, nil
+}
+
+// entitiesDefinition maps Cedar JSON entities to an AVP entity list, or nil if there are no entities
+func entitiesDefinition(entities []AuthzEntity) (types.EntitiesDefinition, error) {
+	if len(entities) == 0 {
+		return nil, nil
+	}
+	items := make([]types.EntityItem, len(entities))
+	for i, entity := range entities {
+		if entity.Uid.Type == "" || entity.Uid.Id == "" {
+			return nil, fmt.Errorf("entity %d: uid must have a type and id", i)
+		}
+		attributes, err := attributeMap(entity.Attrs)
+		if err != nil {
+			return nil, fmt.Errorf("entity %s::\"%s\": attribute %w", entity.Uid.Type, entity.Uid.Id, err)
+		}
+		items[i] = types.EntityItem{Identifier: entityUid(entity.Uid), Attributes: attributes}
+		for _, parent := range entity.Parents {
+			items[i].Parents = append(items[i].Parents, *entityUid(parent))
+		}
+	}
+	return &types.EntitiesDefinitionMemberEntityList{Value: items}, nil
+}
+
+func entityUid(uid AuthzEntityUid) *types.EntityIdentifier {
+	return &types.EntityIdentifier{EntityType: aws.String(uid.Type), EntityId: aws.String(uid.Id)}
+}
+
+func attributeMap(values map[string]interface{}) (map[string]types.AttributeValue, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	attributes := make(map[string]types.AttributeValue, len(values))
+	for name, value := range values {
+		attribute, err := attributeValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		attributes[name] = attribute
+	}
+	return attributes, nil
+}
+
+// attributeValue maps a value in the Cedar JSON entities format to an AVP attribute value
+func attributeValue(value interface{}) (types.AttributeValue, error) {
+	switch v := value.(type) {
+	case bool:
+		return &types.AttributeValueMemberBoolean{Value: v}, nil
+	case string:
+		return &types.AttributeValueMemberString{Value: v}, nil
+	case json.Number:
+		long, err := v.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a long (use {\"__extn\": {\"fn\": \"decimal\", \"arg\": \"%s\"}} for a decimal)", v, v)
+		}
+		return &types.AttributeValueMemberLong{Value: long}, nil
+	case float64:
+		if v != math.Trunc(v) {
+			return nil, fmt.Errorf("%v is not a long", v)
+		}
+		return &types.AttributeValueMemberLong{Value: int64(v)}, nil
+	case int:
+		return &types.AttributeValueMemberLong{Value: int64(v)}, nil
+	case int64:
+		return &types.AttributeValueMemberLong{Value: v}, nil
+	case []interface{}:
+		set := make([]types.AttributeValue, len(v))
+		for i, member := range v {
+			attribute, err := attributeValue(member)
+			if err != nil {
+				return nil, err
+			}
+			set[i] = attribute
+		}
+		return &types.AttributeValueMemberSet{Value: set}, nil
+	case map[string]interface{}:
+		if ref, ok := v["__entity"].(map[string]interface{}); ok {
+			entityType, _ := ref["type"].(string)
+			id, _ := ref["id"].(string)
+			if entityType == "" || id == "" {
+				return nil, errors.New("__entity must have a type and id")
+			}
+			return &types.AttributeValueMemberEntityIdentifier{Value: *entityUid(AuthzEntityUid{Type: entityType, Id: id})}, nil
+		}
+		if extn, ok := v["__extn"].(map[string]interface{}); ok {
+			arg, _ := extn["arg"].(string)
+			switch extn["fn"] {
+			case "decimal":
+				return &types.AttributeValueMemberDecimal{Value: arg}, nil
+			case "ip", "ipaddr":
+				return &types.AttributeValueMemberIpaddr{Value: arg}, nil
+			}
+			return nil, fmt.Errorf("unsupported extension function %v", extn["fn"])
+		}
+		record, err := attributeMap(v)
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberRecord{Value: record}, nil
+	}
+	return nil, fmt.Errorf("unsupported value %v", value)
+}
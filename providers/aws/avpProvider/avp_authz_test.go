@@ -0,0 +1,177 @@
+package avpProvider_test
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "testing"
+
+    "github.com/hexa-org/policy-mapper/providers/aws/avpProvider"
+    "github.com/hexa-org/policy-mapper/providers/aws/avpProvider/avpClient/avpTestSupport"
+    "github.com/hexa-org/policy-mapper/providers/aws/awscommon"
+    "github.com/stretchr/testify/assert"
+)
+
+func authzProvider() (*avpTestSupport.MockVerifiedPermissionsHTTPClient, avpProvider.AmazonAvpProvider) {
+    mockClient := avpTestSupport.NewMockVerifiedPermissionsHTTPClient()
+    return mockClient, avpProvider.AmazonAvpProvider{AwsClientOpts: awscommon.AWSClientOptions{
+        HTTPClient:   mockClient,
+        DisableRetry: true,
+    }}
+}
+
+func TestAvp_RunAuthzTests(t *testing.T) {
+    mockClient, p := authzProvider()
+    tests, err := avpProvider.LoadAuthzTests("avpClient/avpTestSupport/data/authzTests.json")
+    assert.NoError(t, err)
+    assert.Len(t, tests.Cases, 3)
+
+    // The cases using the shared entities are batched, the case with its own entities is evaluated alone
+    mockClient.MockIsAuthorizedWithHttpStatus(http.StatusOK, "DENY")
+    mockClient.MockBatchIsAuthorizedWithHttpStatus(http.StatusOK, "ALLOW", "DENY")
+    report, err := p.RunAuthzTests(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), *tests)
+    assert.NoError(t, err)
+    assert.True(t, mockClient.VerifyCalled())
+
+    assert.Len(t, report.Results, 3)
+    assert.True(t, report.Results[0].Passed)
+    assert.Equal(t, []string{avpTestSupport.TestCedarStaticPolicyId + "0"}, report.Results[0].DeterminingPolicies)
+    assert.True(t, report.Results[1].Passed)
+    assert.False(t, report.Results[2].Passed)
+    assert.Equal(t, []avpProvider.AuthzTestResult{report.Results[2]}, report.Failed())
+
+    output := report.String()
+    assert.Contains(t, output, "Policy store "+avpTestSupport.TestPolicyStoreId+": 2 passed, 1 failed")
+    assert.Contains(t, output, "PASS alice can read her account: ALLOW (policies: "+avpTestSupport.TestCedarStaticPolicyId+"0)")
+    assert.Contains(t, output, "FAIL a new accountant can read the account: expected ALLOW, got DENY (policies: none)")
+
+    // The batch request has the shared entities, with attributes in AVP form
+    var batch map[string]interface{}
+    _ = json.Unmarshal(mockClient.GetRequestBody(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.BatchIsAuthorized"), &batch)
+    assert.Len(t, batch["requests"], 2)
+    batchBody, _ := json.Marshal(batch)
+    assert.Contains(t, string(batchBody), `"level":{"long":5}`)
+    assert.Contains(t, string(batchBody), `"limit":{"decimal":"1000.50"}`)
+    assert.Contains(t, string(batchBody), `"ip":{"ipaddr":"10.0.0.1"}`)
+    assert.Contains(t, string(batchBody), `"actionId":"ReadAccount","actionType":"hexa_avp::Action"`)
+
+    // The single request has the shared entities and its own
+    single := string(mockClient.GetRequestBody(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.IsAuthorized"))
+    assert.Contains(t, single, `"entityId":"alice"`)
+    assert.Contains(t, single, `"entityId":"carol"`)
+}
+
+func TestAvp_RunAuthzTests_batches(t *testing.T) {
+    mockClient, p := authzProvider()
+    tests := avpProvider.AuthzTests{}
+    decisions := make([]string, 35)
+    for i := range decisions {
+        decisions[i] = "ALLOW"
+        tests.Cases = append(tests.Cases, avpProvider.AuthzTestCase{
+            Principal: fmt.Sprintf("hexa_avp:User:\"user%d\"", i),
+            Action:    "hexa_avp:Action:\"ReadAccount\"",
+            Resource:  "hexa_avp:Account:\"1\"",
+            Decision:  "allow",
+        })
+    }
+
+    // AVP accepts at most 30 requests per batch
+    mockClient.MockBatchIsAuthorizedWithHttpStatus(http.StatusOK, decisions[:30]...)
+    mockClient.MockBatchIsAuthorizedWithHttpStatus(http.StatusOK, decisions[30:]...)
+    report, err := p.RunAuthzTests(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), tests)
+    assert.NoError(t, err)
+    assert.True(t, mockClient.VerifyCalled())
+    assert.Len(t, report.Failed(), 0)
+    assert.Equal(t, "case 34", report.Results[34].Name)
+
+    mockClient.MockBatchIsAuthorizedWithHttpStatus(http.StatusBadRequest)
+    _, err = p.RunAuthzTests(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), avpProvider.AuthzTests{Cases: tests.Cases[:1]})
+    assert.Error(t, err)
+    assert.True(t, mockClient.VerifyCalled())
+}
+
+func TestAvp_RunAuthzTests_groupsBatches(t *testing.T) {
+    mockClient, p := authzProvider()
+    authzCase := func(principal string, resource string) avpProvider.AuthzTestCase {
+        return avpProvider.AuthzTestCase{
+            Name:      principal + " reads " + resource,
+            Principal: fmt.Sprintf("hexa_avp:User:%q", principal),
+            Action:    "hexa_avp:Action:\"ReadAccount\"",
+            Resource:  fmt.Sprintf("hexa_avp:Account:%q", resource),
+            Decision:  "ALLOW",
+        }
+    }
+    tests := avpProvider.AuthzTests{Cases: []avpProvider.AuthzTestCase{
+        authzCase("alice", "1"),
+        authzCase("bob", "2"),
+        authzCase("alice", "3"),
+        authzCase("carol", "2"),
+        authzCase("dave", "4"),
+    }}
+
+    // A batch must share its principal or its resource: alice's cases, then the cases for account 2, then dave's
+    mockClient.MockBatchIsAuthorizedWithHttpStatus(http.StatusOK, "ALLOW", "ALLOW")
+    mockClient.MockBatchIsAuthorizedWithHttpStatus(http.StatusOK, "ALLOW", "DENY")
+    mockClient.MockBatchIsAuthorizedWithHttpStatus(http.StatusOK, "DENY")
+    report, err := p.RunAuthzTests(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), tests)
+    assert.NoError(t, err)
+    assert.True(t, mockClient.VerifyCalled())
+    assert.Len(t, report.Results, 5)
+    assert.Equal(t, []string{"carol reads 2", "dave reads 4"}, []string{report.Failed()[0].Name, report.Failed()[1].Name})
+
+    var batch map[string][]interface{}
+    _ = json.Unmarshal(mockClient.GetRequestBodyByIndex(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.BatchIsAuthorized", 1), &batch)
+    assert.Len(t, batch["requests"], 2)
+}
+
+func TestAvp_RunAuthzTestsContext(t *testing.T) {
+    mockClient, p := authzProvider()
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    _, err := p.RunAuthzTestsContext(ctx, avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), avpProvider.AuthzTests{Cases: []avpProvider.AuthzTestCase{{
+        Principal: "hexa_avp:User:\"alice\"",
+        Action:    "hexa_avp:Action:\"ReadAccount\"",
+        Resource:  "hexa_avp:Account:\"1\"",
+        Decision:  "ALLOW",
+    }}})
+    assert.ErrorIs(t, err, context.Canceled)
+    assert.True(t, mockClient.VerifyCalled())
+}
+
+func TestAvp_RunAuthzTests_invalid(t *testing.T) {
+    _, p := authzProvider()
+    valid := avpProvider.AuthzTestCase{
+        Name:      "test",
+        Principal: "hexa_avp:User:\"alice\"",
+        Action:    "hexa_avp:Action:\"ReadAccount\"",
+        Resource:  "hexa_avp:Account:\"1\"",
+        Decision:  "ALLOW",
+    }
+    tests := []struct {
+        name   string
+        change func(testCase *avpProvider.AuthzTestCase)
+        err    string
+    }{
+        {"decision", func(c *avpProvider.AuthzTestCase) { c.Decision = "MAYBE" }, "test case test: expected decision must be ALLOW or DENY"},
+        {"principal", func(c *avpProvider.AuthzTestCase) { c.Principal = "" }, "test case test: principal \"\" is not an entity"},
+        {"action", func(c *avpProvider.AuthzTestCase) { c.Action = "any" }, "test case test: action \"any\" is not an entity"},
+        {"context", func(c *avpProvider.AuthzTestCase) { c.Context = map[string]interface{}{"amount": 1.5} }, "test case test: context amount: 1.5 is not a long"},
+        {"entity", func(c *avpProvider.AuthzTestCase) {
+            c.Entities = []avpProvider.AuthzEntity{{Uid: avpProvider.AuthzEntityUid{Type: "hexa_avp::User"}}}
+        }, "test case test: entity 0: uid must have a type and id"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            testCase := valid
+            tt.change(&testCase)
+            _, err := p.RunAuthzTests(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), avpProvider.AuthzTests{Cases: []avpProvider.AuthzTestCase{testCase}})
+            assert.ErrorContains(t, err, tt.err)
+        })
+    }
+
+    _, err := avpProvider.ParseAuthzTests([]byte(`{"cases": []}`))
+    assert.EqualError(t, err, "invalid authorization tests: no test cases found")
+    _, err = avpProvider.ParseAuthzTests([]byte(`{"cases": [{"context": {"amount": 1.5}}]}`))
+    assert.NoError(t, err)
+}
@@ -0,0 +1,506 @@
+package avpProvider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/verifiedpermissions/types"
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/providers/aws/avpProvider/avpClient"
+)
+
+// Journal step operations
+const (
+	OpCreate string = "create"
+	OpUpdate string = "update"
+	OpDelete string = "delete"
+)
+
+// Journal step states
+const (
+	StepPending            string = "pending"
+	StepApplied            string = "applied"
+	StepFailed             string = "failed"
+	StepCompensated        string = "compensated"
+	StepCompensationFailed string = "compensation_failed"
+)
+
+// Policy outcomes reported by ApplyJournal.Outcomes
+const (
+	OutcomeApplied        string = "applied"
+	OutcomeFailed         string = "failed"
+	OutcomeRolledBack     string = "rolled_back"
+	OutcomeRollbackFailed string = "rollback_failed"
+	OutcomeNotApplied     string = "not_applied"
+)
+
+// JournalStep is a single AVP mutation. Steps belonging to the same IDQL policy (e.g. the delete and create of a
+// replacement) share a PolicyKey.
+type JournalStep struct {
+	PolicyKey      string                 `json:"policyKey"`
+	Operation      string                 `json:"operation"`
+	PolicyId       string                 `json:"policyId,omitempty"` // the AVP id changed, or created once applied
+	Policy         *hexapolicy.PolicyInfo `json:"policy,omitempty"`   // the policy created, or the update to apply
+	Previous       *hexapolicy.PolicyInfo `json:"previous,omitempty"` // the policy deleted or updated, used to compensate
+	State          string                 `json:"state"`
+	Error          string                 `json:"error,omitempty"`
+	CompensationId string                 `json:"compensationId,omitempty"` // the AVP id of a deleted policy recreated by rollback
+}
+
+/*
+ApplyJournal records the mutations planned and made by AmazonAvpProvider.ApplyPolicies. When an apply fails, the
+journal records which steps were applied, failed, or compensated (rolled back). A journal that was not rolled back may be
+passed to AmazonAvpProvider.ResumeApply to complete the remaining steps.
+*/
+type ApplyJournal struct {
+	PolicyStoreId string        `json:"policyStoreId"`
+	Started       time.Time     `json:"started"`
+	Updated       time.Time     `json:"updated"`
+	Steps         []JournalStep `json:"steps"`
+	path          string
+}
+
+// PolicyOutcome is the result of applying the steps of one IDQL policy
+type PolicyOutcome struct {
+	PolicyKey string `json:"policyKey"`
+	Outcome   string `json:"outcome"`
+	PolicyId  string `json:"policyId,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// LoadApplyJournal reads a journal saved by an apply. Subsequent changes made by ResumeApply are saved to the same file.
+func LoadApplyJournal(path string) (*ApplyJournal, error) {
+	journalBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var journal ApplyJournal
+	if err = json.Unmarshal(journalBytes, &journal); err != nil {
+		return nil, fmt.Errorf("invalid AVP apply journal %s: %w", path, err)
+	}
+	journal.path = path
+	return &journal, nil
+}
+
+// Save writes the journal as JSON to path
+func (j *ApplyJournal) Save(path string) error {
+	journalBytes, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, journalBytes, 0600)
+}
+
+// checkpoint saves the journal, if it has a file, after each change in state
+func (j *ApplyJournal) checkpoint() {
+	j.Updated = time.Now()
+	if j.path == "" {
+		return
+	}
+	if err := j.Save(j.path); err != nil {
+		log.Printf("Warning, unable to save AVP apply journal %s: %s", j.path, err.Error())
+	}
+}
+
+// Complete returns true when every step has been applied
+func (j *ApplyJournal) Complete() bool {
+	return !slices.ContainsFunc(j.Steps, func(step JournalStep) bool {
+		return step.State != StepApplied
+	})
+}
+
+// RolledBack returns true when a failed apply was compensated
+func (j *ApplyJournal) RolledBack() bool {
+	return slices.ContainsFunc(j.Steps, func(step JournalStep) bool {
+		return step.State == StepCompensated || step.State == StepCompensationFailed
+	})
+}
+
+// Outcomes returns the result for each policy in the order the policies were first changed
+func (j *ApplyJournal) Outcomes() []PolicyOutcome {
+	outcomes := make([]PolicyOutcome, 0)
+	index := make(map[string]int)
+	for _, step := range j.Steps {
+		i, exists := index[step.PolicyKey]
+		if !exists {
+			i = len(outcomes)
+			index[step.PolicyKey] = i
+			outcomes = append(outcomes, PolicyOutcome{PolicyKey: step.PolicyKey, Outcome: OutcomeApplied})
+		}
+		outcome := &outcomes[i]
+		if step.Error != "" && outcome.Error == "" {
+			outcome.Error = step.Error
+		}
+		switch step.State {
+		case StepApplied:
+			if step.Operation != OpDelete {
+				outcome.PolicyId = step.PolicyId
+			}
+		case StepCompensationFailed:
+			outcome.Outcome = OutcomeRollbackFailed
+		case StepFailed:
+			if outcome.Outcome != OutcomeRollbackFailed {
+				outcome.Outcome = OutcomeFailed
+			}
+		case StepCompensated:
+			if outcome.Outcome == OutcomeApplied || outcome.Outcome == OutcomeNotApplied {
+				outcome.Outcome = OutcomeRolledBack
+			}
+			if step.CompensationId != "" {
+				outcome.PolicyId = step.CompensationId
+			}
+		case StepPending:
+			if outcome.Outcome == OutcomeApplied {
+				outcome.Outcome = OutcomeNotApplied
+			}
+		}
+	}
+	return outcomes
+}
+
+// failure returns the first failed step
+func (j *ApplyJournal) failure() *JournalStep {
+	for i, step := range j.Steps {
+		if step.State == StepFailed {
+			return &j.Steps[i]
+		}
+	}
+	return nil
+}
+
+// policyKey identifies the IDQL policy of a step by its AVP id or, for a new policy, its etag
+func policyKey(hexaPolicy hexapolicy.PolicyInfo) string {
+	if hexaPolicy.Meta.PolicyId != nil && hexaPolicy.Meta.ProviderType == ProviderTypeAvp {
+		return *hexaPolicy.Meta.PolicyId
+	}
+	return "etag:" + hexaPolicy.CalculateEtag()
+}
+
+func policyStep(operation string, policy *hexapolicy.PolicyInfo, previous *hexapolicy.PolicyInfo) JournalStep {
+	step := JournalStep{Operation: operation, Policy: policy, Previous: previous, State: StepPending}
+	if previous != nil {
+		step.PolicyKey = policyKey(*previous)
+		step.PolicyId = aws.ToString(previous.Meta.PolicyId)
+	} else {
+		step.PolicyKey = policyKey(*policy)
+	}
+	return step
+}
+
+/*
+planSteps converts the reconciled differences into the AVP mutations needed to apply them. Deleting a template deletes
+its linked policies, so each existing policy linked to a deleted template is deleted explicitly first, allowing a rollback
+to restore it.
+*/
+func planSteps(differences []hexapolicy.PolicyDif, existing []hexapolicy.PolicyInfo) []JournalStep {
+	// Templates must exist before policies are linked to them, and deleting a template deletes its linked policies
+	slices.SortStableFunc(differences, func(a, b hexapolicy.PolicyDif) int {
+		return applyOrder(a) - applyOrder(b)
+	})
+
+	steps := make([]JournalStep, 0, len(differences))
+	for _, dif := range differences {
+		switch dif.Type {
+		case hexapolicy.ChangeTypeNew:
+			steps = append(steps, policyStep(OpCreate, dif.PolicyCompare, nil))
+
+		case hexapolicy.ChangeTypeDelete:
+			for i := range dif.PolicyExist {
+				steps = append(steps, policyStep(OpDelete, nil, &dif.PolicyExist[i]))
+			}
+
+		case hexapolicy.ChangeTypeUpdate:
+			hexaPolicy := dif.PolicyCompare
+			if hexaPolicy.Meta.ProviderType != ProviderTypeAvp || len(dif.PolicyExist) == 0 {
+				continue
+			}
+			existPolicy := &dif.PolicyExist[0]
+			switch avpPolicyType(*hexaPolicy) {
+			case PolicyTypeTemplate:
+				steps = append(steps, policyStep(OpUpdate, hexaPolicy, existPolicy))
+				continue
+
+			case string(types.PolicyTypeTemplateLinked):
+				// Template links cannot be modified, so are always replaced
+				for i := range dif.PolicyExist {
+					steps = append(steps, policyStep(OpDelete, nil, &dif.PolicyExist[i]))
+				}
+				create := policyStep(OpCreate, hexaPolicy, nil)
+				create.PolicyKey = policyKey(*existPolicy)
+				steps = append(steps, create)
+				continue
+			}
+
+			if slices.Contains(dif.DifTypes, hexapolicy.CompareDifSubject) || slices.Contains(dif.DifTypes, hexapolicy.CompareDifObject) {
+				// will delete and replace
+				create := policyStep(OpCreate, hexaPolicy, nil)
+				create.PolicyKey = policyKey(*existPolicy)
+				steps = append(steps, policyStep(OpDelete, nil, existPolicy), create)
+			} else if slices.Contains(dif.DifTypes, hexapolicy.CompareDifAction) || slices.Contains(dif.DifTypes, hexapolicy.CompareDifCondition) {
+				steps = append(steps, policyStep(OpUpdate, hexaPolicy, existPolicy))
+			}
+		case hexapolicy.ChangeTypeIgnore, hexapolicy.ChangeTypeEqual:
+			// do nothing
+		}
+	}
+	return deleteLinkedPolicies(steps, existing)
+}
+
+// deleteLinkedPolicies inserts a delete step, before the first template delete, for each existing policy linked to a
+// deleted template that is not already deleted
+func deleteLinkedPolicies(steps []JournalStep, existing []hexapolicy.PolicyInfo) []JournalStep {
+	deleted := make(map[string]bool)
+	deletedTemplates := make(map[string]bool)
+	firstTemplate := len(steps)
+	for i, step := range steps {
+		if step.Operation != OpDelete {
+			continue
+		}
+		deleted[step.PolicyId] = true
+		if avpPolicyType(*step.Previous) == PolicyTypeTemplate {
+			deletedTemplates[step.PolicyId] = true
+			firstTemplate = min(firstTemplate, i)
+		}
+	}
+	if len(deletedTemplates) == 0 {
+		return steps
+	}
+
+	var linkedSteps []JournalStep
+	for i := range existing {
+		linked := &existing[i]
+		if avpPolicyType(*linked) != string(types.PolicyTypeTemplateLinked) || !deletedTemplates[linkedTemplateId(*linked)] {
+			continue
+		}
+		if !deleted[aws.ToString(linked.Meta.PolicyId)] {
+			linkedSteps = append(linkedSteps, policyStep(OpDelete, nil, linked))
+		}
+	}
+	return slices.Insert(steps, firstTemplate, linkedSteps...)
+}
+
+// validateSteps maps each policy to be created or updated to Cedar so that mapping errors are found before any change
+// is made. Template-linked policies are validated when their template is retrieved.
+func (a AmazonAvpProvider) validateSteps(steps []JournalStep) error {
+	for _, step := range steps {
+		if step.Policy == nil || avpPolicyType(*step.Policy) == string(types.PolicyTypeTemplateLinked) {
+			continue
+		}
+		if _, err := a.convertCedarStatement(*step.Policy); err != nil {
+			return fmt.Errorf("unable to map policy %s to Cedar: %w", step.PolicyKey, err)
+		}
+	}
+	return nil
+}
+
+/*
+verifySteps checks each step still to be applied against the policies now in the policy store, which may have changed
+since the journal was saved (including by the interrupted apply itself). A create whose policy already exists, a delete
+whose policy no longer exists, or an update already made, is marked applied rather than replayed. When a policy to be
+deleted or updated no longer matches the journal, an error is returned and no step is changed.
+*/
+func (j *ApplyJournal) verifySteps(existing []hexapolicy.PolicyInfo) error {
+	current := make(map[string]hexapolicy.PolicyInfo, len(existing))
+	for _, policy := range existing {
+		current[aws.ToString(policy.Meta.PolicyId)] = policy
+	}
+	// policies created or deleted by the journal cannot be the result of another create
+	claimed := make(map[string]bool)
+	for _, step := range j.Steps {
+		if step.PolicyId != "" {
+			claimed[step.PolicyId] = true
+		}
+	}
+
+	applied := make(map[int]string) // step index -> AVP id of the policy in the store
+	var errs []error
+	for i, step := range j.Steps {
+		if step.State != StepPending && step.State != StepFailed {
+			continue
+		}
+		switch step.Operation {
+		case OpCreate:
+			for id, policy := range current {
+				if !claimed[id] && policy.Equals(*step.Policy) {
+					claimed[id] = true
+					applied[i] = id
+					break
+				}
+			}
+		case OpDelete:
+			policy, exists := current[step.PolicyId]
+			if !exists {
+				applied[i] = step.PolicyId
+			} else if !policy.Equals(*step.Previous) {
+				errs = append(errs, fmt.Errorf("AVP policy %s to be deleted was changed after the journal was saved", step.PolicyId))
+			}
+		case OpUpdate:
+			policy, exists := current[step.PolicyId]
+			switch {
+			case !exists:
+				errs = append(errs, fmt.Errorf("AVP policy %s to be updated was deleted after the journal was saved", step.PolicyId))
+			case policy.Equals(*step.Policy):
+				applied[i] = step.PolicyId
+			case !policy.Equals(*step.Previous):
+				errs = append(errs, fmt.Errorf("AVP policy %s to be updated was changed after the journal was saved", step.PolicyId))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for i, policyId := range applied {
+		step := &j.Steps[i]
+		step.State = StepApplied
+		step.PolicyId = policyId
+		step.Error = ""
+		log.Printf("AVP %s of %s was already applied", step.Operation, step.PolicyKey)
+	}
+	if len(applied) > 0 {
+		j.checkpoint()
+	}
+	return nil
+}
+
+// runSteps applies the pending (or previously failed) steps of the journal in order, stopping at the first failure
+func (a AmazonAvpProvider) runSteps(client avpClient.AvpClient, app policyprovider.ApplicationInfo, journal *ApplyJournal) error {
+	for i := range journal.Steps {
+		step := &journal.Steps[i]
+		if step.State != StepPending && step.State != StepFailed {
+			continue
+		}
+		err := a.applyStep(client, app, step)
+		if err != nil {
+			step.State = StepFailed
+			step.Error = err.Error()
+			journal.checkpoint()
+			return err
+		}
+		step.State = StepApplied
+		step.Error = ""
+		journal.checkpoint()
+	}
+	return nil
+}
+
+func (a AmazonAvpProvider) applyStep(client avpClient.AvpClient, app policyprovider.ApplicationInfo, step *JournalStep) error {
+	switch step.Operation {
+	case OpCreate:
+		policyId, err := a.createPolicy(client, *step.Policy, app)
+		if err != nil {
+			return err
+		}
+		step.PolicyId = *policyId
+		log.Printf("AVP PolicyId %s created (hexa etag: %s)", *policyId, step.Policy.Meta.Etag)
+
+	case OpDelete:
+		err := a.deletePolicy(client, *step.Previous)
+		if err != nil && !isNotFound(err) { // already deleted (e.g. by an interrupted apply)
+			return err
+		}
+		log.Printf("AVP PolicyId %s deleted", step.PolicyId)
+
+	case OpUpdate:
+		err := a.updatePolicy(client, *step.Policy, step.Policy.Meta)
+		if err != nil {
+			return err
+		}
+		log.Printf("AVP PolicyId %s updated", step.PolicyId)
+
+	default:
+		return fmt.Errorf("unknown AVP apply journal operation %s", step.Operation)
+	}
+	return nil
+}
+
+// updatePolicy updates the statement and description of the policy or policy template identified by meta
+func (a AmazonAvpProvider) updatePolicy(client avpClient.AvpClient, hexaPolicy hexapolicy.PolicyInfo, meta hexapolicy.MetaInfo) error {
+	if avpPolicyType(hexaPolicy) == PolicyTypeTemplate {
+		update, err := a.prepareTemplateUpdate(hexaPolicy, meta)
+		if err != nil {
+			return err
+		}
+		_, err = client.UpdatePolicyTemplate(update)
+		return err
+	}
+	update, err := a.preparePolicyUpdate(hexaPolicy, meta)
+	if err != nil {
+		return err
+	}
+	_, err = client.UpdatePolicy(update)
+	return err
+}
+
+/*
+compensate reverses the applied steps of the journal in reverse order: created policies are deleted, updated policies are
+restored and deleted policies are recreated. A recreated policy or template is assigned a new AVP id, so policies linked
+to a recreated template are linked to its new id.
+*/
+func (a AmazonAvpProvider) compensate(client avpClient.AvpClient, app policyprovider.ApplicationInfo, journal *ApplyJournal) error {
+	var errs []error
+	templateIds := make(map[string]string) // deleted template id -> recreated template id
+	for i := len(journal.Steps) - 1; i >= 0; i-- {
+		step := &journal.Steps[i]
+		if step.State != StepApplied {
+			continue
+		}
+		var err error
+		switch step.Operation {
+		case OpCreate:
+			created := *step.Policy
+			created.Meta.PolicyId = aws.String(step.PolicyId)
+			created.Meta.PapId = aws.String(app.ObjectID)
+			err = a.deletePolicy(client, created)
+			if isNotFound(err) {
+				err = nil
+			}
+		case OpUpdate:
+			err = a.updatePolicy(client, *step.Previous, step.Previous.Meta)
+		case OpDelete:
+			previous := *step.Previous
+			if templateId, ok := templateIds[linkedTemplateId(previous)]; ok {
+				previous.Meta.SourceData = relinkSourceData(previous.Meta.SourceData, templateId)
+			}
+			var policyId *string
+			policyId, err = a.createPolicy(client, previous, app)
+			if err == nil {
+				step.CompensationId = *policyId
+				if avpPolicyType(previous) == PolicyTypeTemplate {
+					templateIds[step.PolicyId] = *policyId
+				}
+			}
+		}
+		if err != nil {
+			step.State = StepCompensationFailed
+			step.Error = err.Error()
+			errs = append(errs, fmt.Errorf("unable to roll back %s of AVP policy %s: %w", step.Operation, step.PolicyKey, err))
+		} else {
+			step.State = StepCompensated
+			log.Printf("AVP %s of %s rolled back", step.Operation, step.PolicyKey)
+		}
+		journal.checkpoint()
+	}
+	return errors.Join(errs...)
+}
+
+func relinkSourceData(sourceData map[string]interface{}, templateId string) map[string]interface{} {
+	relinked := make(map[string]interface{}, len(sourceData))
+	for k, v := range sourceData {
+		relinked[k] = v
+	}
+	relinked[ParamTemplateId] = templateId
+	return relinked
+}
+
+func isNotFound(err error) bool {
+	var notFound *types.ResourceNotFoundException
+	return errors.As(err, &notFound)
+}
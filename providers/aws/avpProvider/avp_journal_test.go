@@ -0,0 +1,229 @@
+package avpProvider_test
+
+import (
+    "net/http"
+    "path/filepath"
+    "testing"
+
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/hexa-org/policy-mapper/api/policyprovider"
+    "github.com/hexa-org/policy-mapper/models/formats/cedar"
+    "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+    "github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+    "github.com/hexa-org/policy-mapper/providers/aws/avpProvider"
+    "github.com/hexa-org/policy-mapper/providers/aws/avpProvider/avpClient/avpTestSupport"
+    "github.com/hexa-org/policy-mapper/providers/aws/awscommon"
+    "github.com/stretchr/testify/assert"
+)
+
+// journalTest returns a provider with the current policies of the mock policy store and a change replacing the static
+// policy (by changing its subject)
+func journalTest(t *testing.T) (*avpTestSupport.MockVerifiedPermissionsHTTPClient, avpProvider.AmazonAvpProvider, []hexapolicy.PolicyInfo) {
+    mockClient := avpTestSupport.NewMockVerifiedPermissionsHTTPClient()
+    p := avpProvider.AmazonAvpProvider{
+        AwsClientOpts: awscommon.AWSClientOptions{
+            HTTPClient:   mockClient,
+            DisableRetry: true,
+        },
+        CedarMapper: cedar.NewCedarMapper(map[string]string{})}
+
+    mockGetPolicies(mockClient)
+    policies, err := p.GetPolicyInfo(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo())
+    assert.NoError(t, err)
+    policies[0].Subjects = hexapolicy.SubjectInfo{"hexa_avp::User::\"gerry@strata.io\""}
+    return mockClient, p, policies
+}
+
+func mockGetPolicies(mockClient *avpTestSupport.MockVerifiedPermissionsHTTPClient) {
+    mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
+    mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+}
+
+func TestAvp_ApplyPolicies_Rollback(t *testing.T) {
+    mockClient, p, policies := journalTest(t)
+    policyId := avpTestSupport.TestCedarStaticPolicyId + "0"
+
+    // The replacement is created after the existing policy is deleted. When the create fails, the policy is recreated.
+    mockGetPolicies(mockClient)
+    mockClient.MockDeletePolicyWithHttpStatus(http.StatusOK)
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusBadRequest, "")
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusOK, "id40")
+    journal, err := p.ApplyPolicies(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), policies)
+    assert.ErrorContains(t, err, "AVP create of policy "+policyId+" failed")
+    assert.ErrorContains(t, err, "changes rolled back")
+    assert.True(t, mockClient.VerifyCalled())
+
+    assert.Len(t, journal.Steps, 2)
+    assert.Equal(t, avpProvider.OpDelete, journal.Steps[0].Operation)
+    assert.Equal(t, avpProvider.StepCompensated, journal.Steps[0].State)
+    assert.Equal(t, "id40", journal.Steps[0].CompensationId)
+    assert.Equal(t, avpProvider.StepFailed, journal.Steps[1].State)
+    assert.False(t, journal.Complete())
+    assert.True(t, journal.RolledBack())
+
+    outcomes := journal.Outcomes()
+    assert.Len(t, outcomes, 1)
+    assert.Equal(t, policyId, outcomes[0].PolicyKey)
+    assert.Equal(t, avpProvider.OutcomeFailed, outcomes[0].Outcome)
+    assert.Equal(t, "id40", outcomes[0].PolicyId)
+    assert.NotEmpty(t, outcomes[0].Error)
+
+    // The recreated policy is the deleted policy's statement
+    recreated := string(mockClient.GetRequestBodyByIndex(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.CreatePolicy", 1))
+    assert.NotContains(t, recreated, "gerry@strata.io")
+    assert.Contains(t, recreated, "ReadAccount")
+
+    // A journal that was rolled back cannot be resumed
+    _, err = p.ResumeApply(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), journal)
+    assert.ErrorContains(t, err, "rolled back")
+
+    // SetPolicyInfo reports the failure
+    mockGetPolicies(mockClient)
+    mockClient.MockDeletePolicyWithHttpStatus(http.StatusOK)
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusBadRequest, "")
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusOK, "id41")
+    status, err := p.SetPolicyInfo(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), policies)
+    assert.Error(t, err)
+    assert.Equal(t, http.StatusInternalServerError, status, "an AVP request failure is not a bad request")
+    assert.True(t, mockClient.VerifyCalled())
+
+    // A policy that cannot be mapped to Cedar is a bad request
+    invalid := policies[0]
+    invalid.Condition = &conditions.ConditionInfo{Rule: "bad condition ("}
+    mockGetPolicies(mockClient)
+    status, err = p.SetPolicyInfo(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), []hexapolicy.PolicyInfo{invalid})
+    assert.ErrorIs(t, err, avpProvider.ErrInvalidPolicy)
+    assert.Equal(t, http.StatusBadRequest, status)
+    assert.True(t, mockClient.VerifyCalled())
+}
+
+func TestAvp_ApplyPolicies_RollbackTemplateDelete(t *testing.T) {
+    mockClient, p, _ := journalTest(t)
+    mockGetPolicies(mockClient)
+    policies, err := p.GetPolicyInfo(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo())
+    assert.NoError(t, err)
+    link := policies[1]
+    linkId := *link.Meta.PolicyId
+
+    // Removing the template (but not its link) deletes the link explicitly, so that the rollback can recreate it
+    mockGetPolicies(mockClient)
+    mockClient.MockDeletePolicyWithHttpStatus(http.StatusOK)
+    mockClient.MockDeletePolicyTemplateWithHttpStatus(http.StatusInternalServerError)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusOK, "id50")
+    journal, err := p.ApplyPolicies(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), policies[0:2])
+    assert.ErrorContains(t, err, "changes rolled back")
+    assert.True(t, mockClient.VerifyCalled())
+
+    assert.Len(t, journal.Steps, 2)
+    assert.Equal(t, avpProvider.OpDelete, journal.Steps[0].Operation)
+    assert.Equal(t, linkId, journal.Steps[0].PolicyId)
+    assert.Equal(t, avpProvider.StepCompensated, journal.Steps[0].State)
+    assert.Equal(t, "id50", journal.Steps[0].CompensationId)
+    assert.Equal(t, avpTestSupport.TestCedarTemplateId, journal.Steps[1].PolicyId)
+    assert.Equal(t, avpProvider.StepFailed, journal.Steps[1].State)
+
+    recreated := string(mockClient.GetRequestBodyByIndex(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.CreatePolicy", 0))
+    assert.Contains(t, recreated, `"policyTemplateId":"`+avpTestSupport.TestCedarTemplateId+`"`)
+}
+
+func TestAvp_ApplyPolicies_RollbackFailed(t *testing.T) {
+    mockClient, p, policies := journalTest(t)
+
+    mockGetPolicies(mockClient)
+    mockClient.MockDeletePolicyWithHttpStatus(http.StatusOK)
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusBadRequest, "")
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusInternalServerError, "")
+    journal, err := p.ApplyPolicies(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), policies)
+    assert.ErrorContains(t, err, "unable to roll back delete")
+    assert.True(t, mockClient.VerifyCalled())
+    assert.Equal(t, avpProvider.StepCompensationFailed, journal.Steps[0].State)
+    assert.Equal(t, avpProvider.OutcomeRollbackFailed, journal.Outcomes()[0].Outcome)
+}
+
+func TestAvp_ApplyPolicies_Resume(t *testing.T) {
+    mockClient, p, policies := journalTest(t)
+    policyId := avpTestSupport.TestCedarStaticPolicyId + "0"
+    p.DisableRollback = true
+    p.JournalPath = filepath.Join(t.TempDir(), "journal.json")
+
+    mockGetPolicies(mockClient)
+    mockClient.MockDeletePolicyWithHttpStatus(http.StatusOK)
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusBadRequest, "")
+    journal, err := p.ApplyPolicies(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), policies)
+    assert.ErrorContains(t, err, "AVP create of policy "+policyId+" failed")
+    assert.NotContains(t, err.Error(), "rolled back")
+    assert.True(t, mockClient.VerifyCalled())
+    assert.Equal(t, []string{avpProvider.StepApplied, avpProvider.StepFailed}, []string{journal.Steps[0].State, journal.Steps[1].State})
+
+    // The journal saved by the failed apply is resumed from the failed step
+    saved, err := avpProvider.LoadApplyJournal(p.JournalPath)
+    assert.NoError(t, err)
+    assert.Equal(t, journal.Steps[1].State, saved.Steps[1].State)
+    assert.Contains(t, saved.Steps[1].Policy.Subjects[0], "gerry@strata.io")
+
+    // The store is checked before resuming: the static policy was deleted, and its replacement is not yet created
+    mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 0, 1, nil)
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusOK, "id42")
+    resumed, err := avpProvider.AmazonAvpProvider{AwsClientOpts: p.AwsClientOpts}.ResumeApply(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), saved)
+    assert.NoError(t, err)
+    assert.True(t, mockClient.VerifyCalled())
+    assert.True(t, resumed.Complete())
+    assert.Equal(t, []avpProvider.PolicyOutcome{{PolicyKey: policyId, Outcome: avpProvider.OutcomeApplied, PolicyId: "id42"}}, resumed.Outcomes())
+
+    // The resumed journal is saved to the file it was loaded from
+    saved, err = avpProvider.LoadApplyJournal(p.JournalPath)
+    assert.NoError(t, err)
+    assert.True(t, saved.Complete())
+
+    // A journal applies only to its own policy store
+    _, err = p.ResumeApply(avpTestSupport.IntegrationInfo(), policyprovider.ApplicationInfo{ObjectID: "another"}, saved)
+    assert.ErrorContains(t, err, "is for policy store "+avpTestSupport.TestPolicyStoreId)
+}
+
+func TestAvp_ResumeApply_VerifiesSteps(t *testing.T) {
+    mockClient, p, policies := journalTest(t)
+    policyId := avpTestSupport.TestCedarStaticPolicyId + "0"
+    existing := policies[0] // the journal's copy of the policy, with a subject the store no longer has
+    mockGetPolicies(mockClient)
+    current, err := p.GetPolicyInfo(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo())
+    assert.NoError(t, err)
+
+    // The create was made before the apply was interrupted, and the policy to be deleted is already gone
+    created := current[0]
+    created.Meta = hexapolicy.MetaInfo{Description: "created"}
+    deleted := current[0]
+    deleted.Meta.PolicyId = aws.String("deletedId")
+    journal := &avpProvider.ApplyJournal{
+        PolicyStoreId: avpTestSupport.TestPolicyStoreId,
+        Steps: []avpProvider.JournalStep{
+            {PolicyKey: "deletedId", Operation: avpProvider.OpDelete, PolicyId: "deletedId", Previous: &deleted, State: avpProvider.StepPending},
+            {PolicyKey: "etag:new", Operation: avpProvider.OpCreate, Policy: &created, State: avpProvider.StepFailed},
+        },
+    }
+    mockGetPolicies(mockClient)
+    resumed, err := p.ResumeApply(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), journal)
+    assert.NoError(t, err)
+    assert.True(t, mockClient.VerifyCalled(), "no AVP mutation is made")
+    assert.True(t, resumed.Complete())
+    assert.Equal(t, policyId, resumed.Steps[1].PolicyId)
+
+    // An update of a policy that has changed since the journal was saved (here, its subject) is not replayed
+    update := current[0]
+    update.Actions = append([]hexapolicy.ActionInfo{"hexa_avp::Action::\"UpdateAccount\""}, update.Actions...)
+    journal = &avpProvider.ApplyJournal{
+        PolicyStoreId: avpTestSupport.TestPolicyStoreId,
+        Steps: []avpProvider.JournalStep{
+            {PolicyKey: policyId, Operation: avpProvider.OpUpdate, PolicyId: policyId, Policy: &update, Previous: &existing, State: avpProvider.StepPending},
+        },
+    }
+    mockGetPolicies(mockClient)
+    resumed, err = p.ResumeApply(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), journal)
+    assert.ErrorContains(t, err, "AVP policy "+policyId+" to be updated was changed after the journal was saved")
+    assert.True(t, mockClient.VerifyCalled())
+    assert.Equal(t, avpProvider.StepPending, resumed.Steps[0].State)
+}
@@ -1,34 +1,55 @@
 package avpProvider
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"slices"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/verifiedpermissions"
 	"github.com/aws/aws-sdk-go-v2/service/verifiedpermissions/types"
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
 	"github.com/hexa-org/policy-mapper/models/formats/cedar"
 	"github.com/hexa-org/policy-mapper/models/policyInfoModel"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	hexaTypes "github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
 	"github.com/hexa-org/policy-mapper/providers/aws/avpProvider/avpClient"
 	"github.com/hexa-org/policy-mapper/providers/aws/awscommon"
 )
 
 const (
-	ProviderTypeAvp string = "avp"
-	ParamResource   string = "resource"
-	ParamPrincipal  string = "principal"
-	ParamPolicyType string = "policyType"
+	ProviderTypeAvp    string = "avp"
+	ParamResource      string = "resource"
+	ParamPrincipal     string = "principal"
+	ParamPolicyType    string = "policyType"
+	ParamTemplateId    string = "policyTemplateId"
+	PolicyTypeTemplate string = "TEMPLATE" // Policy type used in IDQL meta for an AVP policy template
+	CompareDifTemplate string = "TEMPLATE" // Difference type when a template-linked policy is linked to a different template
+
+	SettingValidationMode string = "validationMode" // CreateApplication setting for the policy store validation mode
 )
 
+// ErrInvalidPolicy is returned (wrapped) when an IDQL policy cannot be represented in AVP. SetPolicyInfo returns
+// http.StatusBadRequest for these errors, and http.StatusInternalServerError when AVP requests fail.
+var ErrInvalidPolicy = errors.New("invalid AVP policy")
+
 func MapAvpMeta(item types.PolicyItem) hexapolicy.MetaInfo {
 	data := map[string]interface{}{}
 
 	data[ParamPrincipal] = item.Principal
 	data[ParamResource] = item.Resource
 	data[ParamPolicyType] = string(types.PolicyTypeStatic)
+	if linked, ok := item.Definition.(*types.PolicyDefinitionItemMemberTemplateLinked); ok {
+		data[ParamPolicyType] = string(types.PolicyTypeTemplateLinked)
+		data[ParamTemplateId] = aws.ToString(linked.Value.PolicyTemplateId)
+		data[ParamPrincipal] = linked.Value.Principal
+		data[ParamResource] = linked.Value.Resource
+	}
 
 	return hexapolicy.MetaInfo{
 		Version:      hexapolicy.IdqlVersion,
@@ -43,7 +64,7 @@ func MapAvpMeta(item types.PolicyItem) hexapolicy.MetaInfo {
 
 func MapAvpTemplate(item *verifiedpermissions.GetPolicyTemplateOutput) hexapolicy.MetaInfo {
 	data := map[string]interface{}{}
-	data[ParamPolicyType] = string(types.PolicyTypeTemplateLinked)
+	data[ParamPolicyType] = PolicyTypeTemplate
 	return hexapolicy.MetaInfo{
 		Version:      hexapolicy.IdqlVersion,
 		ProviderType: ProviderTypeAvp,
@@ -57,8 +78,10 @@ func MapAvpTemplate(item *verifiedpermissions.GetPolicyTemplateOutput) hexapolic
 
 type (
 	AmazonAvpProvider struct {
-		AwsClientOpts awscommon.AWSClientOptions
-		CedarMapper   *cedar.CedarMapper
+		AwsClientOpts   awscommon.AWSClientOptions
+		CedarMapper     *cedar.CedarMapper
+		JournalPath     string // when set, the journal of each apply is saved to this file (see ApplyPolicies)
+		DisableRollback bool   // when true, a failed apply is not rolled back so that it may be resumed
 	}
 )
 
@@ -66,29 +89,45 @@ func (a AmazonAvpProvider) Name() string {
 	return ProviderTypeAvp
 }
 
-func (a AmazonAvpProvider) initCedarMapper() {
+func (a AmazonAvpProvider) Capabilities() policyprovider.Capabilities {
+	return policyprovider.Capabilities{
+		Conditions:      true,
+		DenyConditions:  true, // mapped to a Cedar unless clause
+		Templates:       true,
+		Wildcards:       true,
+		MultipleActions: true,
+		Objects:         true,
+	}
+}
+
+// cedarMapper returns the provider's mapper or, if not set, a mapper with no attribute mapping
+func (a AmazonAvpProvider) cedarMapper() *cedar.CedarMapper {
 	if a.CedarMapper == nil {
-		a.CedarMapper = cedar.NewCedarMapper(map[string]string{})
+		return cedar.NewCedarMapper(map[string]string{})
 	}
+	return a.CedarMapper
 }
 
-func (a AmazonAvpProvider) getAvpClient(info policyprovider.IntegrationInfo) (avpClient.AvpClient, error) {
+func (a AmazonAvpProvider) getAvpClient(ctx context.Context, info policyprovider.IntegrationInfo) (avpClient.AvpClient, error) {
 	var err error
-	client, err := avpClient.NewAvpClient(info.Key, a.AwsClientOpts) // NewFromConfig(info.Key, a.AwsClientOpts)
+	client, err := avpClient.NewAvpClientContext(ctx, info.Key, a.AwsClientOpts)
 	if err != nil {
 		return nil, err
 	}
-	a.initCedarMapper()
 
 	return client, nil
 }
 
 func (a AmazonAvpProvider) DiscoverApplications(info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
+	return a.DiscoverApplicationsContext(context.Background(), info)
+}
+
+func (a AmazonAvpProvider) DiscoverApplicationsContext(ctx context.Context, info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
 	if !strings.EqualFold(info.Name, a.Name()) {
 		return []policyprovider.ApplicationInfo{}, nil
 	}
 
-	client, err := a.getAvpClient(info)
+	client, err := a.getAvpClient(ctx, info)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +135,7 @@ func (a AmazonAvpProvider) DiscoverApplications(info policyprovider.IntegrationI
 	return client.ListStores()
 }
 
-func (a AmazonAvpProvider) mapAvpPolicyToHexa(avpPolicy types.PolicyItem, client avpClient.AvpClient, applicationInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+func (a AmazonAvpProvider) mapAvpPolicyToHexa(avpPolicy types.PolicyItem, client avpClient.AvpClient, applicationInfo policyprovider.ApplicationInfo, templates map[string]hexapolicy.PolicyInfo) ([]hexapolicy.PolicyInfo, error) {
 	hexaPols := make([]hexapolicy.PolicyInfo, 0)
 	policyType := avpPolicy.PolicyType
 
@@ -109,7 +148,7 @@ func (a AmazonAvpProvider) mapAvpPolicyToHexa(avpPolicy types.PolicyItem, client
 		policyDefinition := output.Definition
 		policyStatic := policyDefinition.(*types.PolicyDefinitionDetailMemberStatic).Value
 		cedarPolicy := policyStatic.Statement
-		mapPols, err := a.CedarMapper.MapCedarPolicyBytes(applicationInfo.ObjectID, []byte(*cedarPolicy))
+		mapPols, err := a.cedarMapper().MapCedarPolicyBytes(applicationInfo.ObjectID, []byte(*cedarPolicy))
 		if err != nil {
 			return nil, err
 		}
@@ -117,8 +156,8 @@ func (a AmazonAvpProvider) mapAvpPolicyToHexa(avpPolicy types.PolicyItem, client
 
 		// Update IDQL Meta
 		avpMeta := MapAvpMeta(avpPolicy)
-		hexaPolicy.Meta = avpMeta
-		hexaPolicy.Meta.Description = *policyStatic.Description
+		avpMeta.Description = aws.ToString(policyStatic.Description)
+		hexaPolicy.Meta = mergeAvpMeta(avpMeta, hexaPolicy.Meta)
 		hexaPolicy.CalculateEtag()
 		hexaPols = append(hexaPols, hexaPolicy)
 
@@ -127,33 +166,26 @@ func (a AmazonAvpProvider) mapAvpPolicyToHexa(avpPolicy types.PolicyItem, client
 		policyDefinition := avpPolicy.Definition
 		policyLinked := policyDefinition.(*types.PolicyDefinitionItemMemberTemplateLinked).Value
 
-		output, err := client.GetTemplatePolicy(*policyLinked.PolicyTemplateId, applicationInfo)
-		if err != nil {
-			return nil, err
-		}
-		// permit(
-		//    principal == ?principal,
-		//    action in [hexa_avp::Action::"ReadAccount"],
-		//    resource == ?resource
-		// );
-		policyString := *output.Statement
-		policyString = strings.Replace(policyString, "?principal", "Template::\"principal\"", -1)
-		policyString = strings.Replace(policyString, "?resource", "Template::\"resource\"", -1)
-
-		mapPols, err := a.CedarMapper.MapCedarPolicyBytes(applicationInfo.ObjectID, []byte(policyString))
-		if err != nil {
-			return nil, err
+		templateId := *policyLinked.PolicyTemplateId
+		template, exists := templates[templateId]
+		if !exists {
+			// The template was not present when templates were listed
+			output, err := client.GetTemplatePolicy(templateId, applicationInfo)
+			if err != nil {
+				return nil, err
+			}
+			template, err = a.mapAvpTemplateToHexa(output, applicationInfo)
+			if err != nil {
+				return nil, err
+			}
+			templates[templateId] = template
 		}
-		hexaPolicy := mapPols.Policies[0]
 
-		// Update the meta information
-		avpMeta := MapAvpTemplate(output)
-		avpMeta.SourceData[ParamResource] = avpPolicy.Resource
-		avpMeta.SourceData[ParamPrincipal] = avpPolicy.Principal
-		hexaPolicy.Meta = avpMeta
-		if output.Description != nil {
-			hexaPolicy.Meta.Description = *output.Description
-		}
+		// The linked policy is the template with the ?principal and ?resource slots replaced
+		hexaPolicy := cedar.LinkTemplate(template, entityValue(policyLinked.Principal), entityValue(policyLinked.Resource))
+		avpMeta := MapAvpMeta(avpPolicy)
+		avpMeta.Description = template.Meta.Description
+		hexaPolicy.Meta = mergeAvpMeta(avpMeta, hexaPolicy.Meta)
 		hexaPolicy.CalculateEtag()
 		hexaPols = append(hexaPols, hexaPolicy)
 
@@ -162,8 +194,73 @@ func (a AmazonAvpProvider) mapAvpPolicyToHexa(avpPolicy types.PolicyItem, client
 	return hexaPols, nil
 }
 
+func (a AmazonAvpProvider) mapAvpTemplateToHexa(output *verifiedpermissions.GetPolicyTemplateOutput, applicationInfo policyprovider.ApplicationInfo) (hexapolicy.PolicyInfo, error) {
+	// permit(
+	//    principal == ?principal,
+	//    action in [hexa_avp::Action::"ReadAccount"],
+	//    resource == ?resource
+	// );
+	mapPols, err := a.cedarMapper().MapCedarPolicyBytes(applicationInfo.ObjectID, []byte(*output.Statement))
+	if err != nil {
+		return hexapolicy.PolicyInfo{}, err
+	}
+	if len(mapPols.Policies) == 0 {
+		return hexapolicy.PolicyInfo{}, fmt.Errorf("AVP policy template %s has no policy statement", *output.PolicyTemplateId)
+	}
+	hexaPolicy := mapPols.Policies[0]
+
+	// Update the meta information
+	avpMeta := MapAvpTemplate(output)
+	avpMeta.Description = aws.ToString(output.Description)
+	hexaPolicy.Meta = mergeAvpMeta(avpMeta, hexaPolicy.Meta)
+	hexaPolicy.CalculateEtag()
+	return hexaPolicy, nil
+}
+
+/*
+mergeAvpMeta returns avpMeta with the source data (e.g. the Cedar annotations) of the meta mapped from the Cedar statement.
+The AVP policy id is kept, and the Cedar `@description` is used when AVP has no description.
+*/
+func mergeAvpMeta(avpMeta hexapolicy.MetaInfo, cedarMeta hexapolicy.MetaInfo) hexapolicy.MetaInfo {
+	for key, value := range cedarMeta.SourceData {
+		if _, exists := avpMeta.SourceData[key]; !exists {
+			avpMeta.SourceData[key] = value
+		}
+	}
+	if avpMeta.Description == "" {
+		avpMeta.Description = cedarMeta.Description
+	}
+	return avpMeta
+}
+
+// getTemplates retrieves the policy templates in the policy store in the order listed
+func (a AmazonAvpProvider) getTemplates(client avpClient.AvpClient, applicationInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	templateItems, err := client.ListPolicyTemplates(applicationInfo)
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]hexapolicy.PolicyInfo, 0, len(templateItems))
+	for _, item := range templateItems {
+		output, err := client.GetTemplatePolicy(*item.PolicyTemplateId, applicationInfo)
+		if err != nil {
+			return nil, err
+		}
+		template, err := a.mapAvpTemplateToHexa(output, applicationInfo)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
+
+// GetPolicyInfo returns the static and template-linked policies in the policy store followed by the policy templates.
 func (a AmazonAvpProvider) GetPolicyInfo(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
-	client, err := a.getAvpClient(info)
+	return a.GetPolicyInfoContext(context.Background(), info, applicationInfo)
+}
+
+func (a AmazonAvpProvider) GetPolicyInfoContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	client, err := a.getAvpClient(ctx, info)
 	if err != nil {
 		return nil, err
 	}
@@ -174,25 +271,42 @@ func (a AmazonAvpProvider) GetPolicyInfo(info policyprovider.IntegrationInfo, ap
 		return nil, err
 	}
 
+	templates, err := a.getTemplates(client, applicationInfo)
+	if err != nil {
+		return nil, err
+	}
+	templateMap := make(map[string]hexapolicy.PolicyInfo, len(templates))
+	for _, template := range templates {
+		templateMap[*template.Meta.PolicyId] = template
+	}
+
 	for _, avpPolicy := range avpPolicies {
-		policies, err := a.mapAvpPolicyToHexa(avpPolicy, client, applicationInfo)
+		policies, err := a.mapAvpPolicyToHexa(avpPolicy, client, applicationInfo, templateMap)
 		if err != nil {
 			return nil, err
 		}
 		hexaPols = append(hexaPols, policies...)
 	}
-	// Now to map the policies
+	hexaPols = append(hexaPols, templates...)
 	return hexaPols, nil
 }
 
 func (a AmazonAvpProvider) Reconcile(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, compareHexaPolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+	return a.ReconcileContext(context.Background(), info, applicationInfo, compareHexaPolicies, diffsOnly)
+}
+
+func (a AmazonAvpProvider) ReconcileContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, compareHexaPolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
 
 	// Get all existing policies to compare:
-	avpExistingPolicies, err := a.GetPolicyInfo(info, applicationInfo)
+	avpExistingPolicies, err := a.GetPolicyInfoContext(ctx, info, applicationInfo)
 	if err != nil {
 		return []hexapolicy.PolicyDif{}, err
 	}
+	return a.reconcile(avpExistingPolicies, compareHexaPolicies, diffsOnly), nil
+}
 
+// reconcile returns the differences between the existing AVP policies and compareHexaPolicies
+func (a AmazonAvpProvider) reconcile(avpExistingPolicies []hexapolicy.PolicyInfo, compareHexaPolicies []hexapolicy.PolicyInfo, diffsOnly bool) []hexapolicy.PolicyDif {
 	var res = make([]hexapolicy.PolicyDif, 0)
 
 	var avpMap = make(map[string]hexapolicy.PolicyInfo, len(avpExistingPolicies))
@@ -205,61 +319,78 @@ func (a AmazonAvpProvider) Reconcile(info policyprovider.IntegrationInfo, applic
 		meta := comparePolicy.Meta
 		switch meta.ProviderType {
 		case ProviderTypeAvp:
+			if meta.PolicyId == nil {
+				break
+			}
 			policyId := *meta.PolicyId
 			sourcePolicy, exists := avpMap[policyId]
-			if isTemplate(comparePolicy) {
-				dif := hexapolicy.PolicyDif{
-					Type:          hexapolicy.ChangeTypeIgnore,
+			if !exists {
+				break
+			}
+			delete(avpMap, policyId) // Remove to indicate existing policy handled
+
+			policyType := avpPolicyType(comparePolicy)
+			if policyType != avpPolicyType(sourcePolicy) {
+				// AVP cannot convert between static policies, templates, and template-linked policies. Replace instead.
+				res = append(res, hexapolicy.PolicyDif{
+					Type:          hexapolicy.ChangeTypeDelete,
 					DifTypes:      nil,
 					PolicyExist:   []hexapolicy.PolicyInfo{sourcePolicy},
-					PolicyCompare: &comparePolicy,
-				}
-				res = append(res, dif)
-
-				delete(avpMap, *meta.PolicyId) // Remove to indicate existing policy handled
-				fmt.Printf("Ignoring AVP policyid %s. Template updates not currently supported\n",
-					*meta.PolicyId)
-				continue
+					PolicyCompare: nil,
+				})
+				break
 			}
 
-			if exists {
-				differenceTypes := comparePolicy.Compare(sourcePolicy)
-				if slices.Contains(differenceTypes, hexapolicy.CompareEqual) {
-					if !diffsOnly {
-						// policy matches
-						dif := hexapolicy.PolicyDif{
-							Type:          hexapolicy.ChangeTypeEqual,
-							DifTypes:      nil,
-							PolicyExist:   []hexapolicy.PolicyInfo{sourcePolicy},
-							PolicyCompare: &comparePolicy,
-						}
-						res = append(res, dif)
+			differenceTypes := comparePolicy.Compare(sourcePolicy)
+			if policyType == string(types.PolicyTypeTemplateLinked) && linkedTemplateId(comparePolicy) != linkedTemplateId(sourcePolicy) {
+				differenceTypes = slices.DeleteFunc(differenceTypes, func(difType string) bool {
+					return difType == hexapolicy.CompareEqual
+				})
+				differenceTypes = append(differenceTypes, CompareDifTemplate)
+			}
+			if slices.Contains(differenceTypes, hexapolicy.CompareEqual) {
+				if !diffsOnly {
+					// policy matches
+					dif := hexapolicy.PolicyDif{
+						Type:          hexapolicy.ChangeTypeEqual,
+						DifTypes:      nil,
+						PolicyExist:   []hexapolicy.PolicyInfo{sourcePolicy},
+						PolicyCompare: &comparePolicy,
 					}
-					delete(avpMap, policyId) // Remove to indicate existing policy handled
-					continue                 // nothing to do
+					res = append(res, dif)
 				}
-				// This is a modify request
-				newPolicy := comparePolicy
+				continue // nothing to do
+			}
+
+			if policyType == string(types.PolicyTypeTemplateLinked) && !isLinkChange(differenceTypes) {
+				// Actions and conditions of a template-linked policy come from its template
 				dif := hexapolicy.PolicyDif{
-					Type:          hexapolicy.ChangeTypeUpdate,
+					Type:          hexapolicy.ChangeTypeIgnore,
 					DifTypes:      differenceTypes,
 					PolicyExist:   []hexapolicy.PolicyInfo{sourcePolicy},
-					PolicyCompare: &newPolicy,
+					PolicyCompare: &comparePolicy,
 				}
 				res = append(res, dif)
-				delete(avpMap, policyId) // Remove to indicate existing policy handled
+				fmt.Printf("Ignoring AVP policyid %s. Template-linked policy actions and conditions are updated through template %s\n",
+					policyId, linkedTemplateId(sourcePolicy))
 				continue
 			}
+
+			// This is a modify request
+			newPolicy := comparePolicy
+			dif := hexapolicy.PolicyDif{
+				Type:          hexapolicy.ChangeTypeUpdate,
+				DifTypes:      differenceTypes,
+				PolicyExist:   []hexapolicy.PolicyInfo{sourcePolicy},
+				PolicyCompare: &newPolicy,
+			}
+			res = append(res, dif)
+			continue
 		default:
 			// Fall through to create - likely a policy from another source
 		}
 
 		// At this point no match was found. So assume new
-
-		if isTemplate(comparePolicy) {
-			fmt.Printf("AVP template policy ignored (Etag: %s)\n", comparePolicy.CalculateEtag())
-			continue
-		}
 		newPolicy := comparePolicy
 		dif := hexapolicy.PolicyDif{
 			Type:          hexapolicy.ChangeTypeNew,
@@ -284,106 +415,214 @@ func (a AmazonAvpProvider) Reconcile(info policyprovider.IntegrationInfo, applic
 			res = append(res, dif)
 		}
 	}
-	return res, nil
+	return res
 }
 
+/*
+SetPolicyInfo reconciles hexaPolicies with the policy store and applies the differences (see ApplyPolicies). If a change
+fails, the changes already made are rolled back unless DisableRollback is set. http.StatusBadRequest is returned when a
+policy cannot be represented in AVP (see ErrInvalidPolicy) and http.StatusInternalServerError when AVP requests fail.
+*/
 func (a AmazonAvpProvider) SetPolicyInfo(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, hexaPolicies []hexapolicy.PolicyInfo) (int, error) {
-	client, err := a.getAvpClient(info)
+	return a.SetPolicyInfoContext(context.Background(), info, applicationInfo, hexaPolicies)
+}
+
+func (a AmazonAvpProvider) SetPolicyInfoContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, hexaPolicies []hexapolicy.PolicyInfo) (int, error) {
+	_, err := a.ApplyPoliciesContext(ctx, info, applicationInfo, hexaPolicies)
+	switch {
+	case err == nil:
+		return http.StatusOK, nil
+	case errors.Is(err, ErrInvalidPolicy):
+		return http.StatusBadRequest, err
+	}
+	return http.StatusInternalServerError, err
+}
+
+/*
+ApplyPolicies reconciles hexaPolicies with the policy store and applies the differences as a journal of AVP mutations
+(creates, updates, and deletes). Each policy is mapped to Cedar before any change is made. When a mutation fails, the
+mutations already made are compensated in reverse order (created policies are deleted and deleted policies are
+recreated) unless DisableRollback is set, in which case the apply may be completed later with ResumeApply.
+
+The journal is returned with the outcome of each step (see ApplyJournal.Outcomes), and is saved to JournalPath after each
+step when set. A nil journal is returned if the changes could not be determined.
+*/
+func (a AmazonAvpProvider) ApplyPolicies(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, hexaPolicies []hexapolicy.PolicyInfo) (*ApplyJournal, error) {
+	return a.ApplyPoliciesContext(context.Background(), info, applicationInfo, hexaPolicies)
+}
+
+/*
+ApplyPoliciesContext is ApplyPolicies where the AVP requests are made with ctx. If ctx is cancelled while the changes are
+applied, the changes already made are still rolled back (unless DisableRollback is set).
+*/
+func (a AmazonAvpProvider) ApplyPoliciesContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, hexaPolicies []hexapolicy.PolicyInfo) (*ApplyJournal, error) {
+	client, err := a.getAvpClient(ctx, info)
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return nil, err
 	}
 
-	differences, err := a.Reconcile(info, applicationInfo, hexaPolicies, true)
+	existingPolicies, err := a.GetPolicyInfoContext(ctx, info, applicationInfo)
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return nil, err
 	}
-	for _, dif := range differences {
-		switch dif.Type {
+	differences := a.reconcile(existingPolicies, hexaPolicies, true)
 
-		case hexapolicy.ChangeTypeNew:
-			hexaPolicy := *dif.PolicyCompare
-			if isTemplate(hexaPolicy) {
-				fmt.Printf("AVP template policy creation not currently supported (Etag: %s)\n", hexaPolicy.CalculateEtag())
-				continue
-			}
-			createInput, err := a.prepareCreatePolicy(hexaPolicy, applicationInfo)
-			if err != nil {
-				return http.StatusBadRequest, err
-			}
-			output, err := client.CreatePolicy(createInput)
-			if err != nil {
-				return http.StatusBadRequest, err
-			}
-			policyId := output.PolicyId
-			fmt.Printf("AVP PolicyId %s created (hexa etag: %s)\n", *policyId, hexaPolicy.Meta.Etag)
-
-		case hexapolicy.ChangeTypeDelete:
-			for _, existPolicy := range dif.PolicyExist {
-				source := existPolicy.Meta
-				deleteInput := a.prepareDelete(source)
-				_, err = client.DeletePolicy(deleteInput)
-				if err != nil {
-					return http.StatusBadRequest, err
-				}
-				fmt.Printf("AVP PolicyId %s deleted\n", *source.PolicyId)
-			}
+	journal := &ApplyJournal{
+		PolicyStoreId: applicationInfo.ObjectID,
+		Started:       time.Now(),
+		Steps:         planSteps(differences, existingPolicies),
+		path:          a.JournalPath,
+	}
+	journal.checkpoint()
+	if err = a.validateSteps(journal.Steps); err != nil {
+		return journal, err
+	}
+	return journal, a.runJournal(ctx, info, client, applicationInfo, journal)
+}
 
-		case hexapolicy.ChangeTypeUpdate:
-			hexaPolicy := *dif.PolicyCompare
-			source := hexaPolicy.Meta
-			metaType := source.ProviderType
-			switch metaType {
-			case ProviderTypeAvp:
-				policyId := *source.PolicyId
-
-				if slices.Contains(dif.DifTypes, hexapolicy.CompareDifSubject) || slices.Contains(dif.DifTypes, hexapolicy.CompareDifObject) {
-					// will delete and replace
-					deleteInput := a.prepareDelete(source)
-					_, err = client.DeletePolicy(deleteInput)
-					if err != nil {
-						return http.StatusBadRequest, err
-					}
-					createInput, err := a.prepareCreatePolicy(hexaPolicy, applicationInfo)
-					if err != nil {
-						return http.StatusBadRequest, err
-					}
-					output, err := client.CreatePolicy(createInput)
-					if err != nil {
-						return http.StatusBadRequest, err
-					}
-					newPolicyId := output.PolicyId
-					fmt.Printf("AVP PolicyId %s replaced as %s (hexa etag: %s)\n", policyId, *newPolicyId, hexaPolicy.Meta.Etag)
-
-				} else if slices.Contains(dif.DifTypes, hexapolicy.CompareDifAction) || slices.Contains(dif.DifTypes, hexapolicy.CompareDifCondition) {
-					// Do Update (if subject or object changed, the update would already be done)
-					update, err := a.preparePolicyUpdate(hexaPolicy, source)
-					if err != nil {
-						return http.StatusBadRequest, err
-					}
-					_, err = client.UpdatePolicy(update)
-					if err != nil {
-						return http.StatusBadRequest, err
-					}
-					fmt.Printf("AVP PolicyId %s updated\n", policyId)
-					continue
-				}
+/*
+ResumeApply applies the steps of a journal that were not applied by a previous ApplyPolicies or ResumeApply. Each step is
+first verified against the policy store: steps found to be already applied are not replayed, and an error is returned
+without any change when a policy to be deleted or updated has changed since the journal was saved.
+*/
+func (a AmazonAvpProvider) ResumeApply(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, journal *ApplyJournal) (*ApplyJournal, error) {
+	return a.ResumeApplyContext(context.Background(), info, applicationInfo, journal)
+}
 
-			default:
-				// Fall through to create - likely a policy from another source
-			}
-		case hexapolicy.ChangeTypeIgnore, hexapolicy.ChangeTypeEqual:
-			// do nothing
+// ResumeApplyContext is ResumeApply where the AVP requests are made with ctx (see ApplyPoliciesContext)
+func (a AmazonAvpProvider) ResumeApplyContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, journal *ApplyJournal) (*ApplyJournal, error) {
+	if journal.PolicyStoreId != applicationInfo.ObjectID {
+		return journal, fmt.Errorf("AVP apply journal is for policy store %s, not %s", journal.PolicyStoreId, applicationInfo.ObjectID)
+	}
+	if journal.RolledBack() {
+		return journal, errors.New("AVP apply journal was rolled back and cannot be resumed")
+	}
+	client, err := a.getAvpClient(ctx, info)
+	if err != nil {
+		return journal, err
+	}
+	if a.JournalPath != "" {
+		journal.path = a.JournalPath
+	}
+	existingPolicies, err := a.GetPolicyInfoContext(ctx, info, applicationInfo)
+	if err != nil {
+		return journal, err
+	}
+	if err = journal.verifySteps(existingPolicies); err != nil {
+		return journal, err
+	}
+	return journal, a.runJournal(ctx, info, client, applicationInfo, journal)
+}
+
+func (a AmazonAvpProvider) runJournal(ctx context.Context, info policyprovider.IntegrationInfo, client avpClient.AvpClient, applicationInfo policyprovider.ApplicationInfo, journal *ApplyJournal) error {
+	err := a.runSteps(client, applicationInfo, journal)
+	if err == nil {
+		return nil
+	}
+	failed := journal.failure()
+	err = fmt.Errorf("AVP %s of policy %s failed: %w", failed.Operation, failed.PolicyKey, err)
+	if a.DisableRollback {
+		return err
+	}
+	// the rollback is not cancelled with ctx, so that a cancelled apply does not leave the policy store partly changed
+	rollbackClient, clientErr := a.getAvpClient(context.WithoutCancel(ctx), info)
+	if clientErr != nil {
+		return errors.Join(err, clientErr)
+	}
+	if compensateErr := a.compensate(rollbackClient, applicationInfo, journal); compensateErr != nil {
+		return errors.Join(err, compensateErr)
+	}
+	return fmt.Errorf("%w (changes rolled back)", err)
+}
+
+/*
+MapPolicyReport reports how hexaPolicies are represented as AVP Cedar policies (see policyprovider.MappingReporter). The
+actions and condition of template-linked policies are reported as approximated because they are taken from the template.
+*/
+func (a AmazonAvpProvider) MapPolicyReport(_ policyprovider.IntegrationInfo, _ policyprovider.ApplicationInfo, hexaPolicies []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+	_, report := a.cedarMapper().MapHexaPoliciesReport("", hexaPolicies)
+	report.Target = a.Name()
+	for i, hexaPolicy := range hexaPolicies {
+		if avpPolicyType(hexaPolicy) != string(types.PolicyTypeTemplateLinked) {
+			continue
+		}
+		if len(hexaPolicy.Actions) > 0 {
+			report.Approximated(i, hexaPolicy, hexapolicy.CompareDifAction, fmt.Sprintf("actions of a template-linked policy are taken from template %s", linkedTemplateId(hexaPolicy)))
+		}
+		if hexaPolicy.Condition != nil {
+			report.Approximated(i, hexaPolicy, hexapolicy.CompareDifCondition, fmt.Sprintf("the condition of a template-linked policy is taken from template %s", linkedTemplateId(hexaPolicy)))
 		}
 	}
+	return report, nil
+}
+
+// createPolicy creates a static policy, policy template, or template-linked policy and returns the new AVP id
+func (a AmazonAvpProvider) createPolicy(client avpClient.AvpClient, hexaPolicy hexapolicy.PolicyInfo, app policyprovider.ApplicationInfo) (*string, error) {
+	switch avpPolicyType(hexaPolicy) {
+	case PolicyTypeTemplate:
+		createInput, err := a.prepareCreateTemplate(hexaPolicy, app)
+		if err != nil {
+			return nil, err
+		}
+		output, err := client.CreatePolicyTemplate(createInput)
+		if err != nil {
+			return nil, err
+		}
+		return output.PolicyTemplateId, nil
+
+	case string(types.PolicyTypeTemplateLinked):
+		createInput, err := a.prepareCreateLinkedPolicy(client, hexaPolicy, app)
+		if err != nil {
+			return nil, err
+		}
+		output, err := client.CreatePolicy(createInput)
+		if err != nil {
+			return nil, err
+		}
+		return output.PolicyId, nil
+	}
+
+	createInput, err := a.prepareCreatePolicy(hexaPolicy, app)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.CreatePolicy(createInput)
+	if err != nil {
+		return nil, err
+	}
+	return output.PolicyId, nil
+}
 
-	return http.StatusOK, nil
+func (a AmazonAvpProvider) deletePolicy(client avpClient.AvpClient, hexaPolicy hexapolicy.PolicyInfo) error {
+	avpMeta := hexaPolicy.Meta
+	if avpPolicyType(hexaPolicy) == PolicyTypeTemplate {
+		_, err := client.DeletePolicyTemplate(&verifiedpermissions.DeletePolicyTemplateInput{
+			PolicyStoreId:    avpMeta.PapId,
+			PolicyTemplateId: avpMeta.PolicyId,
+		})
+		return err
+	}
+	_, err := client.DeletePolicy(a.prepareDelete(avpMeta))
+	return err
 }
 
 func (a AmazonAvpProvider) convertCedarStatement(hexaPolicy hexapolicy.PolicyInfo) (*string, error) {
-	cedarPolicies, err := a.CedarMapper.MapHexaPolicies("", []hexapolicy.PolicyInfo{hexaPolicy})
-	cedarPolicies = strings.Replace(cedarPolicies, "Template::\"principal\"", "?principal", -1)
-	cedarPolicies = strings.Replace(cedarPolicies, "Template::\"resource\"", "?resource", -1)
-	return &cedarPolicies, err
+	if hexaPolicy.Meta.ProviderType == ProviderTypeAvp {
+		// The AVP policy id is not the Cedar @id annotation
+		hexaPolicy.Meta.PolicyId = nil
+	}
+	cedarPolicies, err := a.cedarMapper().MapHexaPolicies("", []hexapolicy.PolicyInfo{hexaPolicy})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+	return &cedarPolicies, nil
+}
+
+func policyDescription(hexaPolicy hexapolicy.PolicyInfo) string {
+	if hexaPolicy.Meta.Description != "" {
+		return hexaPolicy.Meta.Description
+	}
+	return fmt.Sprintf("Mapped from IDQL (etag: %s)", hexaPolicy.CalculateEtag())
 }
 
 func (a AmazonAvpProvider) prepareCreatePolicy(hexaPolicy hexapolicy.PolicyInfo, app policyprovider.ApplicationInfo) (*verifiedpermissions.CreatePolicyInput, error) {
@@ -391,10 +630,7 @@ func (a AmazonAvpProvider) prepareCreatePolicy(hexaPolicy hexapolicy.PolicyInfo,
 	if err != nil {
 		return nil, err
 	}
-	description := fmt.Sprintf("Mapped from IDQL (etag: %s)", hexaPolicy.CalculateEtag())
-	if hexaPolicy.Meta.Description != "" {
-		description = hexaPolicy.Meta.Description
-	}
+	description := policyDescription(hexaPolicy)
 	createPolicyDefinition := types.StaticPolicyDefinition{
 		Statement:   cedarStatement,
 		Description: &description,
@@ -409,6 +645,57 @@ func (a AmazonAvpProvider) prepareCreatePolicy(hexaPolicy hexapolicy.PolicyInfo,
 	return &createPolicyInput, nil
 }
 
+func (a AmazonAvpProvider) prepareCreateTemplate(hexaPolicy hexapolicy.PolicyInfo, app policyprovider.ApplicationInfo) (*verifiedpermissions.CreatePolicyTemplateInput, error) {
+	cedarStatement, err := a.convertCedarStatement(hexaPolicy)
+	if err != nil {
+		return nil, err
+	}
+	description := policyDescription(hexaPolicy)
+	return &verifiedpermissions.CreatePolicyTemplateInput{
+		PolicyStoreId: &app.ObjectID,
+		Statement:     cedarStatement,
+		Description:   &description,
+	}, nil
+}
+
+// prepareCreateLinkedPolicy binds the template slots to the IDQL subject and object. The template is retrieved to
+// determine which slots it contains.
+func (a AmazonAvpProvider) prepareCreateLinkedPolicy(client avpClient.AvpClient, hexaPolicy hexapolicy.PolicyInfo, app policyprovider.ApplicationInfo) (*verifiedpermissions.CreatePolicyInput, error) {
+	templateId := linkedTemplateId(hexaPolicy)
+	if templateId == "" {
+		return nil, fmt.Errorf("%w: template-linked policy is missing meta sourceData %s", ErrInvalidPolicy, ParamTemplateId)
+	}
+	template, err := client.GetTemplatePolicy(templateId, app)
+	if err != nil {
+		return nil, err
+	}
+
+	linkDefinition := types.TemplateLinkedPolicyDefinition{
+		PolicyTemplateId: &templateId,
+	}
+	slots := cedar.TemplateSlots(aws.ToString(template.Statement))
+	if slices.Contains(slots, cedar.SlotPrincipal) {
+		if len(hexaPolicy.Subjects) != 1 {
+			return nil, fmt.Errorf("%w: template-linked policy for %s must have exactly one subject", ErrInvalidPolicy, templateId)
+		}
+		linkDefinition.Principal, err = entityIdentifier(hexaPolicy.Subjects[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if slices.Contains(slots, cedar.SlotResource) {
+		linkDefinition.Resource, err = entityIdentifier(hexaPolicy.Object.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &verifiedpermissions.CreatePolicyInput{
+		Definition:    &types.PolicyDefinitionMemberTemplateLinked{Value: linkDefinition},
+		PolicyStoreId: &app.ObjectID,
+	}, nil
+}
+
 func (a AmazonAvpProvider) preparePolicyUpdate(hexaPolicy hexapolicy.PolicyInfo, meta hexapolicy.MetaInfo) (*verifiedpermissions.UpdatePolicyInput, error) {
 	cedarStatement, err := a.convertCedarStatement(hexaPolicy)
 	if err != nil {
@@ -429,11 +716,20 @@ func (a AmazonAvpProvider) preparePolicyUpdate(hexaPolicy hexapolicy.PolicyInfo,
 	return &update, nil
 }
 
-func (a AmazonAvpProvider) prepareDelete(avpMeta hexapolicy.MetaInfo) *verifiedpermissions.DeletePolicyInput {
-	policyType := avpMeta.SourceData[ParamPolicyType]
-	if policyType == string(types.PolicyTypeTemplateLinked) {
-		return nil // template deletions not currently supported
+func (a AmazonAvpProvider) prepareTemplateUpdate(hexaPolicy hexapolicy.PolicyInfo, meta hexapolicy.MetaInfo) (*verifiedpermissions.UpdatePolicyTemplateInput, error) {
+	cedarStatement, err := a.convertCedarStatement(hexaPolicy)
+	if err != nil {
+		return nil, err
 	}
+	return &verifiedpermissions.UpdatePolicyTemplateInput{
+		Statement:        cedarStatement,
+		Description:      &hexaPolicy.Meta.Description,
+		PolicyTemplateId: meta.PolicyId,
+		PolicyStoreId:    meta.PapId,
+	}, nil
+}
+
+func (a AmazonAvpProvider) prepareDelete(avpMeta hexapolicy.MetaInfo) *verifiedpermissions.DeletePolicyInput {
 	deletePolicyInput := verifiedpermissions.DeletePolicyInput{
 		PolicyId:      avpMeta.PolicyId,
 		PolicyStoreId: avpMeta.PapId,
@@ -441,36 +737,155 @@ func (a AmazonAvpProvider) prepareDelete(avpMeta hexapolicy.MetaInfo) *verifiedp
 	return &deletePolicyInput
 }
 
-func isTemplate(hexaPolicy hexapolicy.PolicyInfo) bool {
-	if hexaPolicy.Meta.SourceData == nil {
-		// in the case where a policy is new, but contains template we need to test for ?resource and ?principle
-		if slices.Contains(hexaPolicy.Subjects.String(), "?principal") {
-			return true
-		}
-		if strings.Contains(hexaPolicy.Object.String(), "?resource") {
-			return true
-		}
+// avpPolicyType returns the AVP policy type from the IDQL meta. When no type is recorded (e.g. a policy from another
+// source), a policy containing template slots is a template and otherwise a static policy.
+func avpPolicyType(hexaPolicy hexapolicy.PolicyInfo) string {
+	if policyType, ok := hexaPolicy.Meta.SourceData[ParamPolicyType].(string); ok {
+		return policyType
+	}
+	if cedar.IsTemplate(hexaPolicy) {
+		return PolicyTypeTemplate
+	}
+	return string(types.PolicyTypeStatic)
+}
+
+func linkedTemplateId(hexaPolicy hexapolicy.PolicyInfo) string {
+	templateId, _ := hexaPolicy.Meta.SourceData[ParamTemplateId].(string)
+	return templateId
+}
+
+// isLinkChange returns true if the differences change the template or slot values of a template-linked policy
+func isLinkChange(difTypes []string) bool {
+	return slices.ContainsFunc(difTypes, func(difType string) bool {
+		return difType == hexapolicy.CompareDifSubject || difType == hexapolicy.CompareDifObject || difType == CompareDifTemplate
+	})
+}
 
-		return false
+// applyOrder orders changes so that templates are created or updated first and deleted last
+func applyOrder(dif hexapolicy.PolicyDif) int {
+	policy := dif.PolicyCompare
+	if policy == nil && len(dif.PolicyExist) > 0 {
+		policy = &dif.PolicyExist[0]
+	}
+	if policy == nil || avpPolicyType(*policy) != PolicyTypeTemplate {
+		return 1
 	}
-	policyType, exists := hexaPolicy.Meta.SourceData[ParamPolicyType]
-	return exists && policyType == string(types.PolicyTypeTemplateLinked)
+	if dif.Type == hexapolicy.ChangeTypeDelete {
+		return 2
+	}
+	return 0
 }
 
+// entityValue returns the IDQL value for an AVP entity identifier or "" if not set
+func entityValue(identifier *types.EntityIdentifier) string {
+	if identifier == nil || identifier.EntityType == nil || identifier.EntityId == nil {
+		return ""
+	}
+	return cedar.EntityValue(*identifier.EntityType, *identifier.EntityId)
+}
+
+// entityIdentifier returns the AVP entity identifier for an IDQL subject or object bound to a template slot, e.g.
+// `hexa_avp:User:"alice"` or `[hexa_avp:Group:"admins"]`
+func entityIdentifier(value string) (*types.EntityIdentifier, error) {
+	entity := hexaTypes.ParseEntity(value)
+	if (entity.Type == hexaTypes.RelTypeIn || entity.Type == hexaTypes.RelTypeIsIn) && len(*entity.In) == 1 {
+		entity = &(*entity.In)[0]
+	}
+	if entity.Type != hexaTypes.RelTypeEquals || len(entity.Types) == 0 {
+		return nil, fmt.Errorf("%w: unable to link template slot to value %s, expecting an entity", ErrInvalidPolicy, value)
+	}
+	return &types.EntityIdentifier{
+		EntityType: aws.String(strings.Join(entity.Types, "::")),
+		EntityId:   aws.String(entity.GetId()),
+	}, nil
+}
+
+/*
+GetSchema returns the Cedar schema of the policy store as a policy information model. A store without a schema returns
+empty namespaces.
+*/
 func (a AmazonAvpProvider) GetSchema(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo) (*policyInfoModel.Namespaces, error) {
-	client, err := a.getAvpClient(info)
+	return a.GetSchemaContext(context.Background(), info, applicationInfo)
+}
+
+// GetSchemaContext is GetSchema where the AVP request is made with ctx
+func (a AmazonAvpProvider) GetSchemaContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo) (*policyInfoModel.Namespaces, error) {
+	client, err := a.getAvpClient(ctx, info)
 	if err != nil {
 		return nil, err
 	}
 
 	schemaResponse, err := client.GetSchema(applicationInfo)
 	if err != nil {
+		if isNotFound(err) {
+			return &policyInfoModel.Namespaces{}, nil
+		}
 		return nil, err
 	}
-	namespaceNames := schemaResponse.Namespaces
-	fmt.Println(fmt.Sprintf("Found namespaces: %v", namespaceNames))
-	cedarSchemaString := schemaResponse.Schema
+	if schemaResponse.Schema == nil {
+		return &policyInfoModel.Namespaces{}, nil
+	}
+	return policyInfoModel.ParseCedarJsonSchema([]byte(*schemaResponse.Schema))
+}
+
+// SetSchema replaces the Cedar schema of the policy store with namespaces (in Cedar JSON schema format)
+func (a AmazonAvpProvider) SetSchema(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, namespaces policyInfoModel.Namespaces) error {
+	return a.SetSchemaContext(context.Background(), info, applicationInfo, namespaces)
+}
+
+// SetSchemaContext is SetSchema where the AVP request is made with ctx
+func (a AmazonAvpProvider) SetSchemaContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, namespaces policyInfoModel.Namespaces) error {
+	if len(namespaces) == 0 {
+		return errors.New("the schema of an AVP policy store requires at least one namespace")
+	}
+	client, err := a.getAvpClient(ctx, info)
+	if err != nil {
+		return err
+	}
 
-	return policyInfoModel.ParseSchemaFile([]byte(*cedarSchemaString))
+	schemaBytes, err := json.Marshal(namespaces)
+	if err != nil {
+		return err
+	}
+	_, err = client.PutSchema(applicationInfo, &types.SchemaDefinitionMemberCedarJson{Value: string(schemaBytes)})
+	return err
+}
+
+/*
+CreateApplication creates a new AVP policy store with the description. The SettingValidationMode setting (STRICT or OFF)
+determines whether policies are validated against the store's schema and defaults to STRICT.
+*/
+func (a AmazonAvpProvider) CreateApplication(info policyprovider.IntegrationInfo, description string, settings map[string]string) (policyprovider.ApplicationInfo, error) {
+	return a.CreateApplicationContext(context.Background(), info, description, settings)
+}
+
+// CreateApplicationContext is CreateApplication where the AVP request is made with ctx
+func (a AmazonAvpProvider) CreateApplicationContext(ctx context.Context, info policyprovider.IntegrationInfo, description string, settings map[string]string) (policyprovider.ApplicationInfo, error) {
+	mode := types.ValidationModeStrict
+	if value, ok := settings[SettingValidationMode]; ok && value != "" {
+		mode = types.ValidationMode(strings.ToUpper(value))
+		if !slices.Contains(mode.Values(), mode) {
+			return policyprovider.ApplicationInfo{}, fmt.Errorf("invalid AVP validation mode %s (expecting %v)", value, mode.Values())
+		}
+	}
+	for key := range settings {
+		if key != SettingValidationMode {
+			return policyprovider.ApplicationInfo{}, fmt.Errorf("unsupported AVP policy store setting %s", key)
+		}
+	}
 
+	client, err := a.getAvpClient(ctx, info)
+	if err != nil {
+		return policyprovider.ApplicationInfo{}, err
+	}
+	output, err := client.CreatePolicyStore(description, mode)
+	if err != nil {
+		return policyprovider.ApplicationInfo{}, err
+	}
+	return policyprovider.ApplicationInfo{
+		ObjectID:    aws.ToString(output.PolicyStoreId),
+		Name:        aws.ToString(output.Arn),
+		Description: description,
+		Service:     "VerifiedPermissions",
+	}, nil
 }
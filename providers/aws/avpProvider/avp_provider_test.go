@@ -7,6 +7,7 @@ import (
     "net/http"
     "os"
     "slices"
+    "strings"
     "testing"
     "time"
 
@@ -15,6 +16,7 @@ import (
     "github.com/aws/aws-sdk-go-v2/service/verifiedpermissions/types"
     "github.com/hexa-org/policy-mapper/api/policyprovider"
     "github.com/hexa-org/policy-mapper/models/formats/cedar"
+    "github.com/hexa-org/policy-mapper/models/policyInfoModel"
     "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
     "github.com/hexa-org/policy-mapper/providers/aws/avpProvider"
     "github.com/hexa-org/policy-mapper/providers/aws/avpProvider/avpClient"
@@ -196,12 +198,71 @@ func TestAvp_2_GetPolicies(t *testing.T) {
 
     mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
-    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     policies, err := p.GetPolicyInfo(info, apps[0])
     assert.NoError(t, err)
     assert.NotNil(t, policies)
-    assert.Len(t, policies, 2, "Should be 2 policies")
+    assert.Len(t, policies, 3, "Should be 3 policies")
     assert.True(t, mockClient.VerifyCalled())
+
+    linked := policies[1]
+    assert.Equal(t, "TEMPLATE_LINKED", linked.Meta.SourceData[avpProvider.ParamPolicyType])
+    assert.Equal(t, avpTestSupport.TestCedarTemplateId, linked.Meta.SourceData[avpProvider.ParamTemplateId])
+    assert.Equal(t, avpTestSupport.TestCedarTemplatePolicyId+"0", *linked.Meta.PolicyId)
+    assert.Equal(t, hexapolicy.SubjectInfo{"hexa_avp:User:\"joe@example.com\""}, linked.Subjects)
+    assert.Equal(t, "hexa_avp:account:\"1\"", linked.Object.String())
+
+    template := policies[2]
+    assert.Equal(t, avpProvider.PolicyTypeTemplate, template.Meta.SourceData[avpProvider.ParamPolicyType])
+    assert.Equal(t, avpTestSupport.TestCedarTemplateId, *template.Meta.PolicyId)
+    assert.Equal(t, hexapolicy.SubjectInfo{"?principal"}, template.Subjects)
+    assert.Equal(t, "?resource", template.Object.String())
+    assert.Equal(t, linked.Actions, template.Actions)
+}
+
+func TestAvp_2a_GetPoliciesAnnotations(t *testing.T) {
+    mockClient := avpTestSupport.NewMockVerifiedPermissionsHTTPClient()
+    p := avpProvider.AmazonAvpProvider{
+        AwsClientOpts: awscommon.AWSClientOptions{
+            HTTPClient:   mockClient,
+            DisableRetry: true,
+        },
+        CedarMapper: cedar.NewCedarMapper(map[string]string{})}
+
+    staticPolicy := avpTestSupport.TestCedarStaticPolicy
+    t.Cleanup(func() { avpTestSupport.TestCedarStaticPolicy = staticPolicy })
+    avpTestSupport.TestCedarStaticPolicy = "@id(\"readers\")\n@owner(\"finance\")" + staticPolicy
+
+    mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
+    mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    policies, err := p.GetPolicyInfo(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo())
+    assert.NoError(t, err)
+    assert.True(t, mockClient.VerifyCalled())
+
+    // The AVP id and description are kept along with the Cedar annotations
+    static := policies[0]
+    assert.Equal(t, avpTestSupport.TestCedarStaticPolicyId+"0", *static.Meta.PolicyId)
+    assert.Equal(t, avpTestSupport.TestCedarStaticPolicyDescription, static.Meta.Description)
+    assert.Equal(t, string(types.PolicyTypeStatic), static.Meta.SourceData[avpProvider.ParamPolicyType])
+    assert.Equal(t, map[string]string{"id": "readers", "owner": "finance"}, cedar.GetAnnotations(static.Meta))
+
+    // An update writes the annotations back unchanged
+    policies[0].Actions = append(policies[0].Actions, "hexa_avp:Action:\"UpdateAccount\"")
+    mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
+    mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockUpdatePolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
+    status, err := p.SetPolicyInfo(avpTestSupport.IntegrationInfo(), avpTestSupport.AppInfo(), policies)
+    assert.NoError(t, err)
+    assert.Equal(t, http.StatusOK, status)
+    assert.True(t, mockClient.VerifyCalled())
+    update := string(mockClient.GetRequestBodyByIndex(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.UpdatePolicy", 0))
+    assert.Contains(t, update, `@id(\"readers\")`)
+    assert.Contains(t, update, `@owner(\"finance\")`)
 }
 
 func TestAvp_3_Reconcile(t *testing.T) {
@@ -231,7 +292,8 @@ func TestAvp_3_Reconcile(t *testing.T) {
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"7")
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"8")
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"9")
-    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     policies, err := p.GetPolicyInfo(info, apps[0])
     assert.True(t, mockClient.VerifyCalled())
 
@@ -250,12 +312,19 @@ func TestAvp_3_Reconcile(t *testing.T) {
     assert.True(t, exist, "Check policy type exists")
     assert.Equal(t, "TEMPLATE_LINKED", avpType, "Second [1] policy should be template")
 
+    // a template-linked policy inherits its actions from the template, so this is ignored
+    policies[1].Actions = []hexapolicy.ActionInfo{"hexa_avp:Action:\"Transfer\""}
+
     // this should cause a replacement (delete and add) to occur (subject change)
     policies[2].Subjects = []string{"hexa_avp::User::\"gerry@strata.io\""}
 
     // this should cause an implied delete by removing policy 5
     policies = append(policies[0:5], policies[6:]...)
 
+    // the template (last policy) is updated with an additional action
+    template := &policies[len(policies)-1]
+    template.Actions = append(template.Actions, "hexa_avp:Action:\"Transfer\"")
+
     now := time.Now()
     // now append a policy by copying and modifying the first
     newPolicy := policies[0]
@@ -280,18 +349,22 @@ func TestAvp_3_Reconcile(t *testing.T) {
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"7")
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"8")
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"9")
-    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     difs, err := p.Reconcile(info, apps[0], policies, true)
     assert.NoError(t, err)
     assert.True(t, mockClient.VerifyCalled())
-    assert.Len(t, difs, 5)
+    assert.Len(t, difs, 6)
     assert.Equal(t, hexapolicy.ChangeTypeUpdate, difs[0].Type)
     assert.True(t, slices.Equal([]string{"ACTION"}, difs[0].DifTypes))
     assert.Equal(t, hexapolicy.ChangeTypeIgnore, difs[1].Type)
     assert.Equal(t, hexapolicy.ChangeTypeUpdate, difs[2].Type)
     assert.True(t, slices.Equal([]string{"SUBJECT"}, difs[2].DifTypes))
-    assert.Equal(t, hexapolicy.ChangeTypeNew, difs[3].Type)
-    assert.Equal(t, hexapolicy.ChangeTypeDelete, difs[4].Type)
+    assert.Equal(t, hexapolicy.ChangeTypeUpdate, difs[3].Type)
+    assert.True(t, slices.Equal([]string{"ACTION"}, difs[3].DifTypes))
+    assert.Equal(t, avpTestSupport.TestCedarTemplateId, *difs[3].PolicyCompare.Meta.PolicyId)
+    assert.Equal(t, hexapolicy.ChangeTypeNew, difs[4].Type)
+    assert.Equal(t, hexapolicy.ChangeTypeDelete, difs[5].Type)
     for _, dif := range difs {
         fmt.Println(dif.Report())
     }
@@ -316,7 +389,8 @@ func TestAvp_4_SetPolicies(t *testing.T) {
 
     mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
-    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     policies, err := p.GetPolicyInfo(info, apps[0])
     assert.True(t, mockClient.VerifyCalled())
 
@@ -339,7 +413,8 @@ func TestAvp_4_SetPolicies(t *testing.T) {
 
     mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
-    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     mockClient.MockUpdatePolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
     status, err := p.SetPolicyInfo(info, apps[0], policies)
     assert.NoError(t, err)
@@ -350,7 +425,8 @@ func TestAvp_4_SetPolicies(t *testing.T) {
 
     mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
-    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     mockClient.MockDeletePolicyWithHttpStatus(http.StatusOK)
     mockClient.MockCreatePolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
     status, err = p.SetPolicyInfo(info, apps[0], policies)
@@ -362,7 +438,8 @@ func TestAvp_4_SetPolicies(t *testing.T) {
     policies2 := policies[1:]
     mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
     mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
-    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     mockClient.MockDeletePolicyWithHttpStatus(http.StatusOK)
     status, err = p.SetPolicyInfo(info, apps[0], policies2)
     assert.NoError(t, err)
@@ -371,7 +448,8 @@ func TestAvp_4_SetPolicies(t *testing.T) {
 
     // now do an add policy
     mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 0, 1, nil)
-    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     mockClient.MockCreatePolicyWithHttpStatus(http.StatusOK, "id10")
 
     // Note policies has both a static and template. Initial list was mocked with only 1 template - to cause an add
@@ -381,6 +459,133 @@ func TestAvp_4_SetPolicies(t *testing.T) {
     assert.True(t, mockClient.VerifyCalled())
 }
 
+func TestAvp_4a_SetTemplates(t *testing.T) {
+    mockClient := avpTestSupport.NewMockVerifiedPermissionsHTTPClient()
+
+    p := avpProvider.AmazonAvpProvider{
+        AwsClientOpts: awscommon.AWSClientOptions{
+            HTTPClient:   mockClient,
+            DisableRetry: true,
+        },
+        CedarMapper: cedar.NewCedarMapper(map[string]string{})}
+
+    mockClient.MockListStores()
+    info := avpTestSupport.IntegrationInfo()
+    apps, err := p.DiscoverApplications(info)
+    assert.NoError(t, err)
+
+    mockGetPolicies := func() {
+        mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
+        mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
+        mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+        mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    }
+    mockGetPolicies()
+    policies, err := p.GetPolicyInfo(info, apps[0])
+    assert.NoError(t, err)
+    assert.Len(t, policies, 3)
+    assert.True(t, mockClient.VerifyCalled())
+
+    // Re-link the template-linked policy to a different principal
+    policies[1].Subjects = hexapolicy.SubjectInfo{"hexa_avp:User:\"alice@example.com\""}
+    // Add an action to the template
+    policies[2].Actions = append(policies[2].Actions, "hexa_avp:Action:\"Transfer\"")
+    // A new template and a new link to the existing template
+    newTemplate := hexapolicy.PolicyInfo{
+        Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion, Description: "New template"},
+        Subjects: hexapolicy.SubjectInfo{"[?principal]"},
+        Actions:  []hexapolicy.ActionInfo{"hexa_avp:Action:\"Deposit\""},
+        Object:   "?resource",
+    }
+    newLink := hexapolicy.PolicyInfo{
+        Meta: hexapolicy.MetaInfo{
+            Version: hexapolicy.IdqlVersion,
+            SourceData: map[string]interface{}{
+                avpProvider.ParamPolicyType: "TEMPLATE_LINKED",
+                avpProvider.ParamTemplateId: avpTestSupport.TestCedarTemplateId,
+            },
+        },
+        Subjects: hexapolicy.SubjectInfo{"hexa_avp:User:\"bob@example.com\""},
+        Actions:  policies[2].Actions,
+        Object:   "hexa_avp:account:\"2\"",
+    }
+    updates := append(slices.Clone(policies), newTemplate, newLink)
+
+    mockGetPolicies()
+    mockClient.MockUpdatePolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockCreatePolicyTemplateWithHttpStatus(http.StatusOK, "temp2")
+    mockClient.MockDeletePolicyWithHttpStatus(http.StatusOK)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusOK, "id30")
+    mockClient.MockCreatePolicyWithHttpStatus(http.StatusOK, "id31")
+    status, err := p.SetPolicyInfo(info, apps[0], updates)
+    assert.NoError(t, err)
+    assert.Equal(t, http.StatusOK, status)
+    assert.True(t, mockClient.VerifyCalled())
+
+    templateBody := string(mockClient.GetRequestBody(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.CreatePolicyTemplate"))
+    assert.Contains(t, templateBody, "principal in ?principal")
+    assert.Contains(t, templateBody, "resource == ?resource")
+    updateBody := string(mockClient.GetRequestBody(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.UpdatePolicyTemplate"))
+    assert.Contains(t, updateBody, "Transfer")
+    linkBodies := string(mockClient.GetRequestBodyByIndex(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.CreatePolicy", 0)) +
+        string(mockClient.GetRequestBodyByIndex(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.CreatePolicy", 1))
+    assert.Contains(t, linkBodies, `"entityId":"alice@example.com"`)
+    assert.Contains(t, linkBodies, `"entityId":"bob@example.com"`)
+    assert.Contains(t, linkBodies, `"policyTemplateId":"`+avpTestSupport.TestCedarTemplateId+`"`)
+
+    // Removing the template and its link deletes both
+    mockGetPolicies()
+    mockClient.MockDeletePolicyWithHttpStatus(http.StatusOK)
+    mockClient.MockDeletePolicyTemplateWithHttpStatus(http.StatusOK)
+    status, err = p.SetPolicyInfo(info, apps[0], policies[0:1])
+    assert.NoError(t, err)
+    assert.Equal(t, http.StatusOK, status)
+    assert.True(t, mockClient.VerifyCalled())
+
+    // A link must identify its template
+    badLink := newLink
+    badLink.Meta.SourceData = map[string]interface{}{avpProvider.ParamPolicyType: "TEMPLATE_LINKED"}
+    mockGetPolicies()
+    current, err := p.GetPolicyInfo(info, apps[0])
+    assert.NoError(t, err)
+    mockGetPolicies()
+    status, err = p.SetPolicyInfo(info, apps[0], append(current, badLink))
+    assert.ErrorContains(t, err, avpProvider.ParamTemplateId)
+    assert.Equal(t, http.StatusBadRequest, status)
+    assert.True(t, mockClient.VerifyCalled())
+}
+
+func TestAvp_4b_MapPolicyReport(t *testing.T) {
+    p := avpProvider.AmazonAvpProvider{}
+
+    policies := []hexapolicy.PolicyInfo{{
+        Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+        Subjects: hexapolicy.SubjectInfo{"hexa_avp:User:\"alice@example.com\""},
+        Actions:  []hexapolicy.ActionInfo{"hexa_avp:Action:\"Deposit\""},
+        Object:   "hexa_avp:account:\"1\"",
+    }, {
+        Meta: hexapolicy.MetaInfo{
+            Version: hexapolicy.IdqlVersion,
+            SourceData: map[string]interface{}{
+                avpProvider.ParamPolicyType: "TEMPLATE_LINKED",
+                avpProvider.ParamTemplateId: avpTestSupport.TestCedarTemplateId,
+            },
+        },
+        Subjects: hexapolicy.SubjectInfo{"hexa_avp:User:\"bob@example.com\""},
+        Actions:  []hexapolicy.ActionInfo{"hexa_avp:Action:\"Deposit\""},
+        Object:   "hexa_avp:account:\"2\"",
+    }}
+
+    report, err := p.MapPolicyReport(avpTestSupport.IntegrationInfo(), policyprovider.ApplicationInfo{}, policies)
+    assert.NoError(t, err)
+    assert.Equal(t, avpProvider.ProviderTypeAvp, report.Target)
+    assert.Equal(t, []string{
+        "policy 1: ACTION APPROXIMATED - actions of a template-linked policy are taken from template " + avpTestSupport.TestCedarTemplateId,
+    }, report.Issues())
+}
+
 func TestAvp_5_GetSchemaLive(t *testing.T) {
     if isLiveTest() {
         var err error
@@ -408,6 +613,86 @@ func TestAvp_5_GetSchemaLive(t *testing.T) {
 
 }
 
+func TestAvp_5a_Schema(t *testing.T) {
+    mockClient := avpTestSupport.NewMockVerifiedPermissionsHTTPClient()
+    var p policyprovider.SchemaManager = avpProvider.AmazonAvpProvider{
+        AwsClientOpts: awscommon.AWSClientOptions{
+            HTTPClient:   mockClient,
+            DisableRetry: true,
+        }}
+    info := avpTestSupport.IntegrationInfo()
+    app := avpTestSupport.AppInfo()
+    schema := `{"hexa_avp": {"entityTypes": {"User": {"shape": {"type": "Record", "attributes": {"name": {"type": "String"}}}}},
+  "actions": {"ReadAccount": {"appliesTo": {"principalTypes": ["User"], "resourceTypes": ["Account"]}}}}}`
+
+    mockClient.MockGetSchemaWithHttpStatus(http.StatusOK, schema, "hexa_avp")
+    namespaces, err := p.GetSchema(info, app)
+    assert.NoError(t, err)
+    assert.Equal(t, policyInfoModel.PrincipalTypes{"User"}, *(*namespaces)["hexa_avp"].Actions["ReadAccount"].AppliesTo.PrincipalTypes)
+
+    // A store without a schema
+    mockClient.MockGetSchemaWithHttpStatus(http.StatusNotFound, "")
+    empty, err := p.GetSchema(info, app)
+    assert.NoError(t, err)
+    assert.Empty(t, *empty)
+
+    mockClient.MockGetSchemaWithHttpStatus(http.StatusForbidden, "")
+    _, err = p.GetSchema(info, app)
+    assert.Error(t, err)
+
+    mockClient.MockPutSchemaWithHttpStatus(http.StatusOK, "hexa_avp")
+    assert.NoError(t, p.SetSchema(info, app, *namespaces))
+    var putInput struct {
+        PolicyStoreId string
+        Definition    struct {
+            CedarJson string `json:"cedarJson"`
+        } `json:"definition"`
+    }
+    assert.NoError(t, json.Unmarshal(mockClient.GetRequestBody(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.PutSchema"), &putInput))
+    assert.Equal(t, avpTestSupport.TestPolicyStoreId, putInput.PolicyStoreId)
+    // Cedar treats attributes as required unless declared otherwise
+    assert.JSONEq(t, strings.Replace(schema, `{"type": "String"}`, `{"type": "String", "required": true}`, 1), putInput.Definition.CedarJson)
+
+    assert.ErrorContains(t, p.SetSchema(info, app, nil), "at least one namespace")
+    assert.True(t, mockClient.VerifyCalled())
+}
+
+func TestAvp_5b_CreateApplication(t *testing.T) {
+    mockClient := avpTestSupport.NewMockVerifiedPermissionsHTTPClient()
+    var p policyprovider.ApplicationCreator = avpProvider.AmazonAvpProvider{
+        AwsClientOpts: awscommon.AWSClientOptions{
+            HTTPClient:   mockClient,
+            DisableRetry: true,
+        }}
+    info := avpTestSupport.IntegrationInfo()
+
+    mockClient.MockCreatePolicyStoreWithHttpStatus(http.StatusOK, "newStore")
+    app, err := p.CreateApplication(info, "A new store", map[string]string{avpProvider.SettingValidationMode: "off"})
+    assert.NoError(t, err)
+    assert.Equal(t, policyprovider.ApplicationInfo{
+        ObjectID:    "newStore",
+        Name:        "arn:aws:verifiedpermissions::773752081234:policy-store/newStore",
+        Description: "A new store",
+        Service:     "VerifiedPermissions",
+    }, app)
+    body := string(mockClient.GetRequestBody(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.CreatePolicyStore"))
+    assert.Contains(t, body, `"validationSettings":{"mode":"OFF"}`)
+    assert.Contains(t, body, `"description":"A new store"`)
+
+    mockClient.MockCreatePolicyStoreWithHttpStatus(http.StatusOK, "strictStore")
+    app, err = p.CreateApplication(info, "A strict store", nil)
+    assert.NoError(t, err)
+    assert.Equal(t, "strictStore", app.ObjectID)
+    body = string(mockClient.GetRequestBodyByIndex(http.MethodPost, avpTestSupport.AvpApiUrl, "VerifiedPermissions.CreatePolicyStore", 1))
+    assert.Contains(t, body, `"mode":"STRICT"`)
+    assert.True(t, mockClient.VerifyCalled())
+
+    _, err = p.CreateApplication(info, "bad", map[string]string{avpProvider.SettingValidationMode: "loose"})
+    assert.ErrorContains(t, err, "invalid AVP validation mode loose")
+    _, err = p.CreateApplication(info, "bad", map[string]string{"other": "x"})
+    assert.ErrorContains(t, err, "unsupported AVP policy store setting other")
+}
+
 func TestAvp_6_GetPoliciesLive(t *testing.T) {
     if isLiveTest() {
 
@@ -0,0 +1,347 @@
+package awsIamProvider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/formats/awsIam"
+	"github.com/hexa-org/policy-mapper/providers/aws/awscommon"
+)
+
+// MaxPolicyVersions is the number of versions IAM keeps for a managed policy
+const MaxPolicyVersions = 5
+
+const (
+	ServiceRole  = "role"
+	ServiceGroup = "group"
+	ServiceUser  = "user"
+)
+
+// serviceRolePath is the path of service-linked roles, whose policies are managed by AWS
+const serviceRolePath = "/aws-service-role/"
+
+// awsManagedPolicyArn is part of the ARN of every AWS managed policy (e.g. arn:aws:iam::aws:policy/ReadOnlyAccess)
+const awsManagedPolicyArn = ":iam::aws:policy/"
+
+/*
+IamClient lists IAM roles and groups and manages the customer managed policies attached to them. Subjects are IAM
+identities in the form <user|group|role>:<name> (see awsIam.SubjectTypes).
+*/
+type IamClient interface {
+	ListRoles() ([]policyprovider.ApplicationInfo, error)
+	ListGroups() ([]policyprovider.ApplicationInfo, error)
+	// ListAttachedPolicies returns the ARNs of the customer managed policies attached to the subject
+	ListAttachedPolicies(subject string) ([]string, error)
+	// ListLocalPolicies returns the ARNs of the customer managed policies of the account by name
+	ListLocalPolicies() (map[string]string, error)
+	GetManagedPolicy(arn string) (awsIam.ManagedPolicy, error)
+	CreatePolicy(name string, document awsIam.PolicyDocument) (string, error)
+	// UpdatePolicyDocument makes the document the default version of the policy, deleting the oldest version when
+	// the policy already has MaxPolicyVersions
+	UpdatePolicyDocument(arn string, document awsIam.PolicyDocument) (string, error)
+	AttachPolicy(arn string, subject string) error
+	DetachPolicy(arn string, subject string) error
+}
+
+type iamClient struct {
+	client *iam.Client
+	ctx    context.Context
+}
+
+/*
+NewIamClient returns an IamClient for the AWS credentials key (see awscommon.GetAwsClientConfig). baseEndpoint
+overrides the IAM endpoint when not empty.
+*/
+func NewIamClient(key []byte, opt awscommon.AWSClientOptions, baseEndpoint string) (IamClient, error) {
+	return NewIamClientContext(context.Background(), key, opt, baseEndpoint)
+}
+
+// NewIamClientContext is NewIamClient where the requests of the client are made with ctx
+func NewIamClientContext(ctx context.Context, key []byte, opt awscommon.AWSClientOptions, baseEndpoint string) (IamClient, error) {
+	cfg, err := awscommon.GetAwsClientConfigContext(ctx, key, opt)
+	if err != nil {
+		return nil, err
+	}
+	client := iam.NewFromConfig(cfg, func(o *iam.Options) {
+		if baseEndpoint != "" {
+			o.BaseEndpoint = aws.String(baseEndpoint)
+		}
+	})
+	return &iamClient{client: client, ctx: ctx}, nil
+}
+
+func (c *iamClient) ListRoles() ([]policyprovider.ApplicationInfo, error) {
+	var apps []policyprovider.ApplicationInfo
+	paginator := iam.NewListRolesPaginator(c.client, &iam.ListRolesInput{})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(c.ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range output.Roles {
+			if strings.HasPrefix(aws.ToString(role.Path), serviceRolePath) {
+				continue
+			}
+			apps = append(apps, policyprovider.ApplicationInfo{
+				ObjectID:    aws.ToString(role.Arn),
+				Name:        aws.ToString(role.RoleName),
+				Description: aws.ToString(role.Description),
+				Service:     ServiceRole,
+			})
+		}
+	}
+	return apps, nil
+}
+
+func (c *iamClient) ListGroups() ([]policyprovider.ApplicationInfo, error) {
+	var apps []policyprovider.ApplicationInfo
+	paginator := iam.NewListGroupsPaginator(c.client, &iam.ListGroupsInput{})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(c.ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range output.Groups {
+			apps = append(apps, policyprovider.ApplicationInfo{
+				ObjectID:    aws.ToString(group.Arn),
+				Name:        aws.ToString(group.GroupName),
+				Description: "IAM group " + aws.ToString(group.Path),
+				Service:     ServiceGroup,
+			})
+		}
+	}
+	return apps, nil
+}
+
+func (c *iamClient) ListAttachedPolicies(subject string) ([]string, error) {
+	service, name, err := splitSubject(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var attached []types.AttachedPolicy
+	switch service {
+	case ServiceRole:
+		paginator := iam.NewListAttachedRolePoliciesPaginator(c.client, &iam.ListAttachedRolePoliciesInput{RoleName: &name})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(c.ctx)
+			if err != nil {
+				return nil, err
+			}
+			attached = append(attached, output.AttachedPolicies...)
+		}
+	case ServiceGroup:
+		paginator := iam.NewListAttachedGroupPoliciesPaginator(c.client, &iam.ListAttachedGroupPoliciesInput{GroupName: &name})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(c.ctx)
+			if err != nil {
+				return nil, err
+			}
+			attached = append(attached, output.AttachedPolicies...)
+		}
+	default:
+		paginator := iam.NewListAttachedUserPoliciesPaginator(c.client, &iam.ListAttachedUserPoliciesInput{UserName: &name})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(c.ctx)
+			if err != nil {
+				return nil, err
+			}
+			attached = append(attached, output.AttachedPolicies...)
+		}
+	}
+
+	var arns []string
+	for _, policy := range attached {
+		arn := aws.ToString(policy.PolicyArn)
+		if !strings.Contains(arn, awsManagedPolicyArn) {
+			arns = append(arns, arn)
+		}
+	}
+	return arns, nil
+}
+
+func (c *iamClient) ListLocalPolicies() (map[string]string, error) {
+	policies := map[string]string{}
+	paginator := iam.NewListPoliciesPaginator(c.client, &iam.ListPoliciesInput{Scope: types.PolicyScopeTypeLocal})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(c.ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, policy := range output.Policies {
+			policies[aws.ToString(policy.PolicyName)] = aws.ToString(policy.Arn)
+		}
+	}
+	return policies, nil
+}
+
+func (c *iamClient) GetManagedPolicy(arn string) (awsIam.ManagedPolicy, error) {
+	policyOutput, err := c.client.GetPolicy(c.ctx, &iam.GetPolicyInput{PolicyArn: &arn})
+	if err != nil {
+		return awsIam.ManagedPolicy{}, err
+	}
+	policy := policyOutput.Policy
+
+	versionOutput, err := c.client.GetPolicyVersion(c.ctx, &iam.GetPolicyVersionInput{
+		PolicyArn: &arn,
+		VersionId: policy.DefaultVersionId,
+	})
+	if err != nil {
+		return awsIam.ManagedPolicy{}, err
+	}
+	// IAM returns the document URL encoded
+	document, err := url.QueryUnescape(aws.ToString(versionOutput.PolicyVersion.Document))
+	if err != nil {
+		return awsIam.ManagedPolicy{}, err
+	}
+	doc, err := awsIam.ParsePolicyDocument(document)
+	if err != nil {
+		return awsIam.ManagedPolicy{}, fmt.Errorf("policy %s: %w", arn, err)
+	}
+
+	subjects, err := c.listEntities(arn)
+	if err != nil {
+		return awsIam.ManagedPolicy{}, err
+	}
+
+	return awsIam.ManagedPolicy{
+		Name:      aws.ToString(policy.PolicyName),
+		Arn:       arn,
+		VersionId: aws.ToString(policy.DefaultVersionId),
+		Subjects:  subjects,
+		Document:  *doc,
+	}, nil
+}
+
+// listEntities returns the users, groups and roles the policy is attached to as sorted subjects
+func (c *iamClient) listEntities(arn string) ([]string, error) {
+	var subjects []string
+	paginator := iam.NewListEntitiesForPolicyPaginator(c.client, &iam.ListEntitiesForPolicyInput{PolicyArn: &arn})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(c.ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range output.PolicyUsers {
+			subjects = append(subjects, ServiceUser+":"+aws.ToString(user.UserName))
+		}
+		for _, group := range output.PolicyGroups {
+			subjects = append(subjects, ServiceGroup+":"+aws.ToString(group.GroupName))
+		}
+		for _, role := range output.PolicyRoles {
+			subjects = append(subjects, ServiceRole+":"+aws.ToString(role.RoleName))
+		}
+	}
+	sort.Strings(subjects)
+	return subjects, nil
+}
+
+func (c *iamClient) CreatePolicy(name string, document awsIam.PolicyDocument) (string, error) {
+	output, err := c.client.CreatePolicy(c.ctx, &iam.CreatePolicyInput{
+		PolicyName:     &name,
+		PolicyDocument: aws.String(document.String()),
+		Description:    aws.String("Managed by Hexa"),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.Policy.Arn), nil
+}
+
+func (c *iamClient) UpdatePolicyDocument(arn string, document awsIam.PolicyDocument) (string, error) {
+	var versions []types.PolicyVersion
+	paginator := iam.NewListPolicyVersionsPaginator(c.client, &iam.ListPolicyVersionsInput{PolicyArn: &arn})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(c.ctx)
+		if err != nil {
+			return "", err
+		}
+		versions = append(versions, output.Versions...)
+	}
+
+	if len(versions) >= MaxPolicyVersions {
+		oldest := oldestVersion(versions)
+		if oldest == nil {
+			return "", fmt.Errorf("policy %s has no version that can be deleted", arn)
+		}
+		_, err := c.client.DeletePolicyVersion(c.ctx, &iam.DeletePolicyVersionInput{
+			PolicyArn: &arn,
+			VersionId: oldest.VersionId,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	output, err := c.client.CreatePolicyVersion(c.ctx, &iam.CreatePolicyVersionInput{
+		PolicyArn:      &arn,
+		PolicyDocument: aws.String(document.String()),
+		SetAsDefault:   true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.PolicyVersion.VersionId), nil
+}
+
+// oldestVersion returns the oldest version that is not the default version
+func oldestVersion(versions []types.PolicyVersion) *types.PolicyVersion {
+	var oldest *types.PolicyVersion
+	for i, version := range versions {
+		if version.IsDefaultVersion {
+			continue
+		}
+		if oldest == nil || aws.ToTime(version.CreateDate).Before(aws.ToTime(oldest.CreateDate)) {
+			oldest = &versions[i]
+		}
+	}
+	return oldest
+}
+
+func (c *iamClient) AttachPolicy(arn string, subject string) error {
+	service, name, err := splitSubject(subject)
+	if err != nil {
+		return err
+	}
+	switch service {
+	case ServiceRole:
+		_, err = c.client.AttachRolePolicy(c.ctx, &iam.AttachRolePolicyInput{PolicyArn: &arn, RoleName: &name})
+	case ServiceGroup:
+		_, err = c.client.AttachGroupPolicy(c.ctx, &iam.AttachGroupPolicyInput{PolicyArn: &arn, GroupName: &name})
+	default:
+		_, err = c.client.AttachUserPolicy(c.ctx, &iam.AttachUserPolicyInput{PolicyArn: &arn, UserName: &name})
+	}
+	return err
+}
+
+func (c *iamClient) DetachPolicy(arn string, subject string) error {
+	service, name, err := splitSubject(subject)
+	if err != nil {
+		return err
+	}
+	switch service {
+	case ServiceRole:
+		_, err = c.client.DetachRolePolicy(c.ctx, &iam.DetachRolePolicyInput{PolicyArn: &arn, RoleName: &name})
+	case ServiceGroup:
+		_, err = c.client.DetachGroupPolicy(c.ctx, &iam.DetachGroupPolicyInput{PolicyArn: &arn, GroupName: &name})
+	default:
+		_, err = c.client.DetachUserPolicy(c.ctx, &iam.DetachUserPolicyInput{PolicyArn: &arn, UserName: &name})
+	}
+	return err
+}
+
+func splitSubject(subject string) (string, string, error) {
+	service, name, found := strings.Cut(subject, ":")
+	if !found || name == "" || (service != ServiceRole && service != ServiceGroup && service != ServiceUser) {
+		return "", "", errors.New("invalid IAM subject (expecting user:, group: or role:<name>): " + subject)
+	}
+	return service, name, nil
+}
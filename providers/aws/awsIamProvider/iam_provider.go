@@ -0,0 +1,283 @@
+package awsIamProvider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/formats/awsIam"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/providers/aws/awscommon"
+)
+
+const ProviderTypeAwsIam string = "aws_iam"
+
+/*
+AwsIamProvider manages the customer managed IAM policies attached to IAM roles and groups. Each role and group is a
+policy application point (ObjectID is its ARN and Service is role or group). The statements of the policies attached to
+the PAP are mapped to IDQL policies (see awsIam.AwsIamMapper), whose subjects are all the users, groups and roles the
+policy is attached to. AWS managed policies are not returned or modified.
+*/
+type AwsIamProvider struct {
+	AwsClientOpts awscommon.AWSClientOptions
+	BaseEndpoint  string // BaseEndpoint overrides the IAM endpoint (e.g. for testing)
+	Mapper        *awsIam.AwsIamMapper
+}
+
+func (a *AwsIamProvider) initMapper() {
+	if a.Mapper == nil {
+		a.Mapper = awsIam.New(map[string]string{})
+	}
+}
+
+func (a *AwsIamProvider) Name() string {
+	return ProviderTypeAwsIam
+}
+
+// Capabilities reports that policies are IAM statements. A policy with a deny condition is a Deny statement.
+func (a *AwsIamProvider) Capabilities() policyprovider.Capabilities {
+	return policyprovider.Capabilities{
+		Conditions:      true,
+		DenyConditions:  true,
+		MultipleActions: true,
+		Objects:         true,
+		SubjectTypes:    awsIam.SubjectTypes,
+	}
+}
+
+func (a *AwsIamProvider) getClient(ctx context.Context, key []byte) (IamClient, error) {
+	return NewIamClientContext(ctx, key, a.AwsClientOpts, a.BaseEndpoint)
+}
+
+// DiscoverApplications returns the roles (except service-linked roles) and groups of the account
+func (a *AwsIamProvider) DiscoverApplications(info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
+	return a.DiscoverApplicationsContext(context.Background(), info)
+}
+
+func (a *AwsIamProvider) DiscoverApplicationsContext(ctx context.Context, info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
+	if !strings.EqualFold(info.Name, a.Name()) {
+		return []policyprovider.ApplicationInfo{}, nil
+	}
+
+	client, err := a.getClient(ctx, info.Key)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := client.ListRoles()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := client.ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	return append(roles, groups...), nil
+}
+
+func (a *AwsIamProvider) GetPolicyInfo(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	return a.GetPolicyInfoContext(context.Background(), info, applicationInfo)
+}
+
+func (a *AwsIamProvider) GetPolicyInfoContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	a.initMapper()
+
+	client, err := a.getClient(ctx, info.Key)
+	if err != nil {
+		return nil, err
+	}
+	managedPolicies, err := a.attachedPolicies(client, applicationInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []hexapolicy.PolicyInfo
+	for _, managed := range managedPolicies {
+		mapped, err := a.Mapper.MapManagedPolicyToPolicies(managed)
+		if err != nil {
+			return nil, err
+		}
+		for i := range mapped {
+			mapped[i].Meta.ProviderType = a.Name()
+			mapped[i].Meta.PapId = &applicationInfo.ObjectID
+		}
+		policies = append(policies, mapped...)
+	}
+	return policies, nil
+}
+
+func (a *AwsIamProvider) attachedPolicies(client IamClient, applicationInfo policyprovider.ApplicationInfo) ([]awsIam.ManagedPolicy, error) {
+	subject, err := papSubject(applicationInfo)
+	if err != nil {
+		return nil, err
+	}
+	arns, err := client.ListAttachedPolicies(subject)
+	if err != nil {
+		return nil, err
+	}
+	managedPolicies := make([]awsIam.ManagedPolicy, len(arns))
+	for i, arn := range arns {
+		if managedPolicies[i], err = client.GetManagedPolicy(arn); err != nil {
+			return nil, err
+		}
+	}
+	return managedPolicies, nil
+}
+
+/*
+SetPolicyInfo replaces the customer managed policies attached to the role or group with those mapped from policyInfos.
+Policies are identified by the managed policy name of the policy id (see awsIam.AwsIamMapper); policies without one
+are kept in the policy hexa-<PAP name>. A changed document is added as a new default version, deleting the oldest
+version when the policy has MaxPolicyVersions. The policies are attached to all of their subjects (which always include
+the PAP), and detached from the other users, groups and roles. Policies no longer mapped are detached from the PAP but
+are not deleted.
+*/
+func (a *AwsIamProvider) SetPolicyInfo(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+	return a.SetPolicyInfoContext(context.Background(), info, applicationInfo, policyInfos)
+}
+
+func (a *AwsIamProvider) SetPolicyInfoContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+	a.initMapper()
+
+	validate := validator.New()
+	if err := validate.Struct(applicationInfo); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := validate.Var(policyInfos, "omitempty,dive"); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	subject, err := papSubject(applicationInfo)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	managedPolicies, err := a.Mapper.MapPoliciesToManagedPolicies(policyInfos, "hexa-"+applicationInfo.Name)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	client, err := a.getClient(ctx, info.Key)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	existing, err := a.attachedPolicies(client, applicationInfo)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	existingByName := map[string]awsIam.ManagedPolicy{}
+	for _, managed := range existing {
+		existingByName[managed.Name] = managed
+	}
+
+	var localPolicies map[string]string
+	for _, managed := range managedPolicies {
+		if !slices.Contains(managed.Subjects, subject) {
+			managed.Subjects = append(managed.Subjects, subject)
+		}
+
+		current, attached := existingByName[managed.Name]
+		delete(existingByName, managed.Name)
+		if !attached {
+			// the policy may exist without being attached to the PAP
+			if localPolicies == nil {
+				if localPolicies, err = client.ListLocalPolicies(); err != nil {
+					return http.StatusInternalServerError, err
+				}
+			}
+			if arn, found := localPolicies[managed.Name]; found {
+				if current, err = client.GetManagedPolicy(arn); err != nil {
+					return http.StatusInternalServerError, err
+				}
+				attached = true
+			}
+		}
+
+		if err = a.updatePolicy(client, current, attached, managed); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	for _, removed := range existingByName {
+		log.Printf("Detaching IAM policy %s from %s.\n", removed.Arn, subject)
+		if err = client.DetachPolicy(removed.Arn, subject); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	return http.StatusCreated, nil
+}
+
+// updatePolicy creates or updates the managed policy and its attachments. exists is false when current is empty.
+func (a *AwsIamProvider) updatePolicy(client IamClient, current awsIam.ManagedPolicy, exists bool, managed *awsIam.ManagedPolicy) error {
+	if !exists {
+		arn, err := client.CreatePolicy(managed.Name, managed.Document)
+		if err != nil {
+			return fmt.Errorf("unable to create IAM policy %s: %w", managed.Name, err)
+		}
+		for _, s := range managed.Subjects {
+			if err = client.AttachPolicy(arn, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !current.Document.Equals(managed.Document) {
+		if _, err := client.UpdatePolicyDocument(current.Arn, managed.Document); err != nil {
+			return fmt.Errorf("unable to update IAM policy %s: %w", managed.Name, err)
+		}
+	}
+	for _, s := range managed.Subjects {
+		if !slices.Contains(current.Subjects, s) {
+			if err := client.AttachPolicy(current.Arn, s); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range current.Subjects {
+		if !slices.Contains(managed.Subjects, s) {
+			if err := client.DetachPolicy(current.Arn, s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MapPolicyReport reports how policyInfos are represented as IAM policy statements (see policyprovider.MappingReporter)
+func (a *AwsIamProvider) MapPolicyReport(_ policyprovider.IntegrationInfo, _ policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+	a.initMapper()
+	_, report := a.Mapper.MapPoliciesToManagedPoliciesReport(policyInfos, "hexa")
+	report.Target = a.Name()
+	return report, nil
+}
+
+// Reconcile compares the supplied policies with the statements of the policies attached to the role or group
+func (a *AwsIamProvider) Reconcile(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+	return a.ReconcileContext(context.Background(), info, applicationInfo, comparePolicies, diffsOnly)
+}
+
+func (a *AwsIamProvider) ReconcileContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+	existing, err := a.GetPolicyInfoContext(ctx, info, applicationInfo)
+	if err != nil {
+		return nil, err
+	}
+	policies := hexapolicy.Policies{Policies: existing}
+	return policies.ReconcilePolicies(comparePolicies, diffsOnly), nil
+}
+
+// papSubject returns the IAM subject of the role or group (e.g. role:app-server). The name is the last part of the ARN
+// because role and group names do not include their path.
+func papSubject(applicationInfo policyprovider.ApplicationInfo) (string, error) {
+	if applicationInfo.Service != ServiceRole && applicationInfo.Service != ServiceGroup {
+		return "", fmt.Errorf("unsupported IAM application service '%s' (expecting role or group)", applicationInfo.Service)
+	}
+	name := applicationInfo.ObjectID[strings.LastIndex(applicationInfo.ObjectID, "/")+1:]
+	if name == "" {
+		name = applicationInfo.Name
+	}
+	return applicationInfo.Service + ":" + name, nil
+}
@@ -0,0 +1,275 @@
+package awsIamProvider_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/formats/awsIam"
+	"github.com/hexa-org/policy-mapper/models/rar/testsupport/awstestsupport"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/providers/aws/awsIamProvider"
+	"github.com/hexa-org/policy-mapper/providers/aws/awscommon"
+	"github.com/stretchr/testify/assert"
+)
+
+var info = awstestsupport.IntegrationInfo(awsIamProvider.ProviderTypeAwsIam)
+
+var analystApp = policyprovider.ApplicationInfo{
+	ObjectID:    fmt.Sprintf("arn:aws:iam::%s:role/analyst", testAccount),
+	Name:        "analyst",
+	Description: "analyst role",
+	Service:     awsIamProvider.ServiceRole,
+}
+
+func newProvider(server *iamServer) *awsIamProvider.AwsIamProvider {
+	return &awsIamProvider.AwsIamProvider{
+		AwsClientOpts: awscommon.AWSClientOptions{DisableRetry: true},
+		BaseEndpoint:  server.URL,
+	}
+}
+
+func TestAwsIamProvider_DiscoverApplications(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+
+	apps, err := p.DiscoverApplications(info)
+	assert.NoError(t, err)
+	assert.Len(t, apps, 3)
+	assert.Equal(t, fmt.Sprintf("arn:aws:iam::%s:role/app-server", testAccount), apps[0].ObjectID)
+	assert.Equal(t, analystApp, apps[1])
+	assert.Equal(t, "readers", apps[2].Name)
+	assert.Equal(t, awsIamProvider.ServiceGroup, apps[2].Service)
+	// the roles were paged
+	assert.Equal(t, 2, countActions(server, "ListRoles"))
+
+	apps, err = p.DiscoverApplications(policyprovider.IntegrationInfo{Name: "avp", Key: info.Key})
+	assert.NoError(t, err)
+	assert.Empty(t, apps)
+}
+
+func TestAwsIamProvider_GetPolicyInfo(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+
+	policies, err := p.GetPolicyInfo(info, analystApp)
+	assert.NoError(t, err)
+	// ReadOnlyAccess is an AWS managed policy and is ignored
+	assert.Len(t, policies, 1)
+	policy := policies[0]
+	assert.Equal(t, "ReportReaders/ReadReports", *policy.Meta.PolicyId)
+	assert.Equal(t, awsIamProvider.ProviderTypeAwsIam, policy.Meta.ProviderType)
+	assert.Equal(t, analystApp.ObjectID, *policy.Meta.PapId)
+	assert.Equal(t, "v5", policy.Meta.SourceData[awsIam.SourceVersionId])
+	assert.Equal(t, hexapolicy.SubjectInfo{"role:analyst", "user:alice"}, policy.Subjects)
+	assert.Equal(t, []hexapolicy.ActionInfo{"s3:GetObject", "s3:ListBucket"}, policy.Actions)
+	assert.Equal(t, hexapolicy.ObjectInfo("arn:aws:s3:::reports/*"), policy.Object)
+	assert.Equal(t, "aws:SecureTransport eq true", policy.Condition.Rule)
+
+	policies, err = p.GetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: "arn:aws:iam::123456789012:role/app-server", Name: "app-server", Service: awsIamProvider.ServiceRole})
+	assert.NoError(t, err)
+	assert.Empty(t, policies)
+}
+
+func TestAwsIamProvider_SetPolicyInfo(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+
+	policies, err := p.GetPolicyInfo(info, analystApp)
+	assert.NoError(t, err)
+	readReports := policies[0]
+	readReports.Subjects = hexapolicy.SubjectInfo{"role:analyst"}
+	readReports.Actions = append(readReports.Actions, "s3:GetObjectVersion")
+	newPolicy := hexapolicy.PolicyInfo{
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: hexapolicy.SubjectInfo{"group:readers"},
+		Actions:  []hexapolicy.ActionInfo{"sqs:ReceiveMessage"},
+		Object:   "arn:aws:sqs:us-west-2:123456789012:reports",
+	}
+
+	status, err := p.SetPolicyInfo(info, analystApp, []hexapolicy.PolicyInfo{readReports, newPolicy})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status)
+
+	// the oldest version was deleted to make room for the new default version
+	readers := server.policy(reportReadersArn)
+	assert.Len(t, readers.versions, awsIamProvider.MaxPolicyVersions)
+	assert.Equal(t, "v2", readers.versions[0].id)
+	assert.Equal(t, "v6", readers.defaultVersion)
+	assert.Equal(t, map[string]bool{"role:analyst": true}, readers.attachments)
+
+	// the policy without an id is created and attached to the PAP and its subjects
+	created := server.policy("arn:aws:iam::123456789012:policy/hexa-analyst")
+	assert.NotNil(t, created)
+	assert.Equal(t, map[string]bool{"group:readers": true, "role:analyst": true}, created.attachments)
+
+	policies, err = p.GetPolicyInfo(info, analystApp)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+	assert.Equal(t, []hexapolicy.ActionInfo{"s3:GetObject", "s3:ListBucket", "s3:GetObjectVersion"}, policies[0].Actions)
+	assert.Equal(t, hexapolicy.SubjectInfo{"group:readers", "role:analyst"}, policies[1].Subjects)
+
+	// an unchanged policy is not updated, and a policy no longer mapped is detached but not deleted
+	status, err = p.SetPolicyInfo(info, analystApp, policies[1:])
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, 1, countActions(server, "CreatePolicyVersion"))
+	assert.Empty(t, server.policy(reportReadersArn).attachments)
+	assert.Len(t, server.policy("arn:aws:iam::123456789012:policy/hexa-analyst").versions, 1)
+	// the AWS managed policy is untouched
+	assert.True(t, server.policy(readOnlyAccessArn).attachments["role:analyst"])
+}
+
+func TestAwsIamProvider_SetPolicyInfo_existingPolicy(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+	appServer := policyprovider.ApplicationInfo{
+		ObjectID: "arn:aws:iam::123456789012:role/app-server",
+		Name:     "app-server",
+		Service:  awsIamProvider.ServiceRole,
+	}
+
+	policies, err := p.GetPolicyInfo(info, analystApp)
+	assert.NoError(t, err)
+
+	// ReportReaders exists but is not attached to app-server
+	status, err := p.SetPolicyInfo(info, appServer, policies)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, 0, countActions(server, "CreatePolicy"))
+	assert.Equal(t, 0, countActions(server, "CreatePolicyVersion"))
+	assert.Equal(t, map[string]bool{"role:analyst": true, "role:app-server": true, "user:alice": true}, server.policy(reportReadersArn).attachments)
+}
+
+func TestAwsIamProvider_SetPolicyInfo_errors(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+
+	status, err := p.SetPolicyInfo(info, analystApp, []hexapolicy.PolicyInfo{{
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: hexapolicy.SubjectInfo{"any"},
+		Actions:  []hexapolicy.ActionInfo{"s3:GetObject"},
+		Object:   "*",
+	}})
+	assert.ErrorContains(t, err, "not an IAM user, group or role")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	user := analystApp
+	user.Service = awsIamProvider.ServiceUser
+	status, err = p.SetPolicyInfo(info, user, []hexapolicy.PolicyInfo{})
+	assert.ErrorContains(t, err, "unsupported IAM application service")
+	assert.Equal(t, http.StatusInternalServerError, status)
+
+	missing := analystApp
+	missing.ObjectID = "arn:aws:iam::123456789012:role/missing"
+	// the policy attached to the role has no versions
+	server.policies["arn:aws:iam::123456789012:policy/Missing"] = &managedPolicy{
+		name:           "Missing",
+		arn:            "arn:aws:iam::123456789012:policy/Missing",
+		defaultVersion: "v1",
+		attachments:    map[string]bool{"role:missing": true},
+	}
+	status, err = p.SetPolicyInfo(info, missing, []hexapolicy.PolicyInfo{})
+	assert.ErrorContains(t, err, "NoSuchEntity")
+	assert.Equal(t, http.StatusInternalServerError, status)
+}
+
+func TestAwsIamProvider_Reconcile(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+
+	policies, err := p.GetPolicyInfo(info, analystApp)
+	assert.NoError(t, err)
+
+	difs, err := p.Reconcile(info, analystApp, policies, true)
+	assert.NoError(t, err)
+	assert.Empty(t, difs)
+
+	changed := policies[0]
+	changed.Condition = &conditions.ConditionInfo{Rule: "aws:SecureTransport eq false", Action: conditions.AAllow}
+	difs, err = p.Reconcile(info, analystApp, []hexapolicy.PolicyInfo{changed}, true)
+	assert.NoError(t, err)
+	assert.Len(t, difs, 1)
+	assert.Equal(t, hexapolicy.ChangeTypeUpdate, difs[0].Type)
+}
+
+func TestAwsIamProvider_MapPolicyReport(t *testing.T) {
+	p := &awsIamProvider.AwsIamProvider{}
+	report, err := p.MapPolicyReport(info, analystApp, []hexapolicy.PolicyInfo{{
+		Subjects:  hexapolicy.SubjectInfo{"role:analyst"},
+		Condition: &conditions.ConditionInfo{Rule: awsIam.DenyAllRule, Action: conditions.ADeny},
+		Actions:   []hexapolicy.ActionInfo{"s3:DeleteObject"},
+		Object:    "*",
+	}, {
+		Subjects: hexapolicy.SubjectInfo{"anyAuthenticated"},
+		Actions:  []hexapolicy.ActionInfo{"s3:GetObject"},
+		Object:   "*",
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, awsIamProvider.ProviderTypeAwsIam, report.Target)
+	issues := report.Issues()
+	assert.Len(t, issues, 2)
+	assert.Contains(t, issues[0], "IAM Deny statement")
+	assert.Contains(t, issues[1], "not an IAM user, group or role")
+}
+
+func TestAwsIamProvider_Context(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+
+	policies, err := p.GetPolicyInfoContext(context.Background(), info, analystApp)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := len(server.actions())
+
+	_, err = p.DiscoverApplicationsContext(ctx, info)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = p.GetPolicyInfoContext(ctx, info, analystApp)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	status, err := p.SetPolicyInfoContext(ctx, info, analystApp, policies)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, http.StatusInternalServerError, status)
+
+	_, err = p.ReconcileContext(ctx, info, analystApp, policies, true)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// no requests were made once the context was cancelled
+	assert.Len(t, server.actions(), calls)
+}
+
+func TestAwsIamProvider_BadCredentials(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+	badInfo := policyprovider.IntegrationInfo{Name: awsIamProvider.ProviderTypeAwsIam, Key: []byte("aKey")}
+
+	_, err := p.DiscoverApplications(badInfo)
+	assert.Error(t, err)
+
+	_, err = p.GetPolicyInfo(badInfo, analystApp)
+	assert.Error(t, err)
+
+	status, err := p.SetPolicyInfo(badInfo, analystApp, []hexapolicy.PolicyInfo{})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusInternalServerError, status)
+
+	_, err = p.Reconcile(badInfo, analystApp, []hexapolicy.PolicyInfo{}, true)
+	assert.Error(t, err)
+}
+
+func countActions(server *iamServer, action string) int {
+	count := 0
+	for _, a := range server.actions() {
+		if a == action {
+			count++
+		}
+	}
+	return count
+}
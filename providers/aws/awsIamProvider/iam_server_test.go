@@ -0,0 +1,357 @@
+package awsIamProvider_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/providers/aws/awsIamProvider"
+)
+
+const (
+	testAccount = "123456789012"
+
+	readOnlyAccessArn = "arn:aws:iam::aws:policy/ReadOnlyAccess"
+	reportReadersArn  = "arn:aws:iam::123456789012:policy/ReportReaders"
+)
+
+const reportReadersDocument = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "ReadReports",
+      "Effect": "Allow",
+      "Action": ["s3:GetObject", "s3:ListBucket"],
+      "Resource": "arn:aws:s3:::reports/*",
+      "Condition": {"Bool": {"aws:SecureTransport": "true"}}
+    }
+  ]
+}`
+
+type policyVersion struct {
+	id       string
+	document string
+	created  time.Time
+}
+
+type managedPolicy struct {
+	name           string
+	arn            string
+	defaultVersion string
+	versions       []*policyVersion
+	nextVersion    int
+	attachments    map[string]bool // subjects, e.g. role:analyst
+}
+
+/*
+iamServer is an httptest stand-in for the IAM query API. Requests are form encoded with an Action parameter and
+responses are XML. Roles are returned two per page so that paging is exercised. As in IAM, a policy has at most
+awsIamProvider.MaxPolicyVersions versions and the default version cannot be deleted.
+*/
+type iamServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	roles    []string // role names, service-linked roles have the prefix service/
+	groups   []string
+	policies map[string]*managedPolicy
+	requests []string // actions received
+}
+
+func newIamServer(t *testing.T) *iamServer {
+	s := &iamServer{
+		roles:    []string{"app-server", "analyst", "service/AWSServiceRoleForSupport"},
+		groups:   []string{"readers"},
+		policies: map[string]*managedPolicy{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+
+	readers := s.addPolicy("ReportReaders", reportReadersDocument, "role:analyst", "user:alice")
+	for i := 0; i < 4; i++ {
+		s.addVersion(readers, reportReadersDocument)
+	}
+	s.policies[readOnlyAccessArn] = &managedPolicy{
+		name:        "ReadOnlyAccess",
+		arn:         readOnlyAccessArn,
+		attachments: map[string]bool{"role:analyst": true},
+	}
+	return s
+}
+
+func (s *iamServer) addPolicy(name string, document string, subjects ...string) *managedPolicy {
+	policy := &managedPolicy{
+		name:        name,
+		arn:         fmt.Sprintf("arn:aws:iam::%s:policy/%s", testAccount, name),
+		attachments: map[string]bool{},
+	}
+	for _, subject := range subjects {
+		policy.attachments[subject] = true
+	}
+	s.policies[policy.arn] = policy
+	s.addVersion(policy, document)
+	return policy
+}
+
+func (s *iamServer) addVersion(policy *managedPolicy, document string) *policyVersion {
+	policy.nextVersion++
+	version := &policyVersion{
+		id:       fmt.Sprintf("v%d", policy.nextVersion),
+		document: document,
+		created:  time.Date(2024, 1, 1, 0, 0, policy.nextVersion, 0, time.UTC),
+	}
+	policy.versions = append(policy.versions, version)
+	policy.defaultVersion = version.id
+	return version
+}
+
+func (s *iamServer) policy(arn string) *managedPolicy {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.policies[arn]
+}
+
+func (s *iamServer) actions() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *iamServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedInput", err.Error())
+		return
+	}
+	action := r.Form.Get("Action")
+	s.requests = append(s.requests, action)
+
+	switch action {
+	case "ListRoles":
+		s.listRoles(w, r.Form.Get("Marker"))
+	case "ListGroups":
+		var members strings.Builder
+		for _, group := range s.groups {
+			fmt.Fprintf(&members, "<member><Path>/</Path><GroupName>%s</GroupName><Arn>arn:aws:iam::%s:group/%s</Arn></member>", group, testAccount, group)
+		}
+		writeResult(w, action, fmt.Sprintf("<Groups>%s</Groups><IsTruncated>false</IsTruncated>", members.String()))
+	case "ListAttachedRolePolicies":
+		s.listAttached(w, action, "role:"+r.Form.Get("RoleName"))
+	case "ListAttachedGroupPolicies":
+		s.listAttached(w, action, "group:"+r.Form.Get("GroupName"))
+	case "ListAttachedUserPolicies":
+		s.listAttached(w, action, "user:"+r.Form.Get("UserName"))
+	case "ListPolicies":
+		var members strings.Builder
+		for _, policy := range s.sortedPolicies() {
+			if r.Form.Get("Scope") == "Local" && strings.HasPrefix(policy.arn, "arn:aws:iam::aws:") {
+				continue
+			}
+			fmt.Fprintf(&members, "<member><PolicyName>%s</PolicyName><Arn>%s</Arn><DefaultVersionId>%s</DefaultVersionId></member>", policy.name, policy.arn, policy.defaultVersion)
+		}
+		writeResult(w, action, fmt.Sprintf("<Policies>%s</Policies><IsTruncated>false</IsTruncated>", members.String()))
+	case "GetPolicy":
+		policy, ok := s.findPolicy(w, r)
+		if ok {
+			writeResult(w, action, fmt.Sprintf("<Policy><PolicyName>%s</PolicyName><Arn>%s</Arn><DefaultVersionId>%s</DefaultVersionId></Policy>", policy.name, policy.arn, policy.defaultVersion))
+		}
+	case "GetPolicyVersion":
+		policy, ok := s.findPolicy(w, r)
+		if !ok {
+			return
+		}
+		for _, version := range policy.versions {
+			if version.id == r.Form.Get("VersionId") {
+				writeResult(w, action, "<PolicyVersion>"+versionXml(policy, version, true)+"</PolicyVersion>")
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "NoSuchEntity", "version not found")
+	case "ListEntitiesForPolicy":
+		policy, ok := s.findPolicy(w, r)
+		if ok {
+			writeResult(w, action, entitiesXml(policy)+"<IsTruncated>false</IsTruncated>")
+		}
+	case "CreatePolicy":
+		name := r.Form.Get("PolicyName")
+		if _, exists := s.policies[fmt.Sprintf("arn:aws:iam::%s:policy/%s", testAccount, name)]; exists {
+			writeError(w, http.StatusConflict, "EntityAlreadyExists", "policy "+name+" already exists")
+			return
+		}
+		policy := s.addPolicy(name, r.Form.Get("PolicyDocument"))
+		writeResult(w, action, fmt.Sprintf("<Policy><PolicyName>%s</PolicyName><Arn>%s</Arn><DefaultVersionId>%s</DefaultVersionId></Policy>", policy.name, policy.arn, policy.defaultVersion))
+	case "CreatePolicyVersion":
+		policy, ok := s.findPolicy(w, r)
+		if !ok {
+			return
+		}
+		if len(policy.versions) >= awsIamProvider.MaxPolicyVersions {
+			writeError(w, http.StatusConflict, "LimitExceeded", "a managed policy can have up to 5 versions")
+			return
+		}
+		version := s.addVersion(policy, r.Form.Get("PolicyDocument"))
+		writeResult(w, action, "<PolicyVersion>"+versionXml(policy, version, false)+"</PolicyVersion>")
+	case "ListPolicyVersions":
+		policy, ok := s.findPolicy(w, r)
+		if !ok {
+			return
+		}
+		var members strings.Builder
+		for _, version := range policy.versions {
+			members.WriteString("<member>" + versionXml(policy, version, false) + "</member>")
+		}
+		writeResult(w, action, fmt.Sprintf("<Versions>%s</Versions><IsTruncated>false</IsTruncated>", members.String()))
+	case "DeletePolicyVersion":
+		policy, ok := s.findPolicy(w, r)
+		if !ok {
+			return
+		}
+		versionId := r.Form.Get("VersionId")
+		if versionId == policy.defaultVersion {
+			writeError(w, http.StatusConflict, "DeleteConflict", "cannot delete the default version")
+			return
+		}
+		for i, version := range policy.versions {
+			if version.id == versionId {
+				policy.versions = append(policy.versions[:i], policy.versions[i+1:]...)
+				writeNoResult(w, action)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "NoSuchEntity", "version not found")
+	case "AttachRolePolicy", "AttachGroupPolicy", "AttachUserPolicy", "DetachRolePolicy", "DetachGroupPolicy", "DetachUserPolicy":
+		policy, ok := s.findPolicy(w, r)
+		if !ok {
+			return
+		}
+		subject := attachmentSubject(action, r.Form)
+		if strings.HasPrefix(action, "Attach") {
+			policy.attachments[subject] = true
+		} else {
+			delete(policy.attachments, subject)
+		}
+		writeNoResult(w, action)
+	default:
+		writeError(w, http.StatusBadRequest, "InvalidAction", "unsupported action "+action)
+	}
+}
+
+func (s *iamServer) listRoles(w http.ResponseWriter, marker string) {
+	start, _ := strconv.Atoi(marker)
+	end := min(start+2, len(s.roles))
+	var members strings.Builder
+	for _, role := range s.roles[start:end] {
+		path := "/"
+		if name, found := strings.CutPrefix(role, "service/"); found {
+			path, role = "/aws-service-role/support.amazonaws.com/", name
+		}
+		fmt.Fprintf(&members, "<member><Path>%s</Path><RoleName>%s</RoleName><Arn>arn:aws:iam::%s:role%s%s</Arn><Description>%s role</Description></member>",
+			path, role, testAccount, path, role, role)
+	}
+	paging := "<IsTruncated>false</IsTruncated>"
+	if end < len(s.roles) {
+		paging = fmt.Sprintf("<IsTruncated>true</IsTruncated><Marker>%d</Marker>", end)
+	}
+	writeResult(w, "ListRoles", fmt.Sprintf("<Roles>%s</Roles>%s", members.String(), paging))
+}
+
+func (s *iamServer) listAttached(w http.ResponseWriter, action string, subject string) {
+	var members strings.Builder
+	for _, policy := range s.sortedPolicies() {
+		if policy.attachments[subject] {
+			fmt.Fprintf(&members, "<member><PolicyName>%s</PolicyName><PolicyArn>%s</PolicyArn></member>", policy.name, policy.arn)
+		}
+	}
+	writeResult(w, action, fmt.Sprintf("<AttachedPolicies>%s</AttachedPolicies><IsTruncated>false</IsTruncated>", members.String()))
+}
+
+func (s *iamServer) sortedPolicies() []*managedPolicy {
+	var policies []*managedPolicy
+	for _, policy := range s.policies {
+		policies = append(policies, policy)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].arn < policies[j].arn })
+	return policies
+}
+
+func (s *iamServer) findPolicy(w http.ResponseWriter, r *http.Request) (*managedPolicy, bool) {
+	policy, found := s.policies[r.Form.Get("PolicyArn")]
+	if !found {
+		writeError(w, http.StatusNotFound, "NoSuchEntity", "policy "+r.Form.Get("PolicyArn")+" not found")
+	}
+	return policy, found
+}
+
+func attachmentSubject(action string, form url.Values) string {
+	switch {
+	case strings.Contains(action, "Role"):
+		return "role:" + form.Get("RoleName")
+	case strings.Contains(action, "Group"):
+		return "group:" + form.Get("GroupName")
+	}
+	return "user:" + form.Get("UserName")
+}
+
+func versionXml(policy *managedPolicy, version *policyVersion, withDocument bool) string {
+	document := ""
+	if withDocument {
+		document = "<Document>" + escape(url.QueryEscape(version.document)) + "</Document>"
+	}
+	return fmt.Sprintf("<VersionId>%s</VersionId><IsDefaultVersion>%t</IsDefaultVersion><CreateDate>%s</CreateDate>%s",
+		version.id, version.id == policy.defaultVersion, version.created.Format(time.RFC3339), document)
+}
+
+func entitiesXml(policy *managedPolicy) string {
+	var users, groups, roles strings.Builder
+	var subjects []string
+	for subject := range policy.attachments {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	for _, subject := range subjects {
+		kind, name, _ := strings.Cut(subject, ":")
+		switch kind {
+		case "user":
+			fmt.Fprintf(&users, "<member><UserName>%s</UserName></member>", name)
+		case "group":
+			fmt.Fprintf(&groups, "<member><GroupName>%s</GroupName></member>", name)
+		default:
+			fmt.Fprintf(&roles, "<member><RoleName>%s</RoleName></member>", name)
+		}
+	}
+	return fmt.Sprintf("<PolicyUsers>%s</PolicyUsers><PolicyGroups>%s</PolicyGroups><PolicyRoles>%s</PolicyRoles>", users.String(), groups.String(), roles.String())
+}
+
+func escape(value string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
+
+func writeResult(w http.ResponseWriter, action string, result string) {
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = fmt.Fprintf(w, `<%sResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/"><%sResult>%s</%sResult><ResponseMetadata><RequestId>request-id</RequestId></ResponseMetadata></%sResponse>`,
+		action, action, result, action, action)
+}
+
+func writeNoResult(w http.ResponseWriter, action string) {
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = fmt.Fprintf(w, `<%sResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/"><ResponseMetadata><RequestId>request-id</RequestId></ResponseMetadata></%sResponse>`, action, action)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<ErrorResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/"><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>request-id</RequestId></ErrorResponse>`,
+		code, escape(message))
+}
@@ -1,12 +1,14 @@
 package awsapigwProvider
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/rar"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 	"github.com/hexa-org/policy-mapper/providers/aws/awsapigwProvider/dynamodbpolicy"
 	"github.com/hexa-org/policy-mapper/providers/aws/awscognito"
@@ -20,6 +22,8 @@ type AwsApiGatewayProvider struct {
 	cognitoClientOverride  awscognito.CognitoClient
 	policyStoreSvcOverride dynamodbpolicy.PolicyStoreSvc
 	hasOverrides           bool
+	idqlStorage            bool
+	idqlStoreSvcOverride   dynamodbpolicy.IdqlPolicyStoreSvc
 }
 
 type AwsApiGatewayProviderOpt func(provider *AwsApiGatewayProvider)
@@ -53,12 +57,38 @@ func (a *AwsApiGatewayProvider) Name() string {
 	return ProviderTypeAwsApiGW
 }
 
+/*
+Capabilities reports that API Gateway policies are resource/action/role (RAR) assignments of roles to HTTP methods of a
+resource. With the v2 storage schema (WithIdqlStorage), complete IDQL policies are stored.
+*/
+func (a *AwsApiGatewayProvider) Capabilities() policyprovider.Capabilities {
+	if a.idqlStorage {
+		return policyprovider.Capabilities{
+			Conditions:      true,
+			DenyConditions:  true,
+			Scopes:          true,
+			Wildcards:       true,
+			MultipleActions: true,
+			Objects:         true,
+		}
+	}
+	return policyprovider.Capabilities{
+		MultipleActions: true,
+		Objects:         true,
+		ActionTypes:     []string{rar.ActionUriPrefix},
+	}
+}
+
 func (a *AwsApiGatewayProvider) DiscoverApplications(integrationInfo policyprovider.IntegrationInfo) (apps []policyprovider.ApplicationInfo, err error) {
+	return a.DiscoverApplicationsContext(context.Background(), integrationInfo)
+}
+
+func (a *AwsApiGatewayProvider) DiscoverApplicationsContext(ctx context.Context, integrationInfo policyprovider.IntegrationInfo) (apps []policyprovider.ApplicationInfo, err error) {
 	log.Info("AwsApiGatewayProvider.DiscoverApplications", "info.Name", integrationInfo.Name, "a.Name", a.Name())
 	if !strings.EqualFold(integrationInfo.Name, a.Name()) {
 		return []policyprovider.ApplicationInfo{}, errors.New("integration instance name and credential name do not match")
 	}
-	service, err := a.getProviderService(integrationInfo.Key)
+	service, err := a.getProviderService(ctx, integrationInfo.Key)
 	if err != nil {
 		log.Error("AwsApiGatewayProvider.DiscoverApplications", "getProviderService err", err)
 		return []policyprovider.ApplicationInfo{}, err
@@ -68,7 +98,14 @@ func (a *AwsApiGatewayProvider) DiscoverApplications(integrationInfo policyprovi
 }
 
 func (a *AwsApiGatewayProvider) GetPolicyInfo(info policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
-	service, err := a.getProviderService(info.Key)
+	return a.GetPolicyInfoContext(context.Background(), info, appInfo)
+}
+
+func (a *AwsApiGatewayProvider) GetPolicyInfoContext(ctx context.Context, info policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	if a.idqlStorage {
+		return a.getIdqlPolicies(ctx, info, appInfo)
+	}
+	service, err := a.getProviderService(ctx, info.Key)
 	if err != nil {
 		log.Error("AwsApiGatewayProvider.GetPolicyInfo", "getProviderService err", err)
 		return []hexapolicy.PolicyInfo{}, err
@@ -77,6 +114,10 @@ func (a *AwsApiGatewayProvider) GetPolicyInfo(info policyprovider.IntegrationInf
 }
 
 func (a *AwsApiGatewayProvider) SetPolicyInfo(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (status int, foundErr error) {
+	return a.SetPolicyInfoContext(context.Background(), info, applicationInfo, policyInfos)
+}
+
+func (a *AwsApiGatewayProvider) SetPolicyInfoContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (status int, foundErr error) {
 	validate := validator.New()
 	err := validate.Struct(applicationInfo)
 	if err != nil {
@@ -87,7 +128,10 @@ func (a *AwsApiGatewayProvider) SetPolicyInfo(info policyprovider.IntegrationInf
 		return http.StatusInternalServerError, err
 	}
 
-	service, err := a.getProviderService(info.Key)
+	if a.idqlStorage {
+		return a.setIdqlPolicies(ctx, info, applicationInfo, policyInfos)
+	}
+	service, err := a.getProviderService(ctx, info.Key)
 	if err != nil {
 		log.Error("AwsApiGatewayProvider.SetPolicyInfo", "getProviderService err", err)
 		return http.StatusBadGateway, nil
@@ -96,7 +140,38 @@ func (a *AwsApiGatewayProvider) SetPolicyInfo(info policyprovider.IntegrationInf
 	return service.SetPolicyInfo(applicationInfo, policyInfos)
 }
 
-func (a *AwsApiGatewayProvider) getProviderService(key []byte) (*AwsApiGatewayProviderService, error) {
+/*
+MapPolicyReport reports how policyInfos are represented by the provider (see policyprovider.MappingReporter). With the v2
+storage schema, policies are stored unchanged. Otherwise, policies are compared with the resource action roles stored for
+the application, but none are changed.
+*/
+func (a *AwsApiGatewayProvider) MapPolicyReport(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+	return a.MapPolicyReportContext(context.Background(), info, applicationInfo, policyInfos)
+}
+
+// MapPolicyReportContext is MapPolicyReport where the resource action roles are read with ctx
+func (a *AwsApiGatewayProvider) MapPolicyReportContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+	if a.idqlStorage {
+		report := hexapolicy.NewMappingReport(a.Name())
+		for i, policyInfo := range policyInfos {
+			report.ExactPolicy(i, policyInfo)
+		}
+		return report, nil
+	}
+	service, err := a.getProviderService(ctx, info.Key)
+	if err != nil {
+		return nil, err
+	}
+	rarList, err := service.policySvc.GetResourceRoles()
+	if err != nil {
+		return nil, err
+	}
+	_, report := rar.CalcResourceActionRolesForUpdateReport(rarList, policyInfos)
+	report.Target = a.Name()
+	return report, nil
+}
+
+func (a *AwsApiGatewayProvider) getProviderService(ctx context.Context, key []byte) (*AwsApiGatewayProviderService, error) {
 	var cognitoClient awscognito.CognitoClient
 	var policyStoreSvc dynamodbpolicy.PolicyStoreSvc
 	var err error
@@ -105,16 +180,16 @@ func (a *AwsApiGatewayProvider) getProviderService(key []byte) (*AwsApiGatewayPr
 		cognitoClient = a.cognitoClientOverride
 		policyStoreSvc = a.policyStoreSvcOverride
 	} else {
-		cognitoClient, err = awscognito.NewCognitoClient(key, awscommon.AWSClientOptions{})
+		cognitoClient, err = awscognito.NewCognitoClientContext(ctx, key, awscommon.AWSClientOptions{})
 		if err != nil {
 			return nil, err
 		}
-		dynamodbClient, err := dynamodbpolicy.NewDynamodbClient(key, awscommon.AWSClientOptions{})
+		dynamodbClient, err := dynamodbpolicy.NewDynamodbClientContext(ctx, key, awscommon.AWSClientOptions{})
 		if err != nil {
 			return nil, err
 		}
 
-		policyStoreSvc = dynamodbpolicy.NewPolicyStoreSvc(dynamodbClient)
+		policyStoreSvc = dynamodbpolicy.NewPolicyStoreSvcContext(ctx, dynamodbClient)
 	}
 
 	return NewAwsApiGatewayProviderService(cognitoClient, policyStoreSvc), nil
@@ -5,6 +5,7 @@ import (
     "net/http"
     "testing"
 
+    "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
     "github.com/hexa-org/policy-mapper/api/policyprovider"
     "github.com/hexa-org/policy-mapper/models/rar"
     "github.com/hexa-org/policy-mapper/models/rar/testsupport/awstestsupport"
@@ -29,6 +30,26 @@ func (m *mockCognitoClient) GetGroups(_ string) (map[string]string, error) {
     panic("GetGroups not implemented")
 }
 
+func (m *mockCognitoClient) ListGroups(_ string) ([]types.GroupType, error) {
+    panic("ListGroups not implemented")
+}
+
+func (m *mockCognitoClient) CreateGroup(_, _, _ string) error {
+    panic("CreateGroup not implemented")
+}
+
+func (m *mockCognitoClient) UpdateGroupDescription(_ types.GroupType, _ string) error {
+    panic("UpdateGroupDescription not implemented")
+}
+
+func (m *mockCognitoClient) ListAppClients(_ string) ([]types.UserPoolClientType, error) {
+    panic("ListAppClients not implemented")
+}
+
+func (m *mockCognitoClient) GetResourceServerScopes(_, _ string) ([]string, error) {
+    panic("GetResourceServerScopes not implemented")
+}
+
 func (m *mockCognitoClient) GetMembersAssignedTo(_ policyprovider.ApplicationInfo, _ string) ([]string, error) {
     panic("GetMembersAssignedTo not implemented")
 }
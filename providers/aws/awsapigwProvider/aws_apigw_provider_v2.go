@@ -1 +1,181 @@
 package awsapigwProvider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/rar"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/providers/aws/awsapigwProvider/dynamodbpolicy"
+	"github.com/hexa-org/policy-mapper/providers/aws/awscommon"
+)
+
+/*
+WithIdqlStorage selects the v2 storage schema, where complete IDQL policies (including conditions, deny rules and scopes)
+are stored in dynamodbpolicy.AwsIdqlPolicyTableName instead of as resource/action/role (RAR) items.
+*/
+func WithIdqlStorage() AwsApiGatewayProviderOpt {
+	return func(provider *AwsApiGatewayProvider) {
+		provider.idqlStorage = true
+	}
+}
+
+// WithIdqlStoreSvcOverride selects the v2 storage schema using idqlStoreSvc
+func WithIdqlStoreSvcOverride(idqlStoreSvc dynamodbpolicy.IdqlPolicyStoreSvc) AwsApiGatewayProviderOpt {
+	return func(provider *AwsApiGatewayProvider) {
+		provider.idqlStorage = true
+		provider.idqlStoreSvcOverride = idqlStoreSvc
+	}
+}
+
+// IdqlPapId returns the partition of the v2 policy table holding the policies of an application (a user pool resource server)
+func IdqlPapId(appInfo policyprovider.ApplicationInfo) string {
+	if appInfo.Service == "" {
+		return appInfo.ObjectID
+	}
+	return appInfo.ObjectID + "|" + appInfo.Service
+}
+
+func (a *AwsApiGatewayProvider) getIdqlStoreSvc(ctx context.Context, key []byte) (dynamodbpolicy.IdqlPolicyStoreSvc, error) {
+	if a.idqlStoreSvcOverride != nil {
+		return a.idqlStoreSvcOverride, nil
+	}
+	dynamodbClient, err := dynamodbpolicy.NewDynamodbClientContext(ctx, key, awscommon.AWSClientOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return dynamodbpolicy.NewIdqlPolicyStoreSvcContext(ctx, dynamodbClient), nil
+}
+
+func (a *AwsApiGatewayProvider) getIdqlPolicies(ctx context.Context, info policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	store, err := a.getIdqlStoreSvc(ctx, info.Key)
+	if err != nil {
+		return []hexapolicy.PolicyInfo{}, err
+	}
+	return store.GetPolicies(IdqlPapId(appInfo))
+}
+
+/*
+setIdqlPolicies reconciles policyInfos with the stored policies and applies the differences. An updated policy whose
+Meta.Etag is set must match the stored etag, i.e. the caller must have read the current version of the policy, otherwise
+409 Conflict is returned and nothing is written. Each write is also conditional on the stored etag, so a policy changed by
+another writer in the meantime causes a 409 Conflict.
+*/
+func (a *AwsApiGatewayProvider) setIdqlPolicies(ctx context.Context, info policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+	store, err := a.getIdqlStoreSvc(ctx, info.Key)
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+	papId := IdqlPapId(appInfo)
+	existing, err := store.GetPolicies(papId)
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+
+	callerEtags := make(map[string]string, len(policyInfos))
+	for _, policy := range policyInfos {
+		if policy.Meta.PolicyId != nil && policy.Meta.Etag != "" {
+			callerEtags[*policy.Meta.PolicyId] = policy.Meta.Etag
+		}
+	}
+
+	existingPolicies := hexapolicy.Policies{Policies: existing}
+	difs := existingPolicies.ReconcilePoliciesWithScopes(policyInfos, true)
+	for _, dif := range difs {
+		if dif.Type != hexapolicy.ChangeTypeUpdate {
+			continue
+		}
+		exist := dif.PolicyExist[0]
+		if etag, ok := callerEtags[*exist.Meta.PolicyId]; ok && etag != exist.Meta.Etag {
+			return http.StatusConflict, fmt.Errorf("%w: %s", dynamodbpolicy.ErrPolicyModified, *exist.Meta.PolicyId)
+		}
+	}
+
+	for _, dif := range difs {
+		switch dif.Type {
+		case hexapolicy.ChangeTypeNew:
+			_, err = store.PutPolicy(papId, *dif.PolicyCompare, "")
+		case hexapolicy.ChangeTypeUpdate:
+			exist := dif.PolicyExist[0]
+			update := *dif.PolicyCompare
+			update.Meta.PolicyId = exist.Meta.PolicyId
+			update.Meta.Created = exist.Meta.Created
+			etag := exist.Meta.Etag
+			if callerEtag, ok := callerEtags[*exist.Meta.PolicyId]; ok {
+				etag = callerEtag
+			}
+			_, err = store.PutPolicy(papId, update, etag)
+		case hexapolicy.ChangeTypeDelete:
+			exist := dif.PolicyExist[0]
+			err = store.DeletePolicy(papId, *exist.Meta.PolicyId, exist.Meta.Etag)
+		}
+		if err != nil {
+			if errors.Is(err, dynamodbpolicy.ErrPolicyModified) {
+				return http.StatusConflict, err
+			}
+			return http.StatusBadGateway, err
+		}
+	}
+	return http.StatusCreated, nil
+}
+
+// Reconcile compares the stored policies (in either storage schema) with comparePolicies
+func (a *AwsApiGatewayProvider) Reconcile(info policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+	return a.ReconcileContext(context.Background(), info, appInfo, comparePolicies, diffsOnly)
+}
+
+func (a *AwsApiGatewayProvider) ReconcileContext(ctx context.Context, info policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+	existing, err := a.GetPolicyInfoContext(ctx, info, appInfo)
+	if err != nil {
+		return nil, err
+	}
+	existingPolicies := hexapolicy.Policies{Policies: existing}
+	return existingPolicies.ReconcilePoliciesWithScopes(comparePolicies, diffsOnly), nil
+}
+
+/*
+MigrateRarPolicies copies the policies of the RAR table (dynamodbpolicy.AwsPolicyStoreTableName) into the v2 policy table
+for appInfo. Each policy is given the id "<method> <resource>" so a migration can be repeated: policies that were
+already migrated are skipped. The number of policies migrated is returned.
+*/
+func (a *AwsApiGatewayProvider) MigrateRarPolicies(info policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo) (int, error) {
+	return a.MigrateRarPoliciesContext(context.Background(), info, appInfo)
+}
+
+// MigrateRarPoliciesContext is MigrateRarPolicies where the DynamoDB requests are made with ctx
+func (a *AwsApiGatewayProvider) MigrateRarPoliciesContext(ctx context.Context, info policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo) (int, error) {
+	service, err := a.getProviderService(ctx, info.Key)
+	if err != nil {
+		return 0, err
+	}
+	rarList, err := service.policySvc.GetResourceRoles()
+	if err != nil {
+		return 0, err
+	}
+	store, err := a.getIdqlStoreSvc(ctx, info.Key)
+	if err != nil {
+		return 0, err
+	}
+
+	papId := IdqlPapId(appInfo)
+	migrated := 0
+	for _, policy := range rar.BuildPolicies(rarList) {
+		method := strings.TrimPrefix(string(policy.Actions[0]), rar.ActionUriPrefix)
+		policyId := fmt.Sprintf("%s %s", method, policy.Object)
+		policy.Meta.PolicyId = &policyId
+		policy.Meta.ProviderType = ProviderTypeAwsApiGW
+		_, err = store.PutPolicy(papId, policy, "")
+		if errors.Is(err, dynamodbpolicy.ErrPolicyModified) {
+			continue // already migrated
+		}
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
@@ -1 +1,303 @@
-package awsapigwProvider
+package awsapigwProvider_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/models/rar/testsupport/awstestsupport"
+	"github.com/hexa-org/policy-mapper/models/rar/testsupport/policytestsupport"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/providers/aws/awsapigwProvider"
+	"github.com/hexa-org/policy-mapper/providers/aws/awsapigwProvider/dynamodbpolicy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// memoryIdqlStore is an IdqlPolicyStoreSvc that checks etags as the DynamoDB conditional writes do
+type memoryIdqlStore struct {
+	policies map[string]map[string]hexapolicy.PolicyInfo
+	nextId   int
+	puts     int
+	deletes  int
+}
+
+func newMemoryIdqlStore() *memoryIdqlStore {
+	return &memoryIdqlStore{policies: make(map[string]map[string]hexapolicy.PolicyInfo)}
+}
+
+func (m *memoryIdqlStore) GetPolicies(papId string) ([]hexapolicy.PolicyInfo, error) {
+	res := make([]hexapolicy.PolicyInfo, 0)
+	for _, policy := range m.policies[papId] {
+		res = append(res, policy)
+	}
+	return res, nil
+}
+
+func (m *memoryIdqlStore) PutPolicy(papId string, policy hexapolicy.PolicyInfo, etag string) (hexapolicy.PolicyInfo, error) {
+	if m.policies[papId] == nil {
+		m.policies[papId] = make(map[string]hexapolicy.PolicyInfo)
+	}
+	if policy.Meta.PolicyId == nil {
+		m.nextId++
+		id := fmt.Sprintf("policy%d", m.nextId)
+		policy.Meta.PolicyId = &id
+	}
+	existing, exists := m.policies[papId][*policy.Meta.PolicyId]
+	if (etag == "" && exists) || (etag != "" && (!exists || existing.Meta.Etag != etag)) {
+		return policy, fmt.Errorf("%w: %s", dynamodbpolicy.ErrPolicyModified, *policy.Meta.PolicyId)
+	}
+	policy.CalculateEtag()
+	m.policies[papId][*policy.Meta.PolicyId] = policy
+	m.puts++
+	return policy, nil
+}
+
+func (m *memoryIdqlStore) DeletePolicy(papId, policyId, etag string) error {
+	existing, exists := m.policies[papId][policyId]
+	if !exists || existing.Meta.Etag != etag {
+		return fmt.Errorf("%w: %s", dynamodbpolicy.ErrPolicyModified, policyId)
+	}
+	delete(m.policies[papId], policyId)
+	m.deletes++
+	return nil
+}
+
+func conditionPolicy(object string, rule string) hexapolicy.PolicyInfo {
+	return hexapolicy.PolicyInfo{
+		Meta:      hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects:  []string{"role:hr"},
+		Actions:   []hexapolicy.ActionInfo{"http:GET"},
+		Object:    hexapolicy.ObjectInfo(object),
+		Condition: &conditions.ConditionInfo{Rule: rule, Action: conditions.AAllow},
+	}
+}
+
+func TestAwsApiGatewayProvider_IdqlStorage_Capabilities(t *testing.T) {
+	p := awsapigwProvider.NewAwsApiGatewayProvider(awsapigwProvider.WithIdqlStorage())
+	capabilities := p.Capabilities()
+	assert.True(t, capabilities.Conditions)
+	assert.True(t, capabilities.DenyConditions)
+	assert.True(t, capabilities.Scopes)
+	assert.Empty(t, capabilities.ActionTypes)
+
+	assert.False(t, awsapigwProvider.NewAwsApiGatewayProvider().Capabilities().Conditions)
+}
+
+func TestAwsApiGatewayProvider_IdqlStorage_SetAndGet(t *testing.T) {
+	store := newMemoryIdqlStore()
+	p := awsapigwProvider.NewAwsApiGatewayProvider(awsapigwProvider.WithIdqlStoreSvcOverride(store))
+	info := awstestsupport.IntegrationInfo(awsapigwProvider.ProviderTypeAwsApiGW)
+	appInfo := awstestsupport.AppInfo()
+
+	status, err := p.SetPolicyInfo(info, appInfo, []hexapolicy.PolicyInfo{
+		conditionPolicy("/humanresources/us", "req.ip sw 10.1"),
+		conditionPolicy("/profile", "subject.type eq user"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Len(t, store.policies[awsapigwProvider.IdqlPapId(appInfo)], 2)
+
+	policies, err := p.GetPolicyInfo(info, appInfo)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+	for _, policy := range policies {
+		assert.NotNil(t, policy.Condition)
+		assert.NotNil(t, policy.Meta.PolicyId)
+	}
+
+	// change one policy and remove the other
+	var update hexapolicy.PolicyInfo
+	for _, policy := range policies {
+		if policy.Object == "/profile" {
+			update = policy
+		}
+	}
+	update.Condition = &conditions.ConditionInfo{Rule: "subject.type eq admin", Action: conditions.AAllow}
+	store.puts = 0
+	status, err = p.SetPolicyInfo(info, appInfo, []hexapolicy.PolicyInfo{update})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, 1, store.puts)
+	assert.Equal(t, 1, store.deletes)
+
+	policies, _ = p.GetPolicyInfo(info, appInfo)
+	assert.Len(t, policies, 1)
+	assert.Equal(t, *update.Meta.PolicyId, *policies[0].Meta.PolicyId)
+	assert.Equal(t, "subject.type eq admin", policies[0].Condition.Rule)
+}
+
+// conflictStore simulates another writer changing a policy between the read and the write
+type conflictStore struct {
+	*memoryIdqlStore
+}
+
+func (c conflictStore) GetPolicies(papId string) ([]hexapolicy.PolicyInfo, error) {
+	policies, err := c.memoryIdqlStore.GetPolicies(papId)
+	for _, policy := range c.memoryIdqlStore.policies[papId] {
+		policy.Meta.Etag = "changed-by-another-writer"
+		c.memoryIdqlStore.policies[papId][*policy.Meta.PolicyId] = policy
+	}
+	return policies, err
+}
+
+func TestAwsApiGatewayProvider_IdqlStorage_Conflict(t *testing.T) {
+	store := newMemoryIdqlStore()
+	appInfo := awstestsupport.AppInfo()
+	_, _ = store.PutPolicy(awsapigwProvider.IdqlPapId(appInfo), conditionPolicy("/profile", "subject.type eq user"), "")
+
+	p := awsapigwProvider.NewAwsApiGatewayProvider(awsapigwProvider.WithIdqlStoreSvcOverride(conflictStore{store}))
+	info := awstestsupport.IntegrationInfo(awsapigwProvider.ProviderTypeAwsApiGW)
+	status, err := p.SetPolicyInfo(info, appInfo, []hexapolicy.PolicyInfo{})
+	assert.Equal(t, http.StatusConflict, status)
+	assert.ErrorIs(t, err, dynamodbpolicy.ErrPolicyModified)
+}
+
+func TestAwsApiGatewayProvider_Reconcile(t *testing.T) {
+	store := newMemoryIdqlStore()
+	appInfo := awstestsupport.AppInfo()
+	papId := awsapigwProvider.IdqlPapId(appInfo)
+	hr, _ := store.PutPolicy(papId, conditionPolicy("/humanresources/us", "req.ip sw 10.1"), "")
+	profile, _ := store.PutPolicy(papId, conditionPolicy("/profile", "subject.type eq user"), "")
+
+	p := awsapigwProvider.NewAwsApiGatewayProvider(awsapigwProvider.WithIdqlStoreSvcOverride(store))
+	info := awstestsupport.IntegrationInfo(awsapigwProvider.ProviderTypeAwsApiGW)
+
+	profile.Condition = &conditions.ConditionInfo{Rule: "subject.type eq admin", Action: conditions.AAllow}
+	difs, err := p.Reconcile(info, appInfo, []hexapolicy.PolicyInfo{hr, profile, conditionPolicy("/developer", "subject.type eq dev")}, false)
+	assert.NoError(t, err)
+	difTypes := make(map[string]int)
+	for _, dif := range difs {
+		difTypes[dif.Type]++
+	}
+	assert.Equal(t, map[string]int{hexapolicy.ChangeTypeEqual: 1, hexapolicy.ChangeTypeUpdate: 1, hexapolicy.ChangeTypeNew: 1}, difTypes)
+
+	difs, err = p.Reconcile(info, appInfo, []hexapolicy.PolicyInfo{hr}, true)
+	assert.NoError(t, err)
+	assert.Len(t, difs, 1)
+	assert.Equal(t, hexapolicy.ChangeTypeDelete, difs[0].Type)
+}
+
+func TestAwsApiGatewayProvider_Reconcile_RarStorage(t *testing.T) {
+	policyStoreSvc := &mockPolicyStoreSvc{}
+	existingActionRoles := map[string][]string{
+		policytestsupport.ActionGetHrUs:    {"some-hr-role"},
+		policytestsupport.ActionGetProfile: {"some-profile-role"},
+	}
+	policyStoreSvc.expectGetResourceRoles(policytestsupport.MakeRarList(existingActionRoles), nil)
+
+	p := awsapigwProvider.NewAwsApiGatewayProvider(awsapigwProvider.WithPolicyStoreSvcOverride(policyStoreSvc))
+	info := awstestsupport.IntegrationInfo(awsapigwProvider.ProviderTypeAwsApiGW)
+	existing, err := p.GetPolicyInfo(info, awstestsupport.AppInfo())
+	assert.NoError(t, err)
+
+	difs, err := p.Reconcile(info, awstestsupport.AppInfo(), existing[0:1], true)
+	assert.NoError(t, err)
+	assert.Len(t, difs, 1)
+	assert.Equal(t, hexapolicy.ChangeTypeDelete, difs[0].Type)
+}
+
+func TestAwsApiGatewayProvider_MapPolicyReport(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{
+		conditionPolicy(policytestsupport.ResourceHrUs, "subject.common_name eq \"alice\""),
+		conditionPolicy("/payroll", ""),
+	}
+	policies[1].Condition = nil
+	info := awstestsupport.IntegrationInfo(awsapigwProvider.ProviderTypeAwsApiGW)
+
+	policyStoreSvc := &mockPolicyStoreSvc{}
+	policyStoreSvc.expectGetResourceRoles(policytestsupport.MakeRarList(map[string][]string{policytestsupport.ActionGetHrUs: {"some-hr-role"}}), nil)
+	p := awsapigwProvider.NewAwsApiGatewayProvider(awsapigwProvider.WithPolicyStoreSvcOverride(policyStoreSvc))
+	report, err := p.MapPolicyReport(info, awstestsupport.AppInfo(), policies)
+	assert.NoError(t, err)
+	assert.Equal(t, awsapigwProvider.ProviderTypeAwsApiGW, report.Target)
+	issues := report.Issues()
+	assert.Len(t, issues, 3)
+	assert.Contains(t, issues[0], "policy 0: CONDITION DROPPED")
+	assert.Contains(t, issues[1], "policy 1: ACTION DROPPED - no existing resource action matches http:GET /payroll")
+	policyStoreSvc.AssertNotCalled(t, "UpdateResourceRole", mock.Anything)
+
+	p = awsapigwProvider.NewAwsApiGatewayProvider(awsapigwProvider.WithIdqlStoreSvcOverride(newMemoryIdqlStore()))
+	report, err = p.MapPolicyReportContext(context.Background(), info, awstestsupport.AppInfo(), policies)
+	assert.NoError(t, err)
+	assert.False(t, report.IsLossy(), "the v2 storage schema stores complete IDQL policies")
+	assert.Len(t, report.Policies, 2)
+}
+
+func TestAwsApiGatewayProvider_MigrateRarPolicies(t *testing.T) {
+	policyStoreSvc := &mockPolicyStoreSvc{}
+	existingActionRoles := map[string][]string{
+		policytestsupport.ActionGetHrUs:    {"some-hr-role"},
+		policytestsupport.ActionGetProfile: {"some-profile-role"},
+	}
+	policyStoreSvc.expectGetResourceRoles(policytestsupport.MakeRarList(existingActionRoles), nil)
+	store := newMemoryIdqlStore()
+
+	p := awsapigwProvider.NewAwsApiGatewayProvider(
+		awsapigwProvider.WithPolicyStoreSvcOverride(policyStoreSvc),
+		awsapigwProvider.WithIdqlStoreSvcOverride(store))
+	info := awstestsupport.IntegrationInfo(awsapigwProvider.ProviderTypeAwsApiGW)
+	appInfo := awstestsupport.AppInfo()
+
+	migrated, err := p.MigrateRarPolicies(info, appInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, migrated)
+
+	policies, err := p.GetPolicyInfo(info, appInfo)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+	stored := store.policies[awsapigwProvider.IdqlPapId(appInfo)]
+	assert.Equal(t, hexapolicy.SubjectInfo{"some-profile-role"}, stored["GET /profile"].Subjects)
+	assert.Equal(t, hexapolicy.SubjectInfo{"some-hr-role"}, stored["GET /humanresources/us"].Subjects)
+
+	// repeating the migration skips the policies already migrated
+	migrated, err = p.MigrateRarPoliciesContext(context.Background(), info, appInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, migrated)
+}
+
+func TestAwsApiGatewayProvider_IdqlStorage_StaleCallerEtag(t *testing.T) {
+	store := newMemoryIdqlStore()
+	appInfo := awstestsupport.AppInfo()
+	papId := awsapigwProvider.IdqlPapId(appInfo)
+	_, _ = store.PutPolicy(papId, conditionPolicy("/profile", "subject.type eq user"), "")
+	_, _ = store.PutPolicy(papId, conditionPolicy("/humanresources/us", "req.ip sw 10.1"), "")
+
+	p := awsapigwProvider.NewAwsApiGatewayProvider(awsapigwProvider.WithIdqlStoreSvcOverride(store))
+	info := awstestsupport.IntegrationInfo(awsapigwProvider.ProviderTypeAwsApiGW)
+	policies, err := p.GetPolicyInfo(info, appInfo)
+	assert.NoError(t, err)
+	var read hexapolicy.PolicyInfo
+	for _, policy := range policies {
+		if policy.Object == "/profile" {
+			read = policy
+		}
+	}
+
+	// another writer changes the policy after it was read
+	changed := read
+	changed.Condition = &conditions.ConditionInfo{Rule: "subject.type eq service", Action: conditions.AAllow}
+	_, err = store.PutPolicy(papId, changed, read.Meta.Etag)
+	assert.NoError(t, err)
+
+	store.puts = 0
+	update := read
+	update.Condition = &conditions.ConditionInfo{Rule: "subject.type eq admin", Action: conditions.AAllow}
+	status, err := p.SetPolicyInfo(info, appInfo, []hexapolicy.PolicyInfo{update})
+	assert.Equal(t, http.StatusConflict, status)
+	assert.ErrorIs(t, err, dynamodbpolicy.ErrPolicyModified)
+	assert.Equal(t, 0, store.puts)
+	assert.Equal(t, 0, store.deletes)
+	assert.Len(t, store.policies[papId], 2)
+	assert.Equal(t, "subject.type eq service", store.policies[papId][*read.Meta.PolicyId].Condition.Rule)
+
+	// without an etag the caller's policy replaces the stored one
+	update.Meta.Etag = ""
+	status, err = p.SetPolicyInfo(info, appInfo, []hexapolicy.PolicyInfo{update})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "subject.type eq admin", store.policies[papId][*read.Meta.PolicyId].Condition.Rule)
+}
@@ -12,6 +12,9 @@ import (
 type DynamodbClient interface {
 	Scan(ctx context.Context, params *ddb.ScanInput, optFns ...func(*ddb.Options)) (*ddb.ScanOutput, error)
 	UpdateItem(ctx context.Context, params *ddb.UpdateItemInput, optFns ...func(*ddb.Options)) (*ddb.UpdateItemOutput, error)
+	Query(ctx context.Context, params *ddb.QueryInput, optFns ...func(*ddb.Options)) (*ddb.QueryOutput, error)
+	PutItem(ctx context.Context, params *ddb.PutItemInput, optFns ...func(*ddb.Options)) (*ddb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *ddb.DeleteItemInput, optFns ...func(*ddb.Options)) (*ddb.DeleteItemOutput, error)
 }
 
 type dynamodbClient struct {
@@ -19,7 +22,12 @@ type dynamodbClient struct {
 }
 
 func NewDynamodbClient(key []byte, opt awscommon.AWSClientOptions) (DynamodbClient, error) {
-	cfg, err := awscommon.GetAwsClientConfig(key, opt)
+	return NewDynamodbClientContext(context.Background(), key, opt)
+}
+
+// NewDynamodbClientContext is NewDynamodbClient where ctx bounds the loading of the AWS configuration
+func NewDynamodbClientContext(ctx context.Context, key []byte, opt awscommon.AWSClientOptions) (DynamodbClient, error) {
+	cfg, err := awscommon.GetAwsClientConfigContext(ctx, key, opt)
 	if err != nil {
 		log.Error("NewDynamodbClient Failed to GetAwsClientConfig", "Error", err)
 		return nil, err
@@ -35,3 +43,15 @@ func (c *dynamodbClient) Scan(ctx context.Context, params *ddb.ScanInput, optFns
 func (c *dynamodbClient) UpdateItem(ctx context.Context, params *ddb.UpdateItemInput, optFns ...func(*ddb.Options)) (*ddb.UpdateItemOutput, error) {
 	return c.internal.UpdateItem(ctx, params, optFns...)
 }
+
+func (c *dynamodbClient) Query(ctx context.Context, params *ddb.QueryInput, optFns ...func(*ddb.Options)) (*ddb.QueryOutput, error) {
+	return c.internal.Query(ctx, params, optFns...)
+}
+
+func (c *dynamodbClient) PutItem(ctx context.Context, params *ddb.PutItemInput, optFns ...func(*ddb.Options)) (*ddb.PutItemOutput, error) {
+	return c.internal.PutItem(ctx, params, optFns...)
+}
+
+func (c *dynamodbClient) DeleteItem(ctx context.Context, params *ddb.DeleteItemInput, optFns ...func(*ddb.Options)) (*ddb.DeleteItemOutput, error) {
+	return c.internal.DeleteItem(ctx, params, optFns...)
+}
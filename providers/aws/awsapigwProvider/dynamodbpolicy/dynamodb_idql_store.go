@@ -0,0 +1,168 @@
+package dynamodbpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+
+	log "golang.org/x/exp/slog"
+)
+
+/*
+AwsIdqlPolicyTableName is the table of the v2 storage schema, which holds complete IDQL policies (including conditions
+and scopes). The table key is PapId (partition key) and PolicyId (sort key), both strings.
+*/
+var AwsIdqlPolicyTableName = "HexaPolicies"
+
+// IdqlSchemaVersion is the storage schema version recorded in each policy item
+const IdqlSchemaVersion = "2"
+
+// ErrPolicyModified is returned when a conditional write fails because the stored policy was changed (or created) since it was read
+var ErrPolicyModified = errors.New("policy was modified since it was read")
+
+// IdqlPolicyStoreSvc stores the IDQL policies of a PAP using the v2 storage schema
+type IdqlPolicyStoreSvc interface {
+	// GetPolicies returns the policies of papId. Each policy's Meta.Etag is the stored etag.
+	GetPolicies(papId string) ([]hexapolicy.PolicyInfo, error)
+	// PutPolicy creates a policy (etag is "") or replaces the policy whose stored etag is etag. A policy without a
+	// policy id is assigned one. The stored policy is returned.
+	PutPolicy(papId string, policy hexapolicy.PolicyInfo, etag string) (hexapolicy.PolicyInfo, error)
+	// DeletePolicy deletes the policy if its stored etag is etag
+	DeletePolicy(papId, policyId, etag string) error
+}
+
+type idqlPolicyItem struct {
+	PapId         string `dynamodbav:"PapId"`
+	PolicyId      string `dynamodbav:"PolicyId"`
+	Policy        string `dynamodbav:"Policy"`
+	Etag          string `dynamodbav:"Etag"`
+	SchemaVersion string `dynamodbav:"SchemaVersion"`
+}
+
+type idqlPolicyStoreSvc struct {
+	client DynamodbClient
+	ctx    context.Context
+}
+
+// NewIdqlPolicyStoreSvc returns an IdqlPolicyStoreSvc whose requests are made with context.Background (see
+// NewIdqlPolicyStoreSvcContext)
+func NewIdqlPolicyStoreSvc(client DynamodbClient) IdqlPolicyStoreSvc {
+	return NewIdqlPolicyStoreSvcContext(context.Background(), client)
+}
+
+// NewIdqlPolicyStoreSvcContext returns an IdqlPolicyStoreSvc whose requests are made with ctx
+func NewIdqlPolicyStoreSvcContext(ctx context.Context, client DynamodbClient) IdqlPolicyStoreSvc {
+	return &idqlPolicyStoreSvc{client: client, ctx: ctx}
+}
+
+func (s *idqlPolicyStoreSvc) GetPolicies(papId string) ([]hexapolicy.PolicyInfo, error) {
+	papIdVal, _ := attributevalue.Marshal(papId)
+	keyCondition := "PapId = :papId"
+	policies := make([]hexapolicy.PolicyInfo, 0)
+	var startKey map[string]types.AttributeValue
+	for {
+		input := &dynamodb.QueryInput{
+			TableName:                 &AwsIdqlPolicyTableName,
+			KeyConditionExpression:    &keyCondition,
+			ExpressionAttributeValues: map[string]types.AttributeValue{":papId": papIdVal},
+			ExclusiveStartKey:         startKey,
+		}
+		output, err := s.client.Query(s.ctx, input)
+		if err != nil {
+			log.Error("IdqlPolicyStoreSvc.GetPolicies", "Failed to Query table. Err=", err)
+			return nil, err
+		}
+
+		var items []idqlPolicyItem
+		if err = attributevalue.UnmarshalListOfMaps(output.Items, &items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			var policy hexapolicy.PolicyInfo
+			if err = json.Unmarshal([]byte(item.Policy), &policy); err != nil {
+				return nil, fmt.Errorf("invalid policy %s: %w", item.PolicyId, err)
+			}
+			policyId := item.PolicyId
+			policy.Meta.PolicyId = &policyId
+			policy.Meta.Etag = item.Etag
+			policies = append(policies, policy)
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return policies, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
+
+func (s *idqlPolicyStoreSvc) PutPolicy(papId string, policy hexapolicy.PolicyInfo, etag string) (hexapolicy.PolicyInfo, error) {
+	if policy.Meta.PolicyId == nil || *policy.Meta.PolicyId == "" {
+		policyId := uuid.New().String()
+		policy.Meta.PolicyId = &policyId
+	}
+	now := time.Now()
+	if policy.Meta.Created == nil {
+		policy.Meta.Created = &now
+	}
+	policy.Meta.Modified = &now
+	policy.Meta.PapId = &papId
+	policy.CalculateEtag()
+
+	policyBytes, err := json.Marshal(policy)
+	if err != nil {
+		return policy, err
+	}
+	item, err := attributevalue.MarshalMap(idqlPolicyItem{
+		PapId:         papId,
+		PolicyId:      *policy.Meta.PolicyId,
+		Policy:        string(policyBytes),
+		Etag:          policy.Meta.Etag,
+		SchemaVersion: IdqlSchemaVersion,
+	})
+	if err != nil {
+		return policy, err
+	}
+
+	input := &dynamodb.PutItemInput{TableName: &AwsIdqlPolicyTableName, Item: item}
+	if etag == "" {
+		input.ConditionExpression = aws.String("attribute_not_exists(PolicyId)")
+	} else {
+		etagVal, _ := attributevalue.Marshal(etag)
+		input.ConditionExpression = aws.String("Etag = :etag")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{":etag": etagVal}
+	}
+	_, err = s.client.PutItem(s.ctx, input)
+	return policy, conditionalError(*policy.Meta.PolicyId, err)
+}
+
+func (s *idqlPolicyStoreSvc) DeletePolicy(papId, policyId, etag string) error {
+	papIdVal, _ := attributevalue.Marshal(papId)
+	policyIdVal, _ := attributevalue.Marshal(policyId)
+	etagVal, _ := attributevalue.Marshal(etag)
+	input := &dynamodb.DeleteItemInput{
+		TableName:                 &AwsIdqlPolicyTableName,
+		Key:                       map[string]types.AttributeValue{"PapId": papIdVal, "PolicyId": policyIdVal},
+		ConditionExpression:       aws.String("Etag = :etag"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":etag": etagVal},
+	}
+	_, err := s.client.DeleteItem(s.ctx, input)
+	return conditionalError(policyId, err)
+}
+
+// conditionalError converts a failed write condition into ErrPolicyModified
+func conditionalError(policyId string, err error) error {
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return fmt.Errorf("%w: %s", ErrPolicyModified, policyId)
+	}
+	return err
+}
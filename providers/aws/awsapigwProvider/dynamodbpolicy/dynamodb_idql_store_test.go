@@ -0,0 +1,172 @@
+package dynamodbpolicy_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/providers/aws/awsapigwProvider/dynamodbpolicy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testPapId = "some-user-pool-id|https://some-resource-server"
+
+func idqlItem(policyId, etag string, policy hexapolicy.PolicyInfo) map[string]types.AttributeValue {
+	policyBytes, _ := json.Marshal(policy)
+	return map[string]types.AttributeValue{
+		"PapId":         &types.AttributeValueMemberS{Value: testPapId},
+		"PolicyId":      &types.AttributeValueMemberS{Value: policyId},
+		"Policy":        &types.AttributeValueMemberS{Value: string(policyBytes)},
+		"Etag":          &types.AttributeValueMemberS{Value: etag},
+		"SchemaVersion": &types.AttributeValueMemberS{Value: dynamodbpolicy.IdqlSchemaVersion},
+	}
+}
+
+func conditionalPolicy() hexapolicy.PolicyInfo {
+	var policy hexapolicy.PolicyInfo
+	_ = json.Unmarshal([]byte(`{
+  "meta": {"version": "0.7"},
+  "subjects": ["role:hr"],
+  "actions": ["http:GET"],
+  "object": "/humanresources/us",
+  "condition": {"rule": "req.ip sw 10.1", "action": "deny"}
+}`), &policy)
+	return policy
+}
+
+func TestIdqlPolicyStore_GetPolicies(t *testing.T) {
+	client := newMockDynamodbClient()
+	firstPage := &ddb.QueryOutput{
+		Items:            []map[string]types.AttributeValue{idqlItem("hr", "etag1", conditionalPolicy())},
+		LastEvaluatedKey: map[string]types.AttributeValue{"PapId": &types.AttributeValueMemberS{Value: testPapId}},
+	}
+	secondPage := &ddb.QueryOutput{
+		Items: []map[string]types.AttributeValue{idqlItem("profile", "etag2", hexapolicy.PolicyInfo{
+			Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+			Subjects: []string{"role:profile"},
+			Actions:  []hexapolicy.ActionInfo{"http:GET"},
+			Object:   "/profile",
+		})},
+	}
+	client.On("Query", context.Background(), mock.MatchedBy(func(input *ddb.QueryInput) bool { return input.ExclusiveStartKey == nil }), mock.Anything).
+		Return(firstPage, nil).Once()
+	client.On("Query", context.Background(), mock.MatchedBy(func(input *ddb.QueryInput) bool { return input.ExclusiveStartKey != nil }), mock.Anything).
+		Return(secondPage, nil).Once()
+
+	svc := dynamodbpolicy.NewIdqlPolicyStoreSvc(client)
+	policies, err := svc.GetPolicies(testPapId)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+	assert.Equal(t, "hr", *policies[0].Meta.PolicyId)
+	assert.Equal(t, "etag1", policies[0].Meta.Etag)
+	assert.NotNil(t, policies[0].Condition)
+	assert.Equal(t, "req.ip sw 10.1", policies[0].Condition.Rule)
+	assert.Equal(t, "profile", *policies[1].Meta.PolicyId)
+	client.AssertExpectations(t)
+}
+
+func TestIdqlPolicyStore_GetPolicies_Error(t *testing.T) {
+	client := newMockDynamodbClient()
+	client.On("Query", context.Background(), mock.Anything, mock.Anything).Return((*ddb.QueryOutput)(nil), errors.New("some error"))
+
+	svc := dynamodbpolicy.NewIdqlPolicyStoreSvc(client)
+	policies, err := svc.GetPolicies(testPapId)
+	assert.ErrorContains(t, err, "some error")
+	assert.Nil(t, policies)
+}
+
+func TestIdqlPolicyStore_PutPolicy_Create(t *testing.T) {
+	client := newMockDynamodbClient()
+	var input *ddb.PutItemInput
+	client.On("PutItem", context.Background(), mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { input = args.Get(1).(*ddb.PutItemInput) }).
+		Return(&ddb.PutItemOutput{}, nil)
+
+	svc := dynamodbpolicy.NewIdqlPolicyStoreSvc(client)
+	stored, err := svc.PutPolicy(testPapId, conditionalPolicy(), "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, *stored.Meta.PolicyId)
+	assert.NotEmpty(t, stored.Meta.Etag)
+	assert.Equal(t, testPapId, *stored.Meta.PapId)
+	assert.NotNil(t, stored.Meta.Created)
+
+	assert.Equal(t, dynamodbpolicy.AwsIdqlPolicyTableName, aws.ToString(input.TableName))
+	assert.Equal(t, "attribute_not_exists(PolicyId)", aws.ToString(input.ConditionExpression))
+	var etag, policyJson string
+	_ = attributevalue.Unmarshal(input.Item["Etag"], &etag)
+	_ = attributevalue.Unmarshal(input.Item["Policy"], &policyJson)
+	assert.Equal(t, stored.Meta.Etag, etag)
+	assert.Contains(t, policyJson, "req.ip sw 10.1")
+}
+
+func TestIdqlPolicyStore_PutPolicy_Update(t *testing.T) {
+	client := newMockDynamodbClient()
+	var input *ddb.PutItemInput
+	client.On("PutItem", context.Background(), mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { input = args.Get(1).(*ddb.PutItemInput) }).
+		Return(&ddb.PutItemOutput{}, nil)
+
+	policy := conditionalPolicy()
+	policyId := "hr"
+	policy.Meta.PolicyId = &policyId
+	svc := dynamodbpolicy.NewIdqlPolicyStoreSvc(client)
+	stored, err := svc.PutPolicy(testPapId, policy, "etag1")
+	assert.NoError(t, err)
+	assert.Equal(t, "hr", *stored.Meta.PolicyId)
+
+	assert.Equal(t, "Etag = :etag", aws.ToString(input.ConditionExpression))
+	var expectEtag string
+	_ = attributevalue.Unmarshal(input.ExpressionAttributeValues[":etag"], &expectEtag)
+	assert.Equal(t, "etag1", expectEtag)
+}
+
+func TestIdqlPolicyStore_PutPolicy_Modified(t *testing.T) {
+	client := newMockDynamodbClient()
+	client.On("PutItem", context.Background(), mock.Anything, mock.Anything).
+		Return((*ddb.PutItemOutput)(nil), &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")})
+
+	policy := conditionalPolicy()
+	policyId := "hr"
+	policy.Meta.PolicyId = &policyId
+	svc := dynamodbpolicy.NewIdqlPolicyStoreSvc(client)
+	_, err := svc.PutPolicy(testPapId, policy, "etag1")
+	assert.ErrorIs(t, err, dynamodbpolicy.ErrPolicyModified)
+	assert.EqualError(t, err, "policy was modified since it was read: hr")
+}
+
+func TestIdqlPolicyStore_DeletePolicy(t *testing.T) {
+	client := newMockDynamodbClient()
+	var input *ddb.DeleteItemInput
+	client.On("DeleteItem", context.Background(), mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { input = args.Get(1).(*ddb.DeleteItemInput) }).
+		Return(&ddb.DeleteItemOutput{}, nil)
+
+	svc := dynamodbpolicy.NewIdqlPolicyStoreSvc(client)
+	err := svc.DeletePolicy(testPapId, "hr", "etag1")
+	assert.NoError(t, err)
+
+	var papId, policyId string
+	_ = attributevalue.Unmarshal(input.Key["PapId"], &papId)
+	_ = attributevalue.Unmarshal(input.Key["PolicyId"], &policyId)
+	assert.Equal(t, testPapId, papId)
+	assert.Equal(t, "hr", policyId)
+	assert.Equal(t, "Etag = :etag", aws.ToString(input.ConditionExpression))
+}
+
+func TestIdqlPolicyStore_DeletePolicy_Modified(t *testing.T) {
+	client := newMockDynamodbClient()
+	client.On("DeleteItem", context.Background(), mock.Anything, mock.Anything).
+		Return((*ddb.DeleteItemOutput)(nil), &types.ConditionalCheckFailedException{})
+
+	svc := dynamodbpolicy.NewIdqlPolicyStoreSvc(client)
+	err := svc.DeletePolicy(testPapId, "hr", "etag1")
+	assert.ErrorIs(t, err, dynamodbpolicy.ErrPolicyModified)
+}
@@ -20,15 +20,21 @@ type PolicyStoreSvc interface {
 
 type policyStoreSvc struct {
 	client DynamodbClient
+	ctx    context.Context
 }
 
 func NewPolicyStoreSvc(client DynamodbClient) PolicyStoreSvc {
-	return &policyStoreSvc{client: client}
+	return NewPolicyStoreSvcContext(context.TODO(), client)
+}
+
+// NewPolicyStoreSvcContext returns a PolicyStoreSvc whose requests are made with ctx
+func NewPolicyStoreSvcContext(ctx context.Context, client DynamodbClient) PolicyStoreSvc {
+	return &policyStoreSvc{client: client, ctx: ctx}
 }
 
 func (p *policyStoreSvc) GetResourceRoles() ([]rar.ResourceActionRoles, error) {
 	input := &dynamodb.ScanInput{TableName: &AwsPolicyStoreTableName}
-	output, err := p.client.Scan(context.TODO(), input)
+	output, err := p.client.Scan(p.ctx, input)
 
 	if err != nil {
 		log.Error("PolicyStoreSvc.GetResourceRoles", "Failed to Scan table. Err=", err)
@@ -60,7 +66,7 @@ func (p *policyStoreSvc) UpdateResourceRole(rar rar.ResourceActionRoles) error {
 	}
 
 	// TODO - process output
-	_, err = p.client.UpdateItem(context.TODO(), input)
+	_, err = p.client.UpdateItem(p.ctx, input)
 	return err
 }
 
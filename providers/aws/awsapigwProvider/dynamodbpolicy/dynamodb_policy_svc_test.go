@@ -138,6 +138,21 @@ func (m *mockDynamodbClient) UpdateItem(ctx context.Context, params *ddb.UpdateI
 	return args.Get(0).(*ddb.UpdateItemOutput), args.Error(1)
 }
 
+func (m *mockDynamodbClient) Query(ctx context.Context, params *ddb.QueryInput, optFns ...func(*ddb.Options)) (*ddb.QueryOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*ddb.QueryOutput), args.Error(1)
+}
+
+func (m *mockDynamodbClient) PutItem(ctx context.Context, params *ddb.PutItemInput, optFns ...func(*ddb.Options)) (*ddb.PutItemOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*ddb.PutItemOutput), args.Error(1)
+}
+
+func (m *mockDynamodbClient) DeleteItem(ctx context.Context, params *ddb.DeleteItemInput, optFns ...func(*ddb.Options)) (*ddb.DeleteItemOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*ddb.DeleteItemOutput), args.Error(1)
+}
+
 func (m *mockDynamodbClient) expectScan(output *ddb.ScanOutput, err error) {
 	input := &ddb.ScanInput{TableName: &dynamodbpolicy.AwsPolicyStoreTableName}
 	m.On("Scan", context.TODO(), input, mock.AnythingOfType("[]func(*dynamodb.Options)")).
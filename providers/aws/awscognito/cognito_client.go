@@ -18,24 +18,38 @@ import (
 type CognitoClient interface {
 	ListUserPools() (apps []policyprovider.ApplicationInfo, err error)
 	GetGroups(userPoolId string) (map[string]string, error)
+	ListGroups(userPoolId string) ([]types.GroupType, error)
+	CreateGroup(userPoolId, groupName, description string) error
+	UpdateGroupDescription(group types.GroupType, description string) error
+	ListAppClients(userPoolId string) ([]types.UserPoolClientType, error)
+	GetResourceServerScopes(userPoolId, identifier string) ([]string, error)
 	GetMembersAssignedTo(appInfo policyprovider.ApplicationInfo, groupName string) ([]string, error)
 	SetGroupsAssignedTo(groupName string, members []string, applicationInfo policyprovider.ApplicationInfo) error
 }
 
 type cognitoClient struct {
 	client *cognitoidentityprovider.Client
+	ctx    context.Context
 }
 
 func NewCognitoClient(key []byte, opt awscommon.AWSClientOptions) (CognitoClient, error) {
-	client, err := newCognitoClient(key, opt)
+	return NewCognitoClientContext(context.Background(), key, opt)
+}
+
+/*
+NewCognitoClientContext returns a client whose requests are made with ctx, so that they are cancelled or time out with
+the operation the client was created for.
+*/
+func NewCognitoClientContext(ctx context.Context, key []byte, opt awscommon.AWSClientOptions) (CognitoClient, error) {
+	client, err := newCognitoClient(ctx, key, opt)
 	if err != nil {
 		return nil, err
 	}
-	return &cognitoClient{client: client}, nil
+	return &cognitoClient{client: client, ctx: ctx}, nil
 }
 
-func newCognitoClient(key []byte, opts awscommon.AWSClientOptions) (*cognitoidentityprovider.Client, error) {
-	cfg, err := awscommon.GetAwsClientConfig(key, opts)
+func newCognitoClient(ctx context.Context, key []byte, opts awscommon.AWSClientOptions) (*cognitoidentityprovider.Client, error) {
+	cfg, err := awscommon.GetAwsClientConfigContext(ctx, key, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -48,13 +62,13 @@ func (c *cognitoClient) ListUserPools() (apps []policyprovider.ApplicationInfo,
 	if listErr != nil {
 		return nil, listErr
 	}
-	for _, p := range pools.UserPools {
-		rsOutput, err := c.listResourceServers(*p.Id)
+	for _, p := range pools {
+		resourceServers, err := c.listResourceServers(*p.Id)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, rs := range rsOutput.ResourceServers {
+		for _, rs := range resourceServers {
 			apps = append(apps, policyprovider.ApplicationInfo{
 				ObjectID:    *rs.UserPoolId,
 				Name:        *rs.Name,
@@ -66,37 +80,157 @@ func (c *cognitoClient) ListUserPools() (apps []policyprovider.ApplicationInfo,
 	return apps, err
 }
 
-func (c *cognitoClient) listUserPools() (*cognitoidentityprovider.ListUserPoolsOutput, error) {
+func (c *cognitoClient) listUserPools() ([]types.UserPoolDescriptionType, error) {
 	maxRes := int32(20)
-	poolsInput := cognitoidentityprovider.ListUserPoolsInput{MaxResults: &maxRes}
-	pools, err := c.client.ListUserPools(context.Background(), &poolsInput)
-	return pools, err
+	var pools []types.UserPoolDescriptionType
+	var nextToken *string
+	for {
+		poolsInput := cognitoidentityprovider.ListUserPoolsInput{MaxResults: &maxRes, NextToken: nextToken}
+		output, err := c.client.ListUserPools(c.ctx, &poolsInput)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, output.UserPools...)
+		if aws.ToString(output.NextToken) == "" {
+			return pools, nil
+		}
+		nextToken = output.NextToken
+	}
 }
 
-func (c *cognitoClient) listResourceServers(userPoolId string) (*cognitoidentityprovider.ListResourceServersOutput, error) {
+func (c *cognitoClient) listResourceServers(userPoolId string) ([]types.ResourceServerType, error) {
 	maxRes := int32(10)
-	rsInput := cognitoidentityprovider.ListResourceServersInput{UserPoolId: &userPoolId, MaxResults: &maxRes}
-	rsOutput, err := c.client.ListResourceServers(context.Background(), &rsInput)
-	return rsOutput, err
+	var resourceServers []types.ResourceServerType
+	var nextToken *string
+	for {
+		rsInput := cognitoidentityprovider.ListResourceServersInput{UserPoolId: &userPoolId, MaxResults: &maxRes, NextToken: nextToken}
+		output, err := c.client.ListResourceServers(c.ctx, &rsInput)
+		if err != nil {
+			return nil, err
+		}
+		resourceServers = append(resourceServers, output.ResourceServers...)
+		if aws.ToString(output.NextToken) == "" {
+			return resourceServers, nil
+		}
+		nextToken = output.NextToken
+	}
 }
 
 func (c *cognitoClient) GetGroups(userPoolId string) (map[string]string, error) {
-	groupsInput := cognitoidentityprovider.ListGroupsInput{
-		UserPoolId: aws.String(userPoolId),
-	}
-	output, err := c.client.ListGroups(context.Background(), &groupsInput)
+	groupList, err := c.ListGroups(userPoolId)
 	if err != nil {
 		return nil, err
 	}
 
 	groups := make(map[string]string)
-	for _, g := range output.Groups {
+	for _, g := range groupList {
 		groups[aws.ToString(g.GroupName)] = aws.ToString(g.Description)
 	}
 
 	return groups, nil
 }
 
+// ListGroups returns all the groups of the user pool (including description, precedence and role)
+func (c *cognitoClient) ListGroups(userPoolId string) ([]types.GroupType, error) {
+	var groups []types.GroupType
+	var nextToken *string
+	for {
+		groupsInput := cognitoidentityprovider.ListGroupsInput{
+			UserPoolId: aws.String(userPoolId),
+			NextToken:  nextToken,
+		}
+		output, err := c.client.ListGroups(c.ctx, &groupsInput)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, output.Groups...)
+		if aws.ToString(output.NextToken) == "" {
+			return groups, nil
+		}
+		nextToken = output.NextToken
+	}
+}
+
+func (c *cognitoClient) CreateGroup(userPoolId, groupName, description string) error {
+	input := cognitoidentityprovider.CreateGroupInput{
+		GroupName:   aws.String(groupName),
+		UserPoolId:  aws.String(userPoolId),
+		Description: aws.String(description),
+	}
+	_, err := c.client.CreateGroup(c.ctx, &input)
+	return err
+}
+
+// UpdateGroupDescription replaces the description of group. The group's precedence and role are preserved
+// (UpdateGroup otherwise removes them).
+func (c *cognitoClient) UpdateGroupDescription(group types.GroupType, description string) error {
+	input := cognitoidentityprovider.UpdateGroupInput{
+		GroupName:   group.GroupName,
+		UserPoolId:  group.UserPoolId,
+		Description: aws.String(description),
+		Precedence:  group.Precedence,
+		RoleArn:     group.RoleArn,
+	}
+	_, err := c.client.UpdateGroup(c.ctx, &input)
+	return err
+}
+
+// ListAppClients returns the app clients of the user pool, including their allowed OAuth scopes
+func (c *cognitoClient) ListAppClients(userPoolId string) ([]types.UserPoolClientType, error) {
+	maxRes := int32(60)
+	var clients []types.UserPoolClientType
+	var nextToken *string
+	for {
+		listInput := cognitoidentityprovider.ListUserPoolClientsInput{
+			UserPoolId: aws.String(userPoolId),
+			MaxResults: &maxRes,
+			NextToken:  nextToken,
+		}
+		output, err := c.client.ListUserPoolClients(c.ctx, &listInput)
+		if err != nil {
+			return nil, err
+		}
+		for _, desc := range output.UserPoolClients {
+			describeInput := cognitoidentityprovider.DescribeUserPoolClientInput{
+				ClientId:   desc.ClientId,
+				UserPoolId: aws.String(userPoolId),
+			}
+			client, err := c.client.DescribeUserPoolClient(c.ctx, &describeInput)
+			if err != nil {
+				return nil, err
+			}
+			if client.UserPoolClient != nil {
+				clients = append(clients, *client.UserPoolClient)
+			}
+		}
+		if aws.ToString(output.NextToken) == "" {
+			return clients, nil
+		}
+		nextToken = output.NextToken
+	}
+}
+
+// GetResourceServerScopes returns the full names (<identifier>/<scope>) of the scopes defined by a resource server
+func (c *cognitoClient) GetResourceServerScopes(userPoolId, identifier string) ([]string, error) {
+	input := cognitoidentityprovider.DescribeResourceServerInput{
+		Identifier: aws.String(identifier),
+		UserPoolId: aws.String(userPoolId),
+	}
+	output, err := c.client.DescribeResourceServer(c.ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := make([]string, 0)
+	if output.ResourceServer == nil {
+		return scopes, nil
+	}
+	for _, scope := range output.ResourceServer.Scopes {
+		scopes = append(scopes, identifier+"/"+aws.ToString(scope.ScopeName))
+	}
+	return scopes, nil
+}
+
 func (c *cognitoClient) GetMembersAssignedTo(appInfo policyprovider.ApplicationInfo, groupName string) ([]string, error) {
 	tmpUserEmailMap, err := c.listUsersInGroup(groupName, appInfo.ObjectID)
 
@@ -146,22 +280,32 @@ func (c *cognitoClient) SetGroupsAssignedTo(groupName string, members []string,
 }
 
 func (c *cognitoClient) listUsersInGroup(groupName, userPoolId string) (map[string]string, error) {
-	input := cognitoidentityprovider.ListUsersInGroupInput{
-		GroupName:  aws.String(groupName),
-		UserPoolId: aws.String(userPoolId),
-	}
-	output, err := c.client.ListUsersInGroup(context.Background(), &input)
-	if err != nil {
-		return nil, err
+	var users []types.UserType
+	var nextToken *string
+	for {
+		input := cognitoidentityprovider.ListUsersInGroupInput{
+			GroupName:  aws.String(groupName),
+			UserPoolId: aws.String(userPoolId),
+			NextToken:  nextToken,
+		}
+		output, err := c.client.ListUsersInGroup(c.ctx, &input)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, output.Users...)
+		if aws.ToString(output.NextToken) == "" {
+			break
+		}
+		nextToken = output.NextToken
 	}
 
-	userEmailList := workflowsupport.ProcessAsync[string, types.UserType](output.Users, func(user types.UserType) (string, error) {
+	userEmailList := workflowsupport.ProcessAsync[string, types.UserType](users, func(user types.UserType) (string, error) {
 		userInput := cognitoidentityprovider.AdminGetUserInput{
 			UserPoolId: aws.String(userPoolId),
 			Username:   user.Username,
 		}
 
-		userInfo, err := c.client.AdminGetUser(context.Background(), &userInput)
+		userInfo, err := c.client.AdminGetUser(c.ctx, &userInput)
 		if err != nil {
 			log.Println("amazon_provider listUsersInGroup error calling AdminGetUser. error=", err)
 			return "", err
@@ -190,16 +334,21 @@ func (c *cognitoClient) listUsersInGroup(groupName, userPoolId string) (map[stri
 
 func (c *cognitoClient) getPrincipalIdFromEmail(appInfo policyprovider.ApplicationInfo, email string) (string, error) {
 	filter := fmt.Sprintf("email=\"%s\"", email)
-	listUserInput := cognitoidentityprovider.ListUsersInput{UserPoolId: &appInfo.ObjectID, Filter: &filter}
-	users, err := c.client.ListUsers(context.Background(), &listUserInput)
-	if err != nil {
-		return "", err
-	}
-	if len(users.Users) == 0 {
-		return "", errors.New("user not found for email=" + email)
+	var paginationToken *string
+	for {
+		listUserInput := cognitoidentityprovider.ListUsersInput{UserPoolId: &appInfo.ObjectID, Filter: &filter, PaginationToken: paginationToken}
+		users, err := c.client.ListUsers(c.ctx, &listUserInput)
+		if err != nil {
+			return "", err
+		}
+		if len(users.Users) > 0 {
+			return *users.Users[0].Username, nil
+		}
+		if aws.ToString(users.PaginationToken) == "" {
+			return "", errors.New("user not found for email=" + email)
+		}
+		paginationToken = users.PaginationToken
 	}
-
-	return *users.Users[0].Username, nil
 }
 
 func (c *cognitoClient) addUsersToGroup(appInfo policyprovider.ApplicationInfo, groupName string, toAdd []string) error {
@@ -210,7 +359,7 @@ func (c *cognitoClient) addUsersToGroup(appInfo policyprovider.ApplicationInfo,
 			Username:   &principalId,
 		}
 
-		_, err := c.client.AdminAddUserToGroup(context.Background(), &input)
+		_, err := c.client.AdminAddUserToGroup(c.ctx, &input)
 		if err != nil {
 			log.Println("Error adding user to group. User=", principalId, "group=", groupName, "Error=", err)
 			return err
@@ -227,7 +376,7 @@ func (c *cognitoClient) removeUsersFromGroup(appInfo policyprovider.ApplicationI
 			Username:   &principalId,
 		}
 
-		_, err := c.client.AdminRemoveUserFromGroup(context.Background(), &input)
+		_, err := c.client.AdminRemoveUserFromGroup(c.ctx, &input)
 		if err != nil {
 			log.Println("Error removing user from group. User=", principalId, "group=", groupName, "Error=", err)
 			return err
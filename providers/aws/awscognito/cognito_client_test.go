@@ -1,9 +1,14 @@
 package awscognito_test
 
 import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
 	"github.com/hexa-org/policy-mapper/models/rar/testsupport/awstestsupport"
 	"github.com/hexa-org/policy-mapper/models/rar/testsupport/cognitotestsupport"
+	"github.com/hexa-org/policy-mapper/models/rar/testsupport/policytestsupport"
 	"github.com/hexa-org/policy-mapper/providers/aws/awscognito"
 	"github.com/hexa-org/policy-mapper/providers/aws/awscommon"
 
@@ -65,6 +70,178 @@ func TestListUserPools_Success(t *testing.T) {
 
 }
 
+func TestListUserPools_Paging(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	firstPage, _ := json.Marshal(cognitoidentityprovider.ListUserPoolsOutput{
+		NextToken: aws.String("page2"),
+		UserPools: []types.UserPoolDescriptionType{{Id: aws.String("first-pool"), Name: aws.String("first-pool-name")}},
+	})
+	mockHttpClient.AddRequest(http.MethodPost, cognitotestsupport.CognitoApiUrl, "ListUserPools", http.StatusOK, firstPage)
+	mockHttpClient.MockListUserPools()
+	mockHttpClient.MockListResourceServers(cognitotestsupport.WithResourceServerOptions("first-pool", "first-server", "https://first-server"))
+	mockHttpClient.MockListResourceServers(cognitotestsupport.WithResourceServer())
+
+	client := cognitoClient(mockHttpClient)
+	pools, err := client.ListUserPools()
+	assert.NoError(t, err)
+	assert.Len(t, pools, 2)
+	assert.Equal(t, "first-pool", pools[0].ObjectID)
+	assert.Equal(t, awstestsupport.TestUserPoolId, pools[1].ObjectID)
+	assert.True(t, mockHttpClient.VerifyCalled())
+
+	var secondReq cognitoidentityprovider.ListUserPoolsInput
+	_ = json.Unmarshal(mockHttpClient.GetRequestBodyByIndex(http.MethodPost, cognitotestsupport.CognitoApiUrl, "AWSCognitoIdentityProviderService.ListUserPools", 1), &secondReq)
+	assert.Equal(t, "page2", aws.ToString(secondReq.NextToken))
+}
+
+func TestListGroups_Paging(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	mockHttpClient.MockListGroupsPage("page2", cognitotestsupport.Group("admins", "Administrators"))
+	mockHttpClient.MockListGroupsPage("", cognitotestsupport.Group("readers", "Readers"))
+
+	client := cognitoClient(mockHttpClient)
+	groups, err := client.GetGroups(awstestsupport.TestUserPoolId)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"admins": "Administrators", "readers": "Readers"}, groups)
+	assert.True(t, mockHttpClient.VerifyCalled())
+}
+
+func TestListAppClients(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	mockHttpClient.MockListUserPoolClients("web-client", "mobile-client")
+	mockHttpClient.MockDescribeUserPoolClient("web-client", "https://some-resource-server/read")
+	mockHttpClient.MockDescribeUserPoolClient("mobile-client")
+
+	client := cognitoClient(mockHttpClient)
+	clients, err := client.ListAppClients(awstestsupport.TestUserPoolId)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 2)
+	assert.Equal(t, "web-client", aws.ToString(clients[0].ClientId))
+	assert.Equal(t, []string{"https://some-resource-server/read"}, clients[0].AllowedOAuthScopes)
+	assert.Empty(t, clients[1].AllowedOAuthScopes)
+	assert.True(t, mockHttpClient.VerifyCalled())
+}
+
+func TestListAppClients_Error(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	mockHttpClient.MockListUserPoolClientsWithHttpStatus(http.StatusBadRequest)
+
+	client := cognitoClient(mockHttpClient)
+	clients, err := client.ListAppClients(awstestsupport.TestUserPoolId)
+	assert.ErrorContains(t, err, "ListUserPoolClients")
+	assert.Nil(t, clients)
+}
+
+func TestGetResourceServerScopes(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	mockHttpClient.MockDescribeResourceServer("read", "write")
+
+	client := cognitoClient(mockHttpClient)
+	scopes, err := client.GetResourceServerScopes(awstestsupport.TestUserPoolId, awstestsupport.TestResourceServerIdentifier)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://some-resource-server/read", "https://some-resource-server/write"}, scopes)
+}
+
+func TestUpdateGroupDescription_KeepsPrecedenceAndRole(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	mockHttpClient.MockUpdateGroup()
+
+	group := cognitotestsupport.Group("admins", "Administrators")
+	group.Precedence = aws.Int32(3)
+	group.RoleArn = aws.String("arn:aws:iam::123456789012:role/admins")
+
+	client := cognitoClient(mockHttpClient)
+	err := client.UpdateGroupDescription(group, "new description")
+	assert.NoError(t, err)
+
+	var req cognitoidentityprovider.UpdateGroupInput
+	_ = json.Unmarshal(mockHttpClient.GetRequestBody(http.MethodPost, cognitotestsupport.CognitoApiUrl, "AWSCognitoIdentityProviderService.UpdateGroup"), &req)
+	assert.Equal(t, "new description", aws.ToString(req.Description))
+	assert.Equal(t, int32(3), aws.ToInt32(req.Precedence))
+	assert.Equal(t, "arn:aws:iam::123456789012:role/admins", aws.ToString(req.RoleArn))
+}
+
+func TestGetMembersAssignedTo_Paging(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	firstPage, _ := json.Marshal(cognitoidentityprovider.ListUsersInGroupOutput{
+		NextToken: aws.String("page2"),
+		Users:     []types.UserType{{Username: aws.String(policytestsupport.UserIdGetHrUs)}},
+	})
+	mockHttpClient.AddRequest(http.MethodPost, cognitotestsupport.CognitoApiUrl, "ListUsersInGroup", http.StatusOK, firstPage)
+	mockHttpClient.MockListUsersInGroup()
+	mockHttpClient.MockAdminGetUser(policytestsupport.UserIdGetHrUs, policytestsupport.UserEmailGetHrUs)
+
+	client := cognitoClient(mockHttpClient)
+	members, err := client.GetMembersAssignedTo(awstestsupport.AppInfo(), policytestsupport.ActionGetHrUs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user:" + policytestsupport.UserEmailGetHrUs}, members)
+	assert.True(t, mockHttpClient.VerifyCalled())
+}
+
+func TestSetGroupsAssignedTo_ListUsersInGroupError(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	mockHttpClient.MockListUsersInGroupWithHttpStatus(http.StatusBadRequest)
+
+	client := cognitoClient(mockHttpClient)
+	err := client.SetGroupsAssignedTo(policytestsupport.ActionGetHrUs, []string{"user:" + policytestsupport.UserEmailGetHrUs}, awstestsupport.AppInfo())
+	assert.ErrorContains(t, err, "ListUsersInGroup")
+	assert.ErrorContains(t, err, "error StatusCode: 400")
+}
+
+func TestSetGroupsAssignedTo_IgnoresNotFoundPrincipal(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	mockHttpClient.MockListUsersInGroup()
+	mockHttpClient.MockListUsers(policytestsupport.UserIdGetHrUs)
+	mockHttpClient.MockListUsers("")
+	mockHttpClient.MockAdminAddUserToGroup()
+
+	client := cognitoClient(mockHttpClient)
+	err := client.SetGroupsAssignedTo(policytestsupport.ActionGetHrUs, []string{
+		"user:" + policytestsupport.UserEmailGetHrUs,
+		"user:" + policytestsupport.UserEmailGetHrUsAndProfile,
+	}, awstestsupport.AppInfo())
+	assert.NoError(t, err)
+	assert.True(t, mockHttpClient.VerifyCalled())
+}
+
+func TestSetGroupsAssignedTo_AddUserToGroupError(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	mockHttpClient.MockListUsersInGroup()
+	mockHttpClient.MockListUsers(policytestsupport.UserIdGetHrUs)
+	mockHttpClient.MockAdminAddUserToGroupWithHttpStatus(http.StatusBadRequest)
+
+	client := cognitoClient(mockHttpClient)
+	err := client.SetGroupsAssignedTo(policytestsupport.ActionGetHrUs, []string{"user:" + policytestsupport.UserEmailGetHrUs}, awstestsupport.AppInfo())
+	assert.ErrorContains(t, err, "AdminAddUserToGroup")
+	assert.ErrorContains(t, err, "error StatusCode: 400")
+	assert.True(t, mockHttpClient.VerifyCalled())
+}
+
+func TestSetGroupsAssignedTo_RemoveUserFromGroupError(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	mockHttpClient.MockListUsersInGroup(policytestsupport.UserIdGetHrUs)
+	mockHttpClient.MockAdminGetUser(policytestsupport.UserIdGetHrUs, "random@email.io")
+	mockHttpClient.MockAdminRemoveUserFromGroupWithHttpStatus(http.StatusBadRequest)
+
+	client := cognitoClient(mockHttpClient)
+	err := client.SetGroupsAssignedTo(policytestsupport.ActionGetHrUs, []string{}, awstestsupport.AppInfo())
+	assert.ErrorContains(t, err, "AdminRemoveUserFromGroup")
+	assert.ErrorContains(t, err, "error StatusCode: 400")
+	assert.True(t, mockHttpClient.VerifyCalled())
+}
+
+func TestSetGroupsAssignedTo_NoneAddedOrRemoved(t *testing.T) {
+	mockHttpClient := cognitotestsupport.NewMockCognitoHTTPClient()
+	mockHttpClient.MockListUsersInGroup(policytestsupport.UserIdGetHrUs)
+	mockHttpClient.MockAdminGetUser(policytestsupport.UserIdGetHrUs, policytestsupport.UserEmailGetHrUs)
+	mockHttpClient.MockListUsers(policytestsupport.UserIdGetHrUs)
+
+	client := cognitoClient(mockHttpClient)
+	err := client.SetGroupsAssignedTo(policytestsupport.ActionGetHrUs, []string{"user:" + policytestsupport.UserEmailGetHrUs}, awstestsupport.AppInfo())
+	assert.NoError(t, err)
+	assert.True(t, mockHttpClient.VerifyCalled())
+}
+
 func cognitoClient(mockHttpClient *cognitotestsupport.MockCognitoHTTPClient) awscognito.CognitoClient {
 	info := awstestsupport.IntegrationInfo("amazon")
 	client, _ := awscognito.NewCognitoClient(info.Key, awscommon.AWSClientOptions{
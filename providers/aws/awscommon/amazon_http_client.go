@@ -1,14 +1,17 @@
 package awscommon
 
 import (
-    "bytes"
     "context"
-    "encoding/json"
     "net/http"
+    "os"
+    "strings"
+    "time"
 
     "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/config"
     awscredentials "github.com/aws/aws-sdk-go-v2/credentials"
+    "github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+    "github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 type AWSHttpClient interface {
@@ -18,20 +21,49 @@ type AWSHttpClient interface {
 type AWSClientOptions struct {
     HTTPClient   AWSHttpClient
     DisableRetry bool
+    // DenyLongLivedKeys rejects keys holding an access key without a session token (see also EnvDenyLongLivedKeys)
+    DenyLongLivedKeys bool
 }
 
+/*
+GetAwsClientConfig returns the configuration used by the AWS providers for the integration key (see CredentialsKey).
+Credentials are resolved in the following order:
+
+  - a static access key (with a session token for temporary credentials), or
+  - a named profile from the shared config and credentials files, or
+  - the default credential chain (environment, shared files, web identity and instance roles) when defaultChain is set.
+
+A key without any of these is rejected, unless it assumes a role with a web identity token (which needs no credentials).
+
+When the key has a roleArn, those credentials are used to assume the role (or, with webIdentityTokenFile, the role is
+assumed with the web identity token), and the role's credentials are refreshed as they expire.
+*/
 func GetAwsClientConfig(key []byte, opt AWSClientOptions) (aws.Config, error) {
-    var awsCredentials credentialsInfo
-    err := json.NewDecoder(bytes.NewReader(key)).Decode(&awsCredentials)
+    return GetAwsClientConfigContext(context.Background(), key, opt)
+}
+
+// GetAwsClientConfigContext is GetAwsClientConfig where ctx bounds the loading of the shared configuration and credentials
+func GetAwsClientConfigContext(ctx context.Context, key []byte, opt AWSClientOptions) (aws.Config, error) {
+    awsKey, err := DecodeCredentialsKey(key)
     if err != nil {
         return aws.Config{}, err
     }
+    denyLongLived := opt.DenyLongLivedKeys || strings.EqualFold(os.Getenv(EnvDenyLongLivedKeys), "true")
+    if err = awsKey.Validate(denyLongLived); err != nil {
+        return aws.Config{}, err
+    }
 
-    awsOptions := []func(options *config.LoadOptions) error{
-        config.WithCredentialsProvider(awscredentials.StaticCredentialsProvider{
-            Value: aws.Credentials{AccessKeyID: awsCredentials.AccessKeyID, SecretAccessKey: awsCredentials.SecretAccessKey},
-        }),
-        config.WithRegion(awsCredentials.Region),
+    var awsOptions []func(options *config.LoadOptions) error
+    if awsKey.Region != "" {
+        awsOptions = append(awsOptions, config.WithRegion(awsKey.Region))
+    }
+    switch {
+    case awsKey.AccessKeyID != "":
+        awsOptions = append(awsOptions, config.WithCredentialsProvider(awscredentials.StaticCredentialsProvider{
+            Value: aws.Credentials{AccessKeyID: awsKey.AccessKeyID, SecretAccessKey: awsKey.SecretAccessKey, SessionToken: awsKey.SessionToken},
+        }))
+    case awsKey.Profile != "":
+        awsOptions = append(awsOptions, config.WithSharedConfigProfile(awsKey.Profile))
     }
 
     if opt.HTTPClient != nil {
@@ -42,11 +74,36 @@ func GetAwsClientConfig(key []byte, opt AWSClientOptions) (aws.Config, error) {
         awsOptions = append(awsOptions, config.WithRetryer(func() aws.Retryer { return aws.NopRetryer{} }))
     }
 
-    return config.LoadDefaultConfig(context.Background(), awsOptions...)
+    cfg, err := config.LoadDefaultConfig(ctx, awsOptions...)
+    if err != nil || awsKey.RoleArn == "" {
+        return cfg, err
+    }
+
+    cfg.Credentials = aws.NewCredentialsCache(awsKey.roleProvider(sts.NewFromConfig(cfg)))
+    return cfg, nil
 }
 
-type credentialsInfo struct {
-    AccessKeyID     string `json:"accessKeyID"`
-    SecretAccessKey string `json:"secretAccessKey"`
-    Region          string `json:"region"`
+// roleProvider returns a provider of the credentials of the key's role, assumed using the STS client
+func (k CredentialsKey) roleProvider(client *sts.Client) aws.CredentialsProvider {
+    sessionName := k.RoleSessionName
+    if sessionName == "" {
+        sessionName = DefaultRoleSessionName
+    }
+    duration := time.Duration(k.DurationSeconds) * time.Second
+
+    if k.WebIdentityTokenFile != "" {
+        return stscreds.NewWebIdentityRoleProvider(client, k.RoleArn, stscreds.IdentityTokenFile(k.WebIdentityTokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+            o.RoleSessionName = sessionName
+            o.Duration = duration
+        })
+    }
+    return stscreds.NewAssumeRoleProvider(client, k.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+        o.RoleSessionName = sessionName
+        if k.ExternalId != "" {
+            o.ExternalID = aws.String(k.ExternalId)
+        }
+        if duration > 0 {
+            o.Duration = duration
+        }
+    })
 }
@@ -0,0 +1,83 @@
+package awscommon
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+)
+
+// EnvDenyLongLivedKeys when "true" causes integration keys holding long-lived access keys to be rejected
+const EnvDenyLongLivedKeys = "HEXA_AWS_DENY_LONG_LIVED_KEYS"
+
+// DefaultRoleSessionName is the session name used to assume a role when the key does not specify one
+const DefaultRoleSessionName = "hexa-policy-mapper"
+
+/*
+CredentialsKey is the integration key of the AWS providers. The key must select a source of credentials: an access key,
+a profile, the default credential chain (defaultChain), or a role assumed with a web identity token (see
+GetAwsClientConfig). For example, to assume a role using the default credential chain:
+
+    {
+      "region": "us-west-1",
+      "defaultChain": true,
+      "roleArn": "arn:aws:iam::123456789012:role/hexa",
+      "externalId": "hexa-external-id"
+    }
+*/
+type CredentialsKey struct {
+    AccessKeyID          string `json:"accessKeyID,omitempty"`
+    SecretAccessKey      string `json:"secretAccessKey,omitempty"`
+    SessionToken         string `json:"sessionToken,omitempty"`
+    Region               string `json:"region,omitempty"`
+    Profile              string `json:"profile,omitempty"`              // a profile in the shared config files (e.g. ~/.aws/config)
+    DefaultChain         bool   `json:"defaultChain,omitempty"`         // use the AWS default credential chain (environment, instance roles, etc.)
+    RoleArn              string `json:"roleArn,omitempty"`              // a role to assume with STS
+    ExternalId           string `json:"externalId,omitempty"`           // the external id required by the role's trust policy
+    RoleSessionName      string `json:"roleSessionName,omitempty"`      // defaults to DefaultRoleSessionName
+    DurationSeconds      int    `json:"durationSeconds,omitempty"`      // the duration of the role session (defaults to 15 minutes)
+    WebIdentityTokenFile string `json:"webIdentityTokenFile,omitempty"` // assume roleArn with an OIDC token (e.g. an EKS service account)
+}
+
+func DecodeCredentialsKey(key []byte) (CredentialsKey, error) {
+    var decoded CredentialsKey
+    err := json.NewDecoder(bytes.NewReader(key)).Decode(&decoded)
+    return decoded, err
+}
+
+/*
+Validate checks that the key's fields are consistent. When denyLongLived is true, access keys without a session token
+(i.e. IAM user keys) are rejected.
+*/
+func (k CredentialsKey) Validate(denyLongLived bool) error {
+    if (k.AccessKeyID == "") != (k.SecretAccessKey == "") {
+        return errors.New("aws key must have both accessKeyID and secretAccessKey")
+    }
+    if k.SessionToken != "" && k.AccessKeyID == "" {
+        return errors.New("aws key sessionToken requires accessKeyID and secretAccessKey")
+    }
+    if k.RoleArn == "" && (k.ExternalId != "" || k.RoleSessionName != "" || k.DurationSeconds != 0 || k.WebIdentityTokenFile != "") {
+        return errors.New("aws key externalId, roleSessionName, durationSeconds and webIdentityTokenFile require roleArn")
+    }
+    if k.WebIdentityTokenFile != "" && k.ExternalId != "" {
+        return errors.New("aws key externalId cannot be used with webIdentityTokenFile")
+    }
+    if k.DurationSeconds < 0 {
+        return errors.New("aws key durationSeconds must be positive")
+    }
+    sources := 0
+    for _, source := range []bool{k.AccessKeyID != "", k.Profile != "", k.DefaultChain} {
+        if source {
+            sources++
+        }
+    }
+    if sources > 1 {
+        return errors.New("aws key may have only one of accessKeyID, profile or defaultChain")
+    }
+    if sources == 0 && k.WebIdentityTokenFile == "" {
+        return errors.New("aws key requires accessKeyID, profile, defaultChain, or roleArn with webIdentityTokenFile")
+    }
+    if denyLongLived && k.AccessKeyID != "" && k.SessionToken == "" {
+        return errors.New("long-lived aws access keys are not permitted: use a sessionToken, profile, roleArn with webIdentityTokenFile, or defaultChain")
+    }
+    return nil
+}
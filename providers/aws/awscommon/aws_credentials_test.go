@@ -0,0 +1,159 @@
+package awscommon_test
+
+import (
+    "context"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/hexa-org/policy-mapper/models/rar/testsupport"
+    "github.com/hexa-org/policy-mapper/providers/aws/awscommon"
+    "github.com/stretchr/testify/assert"
+)
+
+const stsUrl = "https://sts.us-west-1.amazonaws.com/"
+
+func stsResponse(action string) []byte {
+    return []byte(`<` + action + `Response xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <` + action + `Result>
+    <Credentials>
+      <AccessKeyId>ASIAROLE</AccessKeyId>
+      <SecretAccessKey>roleSecret</SecretAccessKey>
+      <SessionToken>roleToken</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </` + action + `Result>
+</` + action + `Response>`)
+}
+
+func TestGetAwsClientConfig_StaticKey(t *testing.T) {
+    cfg, err := awscommon.GetAwsClientConfig([]byte(`{"accessKeyID": "ASIAKEY", "secretAccessKey": "secret", "sessionToken": "token", "region": "us-west-1"}`), awscommon.AWSClientOptions{DenyLongLivedKeys: true})
+    assert.NoError(t, err)
+    assert.Equal(t, "us-west-1", cfg.Region)
+
+    creds, err := cfg.Credentials.Retrieve(context.Background())
+    assert.NoError(t, err)
+    assert.Equal(t, "ASIAKEY", creds.AccessKeyID)
+    assert.Equal(t, "token", creds.SessionToken)
+}
+
+func TestGetAwsClientConfig_DenyLongLivedKeys(t *testing.T) {
+    key := []byte(`{"accessKeyID": "AKIAKEY", "secretAccessKey": "secret", "region": "us-west-1"}`)
+    _, err := awscommon.GetAwsClientConfig(key, awscommon.AWSClientOptions{})
+    assert.NoError(t, err)
+
+    _, err = awscommon.GetAwsClientConfig(key, awscommon.AWSClientOptions{DenyLongLivedKeys: true})
+    assert.ErrorContains(t, err, "long-lived aws access keys are not permitted")
+
+    t.Setenv(awscommon.EnvDenyLongLivedKeys, "true")
+    _, err = awscommon.GetAwsClientConfig(key, awscommon.AWSClientOptions{})
+    assert.ErrorContains(t, err, "long-lived aws access keys are not permitted")
+}
+
+func TestGetAwsClientConfig_Profile(t *testing.T) {
+    dir := t.TempDir()
+    configFile := filepath.Join(dir, "config")
+    credentialsFile := filepath.Join(dir, "credentials")
+    _ = os.WriteFile(configFile, []byte("[profile hexa]\nregion = us-east-2\n"), 0600)
+    _ = os.WriteFile(credentialsFile, []byte("[hexa]\naws_access_key_id = ASIAPROFILE\naws_secret_access_key = secret\naws_session_token = token\n"), 0600)
+    t.Setenv("AWS_CONFIG_FILE", configFile)
+    t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+
+    cfg, err := awscommon.GetAwsClientConfig([]byte(`{"profile": "hexa"}`), awscommon.AWSClientOptions{})
+    assert.NoError(t, err)
+    assert.Equal(t, "us-east-2", cfg.Region)
+    creds, err := cfg.Credentials.Retrieve(context.Background())
+    assert.NoError(t, err)
+    assert.Equal(t, "ASIAPROFILE", creds.AccessKeyID)
+
+    _, err = awscommon.GetAwsClientConfig([]byte(`{"profile": "missing"}`), awscommon.AWSClientOptions{})
+    assert.Error(t, err)
+}
+
+func TestGetAwsClientConfig_AssumeRole(t *testing.T) {
+    mockClient := testsupport.NewMockHTTPClient()
+    mockClient.AddRequest(http.MethodPost, stsUrl, http.StatusOK, stsResponse("AssumeRole"))
+
+    key := []byte(`{
+  "accessKeyID": "ASIAKEY",
+  "secretAccessKey": "secret",
+  "sessionToken": "token",
+  "region": "us-west-1",
+  "roleArn": "arn:aws:iam::123456789012:role/hexa",
+  "externalId": "anExternalId",
+  "durationSeconds": 1800
+}`)
+    cfg, err := awscommon.GetAwsClientConfig(key, awscommon.AWSClientOptions{HTTPClient: mockClient, DisableRetry: true})
+    assert.NoError(t, err)
+
+    creds, err := cfg.Credentials.Retrieve(context.Background())
+    assert.NoError(t, err)
+    assert.Equal(t, "ASIAROLE", creds.AccessKeyID)
+    assert.Equal(t, "roleToken", creds.SessionToken)
+
+    body := string(mockClient.GetRequestBodyByKey(http.MethodPost, stsUrl))
+    assert.Contains(t, body, "Action=AssumeRole")
+    assert.Contains(t, body, "ExternalId=anExternalId")
+    assert.Contains(t, body, "RoleSessionName="+awscommon.DefaultRoleSessionName)
+    assert.Contains(t, body, "DurationSeconds=1800")
+}
+
+func TestGetAwsClientConfig_WebIdentity(t *testing.T) {
+    tokenFile := filepath.Join(t.TempDir(), "token")
+    _ = os.WriteFile(tokenFile, []byte("anOidcToken"), 0600)
+
+    mockClient := testsupport.NewMockHTTPClient()
+    mockClient.AddRequest(http.MethodPost, stsUrl, http.StatusOK, stsResponse("AssumeRoleWithWebIdentity"))
+
+    key := []byte(`{
+  "region": "us-west-1",
+  "roleArn": "arn:aws:iam::123456789012:role/hexa",
+  "roleSessionName": "aSession",
+  "webIdentityTokenFile": "` + filepath.ToSlash(tokenFile) + `"
+}`)
+    cfg, err := awscommon.GetAwsClientConfig(key, awscommon.AWSClientOptions{HTTPClient: mockClient, DisableRetry: true, DenyLongLivedKeys: true})
+    assert.NoError(t, err)
+
+    creds, err := cfg.Credentials.Retrieve(context.Background())
+    assert.NoError(t, err)
+    assert.Equal(t, "ASIAROLE", creds.AccessKeyID)
+
+    body := string(mockClient.GetRequestBodyByKey(http.MethodPost, stsUrl))
+    assert.Contains(t, body, "Action=AssumeRoleWithWebIdentity")
+    assert.Contains(t, body, "WebIdentityToken=anOidcToken")
+    assert.Contains(t, body, "RoleSessionName=aSession")
+}
+
+func TestCredentialsKey_Validate(t *testing.T) {
+    tests := []struct {
+        key    string
+        errMsg string
+    }{
+        {`{"region": "us-west-1", "defaultChain": true}`, ""},
+        {`{"region": "us-west-1"}`, "requires accessKeyID, profile, defaultChain"},
+        {`{"region": "us-west-1", "roleArn": "r"}`, "requires accessKeyID, profile, defaultChain"},
+        {`{"region": "us-west-1", "roleArn": "r", "webIdentityTokenFile": "f"}`, ""},
+        {`{"profile": "p", "defaultChain": true}`, "only one of accessKeyID, profile or defaultChain"},
+        {`{"accessKeyID": "a", "region": "us-west-1"}`, "both accessKeyID and secretAccessKey"},
+        {`{"sessionToken": "t", "region": "us-west-1"}`, "sessionToken requires accessKeyID"},
+        {`{"accessKeyID": "a", "secretAccessKey": "s", "profile": "p"}`, "only one of accessKeyID, profile or defaultChain"},
+        {`{"externalId": "e"}`, "require roleArn"},
+        {`{"roleArn": "r", "webIdentityTokenFile": "f", "externalId": "e"}`, "externalId cannot be used with webIdentityTokenFile"},
+        {`{"roleArn": "r", "durationSeconds": -1}`, "durationSeconds must be positive"},
+    }
+    for _, test := range tests {
+        key, err := awscommon.DecodeCredentialsKey([]byte(test.key))
+        assert.NoError(t, err)
+        err = key.Validate(false)
+        if test.errMsg == "" {
+            assert.NoError(t, err, test.key)
+        } else {
+            assert.ErrorContains(t, err, test.errMsg, test.key)
+        }
+    }
+
+    _, err := awscommon.DecodeCredentialsKey([]byte("bad key"))
+    assert.True(t, err != nil && strings.Contains(err.Error(), "invalid character"))
+}
@@ -1,9 +1,14 @@
 package cognitoProvider
 
 import (
+    "context"
+    "fmt"
     "net/http"
+    "sort"
     "strings"
 
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
     "github.com/hexa-org/policy-mapper/api/policyprovider"
     "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
     "github.com/hexa-org/policy-mapper/providers/aws/awscognito"
@@ -14,20 +19,48 @@ import (
 
 const ProviderTypeAwsCognito string = "cognito"
 
+// SubjectPrefixRole is the subject prefix of a user pool group (e.g. role:admins)
+const SubjectPrefixRole = "role:"
+
+// SubjectPrefixUser is the subject prefix of a group member, identified by email (e.g. user:alice@example.com)
+const SubjectPrefixUser = "user:"
+
+/*
+CognitoProvider maps the groups of a user pool to IDQL policies for a resource server (the PAP). A policy grants the
+members of one or more groups (role:<group>) the resource server scopes (actions) of an app client (object), and lists
+the members of its group as user:<email> subjects. Group membership and the app client's allowed OAuth scopes are
+enforced by Cognito. The grant of scopes to a group is Hexa metadata stored in the group description (see groupGrants),
+which Cognito does not enforce.
+*/
 type CognitoProvider struct {
     AwsClientOpts awscommon.AWSClientOptions
+    CreateGroups  bool // CreateGroups causes SetPolicyInfo to create groups that do not exist in the user pool
 }
 
 func (a *CognitoProvider) Name() string {
     return ProviderTypeAwsCognito
 }
 
+// Capabilities reports that a policy grants groups (role:<group>) and their members (user:<email>) multiple scopes
+// (actions) of an app client (object)
+func (a *CognitoProvider) Capabilities() policyprovider.Capabilities {
+    return policyprovider.Capabilities{
+        MultipleActions: true,
+        Objects:         true,
+        SubjectTypes:    []string{SubjectPrefixRole, SubjectPrefixUser},
+    }
+}
+
 func (a *CognitoProvider) DiscoverApplications(info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
+    return a.DiscoverApplicationsContext(context.Background(), info)
+}
+
+func (a *CognitoProvider) DiscoverApplicationsContext(ctx context.Context, info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
     if !strings.EqualFold(info.Name, a.Name()) {
         return []policyprovider.ApplicationInfo{}, nil
     }
 
-    client, err := awscognito.NewCognitoClient(info.Key, a.AwsClientOpts)
+    client, err := awscognito.NewCognitoClientContext(ctx, info.Key, a.AwsClientOpts)
     if err != nil {
         return nil, err
     }
@@ -35,37 +68,60 @@ func (a *CognitoProvider) DiscoverApplications(info policyprovider.IntegrationIn
 }
 
 func (a *CognitoProvider) GetPolicyInfo(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
-    client, err := awscognito.NewCognitoClient(info.Key, a.AwsClientOpts)
+    return a.GetPolicyInfoContext(context.Background(), info, applicationInfo)
+}
+
+func (a *CognitoProvider) GetPolicyInfoContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+    client, err := awscognito.NewCognitoClientContext(ctx, info.Key, a.AwsClientOpts)
     if err != nil {
         return nil, err
     }
 
-    groups, err := client.GetGroups(applicationInfo.ObjectID)
+    groups, err := client.ListGroups(applicationInfo.ObjectID)
     if err != nil {
         return nil, err
     }
 
+    grants := existingGrants(groups, applicationInfo.Service)
+    if err = readMembers(client, applicationInfo, grants); err != nil {
+        return nil, err
+    }
     var policies []hexapolicy.PolicyInfo
-    for groupName := range groups {
-        members, err := client.GetMembersAssignedTo(applicationInfo, groupName)
-        if err != nil {
-            return nil, err
-        }
-        policies = append(policies, hexapolicy.PolicyInfo{
-            Meta: hexapolicy.MetaInfo{
-                Version:      hexapolicy.IdqlVersion,
-                ProviderType: ProviderTypeAwsCognito,
-            },
-            Actions:  []hexapolicy.ActionInfo{hexapolicy.ActionInfo(groupName)},
-            Subjects: members,
-            Object:   hexapolicy.ObjectInfo(applicationInfo.Name),
-        })
+    for _, g := range grants {
+        policies = append(policies, g.toPolicy(applicationInfo.ObjectID))
     }
 
     return policies, nil
 }
 
+// readMembers sets the members of each grant's group, reading the members of each group once
+func readMembers(client awscognito.CognitoClient, applicationInfo policyprovider.ApplicationInfo, grants []*grant) error {
+    members := make(map[string][]string)
+    for _, g := range grants {
+        groupMembers, read := members[g.group]
+        if !read {
+            var err error
+            if groupMembers, err = client.GetMembersAssignedTo(applicationInfo, g.group); err != nil {
+                return err
+            }
+            members[g.group] = groupMembers
+        }
+        g.addMembers(groupMembers...)
+    }
+    return nil
+}
+
+/*
+SetPolicyInfo replaces the resource server scopes granted to the user pool groups with those of policyInfos. Each scope
+must be defined by the resource server and allowed for the app client. A group that does not exist is an error unless
+CreateGroups is set. The members of a group are replaced by the user subjects of its policies; the members of a group
+whose policies have no user subjects are not changed. No changes are made when a policy cannot be applied.
+*/
 func (a *CognitoProvider) SetPolicyInfo(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+    return a.SetPolicyInfoContext(context.Background(), info, applicationInfo, policyInfos)
+}
+
+func (a *CognitoProvider) SetPolicyInfoContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
     validate := validator.New() // todo - move this up?
     err := validate.Struct(applicationInfo)
     if err != nil {
@@ -76,27 +132,221 @@ func (a *CognitoProvider) SetPolicyInfo(info policyprovider.IntegrationInfo, app
         return http.StatusInternalServerError, err
     }
 
-    client, err := awscognito.NewCognitoClient(info.Key, a.AwsClientOpts)
+    client, err := awscognito.NewCognitoClientContext(ctx, info.Key, a.AwsClientOpts)
     if err != nil {
         return http.StatusInternalServerError, err
     }
 
-    allGroups, err := client.GetGroups(applicationInfo.ObjectID)
+    groups, err := client.ListGroups(applicationInfo.ObjectID)
     if err != nil {
         return http.StatusInternalServerError, err
     }
-    for _, pol := range policyInfos {
-        groupName := string(pol.Actions[0])
-        _, exists := allGroups[groupName]
-        if !exists {
+    grants, err := mapPolicies(policyInfos, applicationInfo.Service)
+    if err != nil {
+        return http.StatusBadRequest, err
+    }
+    if len(grants) > 0 {
+        if err = a.validateGrants(client, applicationInfo, grants); err != nil {
+            return http.StatusBadRequest, err
+        }
+    }
+
+    groupScopes := make(map[string]map[string][]string)
+    for _, g := range grants {
+        if groupScopes[g.group] == nil {
+            groupScopes[g.group] = make(map[string][]string)
+        }
+        groupScopes[g.group][g.clientId] = g.scopes
+    }
+
+    // Determine all the group changes before making any
+    updates := make(map[string]string)
+    var updateGroups []types.GroupType
+    for _, group := range groups {
+        name := aws.ToString(group.GroupName)
+        groupGrants := parseGroupGrants(aws.ToString(group.Description))
+        changed := groupGrants.replaceScopes(applicationInfo.Service, groupScopes[name])
+        delete(groupScopes, name)
+        if !changed {
             continue
         }
+        desc, err := groupGrants.String()
+        if err != nil {
+            return http.StatusBadRequest, fmt.Errorf("group %s: %w", name, err)
+        }
+        updates[name] = desc
+        updateGroups = append(updateGroups, group)
+    }
 
-        err = client.SetGroupsAssignedTo(groupName, pol.Subjects, applicationInfo)
+    newGroups := make([]string, 0, len(groupScopes))
+    for name := range groupScopes {
+        newGroups = append(newGroups, name)
+    }
+    sort.Strings(newGroups)
+    creates := make(map[string]string, len(newGroups))
+    for _, name := range newGroups {
+        if !a.CreateGroups {
+            return http.StatusBadRequest, fmt.Errorf("group %s does not exist in user pool %s", name, applicationInfo.ObjectID)
+        }
+        desc, err := groupGrants{Grants: groupScopes[name]}.String()
         if err != nil {
+            return http.StatusBadRequest, fmt.Errorf("group %s: %w", name, err)
+        }
+        creates[name] = desc
+    }
+
+    for _, group := range updateGroups {
+        if err = client.UpdateGroupDescription(group, updates[aws.ToString(group.GroupName)]); err != nil {
+            return http.StatusInternalServerError, err
+        }
+    }
+    for _, name := range newGroups {
+        if err = client.CreateGroup(applicationInfo.ObjectID, name, creates[name]); err != nil {
+            return http.StatusInternalServerError, err
+        }
+    }
+
+    memberships := groupMembers(grants)
+    memberGroups := make([]string, 0, len(memberships))
+    for name := range memberships {
+        memberGroups = append(memberGroups, name)
+    }
+    sort.Strings(memberGroups)
+    for _, name := range memberGroups {
+        if err = client.SetGroupsAssignedTo(name, memberships[name], applicationInfo); err != nil {
             return http.StatusInternalServerError, err
         }
     }
 
     return http.StatusCreated, nil
 }
+
+// validateGrants checks that each granted scope is defined by the resource server and allowed for the app client
+func (a *CognitoProvider) validateGrants(client awscognito.CognitoClient, applicationInfo policyprovider.ApplicationInfo, grants []*grant) error {
+    scopes, err := client.GetResourceServerScopes(applicationInfo.ObjectID, applicationInfo.Service)
+    if err != nil {
+        return err
+    }
+    appClients, err := client.ListAppClients(applicationInfo.ObjectID)
+    if err != nil {
+        return err
+    }
+    allowedScopes := make(map[string][]string, len(appClients))
+    for _, appClient := range appClients {
+        allowedScopes[aws.ToString(appClient.ClientId)] = appClient.AllowedOAuthScopes
+    }
+
+    for _, g := range grants {
+        allowed, exists := allowedScopes[g.clientId]
+        if !exists {
+            return fmt.Errorf("app client %s not found in user pool %s", g.clientId, applicationInfo.ObjectID)
+        }
+        for _, scope := range g.scopes {
+            if !containsString(scopes, scope) {
+                return fmt.Errorf("scope %s is not defined by resource server %s", scope, applicationInfo.Service)
+            }
+            if !containsString(allowed, scope) {
+                return fmt.Errorf("scope %s is not allowed for app client %s", scope, g.clientId)
+            }
+        }
+    }
+    return nil
+}
+
+/*
+MapPolicyReport reports how policyInfos are represented as group grants of the scopes of the application's resource
+server (see policyprovider.MappingReporter). Cognito is not called, so scopes and app clients are not validated.
+*/
+func (a *CognitoProvider) MapPolicyReport(_ policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+    report := hexapolicy.NewMappingReport(a.Name())
+    reportPolicies(policyInfos, applicationInfo.Service, report)
+    return report, nil
+}
+
+// Reconcile compares the group grants of the user pool with comparePolicies. Differences are reported per group and app client.
+func (a *CognitoProvider) Reconcile(info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+    return a.ReconcileContext(context.Background(), info, applicationInfo, comparePolicies, diffsOnly)
+}
+
+func (a *CognitoProvider) ReconcileContext(ctx context.Context, info policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+    client, err := awscognito.NewCognitoClientContext(ctx, info.Key, a.AwsClientOpts)
+    if err != nil {
+        return nil, err
+    }
+    groups, err := client.ListGroups(applicationInfo.ObjectID)
+    if err != nil {
+        return nil, err
+    }
+    existGrants := existingGrants(groups, applicationInfo.Service)
+    compareGrants, err := mapPolicies(comparePolicies, applicationInfo.Service)
+    if err != nil {
+        return nil, err
+    }
+    if err = readMembers(client, applicationInfo, existGrants); err != nil {
+        return nil, err
+    }
+
+    existMap := make(map[string]*grant, len(existGrants))
+    for _, g := range existGrants {
+        existMap[g.key()] = g
+    }
+
+    userPoolId := applicationInfo.ObjectID
+    res := make([]hexapolicy.PolicyDif, 0)
+    for _, g := range compareGrants {
+        key := g.key()
+        comparePolicy := g.toPolicy(userPoolId)
+        existGrant, exists := existMap[key]
+        if !exists {
+            res = append(res, hexapolicy.PolicyDif{
+                Type:          hexapolicy.ChangeTypeNew,
+                PolicyId:      key,
+                PolicyCompare: &comparePolicy,
+            })
+            continue
+        }
+        delete(existMap, key)
+
+        existPolicy := existGrant.toPolicy(userPoolId)
+        var difTypes []string
+        if !existGrant.sameMembers(g) {
+            difTypes = append(difTypes, hexapolicy.CompareDifSubject)
+        }
+        if strings.Join(existGrant.scopes, " ") != strings.Join(g.scopes, " ") {
+            difTypes = append(difTypes, hexapolicy.CompareDifAction)
+        }
+        if len(difTypes) == 0 {
+            if !diffsOnly {
+                res = append(res, hexapolicy.PolicyDif{
+                    Type:          hexapolicy.ChangeTypeEqual,
+                    PolicyId:      key,
+                    DifTypes:      []string{hexapolicy.CompareEqual},
+                    PolicyExist:   []hexapolicy.PolicyInfo{existPolicy},
+                    PolicyCompare: &comparePolicy,
+                })
+            }
+            continue
+        }
+        res = append(res, hexapolicy.PolicyDif{
+            Type:          hexapolicy.ChangeTypeUpdate,
+            PolicyId:      key,
+            DifTypes:      difTypes,
+            PolicyExist:   []hexapolicy.PolicyInfo{existPolicy},
+            PolicyCompare: &comparePolicy,
+        })
+    }
+
+    // Remaining existing grants are implied deletes
+    for _, g := range existGrants {
+        if _, ok := existMap[g.key()]; !ok {
+            continue
+        }
+        existPolicy := g.toPolicy(userPoolId)
+        res = append(res, hexapolicy.PolicyDif{
+            Type:        hexapolicy.ChangeTypeDelete,
+            PolicyId:    g.key(),
+            PolicyExist: []hexapolicy.PolicyInfo{existPolicy},
+        })
+    }
+    return res, nil
+}
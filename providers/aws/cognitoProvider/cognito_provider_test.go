@@ -1,15 +1,19 @@
 package cognitoProvider_test
 
 import (
+    "encoding/json"
     "net/http"
     "testing"
 
+    "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+    "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
     "github.com/hexa-org/policy-mapper/api/policyprovider"
     "github.com/hexa-org/policy-mapper/models/rar/testsupport/awstestsupport"
     "github.com/hexa-org/policy-mapper/models/rar/testsupport/cognitotestsupport"
     "github.com/hexa-org/policy-mapper/models/rar/testsupport/policytestsupport"
     "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+    "github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
     "github.com/hexa-org/policy-mapper/providers/aws/awscommon"
     "github.com/hexa-org/policy-mapper/providers/aws/cognitoProvider"
 
@@ -98,37 +102,6 @@ func TestAmazonProvider_GetPolicyInfo_CognitoClientError(t *testing.T) {
     assert.Nil(t, policyInfo)
 }
 
-func TestAmazonProvider_GetPolicyInfo(t *testing.T) {
-    // TODO - investigate why this test is flaky. Something to do with the ProcessAsync call
-    t.Skip("Skip flaky test TestAmazonProvider_GetPolicyInfo")
-    mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
-    mockClient.MockListGroups(policytestsupport.ActionGetProfile, policytestsupport.ActionGetHrUs)
-    mockClient.MockListUsersInGroup(policytestsupport.UserIdGetProfile)
-    mockClient.MockAdminGetUser(policytestsupport.UserIdGetProfile, policytestsupport.UserEmailGetProfile)
-    mockClient.MockListUsersInGroup(policytestsupport.UserIdGetHrUs)
-    mockClient.MockAdminGetUser(policytestsupport.UserIdGetHrUs, policytestsupport.UserEmailGetHrUs)
-
-    p := cognitoProvider.CognitoProvider{
-        AwsClientOpts: awscommon.AWSClientOptions{
-            HTTPClient:   mockClient,
-            DisableRetry: true}}
-
-    info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
-    appInfo := awstestsupport.AppInfo()
-    actualPolicies, err := p.GetPolicyInfo(info, appInfo)
-    assert.NoError(t, err)
-    assert.NotEmpty(t, actualPolicies)
-    expActionMembers := map[string][]string{
-        policytestsupport.ActionGetProfile: {policytestsupport.UserEmailGetProfile},
-        policytestsupport.ActionGetHrUs:    {policytestsupport.UserEmailGetHrUs},
-    }
-
-    expPolicies := policytestsupport.MakePolicies(expActionMembers, awstestsupport.TestResourceServerName)
-    assert.Equal(t, len(expPolicies), len(actualPolicies))
-    assert.True(t, policytestsupport.ContainsPolicies(t, expPolicies, actualPolicies))
-    assert.True(t, mockClient.VerifyCalled())
-}
-
 func TestAmazonProvider_GetPolicyInfo_withListGroupsError(t *testing.T) {
     mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
 
@@ -221,220 +194,394 @@ func TestSetPolicyInfo_NoPoliciesInput(t *testing.T) {
     assert.Equal(t, http.StatusCreated, status)
 }
 
-func TestSetPolicyInfo_ListUsersInGroupError(t *testing.T) {
-    mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
-    expGroups := []string{policytestsupport.ActionGetProfile, policytestsupport.ActionGetHrUs}
-    mockClient.MockListGroups(expGroups...)
-    mockClient.MockListUsersInGroupWithHttpStatus(http.StatusBadRequest)
 
-    actionMemberMap := policytestsupport.MakeActionMembers()
+const testClientId = "web-client"
 
-    p := cognitoProvider.CognitoProvider{
+var (
+    scopeRead  = awstestsupport.TestResourceServerIdentifier + "/read"
+    scopeWrite = awstestsupport.TestResourceServerIdentifier + "/write"
+    scopeOther = "https://other-resource-server/read"
+)
+
+func grantsDescription(description string, grants map[string][]string) string {
+    desc, _ := json.Marshal(map[string]interface{}{"description": description, "grants": grants})
+    return string(desc)
+}
+
+func testProvider(mockClient *cognitotestsupport.MockCognitoHTTPClient) cognitoProvider.CognitoProvider {
+    return cognitoProvider.CognitoProvider{
         AwsClientOpts: awscommon.AWSClientOptions{
             HTTPClient:   mockClient,
             DisableRetry: true}}
-
-    info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
-    appInfo := awstestsupport.AppInfo()
-
-    expPolicies := policytestsupport.MakeTestPolicies(actionMemberMap)
-    _, err := p.SetPolicyInfo(info, appInfo, expPolicies)
-    assert.Error(t, err)
-    assert.ErrorContains(t, err, "ListUsersInGroup")
-    assert.ErrorContains(t, err, "error StatusCode: 400")
 }
 
-func TestSetPolicyInfo_IgnoresNotFoundPrincipal(t *testing.T) {
-    mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
-    expGroups := []string{policytestsupport.ActionGetHrUs}
-    mockClient.MockListGroups(expGroups...)
-
-    actionMemberMap := map[string]policytestsupport.ActionMembers{
-        policytestsupport.ActionGetHrUs: {
-            MemberIds: []string{policytestsupport.UserIdGetHrUs, ""},
-            Emails:    []string{policytestsupport.UserEmailGetHrUs, policytestsupport.UserEmailGetHrUsAndProfile},
-        },
+func grantPolicy(clientId string, scopes []string, groups ...string) hexapolicy.PolicyInfo {
+    policy := hexapolicy.PolicyInfo{
+        Meta:   hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+        Object: hexapolicy.ObjectInfo(clientId),
     }
-    for range actionMemberMap {
-        mockClient.MockListUsersInGroup()
+    for _, group := range groups {
+        policy.Subjects = append(policy.Subjects, cognitoProvider.SubjectPrefixRole+group)
     }
-
-    for _, actionMem := range actionMemberMap {
-        for _, principalId := range actionMem.MemberIds {
-            mockClient.MockListUsers(principalId)
-            if principalId != "" {
-                mockClient.MockAdminAddUserToGroup()
-            }
-        }
+    for _, scope := range scopes {
+        policy.Actions = append(policy.Actions, hexapolicy.ActionInfo(scope))
     }
+    return policy
+}
 
-    p := cognitoProvider.CognitoProvider{
-        AwsClientOpts: awscommon.AWSClientOptions{
-            HTTPClient:   mockClient,
-            DisableRetry: true}}
+// mockValidation mocks the resource server and app client calls made to validate grants to testClientId
+func mockValidation(mockClient *cognitotestsupport.MockCognitoHTTPClient, allowedScopes ...string) {
+    mockClient.MockDescribeResourceServer("read", "write")
+    mockClient.MockListUserPoolClients(testClientId)
+    mockClient.MockDescribeUserPoolClient(testClientId, allowedScopes...)
+}
+
+func updateGroupRequest(t *testing.T, mockClient *cognitotestsupport.MockCognitoHTTPClient, op string, index int) map[string]interface{} {
+    body := mockClient.GetRequestBodyByIndex(http.MethodPost, cognitotestsupport.CognitoApiUrl, "AWSCognitoIdentityProviderService."+op, index)
+    var req map[string]interface{}
+    assert.NoError(t, json.Unmarshal(body, &req))
+    return req
+}
+
+func TestAmazonProvider_Capabilities(t *testing.T) {
+    p := cognitoProvider.CognitoProvider{}
+    capabilities := p.Capabilities()
+    assert.True(t, capabilities.MultipleActions)
+    assert.True(t, capabilities.Objects)
+    assert.False(t, capabilities.Conditions)
+    assert.Equal(t, []string{cognitoProvider.SubjectPrefixRole, cognitoProvider.SubjectPrefixUser}, capabilities.SubjectTypes)
+}
+
+func TestAmazonProvider_GetPolicyInfo(t *testing.T) {
+    mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
+    mockClient.MockListGroupsPage("page2",
+        cognitotestsupport.Group("admins", grantsDescription("Administrators", map[string][]string{testClientId: {scopeWrite, scopeRead, scopeOther}})),
+        cognitotestsupport.Group("plain", "a group without grants"))
+    mockClient.MockListGroupsPage("",
+        cognitotestsupport.Group("readers", grantsDescription("", map[string][]string{testClientId: {scopeRead}, "other-client": {scopeOther}})))
+    mockClient.MockListUsersInGroup("alice")
+    mockClient.MockAdminGetUser("alice", "alice@example.com")
+    mockClient.MockListUsersInGroup()
 
+    p := testProvider(mockClient)
     info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
-    appInfo := awstestsupport.AppInfo()
-    expPolicies := policytestsupport.MakeTestPolicies(actionMemberMap)
-    _, err := p.SetPolicyInfo(info, appInfo, expPolicies)
+    policies, err := p.GetPolicyInfo(info, awstestsupport.AppInfo())
     assert.NoError(t, err)
     assert.True(t, mockClient.VerifyCalled())
+    assert.Len(t, policies, 2)
+
+    admins := policies[0]
+    assert.Equal(t, hexapolicy.SubjectInfo{"role:admins", "user:alice@example.com"}, admins.Subjects)
+    assert.Equal(t, []hexapolicy.ActionInfo{hexapolicy.ActionInfo(scopeRead), hexapolicy.ActionInfo(scopeWrite)}, admins.Actions)
+    assert.Equal(t, hexapolicy.ObjectInfo(testClientId), admins.Object)
+    assert.Equal(t, "admins/"+testClientId, *admins.Meta.PolicyId)
+    assert.Equal(t, awstestsupport.TestUserPoolId, *admins.Meta.PapId)
+    assert.Equal(t, cognitoProvider.ProviderTypeAwsCognito, admins.Meta.ProviderType)
+    assert.Equal(t, "admins", admins.Meta.SourceData["group"])
+
+    readers := policies[1]
+    assert.Equal(t, hexapolicy.SubjectInfo{"role:readers"}, readers.Subjects)
+    assert.Equal(t, []hexapolicy.ActionInfo{hexapolicy.ActionInfo(scopeRead)}, readers.Actions)
 }
 
-func TestSetPolicyInfo_AddUserToGroupError(t *testing.T) {
+func TestSetPolicyInfo_UpdatesGroupGrants(t *testing.T) {
     mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
-    expGroups := []string{policytestsupport.ActionGetProfile, policytestsupport.ActionGetHrUs}
-    mockClient.MockListGroups(expGroups...)
-
-    actionMemberMap := policytestsupport.MakeActionMembers()
-    mockClient.MockListUsersInGroup()
-    for _, principalId := range actionMemberMap[expGroups[0]].MemberIds {
-        mockClient.MockListUsers(principalId)
-    }
+    admins := cognitotestsupport.Group("admins", "Administrators")
+    admins.Precedence = aws.Int32(1)
+    admins.RoleArn = aws.String("arn:aws:iam::123456789012:role/admins")
+    mockClient.MockListGroupsPage("", admins,
+        cognitotestsupport.Group("readers", grantsDescription("Readers", map[string][]string{testClientId: {scopeRead, scopeOther}})),
+        cognitotestsupport.Group("plain", "a group without grants"))
+    mockValidation(mockClient, scopeRead, scopeWrite)
+    mockClient.MockUpdateGroup()
+    mockClient.MockUpdateGroup()
+
+    p := testProvider(mockClient)
+    info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
+    status, err := p.SetPolicyInfo(info, awstestsupport.AppInfo(), []hexapolicy.PolicyInfo{
+        grantPolicy(testClientId, []string{scopeWrite, scopeRead}, "admins"),
+    })
+    assert.NoError(t, err)
+    assert.Equal(t, http.StatusCreated, status)
+    assert.True(t, mockClient.VerifyCalled())
 
-    mockClient.MockAdminAddUserToGroupWithHttpStatus(http.StatusBadRequest)
+    adminsReq := updateGroupRequest(t, mockClient, "UpdateGroup", 0)
+    assert.Equal(t, "admins", adminsReq["GroupName"])
+    assert.Equal(t, float64(1), adminsReq["Precedence"])
+    assert.Equal(t, "arn:aws:iam::123456789012:role/admins", adminsReq["RoleArn"])
+    assert.Equal(t, grantsDescription("Administrators", map[string][]string{testClientId: {scopeRead, scopeWrite}}), adminsReq["Description"])
 
-    p := cognitoProvider.CognitoProvider{
-        AwsClientOpts: awscommon.AWSClientOptions{
-            HTTPClient:   mockClient,
-            DisableRetry: true}}
+    // grants of other resource servers are kept
+    readersReq := updateGroupRequest(t, mockClient, "UpdateGroup", 1)
+    assert.Equal(t, "readers", readersReq["GroupName"])
+    assert.Equal(t, grantsDescription("Readers", map[string][]string{testClientId: {scopeOther}}), readersReq["Description"])
+}
 
+func TestSetPolicyInfo_UpdatesGroupMembers(t *testing.T) {
+    mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
+    mockClient.MockListGroupsPage("",
+        cognitotestsupport.Group("readers", grantsDescription("Readers", map[string][]string{testClientId: {scopeRead}})),
+        cognitotestsupport.Group("writers", grantsDescription("Writers", map[string][]string{testClientId: {scopeWrite}})))
+    mockValidation(mockClient, scopeRead, scopeWrite)
+    mockClient.MockListUsersInGroup("bob")
+    mockClient.MockAdminGetUser("bob", "bob@example.com")
+    mockClient.MockListUsers("alice")
+    mockClient.MockAdminRemoveUserFromGroup()
+    mockClient.MockAdminAddUserToGroup()
+
+    p := testProvider(mockClient)
     info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
-    appInfo := awstestsupport.AppInfo()
-    expPolicies := policytestsupport.MakeTestPolicies(actionMemberMap)
-    stat, err := p.SetPolicyInfo(info, appInfo, expPolicies)
-    assert.Equal(t, http.StatusInternalServerError, stat)
-    assert.Error(t, err)
-    assert.ErrorContains(t, err, "AdminAddUserToGroup")
-    assert.ErrorContains(t, err, "error StatusCode: 400")
+    readers := grantPolicy(testClientId, []string{scopeRead}, "readers")
+    readers.Subjects = append(readers.Subjects, "user:alice@example.com")
+    status, err := p.SetPolicyInfo(info, awstestsupport.AppInfo(), []hexapolicy.PolicyInfo{
+        readers,
+        grantPolicy(testClientId, []string{scopeWrite}, "writers"), // the members of writers are not changed
+    })
+    assert.NoError(t, err)
+    assert.Equal(t, http.StatusCreated, status)
     assert.True(t, mockClient.VerifyCalled())
+
+    removeReq := updateGroupRequest(t, mockClient, "AdminRemoveUserFromGroup", 0)
+    assert.Equal(t, "readers", removeReq["GroupName"])
+    assert.Equal(t, "bob", removeReq["Username"])
+    addReq := updateGroupRequest(t, mockClient, "AdminAddUserToGroup", 0)
+    assert.Equal(t, "readers", addReq["GroupName"])
+    assert.Equal(t, "alice", addReq["Username"])
 }
 
-func TestSetPolicyInfo_RemoveUserFromGroupError(t *testing.T) {
+func TestSetPolicyInfo_RemovesAllGrants(t *testing.T) {
     mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
-    expGroups := []string{policytestsupport.ActionGetProfile, policytestsupport.ActionGetHrUs}
-    mockClient.MockListGroups(expGroups...)
+    mockClient.MockListGroupsPage("",
+        cognitotestsupport.Group("readers", grantsDescription("Readers", map[string][]string{testClientId: {scopeRead}})))
+    mockClient.MockUpdateGroup()
 
-    actionMemberMap := map[string]policytestsupport.ActionMembers{
-        policytestsupport.ActionGetProfile: {
-            MemberIds: []string{policytestsupport.UserIdGetProfile, policytestsupport.UserIdGetHrUsAndProfile},
-        },
-        policytestsupport.ActionGetHrUs: {
-            MemberIds: []string{policytestsupport.UserIdGetHrUs, policytestsupport.UserIdGetHrUsAndProfile},
-        },
-    }
+    p := testProvider(mockClient)
+    info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
+    status, err := p.SetPolicyInfo(info, awstestsupport.AppInfo(), []hexapolicy.PolicyInfo{})
+    assert.NoError(t, err)
+    assert.Equal(t, http.StatusCreated, status)
+    assert.True(t, mockClient.VerifyCalled())
 
-    mockClient.MockListUsersInGroup(actionMemberMap[expGroups[0]].MemberIds...)
-    for _, principalId := range actionMemberMap[expGroups[0]].MemberIds {
-        mockClient.MockAdminGetUser(principalId, "random@email.io")
-    }
+    // the original description is restored
+    req := updateGroupRequest(t, mockClient, "UpdateGroup", 0)
+    assert.Equal(t, "Readers", req["Description"])
+}
 
-    mockClient.MockAdminRemoveUserFromGroupWithHttpStatus(http.StatusBadRequest)
+func TestSetPolicyInfo_NoChanges(t *testing.T) {
+    mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
+    mockClient.MockListGroupsPage("",
+        cognitotestsupport.Group("readers", grantsDescription("Readers", map[string][]string{testClientId: {scopeRead}})))
+    mockValidation(mockClient, scopeRead)
 
-    p := cognitoProvider.CognitoProvider{
-        AwsClientOpts: awscommon.AWSClientOptions{
-            HTTPClient:   mockClient,
-            DisableRetry: true}}
+    p := testProvider(mockClient)
+    info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
+    status, err := p.SetPolicyInfo(info, awstestsupport.AppInfo(), []hexapolicy.PolicyInfo{
+        grantPolicy(testClientId, []string{scopeRead}, "readers"),
+    })
+    assert.NoError(t, err)
+    assert.Equal(t, http.StatusCreated, status)
+    assert.True(t, mockClient.VerifyCalled())
+}
 
+func TestSetPolicyInfo_GroupNotFound(t *testing.T) {
+    mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
+    mockClient.MockListGroupsPage("", cognitotestsupport.Group("readers", "Readers"))
+    mockValidation(mockClient, scopeRead)
+
+    p := testProvider(mockClient)
     info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
-    appInfo := awstestsupport.AppInfo()
-    expPolicies := policytestsupport.MakeTestPolicies(actionMemberMap)
-    stat, err := p.SetPolicyInfo(info, appInfo, expPolicies)
-    assert.Equal(t, http.StatusInternalServerError, stat)
-    assert.Error(t, err)
-    assert.ErrorContains(t, err, "AdminRemoveUserFromGroup")
-    assert.ErrorContains(t, err, "error StatusCode: 400")
+    status, err := p.SetPolicyInfo(info, awstestsupport.AppInfo(), []hexapolicy.PolicyInfo{
+        grantPolicy(testClientId, []string{scopeRead}, "readers", "auditors"),
+    })
+    assert.Equal(t, http.StatusBadRequest, status)
+    assert.EqualError(t, err, "group auditors does not exist in user pool some-user-pool-id")
     assert.True(t, mockClient.VerifyCalled())
+    assert.Nil(t, mockClient.GetRequestBody(http.MethodPost, cognitotestsupport.CognitoApiUrl, "AWSCognitoIdentityProviderService.UpdateGroup"))
 }
 
-func TestSetPolicyInfo_RemoveAllExistingAssignments(t *testing.T) {
+func TestSetPolicyInfo_CreateGroups(t *testing.T) {
     mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
-    expGroups := []string{policytestsupport.ActionGetProfile, policytestsupport.ActionGetHrUs}
-    mockClient.MockListGroups(expGroups...)
+    mockClient.MockListGroupsPage("")
+    mockValidation(mockClient, scopeRead)
+    mockClient.MockCreateGroup()
+
+    p := testProvider(mockClient)
+    p.CreateGroups = true
+    info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
+    status, err := p.SetPolicyInfo(info, awstestsupport.AppInfo(), []hexapolicy.PolicyInfo{
+        grantPolicy(testClientId, []string{scopeRead}, "auditors"),
+    })
+    assert.NoError(t, err)
+    assert.Equal(t, http.StatusCreated, status)
+    assert.True(t, mockClient.VerifyCalled())
 
-    actionMemberMap := map[string]policytestsupport.ActionMembers{
-        policytestsupport.ActionGetProfile: {
-            MemberIds: []string{policytestsupport.UserIdGetProfile, policytestsupport.UserIdGetHrUsAndProfile},
+    req := updateGroupRequest(t, mockClient, "CreateGroup", 0)
+    assert.Equal(t, "auditors", req["GroupName"])
+    assert.Equal(t, awstestsupport.TestUserPoolId, req["UserPoolId"])
+    assert.Equal(t, `{"grants":{"web-client":["https://some-resource-server/read"]}}`, req["Description"])
+}
+
+func TestSetPolicyInfo_InvalidPolicies(t *testing.T) {
+    tests := []struct {
+        name          string
+        policy        hexapolicy.PolicyInfo
+        allowedScopes []string
+        validated     bool
+        wantErr       string
+    }{
+        {
+            name:    "unsupported subject",
+            policy:  hexapolicy.PolicyInfo{Meta: hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion}, Subjects: []string{"group:bob"}, Actions: []hexapolicy.ActionInfo{hexapolicy.ActionInfo(scopeRead)}, Object: testClientId},
+            wantErr: "subject group:bob is not a Cognito group (role:<group>) or user (user:<email>)",
+        },
+        {
+            name:    "user subject without group",
+            policy:  hexapolicy.PolicyInfo{Meta: hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion}, Subjects: []string{"user:bob@example.com"}, Actions: []hexapolicy.ActionInfo{hexapolicy.ActionInfo(scopeRead)}, Object: testClientId},
+            wantErr: "a policy with user subjects must have exactly one group subject (role:<group>)",
+        },
+        {
+            name:    "action of another resource server",
+            policy:  grantPolicy(testClientId, []string{scopeOther}, "readers"),
+            wantErr: "action https://other-resource-server/read is not a scope of resource server https://some-resource-server",
+        },
+        {
+            name:          "undefined scope",
+            policy:        grantPolicy(testClientId, []string{awstestsupport.TestResourceServerIdentifier + "/delete"}, "readers"),
+            allowedScopes: []string{scopeRead},
+            validated:     true,
+            wantErr:       "scope https://some-resource-server/delete is not defined by resource server https://some-resource-server",
+        },
+        {
+            name:          "scope not allowed for client",
+            policy:        grantPolicy(testClientId, []string{scopeWrite}, "readers"),
+            allowedScopes: []string{scopeRead},
+            validated:     true,
+            wantErr:       "scope https://some-resource-server/write is not allowed for app client web-client",
         },
-        policytestsupport.ActionGetHrUs: {
-            MemberIds: []string{policytestsupport.UserIdGetHrUs, policytestsupport.UserIdGetHrUsAndProfile},
+        {
+            name:          "unknown app client",
+            policy:        grantPolicy("mobile-client", []string{scopeRead}, "readers"),
+            allowedScopes: []string{scopeRead},
+            validated:     true,
+            wantErr:       "app client mobile-client not found in user pool some-user-pool-id",
         },
     }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
+            mockClient.MockListGroupsPage("", cognitotestsupport.Group("readers", "Readers"))
+            if tt.validated {
+                mockValidation(mockClient, tt.allowedScopes...)
+            }
 
-    for _, actionMem := range actionMemberMap {
-        mockClient.MockListUsersInGroup(actionMem.MemberIds...)
-        for _, principalId := range actionMem.MemberIds {
-            mockClient.MockAdminGetUser(principalId, "random@email.io")
-            mockClient.MockAdminRemoveUserFromGroup()
-        }
+            p := testProvider(mockClient)
+            info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
+            status, err := p.SetPolicyInfo(info, awstestsupport.AppInfo(), []hexapolicy.PolicyInfo{tt.policy})
+            assert.Equal(t, http.StatusBadRequest, status)
+            assert.EqualError(t, err, tt.wantErr)
+            assert.True(t, mockClient.VerifyCalled())
+        })
     }
+}
 
-    p := cognitoProvider.CognitoProvider{
-        AwsClientOpts: awscommon.AWSClientOptions{
-            HTTPClient:   mockClient,
-            DisableRetry: true}}
+func TestSetPolicyInfo_DescribeResourceServerError(t *testing.T) {
+    mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
+    mockClient.MockListGroupsPage("", cognitotestsupport.Group("readers", "Readers"))
+    mockClient.MockDescribeResourceServerWithHttpStatus(http.StatusBadRequest)
 
+    p := testProvider(mockClient)
     info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
-    appInfo := awstestsupport.AppInfo()
-    expPolicies := policytestsupport.MakeTestPolicies(actionMemberMap)
-    _, err := p.SetPolicyInfo(info, appInfo, expPolicies)
-    assert.NoError(t, err)
-    assert.True(t, mockClient.VerifyCalled())
+    _, err := p.SetPolicyInfo(info, awstestsupport.AppInfo(), []hexapolicy.PolicyInfo{
+        grantPolicy(testClientId, []string{scopeRead}, "readers"),
+    })
+    assert.ErrorContains(t, err, "DescribeResourceServer")
+    assert.ErrorContains(t, err, "error StatusCode: 400")
 }
 
-func TestSetPolicyInfo_NoExistingAssignments_AddAll(t *testing.T) {
+func TestSetPolicyInfo_UpdateGroupError(t *testing.T) {
     mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
-    expGroups := []string{policytestsupport.ActionGetProfile, policytestsupport.ActionGetHrUs}
-    mockClient.MockListGroups(expGroups...)
+    mockClient.MockListGroupsPage("", cognitotestsupport.Group("readers", "Readers"))
+    mockValidation(mockClient, scopeRead)
+    mockClient.MockUpdateGroupWithHttpStatus(http.StatusBadRequest)
 
-    actionMemberMap := policytestsupport.MakeActionMembers()
-    for range actionMemberMap {
-        mockClient.MockListUsersInGroup()
-    }
+    p := testProvider(mockClient)
+    info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
+    status, err := p.SetPolicyInfo(info, awstestsupport.AppInfo(), []hexapolicy.PolicyInfo{
+        grantPolicy(testClientId, []string{scopeRead}, "readers"),
+    })
+    assert.Equal(t, http.StatusInternalServerError, status)
+    assert.ErrorContains(t, err, "UpdateGroup")
+    assert.ErrorContains(t, err, "error StatusCode: 400")
+    assert.True(t, mockClient.VerifyCalled())
+}
 
-    for _, actionMem := range actionMemberMap {
-        for _, principalId := range actionMem.MemberIds {
-            mockClient.MockListUsers(principalId)
-            mockClient.MockAdminAddUserToGroup()
-        }
+func TestAmazonProvider_MapPolicyReport(t *testing.T) {
+    conditional := grantPolicy(testClientId, []string{scopeRead}, "readers")
+    conditional.Condition = &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: conditions.AAllow}
+    policies := []hexapolicy.PolicyInfo{
+        grantPolicy(testClientId, []string{scopeRead, scopeWrite}, "readers", "writers"),
+        conditional,
+        grantPolicy(testClientId, []string{scopeOther}, "readers"),
+        {Meta: hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion}, Subjects: []string{"group:bob"}, Actions: []hexapolicy.ActionInfo{hexapolicy.ActionInfo(scopeRead)}},
     }
 
-    p := cognitoProvider.CognitoProvider{
-        AwsClientOpts: awscommon.AWSClientOptions{
-            HTTPClient:   mockClient,
-            DisableRetry: true}}
-
-    info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
-    appInfo := awstestsupport.AppInfo()
-    expPolicies := policytestsupport.MakeTestPolicies(actionMemberMap)
-    _, err := p.SetPolicyInfo(info, appInfo, expPolicies)
+    mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
+    p := testProvider(mockClient)
+    report, err := p.MapPolicyReport(awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito), awstestsupport.AppInfo(), policies)
     assert.NoError(t, err)
+    assert.Equal(t, cognitoProvider.ProviderTypeAwsCognito, report.Target)
+    assert.True(t, report.IsLossy())
+    issues := report.Issues()
+    assert.Len(t, issues, 7)
+    assert.Contains(t, issues[0], "policy 0: POLICY APPROXIMATED - Cognito does not enforce group grants")
+    assert.Contains(t, issues[1], "policy 1: CONDITION DROPPED - policy conditions are not supported by Cognito")
+    assert.Contains(t, issues[3], "policy 2: ACTION DROPPED - action https://other-resource-server/read is not a scope")
+    assert.Contains(t, issues[5], "policy 3: SUBJECT DROPPED - subject group:bob is not a Cognito group")
+    assert.Contains(t, issues[6], "policy 3: POLICY DROPPED - policy object must be a Cognito app client id")
     assert.True(t, mockClient.VerifyCalled())
 }
 
-func TestSetPolicyInfo_NoneAddedOrRemoved(t *testing.T) {
+func TestAmazonProvider_Reconcile(t *testing.T) {
     mockClient := cognitotestsupport.NewMockCognitoHTTPClient()
-    expGroups := []string{policytestsupport.ActionGetProfile, policytestsupport.ActionGetHrUs}
-    mockClient.MockListGroups(expGroups...)
-
-    actionMemberMap := policytestsupport.MakeActionMembers()
-    for _, actionMem := range actionMemberMap {
-        mockClient.MockListUsersInGroup(actionMem.MemberIds...)
-        for p, principalId := range actionMem.MemberIds {
-            mockClient.MockAdminGetUser(principalId, actionMem.Emails[p])
-            mockClient.MockListUsers(principalId)
-        }
+    groups := []types.GroupType{
+        cognitotestsupport.Group("admins", grantsDescription("", map[string][]string{testClientId: {scopeRead}})),
+        cognitotestsupport.Group("readers", grantsDescription("", map[string][]string{testClientId: {scopeRead}})),
+        cognitotestsupport.Group("writers", grantsDescription("", map[string][]string{testClientId: {scopeWrite}})),
+    }
+    for range 2 {
+        mockClient.MockListGroupsPage("", groups...)
+        mockClient.MockListUsersInGroup("alice")
+        mockClient.MockAdminGetUser("alice", "alice@example.com")
+        mockClient.MockListUsersInGroup()
+        mockClient.MockListUsersInGroup()
     }
 
-    p := cognitoProvider.CognitoProvider{
-        AwsClientOpts: awscommon.AWSClientOptions{
-            HTTPClient:   mockClient,
-            DisableRetry: true}}
+    comparePolicies := []hexapolicy.PolicyInfo{
+        grantPolicy(testClientId, []string{scopeRead, scopeWrite}, "admins"),
+        grantPolicy(testClientId, []string{scopeRead}, "readers", "auditors"),
+    }
+    comparePolicies[0].Subjects = append(comparePolicies[0].Subjects, "user:bob@example.com")
 
+    p := testProvider(mockClient)
     info := awstestsupport.IntegrationInfo(cognitoProvider.ProviderTypeAwsCognito)
-    appInfo := awstestsupport.AppInfo()
-    expPolicies := policytestsupport.MakeTestPolicies(actionMemberMap)
-    _, err := p.SetPolicyInfo(info, appInfo, expPolicies)
+    difs, err := p.Reconcile(info, awstestsupport.AppInfo(), comparePolicies, false)
+    assert.NoError(t, err)
+    assert.Len(t, difs, 4)
+    difTypes := make(map[string]string)
+    for _, dif := range difs {
+        difTypes[dif.PolicyId] = dif.Type
+    }
+    assert.Equal(t, map[string]string{
+        "admins/" + testClientId:   hexapolicy.ChangeTypeUpdate,
+        "readers/" + testClientId:  hexapolicy.ChangeTypeEqual,
+        "auditors/" + testClientId: hexapolicy.ChangeTypeNew,
+        "writers/" + testClientId:  hexapolicy.ChangeTypeDelete,
+    }, difTypes)
+    assert.Equal(t, []string{hexapolicy.CompareDifSubject, hexapolicy.CompareDifAction}, difs[0].DifTypes)
+    assert.Equal(t, hexapolicy.SubjectInfo{"role:admins", "user:alice@example.com"}, difs[0].PolicyExist[0].Subjects)
+
+    difs, err = p.Reconcile(info, awstestsupport.AppInfo(), comparePolicies, true)
     assert.NoError(t, err)
+    assert.Len(t, difs, 3)
     assert.True(t, mockClient.VerifyCalled())
 }
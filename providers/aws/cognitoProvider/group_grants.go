@@ -0,0 +1,290 @@
+package cognitoProvider
+
+import (
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+    "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+)
+
+// maxGroupDescription is the maximum length of a Cognito group description
+const maxGroupDescription = 2048
+
+/*
+groupGrants is the content of a group description holding the OAuth scopes granted to the group for each app client.
+Cognito does not relate groups to app clients, so the provider records the relationship in the group description. The
+grants are Hexa metadata: Cognito does not enforce them, and tokens issued to an app client may carry any of its allowed
+OAuth scopes whatever the user's groups. Any description text that was in place is kept in Description.
+*/
+type groupGrants struct {
+    Description string              `json:"description,omitempty"`
+    Grants      map[string][]string `json:"grants,omitempty"` // Grants maps an app client id to its full scope names
+}
+
+// parseGroupGrants reads the grants recorded in a group description. A plain text description has no grants.
+func parseGroupGrants(description string) groupGrants {
+    var grants groupGrants
+    if strings.HasPrefix(strings.TrimSpace(description), "{") {
+        if err := json.Unmarshal([]byte(description), &grants); err == nil && grants.Grants != nil {
+            return grants
+        }
+    }
+    return groupGrants{Description: description}
+}
+
+// String returns the group description to store. Without grants, the original description is returned.
+func (g groupGrants) String() (string, error) {
+    if len(g.Grants) == 0 {
+        return g.Description, nil
+    }
+    desc, err := json.Marshal(g)
+    if err != nil {
+        return "", err
+    }
+    if len(desc) > maxGroupDescription {
+        return "", fmt.Errorf("grants exceed the maximum group description length of %d (%d)", maxGroupDescription, len(desc))
+    }
+    return string(desc), nil
+}
+
+// scopesFor returns the scopes of resourceServer granted for each app client
+func (g groupGrants) scopesFor(resourceServer string) map[string][]string {
+    res := make(map[string][]string)
+    prefix := resourceServer + "/"
+    for clientId, scopes := range g.Grants {
+        for _, scope := range scopes {
+            if strings.HasPrefix(scope, prefix) {
+                res[clientId] = append(res[clientId], scope)
+            }
+        }
+    }
+    return res
+}
+
+// replaceScopes replaces the scopes of resourceServer with clientScopes, keeping the scopes of other resource servers.
+// It returns true if the grants changed.
+func (g *groupGrants) replaceScopes(resourceServer string, clientScopes map[string][]string) bool {
+    if clientScopes == nil {
+        clientScopes = map[string][]string{}
+    }
+    if reflect.DeepEqual(g.scopesFor(resourceServer), clientScopes) {
+        return false
+    }
+
+    prefix := resourceServer + "/"
+    grants := make(map[string][]string)
+    for clientId, scopes := range g.Grants {
+        for _, scope := range scopes {
+            if !strings.HasPrefix(scope, prefix) {
+                grants[clientId] = append(grants[clientId], scope)
+            }
+        }
+    }
+    for clientId, scopes := range clientScopes {
+        grants[clientId] = append(grants[clientId], scopes...)
+        sort.Strings(grants[clientId])
+    }
+    g.Grants = grants
+    return true
+}
+
+// grant is the set of scopes a group is granted for an app client, and the members (user:<email>) of the group
+type grant struct {
+    group    string
+    clientId string
+    scopes   []string
+    members  []string
+}
+
+func (g *grant) key() string {
+    return g.group + "/" + g.clientId
+}
+
+func (g *grant) addScopes(scopes ...string) {
+    for _, scope := range scopes {
+        if !containsString(g.scopes, scope) {
+            g.scopes = append(g.scopes, scope)
+        }
+    }
+    sort.Strings(g.scopes)
+}
+
+func (g *grant) addMembers(members ...string) {
+    for _, member := range members {
+        if !containsString(g.members, member) {
+            g.members = append(g.members, member)
+        }
+    }
+    sort.Strings(g.members)
+}
+
+// sameMembers reports whether the members of compare are those of g. A grant without members leaves the membership of
+// the group unchanged, so it matches any members.
+func (g *grant) sameMembers(compare *grant) bool {
+    return len(compare.members) == 0 || strings.Join(g.members, " ") == strings.Join(compare.members, " ")
+}
+
+func (g *grant) toPolicy(userPoolId string) hexapolicy.PolicyInfo {
+    policyId := g.key()
+    papId := userPoolId
+    actions := make([]hexapolicy.ActionInfo, len(g.scopes))
+    for i, scope := range g.scopes {
+        actions[i] = hexapolicy.ActionInfo(scope)
+    }
+    return hexapolicy.PolicyInfo{
+        Meta: hexapolicy.MetaInfo{
+            Version:      hexapolicy.IdqlVersion,
+            ProviderType: ProviderTypeAwsCognito,
+            PolicyId:     &policyId,
+            PapId:        &papId,
+            SourceData: map[string]interface{}{
+                "group":    g.group,
+                "clientId": g.clientId,
+            },
+        },
+        Subjects: append([]string{SubjectPrefixRole + g.group}, g.members...),
+        Actions:  actions,
+        Object:   hexapolicy.ObjectInfo(g.clientId),
+    }
+}
+
+// existingGrants returns the grants of resourceServer scopes recorded in groups, ordered by group and app client
+func existingGrants(groups []types.GroupType, resourceServer string) []*grant {
+    res := make([]*grant, 0)
+    for _, group := range groups {
+        clientScopes := parseGroupGrants(aws.ToString(group.Description)).scopesFor(resourceServer)
+        for clientId, scopes := range clientScopes {
+            g := &grant{group: aws.ToString(group.GroupName), clientId: clientId}
+            g.addScopes(scopes...)
+            res = append(res, g)
+        }
+    }
+    sort.Slice(res, func(i, j int) bool {
+        if res[i].group != res[j].group {
+            return res[i].group < res[j].group
+        }
+        return res[i].clientId < res[j].clientId
+    })
+    return res
+}
+
+/*
+mapPolicies converts policies to grants of resourceServer scopes. A policy with several role subjects grants its scopes
+to each of the groups. The user subjects (user:<email>) of a policy are the members of its group, so a policy with user
+subjects must have exactly one role subject.
+*/
+func mapPolicies(policies []hexapolicy.PolicyInfo, resourceServer string) ([]*grant, error) {
+    res := make([]*grant, 0)
+    grants := make(map[string]*grant)
+    prefix := resourceServer + "/"
+    for _, policy := range policies {
+        if policy.Condition != nil {
+            return nil, fmt.Errorf("policy conditions are not supported by Cognito: %s", policy.Condition.Rule)
+        }
+        clientId := string(policy.Object)
+        if clientId == "" {
+            return nil, fmt.Errorf("policy object must be a Cognito app client id")
+        }
+        for _, action := range policy.Actions {
+            if !strings.HasPrefix(string(action), prefix) {
+                return nil, fmt.Errorf("action %s is not a scope of resource server %s", action, resourceServer)
+            }
+        }
+        groups, members := splitSubjects(policy.Subjects)
+        for _, subject := range policy.Subjects {
+            if !containsString(groups, subject) && !containsString(members, subject) {
+                return nil, fmt.Errorf("subject %s is not a Cognito group (%s<group>) or user (%s<email>)", subject, SubjectPrefixRole, SubjectPrefixUser)
+            }
+        }
+        if len(members) > 0 && len(groups) != 1 {
+            return nil, fmt.Errorf("a policy with user subjects must have exactly one group subject (%s<group>)", SubjectPrefixRole)
+        }
+        for _, subject := range groups {
+            group := strings.TrimPrefix(subject, SubjectPrefixRole)
+            g := &grant{group: group, clientId: clientId}
+            if existing, ok := grants[g.key()]; ok {
+                g = existing
+            } else {
+                grants[g.key()] = g
+                res = append(res, g)
+            }
+            for _, action := range policy.Actions {
+                g.addScopes(string(action))
+            }
+            g.addMembers(members...)
+        }
+    }
+    return res, nil
+}
+
+// splitSubjects returns the group (role:<group>) and user (user:<email>) subjects
+func splitSubjects(subjects []string) (groups []string, members []string) {
+    for _, subject := range subjects {
+        if name, ok := strings.CutPrefix(subject, SubjectPrefixRole); ok && name != "" {
+            groups = append(groups, subject)
+        } else if name, ok = strings.CutPrefix(subject, SubjectPrefixUser); ok && name != "" {
+            members = append(members, subject)
+        }
+    }
+    return groups, members
+}
+
+// groupMembers returns the members of each group that has grants with members
+func groupMembers(grants []*grant) map[string][]string {
+    res := make(map[string][]string)
+    for _, g := range grants {
+        for _, member := range g.members {
+            if !containsString(res[g.group], member) {
+                res[g.group] = append(res[g.group], member)
+            }
+        }
+    }
+    return res
+}
+
+/*
+reportPolicies records in a MappingReport the elements of each policy that mapPolicies cannot represent as a group grant
+of the scopes of resourceServer. SetPolicyInfo rejects the policies when any element is dropped. As Cognito does not
+enforce group grants (see groupGrants), each policy is at best approximated.
+*/
+func reportPolicies(policies []hexapolicy.PolicyInfo, resourceServer string, report *hexapolicy.MappingReport) {
+    prefix := resourceServer + "/"
+    for i, policy := range policies {
+        report.ExactPolicy(i, policy)
+        if policy.Condition != nil {
+            report.Dropped(i, policy, hexapolicy.CompareDifCondition, "policy conditions are not supported by Cognito")
+        }
+        if policy.Object == "" {
+            report.Dropped(i, policy, hexapolicy.MapElementPolicy, "policy object must be a Cognito app client id")
+        }
+        for _, action := range policy.Actions {
+            if !strings.HasPrefix(string(action), prefix) {
+                report.Dropped(i, policy, hexapolicy.CompareDifAction, fmt.Sprintf("action %s is not a scope of resource server %s", action, resourceServer))
+            }
+        }
+        groups, members := splitSubjects(policy.Subjects)
+        for _, subject := range policy.Subjects {
+            if !containsString(groups, subject) && !containsString(members, subject) {
+                report.Dropped(i, policy, hexapolicy.CompareDifSubject, fmt.Sprintf("subject %s is not a Cognito group (%s<group>) or user (%s<email>)", subject, SubjectPrefixRole, SubjectPrefixUser))
+            }
+        }
+        if len(members) > 0 && len(groups) != 1 {
+            report.Dropped(i, policy, hexapolicy.CompareDifSubject, "a policy with user subjects must have exactly one group subject")
+        }
+        report.Approximated(i, policy, hexapolicy.MapElementPolicy, "Cognito does not enforce group grants; app client tokens may carry any of the client's allowed OAuth scopes")
+    }
+}
+
+func containsString(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
@@ -2,8 +2,8 @@ package azad
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -21,18 +21,50 @@ type AzureClient interface {
 	GetServicePrincipals(key []byte, appId string) (AzureServicePrincipals, error)
 	GetUserInfoFromPrincipalId(key []byte, principalId string) (AzureUser, error)
 	GetPrincipalIdFromEmail(key []byte, email string) (string, error)
+	GetGroupIdFromName(key []byte, name string) (string, error)
+	GetPrincipalIdFromAppId(key []byte, appId string) (string, error)
+	GetServicePrincipalAppId(key []byte, principalId string) (string, error)
 	GetAppRoleAssignedTo(key []byte, servicePrincipalId string) (AzureAppRoleAssignments, error)
 	SetAppRoleAssignedTo(key []byte, servicePrincipalId string, assignments []AzureAppRoleAssignment) error
 }
 
+// Principal types of an AzureAppRoleAssignment
+const (
+	PrincipalTypeUser             = "User"
+	PrincipalTypeGroup            = "Group"
+	PrincipalTypeServicePrincipal = "ServicePrincipal"
+)
+
+const graphApiUrl = "https://graph.microsoft.com/v1.0"
+const graphScope = "https://graph.microsoft.com/.default"
+
 type azureClient struct {
 	HttpClient azurecommon.HTTPClient
+	ctx        context.Context
+}
+
+// ContextClient is implemented by an AzureClient whose requests can be bound to a context
+type ContextClient interface {
+	// WithContext returns a copy of the client whose requests are made with ctx
+	WithContext(ctx context.Context) AzureClient
 }
 
-type AzureAccessToken struct {
-	Token string `json:"access_token"`
+func (c *azureClient) WithContext(ctx context.Context) AzureClient {
+	bound := *c
+	bound.ctx = ctx
+	return &bound
 }
 
+func (c *azureClient) requestContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// AzureAccessToken is the access token used for Graph API requests
+type AzureAccessToken = azurecommon.AccessToken
+
 type azureWebApps struct {
 	List []AzureWebApp `json:"value"`
 }
@@ -54,6 +86,7 @@ type AzureServicePrincipals struct {
 
 type azureServicePrincipal struct {
 	ID       string         `json:"id"`
+	AppID    string         `json:"appId"`
 	Name     string         `json:"displayName"`
 	AppRoles []AzureAppRole `json:"appRoles"`
 }
@@ -82,6 +115,11 @@ type AzureUsers struct {
 	List []AzureUser `json:"value"`
 }
 
+type AzureGroup struct {
+	ID   string `json:"id"`
+	Name string `json:"displayName"`
+}
+
 type AzureAppRoleAssignment struct {
 	ID                   string `json:"id"`
 	AppRoleId            string `json:"appRoleId" validate:"required"`
@@ -100,50 +138,17 @@ func NewAzureClient(httpClient azurecommon.HTTPClient) AzureClient {
 }
 
 func (c *azureClient) GetAzureApplications(key []byte) ([]AzureWebApp, error) {
-	request, _ := http.NewRequest("GET", "https://graph.microsoft.com/v1.0/applications", nil)
-	get, err := c.azureRequest(key, request, "https://graph.microsoft.com/.default")
-	if err != nil {
-		log.Println("Unable to get azure web applications. Error=" + err.Error())
-		return nil, err
-	}
-
-	if get.StatusCode != http.StatusOK {
-		errMsg := "unable to get azure web applications. Unexpected status " + get.Status
-		log.Println(errMsg)
-		return nil, errors.New(errMsg)
-	}
-
-	var webapps azureWebApps
-	if err = json.NewDecoder(get.Body).Decode(&webapps); err != nil {
-		log.Println("Unable to decode azure web app response.")
-		return nil, err
-	}
-
-	return webapps.List, nil
+	return getAllPages[AzureWebApp](c, key, graphApiUrl+"/applications", "get azure web applications")
 }
 
 func (c *azureClient) GetWebApplications(key []byte) ([]policyprovider.ApplicationInfo, error) {
-	request, _ := http.NewRequest("GET", "https://graph.microsoft.com/v1.0/applications", nil)
-	get, err := c.azureRequest(key, request, "https://graph.microsoft.com/.default")
+	webapps, err := c.GetAzureApplications(key)
 	if err != nil {
-		log.Println("Unable to get azure web applications. Error=" + err.Error())
-		return []policyprovider.ApplicationInfo{}, err
-	}
-
-	if get.StatusCode != http.StatusOK {
-		errMsg := "unable to get azure web applications. Unexpected status " + get.Status
-		log.Println(errMsg)
-		return []policyprovider.ApplicationInfo{}, errors.New(errMsg)
-	}
-
-	var webapps azureWebApps
-	if err = json.NewDecoder(get.Body).Decode(&webapps); err != nil {
-		log.Println("Unable to decode azure web app response.")
 		return []policyprovider.ApplicationInfo{}, err
 	}
 
 	var apps []policyprovider.ApplicationInfo
-	for _, app := range webapps.List {
+	for _, app := range webapps {
 		log.Printf("Found azure app service web app %s.\n", app.Name)
 		if app.Web.HomePageUrl != "" { // todo - a better way to find enterprise apps, WindowsAzureActiveDirectoryIntegratedApp?
 			apps = append(apps, policyprovider.ApplicationInfo{
@@ -159,101 +164,111 @@ func (c *azureClient) GetWebApplications(key []byte) ([]policyprovider.Applicati
 
 func (c *azureClient) GetServicePrincipals(key []byte, appId string) (AzureServicePrincipals, error) {
 	filter := fmt.Sprintf("$search=\"appId:%s\"", appId)
-	urlWithFilter := fmt.Sprintf("https://graph.microsoft.com/v1.0/servicePrincipals?%s", filter)
-	request, _ := http.NewRequest("GET", urlWithFilter, nil)
-	get, err := c.azureRequest(key, request, "https://graph.microsoft.com/.default")
+	urlWithFilter := fmt.Sprintf("%s/servicePrincipals?%s", graphApiUrl, filter)
+	sps, err := getAllPages[azureServicePrincipal](c, key, urlWithFilter, "get azure service principals")
 	if err != nil {
-		log.Println("Unable to get azure service principals. Error=" + err.Error())
 		return AzureServicePrincipals{}, err
 	}
-
-	if get.StatusCode != http.StatusOK {
-		errMsg := "unable to get azure service principals. Unexpected status " + get.Status
-		log.Println(errMsg)
-		return AzureServicePrincipals{}, errors.New(errMsg)
-	}
-
-	var sps AzureServicePrincipals
-	if err = json.NewDecoder(get.Body).Decode(&sps); err != nil {
-		log.Println("Unable to decode azure service principals response. Error=", err)
-		return AzureServicePrincipals{}, err
-	}
-	return sps, nil
+	return AzureServicePrincipals{List: sps}, nil
 }
 
 func (c *azureClient) GetUserInfoFromPrincipalId(key []byte, principalId string) (AzureUser, error) {
-	endpoint := fmt.Sprintf("https://graph.microsoft.com/v1.0/users/%s", principalId)
-	request, _ := http.NewRequest("GET", endpoint, nil)
-	get, err := c.azureRequest(key, request, "https://graph.microsoft.com/.default")
-	if err != nil {
-		log.Println("Unable to get azure user. Error=" + err.Error())
-		return AzureUser{}, err
-	}
-
-	if get.StatusCode != http.StatusOK {
-		errMsg := "unable to get azure user. Unexpected status " + get.Status
-		log.Println(errMsg)
-		return AzureUser{}, errors.New(errMsg)
-	}
-
+	endpoint := fmt.Sprintf("%s/users/%s", graphApiUrl, principalId)
 	var user AzureUser
-	if err = json.NewDecoder(get.Body).Decode(&user); err != nil {
-		log.Println("Unable to decode azure web app response. Error=" + err.Error())
+	if err := c.getObject(key, endpoint, "get azure user", &user); err != nil {
 		return AzureUser{}, err
 	}
-
 	return user, nil
 }
 
+// GetPrincipalIdFromEmail returns the id of the user with email, or "" if there is no such user
 func (c *azureClient) GetPrincipalIdFromEmail(key []byte, email string) (string, error) {
-	query := fmt.Sprintf("https://graph.microsoft.com/v1.0/users?$select=id,mail&$filter=mail%%20eq%%20%%27%s%%27", url.QueryEscape(email))
-	request, _ := http.NewRequest("GET", query, nil)
-	get, err := c.azureRequest(key, request, "https://graph.microsoft.com/.default")
-	if err != nil {
-		log.Println("Unable to get id for azure user. Error=" + err.Error())
+	query := fmt.Sprintf("%s/users?$select=id,mail&$filter=mail%%20eq%%20%%27%s%%27", graphApiUrl, url.QueryEscape(email))
+	var userValues AzureUsers
+	if err := c.getObject(key, query, "get id for azure user", &userValues); err != nil {
 		return "", err
 	}
+	if len(userValues.List) == 0 {
+		return "", nil
+	}
+	return userValues.List[0].PrincipalId, nil
+}
 
-	if get.StatusCode != http.StatusOK {
-		errMsg := "unable to get id for azure user. Unexpected status " + get.Status
-		log.Println(errMsg)
-		return "", errors.New(errMsg)
+// GetGroupIdFromName returns the id of the group whose display name is name, or "" if there is no such group
+func (c *azureClient) GetGroupIdFromName(key []byte, name string) (string, error) {
+	query := fmt.Sprintf("%s/groups?$select=id,displayName&$filter=displayName%%20eq%%20%%27%s%%27", graphApiUrl, odataString(name))
+	var groups azurecommon.Page[AzureGroup]
+	if err := c.getObject(key, query, "get id for azure group", &groups); err != nil {
+		return "", err
+	}
+	if len(groups.List) == 0 {
+		return "", nil
+	}
+	return groups.List[0].ID, nil
+}
+
+// GetPrincipalIdFromAppId returns the id of the service principal of the application appId, or "" if there is none
+func (c *azureClient) GetPrincipalIdFromAppId(key []byte, appId string) (string, error) {
+	query := fmt.Sprintf("%s/servicePrincipals?$select=id,appId&$filter=appId%%20eq%%20%%27%s%%27", graphApiUrl, odataString(appId))
+	var sps AzureServicePrincipals
+	if err := c.getObject(key, query, "get id for azure service principal", &sps); err != nil {
+		return "", err
+	}
+	if len(sps.List) == 0 {
+		return "", nil
 	}
+	return sps.List[0].ID, nil
+}
 
-	var userValues AzureUsers
-	if err = json.NewDecoder(get.Body).Decode(&userValues); err != nil {
-		log.Println("Unable to decode azure web app response. Error=", err)
+// GetServicePrincipalAppId returns the application (client) id of the service principal principalId
+func (c *azureClient) GetServicePrincipalAppId(key []byte, principalId string) (string, error) {
+	endpoint := fmt.Sprintf("%s/servicePrincipals/%s?$select=id,appId", graphApiUrl, principalId)
+	var sp azureServicePrincipal
+	if err := c.getObject(key, endpoint, "get azure service principal", &sp); err != nil {
 		return "", err
 	}
-	return userValues.List[0].PrincipalId, nil
+	return sp.AppID, nil
 }
 
 func (c *azureClient) GetAppRoleAssignedTo(key []byte, servicePrincipalId string) (AzureAppRoleAssignments, error) {
-	endpoint := fmt.Sprintf("https://graph.microsoft.com/v1.0/servicePrincipals/%s/appRoleAssignedTo", servicePrincipalId)
-	request, _ := http.NewRequest("GET", endpoint, nil)
-	get, err := c.azureRequest(key, request, "https://graph.microsoft.com/.default")
+	endpoint := fmt.Sprintf("%s/servicePrincipals/%s/appRoleAssignedTo", graphApiUrl, servicePrincipalId)
+	assignments, err := getAllPages[AzureAppRoleAssignment](c, key, endpoint, "get azure app role assignments")
 	if err != nil {
-		log.Println("Unable to get azure app role assignments. Error=" + err.Error())
 		return AzureAppRoleAssignments{}, err
 	}
+	return AzureAppRoleAssignments{List: assignments}, nil
+}
 
-	if get.StatusCode != http.StatusOK {
-		errMsg := "unable to get id for azure app role assignments. Unexpected status " + get.Status
-		log.Println(errMsg)
-		return AzureAppRoleAssignments{}, errors.New(errMsg)
+// getObject decodes the response of a GET request to endpoint into value
+func (c *azureClient) getObject(key []byte, endpoint string, description string, value interface{}) error {
+	request, _ := http.NewRequestWithContext(c.requestContext(), "GET", endpoint, nil)
+	get, err := c.azureRequest(key, request, graphScope)
+	if err != nil {
+		log.Printf("Unable to %s. Error=%s\n", description, err.Error())
+		return err
 	}
 
-	var assignments AzureAppRoleAssignments
-	if err = json.NewDecoder(get.Body).Decode(&assignments); err != nil {
-		log.Println("Unable to decode azure web app response. Error=" + err.Error())
-		return AzureAppRoleAssignments{}, err
+	if get.StatusCode != http.StatusOK {
+		return azurecommon.StatusError(description, get)
 	}
 
-	if assignments.List == nil {
-		assignments.List = []AzureAppRoleAssignment{}
+	if err = json.NewDecoder(get.Body).Decode(value); err != nil {
+		log.Printf("Unable to decode response to %s. Error=%s\n", description, err.Error())
+		return err
 	}
+	return nil
+}
+
+// getAllPages returns the values of every page of the Graph collection at endpoint, following @odata.nextLink
+func getAllPages[T any](c *azureClient, key []byte, endpoint string, description string) ([]T, error) {
+	return azurecommon.GetAllPages(endpoint, func(link string, page *azurecommon.Page[T]) error {
+		return c.getObject(key, link, description, page)
+	})
+}
 
-	return assignments, nil
+// odataString escapes value for use as a string literal in an OData $filter
+func odataString(value string) string {
+	return url.QueryEscape(strings.ReplaceAll(value, "'", "''"))
 }
 
 func (c *azureClient) SetAppRoleAssignedTo(key []byte, servicePrincipalId string, assignments []AzureAppRoleAssignment) error {
@@ -340,18 +355,16 @@ func (c *azureClient) addAppRolesAssignedTo(key []byte, servicePrincipalId strin
 		var buf bytes.Buffer
 		ra := azureAppRoleAssignmentPost{assignment.AppRoleId, assignment.PrincipalId, servicePrincipalId} // the resource id is the service principal
 		_ = json.NewEncoder(&buf).Encode(ra)
-		endpoint := fmt.Sprintf("https://graph.microsoft.com/v1.0/servicePrincipals/%s/appRoleAssignedTo", servicePrincipalId)
-		request, _ := http.NewRequest("POST", endpoint, bytes.NewReader(buf.Bytes()))
-		response, err := c.azureRequest(key, request, "https://graph.microsoft.com/.default")
+		endpoint := fmt.Sprintf("%s/servicePrincipals/%s/appRoleAssignedTo", graphApiUrl, servicePrincipalId)
+		request, _ := http.NewRequestWithContext(c.requestContext(), "POST", endpoint, bytes.NewReader(buf.Bytes()))
+		response, err := c.azureRequest(key, request, graphScope)
 		if err != nil {
 			log.Println("Unable to add azure app role assignments. Error=", err)
 			return err
 		}
 
 		if response.StatusCode != http.StatusCreated {
-			errMsg := fmt.Sprintf("unable to add azure app role assignments. Unexpected status %d", response.StatusCode)
-			log.Println(errMsg)
-			return errors.New(errMsg)
+			return azurecommon.StatusError("add azure app role assignments", response)
 		}
 	}
 	return err
@@ -359,57 +372,22 @@ func (c *azureClient) addAppRolesAssignedTo(key []byte, servicePrincipalId strin
 
 func (c *azureClient) deleteAppRolesAssignedTo(key []byte, servicePrincipalId string, assignmentIds []string) (err error) {
 	for _, assignmentId := range assignmentIds {
-		endpoint := fmt.Sprintf("https://graph.microsoft.com/v1.0/servicePrincipals/%s/appRoleAssignedTo/%s", servicePrincipalId, assignmentId)
-		request, _ := http.NewRequest("DELETE", endpoint, nil)
-		response, err := c.azureRequest(key, request, "https://graph.microsoft.com/.default")
+		endpoint := fmt.Sprintf("%s/servicePrincipals/%s/appRoleAssignedTo/%s", graphApiUrl, servicePrincipalId, assignmentId)
+		request, _ := http.NewRequestWithContext(c.requestContext(), "DELETE", endpoint, nil)
+		response, err := c.azureRequest(key, request, graphScope)
 		if err != nil {
 			log.Println("Unable to delete azure app role assignments. Error=", err)
 			return err
 		}
 
 		if response.StatusCode != http.StatusNoContent {
-			errMsg := fmt.Sprintf("unable to delete azure app role assignments. Unexpected status %d", response.StatusCode)
-			log.Println(errMsg)
-			return errors.New(errMsg)
+			return azurecommon.StatusError("delete azure app role assignments", response)
 		}
 	}
 	return err
 }
 
-func (c *azureClient) decodeKey(key []byte) (azurecommon.AzureKey, error) {
-	var decoded azurecommon.AzureKey
-	err := json.NewDecoder(bytes.NewReader(key)).Decode(&decoded)
-	return decoded, err
-}
-
-func (c *azureClient) accessTokenRequest(decoded azurecommon.AzureKey, scope string) (AzureAccessToken, error) {
-	var accessToken AzureAccessToken
-	tokenUrl := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", decoded.Tenant)
-	postBody := fmt.Sprintf("grant_type=client_credentials&client_id=%s&client_secret=%s&scope=%s", decoded.AppId, decoded.Secret, scope)
-	tokenResponse, tokenErr := c.HttpClient.Post(tokenUrl, "", strings.NewReader(postBody))
-	if tokenErr != nil {
-		return accessToken, tokenErr
-	}
-
-	err := json.NewDecoder(tokenResponse.Body).Decode(&accessToken)
-	return accessToken, err
-}
-
 func (c *azureClient) azureRequest(key []byte, request *http.Request, scope string) (*http.Response, error) {
-	decoded, keyErr := c.decodeKey(key)
-	if keyErr != nil {
-		log.Println("Unable to decode azure provider key. Error=", keyErr)
-		return nil, keyErr
-	}
-	accessToken, tokenErr := c.accessTokenRequest(decoded, scope)
-	if tokenErr != nil {
-		log.Println("Unable to find azure web applications.")
-		return nil, tokenErr
-	}
-	request.Header = http.Header{
-		"ConsistencyLevel": []string{"eventual"},
-		"Content-Type":     []string{"application/json"},
-		"Authorization":    []string{fmt.Sprintf("Bearer %s", accessToken.Token)},
-	}
-	return c.HttpClient.Do(request)
+	request.Header.Set("ConsistencyLevel", "eventual")
+	return azurecommon.AuthorizedRequest(c.HttpClient, key, request, scope)
 }
@@ -463,6 +463,71 @@ func TestAzureClient_GetAppRoleAssignedTo(t *testing.T) {
 	assert.Equal(t, len(existingAssignments), foundCount)
 }
 
+func TestAzureClient_GetAppRoleAssignedTo_FollowsNextLink(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	key := azuretestsupport.AzureKeyBytes()
+	nextLink := m.AppRoleAssignmentsUrl() + "?$skiptoken=page2"
+
+	m.TokenRequest("accessToken")
+	m.GetAppRoleAssignmentsPageRequest(m.AppRoleAssignmentsUrl(), azuretestsupport.AppRoleAssignmentGetHrUs, nextLink)
+	m.GetAppRoleAssignmentsPageRequest(nextLink, azuretestsupport.AppRoleAssignmentGetProfile, "")
+
+	client := m.AzureClient()
+	actAssignments, err := client.GetAppRoleAssignedTo(key, azuretestsupport.ServicePrincipalId)
+	assert.NoError(t, err)
+	assert.Len(t, actAssignments.List, 2)
+	assert.Equal(t, azuretestsupport.AppRoleAssignmentGetHrUs[0].ID, actAssignments.List[0].ID)
+	assert.Equal(t, azuretestsupport.AppRoleAssignmentGetProfile[0].ID, actAssignments.List[1].ID)
+}
+
+func TestAzureClient_GetAppRoleAssignedTo_GraphError(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+
+	m.TokenRequest("accessToken")
+	m.ErrorRequest(http.MethodGet, m.AppRoleAssignmentsUrl(), http.StatusForbidden,
+		[]byte(`{"error": {"code": "Authorization_RequestDenied", "message": "Insufficient privileges to complete the operation."}}`))
+
+	client := m.AzureClient()
+	_, err := client.GetAppRoleAssignedTo(azuretestsupport.AzureKeyBytes(), azuretestsupport.ServicePrincipalId)
+	assert.EqualError(t, err, "unable to get azure app role assignments. Unexpected status 403 (Authorization_RequestDenied: Insufficient privileges to complete the operation.)")
+}
+
+func TestAzureClient_GetGroupIdFromName(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	key := azuretestsupport.AzureKeyBytes()
+
+	m.TokenRequest("accessToken")
+	m.GetGroupIdFromNameRequest("HR Admins", "group-id")
+	m.MockHttpClient.AddRequest(http.MethodGet, m.GetGroupIdFromNameUrl("Nobody''s Group"), http.StatusOK, []byte(`{"value": []}`))
+
+	client := m.AzureClient()
+	groupId, err := client.GetGroupIdFromName(key, "HR Admins")
+	assert.NoError(t, err)
+	assert.Equal(t, "group-id", groupId)
+
+	groupId, err = client.GetGroupIdFromName(key, "Nobody's Group")
+	assert.NoError(t, err)
+	assert.Empty(t, groupId)
+}
+
+func TestAzureClient_ServicePrincipalIds(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	key := azuretestsupport.AzureKeyBytes()
+
+	m.TokenRequest("accessToken")
+	m.GetPrincipalIdFromAppIdRequest("sp-app-id", "sp-principal-id")
+	m.GetServicePrincipalAppIdRequest("sp-principal-id", "sp-app-id")
+
+	client := m.AzureClient()
+	principalId, err := client.GetPrincipalIdFromAppId(key, "sp-app-id")
+	assert.NoError(t, err)
+	assert.Equal(t, "sp-principal-id", principalId)
+
+	appId, err := client.GetServicePrincipalAppId(key, "sp-principal-id")
+	assert.NoError(t, err)
+	assert.Equal(t, "sp-app-id", appId)
+}
+
 func TestAzureClient_SetAppRoleAssignedTo_InvalidAppRoleAssignment(t *testing.T) {
 	m := azuretestsupport.NewAzureHttpClient()
 	client := m.AzureClient()
@@ -0,0 +1,292 @@
+package azarm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/providers/azure/azurecommon"
+)
+
+/*
+RbacClient makes calls to the Azure Resource Manager (ARM) API to discover subscriptions, resource groups and resources,
+and to read and update the role assignments (Azure RBAC) made at those scopes.
+*/
+type RbacClient interface {
+	GetRbacApplications(key []byte) ([]policyprovider.ApplicationInfo, error)
+	GetRoleDefinitions(key []byte, scope string) ([]RoleDefinition, error)
+	GetRoleAssignments(key []byte, scope string) ([]RoleAssignment, error)
+	PutRoleAssignment(key []byte, scope string, name string, properties RoleAssignmentProperties) error
+	DeleteRoleAssignment(key []byte, id string) error
+}
+
+// Services of the applications returned by GetRbacApplications. Resources use their resource type as the service.
+const (
+	ServiceSubscription  = "Subscription"
+	ServiceResourceGroup = "Resource Group"
+)
+
+// Principal types of a RoleAssignment
+const (
+	PrincipalTypeUser             = "User"
+	PrincipalTypeGroup            = "Group"
+	PrincipalTypeServicePrincipal = "ServicePrincipal"
+)
+
+const armApiUrl = "https://management.azure.com"
+const armScope = "https://management.azure.com/.default"
+
+const (
+	subscriptionsApiVersion = "2022-12-01"
+	resourcesApiVersion     = "2021-04-01"
+	authorizationApiVersion = "2022-04-01"
+)
+
+type rbacClient struct {
+	HttpClient azurecommon.HTTPClient
+	ctx        context.Context
+}
+
+// ContextClient is implemented by an RbacClient whose requests can be bound to a context
+type ContextClient interface {
+	// WithContext returns a copy of the client whose requests are made with ctx
+	WithContext(ctx context.Context) RbacClient
+}
+
+func (c *rbacClient) WithContext(ctx context.Context) RbacClient {
+	bound := *c
+	bound.ctx = ctx
+	return &bound
+}
+
+func (c *rbacClient) requestContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+type Subscription struct {
+	ID             string `json:"id"` // e.g. /subscriptions/{subscriptionId}
+	SubscriptionID string `json:"subscriptionId"`
+	DisplayName    string `json:"displayName"`
+	State          string `json:"state"`
+}
+
+type ResourceGroup struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+}
+
+type Resource struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Location string `json:"location"`
+}
+
+type RoleDefinition struct {
+	ID         string                   `json:"id"`   // e.g. /subscriptions/{subscriptionId}/providers/Microsoft.Authorization/roleDefinitions/{guid}
+	Name       string                   `json:"name"` // the role definition guid
+	Properties RoleDefinitionProperties `json:"properties"`
+}
+
+type RoleDefinitionProperties struct {
+	RoleName    string `json:"roleName"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"` // BuiltInRole or CustomRole
+}
+
+type RoleAssignment struct {
+	ID         string                   `json:"id"`
+	Name       string                   `json:"name"` // the role assignment guid
+	Properties RoleAssignmentProperties `json:"properties"`
+}
+
+type RoleAssignmentProperties struct {
+	RoleDefinitionId string `json:"roleDefinitionId"`
+	PrincipalId      string `json:"principalId"`
+	PrincipalType    string `json:"principalType,omitempty"`
+	Scope            string `json:"scope,omitempty"`
+	Condition        string `json:"condition,omitempty"`
+	ConditionVersion string `json:"conditionVersion,omitempty"`
+}
+
+type roleAssignmentPut struct {
+	Properties RoleAssignmentProperties `json:"properties"`
+}
+
+func NewRbacClient(httpClient azurecommon.HTTPClient) RbacClient {
+	if httpClient == nil {
+		return &rbacClient{HttpClient: &http.Client{}}
+	}
+	return &rbacClient{HttpClient: httpClient}
+}
+
+/*
+GetRbacApplications returns the subscriptions visible to the key's application along with their resource groups and
+resources. When the key names a subscription only that subscription is discovered. Each is returned as an application
+whose ObjectID is its ARM scope (resource id).
+*/
+func (c *rbacClient) GetRbacApplications(key []byte) ([]policyprovider.ApplicationInfo, error) {
+	subscriptions, err := c.getSubscriptions(key)
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make([]policyprovider.ApplicationInfo, 0)
+	for _, sub := range subscriptions {
+		log.Printf("Found azure subscription %s.\n", sub.DisplayName)
+		apps = append(apps, policyprovider.ApplicationInfo{
+			ObjectID:    sub.ID,
+			Name:        sub.DisplayName,
+			Description: sub.SubscriptionID,
+			Service:     ServiceSubscription,
+		})
+
+		endpoint := fmt.Sprintf("%s%s/resourcegroups?api-version=%s", armApiUrl, sub.ID, resourcesApiVersion)
+		groups, err := getAllPages[ResourceGroup](c, key, endpoint, "get azure resource groups")
+		if err != nil {
+			return apps, err
+		}
+		for _, group := range groups {
+			apps = append(apps, policyprovider.ApplicationInfo{
+				ObjectID:    group.ID,
+				Name:        group.Name,
+				Description: group.Location,
+				Service:     ServiceResourceGroup,
+			})
+		}
+
+		endpoint = fmt.Sprintf("%s%s/resources?api-version=%s", armApiUrl, sub.ID, resourcesApiVersion)
+		resources, err := getAllPages[Resource](c, key, endpoint, "get azure resources")
+		if err != nil {
+			return apps, err
+		}
+		for _, resource := range resources {
+			apps = append(apps, policyprovider.ApplicationInfo{
+				ObjectID:    resource.ID,
+				Name:        resource.Name,
+				Description: resource.Location,
+				Service:     resource.Type,
+			})
+		}
+	}
+	return apps, nil
+}
+
+func (c *rbacClient) getSubscriptions(key []byte) ([]Subscription, error) {
+	decoded, err := azurecommon.DecodeKey(key)
+	if err != nil {
+		log.Println("Unable to decode azure provider key. Error=", err)
+		return nil, err
+	}
+	if decoded.Subscription != "" {
+		endpoint := fmt.Sprintf("%s/subscriptions/%s?api-version=%s", armApiUrl, decoded.Subscription, subscriptionsApiVersion)
+		var sub Subscription
+		if err = c.getObject(key, endpoint, "get azure subscription", &sub); err != nil {
+			return nil, err
+		}
+		return []Subscription{sub}, nil
+	}
+	endpoint := fmt.Sprintf("%s/subscriptions?api-version=%s", armApiUrl, subscriptionsApiVersion)
+	return getAllPages[Subscription](c, key, endpoint, "get azure subscriptions")
+}
+
+// GetRoleDefinitions returns the built-in and custom role definitions that may be assigned at scope
+func (c *rbacClient) GetRoleDefinitions(key []byte, scope string) ([]RoleDefinition, error) {
+	endpoint := fmt.Sprintf("%s%s/providers/Microsoft.Authorization/roleDefinitions?api-version=%s", armApiUrl, scope, authorizationApiVersion)
+	return getAllPages[RoleDefinition](c, key, endpoint, "get azure role definitions")
+}
+
+// GetRoleAssignments returns the role assignments made at scope. Assignments inherited from a parent scope are not returned.
+func (c *rbacClient) GetRoleAssignments(key []byte, scope string) ([]RoleAssignment, error) {
+	endpoint := fmt.Sprintf("%s?api-version=%s&$filter=%s", roleAssignmentsUrl(scope), authorizationApiVersion, url.QueryEscape("atScope()"))
+	assignments, err := getAllPages[RoleAssignment](c, key, endpoint, "get azure role assignments")
+	if err != nil {
+		return nil, err
+	}
+	atScope := make([]RoleAssignment, 0, len(assignments))
+	for _, assignment := range assignments {
+		if strings.EqualFold(assignment.Properties.Scope, scope) {
+			atScope = append(atScope, assignment)
+		}
+	}
+	return atScope, nil
+}
+
+/*
+PutRoleAssignment creates the role assignment name (a new guid) at scope, or updates the condition of an existing
+assignment with that name.
+*/
+func (c *rbacClient) PutRoleAssignment(key []byte, scope string, name string, properties RoleAssignmentProperties) error {
+	body, _ := json.Marshal(roleAssignmentPut{Properties: properties})
+	endpoint := fmt.Sprintf("%s/%s?api-version=%s", roleAssignmentsUrl(scope), name, authorizationApiVersion)
+	request, _ := http.NewRequestWithContext(c.requestContext(), http.MethodPut, endpoint, bytes.NewReader(body))
+	response, err := c.azureRequest(key, request)
+	if err != nil {
+		log.Println("Unable to put azure role assignment. Error=", err)
+		return err
+	}
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		return azurecommon.StatusError("put azure role assignment", response)
+	}
+	return nil
+}
+
+// DeleteRoleAssignment deletes the role assignment with the resource id id
+func (c *rbacClient) DeleteRoleAssignment(key []byte, id string) error {
+	endpoint := fmt.Sprintf("%s%s?api-version=%s", armApiUrl, id, authorizationApiVersion)
+	request, _ := http.NewRequestWithContext(c.requestContext(), http.MethodDelete, endpoint, nil)
+	response, err := c.azureRequest(key, request)
+	if err != nil {
+		log.Println("Unable to delete azure role assignment. Error=", err)
+		return err
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return azurecommon.StatusError("delete azure role assignment", response)
+	}
+	return nil
+}
+
+func roleAssignmentsUrl(scope string) string {
+	return fmt.Sprintf("%s%s/providers/Microsoft.Authorization/roleAssignments", armApiUrl, scope)
+}
+
+// getObject decodes the response of a GET request to endpoint into value
+func (c *rbacClient) getObject(key []byte, endpoint string, description string, value interface{}) error {
+	request, _ := http.NewRequestWithContext(c.requestContext(), http.MethodGet, endpoint, nil)
+	get, err := c.azureRequest(key, request)
+	if err != nil {
+		log.Printf("Unable to %s. Error=%s\n", description, err.Error())
+		return err
+	}
+
+	if get.StatusCode != http.StatusOK {
+		return azurecommon.StatusError(description, get)
+	}
+
+	if err = json.NewDecoder(get.Body).Decode(value); err != nil {
+		log.Printf("Unable to decode response to %s. Error=%s\n", description, err.Error())
+		return err
+	}
+	return nil
+}
+
+// getAllPages returns the values of every page of the ARM collection at endpoint, following nextLink
+func getAllPages[T any](c *rbacClient, key []byte, endpoint string, description string) ([]T, error) {
+	return azurecommon.GetAllPages(endpoint, func(link string, page *azurecommon.Page[T]) error {
+		return c.getObject(key, link, description, page)
+	})
+}
+
+func (c *rbacClient) azureRequest(key []byte, request *http.Request) (*http.Response, error) {
+	return azurecommon.AuthorizedRequest(c.HttpClient, key, request, armScope)
+}
@@ -0,0 +1,145 @@
+package azarm_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/providers/azure/azarm"
+	"github.com/hexa-org/policy-mapper/providers/azure/azurecommon"
+	"github.com/hexa-org/policy-mapper/providers/azure/azuretestsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRbacClient_GetRbacApplications(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	m.TokenRequest("aToken")
+	m.GetSubscriptionRequest(azuretestsupport.AzureSubscription, "aSubscriptionName")
+	m.GetResourceGroupsRequest(azuretestsupport.AzureSubscription, []azarm.ResourceGroup{
+		{ID: azuretestsupport.ArmResourceGroupScope, Name: "aResourceGroup", Location: "eastus"},
+	})
+	m.GetResourcesRequest(azuretestsupport.AzureSubscription, []azarm.Resource{
+		{ID: azuretestsupport.ArmStorageScope, Name: "aStorageAccount", Type: "Microsoft.Storage/storageAccounts", Location: "eastus"},
+	})
+
+	apps, err := m.RbacClient().GetRbacApplications(azuretestsupport.AzureKeyBytes())
+	assert.NoError(t, err)
+	assert.Equal(t, []policyprovider.ApplicationInfo{
+		{ObjectID: azuretestsupport.ArmSubscriptionScope, Name: "aSubscriptionName", Description: azuretestsupport.AzureSubscription, Service: azarm.ServiceSubscription},
+		{ObjectID: azuretestsupport.ArmResourceGroupScope, Name: "aResourceGroup", Description: "eastus", Service: azarm.ServiceResourceGroup},
+		{ObjectID: azuretestsupport.ArmStorageScope, Name: "aStorageAccount", Description: "eastus", Service: "Microsoft.Storage/storageAccounts"},
+	}, apps)
+	assert.True(t, m.TokenCalled())
+}
+
+func TestRbacClient_GetRbacApplications_AllSubscriptions(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	m.TokenRequest("aToken")
+	m.GetSubscriptionsRequest([]azarm.Subscription{
+		{ID: "/subscriptions/sub1", SubscriptionID: "sub1", DisplayName: "one"},
+		{ID: "/subscriptions/sub2", SubscriptionID: "sub2", DisplayName: "two"},
+	})
+	for _, sub := range []string{"sub1", "sub2"} {
+		m.GetResourceGroupsRequest(sub, nil)
+		m.GetResourcesRequest(sub, nil)
+	}
+
+	key := azuretestsupport.AzureKey()
+	key.Subscription = ""
+	keyBytes, _ := json.Marshal(key)
+	apps, err := m.RbacClient().GetRbacApplications(keyBytes)
+	assert.NoError(t, err)
+	assert.Len(t, apps, 2)
+	assert.Equal(t, "/subscriptions/sub2", apps[1].ObjectID)
+	assert.True(t, m.MockHttpClient.VerifyCalled())
+}
+
+func TestRbacClient_GetRbacApplications_Errors(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	m.TokenRequest("aToken")
+	m.ErrorRequest(http.MethodGet, m.GetSubscriptionUrl(azuretestsupport.AzureSubscription), http.StatusForbidden,
+		[]byte(`{"error": {"code": "AuthorizationFailed", "message": "no access"}}`))
+
+	_, err := m.RbacClient().GetRbacApplications(azuretestsupport.AzureKeyBytes())
+	assert.EqualError(t, err, "unable to get azure subscription. Unexpected status 403 (AuthorizationFailed: no access)")
+
+	_, err = m.RbacClient().GetRbacApplications([]byte("bad key"))
+	assert.ErrorContains(t, err, "invalid character 'b'")
+
+	m.GetSubscriptionRequest(azuretestsupport.AzureSubscription, "aSubscriptionName")
+	m.ErrorRequest(http.MethodGet, m.GetResourceGroupsUrl(azuretestsupport.AzureSubscription), http.StatusInternalServerError, nil)
+	apps, err := m.RbacClient().GetRbacApplications(azuretestsupport.AzureKeyBytes())
+	assert.EqualError(t, err, "unable to get azure resource groups. Unexpected status 500")
+	assert.Len(t, apps, 1)
+}
+
+func TestRbacClient_GetRoleAssignments(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	m.TokenRequest("aToken")
+	scope := azuretestsupport.ArmResourceGroupScope
+	nextUrl := m.GetRoleAssignmentsUrl(scope) + "&$skipToken=page2"
+	m.GetRoleAssignmentsPageRequest(m.GetRoleAssignmentsUrl(scope), []azarm.RoleAssignment{
+		azuretestsupport.RoleAssignment(scope, "a1", azuretestsupport.ArmReaderRole, azarm.PrincipalTypeUser, "user1", ""),
+		// inherited from the subscription
+		azuretestsupport.RoleAssignment(azuretestsupport.ArmSubscriptionScope, "a2", azuretestsupport.ArmReaderRole, azarm.PrincipalTypeUser, "user2", ""),
+	}, nextUrl)
+	m.GetRoleAssignmentsPageRequest(nextUrl, []azarm.RoleAssignment{
+		azuretestsupport.RoleAssignment(scope, "a3", azuretestsupport.ArmBlobReaderRole, azarm.PrincipalTypeGroup, "group1", "@Resource[tags:Project] StringEquals 'Alpine'"),
+	}, "")
+
+	assignments, err := m.RbacClient().GetRoleAssignments(azuretestsupport.AzureKeyBytes(), scope)
+	assert.NoError(t, err)
+	assert.Len(t, assignments, 2)
+	assert.Equal(t, "a1", assignments[0].Name)
+	assert.Equal(t, "a3", assignments[1].Name)
+	assert.Equal(t, "@Resource[tags:Project] StringEquals 'Alpine'", assignments[1].Properties.Condition)
+}
+
+func TestRbacClient_GetRoleDefinitions(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	m.TokenRequest("aToken")
+	m.GetRoleDefinitionsRequest(azuretestsupport.ArmStorageScope)
+
+	roles, err := m.RbacClient().GetRoleDefinitions(azuretestsupport.AzureKeyBytes(), azuretestsupport.ArmStorageScope)
+	assert.NoError(t, err)
+	assert.Equal(t, []azarm.RoleDefinition{azuretestsupport.ArmReaderRole, azuretestsupport.ArmBlobReaderRole}, roles)
+}
+
+func TestRbacClient_PutAndDeleteRoleAssignment(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	m.TokenRequest("aToken")
+	scope := azuretestsupport.ArmStorageScope
+	assignment := azuretestsupport.RoleAssignment(scope, "a1", azuretestsupport.ArmBlobReaderRole, azarm.PrincipalTypeUser, "user1", "")
+	m.PutRoleAssignmentRequest(scope, "a1")
+	m.DeleteRoleAssignmentRequest(assignment)
+
+	properties := azarm.RoleAssignmentProperties{
+		RoleDefinitionId: azuretestsupport.ArmBlobReaderRole.ID,
+		PrincipalId:      "user1",
+		PrincipalType:    azarm.PrincipalTypeUser,
+		Condition:        "@Resource[tags:Project] StringEquals 'Alpine'",
+		ConditionVersion: "2.0",
+	}
+	client := m.RbacClient()
+	assert.NoError(t, client.PutRoleAssignment(azuretestsupport.AzureKeyBytes(), scope, "a1", properties))
+	assert.True(t, m.PutRoleAssignmentCalled(scope, "a1"))
+	assert.Equal(t, properties, m.PutRoleAssignmentBody(scope, "a1"))
+
+	assert.NoError(t, client.DeleteRoleAssignment(azuretestsupport.AzureKeyBytes(), assignment.ID))
+	assert.True(t, m.DeleteRoleAssignmentCalled(assignment))
+
+	m.ErrorRequest(http.MethodPut, m.RoleAssignmentUrl(scope, "a2"), http.StatusConflict,
+		[]byte(`{"error": {"code": "RoleAssignmentExists", "message": "The role assignment already exists."}}`))
+	err := client.PutRoleAssignment(azuretestsupport.AzureKeyBytes(), scope, "a2", properties)
+	assert.EqualError(t, err, "unable to put azure role assignment. Unexpected status 409 (RoleAssignmentExists: The role assignment already exists.)")
+
+	m.ErrorRequest(http.MethodDelete, m.RoleAssignmentUrl(scope, "a3"), http.StatusForbidden, nil)
+	err = client.DeleteRoleAssignment(azuretestsupport.AzureKeyBytes(), scope+"/providers/Microsoft.Authorization/roleAssignments/a3")
+	assert.EqualError(t, err, "unable to delete azure role assignment. Unexpected status 403")
+}
+
+func TestNewRbacClient(t *testing.T) {
+	var httpClient azurecommon.HTTPClient
+	assert.NotNil(t, azarm.NewRbacClient(httpClient))
+}
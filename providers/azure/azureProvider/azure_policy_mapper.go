@@ -11,10 +11,14 @@ type AzurePolicyMapper struct {
     objectId             string
     roleIdToAppRole      map[string]azad.AzureAppRole
     existingRoleIdToAras map[string][]azad.AzureAppRoleAssignment
-    azureUserEmail       map[string]string
+    principalNames       map[string]string
 }
 
-func NewAzurePolicyMapper(sps azad.AzureServicePrincipals, existingAssignments []azad.AzureAppRoleAssignment, azureUserEmail map[string]string) *AzurePolicyMapper {
+/*
+NewAzurePolicyMapper maps the app roles of sps and their assignments to IDQL. principalNames holds the email of each
+assigned user and the application id of each assigned service principal, by principal id.
+*/
+func NewAzurePolicyMapper(sps azad.AzureServicePrincipals, existingAssignments []azad.AzureAppRoleAssignment, principalNames map[string]string) *AzurePolicyMapper {
     if len(sps.List) == 0 {
         return &AzurePolicyMapper{}
     }
@@ -23,7 +27,7 @@ func NewAzurePolicyMapper(sps azad.AzureServicePrincipals, existingAssignments [
         objectId:             sps.List[0].Name,
         roleIdToAppRole:      mapAppRoles(sps.List[0].AppRoles),
         existingRoleIdToAras: mapAppRoleAssignments(existingAssignments),
-        azureUserEmail:       azureUserEmail}
+        principalNames:       principalNames}
 }
 
 func (azm *AzurePolicyMapper) ToIDQL() []hexapolicy.PolicyInfo {
@@ -40,11 +44,20 @@ func (azm *AzurePolicyMapper) appRoleAssignmentToIDQL(assignments []azad.AzureAp
 
     members := make([]string, 0)
     for _, oneAssignment := range assignments {
-        email := azm.azureUserEmail[oneAssignment.PrincipalId]
-        if email != "" {
-            members = append(members, fmt.Sprintf("user:%s", email))
+        switch oneAssignment.PrincipalType {
+        case azad.PrincipalTypeGroup:
+            if oneAssignment.PrincipalDisplayName != "" {
+                members = append(members, SubjectPrefixGroup+oneAssignment.PrincipalDisplayName)
+            }
+        case azad.PrincipalTypeServicePrincipal:
+            if appId := azm.principalNames[oneAssignment.PrincipalId]; appId != "" {
+                members = append(members, SubjectPrefixServicePrincipal+appId)
+            }
+        default:
+            if email := azm.principalNames[oneAssignment.PrincipalId]; email != "" {
+                members = append(members, fmt.Sprintf("user:%s", email))
+            }
         }
-
     }
 
     sourceData := make(map[string]interface{}, 2)
@@ -1,6 +1,7 @@
 package azureProvider
 
 import (
+    "context"
     "errors"
     "log"
     "net/http"
@@ -15,6 +16,16 @@ import (
 
 const ProviderTypeAzure string = "azure"
 
+// Subject prefixes of the Azure principals that may be assigned app roles
+const (
+    SubjectPrefixUser             string = "user:"  // user:<email>
+    SubjectPrefixGroup            string = "group:" // group:<display name>
+    SubjectPrefixServicePrincipal string = "sp:"    // sp:<application (client) id>
+)
+
+// maxConcurrentLookups limits the number of concurrent Graph requests made to resolve principals
+const maxConcurrentLookups = 10
+
 type AzureProvider struct {
     client azad.AzureClient
 }
@@ -43,43 +54,121 @@ func (a *AzureProvider) Name() string {
     return ProviderTypeAzure
 }
 
+// Capabilities reports that a policy assigns its users, groups, and service principals to the app roles named by its actions
+func (a *AzureProvider) Capabilities() policyprovider.Capabilities {
+    return policyprovider.Capabilities{
+        MultipleActions: true,
+        SubjectTypes:    []string{SubjectPrefixUser, SubjectPrefixGroup, SubjectPrefixServicePrincipal},
+    }
+}
+
 func (a *AzureProvider) DiscoverApplications(info policyprovider.IntegrationInfo) (apps []policyprovider.ApplicationInfo, err error) {
     if !strings.EqualFold(info.Name, a.Name()) {
         return apps, err
     }
 
     key := info.Key
-    found, _ := a.client.GetWebApplications(key)
+    found, err := a.client.GetWebApplications(key)
     apps = append(apps, found...)
     return apps, err
 }
 
+// withContext returns a copy of the provider whose client requests are made with ctx (see azad.ContextClient)
+func (a *AzureProvider) withContext(ctx context.Context) (*AzureProvider, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    bound := *a
+    if client, ok := a.client.(azad.ContextClient); ok {
+        bound.client = client.WithContext(ctx)
+    }
+    return &bound, nil
+}
+
+func (a *AzureProvider) DiscoverApplicationsContext(ctx context.Context, info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
+    bound, err := a.withContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return bound.DiscoverApplications(info)
+}
+
+func (a *AzureProvider) GetPolicyInfoContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+    bound, err := a.withContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return bound.GetPolicyInfo(integration, app)
+}
+
+func (a *AzureProvider) SetPolicyInfoContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+    bound, err := a.withContext(ctx)
+    if err != nil {
+        return http.StatusInternalServerError, err
+    }
+    return bound.SetPolicyInfo(integration, app, policyInfos)
+}
+
 func (a *AzureProvider) GetPolicyInfo(integrationInfo policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
     key := integrationInfo.Key
-    servicePrincipals, _ := a.client.GetServicePrincipals(key, applicationInfo.Description) // todo - description is named poorly
+    servicePrincipals, err := a.client.GetServicePrincipals(key, applicationInfo.Description) // todo - description is named poorly
+    if err != nil {
+        return nil, err
+    }
     if len(servicePrincipals.List) == 0 {
         return []hexapolicy.PolicyInfo{}, nil
     }
-    assignments, _ := a.client.GetAppRoleAssignedTo(key, servicePrincipals.List[0].ID)
+    assignments, err := a.client.GetAppRoleAssignedTo(key, servicePrincipals.List[0].ID)
+    if err != nil {
+        return nil, err
+    }
 
-    userEmailList := workflowsupport.ProcessAsync[azad.AzureUser, azad.AzureAppRoleAssignment](assignments.List, func(ara azad.AzureAppRoleAssignment) (azad.AzureUser, error) {
-        user, _ := a.client.GetUserInfoFromPrincipalId(key, ara.PrincipalId)
+    principalNames, err := a.principalNames(key, assignments.List)
+    if err != nil {
+        return nil, err
+    }
 
-        if user.Email == "" {
-            return azad.AzureUser{}, errors.New("no email found for principalId " + ara.PrincipalId)
+    policyMapper := NewAzurePolicyMapper(servicePrincipals, assignments.List, principalNames)
+    return policyMapper.ToIDQL(), nil
+}
+
+/*
+principalNames returns the email of each assigned user and the application id of each assigned service principal, by
+principal id. Users without an email are omitted. Group assignments are named by their principalDisplayName and are
+not looked up.
+*/
+func (a *AzureProvider) principalNames(key []byte, assignments []azad.AzureAppRoleAssignment) (map[string]string, error) {
+    var principals []azad.AzureAppRoleAssignment
+    seen := make(map[string]bool)
+    for _, ara := range assignments {
+        if ara.PrincipalType == azad.PrincipalTypeGroup || seen[ara.PrincipalId] {
+            continue
         }
-        return azad.AzureUser{PrincipalId: ara.PrincipalId, Email: user.Email}, nil
-    })
+        seen[ara.PrincipalId] = true
+        principals = append(principals, ara)
+    }
 
-    userEmailMap := make(map[string]string)
-    for _, ue := range userEmailList {
-        if ue.PrincipalId != "" && ue.Email != "" {
-            userEmailMap[ue.PrincipalId] = ue.Email
+    names, err := workflowsupport.ProcessAsyncWithLimit[string, azad.AzureAppRoleAssignment](principals, maxConcurrentLookups, func(ara azad.AzureAppRoleAssignment) (string, error) {
+        if ara.PrincipalType == azad.PrincipalTypeServicePrincipal {
+            return a.client.GetServicePrincipalAppId(key, ara.PrincipalId)
         }
+        user, err := a.client.GetUserInfoFromPrincipalId(key, ara.PrincipalId)
+        if err == nil && user.Email == "" {
+            log.Println("no email found for principalId " + ara.PrincipalId)
+        }
+        return user.Email, err
+    })
+    if err != nil {
+        return nil, err
     }
 
-    policyMapper := NewAzurePolicyMapper(servicePrincipals, assignments.List, userEmailMap)
-    return policyMapper.ToIDQL(), nil
+    principalNames := make(map[string]string)
+    for i, name := range names {
+        if name != "" {
+            principalNames[principals[i].PrincipalId] = name
+        }
+    }
+    return principalNames, nil
 }
 
 func (a *AzureProvider) SetPolicyInfo(integrationInfo policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
@@ -95,51 +184,156 @@ func (a *AzureProvider) SetPolicyInfo(integrationInfo policyprovider.Integration
 
     key := integrationInfo.Key
 
-    sps, _ := a.client.GetServicePrincipals(key, applicationInfo.Description) // todo - description is named poorly
+    sps, err := a.client.GetServicePrincipals(key, applicationInfo.Description) // todo - description is named poorly
+    if err != nil {
+        return http.StatusInternalServerError, err
+    }
+    if len(sps.List) == 0 {
+        return http.StatusInternalServerError, errors.New("no Azure service principal found for " + applicationInfo.Description)
+    }
+
+    policyAssignments, err := a.mapAssignments(key, sps, policyInfos, nil)
+    if err != nil {
+        return http.StatusInternalServerError, err
+    }
 
+    // Assignments are set one app role at a time so that policies sharing an app role do not remove each other's members
+    var appRoleIds []string
+    roleAssignments := make(map[string][]azad.AzureAppRoleAssignment)
+    for _, assignments := range policyAssignments {
+        for _, assignment := range assignments {
+            if _, ok := roleAssignments[assignment.AppRoleId]; !ok {
+                appRoleIds = append(appRoleIds, assignment.AppRoleId)
+            }
+            roleAssignments[assignment.AppRoleId] = append(roleAssignments[assignment.AppRoleId], assignment)
+        }
+    }
+
+    for _, appRoleId := range appRoleIds {
+        err = a.client.SetAppRoleAssignedTo(key, sps.List[0].ID, roleAssignments[appRoleId])
+        if err != nil {
+            return http.StatusInternalServerError, err
+        }
+    }
+    return http.StatusCreated, nil
+}
+
+/*
+MapPolicyReport reports how policyInfos are represented as Azure app role assignments (see policyprovider.MappingReporter).
+Subjects are resolved against Azure AD, but no assignments are changed.
+*/
+func (a *AzureProvider) MapPolicyReport(integrationInfo policyprovider.IntegrationInfo, applicationInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+    key := integrationInfo.Key
+    sps, err := a.client.GetServicePrincipals(key, applicationInfo.Description)
+    if err != nil {
+        return nil, err
+    }
+    if len(sps.List) == 0 {
+        return nil, errors.New("no Azure service principal found for " + applicationInfo.Description)
+    }
+    report := hexapolicy.NewMappingReport(a.Name())
+    if _, err = a.mapAssignments(key, sps, policyInfos, report); err != nil {
+        return nil, err
+    }
+    return report, nil
+}
+
+/*
+mapAssignments returns the app role assignments for each policy, assigning each subject to the app role of each action.
+Elements that cannot be assigned are recorded in report. An error is returned if a subject cannot be looked up.
+*/
+func (a *AzureProvider) mapAssignments(key []byte, sps azad.AzureServicePrincipals, policyInfos []hexapolicy.PolicyInfo, report *hexapolicy.MappingReport) ([][]azad.AzureAppRoleAssignment, error) {
     appRoleValueToId := make(map[string]string)
     for _, ara := range sps.List[0].AppRoles {
         appRoleValueToId[ara.Value] = ara.ID
     }
+    principalIds := make(map[string]string) // principal ids by subject, as subjects are often repeated across policies
 
-    for _, policyInfo := range policyInfos {
+    policyAssignments := make([][]azad.AzureAppRoleAssignment, len(policyInfos))
+    for i, policyInfo := range policyInfos {
         var assignments []azad.AzureAppRoleAssignment
 
-        actionUri := strings.TrimPrefix(string(policyInfo.Actions[0]), "azure:")
-        appRoleId, found := appRoleValueToId[actionUri]
-        if !found {
-            log.Println("No Azure AppRoleAssignment found for policy action", actionUri)
+        if len(policyInfo.Actions) == 0 {
+            report.Dropped(i, policyInfo, hexapolicy.MapElementPolicy, "policy has no action (app role)")
+            continue
+        }
+        var appRoleIds, unknownActions []string
+        for _, action := range policyInfo.Actions {
+            actionUri := strings.TrimPrefix(string(action), "azure:")
+            appRoleId, found := appRoleValueToId[actionUri]
+            if !found {
+                log.Println("No Azure AppRoleAssignment found for policy action", actionUri)
+                unknownActions = append(unknownActions, actionUri)
+                continue
+            }
+            appRoleIds = append(appRoleIds, appRoleId)
+        }
+        if len(appRoleIds) == 0 {
+            report.Dropped(i, policyInfo, hexapolicy.MapElementPolicy, "no Azure app role found for action "+strings.Join(unknownActions, ", "))
             continue
         }
+        report.ExactPolicy(i, policyInfo)
+        for _, actionUri := range unknownActions {
+            report.Dropped(i, policyInfo, hexapolicy.CompareDifAction, "no Azure app role found for action "+actionUri)
+        }
+        if policyInfo.Condition != nil {
+            report.Dropped(i, policyInfo, hexapolicy.CompareDifCondition, "Azure app role assignments do not support conditions")
+        }
 
         if len(policyInfo.Subjects) == 0 {
-            assignments = append(assignments, azad.AzureAppRoleAssignment{
-                AppRoleId:  appRoleId,
-                ResourceId: sps.List[0].ID,
-            })
+            for _, appRoleId := range appRoleIds {
+                assignments = append(assignments, azad.AzureAppRoleAssignment{
+                    AppRoleId:  appRoleId,
+                    ResourceId: sps.List[0].ID,
+                })
+            }
         }
 
-        for _, user := range policyInfo.Subjects {
-            principalId, _ := a.client.GetPrincipalIdFromEmail(key, strings.Split(user, ":")[1])
+        for _, subject := range policyInfo.Subjects {
+            principalId, found := principalIds[subject]
+            if !found {
+                var err error
+                principalId, err = a.principalId(key, subject)
+                if err != nil {
+                    return nil, err
+                }
+                principalIds[subject] = principalId
+            }
             if principalId == "" {
+                report.Dropped(i, policyInfo, hexapolicy.CompareDifSubject, a.unassignableReason(subject))
                 continue
             }
-            assignments = append(assignments, azad.AzureAppRoleAssignment{
-                AppRoleId:   appRoleId,
-                PrincipalId: principalId,
-                ResourceId:  sps.List[0].ID,
-                // ResourceId:  strings.Split(policyInfo.Object.ResourceID, ":")[0],
-            })
+            for _, appRoleId := range appRoleIds {
+                assignments = append(assignments, azad.AzureAppRoleAssignment{
+                    AppRoleId:   appRoleId,
+                    PrincipalId: principalId,
+                    ResourceId:  sps.List[0].ID,
+                })
+            }
         }
+        policyAssignments[i] = assignments
+    }
+    return policyAssignments, nil
+}
 
-        if len(assignments) == 0 {
-            continue
-        }
+// principalId looks up the Azure principal of subject, returning "" if the subject has an unknown form or is not found
+func (a *AzureProvider) principalId(key []byte, subject string) (string, error) {
+    switch {
+    case strings.HasPrefix(subject, SubjectPrefixUser):
+        return a.client.GetPrincipalIdFromEmail(key, strings.TrimPrefix(subject, SubjectPrefixUser))
+    case strings.HasPrefix(subject, SubjectPrefixGroup):
+        return a.client.GetGroupIdFromName(key, strings.TrimPrefix(subject, SubjectPrefixGroup))
+    case strings.HasPrefix(subject, SubjectPrefixServicePrincipal):
+        return a.client.GetPrincipalIdFromAppId(key, strings.TrimPrefix(subject, SubjectPrefixServicePrincipal))
+    }
+    return "", nil
+}
 
-        err := a.client.SetAppRoleAssignedTo(key, sps.List[0].ID, assignments)
-        if err != nil {
-            return http.StatusInternalServerError, err
+func (a *AzureProvider) unassignableReason(subject string) string {
+    for _, prefix := range []string{SubjectPrefixUser, SubjectPrefixGroup, SubjectPrefixServicePrincipal} {
+        if strings.HasPrefix(subject, prefix) {
+            return "no Azure principal found for subject " + subject
         }
     }
-    return http.StatusCreated, nil
+    return "subject " + subject + " is not of the form user:<email>, group:<name>, or sp:<appId>"
 }
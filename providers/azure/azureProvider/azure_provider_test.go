@@ -1,6 +1,7 @@
 package azureProvider_test
 
 import (
+    "errors"
     "log"
     "net/http"
     "testing"
@@ -8,6 +9,7 @@ import (
     "github.com/hexa-org/policy-mapper/api/policyprovider"
     "github.com/hexa-org/policy-mapper/models/rar/testsupport/policytestsupport"
     "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+    "github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
     "github.com/hexa-org/policy-mapper/providers/azure/azad"
     "github.com/hexa-org/policy-mapper/providers/azure/azureProvider"
     "github.com/hexa-org/policy-mapper/providers/azure/azuretestsupport"
@@ -384,3 +386,183 @@ func TestSetPolicy_MultipleAppRolePolicies(t *testing.T) {
     assert.Equal(t, http.StatusCreated, status)
     mockAzClient.AssertExpectations(t)
 }
+
+func TestMapPolicyReport(t *testing.T) {
+    appId := azuretestsupport.AzureAppId
+    key := azuretestsupport.AzureKeyBytes()
+
+    mockAzClient := azuretestsupport.NewMockAzureClient()
+    mockAzClient.ExpectGetServicePrincipals()
+    mockAzClient.ExpectGetPrincipalIdFromEmail(policytestsupport.UserEmailGetHrUs, policytestsupport.UserIdGetHrUs)
+    mockAzClient.ExpectGetPrincipalIdFromEmail(policytestsupport.UserEmailGetProfile, "")
+
+    p := azureProvider.NewAzureProvider(azureProvider.WithAzureClient(mockAzClient))
+    report, err := p.MapPolicyReport(
+        policyprovider.IntegrationInfo{Name: "azure", Key: key},
+        policyprovider.ApplicationInfo{ObjectID: "anObjectId", Name: "anAppName", Description: appId},
+        []hexapolicy.PolicyInfo{{
+            Meta:      hexapolicy.MetaInfo{Version: "0"},
+            Actions:   []hexapolicy.ActionInfo{"azure:" + policytestsupport.ActionGetHrUs, "azure:" + policytestsupport.ActionGetProfile},
+            Subjects:  []string{"user:" + policytestsupport.UserEmailGetHrUs, "user:" + policytestsupport.UserEmailGetProfile},
+            Condition: &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: conditions.AAllow},
+            Object:    policytestsupport.PolicyObjectResourceId,
+        }, {
+            Meta:     hexapolicy.MetaInfo{Version: "0"},
+            Actions:  []hexapolicy.ActionInfo{"azure:unknownRole"},
+            Subjects: []string{"user:" + policytestsupport.UserEmailGetHrUs},
+            Object:   policytestsupport.PolicyObjectResourceId,
+        }})
+
+    assert.NoError(t, err)
+    mockAzClient.AssertExpectations(t)
+    assert.Equal(t, azureProvider.ProviderTypeAzure, report.Target)
+    assert.Equal(t, []string{
+        "policy 0: SUBJECT DROPPED - no Azure principal found for subject user:" + policytestsupport.UserEmailGetProfile,
+        "policy 0: CONDITION DROPPED - Azure app role assignments do not support conditions",
+        "policy 1: POLICY DROPPED - no Azure app role found for action unknownRole",
+    }, report.Issues())
+}
+
+func TestMapPolicyReport_UnassignableSubjects(t *testing.T) {
+    key := azuretestsupport.AzureKeyBytes()
+
+    mockAzClient := azuretestsupport.NewMockAzureClient()
+    mockAzClient.ExpectGetServicePrincipals()
+
+    p := azureProvider.NewAzureProvider(azureProvider.WithAzureClient(mockAzClient))
+    report, err := p.MapPolicyReport(
+        policyprovider.IntegrationInfo{Name: "azure", Key: key},
+        policyprovider.ApplicationInfo{ObjectID: "anObjectId", Name: "anAppName", Description: azuretestsupport.AzureAppId},
+        []hexapolicy.PolicyInfo{{
+            Meta:     hexapolicy.MetaInfo{Version: "0"},
+            Actions:  []hexapolicy.ActionInfo{"azure:" + policytestsupport.ActionGetHrUs, "azure:unknownRole"},
+            Subjects: []string{"role:admin"},
+            Object:   policytestsupport.PolicyObjectResourceId,
+        }})
+
+    assert.NoError(t, err)
+    mockAzClient.AssertExpectations(t)
+    assert.Equal(t, []string{
+        "policy 0: SUBJECT DROPPED - subject role:admin is not of the form user:<email>, group:<name>, or sp:<appId>",
+        "policy 0: ACTION DROPPED - no Azure app role found for action unknownRole",
+    }, report.Issues())
+}
+
+func TestGetPolicy_GroupAndServicePrincipalAssignees(t *testing.T) {
+    key := azuretestsupport.AzureKeyBytes()
+
+    group := azuretestsupport.NewAppRoleAssignments(azuretestsupport.AppRoleIdGetHrUs, "group-id")
+    group.PrincipalType = azad.PrincipalTypeGroup
+    group.PrincipalDisplayName = "HR Admins"
+    sp := azuretestsupport.NewAppRoleAssignments(azuretestsupport.AppRoleIdGetHrUs, "sp-principal-id")
+    sp.PrincipalType = azad.PrincipalTypeServicePrincipal
+    user := azuretestsupport.NewAppRoleAssignments(azuretestsupport.AppRoleIdGetHrUs, policytestsupport.UserIdGetHrUs)
+    user.PrincipalType = azad.PrincipalTypeUser
+
+    mockAzClient := azuretestsupport.NewMockAzureClient()
+    mockAzClient.ExpectGetServicePrincipals()
+    mockAzClient.ExpectAppRoleAssignedTo([]azad.AzureAppRoleAssignment{group, sp, user})
+    mockAzClient.ExpectGetServicePrincipalAppId("sp-principal-id", "sp-app-id")
+    mockAzClient.ExpectGetUserInfoFromPrincipalId(policytestsupport.UserIdGetHrUs)
+
+    p := azureProvider.NewAzureProvider(azureProvider.WithAzureClient(mockAzClient))
+    policies, err := p.GetPolicyInfo(
+        policyprovider.IntegrationInfo{Name: "azure", Key: key},
+        policyprovider.ApplicationInfo{ObjectID: "anObjectId", Name: "anAppName", Description: azuretestsupport.AzureAppId})
+
+    assert.NoError(t, err)
+    mockAzClient.AssertExpectations(t)
+    for _, pol := range policies {
+        if pol.Actions[0].String() == policytestsupport.ActionGetHrUs {
+            assert.Equal(t, hexapolicy.SubjectInfo{"group:HR Admins", "sp:sp-app-id", "user:" + policytestsupport.UserEmailGetHrUs}, pol.Subjects)
+        } else {
+            assert.Empty(t, pol.Subjects)
+        }
+    }
+}
+
+func TestGetPolicy_Errors(t *testing.T) {
+    key := azuretestsupport.AzureKeyBytes()
+    info := policyprovider.IntegrationInfo{Name: "azure", Key: key}
+    appInfo := policyprovider.ApplicationInfo{ObjectID: "anObjectId", Name: "anAppName", Description: azuretestsupport.AzureAppId}
+
+    mockAzClient := azuretestsupport.NewMockAzureClient()
+    mockAzClient.On("GetServicePrincipals", key, azuretestsupport.AzureAppId).
+        Return(azad.AzureServicePrincipals{}, errors.New("service principals unavailable"))
+    p := azureProvider.NewAzureProvider(azureProvider.WithAzureClient(mockAzClient))
+    _, err := p.GetPolicyInfo(info, appInfo)
+    assert.EqualError(t, err, "service principals unavailable")
+
+    mockAzClient = azuretestsupport.NewMockAzureClient()
+    mockAzClient.ExpectGetServicePrincipals()
+    mockAzClient.On("GetAppRoleAssignedTo", key, azuretestsupport.ServicePrincipalId).
+        Return(azad.AzureAppRoleAssignments{}, errors.New("assignments unavailable"))
+    p = azureProvider.NewAzureProvider(azureProvider.WithAzureClient(mockAzClient))
+    _, err = p.GetPolicyInfo(info, appInfo)
+    assert.EqualError(t, err, "assignments unavailable")
+
+    mockAzClient = azuretestsupport.NewMockAzureClient()
+    mockAzClient.ExpectGetServicePrincipals()
+    mockAzClient.ExpectAppRoleAssignedTo(azuretestsupport.AppRoleAssignmentGetHrUs)
+    mockAzClient.On("GetUserInfoFromPrincipalId", key, policytestsupport.UserIdGetHrUs).
+        Return(azad.AzureUser{}, errors.New("user unavailable"))
+    p = azureProvider.NewAzureProvider(azureProvider.WithAzureClient(mockAzClient))
+    _, err = p.GetPolicyInfo(info, appInfo)
+    assert.EqualError(t, err, "user unavailable")
+}
+
+func TestSetPolicy_MultipleActionsGroupsAndServicePrincipals(t *testing.T) {
+    key := azuretestsupport.AzureKeyBytes()
+
+    mockAzClient := azuretestsupport.NewMockAzureClient()
+    mockAzClient.ExpectGetServicePrincipals()
+    mockAzClient.ExpectGetGroupIdFromName("HR Admins", "group-id")
+    mockAzClient.ExpectGetPrincipalIdFromAppId("sp-app-id", "sp-principal-id")
+    mockAzClient.ExpectSetAppRoleAssignedTo([]azad.AzureAppRoleAssignment{
+        azuretestsupport.NewAppRoleAssignments(azuretestsupport.AppRoleIdGetHrUs, "group-id"),
+        azuretestsupport.NewAppRoleAssignments(azuretestsupport.AppRoleIdGetHrUs, "sp-principal-id"),
+    })
+    mockAzClient.ExpectSetAppRoleAssignedTo([]azad.AzureAppRoleAssignment{
+        azuretestsupport.NewAppRoleAssignments(azuretestsupport.AppRoleIdGetProfile, "group-id"),
+        azuretestsupport.NewAppRoleAssignments(azuretestsupport.AppRoleIdGetProfile, "sp-principal-id"),
+    })
+
+    p := azureProvider.NewAzureProvider(azureProvider.WithAzureClient(mockAzClient))
+    status, err := p.SetPolicyInfo(
+        policyprovider.IntegrationInfo{Name: "azure", Key: key},
+        policyprovider.ApplicationInfo{ObjectID: "anObjectId", Name: "anAppName", Description: azuretestsupport.AzureAppId},
+        []hexapolicy.PolicyInfo{{
+            Meta:     hexapolicy.MetaInfo{Version: "0"},
+            Actions:  []hexapolicy.ActionInfo{"azure:" + policytestsupport.ActionGetHrUs, "azure:" + policytestsupport.ActionGetProfile},
+            Subjects: []string{"group:HR Admins", "sp:sp-app-id"},
+            Object:   policytestsupport.PolicyObjectResourceId,
+        }})
+
+    assert.NoError(t, err)
+    assert.Equal(t, http.StatusCreated, status)
+    mockAzClient.AssertExpectations(t)
+}
+
+func TestSetPolicy_LookupError(t *testing.T) {
+    key := azuretestsupport.AzureKeyBytes()
+
+    mockAzClient := azuretestsupport.NewMockAzureClient()
+    mockAzClient.ExpectGetServicePrincipals()
+    mockAzClient.On("GetPrincipalIdFromEmail", key, policytestsupport.UserEmailGetHrUs).
+        Return("", errors.New("unable to get principal id"))
+
+    p := azureProvider.NewAzureProvider(azureProvider.WithAzureClient(mockAzClient))
+    status, err := p.SetPolicyInfo(
+        policyprovider.IntegrationInfo{Name: "azure", Key: key},
+        policyprovider.ApplicationInfo{ObjectID: "anObjectId", Name: "anAppName", Description: azuretestsupport.AzureAppId},
+        []hexapolicy.PolicyInfo{{
+            Meta:     hexapolicy.MetaInfo{Version: "0"},
+            Actions:  []hexapolicy.ActionInfo{"azure:" + policytestsupport.ActionGetHrUs},
+            Subjects: []string{"user:" + policytestsupport.UserEmailGetHrUs},
+            Object:   policytestsupport.PolicyObjectResourceId,
+        }})
+
+    assert.EqualError(t, err, "unable to get principal id")
+    assert.Equal(t, http.StatusInternalServerError, status)
+    mockAzClient.AssertExpectations(t)
+}
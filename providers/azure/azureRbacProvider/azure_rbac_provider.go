@@ -0,0 +1,580 @@
+package azureRbacProvider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/conditionLangs/azureConditions"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/providers/azure/azarm"
+)
+
+const ProviderTypeAzureRbac string = "azure_rbac"
+
+// ActionPrefix is the prefix of policy actions naming an Azure role (e.g. azure:Storage Blob Data Reader)
+const ActionPrefix = "azure:"
+
+// Subject prefixes of the Azure principals that may be assigned roles. Each is followed by the principal's object id.
+const (
+	SubjectPrefixUser             string = "user:"
+	SubjectPrefixGroup            string = "group:"
+	SubjectPrefixServicePrincipal string = "sp:"
+	SubjectPrefixPrincipal        string = "principal:" // a principal of another type (e.g. a foreign group)
+)
+
+var subjectPrincipalTypes = map[string]string{
+	SubjectPrefixUser:             azarm.PrincipalTypeUser,
+	SubjectPrefixGroup:            azarm.PrincipalTypeGroup,
+	SubjectPrefixServicePrincipal: azarm.PrincipalTypeServicePrincipal,
+	SubjectPrefixPrincipal:        "",
+}
+
+/*
+AzureRbacProvider manages the Azure RBAC role assignments of subscriptions, resource groups and resources. Each is a
+policy application point whose ObjectID is its ARM scope (e.g. /subscriptions/{id}/resourceGroups/{name}). A policy
+assigns its subjects the roles named by its actions at that scope, optionally limited by a role assignment condition.
+*/
+type AzureRbacProvider struct {
+	client          azarm.RbacClient
+	conditionMapper *azureConditions.AzureConditionMapper
+	newName         func() string
+}
+
+type ProviderOpt func(provider *AzureRbacProvider)
+
+func WithRbacClient(clientOverride azarm.RbacClient) func(provider *AzureRbacProvider) {
+	return func(provider *AzureRbacProvider) {
+		provider.client = clientOverride
+	}
+}
+
+// WithConditionAttributes maps IDQL condition attribute names to Azure attribute references (see azureConditions)
+func WithConditionAttributes(nameMap map[string]string) func(provider *AzureRbacProvider) {
+	return func(provider *AzureRbacProvider) {
+		provider.conditionMapper = azureConditions.NewAzureConditionMapper(nameMap)
+	}
+}
+
+// WithAssignmentNames overrides how the names (guids) of new role assignments are generated
+func WithAssignmentNames(newName func() string) func(provider *AzureRbacProvider) {
+	return func(provider *AzureRbacProvider) {
+		provider.newName = newName
+	}
+}
+
+func NewAzureRbacProvider(opts ...ProviderOpt) *AzureRbacProvider {
+	provider := &AzureRbacProvider{
+		client:          azarm.NewRbacClient(&http.Client{}),
+		conditionMapper: azureConditions.NewAzureConditionMapper(map[string]string{}),
+		newName:         uuid.NewString,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(provider)
+		}
+	}
+	return provider
+}
+
+func (a *AzureRbacProvider) Name() string {
+	return ProviderTypeAzureRbac
+}
+
+// Capabilities reports that policies are role assignments at the application's scope, whose conditions can only allow access
+func (a *AzureRbacProvider) Capabilities() policyprovider.Capabilities {
+	return policyprovider.Capabilities{
+		Conditions:      true,
+		MultipleActions: true,
+		Objects:         true,
+		SubjectTypes:    []string{SubjectPrefixUser, SubjectPrefixGroup, SubjectPrefixServicePrincipal, SubjectPrefixPrincipal},
+	}
+}
+
+func (a *AzureRbacProvider) DiscoverApplications(info policyprovider.IntegrationInfo) (apps []policyprovider.ApplicationInfo, err error) {
+	if !strings.EqualFold(info.Name, a.Name()) {
+		return apps, err
+	}
+	return a.client.GetRbacApplications(info.Key)
+}
+
+// withContext returns a copy of the provider whose client requests are made with ctx (see azarm.ContextClient)
+func (a *AzureRbacProvider) withContext(ctx context.Context) (*AzureRbacProvider, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bound := *a
+	if client, ok := a.client.(azarm.ContextClient); ok {
+		bound.client = client.WithContext(ctx)
+	}
+	return &bound, nil
+}
+
+func (a *AzureRbacProvider) DiscoverApplicationsContext(ctx context.Context, info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
+	bound, err := a.withContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bound.DiscoverApplications(info)
+}
+
+func (a *AzureRbacProvider) GetPolicyInfoContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	bound, err := a.withContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bound.GetPolicyInfo(integration, app)
+}
+
+func (a *AzureRbacProvider) SetPolicyInfoContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+	bound, err := a.withContext(ctx)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return bound.SetPolicyInfo(integration, app, policyInfos)
+}
+
+func (a *AzureRbacProvider) ReconcileContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+	bound, err := a.withContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bound.Reconcile(integration, app, comparePolicies, diffsOnly)
+}
+
+/*
+roleBinding is the set of subjects assigned a role at a scope with the same condition. Policies are mapped to and from
+bindings so that policies and assignments can be compared regardless of how subjects are spread across policies.
+*/
+type roleBinding struct {
+	role      azarm.RoleDefinition
+	condition string // the Azure condition expression, in the form produced by the condition mapper
+	subjects  []string
+}
+
+// key returns the identity of a binding, which is the role name and the condition (if any)
+func (b *roleBinding) key() string {
+	if b.condition == "" {
+		return b.role.Properties.RoleName
+	}
+	return fmt.Sprintf("%s if %s", b.role.Properties.RoleName, b.condition)
+}
+
+// GetPolicyInfo returns a policy for each role and condition assigned at the application's scope
+func (a *AzureRbacProvider) GetPolicyInfo(integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	bindings, _, err := a.existingBindings(integration.Key, app.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]hexapolicy.PolicyInfo, len(bindings))
+	for i, binding := range bindings {
+		if policies[i], err = a.bindingToPolicy(app.ObjectID, binding); err != nil {
+			return nil, err
+		}
+	}
+	return policies, nil
+}
+
+/*
+SetPolicyInfo makes the role assignments at the application's scope match policyInfos. Missing assignments are
+created, the conditions of existing assignments are updated, and assignments not in any policy are deleted.
+Assignments inherited from parent scopes are not changed.
+*/
+func (a *AzureRbacProvider) SetPolicyInfo(integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+	validate := validator.New()
+	if err := validate.Struct(app); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := validate.Var(policyInfos, "omitempty,dive"); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	key := integration.Key
+	scope := app.ObjectID
+	roles, err := a.client.GetRoleDefinitions(key, scope)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	bindings, err := a.mapPolicies(scope, roles, policyInfos, nil)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	existing, err := a.client.GetRoleAssignments(key, scope)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// Azure allows a principal a single assignment of a role at a scope, so assignments are matched by role and principal
+	existingByKey := make(map[string]azarm.RoleAssignment, len(existing))
+	for _, assignment := range existing {
+		existingByKey[assignmentKey(assignment.Properties.RoleDefinitionId, assignment.Properties.PrincipalId)] = assignment
+	}
+	desired := make(map[string]string)
+	for _, binding := range bindings {
+		for _, subject := range binding.subjects {
+			prefix, principalId := splitSubject(subject)
+			aKey := assignmentKey(binding.role.ID, principalId)
+			if condition, dup := desired[aKey]; dup {
+				if condition != binding.condition {
+					return http.StatusInternalServerError, fmt.Errorf("subject %s is assigned role %s with more than one condition", subject, binding.role.Properties.RoleName)
+				}
+				continue
+			}
+			desired[aKey] = binding.condition
+
+			var name string
+			if assignment, ok := existingByKey[aKey]; ok {
+				if a.normalizeCondition(assignment.Properties.Condition) == binding.condition {
+					continue
+				}
+				name = assignment.Name // only the condition of an existing assignment can be changed
+			} else {
+				name = a.newName()
+			}
+			properties := azarm.RoleAssignmentProperties{
+				RoleDefinitionId: binding.role.ID,
+				PrincipalId:      principalId,
+				PrincipalType:    subjectPrincipalTypes[prefix],
+				Condition:        binding.condition,
+			}
+			if binding.condition != "" {
+				properties.ConditionVersion = azureConditions.ConditionVersion
+			}
+			if err = a.client.PutRoleAssignment(key, scope, name, properties); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+	}
+
+	for _, assignment := range existing {
+		if _, ok := desired[assignmentKey(assignment.Properties.RoleDefinitionId, assignment.Properties.PrincipalId)]; ok {
+			continue
+		}
+		if err = a.client.DeleteRoleAssignment(key, assignment.ID); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	return http.StatusCreated, nil
+}
+
+/*
+MapPolicyReport reports how policyInfos are represented as role assignments at the application's scope (see
+policyprovider.MappingReporter). Actions are resolved against the scope's role definitions, but no assignments are changed.
+*/
+func (a *AzureRbacProvider) MapPolicyReport(integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+	roles, err := a.client.GetRoleDefinitions(integration.Key, app.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	report := hexapolicy.NewMappingReport(a.Name())
+	if _, err = a.mapPolicies(app.ObjectID, roles, policyInfos, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+/*
+Reconcile compares the supplied policies with the role assignments at the application's scope. As assignments are
+grouped by role and condition, differences are reported per group in the same way as the Google Cloud IAM provider.
+*/
+func (a *AzureRbacProvider) Reconcile(integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+	scope := app.ObjectID
+	existBindings, roles, err := a.existingBindings(integration.Key, scope)
+	if err != nil {
+		return nil, err
+	}
+	compareBindings, err := a.mapPolicies(scope, roles, comparePolicies, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	existMap := make(map[string]*roleBinding, len(existBindings))
+	for _, binding := range existBindings {
+		existMap[binding.key()] = binding
+	}
+
+	res := make([]hexapolicy.PolicyDif, 0)
+	for _, binding := range compareBindings {
+		key := binding.key()
+		comparePolicy, err := a.bindingToPolicy(scope, binding)
+		if err != nil {
+			return nil, err
+		}
+
+		existBinding, exists := existMap[key]
+		if !exists {
+			res = append(res, hexapolicy.PolicyDif{
+				Type:          hexapolicy.ChangeTypeNew,
+				PolicyId:      key,
+				PolicyCompare: &comparePolicy,
+			})
+			continue
+		}
+		delete(existMap, key)
+
+		existPolicy, err := a.bindingToPolicy(scope, existBinding)
+		if err != nil {
+			return nil, err
+		}
+		if sameSubjects(binding.subjects, existBinding.subjects) {
+			if !diffsOnly {
+				res = append(res, hexapolicy.PolicyDif{
+					Type:          hexapolicy.ChangeTypeEqual,
+					PolicyId:      key,
+					DifTypes:      []string{hexapolicy.CompareEqual},
+					PolicyExist:   []hexapolicy.PolicyInfo{existPolicy},
+					PolicyCompare: &comparePolicy,
+				})
+			}
+			continue
+		}
+		res = append(res, hexapolicy.PolicyDif{
+			Type:          hexapolicy.ChangeTypeUpdate,
+			PolicyId:      key,
+			DifTypes:      []string{hexapolicy.CompareDifSubject},
+			PolicyExist:   []hexapolicy.PolicyInfo{existPolicy},
+			PolicyCompare: &comparePolicy,
+		})
+	}
+
+	// Remaining existing bindings are implied deletes
+	for _, binding := range existBindings {
+		key := binding.key()
+		if _, ok := existMap[key]; !ok {
+			continue
+		}
+		existPolicy, err := a.bindingToPolicy(scope, binding)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, hexapolicy.PolicyDif{
+			Type:        hexapolicy.ChangeTypeDelete,
+			PolicyId:    key,
+			PolicyExist: []hexapolicy.PolicyInfo{existPolicy},
+		})
+	}
+	return res, nil
+}
+
+// existingBindings returns the role assignments made at scope grouped by role and condition, along with the scope's role definitions
+func (a *AzureRbacProvider) existingBindings(key []byte, scope string) ([]*roleBinding, []azarm.RoleDefinition, error) {
+	roles, err := a.client.GetRoleDefinitions(key, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	assignments, err := a.client.GetRoleAssignments(key, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rolesById := make(map[string]azarm.RoleDefinition, len(roles))
+	for _, role := range roles {
+		rolesById[strings.ToLower(role.Name)] = role
+	}
+
+	var bindings []*roleBinding
+	index := make(map[string]*roleBinding)
+	for _, assignment := range assignments {
+		roleId := assignment.Properties.RoleDefinitionId
+		role, ok := rolesById[strings.ToLower(lastSegment(roleId))]
+		if !ok {
+			// e.g. a custom role that is not assignable at this scope, which is named by its guid
+			role = azarm.RoleDefinition{ID: roleId, Name: lastSegment(roleId), Properties: azarm.RoleDefinitionProperties{RoleName: lastSegment(roleId)}}
+		}
+		binding := &roleBinding{role: role, condition: a.normalizeCondition(assignment.Properties.Condition)}
+		if existing, ok := index[binding.key()]; ok {
+			binding = existing
+		} else {
+			index[binding.key()] = binding
+			bindings = append(bindings, binding)
+		}
+		binding.subjects = append(binding.subjects, principalSubject(assignment.Properties.PrincipalType, assignment.Properties.PrincipalId))
+	}
+	return bindings, roles, nil
+}
+
+/*
+mapPolicies returns the bindings that represent policyInfos at scope, merging bindings with the same role and condition.
+When report is nil an error is returned for the first policy element that cannot be assigned, otherwise the element is
+recorded in report and skipped.
+*/
+func (a *AzureRbacProvider) mapPolicies(scope string, roles []azarm.RoleDefinition, policyInfos []hexapolicy.PolicyInfo, report *hexapolicy.MappingReport) ([]*roleBinding, error) {
+	drop := func(i int, policy hexapolicy.PolicyInfo, element string, reason string) error {
+		if report == nil {
+			return fmt.Errorf("policy %d: %s", i, reason)
+		}
+		report.Dropped(i, policy, element, reason)
+		return nil
+	}
+
+	var bindings []*roleBinding
+	index := make(map[string]*roleBinding)
+	for i, policy := range policyInfos {
+		object := policy.Object.String()
+		if object != "" && !strings.EqualFold(object, scope) {
+			if err := drop(i, policy, hexapolicy.MapElementPolicy, fmt.Sprintf("object %s is not the scope %s", object, scope)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(policy.Actions) == 0 {
+			if err := drop(i, policy, hexapolicy.MapElementPolicy, "policy has no actions (roles) so no role assignments were created"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		condition, err := a.conditionMapper.MapConditionToAzure(policy.Condition)
+		if err != nil {
+			if err = drop(i, policy, hexapolicy.MapElementPolicy, "condition cannot be mapped to an Azure condition: "+err.Error()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var policyRoles []azarm.RoleDefinition
+		var unknownActions []string
+		for _, action := range policy.Actions {
+			if role, ok := findRole(roles, string(action)); ok {
+				policyRoles = append(policyRoles, role)
+				continue
+			}
+			unknownActions = append(unknownActions, string(action))
+		}
+		if len(policyRoles) == 0 {
+			if err = drop(i, policy, hexapolicy.MapElementPolicy, "no Azure role found for action "+strings.Join(unknownActions, ", ")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		report.ExactPolicy(i, policy)
+		for _, action := range unknownActions {
+			if err = drop(i, policy, hexapolicy.CompareDifAction, "no Azure role found for action "+action); err != nil {
+				return nil, err
+			}
+		}
+
+		var subjects []string
+		for _, subject := range policy.Subjects {
+			if prefix, principalId := splitSubject(subject); prefix == "" || principalId == "" {
+				if err = drop(i, policy, hexapolicy.CompareDifSubject, "subject "+subject+" is not of the form user:, group:, sp: or principal: followed by an object id"); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			subjects = append(subjects, subject)
+		}
+
+		for _, role := range policyRoles {
+			binding := &roleBinding{role: role, condition: condition}
+			if existing, ok := index[binding.key()]; ok {
+				binding = existing
+			} else {
+				index[binding.key()] = binding
+				bindings = append(bindings, binding)
+			}
+			for _, subject := range subjects {
+				if !slices.Contains(binding.subjects, subject) {
+					binding.subjects = append(binding.subjects, subject)
+				}
+			}
+		}
+	}
+	return bindings, nil
+}
+
+func (a *AzureRbacProvider) bindingToPolicy(scope string, binding *roleBinding) (hexapolicy.PolicyInfo, error) {
+	policyId := binding.key()
+	policy := hexapolicy.PolicyInfo{
+		Meta: hexapolicy.MetaInfo{
+			Version:      hexapolicy.IdqlVersion,
+			PolicyId:     &policyId,
+			Description:  binding.role.Properties.Description,
+			PapId:        &scope,
+			ProviderType: ProviderTypeAzureRbac,
+		},
+		Subjects: append(hexapolicy.SubjectInfo{}, binding.subjects...),
+		Actions:  []hexapolicy.ActionInfo{hexapolicy.ActionInfo(ActionPrefix + binding.role.Properties.RoleName)},
+		Object:   hexapolicy.ObjectInfo(scope),
+	}
+	if binding.condition != "" {
+		condition, err := a.conditionMapper.MapAzureToCondition(binding.condition)
+		if err != nil {
+			return hexapolicy.PolicyInfo{}, err
+		}
+		policy.Condition = condition
+	}
+	return policy, nil
+}
+
+/*
+normalizeCondition returns an Azure condition in the form produced by the condition mapper so that conditions written
+by other tools can be compared. A condition that cannot be mapped to IDQL is returned unchanged.
+*/
+func (a *AzureRbacProvider) normalizeCondition(condition string) string {
+	idqlCondition, err := a.conditionMapper.MapAzureToCondition(condition)
+	if err != nil {
+		return condition
+	}
+	normalized, err := a.conditionMapper.MapConditionToAzure(idqlCondition)
+	if err != nil {
+		return condition
+	}
+	return normalized
+}
+
+// findRole returns the role named by action, which may be the role's name, its guid or its resource id
+func findRole(roles []azarm.RoleDefinition, action string) (azarm.RoleDefinition, bool) {
+	name := strings.TrimPrefix(action, ActionPrefix)
+	for _, role := range roles {
+		if strings.EqualFold(role.Properties.RoleName, name) || strings.EqualFold(role.Name, name) || strings.EqualFold(role.ID, name) {
+			return role, true
+		}
+	}
+	return azarm.RoleDefinition{}, false
+}
+
+// principalSubject returns the policy subject of an assigned principal
+func principalSubject(principalType string, principalId string) string {
+	for prefix, pType := range subjectPrincipalTypes {
+		if pType != "" && pType == principalType {
+			return prefix + principalId
+		}
+	}
+	return SubjectPrefixPrincipal + principalId
+}
+
+// splitSubject returns the prefix and principal id of subject, or an empty prefix if subject is not a principal subject
+func splitSubject(subject string) (string, string) {
+	for prefix := range subjectPrincipalTypes {
+		if strings.HasPrefix(subject, prefix) {
+			return prefix, strings.TrimPrefix(subject, prefix)
+		}
+	}
+	return "", ""
+}
+
+// assignmentKey identifies the assignment of a role (by resource id or guid) to a principal
+func assignmentKey(roleDefinitionId string, principalId string) string {
+	return strings.ToLower(lastSegment(roleDefinitionId) + "/" + principalId)
+}
+
+func lastSegment(id string) string {
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+func sameSubjects(subjects []string, other []string) bool {
+	if len(subjects) != len(other) {
+		return false
+	}
+	for _, subject := range subjects {
+		if !slices.Contains(other, subject) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,335 @@
+package azureRbacProvider_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/providers/azure/azarm"
+	"github.com/hexa-org/policy-mapper/providers/azure/azureRbacProvider"
+	"github.com/hexa-org/policy-mapper/providers/azure/azuretestsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	scope            = azuretestsupport.ArmStorageScope
+	projectCondition = "@Resource[Microsoft.Storage/storageAccounts/blobServices/containers:name] StringEquals 'alpine'"
+)
+
+var (
+	info = policyprovider.IntegrationInfo{Name: azureRbacProvider.ProviderTypeAzureRbac, Key: azuretestsupport.AzureKeyBytes()}
+	app  = policyprovider.ApplicationInfo{ObjectID: scope, Name: "aStorageAccount", Description: "eastus", Service: "Microsoft.Storage/storageAccounts"}
+)
+
+// newProvider returns a provider whose client uses m, and whose new role assignments are named new1, new2...
+func newProvider(m *azuretestsupport.AzureHttpClient) *azureRbacProvider.AzureRbacProvider {
+	count := 0
+	return azureRbacProvider.NewAzureRbacProvider(
+		azureRbacProvider.WithRbacClient(m.RbacClient()),
+		azureRbacProvider.WithAssignmentNames(func() string {
+			count++
+			return fmt.Sprintf("new%d", count)
+		}))
+}
+
+// existingAssignments sets up the role definitions and the assignments at scope
+func existingAssignments(m *azuretestsupport.AzureHttpClient) []azarm.RoleAssignment {
+	assignments := []azarm.RoleAssignment{
+		azuretestsupport.RoleAssignment(scope, "a1", azuretestsupport.ArmReaderRole, azarm.PrincipalTypeUser, "user1", ""),
+		azuretestsupport.RoleAssignment(scope, "a2", azuretestsupport.ArmReaderRole, azarm.PrincipalTypeGroup, "group1", ""),
+		// the same condition as written by the Azure portal
+		azuretestsupport.RoleAssignment(scope, "a3", azuretestsupport.ArmBlobReaderRole, azarm.PrincipalTypeServicePrincipal, "sp1",
+			"((@Resource[Microsoft.Storage/storageAccounts/blobServices/containers:name] StringEquals 'alpine'))"),
+		azuretestsupport.RoleAssignment(scope, "a4", azuretestsupport.ArmBlobReaderRole, "ForeignGroup", "foreign1", projectCondition),
+	}
+	m.TokenRequest("aToken")
+	m.GetRoleDefinitionsRequest(scope)
+	m.GetRoleAssignmentsRequest(scope, assignments)
+	return assignments
+}
+
+func TestAzureRbacProvider_DiscoverApplications(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	m.TokenRequest("aToken")
+	m.GetSubscriptionRequest(azuretestsupport.AzureSubscription, "aSubscriptionName")
+	m.GetResourceGroupsRequest(azuretestsupport.AzureSubscription, nil)
+	m.GetResourcesRequest(azuretestsupport.AzureSubscription, nil)
+	p := newProvider(m)
+
+	apps, err := p.DiscoverApplications(info)
+	assert.NoError(t, err)
+	assert.Len(t, apps, 1)
+	assert.Equal(t, azuretestsupport.ArmSubscriptionScope, apps[0].ObjectID)
+	assert.Equal(t, azarm.ServiceSubscription, apps[0].Service)
+
+	apps, err = p.DiscoverApplications(policyprovider.IntegrationInfo{Name: "azure", Key: info.Key})
+	assert.NoError(t, err)
+	assert.Empty(t, apps)
+}
+
+func TestAzureRbacProvider_GetPolicyInfo(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	existingAssignments(m)
+	p := newProvider(m)
+
+	policies, err := p.GetPolicyInfo(info, app)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	assert.Equal(t, hexapolicy.SubjectInfo{"user:user1", "group:group1"}, policies[0].Subjects)
+	assert.Equal(t, []hexapolicy.ActionInfo{"azure:Reader"}, policies[0].Actions)
+	assert.Equal(t, scope, policies[0].Object.String())
+	assert.Nil(t, policies[0].Condition)
+	assert.Equal(t, "Reader", *policies[0].Meta.PolicyId)
+	assert.Equal(t, azureRbacProvider.ProviderTypeAzureRbac, policies[0].Meta.ProviderType)
+
+	assert.Equal(t, hexapolicy.SubjectInfo{"sp:sp1", "principal:foreign1"}, policies[1].Subjects)
+	assert.Equal(t, []hexapolicy.ActionInfo{"azure:Storage Blob Data Reader"}, policies[1].Actions)
+	assert.Equal(t, &conditions.ConditionInfo{
+		Rule:   `resource.Microsoft.Storage/storageAccounts/blobServices/containers:name eq "alpine"`,
+		Action: conditions.AAllow,
+	}, policies[1].Condition)
+}
+
+func TestAzureRbacProvider_GetPolicyInfo_Errors(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	m.TokenRequest("aToken")
+	m.ErrorRequest(http.MethodGet, m.GetRoleDefinitionsUrl(scope), http.StatusForbidden, nil)
+	p := newProvider(m)
+
+	_, err := p.GetPolicyInfo(info, app)
+	assert.EqualError(t, err, "unable to get azure role definitions. Unexpected status 403")
+
+	m.GetRoleDefinitionsRequest(scope)
+	m.GetRoleAssignmentsRequest(scope, []azarm.RoleAssignment{
+		azuretestsupport.RoleAssignment(scope, "a1", azuretestsupport.ArmReaderRole, azarm.PrincipalTypeUser, "user1", "@Resource[a] StringEqualsIgnoreCase 'x'"),
+	})
+	_, err = p.GetPolicyInfo(info, app)
+	assert.ErrorContains(t, err, "operator StringEqualsIgnoreCase at position 13 has no IDQL equivalent")
+}
+
+func TestAzureRbacProvider_SetPolicyInfo(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	assignments := existingAssignments(m)
+	p := newProvider(m)
+
+	m.PutRoleAssignmentRequest(scope, "new1")
+	m.PutRoleAssignmentRequest(scope, "a4")
+	m.DeleteRoleAssignmentRequest(assignments[1])
+	status, err := p.SetPolicyInfo(info, app, []hexapolicy.PolicyInfo{{
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: hexapolicy.SubjectInfo{"user:user1", "user:user2"},
+		Actions:  []hexapolicy.ActionInfo{"azure:Reader"},
+		Object:   scope,
+	}, {
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: hexapolicy.SubjectInfo{"sp:sp1"},
+		Actions:  []hexapolicy.ActionInfo{hexapolicy.ActionInfo("azure:" + azuretestsupport.ArmBlobReaderRole.Name)},
+		Object:   scope,
+		Condition: &conditions.ConditionInfo{
+			Rule:   `resource.Microsoft.Storage/storageAccounts/blobServices/containers:name eq "alpine"`,
+			Action: conditions.AAllow,
+		},
+	}, {
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: hexapolicy.SubjectInfo{"principal:foreign1"},
+		Actions:  []hexapolicy.ActionInfo{"storage blob data reader"},
+		Object:   scope,
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status)
+
+	// user2 is added, the condition of foreign1 is removed and group1 is deleted
+	assert.True(t, m.PutRoleAssignmentCalled(scope, "new1"))
+	assert.Equal(t, azarm.RoleAssignmentProperties{
+		RoleDefinitionId: azuretestsupport.ArmReaderRole.ID,
+		PrincipalId:      "user2",
+		PrincipalType:    azarm.PrincipalTypeUser,
+	}, m.PutRoleAssignmentBody(scope, "new1"))
+	assert.True(t, m.PutRoleAssignmentCalled(scope, "a4"))
+	assert.Equal(t, azarm.RoleAssignmentProperties{
+		RoleDefinitionId: azuretestsupport.ArmBlobReaderRole.ID,
+		PrincipalId:      "foreign1",
+	}, m.PutRoleAssignmentBody(scope, "a4"))
+	assert.True(t, m.DeleteRoleAssignmentCalled(assignments[1]))
+	assert.True(t, m.MockHttpClient.VerifyCalled())
+}
+
+func TestAzureRbacProvider_SetPolicyInfo_AddsCondition(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	assignments := existingAssignments(m)
+	p := newProvider(m)
+
+	m.PutRoleAssignmentRequest(scope, "a1")
+	for _, assignment := range assignments[1:] {
+		m.DeleteRoleAssignmentRequest(assignment)
+	}
+	_, err := p.SetPolicyInfo(info, app, []hexapolicy.PolicyInfo{{
+		Meta:      hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects:  hexapolicy.SubjectInfo{"user:user1"},
+		Actions:   []hexapolicy.ActionInfo{"azure:Reader"},
+		Object:    scope,
+		Condition: &conditions.ConditionInfo{Rule: `resource.tags:Project in ["Alpine", "Baker"]`, Action: conditions.AAllow},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, azarm.RoleAssignmentProperties{
+		RoleDefinitionId: azuretestsupport.ArmReaderRole.ID,
+		PrincipalId:      "user1",
+		PrincipalType:    azarm.PrincipalTypeUser,
+		Condition:        "@Resource[tags:Project] ForAnyOfAnyValues:StringEquals {'Alpine', 'Baker'}",
+		ConditionVersion: "2.0",
+	}, m.PutRoleAssignmentBody(scope, "a1"))
+	assert.True(t, m.MockHttpClient.VerifyCalled())
+}
+
+func TestAzureRbacProvider_SetPolicyInfo_Errors(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	existingAssignments(m)
+	p := newProvider(m)
+
+	tests := []struct {
+		name   string
+		policy hexapolicy.PolicyInfo
+		err    string
+	}{
+		{"Unknown role", hexapolicy.PolicyInfo{Subjects: hexapolicy.SubjectInfo{"user:user1"}, Actions: []hexapolicy.ActionInfo{"azure:Owner"}},
+			"policy 0: no Azure role found for action azure:Owner"},
+		{"Other scope", hexapolicy.PolicyInfo{Subjects: hexapolicy.SubjectInfo{"user:user1"}, Actions: []hexapolicy.ActionInfo{"azure:Reader"}, Object: azuretestsupport.ArmSubscriptionScope},
+			"policy 0: object " + azuretestsupport.ArmSubscriptionScope + " is not the scope " + scope},
+		{"Subject", hexapolicy.PolicyInfo{Subjects: hexapolicy.SubjectInfo{"alice@example.com"}, Actions: []hexapolicy.ActionInfo{"azure:Reader"}},
+			"policy 0: subject alice@example.com is not of the form user:, group:, sp: or principal: followed by an object id"},
+		{"Deny condition", hexapolicy.PolicyInfo{Subjects: hexapolicy.SubjectInfo{"user:user1"}, Actions: []hexapolicy.ActionInfo{"azure:Reader"},
+			Condition: &conditions.ConditionInfo{Rule: `resource.a eq "1"`, Action: conditions.ADeny}},
+			"policy 0: condition cannot be mapped to an Azure condition: azure role assignment conditions cannot deny access"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.Meta = hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion}
+			if tt.policy.Object == "" {
+				tt.policy.Object = scope
+			}
+			status, err := p.SetPolicyInfo(info, app, []hexapolicy.PolicyInfo{tt.policy})
+			assert.EqualError(t, err, tt.err)
+			assert.Equal(t, http.StatusInternalServerError, status)
+		})
+	}
+
+	_, err := p.SetPolicyInfo(info, app, []hexapolicy.PolicyInfo{{
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: hexapolicy.SubjectInfo{"user:user1"},
+		Actions:  []hexapolicy.ActionInfo{"azure:Reader"},
+		Object:   scope,
+	}, {
+		Meta:      hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects:  hexapolicy.SubjectInfo{"user:user1"},
+		Actions:   []hexapolicy.ActionInfo{"azure:Reader"},
+		Object:    scope,
+		Condition: &conditions.ConditionInfo{Rule: `resource.a eq "1"`, Action: conditions.AAllow},
+	}})
+	assert.EqualError(t, err, "subject user:user1 is assigned role Reader with more than one condition")
+
+	status, err := p.SetPolicyInfo(info, policyprovider.ApplicationInfo{}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusInternalServerError, status)
+}
+
+func TestAzureRbacProvider_Reconcile(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	existingAssignments(m)
+	p := newProvider(m)
+
+	existing, err := p.GetPolicyInfo(info, app)
+	assert.NoError(t, err)
+
+	difs, err := p.Reconcile(info, app, existing, true)
+	assert.NoError(t, err)
+	assert.Empty(t, difs)
+
+	difs, err = p.Reconcile(info, app, existing, false)
+	assert.NoError(t, err)
+	assert.Len(t, difs, 2)
+	assert.Equal(t, hexapolicy.ChangeTypeEqual, difs[0].Type)
+
+	changed := existing[0]
+	changed.Subjects = hexapolicy.SubjectInfo{"user:user1"}
+	difs, err = p.Reconcile(info, app, []hexapolicy.PolicyInfo{changed}, true)
+	assert.NoError(t, err)
+	assert.Len(t, difs, 2)
+	assert.Equal(t, hexapolicy.ChangeTypeUpdate, difs[0].Type)
+	assert.Equal(t, "Reader", difs[0].PolicyId)
+	assert.Equal(t, []string{hexapolicy.CompareDifSubject}, difs[0].DifTypes)
+	assert.Equal(t, hexapolicy.ChangeTypeDelete, difs[1].Type)
+	assert.Equal(t, "Storage Blob Data Reader if "+projectCondition, difs[1].PolicyId)
+
+	added := existing[0]
+	added.Condition = &conditions.ConditionInfo{Rule: "resource.tags:Project pr", Action: conditions.AAllow}
+	difs, err = p.Reconcile(info, app, []hexapolicy.PolicyInfo{existing[1], added}, true)
+	assert.NoError(t, err)
+	assert.Len(t, difs, 2)
+	assert.Equal(t, hexapolicy.ChangeTypeNew, difs[0].Type)
+	assert.Equal(t, "Reader if Exists @Resource[tags:Project]", difs[0].PolicyId)
+	assert.Equal(t, hexapolicy.ChangeTypeDelete, difs[1].Type)
+	assert.Equal(t, "Reader", difs[1].PolicyId)
+}
+
+func TestAzureRbacProvider_Context(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	existingAssignments(m)
+	p := newProvider(m)
+
+	policies, err := p.GetPolicyInfoContext(context.Background(), info, app)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m = azuretestsupport.NewAzureHttpClient()
+	existingAssignments(m)
+	p = newProvider(m)
+
+	_, err = p.DiscoverApplicationsContext(ctx, info)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = p.GetPolicyInfoContext(ctx, info, app)
+	assert.ErrorIs(t, err, context.Canceled)
+	status, err := p.SetPolicyInfoContext(ctx, info, app, policies)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, http.StatusInternalServerError, status)
+	_, err = p.ReconcileContext(ctx, info, app, policies, true)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, m.TokenCalled())
+}
+
+func TestAzureRbacProvider_MapPolicyReport(t *testing.T) {
+	m := azuretestsupport.NewAzureHttpClient()
+	existingAssignments(m)
+	p := newProvider(m)
+
+	report, err := p.MapPolicyReport(info, app, []hexapolicy.PolicyInfo{{
+		Subjects: hexapolicy.SubjectInfo{"user:user1", "alice@example.com"},
+		Actions:  []hexapolicy.ActionInfo{"azure:Reader", "azure:Owner"},
+	}, {
+		Subjects:  hexapolicy.SubjectInfo{"group:group1"},
+		Actions:   []hexapolicy.ActionInfo{"azure:Reader"},
+		Condition: &conditions.ConditionInfo{Rule: `req.ip sw "127"`, Action: conditions.ADeny},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, azureRbacProvider.ProviderTypeAzureRbac, report.Target)
+	assert.Equal(t, []string{
+		"policy 0: SUBJECT DROPPED - subject alice@example.com is not of the form user:, group:, sp: or principal: followed by an object id",
+		"policy 0: ACTION DROPPED - no Azure role found for action azure:Owner",
+		"policy 1: POLICY DROPPED - condition cannot be mapped to an Azure condition: azure role assignment conditions cannot deny access",
+	}, report.Issues())
+}
+
+func TestAzureRbacProvider_Capabilities(t *testing.T) {
+	p := azureRbacProvider.NewAzureRbacProvider()
+	assert.Equal(t, azureRbacProvider.ProviderTypeAzureRbac, p.Name())
+	capabilities := p.Capabilities()
+	assert.True(t, capabilities.Conditions)
+	assert.False(t, capabilities.DenyConditions)
+	assert.Equal(t, []string{"user:", "group:", "sp:", "principal:"}, capabilities.SubjectTypes)
+}
@@ -0,0 +1,106 @@
+package azurecommon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Page is one page of an ARM or Graph API collection. ARM sets nextLink and Graph sets @odata.nextLink when there
+// are more pages to read.
+type Page[T any] struct {
+	List          []T    `json:"value"`
+	NextLink      string `json:"nextLink"`
+	ODataNextLink string `json:"@odata.nextLink"`
+}
+
+// Next returns the link to the next page, or an empty string if this is the last page
+func (p Page[T]) Next() string {
+	if p.NextLink != "" {
+		return p.NextLink
+	}
+	return p.ODataNextLink
+}
+
+// GetAllPages returns the values of every page of the collection at endpoint. getPage decodes the page at a link
+// into page, and is called until a page has no next link.
+func GetAllPages[T any](endpoint string, getPage func(endpoint string, page *Page[T]) error) ([]T, error) {
+	values := make([]T, 0)
+	for endpoint != "" {
+		var page Page[T]
+		if err := getPage(endpoint, &page); err != nil {
+			return nil, err
+		}
+		values = append(values, page.List...)
+		next := page.Next()
+		if next == endpoint {
+			break
+		}
+		endpoint = next
+	}
+	return values, nil
+}
+
+// responseError is the body of an ARM or Graph API error response
+type responseError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// StatusError returns an error for an unexpected response status, including the Azure error code and message if present
+func StatusError(description string, response *http.Response) error {
+	errMsg := fmt.Sprintf("unable to %s. Unexpected status %d", description, response.StatusCode)
+	var rErr responseError
+	if response.Body != nil && json.NewDecoder(response.Body).Decode(&rErr) == nil && rErr.Error.Code != "" {
+		errMsg = fmt.Sprintf("%s (%s: %s)", errMsg, rErr.Error.Code, rErr.Error.Message)
+	}
+	log.Println(errMsg)
+	return errors.New(errMsg)
+}
+
+type AccessToken struct {
+	Token string `json:"access_token"`
+}
+
+// AccessTokenRequest gets a client credentials access token for scope from the tenant of decoded
+func AccessTokenRequest(httpClient HTTPClient, decoded AzureKey, scope string) (AccessToken, error) {
+	var accessToken AccessToken
+	tokenUrl := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", decoded.Tenant)
+	postBody := fmt.Sprintf("grant_type=client_credentials&client_id=%s&client_secret=%s&scope=%s", decoded.AppId, decoded.Secret, scope)
+	tokenResponse, tokenErr := httpClient.Post(tokenUrl, "", strings.NewReader(postBody))
+	if tokenErr != nil {
+		return accessToken, tokenErr
+	}
+
+	err := json.NewDecoder(tokenResponse.Body).Decode(&accessToken)
+	return accessToken, err
+}
+
+// AuthorizedRequest sends request with an access token for scope obtained with the credentials in key. Headers
+// already set on request are kept. No token is requested once the context of request is done.
+func AuthorizedRequest(httpClient HTTPClient, key []byte, request *http.Request, scope string) (*http.Response, error) {
+	decoded, keyErr := DecodeKey(key)
+	if keyErr != nil {
+		log.Println("Unable to decode azure provider key. Error=", keyErr)
+		return nil, keyErr
+	}
+	if err := request.Context().Err(); err != nil {
+		return nil, err
+	}
+	accessToken, tokenErr := AccessTokenRequest(httpClient, decoded, scope)
+	if tokenErr != nil {
+		log.Println("Unable to get azure access token. Error=", tokenErr)
+		return nil, tokenErr
+	}
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken.Token))
+	return httpClient.Do(request)
+}
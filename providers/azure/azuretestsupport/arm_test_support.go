@@ -0,0 +1,149 @@
+package azuretestsupport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/hexa-org/policy-mapper/providers/azure/azarm"
+)
+
+const ArmApiBaseUrl = "https://management.azure.com"
+
+const (
+	ArmSubscriptionScope  = "/subscriptions/" + AzureSubscription
+	ArmResourceGroupScope = ArmSubscriptionScope + "/resourceGroups/aResourceGroup"
+	ArmStorageScope       = ArmResourceGroupScope + "/providers/Microsoft.Storage/storageAccounts/aStorageAccount"
+)
+
+// Role definitions returned by GetRoleDefinitionsRequest
+var (
+	ArmReaderRole = azarm.RoleDefinition{
+		ID:         ArmSubscriptionScope + "/providers/Microsoft.Authorization/roleDefinitions/acdd72a7-3385-48ef-bd42-f606fba81ae7",
+		Name:       "acdd72a7-3385-48ef-bd42-f606fba81ae7",
+		Properties: azarm.RoleDefinitionProperties{RoleName: "Reader", Type: "BuiltInRole", Description: "View all resources"},
+	}
+	ArmBlobReaderRole = azarm.RoleDefinition{
+		ID:         ArmSubscriptionScope + "/providers/Microsoft.Authorization/roleDefinitions/2a2b9908-6ea1-4ae2-8e65-a410df84e7d1",
+		Name:       "2a2b9908-6ea1-4ae2-8e65-a410df84e7d1",
+		Properties: azarm.RoleDefinitionProperties{RoleName: "Storage Blob Data Reader", Type: "BuiltInRole", Description: "Read Azure Storage containers and blobs"},
+	}
+)
+
+func (ac *AzureHttpClient) RbacClient() azarm.RbacClient {
+	return azarm.NewRbacClient(ac.MockHttpClient)
+}
+
+// armPageRequest returns values from pageUrl along with a link to nextLink, if not empty
+func (ac *AzureHttpClient) armPageRequest(pageUrl string, values interface{}, nextLink string) {
+	page := map[string]interface{}{"value": values}
+	if nextLink != "" {
+		page["nextLink"] = nextLink
+	}
+	resp, _ := json.Marshal(page)
+	ac.MockHttpClient.AddRequest(http.MethodGet, pageUrl, http.StatusOK, resp)
+}
+
+func (ac *AzureHttpClient) GetSubscriptionUrl(subscriptionId string) string {
+	return fmt.Sprintf("%s/subscriptions/%s?api-version=2022-12-01", ArmApiBaseUrl, subscriptionId)
+}
+
+func (ac *AzureHttpClient) GetSubscriptionRequest(subscriptionId string, displayName string) {
+	sub := azarm.Subscription{ID: "/subscriptions/" + subscriptionId, SubscriptionID: subscriptionId, DisplayName: displayName, State: "Enabled"}
+	resp, _ := json.Marshal(sub)
+	ac.MockHttpClient.AddRequest(http.MethodGet, ac.GetSubscriptionUrl(subscriptionId), http.StatusOK, resp)
+}
+
+func (ac *AzureHttpClient) GetSubscriptionsUrl() string {
+	return ArmApiBaseUrl + "/subscriptions?api-version=2022-12-01"
+}
+
+func (ac *AzureHttpClient) GetSubscriptionsRequest(subscriptions []azarm.Subscription) {
+	ac.armPageRequest(ac.GetSubscriptionsUrl(), subscriptions, "")
+}
+
+func (ac *AzureHttpClient) GetResourceGroupsUrl(subscriptionId string) string {
+	return fmt.Sprintf("%s/subscriptions/%s/resourcegroups?api-version=2021-04-01", ArmApiBaseUrl, subscriptionId)
+}
+
+func (ac *AzureHttpClient) GetResourceGroupsRequest(subscriptionId string, groups []azarm.ResourceGroup) {
+	ac.armPageRequest(ac.GetResourceGroupsUrl(subscriptionId), groups, "")
+}
+
+func (ac *AzureHttpClient) GetResourcesUrl(subscriptionId string) string {
+	return fmt.Sprintf("%s/subscriptions/%s/resources?api-version=2021-04-01", ArmApiBaseUrl, subscriptionId)
+}
+
+func (ac *AzureHttpClient) GetResourcesRequest(subscriptionId string, resources []azarm.Resource) {
+	ac.armPageRequest(ac.GetResourcesUrl(subscriptionId), resources, "")
+}
+
+func (ac *AzureHttpClient) GetRoleDefinitionsUrl(scope string) string {
+	return fmt.Sprintf("%s%s/providers/Microsoft.Authorization/roleDefinitions?api-version=2022-04-01", ArmApiBaseUrl, scope)
+}
+
+// GetRoleDefinitionsRequest returns ArmReaderRole and ArmBlobReaderRole as the role definitions of scope
+func (ac *AzureHttpClient) GetRoleDefinitionsRequest(scope string) {
+	ac.armPageRequest(ac.GetRoleDefinitionsUrl(scope), []azarm.RoleDefinition{ArmReaderRole, ArmBlobReaderRole}, "")
+}
+
+func (ac *AzureHttpClient) GetRoleAssignmentsUrl(scope string) string {
+	return fmt.Sprintf("%s%s/providers/Microsoft.Authorization/roleAssignments?api-version=2022-04-01&$filter=atScope()", ArmApiBaseUrl, scope)
+}
+
+func (ac *AzureHttpClient) GetRoleAssignmentsRequest(scope string, assignments []azarm.RoleAssignment) {
+	ac.armPageRequest(ac.GetRoleAssignmentsUrl(scope), assignments, "")
+}
+
+// GetRoleAssignmentsPageRequest returns assignments from pageUrl along with a link to nextLink, if not empty
+func (ac *AzureHttpClient) GetRoleAssignmentsPageRequest(pageUrl string, assignments []azarm.RoleAssignment, nextLink string) {
+	ac.armPageRequest(pageUrl, assignments, nextLink)
+}
+
+func (ac *AzureHttpClient) RoleAssignmentUrl(scope string, name string) string {
+	return fmt.Sprintf("%s%s/providers/Microsoft.Authorization/roleAssignments/%s?api-version=2022-04-01", ArmApiBaseUrl, scope, name)
+}
+
+func (ac *AzureHttpClient) PutRoleAssignmentRequest(scope string, name string) {
+	ac.MockHttpClient.AddRequest(http.MethodPut, ac.RoleAssignmentUrl(scope, name), http.StatusCreated, nil)
+}
+
+func (ac *AzureHttpClient) PutRoleAssignmentCalled(scope string, name string) bool {
+	return ac.MockHttpClient.CalledWithStatus(http.MethodPut, ac.RoleAssignmentUrl(scope, name), http.StatusCreated)
+}
+
+// PutRoleAssignmentBody returns the properties sent to create or update the role assignment name
+func (ac *AzureHttpClient) PutRoleAssignmentBody(scope string, name string) azarm.RoleAssignmentProperties {
+	var body struct {
+		Properties azarm.RoleAssignmentProperties `json:"properties"`
+	}
+	_ = json.Unmarshal(ac.MockHttpClient.GetRequestBodyByKey(http.MethodPut, ac.RoleAssignmentUrl(scope, name)), &body)
+	return body.Properties
+}
+
+func (ac *AzureHttpClient) DeleteRoleAssignmentRequest(assignment azarm.RoleAssignment) {
+	ac.MockHttpClient.AddRequest(http.MethodDelete, ac.RoleAssignmentUrl(assignment.Properties.Scope, assignment.Name), http.StatusOK, nil)
+}
+
+func (ac *AzureHttpClient) DeleteRoleAssignmentCalled(assignment azarm.RoleAssignment) bool {
+	return ac.MockHttpClient.CalledWithStatus(http.MethodDelete, ac.RoleAssignmentUrl(assignment.Properties.Scope, assignment.Name), http.StatusOK)
+}
+
+// RoleAssignment returns an assignment of role to the principal principalId at scope
+func RoleAssignment(scope string, name string, role azarm.RoleDefinition, principalType string, principalId string, condition string) azarm.RoleAssignment {
+	assignment := azarm.RoleAssignment{
+		ID:   fmt.Sprintf("%s/providers/Microsoft.Authorization/roleAssignments/%s", scope, name),
+		Name: name,
+		Properties: azarm.RoleAssignmentProperties{
+			RoleDefinitionId: role.ID,
+			PrincipalId:      principalId,
+			PrincipalType:    principalType,
+			Scope:            scope,
+			Condition:        condition,
+		},
+	}
+	if condition != "" {
+		assignment.Properties.ConditionVersion = "2.0"
+	}
+	return assignment
+}
@@ -40,6 +40,21 @@ func (m *MockAzureClient) GetPrincipalIdFromEmail(key []byte, email string) (str
 	return returnArgs.String(0), returnArgs.Error(1)
 }
 
+func (m *MockAzureClient) GetGroupIdFromName(key []byte, name string) (string, error) {
+	returnArgs := m.Called(key, name)
+	return returnArgs.String(0), returnArgs.Error(1)
+}
+
+func (m *MockAzureClient) GetPrincipalIdFromAppId(key []byte, appId string) (string, error) {
+	returnArgs := m.Called(key, appId)
+	return returnArgs.String(0), returnArgs.Error(1)
+}
+
+func (m *MockAzureClient) GetServicePrincipalAppId(key []byte, principalId string) (string, error) {
+	returnArgs := m.Called(key, principalId)
+	return returnArgs.String(0), returnArgs.Error(1)
+}
+
 func (m *MockAzureClient) GetAppRoleAssignedTo(key []byte, servicePrincipalId string) (azad.AzureAppRoleAssignments, error) {
 	returnArgs := m.Called(key, servicePrincipalId)
 	return returnArgs.Get(0).(azad.AzureAppRoleAssignments), returnArgs.Error(1)
@@ -91,6 +106,21 @@ func (m *MockAzureClient) ExpectGetPrincipalIdFromEmail(email, principalId strin
 		Return(principalId, nil)
 }
 
+func (m *MockAzureClient) ExpectGetGroupIdFromName(name, groupId string) {
+	m.On("GetGroupIdFromName", AzureKeyBytes(), name).
+		Return(groupId, nil)
+}
+
+func (m *MockAzureClient) ExpectGetPrincipalIdFromAppId(appId, principalId string) {
+	m.On("GetPrincipalIdFromAppId", AzureKeyBytes(), appId).
+		Return(principalId, nil)
+}
+
+func (m *MockAzureClient) ExpectGetServicePrincipalAppId(principalId, appId string) {
+	m.On("GetServicePrincipalAppId", AzureKeyBytes(), principalId).
+		Return(appId, nil)
+}
+
 func (m *MockAzureClient) ExpectSetAppRoleAssignedTo(requestedAssignments []azad.AzureAppRoleAssignment) {
 	theFunc := mock.MatchedBy(func(actAssignments []azad.AzureAppRoleAssignment) bool {
 		if len(actAssignments) != len(requestedAssignments) {
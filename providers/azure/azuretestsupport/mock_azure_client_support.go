@@ -137,3 +137,40 @@ func (ac *AzureHttpClient) DeleteAppRoleAssignmentsCalled(deleted azad.AzureAppR
 	deleteUrl := ac.AppRoleAssignmentsUrl() + "/" + deleted.ID
 	return ac.MockHttpClient.CalledWithStatus(http.MethodDelete, deleteUrl, http.StatusNoContent)
 }
+
+// GetAppRoleAssignmentsPageRequest returns appRoleAssignments from pageUrl along with a link to nextLink, if not empty
+func (ac *AzureHttpClient) GetAppRoleAssignmentsPageRequest(pageUrl string, appRoleAssignments []azad.AzureAppRoleAssignment, nextLink string) {
+	page := map[string]interface{}{"value": appRoleAssignments}
+	if nextLink != "" {
+		page["@odata.nextLink"] = nextLink
+	}
+	resp, _ := json.Marshal(page)
+	ac.MockHttpClient.AddRequest(http.MethodGet, pageUrl, http.StatusOK, resp)
+}
+
+func (ac *AzureHttpClient) GetGroupIdFromNameUrl(name string) string {
+	return fmt.Sprintf("%s/groups?$select=id,displayName&$filter=displayName%%20eq%%20%%27%s%%27", GraphApiBaseUrl, url.QueryEscape(name))
+}
+
+func (ac *AzureHttpClient) GetGroupIdFromNameRequest(name string, groupId string) {
+	resp := fmt.Sprintf(`{"value": [{"id": "%s", "displayName": "%s"}]}`, groupId, name)
+	ac.MockHttpClient.AddRequest(http.MethodGet, ac.GetGroupIdFromNameUrl(name), http.StatusOK, []byte(resp))
+}
+
+func (ac *AzureHttpClient) GetPrincipalIdFromAppIdUrl(appId string) string {
+	return fmt.Sprintf("%s/servicePrincipals?$select=id,appId&$filter=appId%%20eq%%20%%27%s%%27", GraphApiBaseUrl, url.QueryEscape(appId))
+}
+
+func (ac *AzureHttpClient) GetPrincipalIdFromAppIdRequest(appId string, principalId string) {
+	resp := fmt.Sprintf(`{"value": [{"id": "%s", "appId": "%s"}]}`, principalId, appId)
+	ac.MockHttpClient.AddRequest(http.MethodGet, ac.GetPrincipalIdFromAppIdUrl(appId), http.StatusOK, []byte(resp))
+}
+
+func (ac *AzureHttpClient) GetServicePrincipalAppIdUrl(principalId string) string {
+	return fmt.Sprintf("%s/servicePrincipals/%s?$select=id,appId", GraphApiBaseUrl, principalId)
+}
+
+func (ac *AzureHttpClient) GetServicePrincipalAppIdRequest(principalId string, appId string) {
+	resp := fmt.Sprintf(`{"id": "%s", "appId": "%s"}`, principalId, appId)
+	ac.MockHttpClient.AddRequest(http.MethodGet, ac.GetServicePrincipalAppIdUrl(principalId), http.StatusOK, []byte(resp))
+}
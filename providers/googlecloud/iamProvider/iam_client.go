@@ -0,0 +1,337 @@
+package iamProvider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/formats/gcpBind"
+	"google.golang.org/api/iam/v1"
+)
+
+const (
+	ServiceResourceManager = "cloudresourcemanager.googleapis.com"
+	ServiceStorage         = "storage.googleapis.com"
+	ServicePubSub          = "pubsub.googleapis.com"
+
+	ServiceTypeProject = "Project"
+	ServiceTypeFolder  = "Folder"
+	ServiceTypeBucket  = "Cloud Storage"
+	ServiceTypeTopic   = "Pub/Sub"
+)
+
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+/*
+Endpoints holds the base URLs of the Google APIs used by the client. Each defaults to the public Google endpoint for the
+service and may be overridden (e.g. for testing).
+*/
+type Endpoints struct {
+	ResourceManager string
+	Storage         string
+	PubSub          string
+}
+
+func DefaultEndpoints() Endpoints {
+	return Endpoints{
+		ResourceManager: "https://" + ServiceResourceManager,
+		Storage:         "https://" + ServiceStorage,
+		PubSub:          "https://" + ServicePubSub,
+	}
+}
+
+/*
+GoogleIamClient reads and writes the IAM policies of Google Cloud resources identified by their full resource name
+(see https://cloud.google.com/iam/docs/full-resource-names), for example:
+
+	//cloudresourcemanager.googleapis.com/projects/my-project
+	//cloudresourcemanager.googleapis.com/folders/123456789
+	//storage.googleapis.com/projects/_/buckets/my-bucket
+	//pubsub.googleapis.com/projects/my-project/topics/my-topic
+*/
+type GoogleIamClient struct {
+	HttpClient HTTPClient
+	ProjectId  string
+	Endpoints  Endpoints
+	Context    context.Context // Context of the client's requests (context.Background() when nil)
+}
+
+type ancestry struct {
+	Ancestor []struct {
+		ResourceId struct {
+			Type string `json:"type"`
+			Id   string `json:"id"`
+		} `json:"resourceId"`
+	} `json:"ancestor"`
+}
+
+type buckets struct {
+	Items []struct {
+		Name string `json:"name"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+type topics struct {
+	Topics []struct {
+		Name string `json:"name"`
+	} `json:"topics"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+type policy struct {
+	Policy *iam.Policy `json:"policy"`
+}
+
+type getPolicyOptions struct {
+	Options iam.GetPolicyOptions `json:"options"`
+}
+
+// ProjectResourceName returns the full resource name of a project
+func ProjectResourceName(projectId string) string {
+	return fmt.Sprintf("//%s/projects/%s", ServiceResourceManager, projectId)
+}
+
+// ParseResourceName splits a full resource name into its service (e.g. `storage.googleapis.com`) and relative name
+// (e.g. `projects/_/buckets/my-bucket`)
+func ParseResourceName(resourceName string) (string, string, error) {
+	service, name, found := strings.Cut(strings.TrimPrefix(resourceName, "//"), "/")
+	if !strings.HasPrefix(resourceName, "//") || !found || name == "" {
+		return "", "", fmt.Errorf("invalid google cloud full resource name: %s", resourceName)
+	}
+	return service, name, nil
+}
+
+/*
+GetResourceHierarchy returns the project and the folders containing it (nearest first). Organizations are not returned.
+*/
+func (c *GoogleIamClient) GetResourceHierarchy() ([]policyprovider.ApplicationInfo, error) {
+	reqUrl := fmt.Sprintf("%s/v1/projects/%s:getAncestry", c.Endpoints.ResourceManager, c.ProjectId)
+	var projectAncestry ancestry
+	if err := c.doJson(http.MethodPost, reqUrl, []byte("{}"), &projectAncestry); err != nil {
+		log.Println("Unable to find google cloud project ancestry.")
+		return []policyprovider.ApplicationInfo{}, err
+	}
+
+	apps := []policyprovider.ApplicationInfo{{
+		ObjectID:    ProjectResourceName(c.ProjectId),
+		Name:        "projects/" + c.ProjectId,
+		Description: "Google Cloud project " + c.ProjectId,
+		Service:     ServiceTypeProject,
+	}}
+	for _, ancestor := range projectAncestry.Ancestor {
+		if ancestor.ResourceId.Type != "folder" {
+			continue
+		}
+		name := "folders/" + ancestor.ResourceId.Id
+		apps = append(apps, policyprovider.ApplicationInfo{
+			ObjectID:    fmt.Sprintf("//%s/%s", ServiceResourceManager, name),
+			Name:        name,
+			Description: "Google Cloud folder " + ancestor.ResourceId.Id,
+			Service:     ServiceTypeFolder,
+		})
+	}
+	return apps, nil
+}
+
+// GetBuckets returns the Cloud Storage buckets of the project
+func (c *GoogleIamClient) GetBuckets() ([]policyprovider.ApplicationInfo, error) {
+	var apps []policyprovider.ApplicationInfo
+	pageToken := ""
+	for {
+		reqUrl := fmt.Sprintf("%s/storage/v1/b?project=%s", c.Endpoints.Storage, url.QueryEscape(c.ProjectId))
+		if pageToken != "" {
+			reqUrl += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		var page buckets
+		if err := c.doJson(http.MethodGet, reqUrl, nil, &page); err != nil {
+			log.Println("Unable to find google cloud storage buckets.")
+			return apps, err
+		}
+		for _, bucket := range page.Items {
+			apps = append(apps, policyprovider.ApplicationInfo{
+				ObjectID:    fmt.Sprintf("//%s/projects/_/buckets/%s", ServiceStorage, bucket.Name),
+				Name:        bucket.Name,
+				Description: "Cloud Storage bucket",
+				Service:     ServiceTypeBucket,
+			})
+		}
+		if page.NextPageToken == "" {
+			return apps, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// GetTopics returns the Pub/Sub topics of the project
+func (c *GoogleIamClient) GetTopics() ([]policyprovider.ApplicationInfo, error) {
+	var apps []policyprovider.ApplicationInfo
+	pageToken := ""
+	for {
+		reqUrl := fmt.Sprintf("%s/v1/projects/%s/topics", c.Endpoints.PubSub, c.ProjectId)
+		if pageToken != "" {
+			reqUrl += "?pageToken=" + url.QueryEscape(pageToken)
+		}
+		var page topics
+		if err := c.doJson(http.MethodGet, reqUrl, nil, &page); err != nil {
+			log.Println("Unable to find google cloud pub/sub topics.")
+			return apps, err
+		}
+		for _, topic := range page.Topics {
+			apps = append(apps, policyprovider.ApplicationInfo{
+				ObjectID:    fmt.Sprintf("//%s/%s", ServicePubSub, topic.Name),
+				Name:        topic.Name,
+				Description: "Pub/Sub topic",
+				Service:     ServiceTypeTopic,
+			})
+		}
+		if page.NextPageToken == "" {
+			return apps, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// GetIamPolicy returns the IAM policy (bindings, etag and version) of the resource. Version 3 is requested so that
+// conditional bindings are returned.
+func (c *GoogleIamClient) GetIamPolicy(resourceName string) (*iam.Policy, error) {
+	service, name, err := ParseResourceName(resourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var method, reqUrl string
+	var body []byte
+	switch service {
+	case ServiceResourceManager:
+		method = http.MethodPost
+		reqUrl = fmt.Sprintf("%s/v3/%s:getIamPolicy", c.Endpoints.ResourceManager, name)
+		body, _ = json.Marshal(getPolicyOptions{Options: iam.GetPolicyOptions{RequestedPolicyVersion: 3}})
+	case ServiceStorage:
+		bucket, err := bucketName(name)
+		if err != nil {
+			return nil, err
+		}
+		method = http.MethodGet
+		reqUrl = fmt.Sprintf("%s/storage/v1/b/%s/iam?optionsRequestedPolicyVersion=3", c.Endpoints.Storage, bucket)
+	case ServicePubSub:
+		method = http.MethodGet
+		reqUrl = fmt.Sprintf("%s/v1/%s:getIamPolicy?options.requestedPolicyVersion=3", c.Endpoints.PubSub, name)
+	default:
+		return nil, fmt.Errorf("unsupported google cloud service: %s", service)
+	}
+
+	var iamPolicy iam.Policy
+	if err = c.doJson(method, reqUrl, body, &iamPolicy); err != nil {
+		log.Printf("Unable to get IAM policy for %s.\n", resourceName)
+		return nil, err
+	}
+	return &iamPolicy, nil
+}
+
+// SetIamPolicy replaces the IAM policy of the resource. The etag of the policy returned by GetIamPolicy should be
+// included so that concurrent modification is detected, in which case gcpBind.ErrEtagConflict is returned.
+func (c *GoogleIamClient) SetIamPolicy(resourceName string, iamPolicy *iam.Policy) error {
+	service, name, err := ParseResourceName(resourceName)
+	if err != nil {
+		return err
+	}
+
+	var method, reqUrl string
+	var body []byte
+	switch service {
+	case ServiceResourceManager:
+		method = http.MethodPost
+		reqUrl = fmt.Sprintf("%s/v3/%s:setIamPolicy", c.Endpoints.ResourceManager, name)
+		body, err = json.Marshal(policy{Policy: iamPolicy})
+	case ServiceStorage:
+		bucket, bucketErr := bucketName(name)
+		if bucketErr != nil {
+			return bucketErr
+		}
+		// Cloud Storage accepts the policy itself rather than a request wrapping the policy
+		method = http.MethodPut
+		reqUrl = fmt.Sprintf("%s/storage/v1/b/%s/iam", c.Endpoints.Storage, bucket)
+		body, err = json.Marshal(iamPolicy)
+	case ServicePubSub:
+		method = http.MethodPost
+		reqUrl = fmt.Sprintf("%s/v1/%s:setIamPolicy", c.Endpoints.PubSub, name)
+		body, err = json.Marshal(policy{Policy: iamPolicy})
+	default:
+		return fmt.Errorf("unsupported google cloud service: %s", service)
+	}
+	if err != nil {
+		return err
+	}
+	err = c.doJson(method, reqUrl, body, nil)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusConflict || statusErr.StatusCode == http.StatusPreconditionFailed) {
+		return gcpBind.ErrEtagConflict
+	}
+	return err
+}
+
+func bucketName(name string) (string, error) {
+	bucket, found := strings.CutPrefix(name, "projects/_/buckets/")
+	if !found || bucket == "" {
+		return "", fmt.Errorf("invalid cloud storage bucket name: %s", name)
+	}
+	return bucket, nil
+}
+
+type statusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *statusError) Error() string {
+	return e.Message
+}
+
+func (c *GoogleIamClient) requestContext() context.Context {
+	if c.Context == nil {
+		return context.Background()
+	}
+	return c.Context
+}
+
+func (c *GoogleIamClient) doJson(method string, reqUrl string, body []byte, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(c.requestContext(), method, reqUrl, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	log.Printf("Google cloud response %s.\n", resp.Status)
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := io.ReadAll(resp.Body)
+		return &statusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("google cloud request %s %s failed with status %d: %s", method, reqUrl, resp.StatusCode, strings.TrimSpace(string(msg)))}
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
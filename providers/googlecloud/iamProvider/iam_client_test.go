@@ -0,0 +1,49 @@
+package iamProvider_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/models/formats/gcpBind"
+	"github.com/hexa-org/policy-mapper/providers/googlecloud/iamProvider"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iam/v1"
+)
+
+func TestParseResourceName(t *testing.T) {
+	service, name, err := iamProvider.ParseResourceName(bucketName)
+	assert.NoError(t, err)
+	assert.Equal(t, iamProvider.ServiceStorage, service)
+	assert.Equal(t, "projects/_/buckets/bucket-a", name)
+
+	assert.Equal(t, projectName, iamProvider.ProjectResourceName(testProject))
+
+	for _, bad := range []string{"", "projects/p", "//cloudresourcemanager.googleapis.com", "//cloudresourcemanager.googleapis.com/"} {
+		_, _, err = iamProvider.ParseResourceName(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestGoogleIamClient_Errors(t *testing.T) {
+	server := newIamServer(t)
+	client := iamProvider.GoogleIamClient{HttpClient: http.DefaultClient, ProjectId: testProject, Endpoints: *server.endpoints()}
+
+	_, err := client.GetIamPolicy("//compute.googleapis.com/projects/p/zones/z/instances/i")
+	assert.ErrorContains(t, err, "unsupported")
+	assert.Error(t, client.SetIamPolicy("//compute.googleapis.com/projects/p/zones/z/instances/i", &iam.Policy{}))
+
+	_, err = client.GetIamPolicy("//storage.googleapis.com/buckets/bucket-a")
+	assert.ErrorContains(t, err, "invalid cloud storage bucket name")
+
+	_, err = client.GetIamPolicy("//pubsub.googleapis.com/projects/p/topics/unknown")
+	assert.ErrorContains(t, err, "404")
+	assert.NotErrorIs(t, err, gcpBind.ErrEtagConflict)
+
+	// A set with a stale etag is reported as a conflict
+	err = client.SetIamPolicy(topicName, &iam.Policy{Etag: "stale"})
+	assert.ErrorIs(t, err, gcpBind.ErrEtagConflict)
+
+	client.ProjectId = "unknown"
+	_, err = client.GetBuckets()
+	assert.Error(t, err)
+}
@@ -0,0 +1,240 @@
+package iamProvider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/formats/gcpBind"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport/http"
+)
+
+const ProviderTypeGoogleCloudIAM string = "gcp_iam"
+
+/*
+GoogleIamProvider manages the IAM policies of Google Cloud projects, folders, Cloud Storage buckets and Pub/Sub topics.
+Each resource is a policy application point whose ObjectID is the resource's full resource name (e.g.
+`//cloudresourcemanager.googleapis.com/projects/my-project`).
+*/
+type GoogleIamProvider struct {
+	HttpClientOverride HTTPClient
+	EndpointsOverride  *Endpoints
+	GcpMapper          *gcpBind.GooglePolicyMapper
+}
+
+func (g *GoogleIamProvider) initMapper() {
+	if g.GcpMapper == nil {
+		g.GcpMapper = gcpBind.New(map[string]string{})
+	}
+}
+
+func (g *GoogleIamProvider) Name() string {
+	return ProviderTypeGoogleCloudIAM
+}
+
+// Capabilities reports that policies are IAM bindings, whose conditions can only allow access
+func (g *GoogleIamProvider) Capabilities() policyprovider.Capabilities {
+	return policyprovider.Capabilities{
+		Conditions:      true,
+		MultipleActions: true,
+		Objects:         true,
+		SubjectTypes:    gcpBind.IamMemberTypes,
+	}
+}
+
+func (g *GoogleIamProvider) DiscoverApplications(info policyprovider.IntegrationInfo) (apps []policyprovider.ApplicationInfo, err error) {
+	return g.DiscoverApplicationsContext(context.Background(), info)
+}
+
+func (g *GoogleIamProvider) DiscoverApplicationsContext(ctx context.Context, info policyprovider.IntegrationInfo) (apps []policyprovider.ApplicationInfo, err error) {
+	if !strings.EqualFold(info.Name, g.Name()) {
+		return apps, err
+	}
+
+	client, err := g.getClient(ctx, info.Key)
+	if err != nil {
+		return apps, err
+	}
+
+	hierarchy, err := client.GetResourceHierarchy()
+	if err != nil {
+		return apps, err
+	}
+	apps = append(apps, hierarchy...)
+
+	// Buckets and topics are optional (e.g. the API may not be enabled), so the first error is reported with the
+	// applications found
+	bucketApps, err1 := client.GetBuckets()
+	apps = append(apps, bucketApps...)
+
+	topicApps, err2 := client.GetTopics()
+	apps = append(apps, topicApps...)
+
+	err = err2
+	if err1 != nil {
+		err = err1
+	}
+	return apps, err
+}
+
+func (g *GoogleIamProvider) GetPolicyInfo(integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	return g.GetPolicyInfoContext(context.Background(), integration, app)
+}
+
+func (g *GoogleIamProvider) GetPolicyInfoContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	g.initMapper()
+
+	client, err := g.getClient(ctx, integration.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	iamPolicy, err := client.GetIamPolicy(app.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]hexapolicy.PolicyInfo, len(iamPolicy.Bindings))
+	for i, binding := range iamPolicy.Bindings {
+		result[i], err = g.GcpMapper.MapBindingToPolicy(app.ObjectID, *binding)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+/*
+SetPolicyInfo replaces the bindings of the resource's IAM policy with the bindings mapped from policyInfos. The policy
+is read and written with its etag (see gcpBind.UpdateIamPolicy), and 409 is returned when a concurrent modification
+cannot be merged.
+*/
+func (g *GoogleIamProvider) SetPolicyInfo(integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+	return g.SetPolicyInfoContext(context.Background(), integration, app, policyInfos)
+}
+
+func (g *GoogleIamProvider) SetPolicyInfoContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+	g.initMapper()
+
+	validate := validator.New()
+	if err := validate.Struct(app); err != nil {
+		return 500, err
+	}
+	if err := validate.Var(policyInfos, "omitempty,dive"); err != nil {
+		return 500, err
+	}
+
+	client, err := g.getClient(ctx, integration.Key)
+	if err != nil {
+		return 500, err
+	}
+
+	bindings, err := g.GcpMapper.MapPoliciesToIamBindings(policyInfos)
+	if errors.Is(err, gcpBind.ErrDenyCondition) {
+		return 400, err
+	}
+	if err != nil {
+		return 500, err
+	}
+
+	err = gcpBind.UpdateIamPolicy(app.ObjectID, func() (*iam.Policy, error) {
+		return client.GetIamPolicy(app.ObjectID)
+	}, func(iamPolicy *iam.Policy) error {
+		return client.SetIamPolicy(app.ObjectID, iamPolicy)
+	}, bindings)
+	if errors.Is(err, gcpBind.ErrEtagConflict) {
+		return 409, err
+	}
+	if err != nil {
+		return 500, err
+	}
+	return 201, nil
+}
+
+// MapPolicyReport reports how policyInfos are represented as IAM bindings (see policyprovider.MappingReporter)
+func (g *GoogleIamProvider) MapPolicyReport(_ policyprovider.IntegrationInfo, _ policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+	g.initMapper()
+	_, report := g.GcpMapper.MapPoliciesToBindingsReport(policyInfos)
+	report.Target = g.Name()
+	return report, nil
+}
+
+/*
+Reconcile compares the supplied policies with the IAM policy of the resource. Because IAM bindings are merged by role
+and condition, differences are reported per binding (see gcpBind.GooglePolicyMapper ReconcileBindings).
+*/
+func (g *GoogleIamProvider) Reconcile(integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+	return g.ReconcileContext(context.Background(), integration, app, comparePolicies, diffsOnly)
+}
+
+func (g *GoogleIamProvider) ReconcileContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+	g.initMapper()
+
+	// Existing bindings are mapped through IDQL so that condition expressions are compared in the same form
+	existingPolicies, err := g.GetPolicyInfoContext(ctx, integration, app)
+	if err != nil {
+		return nil, err
+	}
+	existBindings, err := g.GcpMapper.MapPoliciesToIamBindings(existingPolicies)
+	if err != nil {
+		return nil, err
+	}
+	compareBindings, err := g.GcpMapper.MapPoliciesToIamBindings(comparePolicies)
+	if err != nil {
+		return nil, err
+	}
+	return g.GcpMapper.ReconcileBindings(app.ObjectID, existBindings, compareBindings, diffsOnly)
+}
+
+func (g *GoogleIamProvider) NewHttpClient(key []byte) (HTTPClient, error) {
+	return g.NewHttpClientContext(context.Background(), key)
+}
+
+// NewHttpClientContext is NewHttpClient where ctx bounds obtaining the OAuth token of the client
+func (g *GoogleIamProvider) NewHttpClientContext(ctx context.Context, key []byte) (HTTPClient, error) {
+	if len(key) == 0 {
+		return nil, errors.New("missing credentials")
+	}
+	opts := []option.ClientOption{
+		option.WithScopes("https://www.googleapis.com/auth/cloud-platform"),
+		option.WithCredentialsJSON(key),
+	}
+	client, _, err := http.NewClient(ctx, opts...)
+	return client, err
+}
+
+type credentials struct {
+	ProjectId string `json:"project_id"`
+}
+
+func (g *GoogleIamProvider) getClient(ctx context.Context, key []byte) (*GoogleIamClient, error) {
+	var foundCredentials credentials
+	_ = json.NewDecoder(bytes.NewReader(key)).Decode(&foundCredentials)
+	if foundCredentials.ProjectId == "" {
+		return nil, errors.New("google cloud credentials are missing project_id")
+	}
+
+	httpClient := g.HttpClientOverride
+	if httpClient == nil {
+		var err error
+		httpClient, err = g.NewHttpClientContext(ctx, key)
+		if err != nil {
+			fmt.Println("Unable to create google http client.")
+			return nil, err
+		}
+	}
+
+	endpoints := DefaultEndpoints()
+	if g.EndpointsOverride != nil {
+		endpoints = *g.EndpointsOverride
+	}
+	return &GoogleIamClient{HttpClient: httpClient, ProjectId: foundCredentials.ProjectId, Endpoints: endpoints, Context: ctx}, nil
+}
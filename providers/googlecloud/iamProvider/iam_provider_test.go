@@ -0,0 +1,323 @@
+package iamProvider_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/formats/gcpBind"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/providers/googlecloud/iamProvider"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iam/v1"
+)
+
+var info = policyprovider.IntegrationInfo{Name: iamProvider.ProviderTypeGoogleCloudIAM, Key: projectJSON}
+
+func newProvider(server *iamServer) *iamProvider.GoogleIamProvider {
+	return &iamProvider.GoogleIamProvider{HttpClientOverride: http.DefaultClient, EndpointsOverride: server.endpoints()}
+}
+
+func TestGoogleIamProvider_DiscoverApplications(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+	assert.Equal(t, iamProvider.ProviderTypeGoogleCloudIAM, p.Name())
+
+	apps, err := p.DiscoverApplications(info)
+	assert.NoError(t, err)
+	assert.Len(t, apps, 6)
+
+	assert.Equal(t, policyprovider.ApplicationInfo{
+		ObjectID:    projectName,
+		Name:        "projects/google-cloud-project-id",
+		Description: "Google Cloud project google-cloud-project-id",
+		Service:     iamProvider.ServiceTypeProject,
+	}, apps[0])
+	assert.Equal(t, folderName, apps[1].ObjectID)
+	assert.Equal(t, iamProvider.ServiceTypeFolder, apps[1].Service)
+	assert.Equal(t, "//cloudresourcemanager.googleapis.com/folders/222", apps[2].ObjectID)
+	assert.Equal(t, bucketName, apps[3].ObjectID)
+	assert.Equal(t, iamProvider.ServiceTypeBucket, apps[3].Service)
+	assert.Equal(t, "//storage.googleapis.com/projects/_/buckets/bucket-b", apps[4].ObjectID)
+	assert.Equal(t, topicName, apps[5].ObjectID)
+	assert.Equal(t, iamProvider.ServiceTypeTopic, apps[5].Service)
+
+	apps, err = p.DiscoverApplications(policyprovider.IntegrationInfo{Name: "gcp_iap", Key: projectJSON})
+	assert.NoError(t, err)
+	assert.Empty(t, apps)
+}
+
+func TestGoogleIamProvider_GetPolicyInfo(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+
+	policies, err := p.GetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: projectName})
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+	assert.Equal(t, []hexapolicy.ActionInfo{"gcp:roles/owner"}, policies[0].Actions)
+	assert.Equal(t, hexapolicy.SubjectInfo{"user:owner@example.com"}, policies[0].Subjects)
+	assert.Equal(t, projectName, policies[0].Object.String())
+	assert.NotNil(t, policies[1].Condition)
+
+	policies, err = p.GetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: bucketName})
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+	assert.Equal(t, hexapolicy.SubjectInfo{"allUsers"}, policies[0].Subjects)
+
+	policies, err = p.GetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: topicName})
+	assert.NoError(t, err)
+	assert.Empty(t, policies)
+
+	_, err = p.GetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: "//cloudresourcemanager.googleapis.com/folders/333"})
+	assert.Error(t, err)
+}
+
+func TestGoogleIamProvider_SetPolicyInfo(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+
+	policies := []hexapolicy.PolicyInfo{
+		{
+			Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+			Subjects: hexapolicy.SubjectInfo{"user:owner@example.com"},
+			Actions:  []hexapolicy.ActionInfo{"gcp:roles/owner", "gcp:roles/viewer"},
+			Object:   projectName,
+		},
+		{
+			Meta:      hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+			Subjects:  hexapolicy.SubjectInfo{"user:alice@example.com"},
+			Actions:   []hexapolicy.ActionInfo{"gcp:roles/editor"},
+			Object:    projectName,
+			Condition: &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: conditions.AAllow},
+		},
+		{
+			Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+			Subjects: hexapolicy.SubjectInfo{"user:bob@example.com"},
+			Actions:  []hexapolicy.ActionInfo{"gcp:roles/owner"},
+			Object:   projectName,
+		},
+	}
+	status, err := p.SetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: projectName}, policies)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, status)
+
+	stored := server.policy(projectName)
+	assert.Equal(t, int64(3), stored.Version)
+	assert.Len(t, stored.Bindings, 3)
+	assert.Equal(t, "roles/owner", stored.Bindings[0].Role)
+	assert.Equal(t, []string{"user:owner@example.com", "user:bob@example.com"}, stored.Bindings[0].Members)
+	assert.Equal(t, "roles/viewer", stored.Bindings[1].Role)
+	assert.Nil(t, stored.Bindings[1].Condition)
+	assert.Equal(t, "roles/editor", stored.Bindings[2].Role)
+	assert.NotNil(t, stored.Bindings[2].Condition)
+
+	// Cloud Storage policies are written with PUT and without the policy wrapper
+	bucketPolicy := []hexapolicy.PolicyInfo{{
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: hexapolicy.SubjectInfo{"group:readers@example.com"},
+		Actions:  []hexapolicy.ActionInfo{"gcp:roles/storage.objectViewer"},
+		Object:   bucketName,
+	}}
+	status, err = p.SetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: bucketName}, bucketPolicy)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, status)
+	assert.Equal(t, []string{"group:readers@example.com"}, server.policy(bucketName).Bindings[0].Members)
+	assert.Equal(t, int64(1), server.policy(bucketName).Version)
+
+	topicPolicy := []hexapolicy.PolicyInfo{{
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: hexapolicy.SubjectInfo{"serviceAccount:publisher@example.iam.gserviceaccount.com"},
+		Actions:  []hexapolicy.ActionInfo{"gcp:roles/pubsub.publisher"},
+		Object:   topicName,
+	}}
+	status, err = p.SetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: topicName}, topicPolicy)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, status)
+	assert.Equal(t, "roles/pubsub.publisher", server.policy(topicName).Bindings[0].Role)
+
+	// Round trip
+	read, err := p.GetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: topicName})
+	assert.NoError(t, err)
+	assert.True(t, read[0].Equals(topicPolicy[0]))
+
+	status, err = p.SetPolicyInfo(info, policyprovider.ApplicationInfo{}, topicPolicy)
+	assert.Error(t, err)
+	assert.Equal(t, 500, status)
+}
+
+func TestGoogleIamProvider_SetPolicyInfo_withConflict(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+	policies := []hexapolicy.PolicyInfo{{
+		Meta:     hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects: hexapolicy.SubjectInfo{"user:owner@example.com"},
+		Actions:  []hexapolicy.ActionInfo{"gcp:roles/owner"},
+		Object:   folderName,
+	}}
+
+	server.conflicts = 1
+	status, err := p.SetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: folderName}, policies)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, status)
+	assert.Equal(t, 2, server.sets)
+	assert.Equal(t, "roles/owner", server.policy(folderName).Bindings[0].Role)
+
+	// Storage reports a stale etag with 412 Precondition Failed
+	server.sets = 0
+	server.conflicts = gcpBind.MaxSetPolicyAttempts
+	status, err = p.SetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: bucketName}, policies)
+	assert.ErrorIs(t, err, gcpBind.ErrEtagConflict)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, gcpBind.MaxSetPolicyAttempts, server.sets)
+	assert.Equal(t, "roles/storage.objectViewer", server.policy(bucketName).Bindings[0].Role)
+}
+
+func TestGoogleIamProvider_SetPolicyInfo_withDenyCondition(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+	policies := []hexapolicy.PolicyInfo{{
+		Meta:      hexapolicy.MetaInfo{Version: hexapolicy.IdqlVersion},
+		Subjects:  hexapolicy.SubjectInfo{"user:owner@example.com"},
+		Actions:   []hexapolicy.ActionInfo{"gcp:roles/owner"},
+		Condition: &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: conditions.ADeny},
+		Object:    folderName,
+	}}
+
+	status, err := p.SetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: folderName}, policies)
+	assert.ErrorIs(t, err, gcpBind.ErrDenyCondition)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, 0, server.sets)
+}
+
+func TestGoogleIamProvider_SetPolicyInfo_keepsConcurrentChange(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+	app := policyprovider.ApplicationInfo{ObjectID: projectName}
+	existing, err := p.GetPolicyInfo(info, app)
+	assert.NoError(t, err)
+
+	// Another client grants an editor role while the owners are being changed
+	server.conflicts = 1
+	server.concurrentChange = func(policy *iam.Policy) {
+		policy.Bindings = append(policy.Bindings, &iam.Binding{Role: "roles/editor", Members: []string{"user:dave@example.com"}})
+	}
+	changed := existing[0]
+	changed.Subjects = hexapolicy.SubjectInfo{"user:owner@example.com", "user:bob@example.com"}
+	status, err := p.SetPolicyInfo(info, app, []hexapolicy.PolicyInfo{changed, existing[1]})
+	assert.NoError(t, err)
+	assert.Equal(t, 201, status)
+	assert.Equal(t, 2, server.sets)
+
+	bindings := server.policy(projectName).Bindings
+	assert.Len(t, bindings, 3)
+	assert.Equal(t, []string{"user:owner@example.com", "user:bob@example.com"}, bindings[0].Members)
+	assert.Equal(t, "roles/editor", bindings[2].Role, "the concurrent change should survive the retry")
+
+	// Both clients changing the owners is a conflict that is not retried
+	server.sets = 0
+	server.conflicts = 1
+	server.concurrentChange = func(policy *iam.Policy) {
+		policy.Bindings[0] = &iam.Binding{Role: "roles/owner", Members: []string{"user:carol@example.com"}}
+	}
+	changed.Subjects = hexapolicy.SubjectInfo{"user:alice@example.com"}
+	status, err = p.SetPolicyInfo(info, app, []hexapolicy.PolicyInfo{changed, existing[1]})
+	assert.ErrorIs(t, err, gcpBind.ErrEtagConflict)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, 1, server.sets)
+	assert.Equal(t, []string{"user:carol@example.com"}, server.policy(projectName).Bindings[0].Members)
+}
+
+func TestGoogleIamProvider_Reconcile(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+	app := policyprovider.ApplicationInfo{ObjectID: projectName}
+
+	existing, err := p.GetPolicyInfo(info, app)
+	assert.NoError(t, err)
+
+	difs, err := p.Reconcile(info, app, existing, true)
+	assert.NoError(t, err)
+	assert.Empty(t, difs)
+
+	difs, err = p.Reconcile(info, app, existing, false)
+	assert.NoError(t, err)
+	assert.Len(t, difs, 2)
+	assert.Equal(t, hexapolicy.ChangeTypeEqual, difs[0].Type)
+
+	changed := existing[0]
+	changed.Subjects = hexapolicy.SubjectInfo{"user:owner@example.com", "user:bob@example.com"}
+	difs, err = p.Reconcile(info, app, []hexapolicy.PolicyInfo{changed}, true)
+	assert.NoError(t, err)
+	assert.Len(t, difs, 2)
+	assert.Equal(t, hexapolicy.ChangeTypeUpdate, difs[0].Type)
+	assert.Equal(t, "roles/owner", difs[0].PolicyId)
+	assert.Equal(t, hexapolicy.ChangeTypeDelete, difs[1].Type)
+}
+
+func TestGoogleIamProvider_MapPolicyReport(t *testing.T) {
+	p := &iamProvider.GoogleIamProvider{}
+	report, err := p.MapPolicyReport(info, policyprovider.ApplicationInfo{ObjectID: projectName}, []hexapolicy.PolicyInfo{{
+		Subjects: hexapolicy.SubjectInfo{"user:alice@example.com"},
+		Actions:  []hexapolicy.ActionInfo{"gcp:roles/viewer"},
+	}, {
+		Subjects:  hexapolicy.SubjectInfo{"group:admins@example.com"},
+		Actions:   []hexapolicy.ActionInfo{"gcp:roles/editor"},
+		Condition: &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: conditions.ADeny},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, iamProvider.ProviderTypeGoogleCloudIAM, report.Target)
+	assert.Len(t, report.Policies, 2)
+	issues := report.Issues()
+	assert.Len(t, issues, 1)
+	assert.Contains(t, issues[0], "policy 1: POLICY DROPPED")
+}
+
+func TestGoogleIamProvider_Context(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+	app := policyprovider.ApplicationInfo{ObjectID: projectName}
+
+	policies, err := p.GetPolicyInfoContext(context.Background(), info, app)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = p.DiscoverApplicationsContext(ctx, info)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = p.GetPolicyInfoContext(ctx, info, app)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	status, err := p.SetPolicyInfoContext(ctx, info, app, policies)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 500, status)
+
+	_, err = p.ReconcileContext(ctx, info, app, policies, true)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGoogleIamProvider_BadCredentials(t *testing.T) {
+	server := newIamServer(t)
+	p := newProvider(server)
+	badInfo := policyprovider.IntegrationInfo{Name: iamProvider.ProviderTypeGoogleCloudIAM, Key: []byte("aKey")}
+
+	_, err := p.DiscoverApplications(badInfo)
+	assert.Error(t, err)
+
+	_, err = p.GetPolicyInfo(badInfo, policyprovider.ApplicationInfo{ObjectID: projectName})
+	assert.Error(t, err)
+
+	status, err := p.SetPolicyInfo(badInfo, policyprovider.ApplicationInfo{ObjectID: projectName}, []hexapolicy.PolicyInfo{})
+	assert.Error(t, err)
+	assert.Equal(t, 500, status)
+
+	_, err = p.Reconcile(badInfo, policyprovider.ApplicationInfo{ObjectID: projectName}, []hexapolicy.PolicyInfo{}, true)
+	assert.Error(t, err)
+
+	_, err = (&iamProvider.GoogleIamProvider{}).NewHttpClient(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package iamProvider_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/providers/googlecloud/iamProvider"
+	"google.golang.org/api/iam/v1"
+)
+
+const (
+	testProject = "google-cloud-project-id"
+
+	projectName = "//cloudresourcemanager.googleapis.com/projects/google-cloud-project-id"
+	folderName  = "//cloudresourcemanager.googleapis.com/folders/111"
+	bucketName  = "//storage.googleapis.com/projects/_/buckets/bucket-a"
+	topicName   = "//pubsub.googleapis.com/projects/google-cloud-project-id/topics/orders"
+)
+
+var projectJSON = []byte(`{
+  "type": "service_account",
+  "project_id": "google-cloud-project-id",
+  "client_email": "google-cloud-project-id@google-cloud-project-id.iam.gserviceaccount.com"
+}`)
+
+/*
+iamServer is an httptest stand-in for the Resource Manager, Cloud Storage and Pub/Sub IAM REST endpoints. Policies are
+held by full resource name and a new etag is issued on each update. A setIamPolicy request with a stale etag is
+rejected with the status the service would return (409 or 412).
+*/
+type iamServer struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	policies  map[string]*iam.Policy
+	etag      int
+	conflicts int // number of setIamPolicy requests that will see a concurrent update
+	sets      int
+	// concurrentChange, when set, is the change made to the policy by the simulated concurrent update
+	concurrentChange func(policy *iam.Policy)
+}
+
+func newIamServer(t *testing.T) *iamServer {
+	s := &iamServer{policies: map[string]*iam.Policy{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+
+	s.put(projectName, &iam.Policy{Bindings: []*iam.Binding{
+		{Role: "roles/owner", Members: []string{"user:owner@example.com"}},
+		{
+			Role:      "roles/viewer",
+			Members:   []string{"user:eve@example.com"},
+			Condition: &iam.Expr{Title: "expirable access", Expression: "request.time < timestamp('2020-10-01T00:00:00.000Z')"},
+		},
+	}, Version: 3})
+	s.put(folderName, &iam.Policy{Bindings: []*iam.Binding{{Role: "roles/resourcemanager.folderViewer", Members: []string{"group:admins@example.com"}}}, Version: 1})
+	s.put(bucketName, &iam.Policy{Bindings: []*iam.Binding{{Role: "roles/storage.objectViewer", Members: []string{"allUsers"}}}, Version: 1})
+	s.put(topicName, &iam.Policy{})
+	return s
+}
+
+func (s *iamServer) endpoints() *iamProvider.Endpoints {
+	return &iamProvider.Endpoints{ResourceManager: s.URL, Storage: s.URL, PubSub: s.URL}
+}
+
+func (s *iamServer) put(name string, policy *iam.Policy) {
+	s.etag++
+	policy.Etag = fmt.Sprintf("etag-%d", s.etag)
+	s.policies[name] = policy
+}
+
+func (s *iamServer) policy(name string) *iam.Policy {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.policies[name]
+}
+
+func (s *iamServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPost && path == "/v1/projects/"+testProject+":getAncestry":
+		writeJson(w, `{"ancestor": [
+			{"resourceId": {"type": "project", "id": "`+testProject+`"}},
+			{"resourceId": {"type": "folder", "id": "111"}},
+			{"resourceId": {"type": "folder", "id": "222"}},
+			{"resourceId": {"type": "organization", "id": "999"}}]}`)
+	case r.Method == http.MethodGet && path == "/storage/v1/b":
+		if r.URL.Query().Get("project") != testProject {
+			http.Error(w, "unknown project", http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("pageToken") == "" {
+			writeJson(w, `{"items": [{"name": "bucket-a"}], "nextPageToken": "page2"}`)
+			return
+		}
+		writeJson(w, `{"items": [{"name": "bucket-b"}]}`)
+	case r.Method == http.MethodGet && path == "/v1/projects/"+testProject+"/topics":
+		writeJson(w, `{"topics": [{"name": "projects/`+testProject+`/topics/orders"}]}`)
+	case strings.HasPrefix(path, "/v3/"):
+		s.handlePolicy(w, r, "//cloudresourcemanager.googleapis.com/", strings.TrimPrefix(path, "/v3/"), true, http.StatusConflict)
+	case strings.HasPrefix(path, "/storage/v1/b/") && strings.HasSuffix(path, "/iam"):
+		bucket := strings.TrimSuffix(strings.TrimPrefix(path, "/storage/v1/b/"), "/iam")
+		name := "//storage.googleapis.com/projects/_/buckets/" + bucket
+		switch r.Method {
+		case http.MethodGet:
+			s.handlePolicy(w, r, "", name+":getIamPolicy", false, http.StatusPreconditionFailed)
+		case http.MethodPut:
+			s.handlePolicy(w, r, "", name+":setIamPolicy", false, http.StatusPreconditionFailed)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case strings.HasPrefix(path, "/v1/projects/") && strings.Contains(path, "/topics/"):
+		s.handlePolicy(w, r, "//pubsub.googleapis.com/", strings.TrimPrefix(path, "/v1/"), true, http.StatusConflict)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *iamServer) handlePolicy(w http.ResponseWriter, r *http.Request, prefix string, path string, wrapped bool, conflictStatus int) {
+	name, method, _ := strings.Cut(path, ":")
+	name = prefix + name
+	current, ok := s.policies[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch method {
+	case "getIamPolicy":
+		body, _ := json.Marshal(current)
+		writeJson(w, string(body))
+	case "setIamPolicy":
+		s.sets++
+		var update iam.Policy
+		var err error
+		if wrapped {
+			var request struct {
+				Policy *iam.Policy `json:"policy"`
+			}
+			err = json.NewDecoder(r.Body).Decode(&request)
+			if request.Policy != nil {
+				update = *request.Policy
+			}
+		} else {
+			err = json.NewDecoder(r.Body).Decode(&update)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.conflicts > 0 {
+			// Simulate another client updating the policy after it was read
+			s.conflicts--
+			if s.concurrentChange != nil {
+				s.concurrentChange(current)
+			}
+			s.put(name, current)
+		}
+		if update.Etag != s.policies[name].Etag {
+			http.Error(w, "etag mismatch", conflictStatus)
+			return
+		}
+		for _, binding := range update.Bindings {
+			if binding.Condition != nil && update.Version != 3 {
+				http.Error(w, "conditional bindings require version 3", http.StatusBadRequest)
+				return
+			}
+		}
+		s.put(name, &update)
+		body, _ := json.Marshal(s.policies[name])
+		writeJson(w, string(body))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJson(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(body))
+}
@@ -2,6 +2,7 @@ package iapProvider
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/formats/gcpBind"
 	"google.golang.org/api/appengine/v1"
 	"google.golang.org/api/iam/v1"
 )
@@ -22,6 +24,45 @@ type HTTPClient interface {
 type GoogleClient struct {
 	HttpClient HTTPClient
 	ProjectId  string
+	Context    context.Context // Context of the client's requests (context.Background() when nil)
+}
+
+/*
+get and post make requests with the client's Context when the HttpClient is an *http.Client (see NewHttpClient).
+Otherwise the request is not made once the Context is done.
+*/
+func (c *GoogleClient) get(url string) (*http.Response, error) {
+	return c.do(http.MethodGet, url, "", nil)
+}
+
+func (c *GoogleClient) post(url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.do(http.MethodPost, url, contentType, body)
+}
+
+func (c *GoogleClient) do(method, url, contentType string, body io.Reader) (*http.Response, error) {
+	ctx := c.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	httpClient, ok := c.HttpClient.(*http.Client)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if method == http.MethodGet {
+			return c.HttpClient.Get(url)
+		}
+		return c.HttpClient.Post(url, contentType, body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return httpClient.Do(req)
 }
 
 type backends struct {
@@ -39,7 +80,7 @@ func (c *GoogleClient) GetAppEngineApplications() ([]policyprovider.ApplicationI
 	url := fmt.Sprintf("https://appengine.googleapis.com/v1/apps/%s", c.ProjectId)
 	var appEngine appengine.Application
 
-	get, err := c.HttpClient.Get(url)
+	get, err := c.get(url)
 	if err != nil {
 		log.Println("Unable to find google cloud app engine applications.")
 		return []policyprovider.ApplicationInfo{}, err
@@ -68,7 +109,7 @@ func (c *GoogleClient) GetAppEngineApplications() ([]policyprovider.ApplicationI
 func (c *GoogleClient) GetBackendApplications() ([]policyprovider.ApplicationInfo, error) {
 	url := fmt.Sprintf("https://compute.googleapis.com/compute/v1/projects/%s/global/backendServices", c.ProjectId)
 
-	get, err := c.HttpClient.Get(url)
+	get, err := c.get(url)
 	if err != nil {
 		log.Println("Unable to find google cloud backend services.")
 		return []policyprovider.ApplicationInfo{}, err
@@ -96,51 +137,83 @@ func (c *GoogleClient) GetBackendApplications() ([]policyprovider.ApplicationInf
 }
 
 type policy struct {
-	Policy bindings `json:"policy"`
+	Policy *iam.Policy `json:"policy"`
 }
 
-type bindings struct {
-	Bindings []iam.Binding `json:"bindings"`
+type getPolicyOptions struct {
+	Options iam.GetPolicyOptions `json:"options"`
 }
 
-func (c *GoogleClient) GetBackendPolicy(name, objectId string) ([]iam.Binding, error) {
-	var url string
+func (c *GoogleClient) iapUrl(name, objectId, method string) string {
 	if strings.HasPrefix(name, "apps") { // todo - revisit and improve the decision here
-		url = fmt.Sprintf("https://iap.googleapis.com/v1/projects/%s/iap_web/appengine-%s/services/default:getIamPolicy", c.ProjectId, objectId)
-	} else {
-		url = fmt.Sprintf("https://iap.googleapis.com/v1/projects/%s/iap_web/compute/services/%s:getIamPolicy", c.ProjectId, objectId)
+		return fmt.Sprintf("https://iap.googleapis.com/v1/projects/%s/iap_web/appengine-%s/services/default:%s", c.ProjectId, objectId, method)
 	}
+	return fmt.Sprintf("https://iap.googleapis.com/v1/projects/%s/iap_web/compute/services/%s:%s", c.ProjectId, objectId, method)
+}
+
+// GetIamPolicy returns the full IAM policy (bindings, etag and version) for the backend. Version 3 is requested so that
+// conditional bindings are returned.
+func (c *GoogleClient) GetIamPolicy(name, objectId string) (*iam.Policy, error) {
+	url := c.iapUrl(name, objectId, "getIamPolicy")
+
+	b := new(bytes.Buffer)
+	_ = json.NewEncoder(b).Encode(getPolicyOptions{Options: iam.GetPolicyOptions{RequestedPolicyVersion: 3}})
 
-	post, err := c.HttpClient.Post(url, "application/json", bytes.NewReader([]byte{}))
+	post, err := c.post(url, "application/json", b)
 	if err != nil {
 		log.Println("Unable to find google cloud policy.")
-		return []iam.Binding{}, err
+		return nil, err
 	}
 	log.Printf("Google cloud response %s.\n", post.Status)
+	if post.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("google cloud getIamPolicy failed with status %d", post.StatusCode)
+	}
 
-	var bindings bindings
-	if err = json.NewDecoder(post.Body).Decode(&bindings); err != nil {
+	var iamPolicy iam.Policy
+	if err = json.NewDecoder(post.Body).Decode(&iamPolicy); err != nil {
 		log.Println("Unable to decode google cloud policy.")
-		return []iam.Binding{}, err
+		return nil, err
 	}
-
-	return bindings.Bindings, nil
-
+	return &iamPolicy, nil
 }
 
-func (c *GoogleClient) SetBackendPolicy(name, objectId string, binding *iam.Binding) error { // todo - objectId may no longer be needed, at least for google
-	var url string
-	if strings.HasPrefix(name, "apps") { // todo - revisit and improve the decision here
-		url = fmt.Sprintf("https://iap.googleapis.com/v1/projects/%s/iap_web/appengine-%s/services/default:setIamPolicy", c.ProjectId, objectId)
-	} else {
-		url = fmt.Sprintf("https://iap.googleapis.com/v1/projects/%s/iap_web/compute/services/%s:setIamPolicy", c.ProjectId, objectId)
+func (c *GoogleClient) GetBackendPolicy(name, objectId string) ([]iam.Binding, error) {
+	iamPolicy, err := c.GetIamPolicy(name, objectId)
+	if err != nil {
+		return []iam.Binding{}, err
 	}
 
-	setPolicy := policy{Policy: bindings{Bindings: []iam.Binding{*binding}}}
+	bindings := make([]iam.Binding, len(iamPolicy.Bindings))
+	for i, binding := range iamPolicy.Bindings {
+		bindings[i] = *binding
+	}
+	return bindings, nil
+}
+
+// SetIamPolicy replaces the IAM policy of the backend. The etag of the policy returned by GetIamPolicy should be
+// included so that concurrent modification is detected, in which case gcpBind.ErrEtagConflict is returned.
+func (c *GoogleClient) SetIamPolicy(name, objectId string, iamPolicy *iam.Policy) error {
+	url := c.iapUrl(name, objectId, "setIamPolicy")
 
 	b := new(bytes.Buffer)
-	_ = json.NewEncoder(b).Encode(setPolicy)
+	_ = json.NewEncoder(b).Encode(policy{Policy: iamPolicy})
 
-	_, err := c.HttpClient.Post(url, "application/json", b)
-	return err
+	post, err := c.post(url, "application/json", b)
+	if err != nil {
+		return err
+	}
+	switch {
+	case post.StatusCode == http.StatusConflict, post.StatusCode == http.StatusPreconditionFailed:
+		return gcpBind.ErrEtagConflict
+	case post.StatusCode >= http.StatusMultipleChoices:
+		return fmt.Errorf("google cloud setIamPolicy failed with status %d", post.StatusCode)
+	}
+	return nil
+}
+
+// SetBackendPolicy replaces the IAM policy of the backend with a policy containing only the binding provided.
+//
+// Deprecated: use GetIamPolicy and SetIamPolicy to update the policy with all of its bindings and etag.
+func (c *GoogleClient) SetBackendPolicy(name, objectId string, binding *iam.Binding) error { // todo - objectId may no longer be needed, at least for google
+	return c.SetIamPolicy(name, objectId, &iam.Policy{Bindings: []*iam.Binding{binding}})
 }
@@ -1,7 +1,9 @@
 package iapProvider_test
 
 import (
+    "context"
     "errors"
+    "net/http"
     "testing"
 
     "github.com/hexa-org/policy-mapper/models/formats/gcpBind"
@@ -10,6 +12,7 @@ import (
 
     "github.com/hexa-org/policy-mapper/providers/googlecloud/iapProvider"
     "github.com/stretchr/testify/assert"
+    "google.golang.org/api/iam/v1"
 )
 
 func TestGoogleClient_GetAppEngineApplications(t *testing.T) {
@@ -26,6 +29,22 @@ func TestGoogleClient_GetAppEngineApplications(t *testing.T) {
     assert.Equal(t, "AppEngine", applications[0].Service)
 }
 
+func TestGoogleClient_Context(t *testing.T) {
+    m := testsupport.NewMockHTTPClient()
+    m.ResponseBody["https://appengine.googleapis.com/v1/apps/projectID"] = appEngineAppsJSON
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    client := iapProvider.GoogleClient{ProjectId: "projectID", HttpClient: m, Context: ctx}
+
+    _, err := client.GetAppEngineApplications()
+    assert.ErrorIs(t, err, context.Canceled)
+    assert.Equal(t, "", m.Url)
+
+    client.HttpClient = http.DefaultClient
+    _, err = client.GetIamPolicy("apps/hexa-demo", "anObjectId")
+    assert.ErrorIs(t, err, context.Canceled)
+}
+
 func TestGoogleClient_GetAppEngineApplications_when_404(t *testing.T) {
     m := testsupport.NewMockHTTPClient()
     m.StatusCode = 404
@@ -213,3 +232,45 @@ func TestGoogleClient_SetBackendPolicies_withRequestError(t *testing.T) {
     err = client.SetBackendPolicy("k8sName", "anObjectId", bindPolicy)
     assert.Error(t, err)
 }
+
+func TestGoogleClient_GetIamPolicy(t *testing.T) {
+    m := testsupport.NewMockHTTPClient()
+    m.ResponseBody["https://iap.googleapis.com/v1/projects/k8sproject/iap_web/compute/services/k8sObjectId:getIamPolicy"] = policyJSON
+    client := iapProvider.GoogleClient{HttpClient: m, ProjectId: "k8sproject"}
+
+    iamPolicy, err := client.GetIamPolicy("k8sName", "k8sObjectId")
+    assert.NoError(t, err)
+    assert.Equal(t, "BwWWja0YfJA=", iamPolicy.Etag)
+    assert.Equal(t, int64(3), iamPolicy.Version)
+    assert.Len(t, iamPolicy.Bindings, 2)
+    assert.NotNil(t, iamPolicy.Bindings[1].Condition)
+
+    m.StatusCode = 403
+    _, err = client.GetIamPolicy("k8sName", "k8sObjectId")
+    assert.Error(t, err)
+}
+
+func TestGoogleClient_SetIamPolicy_withConflict(t *testing.T) {
+    url := "https://iap.googleapis.com/v1/projects/k8sproject/iap_web/compute/services/k8sObjectId:setIamPolicy"
+    m := testsupport.NewMockHTTPClient()
+    client := iapProvider.GoogleClient{HttpClient: m, ProjectId: "k8sproject"}
+    iamPolicy := &iam.Policy{Etag: "BwWWja0YfJA=", Bindings: []*iam.Binding{{Role: "roles/viewer", Members: []string{"user:alice@example.com"}}}}
+
+    m.AddRequest(http.MethodPost, url, http.StatusConflict, nil)
+    err := client.SetIamPolicy("k8sName", "k8sObjectId", iamPolicy)
+    assert.ErrorIs(t, err, gcpBind.ErrEtagConflict)
+
+    m.AddRequest(http.MethodPost, url, http.StatusPreconditionFailed, nil)
+    err = client.SetIamPolicy("k8sName", "k8sObjectId", iamPolicy)
+    assert.ErrorIs(t, err, gcpBind.ErrEtagConflict)
+
+    m.AddRequest(http.MethodPost, url, http.StatusBadRequest, nil)
+    err = client.SetIamPolicy("k8sName", "k8sObjectId", iamPolicy)
+    assert.Error(t, err)
+    assert.NotErrorIs(t, err, gcpBind.ErrEtagConflict)
+
+    m.AddRequest(http.MethodPost, url, http.StatusOK, nil)
+    err = client.SetIamPolicy("k8sName", "k8sObjectId", iamPolicy)
+    assert.NoError(t, err)
+    assert.Contains(t, string(m.GetRequestBodyByKey(http.MethodPost, url)), `"etag":"BwWWja0YfJA="`)
+}
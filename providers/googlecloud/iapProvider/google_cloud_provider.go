@@ -11,6 +11,7 @@ import (
     "github.com/hexa-org/policy-mapper/api/policyprovider"
     "github.com/hexa-org/policy-mapper/models/formats/gcpBind"
     "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+    "google.golang.org/api/iam/v1"
     "google.golang.org/api/option"
     "google.golang.org/api/transport/http"
 
@@ -35,23 +36,37 @@ func (g *GoogleProvider) Name() string {
     return ProviderTypeGoogleCloudIAP
 }
 
+// Capabilities reports that IAP policies are IAM bindings, whose conditions can only allow access
+func (g *GoogleProvider) Capabilities() policyprovider.Capabilities {
+    return policyprovider.Capabilities{
+        Conditions:      true,
+        MultipleActions: true,
+        Objects:         true,
+        SubjectTypes:    gcpBind.IamMemberTypes,
+    }
+}
+
 func (g *GoogleProvider) Project(key []byte) string {
     return g.credentials(key).ProjectId
 }
 
 func (g *GoogleProvider) DiscoverApplications(info policyprovider.IntegrationInfo) (apps []policyprovider.ApplicationInfo, err error) {
+    return g.DiscoverApplicationsContext(context.Background(), info)
+}
+
+func (g *GoogleProvider) DiscoverApplicationsContext(ctx context.Context, info policyprovider.IntegrationInfo) (apps []policyprovider.ApplicationInfo, err error) {
     if !strings.EqualFold(info.Name, g.Name()) {
         return apps, err
     }
 
     key := info.Key
     foundCredentials := g.credentials(key)
-    client, createClientErr := g.getHttpClient(key)
+    client, createClientErr := g.getHttpClient(ctx, key)
     if createClientErr != nil {
         fmt.Println("Unable to create google http client.")
         return apps, createClientErr
     }
-    googleClient := GoogleClient{client, foundCredentials.ProjectId}
+    googleClient := GoogleClient{client, foundCredentials.ProjectId, ctx}
 
     backendApplications, err1 := googleClient.GetBackendApplications()
     apps = append(apps, backendApplications...)
@@ -68,16 +83,20 @@ func (g *GoogleProvider) DiscoverApplications(info policyprovider.IntegrationInf
 }
 
 func (g *GoogleProvider) GetPolicyInfo(integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo) (infos []hexapolicy.PolicyInfo, err error) {
+    return g.GetPolicyInfoContext(context.Background(), integration, app)
+}
+
+func (g *GoogleProvider) GetPolicyInfoContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo) (infos []hexapolicy.PolicyInfo, err error) {
     g.initMapper()
 
     key := integration.Key
     foundCredentials := g.credentials(key)
-    client, createClientErr := g.getHttpClient(key)
+    client, createClientErr := g.getHttpClient(ctx, key)
     if createClientErr != nil {
         fmt.Println("Unable to create google http client.")
         return infos, createClientErr
     }
-    googleClient := GoogleClient{client, foundCredentials.ProjectId}
+    googleClient := GoogleClient{client, foundCredentials.ProjectId, ctx}
 
     bindings, err := googleClient.GetBackendPolicy(app.Name, app.ObjectID)
     if err != nil {
@@ -98,6 +117,10 @@ func (g *GoogleProvider) GetPolicyInfo(integration policyprovider.IntegrationInf
 }
 
 func (g *GoogleProvider) SetPolicyInfo(integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+    return g.SetPolicyInfoContext(context.Background(), integration, app, policyInfos)
+}
+
+func (g *GoogleProvider) SetPolicyInfoContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
     g.initMapper()
 
     validate := validator.New() // todo - move this up?
@@ -112,35 +135,83 @@ func (g *GoogleProvider) SetPolicyInfo(integration policyprovider.IntegrationInf
 
     key := integration.Key
     foundCredentials := g.credentials(key)
-    client, createClientErr := g.getHttpClient(key)
+    client, createClientErr := g.getHttpClient(ctx, key)
     if createClientErr != nil {
         fmt.Println("Unable to create google http client.")
         return 500, createClientErr
     }
-    googleClient := GoogleClient{client, foundCredentials.ProjectId}
-    for _, policyInfo := range policyInfos {
+    googleClient := GoogleClient{client, foundCredentials.ProjectId, ctx}
 
-        binding, err := g.GcpMapper.MapPolicyToBinding(policyInfo)
-        if err != nil {
-            return 500, err
-        }
+    bindings, err := g.GcpMapper.MapPoliciesToIamBindings(policyInfos)
+    if errors.Is(err, gcpBind.ErrDenyCondition) {
+        return 400, err
+    }
+    if err != nil {
+        return 500, err
+    }
 
-        err = googleClient.SetBackendPolicy(app.Name, app.ObjectID, binding)
-        if err != nil {
-            return 500, err
-        }
+    err = gcpBind.UpdateIamPolicy(app.ObjectID, func() (*iam.Policy, error) {
+        return googleClient.GetIamPolicy(app.Name, app.ObjectID)
+    }, func(iamPolicy *iam.Policy) error {
+        return googleClient.SetIamPolicy(app.Name, app.ObjectID, iamPolicy)
+    }, bindings)
+    if errors.Is(err, gcpBind.ErrEtagConflict) {
+        return 409, err
+    }
+    if err != nil {
+        return 500, err
     }
     return 201, nil
 }
 
+// MapPolicyReport reports how policyInfos are represented as IAP IAM bindings (see policyprovider.MappingReporter)
+func (g *GoogleProvider) MapPolicyReport(_ policyprovider.IntegrationInfo, _ policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+    g.initMapper()
+    _, report := g.GcpMapper.MapPoliciesToBindingsReport(policyInfos)
+    report.Target = g.Name()
+    return report, nil
+}
+
+/*
+Reconcile compares the supplied policies with the IAM policy of the application. Because IAM bindings are merged by
+role and condition, differences are reported per binding (see gcpBind.GooglePolicyMapper ReconcileBindings).
+*/
+func (g *GoogleProvider) Reconcile(integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+    return g.ReconcileContext(context.Background(), integration, app, comparePolicies, diffsOnly)
+}
+
+func (g *GoogleProvider) ReconcileContext(ctx context.Context, integration policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+    g.initMapper()
+
+    existingPolicies, err := g.GetPolicyInfoContext(ctx, integration, app)
+    if err != nil {
+        return nil, err
+    }
+    existBindings, err := g.GcpMapper.MapPoliciesToIamBindings(existingPolicies)
+    if err != nil {
+        return nil, err
+    }
+    compareBindings, err := g.GcpMapper.MapPoliciesToIamBindings(comparePolicies)
+    if err != nil {
+        return nil, err
+    }
+
+    return g.GcpMapper.ReconcileBindings(app.ObjectID, existBindings, compareBindings, diffsOnly)
+}
+
 func (g *GoogleProvider) NewHttpClient(key []byte) (HTTPClient, error) {
+    return g.NewHttpClientContext(context.Background(), key)
+}
+
+// NewHttpClientContext is NewHttpClient where ctx bounds obtaining the OAuth token of the client
+func (g *GoogleProvider) NewHttpClientContext(ctx context.Context, key []byte) (HTTPClient, error) {
     var opts []option.ClientOption
     opt := option.WithCredentialsJSON(key)
     if key == nil || len(key) == 0 {
         return nil, errors.New("missing credentials")
     }
     opts = append([]option.ClientOption{option.WithScopes("https://www.googleapis.com/auth/cloud-platform")}, opt)
-    client, _, err := http.NewClient(context.Background(), opts...)
+    client, _, err := http.NewClient(ctx, opts...)
     return client, err
 }
 
@@ -154,9 +225,9 @@ func (g *GoogleProvider) credentials(key []byte) credentials {
     return foundCredentials
 }
 
-func (g *GoogleProvider) getHttpClient(key []byte) (HTTPClient, error) {
+func (g *GoogleProvider) getHttpClient(ctx context.Context, key []byte) (HTTPClient, error) {
     if g.HttpClientOverride != nil {
         return g.HttpClientOverride, nil
     }
-    return g.NewHttpClient(key)
+    return g.NewHttpClientContext(ctx, key)
 }
@@ -1,11 +1,18 @@
 package iapProvider_test
 
 import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "strings"
     "testing"
 
     "github.com/hexa-org/policy-mapper/api/policyprovider"
+    "github.com/hexa-org/policy-mapper/models/formats/gcpBind"
     "github.com/hexa-org/policy-mapper/models/rar/testsupport"
     "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+    "github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+    "google.golang.org/api/iam/v1"
 
     "github.com/hexa-org/policy-mapper/providers/googlecloud/iapProvider"
     "github.com/stretchr/testify/assert"
@@ -102,17 +109,214 @@ func TestGoogleProvider_GetPolicy(t *testing.T) {
     assert.Equal(t, 2, len(infos))
 }
 
+const (
+    getPolicyUrl = "https://iap.googleapis.com/v1/projects/google-cloud-project-id/iap_web/compute/services/k8sObjectId:getIamPolicy"
+    setPolicyUrl = "https://iap.googleapis.com/v1/projects/google-cloud-project-id/iap_web/compute/services/k8sObjectId:setIamPolicy"
+)
+
+// conflictClient returns an etag conflict for the first 'conflicts' setIamPolicy requests. When concurrentPolicy is
+// set, it is returned by getIamPolicy after a conflict, as if written by another client.
+type conflictClient struct {
+    *testsupport.MockHTTPClient
+    conflicts        int
+    sets             int
+    concurrentPolicy []byte
+}
+
+func (c *conflictClient) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+    resp, err := c.MockHTTPClient.Post(url, contentType, body)
+    if strings.HasSuffix(url, ":setIamPolicy") {
+        c.sets++
+        if c.sets <= c.conflicts {
+            resp.StatusCode = http.StatusConflict
+            if c.concurrentPolicy != nil {
+                c.ResponseBody[getPolicyUrl] = c.concurrentPolicy
+            }
+        }
+    }
+    return resp, err
+}
+
 func TestGoogleProvider_SetPolicy(t *testing.T) {
+    policies := []hexapolicy.PolicyInfo{
+        {
+            Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor", "gcp:roles/viewer"}, Subjects: []string{"user:alice@example.com"}, Object: "k8sObjectId",
+        },
+        {
+            Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor"}, Subjects: []string{"user:bob@example.com"}, Object: "k8sObjectId",
+        },
+    }
+    m := testsupport.NewMockHTTPClient()
+    m.ResponseBody[getPolicyUrl] = policyJSON
+
+    p := iapProvider.GoogleProvider{HttpClientOverride: m}
+    info := policyprovider.IntegrationInfo{Name: iapProvider.ProviderTypeGoogleCloudIAP, Key: projectJSON}
+    status, err := p.SetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: "k8sObjectId", Name: "k8sName"}, policies)
+    assert.Equal(t, 201, status)
+    assert.NoError(t, err)
+
+    // All policies are written in a single request with the etag of the policy read
+    assert.JSONEq(t, `{
+  "policy": {
+    "bindings": [
+      {
+        "role": "roles/iap.httpsResourceAccessor",
+        "members": ["user:alice@example.com", "user:bob@example.com"]
+      },
+      {
+        "role": "roles/viewer",
+        "members": ["user:alice@example.com"]
+      }
+    ],
+    "etag": "BwWWja0YfJA=",
+    "version": 1
+  }
+}`, string(m.GetRequestBody(setPolicyUrl)))
+    assert.JSONEq(t, `{"options": {"requestedPolicyVersion": 3}}`, string(m.GetRequestBody(getPolicyUrl)))
+}
+
+func TestGoogleProvider_SetPolicy_withCondition(t *testing.T) {
     policy := hexapolicy.PolicyInfo{
-        Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"aUser"}, Object: "anObjectId",
+        Meta:      hexapolicy.MetaInfo{Version: "aVersion"},
+        Actions:   []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor"},
+        Subjects:  []string{"user:alice@example.com"},
+        Object:    "k8sObjectId",
+        Condition: &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: conditions.AAllow},
     }
     m := testsupport.NewMockHTTPClient()
+    m.ResponseBody[getPolicyUrl] = policyJSON
 
     p := iapProvider.GoogleProvider{HttpClientOverride: m}
-    info := policyprovider.IntegrationInfo{Name: iapProvider.ProviderTypeGoogleCloudIAP, Key: []byte("aKey")}
-    status, err := p.SetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: "anObjectId"}, []hexapolicy.PolicyInfo{policy})
+    info := policyprovider.IntegrationInfo{Name: iapProvider.ProviderTypeGoogleCloudIAP, Key: projectJSON}
+    status, err := p.SetPolicyInfo(info, policyprovider.ApplicationInfo{ObjectID: "k8sObjectId", Name: "k8sName"}, []hexapolicy.PolicyInfo{policy})
     assert.Equal(t, 201, status)
     assert.NoError(t, err)
+
+    var request struct {
+        Policy iam.Policy `json:"policy"`
+    }
+    assert.NoError(t, json.Unmarshal(m.GetRequestBody(setPolicyUrl), &request))
+    assert.Equal(t, int64(3), request.Policy.Version)
+    assert.Len(t, request.Policy.Bindings, 1)
+    assert.NotNil(t, request.Policy.Bindings[0].Condition)
+}
+
+func TestGoogleProvider_SetPolicy_retriesOnConflict(t *testing.T) {
+    policy := hexapolicy.PolicyInfo{
+        Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"gcp:roles/viewer"}, Subjects: []string{"user:alice@example.com"}, Object: "k8sObjectId",
+    }
+    info := policyprovider.IntegrationInfo{Name: iapProvider.ProviderTypeGoogleCloudIAP, Key: projectJSON}
+    app := policyprovider.ApplicationInfo{ObjectID: "k8sObjectId", Name: "k8sName"}
+
+    m := &conflictClient{MockHTTPClient: testsupport.NewMockHTTPClient(), conflicts: 1}
+    m.ResponseBody[getPolicyUrl] = policyJSON
+    p := iapProvider.GoogleProvider{HttpClientOverride: m}
+
+    status, err := p.SetPolicyInfo(info, app, []hexapolicy.PolicyInfo{policy})
+    assert.Equal(t, 201, status)
+    assert.NoError(t, err)
+    assert.Equal(t, 2, m.sets)
+
+    m = &conflictClient{MockHTTPClient: testsupport.NewMockHTTPClient(), conflicts: gcpBind.MaxSetPolicyAttempts}
+    m.ResponseBody[getPolicyUrl] = policyJSON
+    p = iapProvider.GoogleProvider{HttpClientOverride: m}
+
+    status, err = p.SetPolicyInfo(info, app, []hexapolicy.PolicyInfo{policy})
+    assert.Equal(t, http.StatusConflict, status)
+    assert.ErrorIs(t, err, gcpBind.ErrEtagConflict)
+    assert.Equal(t, gcpBind.MaxSetPolicyAttempts, m.sets)
+}
+
+func TestGoogleProvider_SetPolicy_keepsConcurrentChange(t *testing.T) {
+    policy := hexapolicy.PolicyInfo{
+        Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"gcp:roles/viewer"}, Subjects: []string{"user:alice@example.com"}, Object: "k8sObjectId",
+    }
+    info := policyprovider.IntegrationInfo{Name: iapProvider.ProviderTypeGoogleCloudIAP, Key: projectJSON}
+    app := policyprovider.ApplicationInfo{ObjectID: "k8sObjectId", Name: "k8sName"}
+
+    // Another client adds an editor binding between the first read and write
+    m := &conflictClient{MockHTTPClient: testsupport.NewMockHTTPClient(), conflicts: 1, concurrentPolicy: []byte(`{
+  "bindings": [
+    {"role": "roles/resourcemanager.organizationAdmin", "members": ["user:phil@example.com"]},
+    {"role": "roles/editor", "members": ["user:dave@example.com"]}
+  ],
+  "etag": "BwWWja0YfJB=",
+  "version": 1
+}`)}
+    m.ResponseBody[getPolicyUrl] = []byte(`{
+  "bindings": [{"role": "roles/resourcemanager.organizationAdmin", "members": ["user:phil@example.com"]}],
+  "etag": "BwWWja0YfJA=",
+  "version": 1
+}`)
+    p := iapProvider.GoogleProvider{HttpClientOverride: m}
+
+    status, err := p.SetPolicyInfo(info, app, []hexapolicy.PolicyInfo{policy})
+    assert.Equal(t, 201, status)
+    assert.NoError(t, err)
+    assert.Equal(t, 2, m.sets)
+    assert.JSONEq(t, `{
+  "policy": {
+    "bindings": [
+      {"role": "roles/viewer", "members": ["user:alice@example.com"]},
+      {"role": "roles/editor", "members": ["user:dave@example.com"]}
+    ],
+    "etag": "BwWWja0YfJB=",
+    "version": 1
+  }
+}`, string(m.GetRequestBody(setPolicyUrl)))
+
+    // A binding removed by the update that was changed by another client is a conflict
+    m = &conflictClient{MockHTTPClient: testsupport.NewMockHTTPClient(), conflicts: 1, concurrentPolicy: []byte(`{
+  "bindings": [{"role": "roles/resourcemanager.organizationAdmin", "members": ["user:phil@example.com", "user:dave@example.com"]}],
+  "etag": "BwWWja0YfJB="
+}`)}
+    m.ResponseBody[getPolicyUrl] = policyJSON
+    p = iapProvider.GoogleProvider{HttpClientOverride: m}
+
+    status, err = p.SetPolicyInfo(info, app, []hexapolicy.PolicyInfo{policy})
+    assert.Equal(t, http.StatusConflict, status)
+    assert.ErrorIs(t, err, gcpBind.ErrEtagConflict)
+    assert.Equal(t, 1, m.sets)
+}
+
+func TestGoogleProvider_Reconcile(t *testing.T) {
+    m := testsupport.NewMockHTTPClient()
+    m.ResponseBody[getPolicyUrl] = policyJSON
+    p := iapProvider.GoogleProvider{HttpClientOverride: m}
+    info := policyprovider.IntegrationInfo{Name: iapProvider.ProviderTypeGoogleCloudIAP, Key: projectJSON}
+    app := policyprovider.ApplicationInfo{ObjectID: "k8sObjectId", Name: "k8sName"}
+
+    existing, err := p.GetPolicyInfo(info, app)
+    assert.NoError(t, err)
+    assert.Len(t, existing, 2)
+
+    difs, err := p.Reconcile(info, app, existing, false)
+    assert.NoError(t, err)
+    assert.Len(t, difs, 2)
+    for _, dif := range difs {
+        assert.Equal(t, hexapolicy.ChangeTypeEqual, dif.Type)
+    }
+
+    difs, err = p.Reconcile(info, app, existing, true)
+    assert.NoError(t, err)
+    assert.Len(t, difs, 0)
+
+    // Change the members of the first binding, remove the second and add a new one
+    changed := existing[0]
+    changed.Subjects = []string{"user:phil@example.com"}
+    added := hexapolicy.PolicyInfo{
+        Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"gcp:roles/viewer"}, Subjects: []string{"user:alice@example.com"}, Object: "k8sObjectId",
+    }
+    difs, err = p.Reconcile(info, app, []hexapolicy.PolicyInfo{changed, added}, true)
+    assert.NoError(t, err)
+    assert.Len(t, difs, 3)
+    assert.Equal(t, hexapolicy.ChangeTypeUpdate, difs[0].Type)
+    assert.Equal(t, "roles/resourcemanager.organizationAdmin", difs[0].PolicyId)
+    assert.Equal(t, []string{hexapolicy.CompareDifSubject}, difs[0].DifTypes)
+    assert.Equal(t, hexapolicy.ChangeTypeNew, difs[1].Type)
+    assert.Equal(t, "roles/viewer", difs[1].PolicyId)
+    assert.Equal(t, hexapolicy.ChangeTypeDelete, difs[2].Type)
+    assert.True(t, strings.HasPrefix(difs[2].PolicyId, "roles/resourcemanager.organizationViewer if "))
 }
 
 func TestGoogleProvider_SetPolicy_withInvalidArguments(t *testing.T) {
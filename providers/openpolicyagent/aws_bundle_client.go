@@ -21,14 +21,20 @@ type AWSBundleClient struct {
 	bucketName string
 	objectName string
 	httpClient *s3.Client
+	ctx        context.Context
 }
 
 func NewAWSBundleClient(bucketName, objectName string, key []byte, opts awscommon.AWSClientOptions) (*AWSBundleClient, error) {
+	return NewAWSBundleClientContext(context.Background(), bucketName, objectName, key, opts)
+}
+
+// NewAWSBundleClientContext is NewAWSBundleClient where the requests of the client are made with ctx
+func NewAWSBundleClientContext(ctx context.Context, bucketName, objectName string, key []byte, opts awscommon.AWSClientOptions) (*AWSBundleClient, error) {
 	if len(bucketName) == 0 || len(objectName) == 0 {
 		return nil, fmt.Errorf("required config: bucket_name, object_name")
 	}
 
-	cfg, err := awscommon.GetAwsClientConfig(key, opts)
+	cfg, err := awscommon.GetAwsClientConfigContext(ctx, key, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +45,7 @@ func NewAWSBundleClient(bucketName, objectName string, key []byte, opts awscommo
 		bucketName: bucketName,
 		objectName: objectName,
 		httpClient: s3Client,
+		ctx:        ctx,
 	}
 
 	return bundleClient, nil
@@ -49,7 +56,7 @@ func (a *AWSBundleClient) Type() string {
 }
 
 func (a *AWSBundleClient) GetDataFromBundle(path string) ([]byte, error) {
-	resp, err := a.httpClient.GetObject(context.Background(),
+	resp, err := a.httpClient.GetObject(a.ctx,
 		&s3.GetObjectInput{Bucket: aws.String(a.bucketName), Key: aws.String(a.objectName)})
 
 	if err != nil {
@@ -72,7 +79,7 @@ func (a *AWSBundleClient) GetDataFromBundle(path string) ([]byte, error) {
 }
 
 func (a *AWSBundleClient) PostBundle(bundle []byte) (int, error) {
-	_, err := a.httpClient.PutObject(context.Background(),
+	_, err := a.httpClient.PutObject(a.ctx,
 		&s3.PutObjectInput{
 			Bucket:      aws.String(a.bucketName),
 			Key:         aws.String(a.objectName),
@@ -25,6 +25,7 @@ type GCPBundleClient struct {
     bucketName      string
     objectName      string
     httpClient      HTTPClient
+    ctx             context.Context
 }
 
 type GCPBundleClientOpt func(client *GCPBundleClient)
@@ -36,11 +37,16 @@ func WithGcpHTTPClient(c HTTPClient) GCPBundleClientOpt {
 }
 
 func NewGCPBundleClient(bucketName, objectName string, key []byte, opts ...GCPBundleClientOpt) (*GCPBundleClient, error) {
+    return NewGCPBundleClientContext(context.Background(), bucketName, objectName, key, opts...)
+}
+
+// NewGCPBundleClientContext is NewGCPBundleClient where the requests of the client are made with ctx
+func NewGCPBundleClientContext(ctx context.Context, bucketName, objectName string, key []byte, opts ...GCPBundleClientOpt) (*GCPBundleClient, error) {
     opt := option.WithCredentialsJSON(key)
     gClientOpts := append([]option.ClientOption{
         option.WithScopes("https://www.googleapis.com/auth/devstorage.read_write"),
     }, opt)
-    client, _, err := ghttp.NewClient(context.Background(), gClientOpts...)
+    client, _, err := ghttp.NewClient(ctx, gClientOpts...)
     if err != nil {
         return nil, fmt.Errorf("unable to create GCS storage client: %w", err)
     }
@@ -53,6 +59,7 @@ func NewGCPBundleClient(bucketName, objectName string, key []byte, opts ...GCPBu
         bucketName: bucketName,
         objectName: objectName,
         httpClient: client,
+        ctx:        ctx,
     }
 
     for _, o := range opts {
@@ -68,7 +75,7 @@ func (g *GCPBundleClient) Type() string {
 
 func (g *GCPBundleClient) GetDataFromBundle(path string) ([]byte, error) {
     urlGoogle := fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s?alt=media", g.bucketName, g.objectName)
-    resp, err := g.httpClient.Get(urlGoogle)
+    resp, err := contextRequest(g.ctx, g.httpClient, urlGoogle, "", nil)
     if err != nil {
         return nil, err
     }
@@ -89,7 +96,7 @@ func (g *GCPBundleClient) GetDataFromBundle(path string) ([]byte, error) {
 
 func (g *GCPBundleClient) PostBundle(bundle []byte) (int, error) {
     getObjectMetadataURL := fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s", g.bucketName, g.objectName)
-    resp, err := g.httpClient.Get(getObjectMetadataURL)
+    resp, err := contextRequest(g.ctx, g.httpClient, getObjectMetadataURL, "", nil)
     if err != nil {
         panic(err)
     }
@@ -114,7 +121,7 @@ func (g *GCPBundleClient) PostBundle(bundle []byte) (int, error) {
     postObjectURL.RawQuery = query.Encode()
 
     contentType := http.DetectContentType(bundle)
-    resp, err = g.httpClient.Post(postObjectURL.String(), contentType, bytes.NewReader(bundle))
+    resp, err = contextRequest(g.ctx, g.httpClient, postObjectURL.String(), contentType, bytes.NewReader(bundle))
     if err != nil {
         return http.StatusInternalServerError, fmt.Errorf("unable to write bundle object to GCS bucket: %w", err)
     }
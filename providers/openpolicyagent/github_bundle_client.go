@@ -2,6 +2,7 @@ package openpolicyagent
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -40,6 +41,7 @@ type GithubBundleClient struct {
 	bundlePath     string
 	credentialsKey githubCredentialsKey
 	httpClient     GithubHTTPClient
+	ctx            context.Context
 }
 
 type GithubPublishInfo struct {
@@ -70,6 +72,11 @@ func (o *GithubBundleClientOptions) githubHttpClient() GithubHTTPClient {
 }
 
 func NewGithubBundleClient(account, repo, bundlePath string, key []byte, opts GithubBundleClientOptions) (*GithubBundleClient, error) {
+	return NewGithubBundleClientContext(context.Background(), account, repo, bundlePath, key, opts)
+}
+
+// NewGithubBundleClientContext is NewGithubBundleClient where the requests of the client are made with ctx
+func NewGithubBundleClientContext(ctx context.Context, account, repo, bundlePath string, key []byte, opts GithubBundleClientOptions) (*GithubBundleClient, error) {
 
 	if len(account) == 0 || len(repo) == 0 || len(bundlePath) == 0 {
 		return nil, fmt.Errorf("required config: account, repo, branch, bundle")
@@ -90,6 +97,7 @@ func NewGithubBundleClient(account, repo, bundlePath string, key []byte, opts Gi
 		bundlePath:     bundlePath,
 		credentialsKey: ghCredentials,
 		httpClient:     opts.githubHttpClient(),
+		ctx:            ctx,
 	}, nil
 }
 
@@ -196,7 +204,7 @@ func parseGithubError(body []byte) string {
 }
 
 func (g *GithubBundleClient) newRequest(method, token, url string, body io.ReadCloser) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(requestContext(g.ctx), method, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -2,6 +2,7 @@ package openpolicyagent
 
 import (
     "bytes"
+    "context"
     "fmt"
     "strings"
 
@@ -32,6 +33,46 @@ type HTTPBundleClient struct {
     BundleServerURL string
     Authorization   *string
     HttpClient      HTTPClient
+    Context         context.Context // Context of the client's requests (context.Background() when nil)
+}
+
+// requestContext returns ctx, or context.Background() when ctx is nil
+func requestContext(ctx context.Context) context.Context {
+    if ctx == nil {
+        return context.Background()
+    }
+    return ctx
+}
+
+/*
+contextRequest makes a GET (when body is nil) or POST request with ctx when client is an *http.Client. Other clients are
+called with Get or Post, and the request is not made once ctx is done.
+*/
+func contextRequest(ctx context.Context, client HTTPClient, url string, contentType string, body io.Reader) (*http.Response, error) {
+    ctx = requestContext(ctx)
+    httpClient, ok := client.(*http.Client)
+    if !ok {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        if body == nil {
+            return client.Get(url)
+        }
+        return client.Post(url, contentType, body)
+    }
+
+    method := http.MethodGet
+    if body != nil {
+        method = http.MethodPost
+    }
+    req, err := http.NewRequestWithContext(ctx, method, url, body)
+    if err != nil {
+        return nil, err
+    }
+    if contentType != "" {
+        req.Header.Set("Content-Type", contentType)
+    }
+    return httpClient.Do(req)
 }
 
 func (b *HTTPBundleClient) Type() string {
@@ -91,7 +132,7 @@ func (b *HTTPBundleClient) PostBundle(bundle []byte) (int, error) {
 }
 
 func (b *HTTPBundleClient) newRequest(method, url string, contentType *string, body io.Reader) (*http.Response, error) {
-    req, err := http.NewRequest(method, url, body)
+    req, err := http.NewRequestWithContext(requestContext(b.Context), method, url, body)
     if err != nil {
         return nil, err
     }
@@ -2,6 +2,7 @@ package openpolicyagent
 
 import (
     "bytes"
+    "context"
     "crypto/tls"
     "crypto/x509"
     _ "embed"
@@ -57,7 +58,20 @@ func (o *OpaProvider) Name() string {
     return ProviderTypeOpa
 }
 
+// Capabilities reports FullCapabilities because IDQL policies are stored unchanged in the OPA bundle
+func (o *OpaProvider) Capabilities() policyprovider.Capabilities {
+    return policyprovider.FullCapabilities
+}
+
 func (o *OpaProvider) DiscoverApplications(info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
+    return o.DiscoverApplicationsContext(context.Background(), info)
+}
+
+// DiscoverApplicationsContext returns the application of the integration key, which requires no request
+func (o *OpaProvider) DiscoverApplicationsContext(ctx context.Context, info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
     c, err := o.credentials(info.Key)
     if err != nil {
         return nil, err
@@ -70,9 +84,13 @@ func (o *OpaProvider) DiscoverApplications(info policyprovider.IntegrationInfo)
     return apps, nil
 }
 
-func (o *OpaProvider) GetPolicyInfo(integration policyprovider.IntegrationInfo, _ policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+func (o *OpaProvider) GetPolicyInfo(integration policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+    return o.GetPolicyInfoContext(context.Background(), integration, appInfo)
+}
+
+func (o *OpaProvider) GetPolicyInfoContext(ctx context.Context, integration policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
     key := integration.Key
-    client, err := o.ConfigureClient(key)
+    client, err := o.ConfigureClientContext(ctx, key)
     if err != nil {
         msg := fmt.Sprintf("open-policy-agent, unable to build client: %s", err)
         log.Error(msg)
@@ -96,6 +114,10 @@ func (o *OpaProvider) GetPolicyInfo(integration policyprovider.IntegrationInfo,
 }
 
 func (o *OpaProvider) SetPolicyInfo(integration policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
+    return o.SetPolicyInfoContext(context.Background(), integration, appInfo, policyInfos)
+}
+
+func (o *OpaProvider) SetPolicyInfoContext(ctx context.Context, integration policyprovider.IntegrationInfo, appInfo policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (int, error) {
     validate := validator.New() // todo - move this up?
     errApp := validate.Struct(appInfo)
     if errApp != nil {
@@ -107,7 +129,7 @@ func (o *OpaProvider) SetPolicyInfo(integration policyprovider.IntegrationInfo,
     }
 
     key := integration.Key
-    client, err := o.ConfigureClient(key)
+    client, err := o.ConfigureClientContext(ctx, key)
     if err != nil {
         log.Warn("open-policy-agent, unable to build client: %s", err)
         return http.StatusInternalServerError, fmt.Errorf("invalid client: %w", err)
@@ -158,6 +180,18 @@ func (o *OpaProvider) SetPolicyInfo(integration policyprovider.IntegrationInfo,
     return client.PostBundle(bundle.Bytes())
 }
 
+/*
+MapPolicyReport reports each policy as mapped without loss because IDQL policies are stored unchanged in the OPA bundle
+(see policyprovider.MappingReporter). Conditions are evaluated by the HexaFilter extension of the OPA server.
+*/
+func (o *OpaProvider) MapPolicyReport(_ policyprovider.IntegrationInfo, _ policyprovider.ApplicationInfo, policyInfos []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+    report := hexapolicy.NewMappingReport(o.Name())
+    for i, policyInfo := range policyInfos {
+        report.ExactPolicy(i, policyInfo)
+    }
+    return report, nil
+}
+
 // MakeHexaBundle will generate a default bundle with current rego. If data is nil, an empty set of policies is generated.
 func MakeHexaBundle(data []byte) (bytes.Buffer, error) {
 
@@ -283,6 +317,17 @@ func (o *OpaProvider) IsOAuthClient() bool {
 }
 
 func (o *OpaProvider) ConfigureClient(key []byte) (BundleClient, error) {
+    return o.ConfigureClientContext(context.Background(), key)
+}
+
+/*
+ConfigureClientContext is ConfigureClient where the requests of the bundle client are made with ctx. The client
+timeouts still apply, so a deadline of ctx only shortens them. BundleClientOverride is returned unchanged.
+*/
+func (o *OpaProvider) ConfigureClientContext(ctx context.Context, key []byte) (BundleClient, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
 
     integrationCredential, err := o.credentials(key)
     if err != nil {
@@ -290,7 +335,8 @@ func (o *OpaProvider) ConfigureClient(key []byte) (BundleClient, error) {
     }
 
     if integrationCredential.GCP != nil {
-        return NewGCPBundleClient(
+        return NewGCPBundleClientContext(
+            ctx,
             integrationCredential.GCP.BucketName,
             integrationCredential.GCP.ObjectName,
             integrationCredential.GCP.Key,
@@ -298,7 +344,8 @@ func (o *OpaProvider) ConfigureClient(key []byte) (BundleClient, error) {
     }
 
     if integrationCredential.AWS != nil {
-        return NewAWSBundleClient(
+        return NewAWSBundleClientContext(
+            ctx,
             integrationCredential.AWS.BucketName,
             integrationCredential.AWS.ObjectName,
             integrationCredential.AWS.Key,
@@ -307,7 +354,8 @@ func (o *OpaProvider) ConfigureClient(key []byte) (BundleClient, error) {
     }
 
     if integrationCredential.GITHUB != nil {
-        return NewGithubBundleClient(
+        return NewGithubBundleClientContext(
+            ctx,
             integrationCredential.GITHUB.Account,
             integrationCredential.GITHUB.Repo,
             integrationCredential.GITHUB.BundlePath,
@@ -364,5 +412,6 @@ func (o *OpaProvider) ConfigureClient(key []byte) (BundleClient, error) {
         BundleServerURL: bundleUrl.String(),
         HttpClient:      o.HttpClient,
         Authorization:   authorization,
+        Context:         ctx,
     }, nil
 }
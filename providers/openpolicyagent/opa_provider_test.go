@@ -87,7 +87,8 @@ func TestDiscoverApplications(t *testing.T) {
     "bucket_name": "opa-bundles",
     "object_name": "bundle.tar.gz",
 	"key": {
-      "region": "us-west-1"
+      "region": "us-west-1",
+      "defaultChain": true
     }
   }
 }
@@ -182,7 +183,8 @@ func TestOpaProvider_EnsureClientIsAvailable(t *testing.T) {
     "bucket_name": "opa-bundles",
     "object_name": "bundle.tar.gz",
 	"key": {
-      "region": "us-west-1"
+      "region": "us-west-1",
+      "defaultChain": true
     }
   }
 }
@@ -261,6 +263,33 @@ func TestGetPolicyInfo(t *testing.T) {
     assert.Equal(t, 4, len(policies))
 }
 
+func TestGetPolicyInfoContext(t *testing.T) {
+    // the bundle server does not respond until the request is abandoned
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        <-r.Context().Done()
+    }))
+    defer server.Close()
+    info := policyprovider.IntegrationInfo{Name: openpolicyagent.ProviderTypeOpa, Key: []byte(fmt.Sprintf(`{"bundle_url": "%s"}`, server.URL))}
+    p := openpolicyagent.OpaProvider{}
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    _, err := p.GetPolicyInfoContext(ctx, info, policyprovider.ApplicationInfo{})
+    assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+    // a cancelled context stops the request before the bundle client is called
+    m := &openpolicyagenttest.MockBundleClient{}
+    p = openpolicyagent.OpaProvider{BundleClientOverride: m}
+    cancelled, cancelNow := context.WithCancel(context.Background())
+    cancelNow()
+    _, err = p.GetPolicyInfoContext(cancelled, info, policyprovider.ApplicationInfo{})
+    assert.ErrorIs(t, err, context.Canceled)
+    status, err := p.SetPolicyInfoContext(cancelled, info, policyprovider.ApplicationInfo{ObjectID: "anObjectId", Name: "aName", Description: "aDescription"}, []hexapolicy.PolicyInfo{})
+    assert.ErrorIs(t, err, context.Canceled)
+    assert.Equal(t, http.StatusInternalServerError, status)
+    assert.Nil(t, m.ArgPostBundle)
+}
+
 func TestGetPolicyInfo_withBadKey(t *testing.T) {
     p := openpolicyagent.OpaProvider{
         BundleClientOverride: &openpolicyagenttest.MockBundleClient{},
@@ -347,6 +376,25 @@ func TestSetPolicyInfo(t *testing.T) {
     assert.True(t, strings.Contains(*meta.PolicyId, "aResourceId_"), "Policy id was generated")
 }
 
+func TestMapPolicyReport(t *testing.T) {
+    mockClient := &openpolicyagenttest.MockBundleClient{}
+    p := openpolicyagent.OpaProvider{BundleClientOverride: mockClient}
+    policies, err := hexapolicysupport.ParsePolicies([]byte(`[
+  {"meta": {"version": "0.7"}, "subjects": ["allusers"], "actions": ["http:GET"], "object": "aResourceId"},
+  {"meta": {"version": "0.7"}, "subjects": ["anyAuthenticated"], "actions": ["http:POST"], "object": "aResourceId",
+   "condition": {"rule": "req.ip sw 127", "action": "deny"}}
+]`))
+    assert.NoError(t, err)
+
+    report, err := p.MapPolicyReport(policyprovider.IntegrationInfo{Name: openpolicyagent.ProviderTypeOpa}, policyprovider.ApplicationInfo{ObjectID: "anotherResourceId"}, policies)
+    assert.NoError(t, err)
+    assert.Equal(t, openpolicyagent.ProviderTypeOpa, report.Target)
+    assert.False(t, report.IsLossy())
+    assert.Len(t, report.Policies, 2)
+    assert.Len(t, report.Policies[1].Elements, 4)
+    assert.Nil(t, mockClient.ArgPostBundle, "no bundle should be posted")
+}
+
 func TestSetPolicyInfo_withInvalidArguments(t *testing.T) {
     key := []byte(`
 {
@@ -2,6 +2,7 @@ package openpolicyagent
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -21,6 +22,7 @@ development purposes.
 type OpaBundleClient struct {
 	OpaServerUrl string
 	HttpClient   HTTPClient
+	Context      context.Context // Context of the client's requests (context.Background() when nil)
 }
 
 type OpaDataResponse struct {
@@ -36,7 +38,7 @@ func (b *OpaBundleClient) GetDataFromBundle(_ string) ([]byte, error) {
 	}
 
 	policyDataUrl := opaUrl.JoinPath(PolicyDataPath)
-	get, getErr := b.HttpClient.Get(policyDataUrl.String())
+	get, getErr := contextRequest(b.Context, b.HttpClient, policyDataUrl.String(), "", nil)
 	if getErr != nil {
 		return nil, getErr
 	}
@@ -68,6 +70,6 @@ func (b *OpaBundleClient) PostBundle(bundle []byte) (int, error) {
 	_ = writer.Close()
 	parse, _ := url.Parse(b.OpaServerUrl)
 	contentType := writer.FormDataContentType()
-	resp, err := b.HttpClient.Post(fmt.Sprintf("%s://%s/bundles", parse.Scheme, parse.Host), contentType, buf)
+	resp, err := contextRequest(b.Context, b.HttpClient, fmt.Sprintf("%s://%s/bundles", parse.Scheme, parse.Host), contentType, buf)
 	return resp.StatusCode, err
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/policyInfoModel"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 )
 
@@ -20,12 +21,18 @@ type MockProvider struct {
 	Policies []hexapolicy.PolicyInfo
 	PapId    string
 	Info     policyprovider.IntegrationInfo
+	Schema   policyInfoModel.Namespaces
+	Created  []policyprovider.ApplicationInfo // applications added by CreateApplication
 }
 
 func (p *MockProvider) Name() string {
 	return ProviderTypeMock
 }
 
+func (p *MockProvider) Capabilities() policyprovider.Capabilities {
+	return policyprovider.FullCapabilities
+}
+
 func (p *MockProvider) checkInit() {
 	if p.PapId == "" {
 		p.PapId = PapIdTest
@@ -39,7 +46,7 @@ func (p *MockProvider) DiscoverApplications(info policyprovider.IntegrationInfo)
 		Description: "Mock PAP",
 		Service:     info.Name,
 	}
-	return []policyprovider.ApplicationInfo{app}, nil
+	return append([]policyprovider.ApplicationInfo{app}, p.Created...), nil
 }
 
 func (p *MockProvider) GetPolicyInfo(info policyprovider.IntegrationInfo, pap policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
@@ -98,6 +105,59 @@ func (p *MockProvider) Reconcile(info policyprovider.IntegrationInfo, app policy
 	}
 
 	existingPolicies := hexapolicy.Policies{Policies: p.Policies, App: &app.ObjectID}
-	return existingPolicies.ReconcilePolicies(comparePolicies, diffsOnly), nil
+	return existingPolicies.ReconcilePoliciesWithScopes(comparePolicies, diffsOnly), nil
+
+}
+
+func (p *MockProvider) checkApp(info policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo) error {
+	p.checkInit()
+	if info.Name != p.Info.Name || !bytes.Equal(p.Info.Key, info.Key) {
+		return errors.New("invalid integration")
+	}
+	if app.ObjectID == p.PapId {
+		return nil
+	}
+	for _, created := range p.Created {
+		if created.ObjectID == app.ObjectID {
+			return nil
+		}
+	}
+	return errors.New("invalid PAP object id")
+}
 
+func (p *MockProvider) GetSchema(info policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo) (*policyInfoModel.Namespaces, error) {
+	if err := p.checkApp(info, app); err != nil {
+		return nil, err
+	}
+	schema := policyInfoModel.Namespaces{}
+	for k, v := range p.Schema {
+		schema[k] = v
+	}
+	return &schema, nil
+}
+
+func (p *MockProvider) SetSchema(info policyprovider.IntegrationInfo, app policyprovider.ApplicationInfo, namespaces policyInfoModel.Namespaces) error {
+	if err := p.checkApp(info, app); err != nil {
+		return err
+	}
+	if len(namespaces) == 0 {
+		return errors.New("at least one namespace is required")
+	}
+	p.Schema = namespaces
+	return nil
+}
+
+func (p *MockProvider) CreateApplication(info policyprovider.IntegrationInfo, description string, _ map[string]string) (policyprovider.ApplicationInfo, error) {
+	p.checkInit()
+	if info.Name != p.Info.Name || !bytes.Equal(p.Info.Key, info.Key) {
+		return policyprovider.ApplicationInfo{}, errors.New("invalid integration")
+	}
+	app := policyprovider.ApplicationInfo{
+		ObjectID:    uuid.New().String(),
+		Name:        ProviderTypeMock,
+		Description: description,
+		Service:     info.Name,
+	}
+	p.Created = append(p.Created, app)
+	return app, nil
 }
@@ -1,12 +1,15 @@
 package sdk
 
 import (
+    "net/http"
     "testing"
 
     "github.com/hexa-org/policy-mapper/api/policyprovider"
     "github.com/hexa-org/policy-mapper/providers/aws/avpProvider"
     "github.com/hexa-org/policy-mapper/providers/aws/avpProvider/avpClient/avpTestSupport"
+    "github.com/hexa-org/policy-mapper/providers/aws/awsIamProvider"
     "github.com/hexa-org/policy-mapper/providers/aws/awscommon"
+    "github.com/hexa-org/policy-mapper/providers/googlecloud/iamProvider"
     "github.com/stretchr/testify/assert"
 )
 
@@ -126,3 +129,39 @@ func TestWithAttributeMap(t *testing.T) {
         assert.Fail(t, "Expecting an Amazon AVP Provider!")
     }
 }
+
+func TestWithGoogleIamIntegration(t *testing.T) {
+    info := policyprovider.IntegrationInfo{
+        Name: ProviderTypeGoogleCloudIAM,
+        Key:  []byte(`{"type": "service_account", "project_id": "google-cloud-project-id"}`),
+    }
+    integration, err := OpenIntegration(WithIntegrationInfo(info), WithHttpClient(&http.Client{}), WithAttributeMap(map[string]string{"username": "account"}))
+    assert.NoError(t, err)
+
+    switch prov := integration.provider.(type) {
+    case *iamProvider.GoogleIamProvider:
+        assert.NotNil(t, prov.GcpMapper)
+        assert.NotNil(t, prov.HttpClientOverride)
+    default:
+        assert.Fail(t, "Expecting a Google IAM Provider!")
+    }
+
+    _, err = OpenIntegration(WithIntegrationInfo(info), WithProviderOptions("unsupported"))
+    assert.Error(t, err)
+}
+
+func TestWithAwsIamIntegration(t *testing.T) {
+    info := policyprovider.IntegrationInfo{Name: ProviderTypeAwsIam, Key: avpTestSupport.IntegrationInfo().Key}
+    options := awscommon.AWSClientOptions{DenyLongLivedKeys: true}
+    integration, err := OpenIntegration(WithIntegrationInfo(info), WithHttpClient(&http.Client{}), WithProviderOptions(options), WithAttributeMap(map[string]string{"username": "aws:username"}))
+    assert.NoError(t, err)
+
+    switch prov := integration.provider.(type) {
+    case *awsIamProvider.AwsIamProvider:
+        assert.NotNil(t, prov.Mapper)
+        assert.NotNil(t, prov.AwsClientOpts.HTTPClient)
+        assert.True(t, prov.AwsClientOpts.DenyLongLivedKeys)
+    default:
+        assert.Fail(t, "Expecting an AWS IAM Provider!")
+    }
+}
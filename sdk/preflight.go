@@ -0,0 +1,149 @@
+package sdk
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+)
+
+// PolicyProblem describes why the policy at Index is not compatible with a provider's Capabilities
+type PolicyProblem struct {
+	Index    int
+	PolicyId string
+	Problem  string
+}
+
+func (p PolicyProblem) String() string {
+	if p.PolicyId != "" {
+		return fmt.Sprintf("policy %d (%s): %s", p.Index, p.PolicyId, p.Problem)
+	}
+	return fmt.Sprintf("policy %d: %s", p.Index, p.Problem)
+}
+
+// PreflightError is returned by CheckPolicies when one or more policies use features a provider does not support
+type PreflightError struct {
+	Provider string
+	Problems []PolicyProblem
+}
+
+func (e *PreflightError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("%d policy problem(s) found for provider %s:", len(e.Problems), e.Provider))
+	for _, problem := range e.Problems {
+		sb.WriteString("\n  ")
+		sb.WriteString(problem.String())
+	}
+	return sb.String()
+}
+
+/*
+CheckPolicies validates policies against the capabilities of the named provider. If any policy uses a feature the
+provider does not support, a *PreflightError listing the problems of each policy is returned.
+*/
+func CheckPolicies(provider string, capabilities policyprovider.Capabilities, policies []hexapolicy.PolicyInfo) error {
+	var problems []PolicyProblem
+	for i, policy := range policies {
+		policyId := ""
+		if policy.Meta.PolicyId != nil {
+			policyId = *policy.Meta.PolicyId
+		}
+		for _, problem := range checkPolicy(capabilities, policy) {
+			problems = append(problems, PolicyProblem{Index: i, PolicyId: policyId, Problem: problem})
+		}
+	}
+	if len(problems) > 0 {
+		return &PreflightError{Provider: provider, Problems: problems}
+	}
+	return nil
+}
+
+func checkPolicy(capabilities policyprovider.Capabilities, policy hexapolicy.PolicyInfo) []string {
+	var problems []string
+	if policy.Condition != nil {
+		if !capabilities.Conditions {
+			problems = append(problems, "conditions are not supported")
+		} else if policy.Condition.Action == conditions.ADeny && !capabilities.DenyConditions {
+			problems = append(problems, "deny conditions are not supported")
+		}
+	}
+	if policy.Scope != nil && !capabilities.Scopes {
+		problems = append(problems, "scopes are not supported")
+	}
+	if !capabilities.Templates && isTemplate(policy) {
+		problems = append(problems, "policy templates are not supported")
+	}
+	if len(policy.Actions) > 1 && !capabilities.MultipleActions {
+		problems = append(problems, fmt.Sprintf("only one action is supported (found %d)", len(policy.Actions)))
+	}
+	if !capabilities.Wildcards {
+		if len(policy.Subjects) == 0 || slices.ContainsFunc(policy.Subjects, isAnySubject) {
+			problems = append(problems, "policies must name their subjects (any and anyAuthenticated are not supported)")
+		}
+		if len(policy.Actions) == 0 {
+			problems = append(problems, "policies must have at least one action")
+		}
+		if capabilities.Objects && policy.Object == "" {
+			problems = append(problems, "policies must have an object")
+		}
+	}
+	for _, subject := range policy.Subjects {
+		if !isAnySubject(subject) && !matchesType(capabilities.SubjectTypes, subject) {
+			problems = append(problems, fmt.Sprintf("subject %s is not one of the supported types %v", subject, capabilities.SubjectTypes))
+		}
+	}
+	for _, action := range policy.Actions {
+		if !matchesType(capabilities.ActionTypes, action.String()) {
+			problems = append(problems, fmt.Sprintf("action %s is not one of the supported types %v", action, capabilities.ActionTypes))
+		}
+	}
+	return problems
+}
+
+func isAnySubject(subject string) bool {
+	return strings.EqualFold(subject, hexapolicy.SubjectAnyUser) || strings.EqualFold(subject, hexapolicy.SubjectAnyAuth)
+}
+
+// isTemplate returns true if the policy contains template slots (e.g. ?principal)
+func isTemplate(policy hexapolicy.PolicyInfo) bool {
+	return slices.ContainsFunc(policy.Subjects, func(subject string) bool {
+		return strings.Contains(subject, "?principal")
+	}) || strings.Contains(policy.Object.String(), "?resource")
+}
+
+// matchesType returns true if types is empty or value matches one of types (see policyprovider.Capabilities SubjectTypes)
+func matchesType(types []string, value string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(types, func(valueType string) bool {
+		if strings.HasSuffix(valueType, ":") {
+			return strings.HasPrefix(value, valueType)
+		}
+		return value == valueType
+	})
+}
+
+/*
+GetCapabilities returns the policy features supported by the integration's provider. Providers that do not advertise
+capabilities are assumed to support all features (see policyprovider.FullCapabilities).
+*/
+func (i *Integration) GetCapabilities() policyprovider.Capabilities {
+	i.checkOpen()
+	if cp, ok := i.provider.(policyprovider.CapabilityProvider); ok {
+		return cp.Capabilities()
+	}
+	return policyprovider.FullCapabilities
+}
+
+/*
+CheckPolicies is a pre-flight check that validates policies against the integration provider's capabilities before
+calling SetPolicyInfo. A *PreflightError describing each incompatible policy is returned when a problem is found.
+*/
+func (i *Integration) CheckPolicies(policies []hexapolicy.PolicyInfo) error {
+	capabilities := i.GetCapabilities()
+	return CheckPolicies(i.provider.Name(), capabilities, policies)
+}
@@ -0,0 +1,81 @@
+package sdk
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/providers/azure/azureProvider"
+	"github.com/hexa-org/policy-mapper/providers/googlecloud/iamProvider"
+	"github.com/hexa-org/policy-mapper/providers/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPolicies(t *testing.T) {
+	policyId := "denyPolicy"
+	policies := []hexapolicy.PolicyInfo{
+		{
+			Subjects: hexapolicy.SubjectInfo{"user:alice@example.com"},
+			Actions:  []hexapolicy.ActionInfo{"gcp:roles/viewer"},
+			Object:   "aResource",
+		},
+		{
+			Meta:      hexapolicy.MetaInfo{PolicyId: &policyId},
+			Subjects:  hexapolicy.SubjectInfo{"group:admins@example.com"},
+			Actions:   []hexapolicy.ActionInfo{"gcp:roles/editor"},
+			Object:    "aResource",
+			Condition: &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: conditions.ADeny},
+		},
+		{
+			Subjects: hexapolicy.SubjectInfo{"any", "User:\"alice\""},
+			Object:   "?resource",
+			Scope:    &hexapolicy.ScopeInfo{Attributes: []string{"username"}},
+		},
+	}
+
+	err := CheckPolicies("iam", (&iamProvider.GoogleIamProvider{}).Capabilities(), policies)
+	var preflightErr *PreflightError
+	assert.True(t, errors.As(err, &preflightErr))
+	assert.Equal(t, "iam", preflightErr.Provider)
+	assert.Equal(t, []string{
+		"policy 1 (denyPolicy): deny conditions are not supported",
+		"policy 2: scopes are not supported",
+		"policy 2: policy templates are not supported",
+		"policy 2: policies must name their subjects (any and anyAuthenticated are not supported)",
+		"policy 2: policies must have at least one action",
+		"policy 2: subject User:\"alice\" is not one of the supported types " + "[allUsers allAuthenticatedUsers user: group: serviceAccount: domain: principal: principalSet: deleted: projectOwner: projectEditor: projectViewer:]",
+	}, problemStrings(preflightErr.Problems))
+	assert.Contains(t, err.Error(), "6 policy problem(s) found for provider iam:\n  policy 1 (denyPolicy)")
+
+	err = CheckPolicies("azure", (&azureProvider.AzureProvider{}).Capabilities(), []hexapolicy.PolicyInfo{{
+		Subjects:  hexapolicy.SubjectInfo{"user:alice@example.com", "group:admins", "role:admins"},
+		Actions:   []hexapolicy.ActionInfo{"azure:role1", "azure:role2"},
+		Condition: &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: conditions.AAllow},
+	}})
+	assert.True(t, errors.As(err, &preflightErr))
+	assert.Equal(t, []string{
+		"policy 0: conditions are not supported",
+		"policy 0: subject role:admins is not one of the supported types [user: group: sp:]",
+	}, problemStrings(preflightErr.Problems), "azure ignores objects so none is required")
+
+	assert.NoError(t, CheckPolicies("full", policyprovider.FullCapabilities, policies))
+	assert.NoError(t, CheckPolicies("rar", policyprovider.Capabilities{ActionTypes: []string{"http:"}, Objects: true},
+		[]hexapolicy.PolicyInfo{{Subjects: hexapolicy.SubjectInfo{"role1"}, Actions: []hexapolicy.ActionInfo{"http:GET"}, Object: "/path"}}))
+}
+
+func TestIntegration_CheckPolicies(t *testing.T) {
+	integration, err := OpenIntegration(WithIntegrationInfo(policyprovider.IntegrationInfo{Name: test.ProviderTypeMock, Key: []byte("key")}))
+	assert.NoError(t, err)
+	assert.Equal(t, policyprovider.FullCapabilities, integration.GetCapabilities())
+	assert.NoError(t, integration.CheckPolicies([]hexapolicy.PolicyInfo{{Subjects: hexapolicy.SubjectInfo{"any"}}}))
+}
+
+func problemStrings(problems []PolicyProblem) []string {
+	res := make([]string, len(problems))
+	for i, problem := range problems {
+		res[i] = problem.String()
+	}
+	return res
+}
@@ -1,18 +1,23 @@
 package sdk
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/models/policyInfoModel"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 	"github.com/hexa-org/policy-mapper/providers/aws/avpProvider"
+	"github.com/hexa-org/policy-mapper/providers/aws/awsIamProvider"
 	"github.com/hexa-org/policy-mapper/providers/azure/azureProvider"
+	"github.com/hexa-org/policy-mapper/providers/azure/azureRbacProvider"
 	"github.com/hexa-org/policy-mapper/providers/openpolicyagent"
 
 	"github.com/hexa-org/policy-mapper/providers/aws/awsapigwProvider"
 	"github.com/hexa-org/policy-mapper/providers/aws/cognitoProvider"
+	"github.com/hexa-org/policy-mapper/providers/googlecloud/iamProvider"
 	"github.com/hexa-org/policy-mapper/providers/googlecloud/iapProvider"
 	"github.com/hexa-org/policy-mapper/providers/test"
 )
@@ -21,14 +26,20 @@ const (
 	ProviderTypeAvp               string = avpProvider.ProviderTypeAvp
 	ProviderTypeGoogleCloudIAP           = iapProvider.ProviderTypeGoogleCloudIAP
 	ProviderTypeGoogleCloudLegacy        = iapProvider.ProviderTypeGoogleCloud
+	ProviderTypeGoogleCloudIAM           = iamProvider.ProviderTypeGoogleCloudIAM
 	ProviderTypeMock              string = test.ProviderTypeMock
 	ProviderTypeCognito           string = cognitoProvider.ProviderTypeAwsCognito
 	ProviderTypeAwsApiGW          string = awsapigwProvider.ProviderTypeAwsApiGW
+	ProviderTypeAwsIam            string = awsIamProvider.ProviderTypeAwsIam
 	ProviderTypeAzure             string = azureProvider.ProviderTypeAzure
+	ProviderTypeAzureRbac         string = azureRbacProvider.ProviderTypeAzureRbac
 	ProviderTypeOpa                      = openpolicyagent.ProviderTypeOpa
 	EnvTestProvider               string = "HEXA_TEST_PROVIDER" // EnvTestProvider overrides whatever provider is requested and uses the specified provider instead (by name)
 )
 
+// SettingAvpValidationMode is the CreateApplication setting for the AVP policy store validation mode (STRICT or OFF)
+const SettingAvpValidationMode = avpProvider.SettingValidationMode
+
 type Integration struct {
 	Alias    string                                    `json:"alias"`
 	Opts     Options                                   `json:"options"`
@@ -88,6 +99,14 @@ points available within a platform Integration. The 'aliasGen' func parameter is
 application. If 'nil' is passed, the ObjectId value from ApplicationInfo is used as the alias.
 */
 func (i *Integration) GetPolicyApplicationPoints(aliasGen func() string) ([]policyprovider.ApplicationInfo, error) {
+	return i.GetPolicyApplicationPointsContext(context.Background(), aliasGen)
+}
+
+/*
+GetPolicyApplicationPointsContext is GetPolicyApplicationPoints where ctx bounds the discovery. See
+policyprovider.WithContext for how providers that do not accept a context are cancelled.
+*/
+func (i *Integration) GetPolicyApplicationPointsContext(ctx context.Context, aliasGen func() string) ([]policyprovider.ApplicationInfo, error) {
 	i.checkOpen()
 
 	aliasMap := map[string]string{}
@@ -100,7 +119,7 @@ func (i *Integration) GetPolicyApplicationPoints(aliasGen func() string) ([]poli
 	var apps []policyprovider.ApplicationInfo
 	var err error
 
-	apps, err = i.provider.DiscoverApplications(*i.Opts.Info)
+	apps, err = policyprovider.WithContext(i.provider).DiscoverApplicationsContext(ctx, *i.Opts.Info)
 	if err != nil {
 		return nil, err
 	}
@@ -127,8 +146,13 @@ func (i *Integration) GetPolicyApplicationPoints(aliasGen func() string) ([]poli
 }
 
 func (i *Integration) GetApplicationInfo(papAlias string) (*policyprovider.ApplicationInfo, error) {
+	return i.GetApplicationInfoContext(context.Background(), papAlias)
+}
+
+// GetApplicationInfoContext is GetApplicationInfo where ctx bounds the discovery made when no applications are known
+func (i *Integration) GetApplicationInfoContext(ctx context.Context, papAlias string) (*policyprovider.ApplicationInfo, error) {
 	if i.Apps == nil {
-		_, err := i.GetPolicyApplicationPoints(nil)
+		_, err := i.GetPolicyApplicationPointsContext(ctx, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -152,16 +176,21 @@ func (i *Integration) GetApplicationInfo(papAlias string) (*policyprovider.Appli
 GetPolicies queries the designated 'pap' and returns a set of mapped hexapolicy.PolicyInfo policies.
 */
 func (i *Integration) GetPolicies(papAlias string) (*hexapolicy.Policies, error) {
+	return i.GetPoliciesContext(context.Background(), papAlias)
+}
+
+// GetPoliciesContext is GetPolicies where ctx bounds the retrieval of the policies
+func (i *Integration) GetPoliciesContext(ctx context.Context, papAlias string) (*hexapolicy.Policies, error) {
 	i.checkOpen()
 	var err error
-	app, err := i.GetApplicationInfo(papAlias)
+	app, err := i.GetApplicationInfoContext(ctx, papAlias)
 	if err != nil {
 		return nil, err
 	}
 
 	var pols []hexapolicy.PolicyInfo
 
-	pols, err = i.provider.GetPolicyInfo(*i.Opts.Info, *app)
+	pols, err = policyprovider.WithContext(i.provider).GetPolicyInfoContext(ctx, *i.Opts.Info, *app)
 	if err != nil {
 		return nil, err
 	}
@@ -178,12 +207,20 @@ set replaces all policies or does a reconciliation and performs the necessary ch
 Note: SetPolicyInfo does not support the setting of an individual policy.
 */
 func (i *Integration) SetPolicyInfo(papAlias string, policies []hexapolicy.PolicyInfo) (int, error) {
+	return i.SetPolicyInfoContext(context.Background(), papAlias, policies)
+}
+
+/*
+SetPolicyInfoContext is SetPolicyInfo where ctx bounds the update. A provider may have applied some of the changes when
+ctx is done during the update.
+*/
+func (i *Integration) SetPolicyInfoContext(ctx context.Context, papAlias string, policies []hexapolicy.PolicyInfo) (int, error) {
 	i.checkOpen()
-	app, err := i.GetApplicationInfo(papAlias)
+	app, err := i.GetApplicationInfoContext(ctx, papAlias)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	return i.provider.SetPolicyInfo(*i.Opts.Info, *app, policies)
+	return policyprovider.WithContext(i.provider).SetPolicyInfoContext(ctx, *i.Opts.Info, *app, policies)
 }
 
 /*
@@ -192,20 +229,126 @@ Setting 'diffsOnly' to false will return results that include matched and unsupp
 provider implementation does not support reconcile, an error is returned.
 */
 func (i *Integration) ReconcilePolicy(papAlias string, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
+	return i.ReconcilePolicyContext(context.Background(), papAlias, comparePolicies, diffsOnly)
+}
+
+// ReconcilePolicyContext is ReconcilePolicy where ctx bounds the retrieval of the policies of the 'pap'
+func (i *Integration) ReconcilePolicyContext(ctx context.Context, papAlias string, comparePolicies []hexapolicy.PolicyInfo, diffsOnly bool) ([]hexapolicy.PolicyDif, error) {
 	i.checkOpen()
-	app, err := i.GetApplicationInfo(papAlias)
+	app, err := i.GetApplicationInfoContext(ctx, papAlias)
 	if err != nil {
 		return []hexapolicy.PolicyDif{}, err
 	}
 	switch rp := i.provider.(type) {
+	case policyprovider.ContextReconciler:
+		return rp.ReconcileContext(ctx, *i.Opts.Info, *app, comparePolicies, diffsOnly)
 	case policyprovider.V2Provider:
-
+		if err = ctx.Err(); err != nil {
+			return []hexapolicy.PolicyDif{}, err
+		}
 		return rp.Reconcile(*i.Opts.Info, *app, comparePolicies, diffsOnly)
 	default:
-		existPolicies, err := i.GetPolicies(papAlias)
+		existPolicies, err := i.GetPoliciesContext(ctx, papAlias)
 		if err != nil {
 			return []hexapolicy.PolicyDif{}, err
 		}
+		if i.GetCapabilities().Scopes {
+			return existPolicies.ReconcilePoliciesWithScopes(comparePolicies, diffsOnly), nil
+		}
 		return existPolicies.ReconcilePolicies(comparePolicies, diffsOnly), nil
 	}
 }
+
+/*
+GetMappingReport returns a hexapolicy.MappingReport describing how faithfully the supplied policies would be represented
+by the integration's 'pap' (e.g. conditions that would be dropped). The 'pap' is not changed. If the provider
+implementation does not support mapping reports, an error is returned.
+*/
+func (i *Integration) GetMappingReport(papAlias string, policies []hexapolicy.PolicyInfo) (*hexapolicy.MappingReport, error) {
+	i.checkOpen()
+	app, err := i.GetApplicationInfo(papAlias)
+	if err != nil {
+		return nil, err
+	}
+	reporter, ok := i.provider.(policyprovider.MappingReporter)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not support mapping reports", i.provider.Name())
+	}
+	return reporter.MapPolicyReport(*i.Opts.Info, *app, policies)
+}
+
+/*
+GetSchema returns the schema of the integration's 'pap' as a policy information model. If the provider implementation
+does not support schemas, an error is returned.
+*/
+func (i *Integration) GetSchema(papAlias string) (*policyInfoModel.Namespaces, error) {
+	i.checkOpen()
+	app, err := i.GetApplicationInfo(papAlias)
+	if err != nil {
+		return nil, err
+	}
+	manager, ok := i.provider.(policyprovider.SchemaManager)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not support schemas", i.provider.Name())
+	}
+	return manager.GetSchema(*i.Opts.Info, *app)
+}
+
+// SetSchema replaces the schema of the integration's 'pap' with the namespaces of a policy information model
+func (i *Integration) SetSchema(papAlias string, namespaces policyInfoModel.Namespaces) error {
+	i.checkOpen()
+	app, err := i.GetApplicationInfo(papAlias)
+	if err != nil {
+		return err
+	}
+	manager, ok := i.provider.(policyprovider.SchemaManager)
+	if !ok {
+		return fmt.Errorf("provider %s does not support schemas", i.provider.Name())
+	}
+	return manager.SetSchema(*i.Opts.Info, *app, namespaces)
+}
+
+/*
+CompareSchema returns the differences between the schema of the integration's 'pap' and the namespaces of a policy
+information model (see policyInfoModel.CompareNamespaces). Namespaces that are not in the model are ignored unless
+allNamespaces is true.
+*/
+func (i *Integration) CompareSchema(papAlias string, namespaces policyInfoModel.Namespaces, allNamespaces bool) ([]policyInfoModel.SchemaDifference, error) {
+	current, err := i.GetSchema(papAlias)
+	if err != nil {
+		return nil, err
+	}
+	if !allNamespaces {
+		for ns := range *current {
+			if _, ok := namespaces[ns]; !ok {
+				delete(*current, ns)
+			}
+		}
+	}
+	return policyInfoModel.CompareNamespaces(*current, namespaces), nil
+}
+
+/*
+CreateApplication provisions a new policy application point (e.g. an AVP policy store) using provider specific settings
+and adds it to the integration's applications using an alias from aliasGen (or the ObjectID if nil).
+*/
+func (i *Integration) CreateApplication(description string, settings map[string]string, aliasGen func() string) (string, *policyprovider.ApplicationInfo, error) {
+	i.checkOpen()
+	creator, ok := i.provider.(policyprovider.ApplicationCreator)
+	if !ok {
+		return "", nil, fmt.Errorf("provider %s does not support creating policy application points", i.provider.Name())
+	}
+	app, err := creator.CreateApplication(*i.Opts.Info, description, settings)
+	if err != nil {
+		return "", nil, err
+	}
+	alias := app.ObjectID
+	if aliasGen != nil {
+		alias = aliasGen()
+	}
+	if i.Apps == nil {
+		i.Apps = make(map[string]policyprovider.ApplicationInfo)
+	}
+	i.Apps[alias] = app
+	return alias, &app, nil
+}
@@ -1,6 +1,7 @@
 package sdk
 
 import (
+    "context"
     "fmt"
     "log"
     "net/http"
@@ -10,10 +11,12 @@ import (
     "time"
 
     "github.com/hexa-org/policy-mapper/api/policyprovider"
+    "github.com/hexa-org/policy-mapper/models/policyInfoModel"
     "github.com/hexa-org/policy-mapper/pkg/hexapolicy"
     "github.com/hexa-org/policy-mapper/providers/aws/avpProvider"
     "github.com/hexa-org/policy-mapper/providers/aws/avpProvider/avpClient/avpTestSupport"
     "github.com/hexa-org/policy-mapper/providers/aws/awscommon"
+    "github.com/hexa-org/policy-mapper/providers/test"
     "github.com/stretchr/testify/assert"
     "github.com/stretchr/testify/suite"
 )
@@ -65,14 +68,15 @@ func (s *testSuite) Test1_GetPaps() {
 func (s *testSuite) Test2_GetPolicies() {
     s.mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
     s.mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
-    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    s.mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
 
     policySet, err := s.Integration.GetPolicies(s.papId)
     assert.NotNil(s.T(), policySet)
     policies := policySet.Policies
     assert.NoError(s.T(), err)
     assert.NotNil(s.T(), policies)
-    assert.Len(s.T(), policies, 2, "Should be 2 policies")
+    assert.Len(s.T(), policies, 3, "Should be 3 policies")
     assert.True(s.T(), s.mockClient.VerifyCalled())
 }
 
@@ -83,7 +87,8 @@ func (s *testSuite) Test3_Reconcile() {
     s.mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"2")
     s.mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"3")
     s.mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"4")
-    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    s.mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
 
     policySet, err := s.Integration.GetPolicies(s.papId)
     assert.NotNil(s.T(), policySet)
@@ -106,6 +111,9 @@ func (s *testSuite) Test3_Reconcile() {
     assert.True(s.T(), exist, "Check policy type exists")
     assert.Equal(s.T(), "TEMPLATE_LINKED", avpType, "Second [1] policy should be template")
 
+    // a template-linked policy inherits its actions from the template, so this is ignored
+    policies[1].Actions = []hexapolicy.ActionInfo{"hexa_avp:Action:\"Transfer\""}
+
     // this should cause a replacement (delete and add) to occur (subject change)
     policies[2].Subjects = []string{"hexa_avp::User::\"gerry@strata.io\""}
 
@@ -131,7 +139,8 @@ func (s *testSuite) Test3_Reconcile() {
     s.mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"2")
     s.mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"3")
     s.mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"4")
-    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    s.mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     difs, err := s.Integration.ReconcilePolicy(s.papId, policies, true)
     assert.NoError(s.T(), err)
     assert.True(s.T(), s.mockClient.VerifyCalled())
@@ -151,7 +160,8 @@ func (s *testSuite) Test3_Reconcile() {
 func (s *testSuite) Test4_SetPolicies() {
     s.mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
     s.mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
-    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    s.mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     policySet, err := s.Integration.GetPolicies(s.papId)
     assert.NotNil(s.T(), policySet)
     policies := policySet.Policies
@@ -166,7 +176,8 @@ func (s *testSuite) Test4_SetPolicies() {
 
     s.mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
     s.mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
-    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplatePolicyId+"0")
+    s.mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
     s.mockClient.MockUpdatePolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
     status, err := s.Integration.SetPolicyInfo(s.papId, policies)
     assert.NoError(s.T(), err)
@@ -174,3 +185,109 @@ func (s *testSuite) Test4_SetPolicies() {
     assert.Equal(s.T(), 200, status, "Should be status 200")
 
 }
+
+func (s *testSuite) Test5_MappingReport() {
+    s.mockClient.MockListPoliciesWithHttpStatus(http.StatusOK, 1, 1, nil)
+    s.mockClient.MockGetPolicyWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarStaticPolicyId+"0")
+    s.mockClient.MockListPolicyTemplatesWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    s.mockClient.MockGetPolicyTemplateWithHttpStatus(http.StatusOK, avpTestSupport.TestCedarTemplateId)
+    policySet, err := s.Integration.GetPolicies(s.papId)
+    assert.NoError(s.T(), err)
+    assert.True(s.T(), s.mockClient.VerifyCalled())
+
+    report, err := s.Integration.GetMappingReport(s.papId, policySet.Policies)
+    assert.NoError(s.T(), err)
+    assert.Len(s.T(), report.Policies, 3)
+
+    _, err = s.Integration.GetMappingReport("unknown", policySet.Policies)
+    assert.Error(s.T(), err)
+}
+
+func (s *testSuite) Test6_Schema() {
+    schema := `{"hexa_avp": {"entityTypes": {"User": {}}}, "other": {"entityTypes": {"Thing": {}}}}`
+    local := policyInfoModel.Namespaces{"hexa_avp": {EntityTypes: map[string]policyInfoModel.EntityType{"User": {}, "Account": {}}}}
+
+    s.mockClient.MockGetSchemaWithHttpStatus(http.StatusOK, schema, "hexa_avp", "other")
+    difs, err := s.Integration.CompareSchema(s.papId, local, false)
+    assert.NoError(s.T(), err)
+    assert.Equal(s.T(), []policyInfoModel.SchemaDifference{
+        {Type: policyInfoModel.SchemaDifAdded, Namespace: "hexa_avp", Element: policyInfoModel.ElementEntityType, Name: "Account"},
+    }, difs)
+
+    s.mockClient.MockGetSchemaWithHttpStatus(http.StatusOK, schema, "hexa_avp", "other")
+    difs, err = s.Integration.CompareSchema(s.papId, local, true)
+    assert.NoError(s.T(), err)
+    assert.Len(s.T(), difs, 2)
+    assert.Equal(s.T(), policyInfoModel.SchemaDifRemoved, difs[1].Type)
+
+    s.mockClient.MockPutSchemaWithHttpStatus(http.StatusOK, "hexa_avp")
+    assert.NoError(s.T(), s.Integration.SetSchema(s.papId, local))
+    assert.True(s.T(), s.mockClient.VerifyCalled())
+
+    _, err = s.Integration.GetSchema("unknown")
+    assert.Error(s.T(), err)
+}
+
+func (s *testSuite) Test7_CreateApplication() {
+    s.mockClient.MockCreatePolicyStoreWithHttpStatus(http.StatusOK, "newStore")
+    alias, app, err := s.Integration.CreateApplication("A new store", map[string]string{avpProvider.SettingValidationMode: "STRICT"}, func() string {
+        return "new"
+    })
+    assert.NoError(s.T(), err)
+    assert.Equal(s.T(), "new", alias)
+    assert.Equal(s.T(), "newStore", app.ObjectID)
+    assert.Equal(s.T(), *app, s.Integration.Apps["new"])
+    assert.True(s.T(), s.mockClient.VerifyCalled())
+}
+
+// basicProvider exposes only the policyprovider.Provider methods of the provider it wraps
+type basicProvider struct {
+    policyprovider.Provider
+}
+
+func TestSchema_notSupported(t *testing.T) {
+    integration, err := OpenIntegration(WithIntegrationInfo(policyprovider.IntegrationInfo{Name: test.ProviderTypeMock, Key: []byte("key")}))
+    assert.NoError(t, err)
+    integration.provider = basicProvider{integration.provider}
+    apps, err := integration.GetPolicyApplicationPoints(nil)
+    assert.NoError(t, err)
+
+    _, err = integration.GetSchema(apps[0].ObjectID)
+    assert.EqualError(t, err, "provider mock does not support schemas")
+    err = integration.SetSchema(apps[0].ObjectID, policyInfoModel.Namespaces{})
+    assert.EqualError(t, err, "provider mock does not support schemas")
+    _, _, err = integration.CreateApplication("description", nil, nil)
+    assert.EqualError(t, err, "provider mock does not support creating policy application points")
+}
+
+func TestGetMappingReport_notSupported(t *testing.T) {
+    integration, err := OpenIntegration(WithIntegrationInfo(policyprovider.IntegrationInfo{Name: test.ProviderTypeMock, Key: []byte("key")}))
+    assert.NoError(t, err)
+    apps, err := integration.GetPolicyApplicationPoints(nil)
+    assert.NoError(t, err)
+
+    _, err = integration.GetMappingReport(apps[0].ObjectID, []hexapolicy.PolicyInfo{})
+    assert.EqualError(t, err, "provider mock does not support mapping reports")
+}
+
+func TestIntegration_Context(t *testing.T) {
+    integration, err := OpenIntegration(WithIntegrationInfo(policyprovider.IntegrationInfo{Name: test.ProviderTypeMock, Key: []byte("key")}))
+    assert.NoError(t, err)
+    apps, err := integration.GetPolicyApplicationPointsContext(context.Background(), nil)
+    assert.NoError(t, err)
+    policies, err := integration.GetPoliciesContext(context.Background(), apps[0].ObjectID)
+    assert.NoError(t, err)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+
+    _, err = integration.GetPolicyApplicationPointsContext(ctx, nil)
+    assert.ErrorIs(t, err, context.Canceled)
+    _, err = integration.GetPoliciesContext(ctx, apps[0].ObjectID)
+    assert.ErrorIs(t, err, context.Canceled)
+    status, err := integration.SetPolicyInfoContext(ctx, apps[0].ObjectID, policies.Policies)
+    assert.ErrorIs(t, err, context.Canceled)
+    assert.Equal(t, http.StatusInternalServerError, status)
+    _, err = integration.ReconcilePolicyContext(ctx, apps[0].ObjectID, policies.Policies, true)
+    assert.ErrorIs(t, err, context.Canceled)
+}
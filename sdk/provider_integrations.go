@@ -7,13 +7,17 @@ import (
     "os"
 
     "github.com/hexa-org/policy-mapper/api/policyprovider"
+    "github.com/hexa-org/policy-mapper/models/formats/awsIam"
     "github.com/hexa-org/policy-mapper/models/formats/cedar"
     "github.com/hexa-org/policy-mapper/models/formats/gcpBind"
     "github.com/hexa-org/policy-mapper/providers/aws/avpProvider"
+    "github.com/hexa-org/policy-mapper/providers/aws/awsIamProvider"
     "github.com/hexa-org/policy-mapper/providers/aws/awsapigwProvider"
     "github.com/hexa-org/policy-mapper/providers/aws/awscommon"
     "github.com/hexa-org/policy-mapper/providers/aws/cognitoProvider"
     "github.com/hexa-org/policy-mapper/providers/azure/azureProvider"
+    "github.com/hexa-org/policy-mapper/providers/azure/azureRbacProvider"
+    "github.com/hexa-org/policy-mapper/providers/googlecloud/iamProvider"
     "github.com/hexa-org/policy-mapper/providers/googlecloud/iapProvider"
     "github.com/hexa-org/policy-mapper/providers/openpolicyagent"
     "github.com/hexa-org/policy-mapper/providers/test"
@@ -52,14 +56,26 @@ func (i *Integration) open() error {
         i.provider, err = newAwsApiGWProvider(i.Opts)
         return err
 
+    case ProviderTypeAwsIam:
+        i.provider, err = newAwsIamProvider(i.Opts)
+        return err
+
     case ProviderTypeAzure:
         i.provider, err = newAzureProvider(i.Opts)
         return err
 
+    case ProviderTypeAzureRbac:
+        i.provider, err = newAzureRbacProvider(i.Opts)
+        return err
+
     case ProviderTypeGoogleCloudLegacy, ProviderTypeGoogleCloudIAP:
         i.provider, err = newGoogleProvider(i.Opts)
         return err
 
+    case ProviderTypeGoogleCloudIAM:
+        i.provider, err = newGoogleIamProvider(i.Opts)
+        return err
+
     case ProviderTypeOpa:
         i.provider, err = newOpaProvider(i.Opts)
         return err
@@ -91,6 +107,23 @@ func newAzureProvider(options Options) (policyprovider.Provider, error) {
     return ret, nil
 }
 
+func newAzureRbacProvider(options Options) (policyprovider.Provider, error) {
+    var ret *azureRbacProvider.AzureRbacProvider
+    if options.ProviderOpts != nil {
+        switch v := options.ProviderOpts.(type) {
+        case azureRbacProvider.ProviderOpt:
+            ret = azureRbacProvider.NewAzureRbacProvider(v)
+
+        default:
+            fmt.Println("Warning, unexpected ProviderOpts (use azureRbacProvider.ProviderOpt)")
+        }
+    }
+    if ret == nil {
+        ret = azureRbacProvider.NewAzureRbacProvider()
+    }
+    return ret, nil
+}
+
 func newAwsApiGWProvider(options Options) (policyprovider.Provider, error) {
     var ret *awsapigwProvider.AwsApiGatewayProvider
     if options.ProviderOpts != nil {
@@ -139,6 +172,41 @@ func newCognitoProvider(options Options) (policyprovider.Provider, error) {
     }, nil
 }
 
+func newAwsIamProvider(options Options) (policyprovider.Provider, error) {
+    opts := awscommon.AWSClientOptions{DisableRetry: true}
+    if options.HTTPClient != nil {
+        switch client := options.HTTPClient.(type) {
+        case awscommon.AWSHttpClient:
+            opts.HTTPClient = client
+        default:
+            return nil, errors.New("HTTPClient type supported, use WithHttpClient(awscommon.AWSHttpClient)")
+        }
+    }
+    if options.ProviderOpts != nil {
+        switch v := options.ProviderOpts.(type) {
+        case awscommon.AWSClientOptions:
+            if opts.HTTPClient != nil {
+                override := opts.HTTPClient
+                opts = v
+                opts.HTTPClient = override
+            } else {
+                opts = v
+            }
+        default:
+            fmt.Println("Warning, unexpected ProviderOpts (use awscommon.AWSClientOptions)")
+        }
+    }
+
+    nameMap := options.AttributeMap
+    if nameMap == nil {
+        nameMap = map[string]string{}
+    }
+    return &awsIamProvider.AwsIamProvider{
+        AwsClientOpts: opts,
+        Mapper:        awsIam.New(nameMap),
+    }, nil
+}
+
 func newAvpProvider(options Options) (policyprovider.Provider, error) {
     opts := awscommon.AWSClientOptions{DisableRetry: true}
     if options.HTTPClient != nil {
@@ -207,6 +275,34 @@ func newGoogleProvider(options Options) (policyprovider.Provider, error) {
     }, nil
 }
 
+func newGoogleIamProvider(options Options) (policyprovider.Provider, error) {
+
+    if options.ProviderOpts != nil {
+        return nil, errors.New("provider options not currently supported for " + ProviderTypeGoogleCloudIAM)
+    }
+
+    var httpClient iamProvider.HTTPClient
+    if options.HTTPClient != nil {
+        switch client := options.HTTPClient.(type) {
+        case iamProvider.HTTPClient:
+            httpClient = client
+        default:
+            return nil, errors.New("HTTPClient type not supported, use WithHttpClient(&http.Client{})")
+        }
+    }
+    var mapper *gcpBind.GooglePolicyMapper
+    if options.AttributeMap != nil {
+        mapper = gcpBind.New(options.AttributeMap)
+    } else {
+        mapper = gcpBind.New(map[string]string{})
+    }
+
+    return &iamProvider.GoogleIamProvider{
+        HttpClientOverride: httpClient,
+        GcpMapper:          mapper,
+    }, nil
+}
+
 func newOpaProvider(options Options) (policyprovider.Provider, error) {
 
     // TODO: Implement bundle client options (see tests)